@@ -0,0 +1,195 @@
+// Package apikey manages API keys which grant third parties scoped access to a subset of Sage's data
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ReadAccess allows reading in-scope data
+	ReadAccess = "read"
+	// WriteAccess allows reading and changing in-scope data
+	WriteAccess = "read-write"
+
+	keysBucket        = "apiKeys"
+	keysBucketVersion = "1"
+
+	idLength     = 12
+	secretLength = 32
+	separator    = "."
+)
+
+// Scope limits the data an API key can access
+type Scope struct {
+	// Access is either ReadAccess or WriteAccess
+	Access string
+	// Accounts are the account IDs the key can access. Empty allows all accounts.
+	Accounts []string `json:",omitempty"`
+	// Categories are the ledger categories, and their subcategories, the key can access. Empty allows all categories.
+	Categories []string `json:",omitempty"`
+}
+
+// Validate returns an error if the scope is malformed
+func (s Scope) Validate() error {
+	switch s.Access {
+	case ReadAccess, WriteAccess:
+	default:
+		return errors.Errorf("Access must be %q or %q: %q", ReadAccess, WriteAccess, s.Access)
+	}
+	for _, account := range s.Accounts {
+		if strings.TrimSpace(account) == "" {
+			return errors.New("Account IDs must not be empty")
+		}
+	}
+	for _, category := range s.Categories {
+		if strings.TrimSpace(category) == "" {
+			return errors.New("Categories must not be empty")
+		}
+	}
+	return nil
+}
+
+// Key grants scoped access to the API. Only a hash of the key's secret is stored.
+type Key struct {
+	ID      string
+	Label   string `json:",omitempty"`
+	Scope   Scope
+	Created time.Time
+}
+
+// storedKey includes the secret's hash, which is never exposed through the API
+type storedKey struct {
+	Key
+	Hash string
+}
+
+// Store manages API keys
+type Store struct {
+	mu     sync.Mutex
+	bucket plaindb.Bucket
+}
+
+// NewStore returns the API keys bucket
+func NewStore(db plaindb.DB) (*Store, error) {
+	bucket, err := db.Bucket(keysBucket, keysBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket: bucket,
+	}, err
+}
+
+// Create generates a new key with 'scope'. The returned secret key is only available once.
+func (s *Store) Create(label string, scope Scope, now time.Time) (secretKey string, key Key, err error) {
+	if err := scope.Validate(); err != nil {
+		return "", Key{}, err
+	}
+	id, err := randomString(idLength)
+	if err != nil {
+		return "", Key{}, err
+	}
+	secret, err := randomString(secretLength)
+	if err != nil {
+		return "", Key{}, err
+	}
+	key = Key{
+		ID:      id,
+		Label:   label,
+		Scope:   scope,
+		Created: now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.bucket.Put(id, storedKey{Key: key, Hash: hashSecret(secret)})
+	return id + separator + secret, key, err
+}
+
+// Revoke deletes the key with the given ID
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var key storedKey
+	found, err := s.bucket.Get(id, &key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("API key not found: %q", id)
+	}
+	return s.bucket.Put(id, nil)
+}
+
+// All returns all keys, sorted by creation time
+func (s *Store) All() ([]Key, error) {
+	var keys []Key
+	var key storedKey
+	err := s.bucket.Iter(&key, func(id string) bool {
+		keys = append(keys, key.Key)
+		return true
+	})
+	sort.Slice(keys, func(a, b int) bool {
+		return keys[a].Created.Before(keys[b].Created)
+	})
+	return keys, err
+}
+
+// Validate returns the key matching 'secretKey' if it exists. The secret comparison is constant-time.
+func (s *Store) Validate(secretKey string) (Key, bool) {
+	tokens := strings.SplitN(secretKey, separator, 2)
+	if len(tokens) != 2 {
+		return Key{}, false
+	}
+	id, secret := tokens[0], tokens[1]
+	var key storedKey
+	found, err := s.bucket.Get(id, &key)
+	if err != nil || !found {
+		// compare anyway to keep timing consistent with a found key
+		subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(hashSecret("")))
+		return Key{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.Hash)) != 1 {
+		return Key{}, false
+	}
+	return key.Key, true
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(length int) (string, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var key storedKey
+		err := json.Unmarshal(data, &key)
+		return key, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
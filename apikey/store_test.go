@@ -0,0 +1,94 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockDBStore(t *testing.T) *Store {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	store, err := NewStore(db)
+	require.NoError(t, err)
+	return store
+}
+
+func TestCreate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		description string
+		scope       Scope
+		expectErr   string
+	}{
+		{
+			description: "read only",
+			scope:       Scope{Access: ReadAccess, Accounts: []string{"1234"}},
+		},
+		{
+			description: "read write",
+			scope:       Scope{Access: WriteAccess, Categories: []string{"expenses:food"}},
+		},
+		{
+			description: "unrecognized access",
+			scope:       Scope{Access: "admin"},
+			expectErr:   `Access must be "read" or "read-write": "admin"`,
+		},
+		{
+			description: "empty account",
+			scope:       Scope{Access: ReadAccess, Accounts: []string{" "}},
+			expectErr:   "Account IDs must not be empty",
+		},
+		{
+			description: "empty category",
+			scope:       Scope{Access: ReadAccess, Categories: []string{""}},
+			expectErr:   "Categories must not be empty",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			store := mockDBStore(t)
+			secretKey, key, err := store.Create("label", tc.scope, now)
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(secretKey, key.ID+separator))
+			assert.Equal(t, tc.scope, key.Scope)
+
+			validated, valid := store.Validate(secretKey)
+			assert.True(t, valid)
+			assert.Equal(t, key, validated)
+
+			keys, err := store.All()
+			require.NoError(t, err)
+			assert.Equal(t, []Key{key}, keys)
+			var stored storedKey
+			_, err = store.bucket.Get(key.ID, &stored)
+			require.NoError(t, err)
+			assert.NotContains(t, stored.Hash, strings.SplitN(secretKey, separator, 2)[1], "Secrets should only be stored hashed")
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	store := mockDBStore(t)
+	secretKey, key, err := store.Create("label", Scope{Access: ReadAccess}, time.Now())
+	require.NoError(t, err)
+
+	for _, invalid := range []string{"", "no separator", key.ID + separator + "wrong secret", "missing" + separator + "secret"} {
+		_, valid := store.Validate(invalid)
+		assert.False(t, valid, "Key %q should be invalid", invalid)
+	}
+
+	require.NoError(t, store.Revoke(key.ID))
+	_, valid := store.Validate(secretKey)
+	assert.False(t, valid, "Revoked keys should be invalid")
+	assert.Error(t, store.Revoke(key.ID))
+}
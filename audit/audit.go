@@ -0,0 +1,167 @@
+// Package audit persists an append-only log of sync outcomes for long-term troubleshooting
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxSize is the size in bytes at which the log rotates
+	DefaultMaxSize = 10 << 20
+
+	rotatedSuffix = ".1"
+	redacted      = "****"
+	filePerm      = 0600
+)
+
+// Entry records the outcome of a single sync run
+type Entry struct {
+	Time     time.Time
+	Start    time.Time
+	End      time.Time
+	Accounts []AccountOutcome
+	// Imported is the number of downloaded transactions, before removing duplicates already in the ledger
+	Imported int
+	Error    string `json:",omitempty"`
+}
+
+// AccountOutcome records a single account's result during a sync
+type AccountOutcome struct {
+	// Account is the ledger account name, which redacts the account number
+	Account     string
+	Description string
+	Downloaded  int
+	Error       string `json:",omitempty"`
+	// Warning is a non-fatal problem reported by the institution, like a password which expires soon
+	Warning string `json:",omitempty"`
+}
+
+// Log appends entries as JSON lines to a file. When the file exceeds its max size, it is rotated to a single backup file.
+// A nil Log discards all entries.
+type Log struct {
+	mu      gosync.Mutex
+	path    string
+	maxSize int64
+}
+
+// New returns a Log writing to 'path', rotating at 'maxSize' bytes. Uses DefaultMaxSize if maxSize is not positive.
+func New(path string, maxSize int64) *Log {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &Log{
+		path:    path,
+		maxSize: maxSize,
+	}
+}
+
+// Write appends entry to the log. Any occurrences of 'secrets' in error and warning messages are redacted.
+func (l *Log) Write(entry Entry, secrets ...string) error {
+	if l == nil {
+		return nil
+	}
+	entry.Error = redact(entry.Error, secrets)
+	for i := range entry.Accounts {
+		entry.Accounts[i].Error = redact(entry.Accounts[i].Error, secrets)
+		entry.Accounts[i].Warning = redact(entry.Accounts[i].Warning, secrets)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.rotate(int64(len(line))); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, filePerm)
+	if err != nil {
+		return errors.Wrap(err, "Failed to open audit log")
+	}
+	_, err = file.Write(line)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrap(err, "Failed to write audit log")
+}
+
+// rotate moves the log to its backup file if appending 'size' more bytes would exceed the max size
+func (l *Log) rotate(size int64) error {
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 || info.Size()+size <= l.maxSize {
+		return nil
+	}
+	return errors.Wrap(os.Rename(l.path, l.path+rotatedSuffix), "Failed to rotate audit log")
+}
+
+// Tail returns the most recent 'limit' entries, oldest first. Includes entries from the rotated backup file if needed.
+func (l *Log) Tail(limit int) ([]Entry, error) {
+	if l == nil || limit <= 0 {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries, err := readEntries(l.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) < limit {
+		rotated, err := readEntries(l.path + rotatedSuffix)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(rotated, entries...)
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+func readEntries(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to open audit log")
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// skip partially written lines
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.Wrap(scanner.Err(), "Failed to read audit log")
+}
+
+func redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, redacted, -1)
+		}
+	}
+	return s
+}
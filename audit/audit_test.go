@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempLogPath(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	return filepath.Join(dir, "audit.log")
+}
+
+func makeEntry(day int) Entry {
+	return Entry{
+		Time:  time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC),
+		Start: time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC),
+		Accounts: []AccountOutcome{
+			{Account: "assets:some bank:****1234", Description: "checking", Downloaded: day},
+		},
+		Imported: day,
+	}
+}
+
+func TestWriteTail(t *testing.T) {
+	path := tempLogPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	log := New(path, 0)
+
+	for day := 1; day <= 3; day++ {
+		require.NoError(t, log.Write(makeEntry(day)))
+	}
+	entries, err := log.Tail(2)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{makeEntry(2), makeEntry(3)}, entries)
+
+	entries, err = log.Tail(10)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestWriteRedactsSecrets(t *testing.T) {
+	path := tempLogPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	log := New(path, 0)
+
+	entry := makeEntry(1)
+	entry.Error = "failed with password hunter2"
+	entry.Accounts[0].Error = "hunter2 rejected"
+	require.NoError(t, log.Write(entry, "hunter2", ""))
+
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), "hunter2")
+	entries, err := log.Tail(1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "failed with password ****", entries[0].Error)
+	assert.Equal(t, "**** rejected", entries[0].Accounts[0].Error)
+}
+
+func TestRotate(t *testing.T) {
+	path := tempLogPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	line, err := json.Marshal(makeEntry(1))
+	require.NoError(t, err)
+	maxSize := int64(2 * (len(line) + 1)) // fits 2 entries
+	log := New(path, maxSize)
+
+	for day := 1; day <= 4; day++ {
+		require.NoError(t, log.Write(makeEntry(day)))
+	}
+	_, err = os.Stat(path + rotatedSuffix)
+	require.NoError(t, err, "Log should rotate after exceeding its max size")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, info.Size() <= maxSize)
+
+	entries, err := log.Tail(3)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{makeEntry(2), makeEntry(3), makeEntry(4)}, entries, "Tail should include rotated entries")
+}
+
+func TestNilLog(t *testing.T) {
+	var log *Log
+	assert.NoError(t, log.Write(makeEntry(1)))
+	entries, err := log.Tail(1)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
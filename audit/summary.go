@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Summary is the machine-readable outcome of the latest sync run
+type Summary struct {
+	Time     time.Time
+	Accounts []SummaryAccount
+	// New is the total number of transactions added to the ledger
+	New int
+	// LedgerModified is true if the sync changed the ledger's contents
+	LedgerModified bool
+	Error          string `json:",omitempty"`
+	// Transactions contains details of each new transaction, only included when the summary is verbose
+	Transactions []SummaryTransaction `json:",omitempty"`
+	// ClassificationDisagreements is the number of new transactions where classifier stages chose different categories, only the highest precedence stage's category is used
+	ClassificationDisagreements int `json:",omitempty"`
+}
+
+// SummaryAccount is a single account's result during a sync
+type SummaryAccount struct {
+	// Account is the ledger account name, which redacts the account number
+	Account     string
+	Description string
+	New         int
+	Error       string `json:",omitempty"`
+	// Warning is a non-fatal problem reported by the institution, like a password which expires soon
+	Warning string `json:",omitempty"`
+	// Deferred is the number of transactions held back until a later sync, e.g. future-dated transactions
+	Deferred int `json:",omitempty"`
+	// Note explains why transactions were deferred
+	Note string `json:",omitempty"`
+	// Dropped is the number of zero-amount transactions dropped by the account's policy
+	Dropped int `json:",omitempty"`
+}
+
+// SummaryTransaction describes a new transaction in a verbose summary
+type SummaryTransaction struct {
+	Date    time.Time
+	Account string
+	Payee   string
+	Amount  decimal.Decimal
+}
+
+// SummaryFile replaces a file with the latest sync summary after every run.
+// A nil SummaryFile discards all summaries.
+type SummaryFile struct {
+	mu      gosync.Mutex
+	path    string
+	verbose bool
+}
+
+// NewSummaryFile returns a SummaryFile writing to 'path'. Transaction details are only included if 'verbose' is true.
+func NewSummaryFile(path string, verbose bool) *SummaryFile {
+	return &SummaryFile{
+		path:    path,
+		verbose: verbose,
+	}
+}
+
+// Prepare redacts any occurrences of 'secrets' in summary's errors and warnings, and removes transaction details unless s is verbose
+func (s *SummaryFile) Prepare(summary Summary, secrets ...string) Summary {
+	summary.Error = redact(summary.Error, secrets)
+	accounts := make([]SummaryAccount, len(summary.Accounts))
+	for i, account := range summary.Accounts {
+		account.Error = redact(account.Error, secrets)
+		account.Warning = redact(account.Warning, secrets)
+		accounts[i] = account
+	}
+	summary.Accounts = accounts
+	if s == nil || !s.verbose {
+		summary.Transactions = nil
+	}
+	return summary
+}
+
+// Write atomically replaces the summary file with 'summary'. Call Prepare first to remove secrets and details.
+func (s *SummaryFile) Write(summary Summary) error {
+	if s == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(summary, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "Failed to create sync summary")
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), filePerm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return errors.Wrap(err, "Failed to write sync summary")
+}
+
+// Read returns the latest summary. Returns false if no sync has written a summary yet.
+func (s *SummaryFile) Read() (Summary, bool, error) {
+	if s == nil {
+		return Summary{}, false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return Summary{}, false, nil
+	}
+	if err != nil {
+		return Summary{}, false, errors.Wrap(err, "Failed to read sync summary")
+	}
+	var summary Summary
+	err = json.Unmarshal(data, &summary)
+	return summary, err == nil, errors.Wrap(err, "Failed to parse sync summary")
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSummary(day int) Summary {
+	return Summary{
+		Time: time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC),
+		Accounts: []SummaryAccount{
+			{Account: "assets:some bank:****1234", Description: "checking", New: day, Error: "bad password hunter2"},
+		},
+		New:            day,
+		LedgerModified: true,
+		Transactions: []SummaryTransaction{
+			{Date: time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC), Account: "assets:some bank:****1234", Payee: "Some Shop", Amount: decimal.New(-5, 0)},
+		},
+	}
+}
+
+func TestSummaryFileWriteRead(t *testing.T) {
+	path := tempLogPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	file := NewSummaryFile(path, false)
+
+	_, found, err := file.Read()
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	for day := 1; day <= 2; day++ {
+		require.NoError(t, file.Write(file.Prepare(makeSummary(day), "hunter2")))
+	}
+	summary, found, err := file.Read()
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.True(t, summary.Time.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 2, summary.New)
+	assert.Equal(t, "bad password ****", summary.Accounts[0].Error)
+	assert.Empty(t, summary.Transactions)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+	assert.NotContains(t, string(data), "Some Shop")
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "Temporary files should be renamed over the summary")
+}
+
+func TestSummaryFileVerbose(t *testing.T) {
+	path := tempLogPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	file := NewSummaryFile(path, true)
+
+	require.NoError(t, file.Write(file.Prepare(makeSummary(1))))
+	summary, found, err := file.Read()
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Len(t, summary.Transactions, 1)
+	assert.Equal(t, "Some Shop", summary.Transactions[0].Payee)
+}
+
+func TestNilSummaryFile(t *testing.T) {
+	var file *SummaryFile
+	summary := file.Prepare(makeSummary(1))
+	assert.Empty(t, summary.Transactions)
+	assert.NoError(t, file.Write(summary))
+	_, found, err := file.Read()
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
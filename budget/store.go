@@ -1,6 +1,7 @@
 package budget
 
 import (
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -17,14 +18,28 @@ type Store struct {
 	bucket plaindb.Bucket
 }
 
+const (
+	budgetsBucket        = "budgets"
+	budgetsBucketVersion = "2"
+)
+
 // NewStore returns the budgets bucket
 func NewStore(db plaindb.DB) (*Store, error) {
-	bucket, err := db.Bucket("budgets", "2", &storeUpgrader{})
+	bucket, err := db.Bucket(budgetsBucket, budgetsBucketVersion, &storeUpgrader{})
 	return &Store{
 		bucket: bucket,
 	}, err
 }
 
+// ReloadStore re-reads the budgets bucket from disk. Call swap to replace the existing budgets with the reloaded ones.
+func ReloadStore(db plaindb.DB) (reloaded *Store, swap func(), err error) {
+	bucket, swap, err := db.ReloadBucket(budgetsBucket, budgetsBucketVersion, &storeUpgrader{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Store{bucket: bucket}, swap, nil
+}
+
 func formatYear(year int) string {
 	return strconv.FormatInt(int64(year), 10)
 }
@@ -122,3 +137,25 @@ func (s *Store) RemoveMonth(year int, month time.Month, account string) error {
 		},
 	}.Do()
 }
+
+// Accounts returns every account with a budget in any month of any stored year
+func (s *Store) Accounts() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accountSet := make(map[string]bool)
+	var budget Budget
+	err := s.bucket.Iter(&budget, func(string) bool {
+		for month := time.January; month <= time.December; month++ {
+			for account := range budget.Month(month) {
+				accountSet[account] = true
+			}
+		}
+		return true
+	})
+	accounts := make([]string, 0, len(accountSet))
+	for account := range accountSet {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts, err
+}
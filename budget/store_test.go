@@ -97,3 +97,14 @@ func TestStoreRemoveMonth(t *testing.T) {
 	require.NoError(t, err)
 	assert.Empty(t, accounts)
 }
+
+func TestStoreAccounts(t *testing.T) {
+	store := mockDBStore(t)
+	require.NoError(t, store.SetMonth(someYear-1, time.March, "expenses:rent", dec(10)))
+	require.NoError(t, store.SetMonth(someYear, time.February, "expenses:food", dec(10)))
+	require.NoError(t, store.SetMonth(someYear, time.June, "Expenses:Travel", dec(10)))
+
+	accounts, err := store.Accounts()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"expenses:food", "expenses:rent", "expenses:travel"}, accounts)
+}
@@ -0,0 +1,285 @@
+// Package changeset applies changes spanning several stores as one unit, so a failure part way through never leaves some stores updated and others not
+package changeset
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/vcs"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MarkerFileName is the in-progress commit's marker file inside the data directory. Hidden to keep it out of version control.
+	MarkerFileName = ".changeset.json"
+
+	stagedFileSuffix = ".tmp"
+)
+
+var errCrashed = errors.New("Simulated crash")
+
+// Resource is a store whose writes can be held in memory while staged, then committed to disk together with other resources
+type Resource interface {
+	// Stage holds all disk writes until Unstage, and returns a func which restores the in-memory state from before staging
+	Stage() (restore func(), err error)
+	// Files returns the new contents of every file changed since Stage, keyed by path
+	Files() (map[string][]byte, error)
+	// Unstage resumes writing to disk directly. Changes held while staged are not written.
+	Unstage()
+}
+
+// Manager runs changes across its resources, one change at a time
+type Manager struct {
+	mu        sync.Mutex
+	dir       string
+	repo      vcs.Repository
+	guard     vcs.WriteGuard
+	resources []Resource
+
+	// crashAt simulates a crash immediately before 'step' when it returns true, skipping all clean up. Only set in tests.
+	crashAt func(step string) bool
+}
+
+// marker records an in-progress commit. Staged files are only moved into place once Committed is set.
+type marker struct {
+	Committed bool
+	Message   string
+	Files     []stagedFile
+}
+
+type stagedFile struct {
+	Path   string
+	Staged string
+}
+
+// New creates a Manager which stores its commit marker in 'dir'. If 'repo' is set, committed files are also committed to version control.
+// Every commit first checks 'guard', if non-nil.
+func New(dir string, repo vcs.Repository, guard vcs.WriteGuard, resources ...Resource) *Manager {
+	return &Manager{
+		dir:       dir,
+		repo:      repo,
+		guard:     guard,
+		resources: resources,
+	}
+}
+
+// Do stages every resource, then runs fn to make the change. If fn succeeds, every changed file is committed together:
+// either all of them are written or none are, even if the process stops part way through.
+// If fn or the commit fails, every resource's in-memory state is restored and nothing is written.
+// Resources may block their own background writers while staged, e.g. the ledger store pauses syncs until the change ends.
+// Any other writes made while fn runs are held and committed or rolled back with it, so keep fn short.
+func (m *Manager) Do(message string, fn func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var restores []func()
+	defer func() {
+		for i := len(restores) - 1; i >= 0; i-- {
+			m.resources[i].Unstage()
+		}
+	}()
+	rollback := func() {
+		for i := len(restores) - 1; i >= 0; i-- {
+			restores[i]()
+		}
+	}
+	for _, resource := range m.resources {
+		restore, err := resource.Stage()
+		if err != nil {
+			rollback()
+			return err
+		}
+		restores = append(restores, restore)
+	}
+
+	if err := fn(); err != nil {
+		rollback()
+		return err
+	}
+	committed, err := m.commit(message)
+	if !committed {
+		rollback()
+	}
+	return err
+}
+
+// commit writes all staged files. Returns committed=true once the change is guaranteed to be applied, even if moving files into place failed.
+func (m *Manager) commit(message string) (committed bool, err error) {
+	files := make(map[string][]byte)
+	for _, resource := range m.resources {
+		resourceFiles, err := resource.Files()
+		if err != nil {
+			return false, err
+		}
+		for path, contents := range resourceFiles {
+			files[path] = contents
+		}
+	}
+	if len(files) == 0 {
+		return true, nil
+	}
+	if m.guard != nil {
+		if err := m.guard(); err != nil {
+			return false, err
+		}
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	mark := marker{Message: message}
+	for path := range files {
+		mark.Files = append(mark.Files, stagedFile{
+			Path:   path,
+			Staged: path + "." + id + stagedFileSuffix,
+		})
+	}
+	sort.Slice(mark.Files, func(a, b int) bool {
+		return mark.Files[a].Path < mark.Files[b].Path
+	})
+
+	if m.crashed("prepare") {
+		return false, errCrashed
+	}
+	if err := writeMarker(m.dir, mark); err != nil {
+		return false, err
+	}
+	for _, f := range mark.Files {
+		if m.crashed("stage " + f.Path) {
+			return false, errCrashed
+		}
+		if err := writeFile(f.Staged, f.Path, files[f.Path]); err != nil {
+			return false, discard(m.dir, mark, err)
+		}
+	}
+	if m.crashed("commit") {
+		return false, errCrashed
+	}
+	mark.Committed = true
+	if err := writeMarker(m.dir, mark); err != nil {
+		return false, discard(m.dir, mark, err)
+	}
+
+	// the change is committed, from here on recovery finishes it instead of discarding it
+	if err := m.finish(mark); err != nil {
+		return true, errors.Wrap(err, "Changes were saved but not fully applied. Restart Sage to finish applying them")
+	}
+	return true, nil
+}
+
+func (m *Manager) crashed(step string) bool {
+	return m.crashAt != nil && m.crashAt(step)
+}
+
+// finish moves committed files into place and removes the marker
+func (m *Manager) finish(mark marker) error {
+	moveFiles := func() error {
+		for _, f := range mark.Files {
+			if m.crashed("rename " + f.Path) {
+				return errCrashed
+			}
+			if err := os.Rename(f.Staged, f.Path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := commitFiles(m.repo, moveFiles, mark); err != nil {
+		return err
+	}
+	if m.crashed("cleanup") {
+		return errCrashed
+	}
+	return removeMarker(m.dir)
+}
+
+func commitFiles(repo vcs.Repository, prepFiles func() error, mark marker) error {
+	if repo == nil {
+		return prepFiles()
+	}
+	paths := make([]string, 0, len(mark.Files))
+	for _, f := range mark.Files {
+		paths = append(paths, f.Path)
+	}
+	return repo.CommitFiles(prepFiles, mark.Message, paths...)
+}
+
+// Recover finishes or discards a change interrupted before its marker in 'dir' was removed.
+// Committed changes are moved into place, and committed to 'repo' if set. Uncommitted changes are discarded.
+// Must run before any resources are loaded.
+func Recover(dir string, repo vcs.Repository) (recovered bool, err error) {
+	markerBytes, err := ioutil.ReadFile(filepath.Join(dir, MarkerFileName))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to read interrupted change")
+	}
+	var mark marker
+	if err := json.Unmarshal(markerBytes, &mark); err != nil {
+		return false, errors.Wrap(err, "Failed to parse interrupted change")
+	}
+	if !mark.Committed {
+		return false, discard(dir, mark, nil)
+	}
+	m := &Manager{dir: dir, repo: repo}
+	return true, errors.Wrap(m.finish(mark), "Failed to finish interrupted change")
+}
+
+// discard removes all staged files and the marker, then returns 'cause'
+func discard(dir string, mark marker, cause error) error {
+	for _, f := range mark.Files {
+		if err := os.Remove(f.Staged); err != nil && !os.IsNotExist(err) && cause == nil {
+			cause = err
+		}
+	}
+	if err := removeMarker(dir); err != nil && cause == nil {
+		cause = err
+	}
+	return cause
+}
+
+func writeMarker(dir string, mark marker) error {
+	markerBytes, err := json.Marshal(mark)
+	if err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(dir, MarkerFileName+stagedFileSuffix)
+	if err := writeFile(tmpPath, "", markerBytes); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(dir, MarkerFileName))
+}
+
+func removeMarker(dir string) error {
+	err := os.Remove(filepath.Join(dir, MarkerFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// writeFile writes and flushes 'b' to 'path', keeping the file mode of 'modeOf' if it exists
+func writeFile(path, modeOf string, b []byte) (returnErr error) {
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(modeOf); err == nil {
+		mode = info.Mode().Perm()
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil && returnErr == nil {
+			returnErr = err
+		}
+	}()
+	if _, err := file.Write(b); err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,175 @@
+package changeset
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileResource keeps one file's contents in memory, writing it to disk on every change unless staged
+type fileResource struct {
+	path     string
+	contents string
+
+	staged bool
+	dirty  bool
+}
+
+func newFileResource(t *testing.T, path, contents string) *fileResource {
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	return &fileResource{path: path, contents: contents}
+}
+
+func (f *fileResource) Set(contents string) error {
+	f.contents = contents
+	if f.staged {
+		f.dirty = true
+		return nil
+	}
+	return ioutil.WriteFile(f.path, []byte(contents), 0600)
+}
+
+func (f *fileResource) Stage() (func(), error) {
+	f.staged = true
+	previous := f.contents
+	return func() { f.contents = previous }, nil
+}
+
+func (f *fileResource) Files() (map[string][]byte, error) {
+	if !f.dirty {
+		return nil, nil
+	}
+	return map[string][]byte{f.path: []byte(f.contents)}, nil
+}
+
+func (f *fileResource) Unstage() {
+	f.staged, f.dirty = false, false
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func setup(t *testing.T) (dir string, accounts, ledger *fileResource, cleanup func()) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	accounts = newFileResource(t, filepath.Join(dir, "accounts.json"), "old accounts")
+	ledger = newFileResource(t, filepath.Join(dir, "ledger"), "old ledger")
+	return dir, accounts, ledger, func() { os.RemoveAll(dir) }
+}
+
+func assertNoLeftovers(t *testing.T, dir string) {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.ElementsMatch(t, []string{"accounts.json", "ledger"}, names)
+}
+
+func TestDo(t *testing.T) {
+	dir, accounts, ledger, cleanup := setup(t)
+	defer cleanup()
+	m := New(dir, nil, nil, accounts, ledger)
+
+	err := m.Do("Rename account", func() error {
+		require.NoError(t, accounts.Set("new accounts"))
+		assert.Equal(t, "old accounts", readFile(t, accounts.path), "Staged changes should not be written")
+		return ledger.Set("new ledger")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new accounts", readFile(t, accounts.path))
+	assert.Equal(t, "new ledger", readFile(t, ledger.path))
+	assert.Equal(t, "new accounts", accounts.contents)
+	assert.False(t, accounts.staged)
+	assertNoLeftovers(t, dir)
+}
+
+func TestDoRollback(t *testing.T) {
+	dir, accounts, ledger, cleanup := setup(t)
+	defer cleanup()
+	m := New(dir, nil, nil, accounts, ledger)
+
+	err := m.Do("Rename account", func() error {
+		require.NoError(t, accounts.Set("new accounts"))
+		return errors.New("ledger rename failed")
+	})
+	assert.EqualError(t, err, "ledger rename failed")
+	assert.Equal(t, "old accounts", accounts.contents)
+	assert.Equal(t, "old accounts", readFile(t, accounts.path))
+	assert.False(t, accounts.staged)
+	assertNoLeftovers(t, dir)
+
+	guardErr := errors.New("read-only")
+	m = New(dir, nil, func() error { return guardErr }, accounts, ledger)
+	err = m.Do("Rename account", func() error {
+		return accounts.Set("new accounts")
+	})
+	assert.Equal(t, guardErr, err)
+	assert.Equal(t, "old accounts", accounts.contents)
+	assert.Equal(t, "old accounts", readFile(t, accounts.path))
+	assertNoLeftovers(t, dir)
+}
+
+func TestRecoverAfterCrash(t *testing.T) {
+	for _, tc := range []struct {
+		step      string
+		committed bool
+	}{
+		{step: "prepare"},
+		{step: "stage accounts.json"},
+		{step: "stage ledger"},
+		{step: "commit"},
+		{step: "rename accounts.json", committed: true},
+		{step: "rename ledger", committed: true},
+		{step: "cleanup", committed: true},
+	} {
+		t.Run(tc.step, func(t *testing.T) {
+			dir, accounts, ledger, cleanup := setup(t)
+			defer cleanup()
+			m := New(dir, nil, nil, accounts, ledger)
+			crashed := false
+			m.crashAt = func(step string) bool {
+				step = strings.Replace(step, dir+string(filepath.Separator), "", 1)
+				crashed = crashed || step == tc.step
+				return crashed
+			}
+
+			err := m.Do("Rename account", func() error {
+				require.NoError(t, accounts.Set("new accounts"))
+				return ledger.Set("new ledger")
+			})
+			require.Equal(t, errCrashed, errors.Cause(err))
+			if tc.committed {
+				_, err := os.Stat(filepath.Join(dir, MarkerFileName))
+				assert.NoError(t, err, "Marker should remain until all files are moved into place")
+			}
+
+			recovered, err := Recover(dir, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.committed, recovered)
+			if tc.committed {
+				assert.Equal(t, "new accounts", readFile(t, accounts.path))
+				assert.Equal(t, "new ledger", readFile(t, ledger.path))
+			} else {
+				assert.Equal(t, "old accounts", readFile(t, accounts.path))
+				assert.Equal(t, "old ledger", readFile(t, ledger.path))
+			}
+			assertNoLeftovers(t, dir)
+
+			recovered, err = Recover(dir, nil)
+			assert.NoError(t, err)
+			assert.False(t, recovered, "Recovering twice should do nothing")
+		})
+	}
+}
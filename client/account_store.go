@@ -12,16 +12,133 @@ import (
 )
 
 // AccountStore enables manipulation of accounts
+// Direct connect institutions are stored once in a separate bucket and shared by all accounts referencing them.
 type AccountStore struct {
 	plaindb.Bucket
+	institutions *institutionStore
 }
 
+const (
+	accountsBucket        = "accounts"
+	accountsBucketVersion = "2"
+)
+
 // NewAccountStore load the accounts bucket from db
 func NewAccountStore(db plaindb.DB) (*AccountStore, error) {
-	bucket, err := db.Bucket("accounts", "2", &accountStoreUpgrader{})
-	return &AccountStore{
-		Bucket: bucket,
-	}, err
+	bucket, err := db.Bucket(accountsBucket, accountsBucketVersion, &accountStoreUpgrader{})
+	if err != nil {
+		return nil, err
+	}
+	institutions, err := newInstitutionStore(db)
+	if err != nil {
+		return nil, err
+	}
+	store := &AccountStore{
+		Bucket:       bucket,
+		institutions: institutions,
+	}
+	return store, store.migrateInstitutions()
+}
+
+// ReloadAccountStore re-reads the accounts bucket from disk. Call swap to replace the existing store's accounts with the reloaded ones.
+func ReloadAccountStore(db plaindb.DB) (reloaded *AccountStore, swap func(), err error) {
+	bucket, swapAccounts, err := db.ReloadBucket(accountsBucket, accountsBucketVersion, &accountStoreUpgrader{})
+	if err != nil {
+		return nil, nil, err
+	}
+	instBucket, swapInstitutions, err := db.ReloadBucket(institutionsBucket, institutionsBucketVersion, &institutionStoreUpgrader{})
+	if err != nil {
+		return nil, nil, err
+	}
+	swap = func() {
+		swapInstitutions()
+		swapAccounts()
+	}
+	return &AccountStore{Bucket: bucket, institutions: &institutionStore{Bucket: instBucket}}, swap, nil
+}
+
+// migrateInstitutions moves any embedded direct connect institutions into the institutions bucket, deduplicating matching institutions
+func (s *AccountStore) migrateInstitutions() error {
+	var embedded []direct.InstitutionReference
+	var account model.Account
+	err := s.Bucket.Iter(&account, func(id string) bool {
+		if ref, ok := account.(direct.InstitutionReference); ok && ref.InstitutionRef() == "" && ref.Institution() != nil {
+			embedded = append(embedded, ref)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, ref := range embedded {
+		if err := s.Put(ref.ID(), ref); err != nil {
+			return errors.Wrap(err, "Failed to migrate institution")
+		}
+	}
+	return nil
+}
+
+// Get reads the account with key 'id' into 'v', including its shared institution
+func (s *AccountStore) Get(id string, v interface{}) (bool, error) {
+	found, err := s.Bucket.Get(id, v)
+	if !found || err != nil {
+		return found, err
+	}
+	return found, s.resolveInstitution(v)
+}
+
+// Iter iterates over all accounts, including their shared institutions
+func (s *AccountStore) Iter(v interface{}, fn func(id string) (keepGoing bool)) error {
+	var resolveErr error
+	err := s.Bucket.Iter(v, func(id string) bool {
+		resolveErr = s.resolveInstitution(v)
+		if resolveErr != nil {
+			return false
+		}
+		return fn(id)
+	})
+	if err != nil {
+		return err
+	}
+	return resolveErr
+}
+
+// Put writes the account 'v' with key 'id'. If the account contains a direct connect institution, it is matched or added to the shared institutions and the account only stores a reference.
+func (s *AccountStore) Put(id string, v interface{}) error {
+	if ref, ok := v.(direct.InstitutionReference); ok && s.institutions != nil {
+		if connector, isConn := ref.Institution().(direct.Connector); isConn && connector != nil {
+			instID, err := s.institutions.save(connector)
+			if err != nil {
+				return err
+			}
+			v = ref.WithInstitution(instID, nil)
+		}
+	}
+	return s.Bucket.Put(id, v)
+}
+
+// resolveInstitution replaces v's institution reference with a copy containing the shared institution
+func (s *AccountStore) resolveInstitution(v interface{}) error {
+	accountPtr, ok := v.(*model.Account)
+	if !ok {
+		return nil
+	}
+	ref, ok := (*accountPtr).(direct.InstitutionReference)
+	if !ok || ref.InstitutionRef() == "" {
+		return nil
+	}
+	if s.institutions == nil {
+		return errors.Errorf("Institution not found for account %q: %q", ref.ID(), ref.InstitutionRef())
+	}
+	connector, found, err := s.institutions.get(ref.InstitutionRef())
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("Institution not found for account %q: %q", ref.ID(), ref.InstitutionRef())
+	}
+	*accountPtr = ref.WithInstitution(ref.InstitutionRef(), connector)
+	return nil
 }
 
 type accountV0 struct {
@@ -199,6 +316,8 @@ func (s *AccountStore) Remove(id string) error {
 func ValidateAccount(account model.Account) error {
 	var errs sErrors.Errors
 	switch kind := account.(type) {
+	case *model.ManualAccount:
+		errs.AddErr(model.ValidateManualAccount(kind))
 	case direct.Account:
 		errs.AddErr(direct.Validate(kind))
 	case web.Account:
@@ -211,7 +330,9 @@ func ValidateAccount(account model.Account) error {
 
 type institutionDetector struct {
 	BasicInstitution *model.BasicInstitution
+	Manual           bool
 	DirectConnect    *json.RawMessage
+	InstitutionID    string
 	WebConnect       *json.RawMessage
 }
 
@@ -222,13 +343,19 @@ func UnmarshalAccount(b []byte) (model.Account, error) {
 		return nil, err
 	}
 	switch {
+	case instDetector.Manual:
+		var account model.ManualAccount
+		if err := json.Unmarshal(b, &account); err != nil {
+			return nil, err
+		}
+		return &account, nil
 	case instDetector.BasicInstitution != nil:
 		var account model.BasicAccount
 		if err := json.Unmarshal(b, &account); err != nil {
 			return nil, err
 		}
 		return &account, nil
-	case instDetector.DirectConnect != nil:
+	case instDetector.DirectConnect != nil, instDetector.InstitutionID != "":
 		return direct.UnmarshalAccount(b)
 	case instDetector.WebConnect != nil:
 		return web.UnmarshalAccount(b)
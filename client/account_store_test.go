@@ -1,9 +1,11 @@
 package client
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
+	"github.com/johnstarich/sage/client/direct"
 	"github.com/johnstarich/sage/client/model"
 	"github.com/johnstarich/sage/plaindb"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +21,25 @@ func TestNewAccountStore(t *testing.T) {
 	assert.Equal(t, bucket, store.Bucket)
 }
 
+func TestReloadAccountStore(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{})
+	store, err := NewAccountStore(db)
+	require.NoError(t, err)
+	require.NoError(t, store.Bucket.Put("1234", &model.BasicAccount{AccountID: "1234"}))
+
+	reloaded, swap, err := ReloadAccountStore(db)
+	require.NoError(t, err)
+	var account model.Account
+	found, _ := reloaded.Get("1234", &account)
+	assert.False(t, found, "Reloaded store should only contain accounts from disk")
+	found, _ = store.Get("1234", &account)
+	assert.True(t, found, "Existing store should not change until swapped")
+
+	swap()
+	found, _ = store.Get("1234", &account)
+	assert.False(t, found)
+}
+
 func TestAccountStoreUpgradeV0(t *testing.T) {
 	for _, tc := range []struct {
 		description string
@@ -448,6 +469,37 @@ func TestAccountStoreAdd(t *testing.T) {
 	assert.Equal(t, `Account already exists with that ID: "1234"`, err.Error())
 }
 
+func TestUnmarshalManualAccount(t *testing.T) {
+	manual := model.NewManualAccount("401k", "retirement", model.AssetAccount, "some employer")
+	b, err := json.Marshal(manual)
+	require.NoError(t, err)
+	account, err := UnmarshalAccount(b)
+	require.NoError(t, err)
+	assert.Equal(t, manual, account)
+	assert.True(t, model.IsManual(account))
+	assert.NoError(t, ValidateAccount(account))
+
+	manual.BasicInstitution = model.BasicInstitution{}
+	assert.Error(t, ValidateAccount(manual))
+}
+
+func TestAccountStoreDisplayName(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{})
+	store, err := NewAccountStore(db)
+	require.NoError(t, err)
+	connector := direct.New("some institution", "some FID", "some org", "some URL", "some username", "some password", direct.Config{})
+	checking := direct.NewCheckingAccount("1234", "some routing number", "some description", connector)
+	checking.(model.DisplayNamer).SetDisplayName("Everyday checking")
+	require.NoError(t, store.Add(checking))
+
+	var account model.Account
+	found, err := store.Get("1234", &account)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "Everyday checking", model.DisplayName(account))
+	assert.Equal(t, model.LedgerAccountName(checking), model.LedgerAccountName(account))
+}
+
 func TestAccountStoreRemove(t *testing.T) {
 	db := plaindb.NewMockDB(plaindb.MockConfig{})
 	store, err := NewAccountStore(db)
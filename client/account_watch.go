@@ -0,0 +1,222 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+)
+
+// AccountsWatchStatus reports hot-reloads of the accounts files after they're modified outside Sage, like by secret rotation tooling
+type AccountsWatchStatus struct {
+	Reloads    int
+	LastReload *time.Time `json:",omitempty"`
+	// Error is set when the files were modified but rejected, in which case the previous accounts are still in use
+	Error string `json:",omitempty"`
+}
+
+// AccountsReload describes the accounts and institutions changed by a hot-reload
+type AccountsReload struct {
+	Accounts     []string
+	Institutions []string
+	// CredentialsChanged contains each account whose direct connect URL, username, or password changed
+	CredentialsChanged []CredentialsChange
+}
+
+// CredentialsChange is an account's direct connector before and after a hot-reload
+type CredentialsChange struct {
+	Account       string
+	Before, After direct.Connector
+}
+
+// AccountWatcher hot-reloads the accounts and institutions files when they change on disk
+type AccountWatcher struct {
+	db    plaindb.DB
+	store *AccountStore
+	now   func() time.Time
+
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+	// base contains each bucket's records as last read from disk
+	base   map[string]map[string]json.RawMessage
+	status AccountsWatchStatus
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewAccountWatcher returns an AccountWatcher for 'store', which must have been opened from 'db'
+func NewAccountWatcher(db plaindb.DB, store *AccountStore) (*AccountWatcher, error) {
+	w := &AccountWatcher{
+		db:    db,
+		store: store,
+		now:   time.Now,
+	}
+	w.stamps = w.readStamps()
+	reloaded, _, err := ReloadAccountStore(db)
+	if err != nil {
+		return nil, err
+	}
+	w.base, err = bucketRecords(reloaded)
+	return w, err
+}
+
+// Status returns the hot-reload count and the latest error, if any
+func (w *AccountWatcher) Status() AccountsWatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// Check hot-reloads the accounts files if they changed since the last check.
+// Fields changed on disk take precedence to the same fields changed in memory, all other in-memory changes are kept.
+// Invalid files are rejected and the current accounts are kept. Returns nil if nothing changed.
+func (w *AccountWatcher) Check() (*AccountsReload, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stamps := w.readStamps()
+	if stampsEqual(stamps, w.stamps) {
+		return nil, nil
+	}
+	w.stamps = stamps
+
+	reload, err := w.reload()
+	if err != nil {
+		w.status.Error = err.Error()
+		return nil, err
+	}
+	w.status.Error = ""
+	if reload == nil {
+		// no records changed, e.g. Sage saved the files itself
+		return nil, nil
+	}
+	now := w.now()
+	w.status.Reloads++
+	w.status.LastReload = &now
+	return reload, nil
+}
+
+func (w *AccountWatcher) reload() (*AccountsReload, error) {
+	reloaded, _, err := ReloadAccountStore(w.db)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to reload accounts")
+	}
+	var account model.Account
+	var validateErr error
+	err = reloaded.Iter(&account, func(id string) bool {
+		validateErr = errors.Wrapf(model.ValidateAccount(account), "Invalid account %q", id)
+		return validateErr == nil
+	})
+	if err == nil {
+		err = validateErr
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Rejected accounts file changes")
+	}
+	disk, err := bucketRecords(reloaded)
+	if err != nil {
+		return nil, err
+	}
+
+	connectors, err := w.connectors()
+	if err != nil {
+		return nil, err
+	}
+	institutionIDs, err := plaindb.Merge(w.store.institutions.Bucket, w.base[institutionsBucket], disk[institutionsBucket])
+	if err != nil {
+		return nil, err
+	}
+	accountIDs, err := plaindb.Merge(w.store.Bucket, w.base[accountsBucket], disk[accountsBucket])
+	if err != nil {
+		return nil, err
+	}
+	w.base = disk
+	if len(institutionIDs) == 0 && len(accountIDs) == 0 {
+		return nil, nil
+	}
+
+	reload := &AccountsReload{
+		Accounts:     accountIDs,
+		Institutions: institutionIDs,
+	}
+	updatedConnectors, err := w.connectors()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(connectors))
+	for id := range connectors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		connector := connectors[id]
+		updated, ok := updatedConnectors[id]
+		if ok && (connector.URL() != updated.URL() ||
+			connector.Username() != updated.Username() ||
+			connector.Password() != updated.Password()) {
+			reload.CredentialsChanged = append(reload.CredentialsChanged, CredentialsChange{
+				Account: id,
+				Before:  connector,
+				After:   updated,
+			})
+		}
+	}
+	return reload, nil
+}
+
+// connectors returns the store's direct connectors by account ID
+func (w *AccountWatcher) connectors() (map[string]direct.Connector, error) {
+	connectors := make(map[string]direct.Connector)
+	var account model.Account
+	err := w.store.Iter(&account, func(id string) bool {
+		if connector, ok := account.Institution().(direct.Connector); ok {
+			connectors[id] = connector
+		}
+		return true
+	})
+	return connectors, err
+}
+
+func (w *AccountWatcher) readStamps() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, bucket := range []plaindb.Bucket{w.store.Bucket, w.store.institutions.Bucket} {
+		path := plaindb.Path(bucket)
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+func stampsEqual(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		if other, ok := b[path]; !ok || !stamp.modTime.Equal(other.modTime) || stamp.size != other.size {
+			return false
+		}
+	}
+	return true
+}
+
+// bucketRecords returns the records of each of the store's buckets, keyed by bucket name
+func bucketRecords(store *AccountStore) (map[string]map[string]json.RawMessage, error) {
+	accounts, err := plaindb.Records(store.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	institutions, err := plaindb.Records(store.institutions.Bucket)
+	return map[string]map[string]json.RawMessage{
+		accountsBucket:     accounts,
+		institutionsBucket: institutions,
+	}, err
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/redactor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountWatcher(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	db, err := plaindb.Open(tmpDir)
+	require.NoError(t, err)
+	store, err := NewAccountStore(db)
+	require.NoError(t, err)
+	require.NoError(t, store.Add(direct.NewCreditCard("1", "card 1", testConnector("user", "old password"))))
+
+	watcher, err := NewAccountWatcher(db, store)
+	require.NoError(t, err)
+	reload, err := watcher.Check()
+	require.NoError(t, err)
+	assert.Nil(t, reload, "Unmodified files should not reload")
+
+	require.NoError(t, store.Add(direct.NewCreditCard("2", "card 2", testConnector("other user", "password"))))
+	reload, err = watcher.Check()
+	require.NoError(t, err)
+	assert.Nil(t, reload, "Files saved by the store should not reload")
+
+	institutionsPath := plaindb.Path(store.institutions.Bucket)
+	contents, err := ioutil.ReadFile(institutionsPath)
+	require.NoError(t, err)
+	require.Contains(t, string(contents), "old password")
+	rotated := strings.Replace(string(contents), "old password", "rotated password", 1)
+	require.NoError(t, ioutil.WriteFile(institutionsPath, []byte(rotated), 0600))
+
+	reload, err = watcher.Check()
+	require.NoError(t, err)
+	require.NotNil(t, reload)
+	assert.Empty(t, reload.Accounts)
+	assert.Len(t, reload.Institutions, 1)
+	require.Len(t, reload.CredentialsChanged, 1)
+	change := reload.CredentialsChanged[0]
+	assert.Equal(t, "1", change.Account)
+	assert.Equal(t, redactor.String("old password"), change.Before.Password())
+	assert.Equal(t, redactor.String("rotated password"), change.After.Password())
+	assert.Equal(t, redactor.String("rotated password"), getConnector(t, store, "1").Password())
+	status := watcher.Status()
+	assert.Equal(t, 1, status.Reloads)
+	assert.NotNil(t, status.LastReload)
+	assert.Empty(t, status.Error)
+
+	accountsPath := plaindb.Path(store.Bucket)
+	require.NoError(t, ioutil.WriteFile(accountsPath, []byte("not json"), 0600))
+	_, err = watcher.Check()
+	assert.Error(t, err)
+	status = watcher.Status()
+	assert.Equal(t, 1, status.Reloads)
+	assert.NotEmpty(t, status.Error, "Rejected changes should be reported")
+	assert.Equal(t, "user", getConnector(t, store, "1").Username(), "Rejected changes should keep the current accounts")
+}
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"github.com/aclindsa/ofxgo"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	centPlaces = 2
+	// floatErrorPlaces is the precision where an amount's floating point error disappears, i.e. 12.339999 is 12.34000 at 5 places
+	floatErrorPlaces = 5
+)
+
+// parseAmount converts an OFX amount to a fixed-point decimal.
+// Amounts within floating point error of a whole cent, like 12.339999 or 12.3400001, round to that cent. Other fractional cents are kept as-is.
+func parseAmount(amount ofxgo.Amount) decimal.Decimal {
+	// NOTE: Amount uses big.Rat internally, which can't form an invalid number with .String()
+	value := decimal.RequireFromString(amount.String())
+	if rounded := value.Round(centPlaces); !rounded.Equal(value) && value.Round(floatErrorPlaces).Equal(rounded) {
+		return rounded
+	}
+	return value
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAmount(t *testing.T) {
+	for _, tc := range []struct {
+		amount   string
+		expected string
+	}{
+		{amount: "12.34", expected: "12.34"},
+		{amount: "-12.339999", expected: "-12.34"},
+		{amount: "12.3400001", expected: "12.34"},
+		{amount: "0.1", expected: "0.1"},
+		{amount: "1234567890.12", expected: "1234567890.12"},
+		{amount: "12.345", expected: "12.345"},
+		{amount: "0.001", expected: "0.001"},
+	} {
+		t.Run(tc.amount, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseAmount(newAmount(t, tc.amount)).String())
+		})
+	}
+}
+
+func newAmount(t *testing.T, s string) ofxgo.Amount {
+	var amount ofxgo.Amount
+	_, ok := amount.SetString(s)
+	require.True(t, ok)
+	return amount
+}
+
+func TestAmountRoundTrip(t *testing.T) {
+	txn := parseTransaction(ofxgo.Transaction{
+		TrnAmt:   newAmount(t, "-12.339999"),
+		DtPosted: ofxgo.Date{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Name:     "Some Shop",
+	}, "$", "assets:Bank", func(id string) string { return id })
+	l, err := ledger.NewFromReader(strings.NewReader(txn.String()))
+	require.NoError(t, err)
+	assert.Equal(t, "-12.34", l.Query(ledger.QueryOptions{}, 1, 1).Transactions[0].Postings[0].Amount.String())
+}
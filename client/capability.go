@@ -0,0 +1,62 @@
+package client
+
+import (
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/client/web"
+)
+
+// Capabilities returns the features supported by account's institution connector.
+// Direct connect statement support is limited by the message sets of the institution's registered driver, if one exists.
+func Capabilities(account model.Account) model.Capabilities {
+	switch connector := account.Institution().(type) {
+	case direct.Connector:
+		return directCapabilities(connector, directStatementMessage(account))
+	case web.Connector:
+		return webCapabilities(connector)
+	default:
+		// manually managed accounts or unresolved connectors
+		return model.NewCapabilities()
+	}
+}
+
+// RequireCapability returns a MissingCapabilityError if account's connector does not support 'capability'
+func RequireCapability(account model.Account, capability model.Capability) error {
+	if !Capabilities(account).Has(capability) {
+		return model.MissingCapabilityError{Capability: capability}
+	}
+	return nil
+}
+
+func directStatementMessage(account model.Account) direct.DriverMessage {
+	switch account.(type) {
+	case *direct.CreditCard:
+		return direct.MessageCreditCard
+	case direct.Bank:
+		return direct.MessageBank
+	default:
+		return 0
+	}
+}
+
+func directCapabilities(connector direct.Connector, statementMessage direct.DriverMessage) model.Capabilities {
+	capabilities := []model.Capability{model.CapabilityAccountDiscovery}
+	driver, hasDriver := direct.FindDriver(connector)
+	if statementMessage != 0 && (!hasDriver || direct.SupportsMessage(driver, statementMessage)) {
+		// verifying a direct connect account signs on with a statement request
+		capabilities = append(capabilities,
+			model.CapabilityVerifySignon,
+			model.CapabilityBalance,
+			model.CapabilityIncrementalStatement,
+		)
+	}
+	return model.NewCapabilities(capabilities...)
+}
+
+func webCapabilities(connector web.Connector) model.Capabilities {
+	capabilities := []model.Capability{model.CapabilityBalance, model.CapabilityIncrementalStatement}
+	if _, ok := connector.(web.ConnectorValidator); ok {
+		capabilities = append(capabilities, model.CapabilityVerifySignon)
+	}
+	return model.NewCapabilities(capabilities...)
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/client/web"
+	"github.com/johnstarich/sage/prompter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type capabilityDriver struct {
+	fid     string
+	support []direct.DriverMessage
+}
+
+func (d capabilityDriver) ID() string {
+	return "capability driver " + d.fid
+}
+
+func (d capabilityDriver) Description() string {
+	return ""
+}
+
+func (d capabilityDriver) FID() string {
+	return d.fid
+}
+
+func (d capabilityDriver) Org() string {
+	return ""
+}
+
+func (d capabilityDriver) URL() string {
+	return "https://example.com/ofx/"
+}
+
+func (d capabilityDriver) MessageSupport() []direct.DriverMessage {
+	return d.support
+}
+
+type capabilityWebConnector struct {
+	model.BasicInstitution
+}
+
+func (c *capabilityWebConnector) Driver() string {
+	return "capability"
+}
+
+func (c *capabilityWebConnector) Statement(start, end time.Time, accountID string, browser web.Browser, prompt prompter.Prompter) (*ofxgo.Response, error) {
+	return nil, nil
+}
+
+type capabilityValidatingWebConnector struct {
+	capabilityWebConnector
+}
+
+func (c *capabilityValidatingWebConnector) Validate(accountID string) error {
+	return nil
+}
+
+type capabilityAccount struct {
+	model.BasicAccount
+	institution model.Institution
+}
+
+func (a *capabilityAccount) Institution() model.Institution {
+	return a.institution
+}
+
+func TestCapabilities(t *testing.T) {
+	direct.Register(
+		capabilityDriver{fid: "bank only", support: []direct.DriverMessage{direct.MessageBank}},
+		capabilityDriver{fid: "all messages", support: []direct.DriverMessage{direct.MessageSignon, direct.MessageBank, direct.MessageCreditCard}},
+	)
+	connector := func(fid string) direct.Connector {
+		return direct.New("Some Bank", fid, "some org", "https://example.com/ofx", "user", "password", direct.Config{})
+	}
+	missingWebDriver, err := web.UnmarshalAccount([]byte(`{"AccountID": "1", "WebConnect": {"Driver": "missing"}}`))
+	require.NoError(t, err)
+
+	statementCapabilities := model.NewCapabilities(
+		model.CapabilityAccountDiscovery,
+		model.CapabilityBalance,
+		model.CapabilityIncrementalStatement,
+		model.CapabilityVerifySignon,
+	)
+	for _, tc := range []struct {
+		description string
+		account     model.Account
+		expect      model.Capabilities
+	}{
+		{
+			description: "direct checking without driver",
+			account:     direct.NewCheckingAccount("1", "2", "checking", connector("no driver")),
+			expect:      statementCapabilities,
+		},
+		{
+			description: "direct credit card without driver",
+			account:     direct.NewCreditCard("1", "card", connector("no driver")),
+			expect:      statementCapabilities,
+		},
+		{
+			description: "direct credit card with full driver support",
+			account:     direct.NewCreditCard("1", "card", connector("all messages")),
+			expect:      statementCapabilities,
+		},
+		{
+			description: "direct credit card without credit card message set",
+			account:     direct.NewCreditCard("1", "card", connector("bank only")),
+			expect:      model.NewCapabilities(model.CapabilityAccountDiscovery),
+		},
+		{
+			description: "direct checking with bank message set",
+			account:     direct.NewCheckingAccount("1", "2", "checking", connector("bank only")),
+			expect:      statementCapabilities,
+		},
+		{
+			description: "direct account with unresolved institution",
+			account:     direct.NewCreditCard("1", "card", nil),
+			expect:      model.NewCapabilities(),
+		},
+		{
+			description: "web connector",
+			account:     &capabilityAccount{institution: &capabilityWebConnector{}},
+			expect:      model.NewCapabilities(model.CapabilityBalance, model.CapabilityIncrementalStatement),
+		},
+		{
+			description: "web connector with validation",
+			account:     &capabilityAccount{institution: &capabilityValidatingWebConnector{}},
+			expect:      model.NewCapabilities(model.CapabilityBalance, model.CapabilityIncrementalStatement, model.CapabilityVerifySignon),
+		},
+		{
+			description: "web driver missing",
+			account:     missingWebDriver,
+			expect:      model.NewCapabilities(),
+		},
+		{
+			description: "basic account",
+			account:     &model.BasicAccount{AccountID: "1"},
+			expect:      model.NewCapabilities(),
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expect, Capabilities(tc.account))
+		})
+	}
+}
+
+func TestRequireCapability(t *testing.T) {
+	account := &model.BasicAccount{AccountID: "1"}
+	err := RequireCapability(account, model.CapabilityVerifySignon)
+	require.Error(t, err)
+	assert.Equal(t, model.MissingCapabilityError{Capability: model.CapabilityVerifySignon}, err)
+	assert.Equal(t, "Institution connector does not support verify-signon", err.Error())
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"regexp"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+)
+
+// cashWithdrawalPayee matches payees of cash withdrawals for institutions which don't send an ATM or cash transaction type
+var cashWithdrawalPayee = regexp.MustCompile(`(?i)\b(atm|cash withdrawal)\b`)
+
+// RouteCashWithdrawals returns copies of txns with each cash-tracking account's withdrawals moved into the cash wallet account, making them transfers instead of spending.
+// Withdrawals are detected by their OFX transaction type or payee. The cash withdrawal tags recorded during import are removed from every transaction.
+func RouteCashWithdrawals(txns []ledger.Transaction, accounts []model.Account) []ledger.Transaction {
+	tracksCash := make(map[string]bool)
+	for _, account := range accounts {
+		if model.TracksCash(account) {
+			tracksCash[model.LedgerAccountName(account)] = true
+		}
+	}
+
+	routed := make([]ledger.Transaction, len(txns))
+	for i, txn := range txns {
+		if len(txn.Postings) == 0 {
+			routed[i] = txn
+			continue
+		}
+		first := txn.Postings[0]
+		_, tagged := first.Tags[model.CashWithdrawalTag]
+		isWithdrawal := (tagged || cashWithdrawalPayee.MatchString(txn.Payee)) && first.Amount.IsNegative()
+		if tracksCash[first.Account] && isWithdrawal && len(txn.Postings) == 2 && txn.Postings[1].Account == model.Uncategorized {
+			second := txn.Postings[1]
+			second.Account = ledger.CashAccount
+			txn.Postings = []ledger.Posting{first, second}
+		}
+		if tagged {
+			tags := make(map[string]string, len(first.Tags))
+			for key, value := range first.Tags {
+				if key != model.CashWithdrawalTag {
+					tags[key] = value
+				}
+			}
+			first.Tags = tags
+			txn.Postings = append([]ledger.Posting{first}, txn.Postings[1:]...)
+		}
+		routed[i] = txn
+	}
+	return routed
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteCashWithdrawals(t *testing.T) {
+	newAccount := func(id string, trackCash bool) *model.BasicAccount {
+		return &model.BasicAccount{
+			AccountID:        id,
+			AccountType:      model.AssetAccount,
+			BasicInstitution: model.BasicInstitution{InstDescription: "some org"},
+			TrackCash:        trackCash,
+		}
+	}
+	tracked := newAccount("1111", true)
+	untracked := newAccount("2222", false)
+	txnFor := func(account model.Account, ofxTxn ofxgo.Transaction, payee string, amount float64) ledger.Transaction {
+		ofxTxn.DtPosted = ofxgo.Date{Time: parseDate("2020/01/01")}
+		ofxTxn.TrnAmt = makeOFXAmount(amount)
+		ofxTxn.FiTID = "1"
+		ofxTxn.Name = ofxgo.String(payee)
+		return parseTransaction(ofxTxn, "$", model.LedgerAccountName(account), func(id string) string { return id })
+	}
+	atm := ofxgo.Transaction{TrnType: ofxgo.TrnTypeATM}
+	debit := ofxgo.Transaction{TrnType: ofxgo.TrnTypeDebit}
+	cash := ofxgo.Transaction{TrnType: ofxgo.TrnTypeCash}
+
+	txns := []ledger.Transaction{
+		txnFor(tracked, atm, "Corner Bank", -40),
+		txnFor(tracked, debit, "ATM Withdrawal #123", -20),
+		txnFor(tracked, debit, "Grocery Store", -10),
+		txnFor(tracked, cash, "Cash Deposit", 50),
+		txnFor(untracked, atm, "Corner Bank", -40),
+	}
+	require.Equal(t, "true", txns[0].Postings[0].Tags[model.CashWithdrawalTag])
+
+	routed := RouteCashWithdrawals(txns, []model.Account{tracked, untracked})
+	var categories []string
+	for _, txn := range routed {
+		categories = append(categories, txn.Postings[1].Account)
+		assert.NotContains(t, txn.Postings[0].Tags, model.CashWithdrawalTag)
+	}
+	assert.Equal(t, []string{
+		ledger.CashAccount,
+		ledger.CashAccount,
+		model.Uncategorized,
+		model.Uncategorized,
+		model.Uncategorized,
+	}, categories, "Only withdrawals from cash-tracking accounts should be routed to the cash wallet")
+	assert.Equal(t, "true", txns[0].Postings[0].Tags[model.CashWithdrawalTag], "Original transactions should not be modified")
+	assert.Equal(t, model.Uncategorized, txns[0].Postings[1].Account)
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+)
+
+const closedDateFormat = "2006-01-02"
+
+// ClosedAccountError is returned when transactions are dated after an account's closure
+type ClosedAccountError struct {
+	AccountID string
+	Account   string
+	Closed    time.Time
+	Rejected  int
+}
+
+func (e ClosedAccountError) Error() string {
+	return fmt.Sprintf("Rejected %d transaction(s) for %q dated after the account was closed on %s", e.Rejected, e.Account, e.Closed.Format(closedDateFormat))
+}
+
+// Partial always returns true, since other accounts' transactions are still imported
+func (e ClosedAccountError) Partial() bool {
+	return true
+}
+
+// RejectClosedTransactions removes transactions dated after their account's closure. Returns an error for each closed account with rejected transactions.
+func RejectClosedTransactions(txns []ledger.Transaction, accounts []model.Account) ([]ledger.Transaction, []ClosedAccountError) {
+	closedAccounts := make(map[string]*ClosedAccountError)
+	var order []string
+	for _, account := range accounts {
+		if closed := model.ClosedDate(account); closed != nil {
+			name := model.LedgerAccountName(account)
+			closedAccounts[name] = &ClosedAccountError{
+				AccountID: account.ID(),
+				Account:   account.Description(),
+				Closed:    *closed,
+			}
+			order = append(order, name)
+		}
+	}
+	if len(closedAccounts) == 0 {
+		return txns, nil
+	}
+
+	filtered := make([]ledger.Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if len(txn.Postings) > 0 {
+			if closedErr, isClosed := closedAccounts[txn.Postings[0].Account]; isClosed && !txn.Date.Before(closedErr.Closed.AddDate(0, 0, 1)) {
+				closedErr.Rejected++
+				continue
+			}
+		}
+		filtered = append(filtered, txn)
+	}
+
+	var errs []ClosedAccountError
+	for _, name := range order {
+		if closedErr := closedAccounts[name]; closedErr.Rejected > 0 {
+			errs = append(errs, *closedErr)
+		}
+	}
+	return filtered, errs
+}
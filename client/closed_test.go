@@ -0,0 +1,51 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectClosedTransactions(t *testing.T) {
+	closedDate := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	closed := &model.BasicAccount{
+		AccountID:          "1234",
+		AccountDescription: "old card",
+		AccountType:        model.LiabilityAccount,
+		BasicInstitution:   model.BasicInstitution{InstDescription: "some org"},
+		Closed:             &closedDate,
+	}
+	open := &model.BasicAccount{
+		AccountID:        "5678",
+		AccountType:      model.AssetAccount,
+		BasicInstitution: model.BasicInstitution{InstDescription: "some org"},
+	}
+	txnFor := func(account model.Account, date string) ledger.Transaction {
+		return ledger.Transaction{
+			Date:     parseDate(date),
+			Postings: []ledger.Posting{{Account: model.LedgerAccountName(account)}, {Account: model.Uncategorized}},
+		}
+	}
+	beforeClose := txnFor(closed, "2020/01/01")
+	onClose := txnFor(closed, "2020/01/02")
+	afterClose := txnFor(closed, "2020/01/03")
+	openAfterClose := txnFor(open, "2020/01/03")
+
+	txns, errs := RejectClosedTransactions(
+		[]ledger.Transaction{beforeClose, onClose, afterClose, openAfterClose, txnFor(closed, "2020/02/01")},
+		[]model.Account{closed, open},
+	)
+	assert.Equal(t, []ledger.Transaction{beforeClose, onClose, openAfterClose}, txns)
+	assert.Equal(t, []ClosedAccountError{{AccountID: "1234", Account: "old card", Closed: closedDate, Rejected: 2}}, errs)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, `Rejected 2 transaction(s) for "old card" dated after the account was closed on 2020-01-02`, errs[0].Error())
+		assert.True(t, errs[0].Partial())
+	}
+
+	txns, errs = RejectClosedTransactions([]ledger.Transaction{beforeClose}, []model.Account{closed})
+	assert.Equal(t, []ledger.Transaction{beforeClose}, txns)
+	assert.Empty(t, errs)
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+)
+
+// codeCleaner removes characters which would end a ledger transaction code early
+var codeCleaner = strings.NewReplacer("(", "", ")", "", ";", "")
+
+// SetTransactionCodes returns copies of txns with each account's configured OFX field as their ledger transaction codes.
+// The check and reference number tags recorded during import are removed from every transaction, so accounts without a configured field omit codes.
+func SetTransactionCodes(txns []ledger.Transaction, accounts []model.Account) []ledger.Transaction {
+	fields := make(map[string]string)
+	for _, account := range accounts {
+		if field := model.TransactionCodeField(account); field != "" {
+			fields[model.LedgerAccountName(account)] = field
+		}
+	}
+
+	coded := make([]ledger.Transaction, len(txns))
+	for i, txn := range txns {
+		if len(txn.Postings) > 0 && hasCodeTags(txn.Postings[0].Tags) {
+			first := txn.Postings[0]
+			if field, ok := fields[first.Account]; ok {
+				txn.Code = strings.TrimSpace(codeCleaner.Replace(first.Tags[field]))
+			}
+			tags := make(map[string]string, len(first.Tags))
+			for key, value := range first.Tags {
+				if key != model.CheckNumberTag && key != model.ReferenceNumberTag {
+					tags[key] = value
+				}
+			}
+			first.Tags = tags
+			txn.Postings = append([]ledger.Posting{first}, txn.Postings[1:]...)
+		}
+		coded[i] = txn
+	}
+	return coded
+}
+
+func hasCodeTags(tags map[string]string) bool {
+	_, hasCheckNumber := tags[model.CheckNumberTag]
+	_, hasReferenceNumber := tags[model.ReferenceNumberTag]
+	return hasCheckNumber || hasReferenceNumber
+}
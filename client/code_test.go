@@ -0,0 +1,59 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTransactionCodes(t *testing.T) {
+	newAccount := func(id, field string) *model.BasicAccount {
+		return &model.BasicAccount{
+			AccountID:        id,
+			AccountType:      model.AssetAccount,
+			BasicInstitution: model.BasicInstitution{InstDescription: "some org"},
+			CodeField:        field,
+		}
+	}
+	none := newAccount("1111", "")
+	checks := newAccount("2222", model.CodeFieldCheckNumber)
+	references := newAccount("3333", model.CodeFieldReferenceNumber)
+	txnFor := func(account model.Account, checkNumber, referenceNumber string) ledger.Transaction {
+		return parseTransaction(ofxgo.Transaction{
+			DtPosted: ofxgo.Date{Time: parseDate("2020/01/01")},
+			TrnAmt:   ofxgo.Amount{},
+			FiTID:    "1",
+			Name:     "check",
+			CheckNum: ofxgo.String(checkNumber),
+			RefNum:   ofxgo.String(referenceNumber),
+		}, "$", model.LedgerAccountName(account), func(id string) string { return id })
+	}
+
+	txns := []ledger.Transaction{
+		txnFor(none, "101", "A1"),
+		txnFor(checks, "102", "A2"),
+		txnFor(checks, "", "A3"),
+		txnFor(references, "104", "(A4)"),
+		ledger.NewBalanceAssertion(model.LedgerAccountName(checks), parseDate("2020/01/01"), decimal.Zero, "$"),
+	}
+	require.Equal(t, "102", txns[1].Postings[0].Tags[model.CheckNumberTag])
+
+	coded := SetTransactionCodes(txns, []model.Account{none, checks, references})
+	var codes []string
+	for _, txn := range coded {
+		codes = append(codes, txn.Code)
+		if len(txn.Postings) > 0 {
+			assert.NotContains(t, txn.Postings[0].Tags, model.CheckNumberTag)
+			assert.NotContains(t, txn.Postings[0].Tags, model.ReferenceNumberTag)
+		}
+	}
+	assert.Equal(t, []string{"", "102", "", "A4", ""}, codes)
+	assert.Equal(t, map[string]string{"id": "1"}, coded[0].Postings[0].Tags)
+	assert.Equal(t, "102", txns[1].Postings[0].Tags[model.CheckNumberTag], "Original transactions should not be modified")
+	assert.Empty(t, txns[1].Code)
+}
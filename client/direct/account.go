@@ -3,6 +3,7 @@ package direct
 import (
 	"encoding/json"
 	"strings"
+	"time"
 
 	"github.com/johnstarich/sage/client/model"
 	sErrors "github.com/johnstarich/sage/errors"
@@ -14,10 +15,44 @@ type Account interface {
 	Requestor
 }
 
+// InstitutionReference is implemented by accounts which can reference a shared institution by ID
+type InstitutionReference interface {
+	Account
+	// InstitutionRef returns the shared institution's ID, if set
+	InstitutionRef() string
+	// WithInstitution returns a copy of the account referencing institution 'id'. 'connector' may be nil to store only the reference.
+	WithInstitution(id string, connector Connector) InstitutionReference
+}
+
+// KeepAliver is implemented by accounts which record when their institution last accepted a keepalive probe
+type KeepAliver interface {
+	LastKeepAliveTime() *time.Time
+	SetLastKeepAliveTime(t *time.Time)
+}
+
+// Transferrer is implemented by accounts which can opt in to sending and receiving transfers initiated from Sage
+type Transferrer interface {
+	TransfersEnabled() bool
+}
+
 type directAccount struct {
 	AccountID          string
 	AccountDescription string
-	DirectConnect      Connector
+	AccountDisplayName string                `json:",omitempty"`
+	DirectConnect      Connector             `json:",omitempty"`
+	InstitutionID      string                `json:",omitempty"`
+	BalanceAssertions  bool                  `json:",omitempty"`
+	ZeroAmounts        string                `json:",omitempty"`
+	TimeZone           string                `json:",omitempty"`
+	CodeField          string                `json:",omitempty"`
+	TrackCash          bool                  `json:",omitempty"`
+	AllowTransfers     bool                  `json:",omitempty"`
+	Currency           *model.CurrencyFormat `json:",omitempty"`
+	Archived           bool                  `json:",omitempty"`
+	LastSync           *time.Time            `json:",omitempty"`
+	LastSyncSuccess    *time.Time            `json:",omitempty"`
+	Closed             *time.Time            `json:",omitempty"`
+	LastKeepAlive      *time.Time            `json:",omitempty"`
 }
 
 // ID implements model.Account
@@ -30,16 +65,135 @@ func (d *directAccount) Description() string {
 	return d.AccountDescription
 }
 
+// DisplayName implements model.DisplayNamer
+func (d *directAccount) DisplayName() string {
+	return d.AccountDisplayName
+}
+
+// SetDisplayName implements model.DisplayNamer
+func (d *directAccount) SetDisplayName(name string) {
+	d.AccountDisplayName = name
+}
+
 // Institution implements model.Account
 func (d *directAccount) Institution() model.Institution {
 	return d.DirectConnect
 }
 
+// InstitutionRef implements InstitutionReference
+func (d *directAccount) InstitutionRef() string {
+	return d.InstitutionID
+}
+
+func (d *directAccount) setInstitution(id string, connector Connector) {
+	d.InstitutionID = id
+	d.DirectConnect = connector
+}
+
+// AssertBalance implements model.BalanceAsserter
+func (d *directAccount) AssertBalance() bool {
+	return d.BalanceAssertions
+}
+
+// ZeroAmountPolicy implements model.ZeroAmountHandler
+func (d *directAccount) ZeroAmountPolicy() string {
+	return d.ZeroAmounts
+}
+
+// InstitutionTimeZone implements model.TimeZoner
+func (d *directAccount) InstitutionTimeZone() string {
+	return d.TimeZone
+}
+
+// TransactionCodeField implements model.TransactionCoder
+func (d *directAccount) TransactionCodeField() string {
+	return d.CodeField
+}
+
+// TracksCash implements model.CashTracker
+func (d *directAccount) TracksCash() bool {
+	return d.TrackCash
+}
+
+// TransfersEnabled implements Transferrer
+func (d *directAccount) TransfersEnabled() bool {
+	return d.AllowTransfers
+}
+
+// CurrencyFormat implements model.CurrencyFormatter
+func (d *directAccount) CurrencyFormat() *model.CurrencyFormat {
+	return d.Currency
+}
+
+// IsArchived implements model.Archiver
+func (d *directAccount) IsArchived() bool {
+	return d.Archived
+}
+
+// SetArchived implements model.Archiver
+func (d *directAccount) SetArchived(archived bool) {
+	d.Archived = archived
+}
+
+// SyncBookmark implements model.SyncBookmarker
+func (d *directAccount) SyncBookmark() *time.Time {
+	return d.LastSync
+}
+
+// SetSyncBookmark implements model.SyncBookmarker
+func (d *directAccount) SetSyncBookmark(bookmark *time.Time) {
+	d.LastSync = bookmark
+}
+
+// LastSyncSuccessTime implements model.SyncSuccessRecorder
+func (d *directAccount) LastSyncSuccessTime() *time.Time {
+	return d.LastSyncSuccess
+}
+
+// SetLastSyncSuccessTime implements model.SyncSuccessRecorder
+func (d *directAccount) SetLastSyncSuccessTime(t *time.Time) {
+	d.LastSyncSuccess = t
+}
+
+// ClosedDate implements model.Closer
+func (d *directAccount) ClosedDate() *time.Time {
+	return d.Closed
+}
+
+// SetClosedDate implements model.Closer
+func (d *directAccount) SetClosedDate(closed *time.Time) {
+	d.Closed = closed
+}
+
+// LastKeepAliveTime implements KeepAliver
+func (d *directAccount) LastKeepAliveTime() *time.Time {
+	return d.LastKeepAlive
+}
+
+// SetLastKeepAliveTime implements KeepAliver
+func (d *directAccount) SetLastKeepAliveTime(t *time.Time) {
+	d.LastKeepAlive = t
+}
+
 func (d *directAccount) UnmarshalJSON(b []byte) error {
 	var account struct {
 		AccountID          string
 		AccountDescription string
+		AccountDisplayName string
 		DirectConnect      *directConnect
+		InstitutionID      string
+		BalanceAssertions  bool
+		ZeroAmounts        string
+		TimeZone           string
+		CodeField          string
+		TrackCash          bool
+		AllowTransfers     bool
+		Currency           *model.CurrencyFormat
+		Archived           bool
+		LastSync           *time.Time
+		LastSyncSuccess    *time.Time
+		Closed             *time.Time
+		LastKeepAlive      *time.Time
 	}
 
 	if err := json.Unmarshal(b, &account); err != nil {
@@ -47,7 +201,24 @@ func (d *directAccount) UnmarshalJSON(b []byte) error {
 	}
 	d.AccountID = account.AccountID
 	d.AccountDescription = account.AccountDescription
-	d.DirectConnect = account.DirectConnect
+	d.AccountDisplayName = account.AccountDisplayName
+	if account.DirectConnect != nil {
+		// avoid a non-nil interface with a nil pointer when only referencing an institution
+		d.DirectConnect = account.DirectConnect
+	}
+	d.InstitutionID = account.InstitutionID
+	d.BalanceAssertions = account.BalanceAssertions
+	d.ZeroAmounts = account.ZeroAmounts
+	d.TimeZone = account.TimeZone
+	d.CodeField = account.CodeField
+	d.TrackCash = account.TrackCash
+	d.AllowTransfers = account.AllowTransfers
+	d.Currency = account.Currency
+	d.Archived = account.Archived
+	d.LastSync = account.LastSync
+	d.LastSyncSuccess = account.LastSyncSuccess
+	d.Closed = account.Closed
+	d.LastKeepAlive = account.LastKeepAlive
 	return nil
 }
 
@@ -43,6 +43,19 @@ func TestDirectAccountUnmarshal(t *testing.T) {
 	}, unmarshaledAccount)
 }
 
+func TestUnmarshalAccountDisplayName(t *testing.T) {
+	connector := New("some institution", "some FID", "some org", "some URL", "some username", "some password", Config{})
+	checking := NewCheckingAccount("1234", "some routing number", "some description", connector)
+	checking.(model.DisplayNamer).SetDisplayName("Everyday checking")
+	b, err := json.Marshal(checking)
+	require.NoError(t, err)
+
+	account, err := UnmarshalAccount(b)
+	require.NoError(t, err)
+	assert.Equal(t, "Everyday checking", model.DisplayName(account))
+	assert.Equal(t, "some description", account.Description())
+}
+
 func TestUnmarshalConnector(t *testing.T) {
 	directConnector := `{
 		"InstDescription": "some inst",
@@ -150,17 +163,19 @@ func TestUnmarshalAccount(t *testing.T) {
 			data:        `{"RoutingNumber": "1234"}`,
 			expectAccount: &bankAccount{
 				RoutingNumber: "1234",
-				directAccount: directAccount{
-					DirectConnect: (*directConnect)(nil),
-				},
 			},
 		},
 		{
-			description: "credit card",
-			data:        `{}`,
+			description:   "credit card",
+			data:          `{}`,
+			expectAccount: &CreditCard{},
+		},
+		{
+			description: "institution reference",
+			data:        `{"InstitutionID": "some ID"}`,
 			expectAccount: &CreditCard{
 				directAccount: directAccount{
-					DirectConnect: (*directConnect)(nil),
+					InstitutionID: "some ID",
 				},
 			},
 		},
@@ -0,0 +1,30 @@
+package direct
+
+import (
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+)
+
+const maxAmountPlaces = 4
+
+// roundingParser returns 'parse', but rounds each parsed amount and balance to 'places' decimal places. A nil 'places' returns 'parse' unchanged.
+func roundingParser(places *int32, parse model.TransactionParser) model.TransactionParser {
+	if places == nil {
+		return parse
+	}
+	return func(resp *ofxgo.Response) ([]model.Account, []ledger.Transaction, error) {
+		accounts, txns, err := parse(resp)
+		for i := range txns {
+			for j := range txns[i].Postings {
+				posting := &txns[i].Postings[j]
+				posting.Amount = posting.Amount.Round(*places)
+				if posting.Balance != nil {
+					balance := posting.Balance.Round(*places)
+					posting.Balance = &balance
+				}
+			}
+		}
+		return accounts, txns, err
+	}
+}
@@ -0,0 +1,37 @@
+package direct
+
+import (
+	"testing"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundingParser(t *testing.T) {
+	balance := decimal.RequireFromString("100.0049")
+	parse := func(*ofxgo.Response) ([]model.Account, []ledger.Transaction, error) {
+		return nil, []ledger.Transaction{{
+			Postings: []ledger.Posting{
+				{Account: "assets:Bank", Amount: decimal.RequireFromString("-12.3351"), Balance: &balance},
+				{Account: "uncategorized", Amount: decimal.RequireFromString("12.3351")},
+			},
+		}}, nil
+	}
+
+	_, txns, err := roundingParser(nil, parse)(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "-12.3351", txns[0].Postings[0].Amount.String())
+
+	places := int32(2)
+	_, txns, err = roundingParser(&places, parse)(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "-12.34", txns[0].Postings[0].Amount.String())
+	assert.Equal(t, "12.34", txns[0].Postings[1].Amount.String())
+	assert.Equal(t, "100", txns[0].Postings[0].Balance.String())
+	assert.True(t, txns[0].Balanced())
+	assert.Equal(t, "100.0049", balance.String(), "Rounding must not modify the original balance")
+}
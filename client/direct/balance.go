@@ -0,0 +1,97 @@
+package direct
+
+import (
+	"context"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Balance is an institution-reported account balance
+type Balance struct {
+	Amount   decimal.Decimal
+	Currency string
+	// AsOf is when the institution last updated the balance
+	AsOf time.Time
+}
+
+// StatementBalance fetches the current balance for 'requestor' with a statement request which excludes transactions.
+// Waits for the institution's rate limit, and fails if 'ctx' is done before the institution responds.
+func StatementBalance(ctx context.Context, connector Connector, requestor Requestor) (Balance, error) {
+	client, err := newSimpleClient(connector.URL(), connector.Config())
+	if err != nil {
+		return Balance{}, err
+	}
+	if err := getLimiterFromCache(connector.URL()).Wait(ctx); err != nil {
+		return Balance{}, errors.Wrap(err, "Timed out waiting for the institution's rate limit")
+	}
+	type result struct {
+		balance Balance
+		err     error
+	}
+	results := make(chan result, 1)
+	go func() {
+		balance, err := statementBalance(connector, requestor, client.Request, time.Now())
+		results <- result{balance, err}
+	}()
+	select {
+	case r := <-results:
+		return r.balance, r.err
+	case <-ctx.Done():
+		return Balance{}, errors.Wrap(ctx.Err(), "Timed out waiting for the institution to respond")
+	}
+}
+
+func statementBalance(connector Connector, requestor Requestor, doRequest func(*ofxgo.Request) (*ofxgo.Response, error), now time.Time) (Balance, error) {
+	var query ofxgo.Request
+	if err := requestor.Statement(&query, now.AddDate(0, 0, -1), now); err != nil {
+		return Balance{}, err
+	}
+	for _, message := range append(query.Bank, query.CreditCard...) {
+		switch request := message.(type) {
+		case *ofxgo.StatementRequest:
+			request.Include = false
+		case *ofxgo.CCStatementRequest:
+			request.Include = false
+		}
+	}
+	if len(query.Bank) == 0 && len(query.CreditCard) == 0 {
+		return Balance{}, errors.Errorf("Invalid balance query: does not contain any statement requests: %+v", query)
+	}
+	addSignonRequest(connector, &query)
+
+	response, err := doRequest(&query)
+	if err != nil {
+		return Balance{}, err
+	}
+	if err := signonError(response); err != nil {
+		return Balance{}, err
+	}
+	for _, message := range append(response.Bank, response.CreditCard...) {
+		var amount ofxgo.Amount
+		var asOf ofxgo.Date
+		var currency string
+		switch statement := message.(type) {
+		case *ofxgo.StatementResponse:
+			amount, asOf, currency = statement.BalAmt, statement.DtAsOf, statement.CurDef.String()
+		case *ofxgo.CCStatementResponse:
+			amount, asOf, currency = statement.BalAmt, statement.DtAsOf, statement.CurDef.String()
+		default:
+			continue
+		}
+		if asOf.Time.IsZero() {
+			continue
+		}
+		value, err := decimal.NewFromString(amount.String())
+		if err != nil {
+			return Balance{}, errors.Wrap(err, "Invalid balance amount")
+		}
+		if places := connector.Config().AmountPlaces; places != nil {
+			value = value.Round(*places)
+		}
+		return Balance{Amount: value, Currency: currency, AsOf: asOf.Time}, nil
+	}
+	return Balance{}, errors.New("Institution did not report a balance")
+}
@@ -0,0 +1,91 @@
+package direct
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementBalance(t *testing.T) {
+	two := int32(2)
+	connector := &directConnect{
+		ConnectorURL:     "some URL",
+		BasicInstitution: model.BasicInstitution{InstFID: "some FID", InstOrg: "some org"},
+		ConnectorConfig:  Config{AmountPlaces: &two},
+	}
+	checking := NewCheckingAccount("some ID", "some routing number", "some description", connector).(Requestor)
+	now := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	asOf := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	requestErr := errors.New("some error")
+	usd, err := ofxgo.NewCurrSymbol("USD")
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		description string
+		requestErr  error
+		statusCode  ofxgo.Int
+		response    ofxgo.Message
+		expectErr   error
+		expectMsg   string
+		expect      Balance
+	}{
+		{
+			description: "happy path",
+			response: &ofxgo.StatementResponse{
+				CurDef: *usd,
+				BalAmt: makeOFXAmount(12.345),
+				DtAsOf: *ofxgo.NewDate(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			expect: Balance{Amount: decimal.RequireFromString("12.35"), Currency: "USD", AsOf: asOf},
+		},
+		{
+			description: "request error",
+			requestErr:  requestErr,
+			expectErr:   requestErr,
+		},
+		{
+			description: "auth failed",
+			statusCode:  ofxAuthFailed,
+			expectErr:   ErrAuthFailed,
+		},
+		{
+			description: "no balance",
+			response:    &ofxgo.StatementResponse{},
+			expectMsg:   "Institution did not report a balance",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			balance, err := statementBalance(connector, checking, func(req *ofxgo.Request) (*ofxgo.Response, error) {
+				require.Len(t, req.Bank, 1)
+				assert.False(t, bool(req.Bank[0].(*ofxgo.StatementRequest).Include), "Balance requests should not include transactions")
+				if tc.requestErr != nil {
+					return nil, tc.requestErr
+				}
+				var resp ofxgo.Response
+				resp.Signon.Status.Code = tc.statusCode
+				if tc.response != nil {
+					resp.Bank = []ofxgo.Message{tc.response}
+				}
+				return &resp, nil
+			}, now)
+			if tc.expectErr != nil {
+				assert.Equal(t, tc.expectErr, err)
+				return
+			}
+			if tc.expectMsg != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectMsg, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tc.expect.Amount.Equal(balance.Amount), "Amount %s != %s", tc.expect.Amount, balance.Amount)
+			assert.Equal(t, tc.expect.Currency, balance.Currency)
+			assert.True(t, tc.expect.AsOf.Equal(balance.AsOf))
+		})
+	}
+}
@@ -2,8 +2,11 @@ package direct
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/aclindsa/ofxgo"
 	"github.com/johnstarich/sage/client/model"
@@ -30,6 +33,80 @@ func ParseAccountType(s string) accountType { // nolint - intentionally do not a
 	}
 }
 
+// DefaultAcctTypeKeywords map words in bank account descriptions to account types, for institutions which don't send a usable ACCTTYPE
+var DefaultAcctTypeKeywords = map[string]string{
+	"checking":      CheckingType.String(),
+	"chk":           CheckingType.String(),
+	"chkg":          CheckingType.String(),
+	"share draft":   CheckingType.String(),
+	"savings":       SavingsType.String(),
+	"saving":        SavingsType.String(),
+	"sav":           SavingsType.String(),
+	"money market":  SavingsType.String(),
+	"mma":           SavingsType.String(),
+	"share":         SavingsType.String(),
+	"share savings": SavingsType.String(),
+}
+
+// InferAccountType guesses a bank account's type from its description, for accounts without a usable ACCTTYPE.
+// Keywords in the description decide the type, ignoring keywords within more specific ones. See DefaultAcctTypeKeywords and Config.AcctTypeKeywords.
+// Falls back to the config's DefaultAcctType if no keywords match, or if they disagree.
+// Returns 0 if neither determine the type, and otherwise a description of how the type was chosen.
+func InferAccountType(description string, config Config) (accountType, string) {
+	keywords := make(map[string]string, len(DefaultAcctTypeKeywords)+len(config.AcctTypeKeywords))
+	for keyword, kind := range DefaultAcctTypeKeywords {
+		keywords[keyword] = kind
+	}
+	for keyword, kind := range config.AcctTypeKeywords {
+		keyword = strings.Join(strings.Fields(strings.ToLower(keyword)), " ")
+		if kind == "" {
+			delete(keywords, keyword)
+		} else {
+			keywords[keyword] = kind
+		}
+	}
+
+	words := " " + strings.Join(strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ") + " "
+	var matches []string
+	for keyword := range keywords {
+		if strings.Contains(words, " "+keyword+" ") {
+			matches = append(matches, keyword)
+		}
+	}
+	sort.Strings(matches)
+	var match accountType
+	var matchKeywords []string
+	for _, keyword := range matches {
+		general := false
+		for _, other := range matches {
+			if other != keyword && strings.Contains(" "+other+" ", " "+keyword+" ") {
+				// a more specific keyword matched, like "share draft" instead of "share"
+				general = true
+				break
+			}
+		}
+		if general {
+			continue
+		}
+		kind := ParseAccountType(keywords[keyword])
+		if match != 0 && kind != match {
+			match = 0
+			break
+		}
+		match = kind
+		matchKeywords = append(matchKeywords, keyword)
+	}
+	if match != 0 {
+		return match, fmt.Sprintf("description contains %q", strings.Join(matchKeywords, `", "`))
+	}
+	if kind := ParseAccountType(config.DefaultAcctType); kind != 0 {
+		return kind, "institution's default account type"
+	}
+	return 0, ""
+}
+
 func (a accountType) String() string {
 	switch a {
 	case CheckingType:
@@ -45,6 +122,8 @@ type bankAccount struct {
 	directAccount
 	BankAccountType string
 	RoutingNumber   string
+	// AcctTypeInferred is set if the institution didn't send a usable account type, so BankAccountType was inferred and may need correcting
+	AcctTypeInferred bool `json:",omitempty"`
 }
 
 // Bank is an account with a bank's routing number or 'bank ID'
@@ -52,6 +131,8 @@ type Bank interface {
 	model.Account
 
 	BankID() string
+	// AcctType is the OFX bank account type, like CHECKING or SAVINGS
+	AcctType() string
 }
 
 // NewCheckingAccount creates an account from checking details
@@ -76,10 +157,21 @@ func newBankAccount(kind accountType, id, bankID, description string, connector
 	}
 }
 
+// WithInstitution implements InstitutionReference
+func (b *bankAccount) WithInstitution(id string, connector Connector) InstitutionReference {
+	account := *b
+	account.setInstitution(id, connector)
+	return &account
+}
+
 func (b *bankAccount) BankID() string {
 	return b.RoutingNumber
 }
 
+func (b *bankAccount) AcctType() string {
+	return b.BankAccountType
+}
+
 func (b *bankAccount) isBank() bool {
 	return b.RoutingNumber != ""
 }
@@ -126,8 +218,9 @@ func (b *bankAccount) Type() string {
 
 func (b *bankAccount) UnmarshalJSON(data []byte) error {
 	var bank struct {
-		BankAccountType string
-		RoutingNumber   string
+		BankAccountType  string
+		RoutingNumber    string
+		AcctTypeInferred bool
 	}
 
 	if err := json.Unmarshal(data, &bank); err != nil {
@@ -136,5 +229,6 @@ func (b *bankAccount) UnmarshalJSON(data []byte) error {
 
 	b.BankAccountType = bank.BankAccountType
 	b.RoutingNumber = bank.RoutingNumber
+	b.AcctTypeInferred = bank.AcctTypeInferred
 	return json.Unmarshal(data, &b.directAccount)
 }
@@ -122,3 +122,30 @@ func TestBankStatement(t *testing.T) {
 	acctType := req.Bank[0].(*ofxgo.StatementRequest).BankAcctFrom.AcctType.String()
 	assert.Equal(t, CheckingType.String(), acctType)
 }
+
+func TestInferAccountType(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		config      Config
+		expectType  accountType
+	}{
+		{description: "Premier CHECKING", expectType: CheckingType},
+		{description: "MMA-1234", expectType: SavingsType},
+		{description: "Share Draft", expectType: CheckingType},
+		{description: "Regular Share", expectType: SavingsType},
+		{description: "Everyday account", expectType: 0},
+		{description: "Everyday account", config: Config{DefaultAcctType: "savings"}, expectType: SavingsType},
+		{description: "Checking and savings", config: Config{DefaultAcctType: "CHECKING"}, expectType: CheckingType},
+		{description: "Checking and savings", expectType: 0},
+		{description: "Everyday account", config: Config{AcctTypeKeywords: map[string]string{"Everyday": "CHECKING"}}, expectType: CheckingType},
+		{description: "MMA", config: Config{AcctTypeKeywords: map[string]string{"mma": ""}}, expectType: 0},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			kind, reason := InferAccountType(tc.description, tc.config)
+			assert.Equal(t, tc.expectType, kind)
+			if kind != 0 {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+}
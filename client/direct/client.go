@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aclindsa/ofxgo"
@@ -18,9 +19,12 @@ import (
 const (
 	loggerDevEnv    = "DEVELOPMENT"
 	discoverCardURL = "https://ofx.discovercard.com"
+
+	maxRequestDelayMillis = 10 * 1000
 )
 
 var (
+	rateLimiterMu    sync.Mutex
 	rateLimiterCache = make(map[string]*rate.Limiter)
 )
 
@@ -28,6 +32,14 @@ type sageClient struct {
 	ofxgo.Client
 	*zap.Logger
 	*rate.Limiter
+
+	newFileUID    bool
+	requestDelay  time.Duration
+	retryPolicy   RetryPolicy
+	sleep         func(time.Duration)
+	parseResponse func(io.Reader) (*ofxgo.Response, error)
+	fileUIDMu     sync.Mutex
+	lastFileUID   string
 }
 
 // New creates a new ofxgo Client with the given connection info
@@ -58,6 +70,11 @@ func newClient(
 		basicClient.SpecVersion = ofxVersion
 	}
 	basicClient.CarriageReturn = true
+	s.newFileUID = config.NewFileUID
+	s.requestDelay = config.RequestDelay()
+	s.retryPolicy = config.RetryPolicy().withConnectDefaults()
+	s.sleep = time.Sleep
+	s.parseResponse = responseParser(config)
 	var err error
 	s.Client, err = getClient(url, basicClient)
 	if err != nil {
@@ -80,6 +97,8 @@ func getClient(url string, basicClient *ofxgo.BasicClient) (ofxgo.Client, error)
 
 func getLimiterFromCache(url string) *rate.Limiter {
 	url = strings.Trim(url, "/")
+	rateLimiterMu.Lock()
+	defer rateLimiterMu.Unlock()
 	if limiter, ok := rateLimiterCache[url]; ok {
 		return limiter
 	}
@@ -104,7 +123,7 @@ func getLoggerFromEnv() (*zap.Logger, error) {
 }
 
 func (s *sageClient) Request(req *ofxgo.Request) (*ofxgo.Response, error) {
-	return request(req, s.RequestNoParse, ofxgo.ParseResponse)
+	return request(req, s.RequestNoParse, s.parseResponse)
 }
 
 func request(
@@ -165,13 +184,47 @@ type requestMarshaler interface {
 }
 
 func (s *sageClient) MarshalRequest(req *ofxgo.Request) (io.Reader, error) {
+	var r io.Reader
 	if marshaller, ok := s.Client.(requestMarshaler); ok {
-		return marshaller.MarshalRequest(req)
+		var err error
+		r, err = marshaller.MarshalRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		req.SetClientFields(s)
+		b, err := req.Marshal()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to marshal request")
+		}
+		r = b
+	}
+	if !s.newFileUID {
+		return r, nil
 	}
+	return s.setNewFileUID(r)
+}
 
-	req.SetClientFields(s)
-	b, err := req.Marshal()
-	return b, errors.Wrap(err, "Failed to marshal request")
+// setNewFileUID replaces the request header's empty NEWFILEUID with a random UID, never repeating the previous request's UID
+func (s *sageClient) setNewFileUID(r io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s.fileUIDMu.Lock()
+	defer s.fileUIDMu.Unlock()
+	var uid string
+	for uid == "" || uid == s.lastFileUID {
+		newUID, err := ofxgo.RandomUID()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to generate NEWFILEUID")
+		}
+		uid = string(*newUID)
+	}
+	s.lastFileUID = uid
+	data = bytes.Replace(data, []byte("NEWFILEUID:NONE"), []byte("NEWFILEUID:"+uid), 1)        // OFX 1XX
+	data = bytes.Replace(data, []byte(`NEWFILEUID="NONE"`), []byte(`NEWFILEUID="`+uid+`"`), 1) // OFX 2XX
+	return bytes.NewReader(data), nil
 }
 
 func (s *sageClient) RawRequest(url string, r io.Reader) (*http.Response, error) {
@@ -182,5 +235,21 @@ func (s *sageClient) RawRequest(url string, r io.Reader) (*http.Response, error)
 	delay := reservation.Delay()
 	s.Logger.Debug("Rate limiting", zap.Duration("delay", delay))
 	time.Sleep(delay)
+	if s.requestDelay > 0 {
+		// some servers fail the first request after being idle unless given time to warm up
+		s.Logger.Debug("Delaying request", zap.Duration("delay", s.requestDelay))
+		s.sleep(s.requestDelay)
+	}
+	if _, isBasic := s.Client.(*ofxgo.BasicClient); isBasic {
+		// connection retries are safe since the request wasn't sent, unlike the request retries around Request
+		post := func(body io.Reader) (*http.Response, error) {
+			return pooledRawRequest(url, body)
+		}
+		return withConnectRetries(s.retryPolicy, post, s.sleep)(r)
+	}
+	// other clients use their own transports, so check the server separately
+	if err := requireMinTLS(url); err != nil {
+		return nil, err
+	}
 	return s.Client.RawRequest(url, r)
 }
@@ -0,0 +1,23 @@
+package direct
+
+import (
+	"github.com/aclindsa/ofxgo"
+	"github.com/pkg/errors"
+)
+
+// NewClientID returns a new randomly generated ClientUID. Institutions which register ClientUIDs must authorize it again before it can sign on.
+func NewClientID() (string, error) {
+	uid, err := ofxgo.RandomUID()
+	if err != nil {
+		return "", err
+	}
+	return string(*uid), nil
+}
+
+// ValidateClientID returns an error if 'clientID' is not a valid OFX ClientUID
+func ValidateClientID(clientID string) error {
+	if _, err := ofxgo.UID(clientID).Valid(); err != nil {
+		return errors.New("Invalid ClientUID, must be 1 to 36 characters")
+	}
+	return nil
+}
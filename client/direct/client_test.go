@@ -6,9 +6,11 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aclindsa/ofxgo"
 	"github.com/stretchr/testify/assert"
@@ -344,3 +346,83 @@ func TestNewRequestMarshaler(t *testing.T) {
 		assert.Contains(t, data, "</DTCLIENT>")
 	})
 }
+
+func TestNewFileUID(t *testing.T) {
+	var fileUIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		for _, line := range strings.Split(string(body), "\r\n") {
+			if strings.HasPrefix(line, "NEWFILEUID:") {
+				fileUIDs = append(fileUIDs, strings.TrimPrefix(line, "NEWFILEUID:"))
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// local clients allow plain http, as long as there's no password
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	for _, newFileUID := range []bool{false, true} {
+		fileUIDs = nil
+		getLogger := func() (*zap.Logger, error) { return zap.NewNop(), nil }
+		c, err := newClient(url, Config{OFXVersion: "102", NewFileUID: newFileUID}, getLogger, getClient, getLimiterFromCache)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			resp, err := c.RequestNoParse(&ofxgo.Request{URL: url, Signon: ofxgo.SignonRequest{UserID: "user"}})
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+
+		require.Len(t, fileUIDs, 3)
+		if !newFileUID {
+			assert.Equal(t, []string{"NONE", "NONE", "NONE"}, fileUIDs)
+			continue
+		}
+		for i, uid := range fileUIDs {
+			assert.NotEqual(t, "NONE", uid)
+			assert.Len(t, uid, 36)
+			if i > 0 {
+				assert.NotEqual(t, fileUIDs[i-1], uid, "File UIDs should not repeat")
+			}
+		}
+	}
+}
+
+func TestRequestDelay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	for _, tc := range []struct {
+		description string
+		delayMillis int
+		expectSleep []time.Duration
+	}{
+		{description: "no delay by default"},
+		{description: "delay before each request", delayMillis: 1500, expectSleep: []time.Duration{1500 * time.Millisecond, 1500 * time.Millisecond}},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			requests = 0
+			getLogger := func() (*zap.Logger, error) { return zap.NewNop(), nil }
+			c, err := newClient(url, Config{OFXVersion: "102", RequestDelayMillis: tc.delayMillis}, getLogger, getClient, getLimiterFromCache)
+			require.NoError(t, err)
+			var slept []time.Duration
+			c.(*sageClient).sleep = func(d time.Duration) {
+				assert.Equal(t, len(slept), requests, "Delay should happen before the request is sent")
+				slept = append(slept, d)
+			}
+			for i := 0; i < 2; i++ {
+				resp, err := c.RequestNoParse(&ofxgo.Request{URL: url, Signon: ofxgo.SignonRequest{UserID: "user"}})
+				require.NoError(t, err)
+				resp.Body.Close()
+			}
+			assert.Equal(t, 2, requests)
+			assert.Equal(t, tc.expectSleep, slept)
+		})
+	}
+}
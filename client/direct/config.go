@@ -1,10 +1,95 @@
 package direct
 
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAccountInfoSince is the default DTACCTUP sent with account info requests.
+// Some institutions only return accounts updated after DTACCTUP, so default to long ago to list every account.
+var DefaultAccountInfoSince = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
 // Config contains financial institution connection details
 type Config struct {
 	AppID      string
 	AppVersion string
 	ClientID   string `json:",omitempty"`
-	OFXVersion string
-	NoIndent   bool `json:",omitempty"`
+	// ClientIDGenerated is when ClientID was generated or imported, if known
+	ClientIDGenerated *time.Time `json:",omitempty"`
+	OFXVersion        string
+	NoIndent          bool `json:",omitempty"`
+	// Retry overrides DefaultRetryPolicy for this institution
+	Retry *RetryPolicy `json:",omitempty"`
+	// KeepAliveDays sends a signon-only probe after this many days without contacting the institution, to keep access from expiring. 0 disables probes.
+	KeepAliveDays int `json:",omitempty"`
+	// AcctInfoSince overrides DefaultAccountInfoSince for this institution's account info requests
+	AcctInfoSince *time.Time `json:",omitempty"`
+	// NewFileUID sends a freshly randomized NEWFILEUID header with each request, for institutions whose OFX profile requires one
+	NewFileUID bool `json:",omitempty"`
+	// LenientParse repairs missing or malformed OFX 1XX SGML headers before parsing responses, for institutions which send nonstandard headers
+	LenientParse bool `json:",omitempty"`
+	// MaxHistoryDays is the most days of transaction history the institution serves. 0 means no limit.
+	MaxHistoryDays int `json:",omitempty"`
+	// AmountPlaces rounds amounts and balances to this many decimal places, for institutions whose amounts carry larger floating point errors than parsing repairs on its own
+	AmountPlaces *int32 `json:",omitempty"`
+	// RequestDelayMillis waits this long before each request, for institutions whose servers fail the first request after being idle. 0 disables the delay.
+	RequestDelayMillis int `json:",omitempty"`
+	// DefaultAcctType is the bank account type, CHECKING or SAVINGS, for accounts without a usable ACCTTYPE whose description matches no keywords. Empty skips those accounts.
+	DefaultAcctType string `json:",omitempty"`
+	// AcctTypeKeywords adds to or replaces DefaultAcctTypeKeywords. An empty type removes a default keyword.
+	AcctTypeKeywords map[string]string `json:",omitempty"`
+	// AccountDiscoveryDays checks the institution for new accounts and accounts it stopped reporting after this many days. 0 disables discovery checks.
+	AccountDiscoveryDays int `json:",omitempty"`
+	// LastAccountDiscovery is when the institution was last checked for new or missing accounts
+	LastAccountDiscovery *time.Time `json:",omitempty"`
+	// AccountInfoUnsupported is set once the institution fails an account info request for lack of support, which stops discovery checks
+	AccountInfoUnsupported bool `json:",omitempty"`
+}
+
+// RetryPolicy returns the institution's retry policy, or DefaultRetryPolicy if not set
+func (c Config) RetryPolicy() RetryPolicy {
+	if c.Retry == nil {
+		return DefaultRetryPolicy
+	}
+	return *c.Retry
+}
+
+// KeepAliveInterval returns the time between keepalive probes, or 0 if disabled
+func (c Config) KeepAliveInterval() time.Duration {
+	return time.Duration(c.KeepAliveDays) * 24 * time.Hour
+}
+
+// AccountDiscoveryInterval returns the time between account discovery checks, or 0 if disabled
+func (c Config) AccountDiscoveryInterval() time.Duration {
+	return time.Duration(c.AccountDiscoveryDays) * 24 * time.Hour
+}
+
+// AccountInfoSince returns the DTACCTUP for account info requests, or DefaultAccountInfoSince if not set
+func (c Config) AccountInfoSince() time.Time {
+	if c.AcctInfoSince == nil {
+		return DefaultAccountInfoSince
+	}
+	return *c.AcctInfoSince
+}
+
+// RequestDelay returns the delay before each request to the institution
+func (c Config) RequestDelay() time.Duration {
+	return time.Duration(c.RequestDelayMillis) * time.Millisecond
+}
+
+// ValidateHistoryDays returns an error if a download of the last 'days' days is empty or reaches further back than MaxHistoryDays
+func (c Config) ValidateHistoryDays(days int) error {
+	if days <= 0 {
+		return errors.Errorf("Days must be greater than zero: %d", days)
+	}
+	if c.MaxHistoryDays > 0 && days > c.MaxHistoryDays {
+		return errors.Errorf("Days must not exceed the institution's maximum history of %d days: %d", c.MaxHistoryDays, days)
+	}
+	return nil
+}
+
+// RelativeRange returns the statement range for the last 'days' days, ending at 'now'
+func RelativeRange(days int, now time.Time) (start, end time.Time) {
+	return now.AddDate(0, 0, -days), now
 }
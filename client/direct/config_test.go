@@ -0,0 +1,25 @@
+package direct
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHistoryDays(t *testing.T) {
+	assert.NoError(t, Config{}.ValidateHistoryDays(365))
+	assert.EqualError(t, Config{}.ValidateHistoryDays(0), "Days must be greater than zero: 0")
+	assert.EqualError(t, Config{}.ValidateHistoryDays(-1), "Days must be greater than zero: -1")
+
+	config := Config{MaxHistoryDays: 90}
+	assert.NoError(t, config.ValidateHistoryDays(90))
+	assert.EqualError(t, config.ValidateHistoryDays(91), "Days must not exceed the institution's maximum history of 90 days: 91")
+}
+
+func TestRelativeRange(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	start, end := RelativeRange(30, now)
+	assert.Equal(t, time.Date(2020, 1, 31, 12, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, now, end)
+}
@@ -0,0 +1,185 @@
+package direct
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DNSProbe resolves the institution's host name
+	DNSProbe = "DNS lookup"
+
+	// ConnectivityTimeout bounds a whole connectivity check, including waiting for the institution's rate limit
+	ConnectivityTimeout = 20 * time.Second
+
+	// anonymousUser is the OFX spec's user ID and password for requests which don't need credentials, like profile requests
+	anonymousUser = "anonymous00000000000000000000000"
+)
+
+// ConnectivityError is returned by ConnectivityReport.Err, naming the first probe which failed
+type ConnectivityError struct {
+	Probe ProbeResult
+}
+
+func (e ConnectivityError) Error() string {
+	return e.Probe.Name + " failed: " + e.Probe.Error
+}
+
+// ConnectivityReport contains the probes of a connectivity check
+type ConnectivityReport struct {
+	Probes []ProbeResult
+	// Signon is true if the check signed on with the connector's credentials
+	Signon bool
+}
+
+// Err returns a ConnectivityError for the first failed probe, or nil if every probe passed
+func (r ConnectivityReport) Err() error {
+	for _, probe := range r.Probes {
+		if !probe.Passed {
+			return ConnectivityError{Probe: probe}
+		}
+	}
+	return nil
+}
+
+// AuthFailed returns true if the institution rejected the credentials during signon
+func (r ConnectivityReport) AuthFailed() bool {
+	for _, probe := range r.Probes {
+		if probe.Name == SignonProbe && (probe.StatusCode == ofxAuthFailed || probe.StatusCode == ofxPasswordLockout) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckConnectivity checks the connector's institution is reachable with a DNS lookup, a TLS handshake, and one OFX request, all bounded by ConnectivityTimeout.
+// If 'signon' is true, the request is a signon-only request with the connector's credentials. Otherwise, an anonymous profile request is sent, so credentials are never used.
+// The OFX request is never retried, only its connection, and waits for the institution's rate limit, so a failed check can't deepen a lockout.
+func CheckConnectivity(ctx context.Context, connector Connector, signon bool) ConnectivityReport {
+	ctx, cancel := context.WithTimeout(ctx, ConnectivityTimeout)
+	defer cancel()
+	report := ConnectivityReport{Signon: signon}
+	client, err := newSimpleClient(connector.URL(), connector.Config())
+	if err != nil {
+		report.Probes = []ProbeResult{{Name: "Client setup", Error: redactCredentials(connector, err.Error())}}
+		return report
+	}
+	requestNoParse := func(req *ofxgo.Request) (*http.Response, error) {
+		if err := getLimiterFromCache(connector.URL()).Wait(ctx); err != nil {
+			return nil, errors.Wrap(err, "Timed out waiting for the institution's rate limit")
+		}
+		return requestWithContext(ctx, req, client.RequestNoParse)
+	}
+	lookupHost := func(host string) ([]string, error) {
+		return net.DefaultResolver.LookupHost(ctx, host)
+	}
+	report.Probes = checkConnectivity(connector, signon, lookupHost, dialTLS, requestNoParse, time.Now)
+	return report
+}
+
+func checkConnectivity(
+	connector Connector,
+	signon bool,
+	lookupHost func(host string) ([]string, error),
+	probeTLS tlsProber,
+	requestNoParse func(*ofxgo.Request) (*http.Response, error),
+	now func() time.Time,
+) []ProbeResult {
+	dnsResult, ok := runDNSProbe(connector, lookupHost, now)
+	probes := []ProbeResult{dnsResult}
+	if !ok {
+		return probes
+	}
+	tlsResult, ok := runTLSProbe(connector, probeTLS, now)
+	probes = append(probes, tlsResult)
+	if !ok {
+		return probes
+	}
+
+	if signon {
+		var signonQuery ofxgo.Request
+		signonResult, _, _ := runOFXProbe(SignonProbe, connector, &signonQuery, requestNoParse, now)
+		return append(probes, signonResult)
+	}
+
+	uid, err := ofxgo.RandomUID()
+	if err != nil {
+		return append(probes, ProbeResult{Name: ProfileProbe, Error: err.Error()})
+	}
+	var profileQuery ofxgo.Request
+	profileQuery.Prof = append(profileQuery.Prof, &ofxgo.ProfileRequest{
+		TrnUID:        *uid,
+		ClientRouting: "NONE",
+		DtProfUp:      ofxgo.Date{Time: time.Unix(0, 0).UTC()},
+	})
+	anonymous := New(connector.Description(), connector.FID(), connector.Org(), connector.URL(), anonymousUser, anonymousUser, connector.Config())
+	profileResult, _, hardFailure := runOFXProbe(ProfileProbe, anonymous, &profileQuery, requestNoParse, now)
+	if !hardFailure && !profileResult.Passed {
+		// any OFX response shows the institution is reachable, even if it rejects anonymous profile requests
+		profileResult.Passed = true
+		profileResult.Details = map[string]string{"Signon status": profileResult.Error}
+		profileResult.Error = ""
+	}
+	return append(probes, profileResult)
+}
+
+func runDNSProbe(connector Connector, lookupHost func(host string) ([]string, error), now func() time.Time) (ProbeResult, bool) {
+	result := ProbeResult{Name: DNSProbe}
+	u, err := url.Parse(connector.URL())
+	if err != nil || u.Hostname() == "" {
+		result.Error = "Institution URL is malformed"
+		if err != nil {
+			result.Error = errors.Wrap(err, result.Error).Error()
+		}
+		return result, false
+	}
+	if net.ParseIP(u.Hostname()) != nil || strings.EqualFold(u.Hostname(), "localhost") {
+		result.Passed = true
+		result.Skipped = true
+		result.Details = map[string]string{"Reason": "URL does not use a host name"}
+		return result, true
+	}
+
+	start := now()
+	addresses, err := lookupHost(u.Hostname())
+	result.ElapsedMillis = now().Sub(start).Nanoseconds() / int64(time.Millisecond)
+	if err != nil {
+		result.Error = err.Error()
+		return result, false
+	}
+	result.Passed = true
+	result.Details = map[string]string{"Addresses": strings.Join(addresses, ", ")}
+	return result, true
+}
+
+// requestWithContext sends 'req', but stops waiting for the response once 'ctx' is done
+func requestWithContext(ctx context.Context, req *ofxgo.Request, requestNoParse func(*ofxgo.Request) (*http.Response, error)) (*http.Response, error) {
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := requestNoParse(req)
+		results <- result{resp, err}
+	}()
+	select {
+	case r := <-results:
+		return r.resp, r.err
+	case <-ctx.Done():
+		go func() {
+			// close the abandoned response's connection once it arrives
+			if r := <-results; r.resp != nil {
+				r.resp.Body.Close()
+			}
+		}()
+		return nil, errors.Wrap(ctx.Err(), "Timed out waiting for the institution to respond")
+	}
+}
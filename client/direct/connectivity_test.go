@@ -0,0 +1,126 @@
+package direct
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConnectivity(t *testing.T) {
+	for _, tc := range []struct {
+		description   string
+		url           string
+		signon        bool
+		dnsErr        error
+		statusCode    int
+		responseErr   error
+		expectUser    string
+		expectProbes  []string
+		expectErr     string
+		expectAuthErr bool
+	}{
+		{
+			description:  "anonymous profile request",
+			url:          "https://example.com",
+			expectUser:   anonymousUser,
+			expectProbes: []string{DNSProbe, TLSProbe, ProfileProbe},
+		},
+		{
+			description:  "profile rejected but institution is reachable",
+			url:          "https://example.com",
+			statusCode:   15500,
+			expectUser:   anonymousUser,
+			expectProbes: []string{DNSProbe, TLSProbe, ProfileProbe},
+		},
+		{
+			description:  "signon with credentials",
+			url:          "https://example.com",
+			signon:       true,
+			expectUser:   "some user",
+			expectProbes: []string{DNSProbe, TLSProbe, SignonProbe},
+		},
+		{
+			description:   "signon rejected",
+			url:           "https://example.com",
+			signon:        true,
+			statusCode:    15500,
+			expectUser:    "some user",
+			expectProbes:  []string{DNSProbe, TLSProbe, SignonProbe},
+			expectErr:     SignonProbe + " failed: ",
+			expectAuthErr: true,
+		},
+		{
+			description:  "DNS failure stops early",
+			url:          "https://example.com",
+			signon:       true,
+			dnsErr:       errors.New("no such host"),
+			expectProbes: []string{DNSProbe},
+			expectErr:    "DNS lookup failed: no such host",
+		},
+		{
+			description:  "HTTP error fails",
+			url:          "https://example.com",
+			responseErr:  errors.New(requestStatusPrefix + "503 Service Unavailable"),
+			expectUser:   anonymousUser,
+			expectProbes: []string{DNSProbe, TLSProbe, ProfileProbe},
+			expectErr:    ProfileProbe + " failed: ",
+		},
+		{
+			description:  "localhost skips DNS",
+			url:          "http://localhost:8000",
+			dnsErr:       errors.New("should not look up"),
+			expectUser:   anonymousUser,
+			expectProbes: []string{DNSProbe, TLSProbe, ProfileProbe},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			connector := New("Some Bank", "1234", "some org", tc.url, "some user", "some password", Config{})
+			lookupHost := func(host string) ([]string, error) {
+				assert.Equal(t, "example.com", host)
+				return []string{"192.0.2.1"}, tc.dnsErr
+			}
+			probeTLS := func(u *url.URL) (tls.ConnectionState, error) {
+				return tls.ConnectionState{Version: tls.VersionTLS12}, nil
+			}
+			requestCount := 0
+			requestNoParse := func(req *ofxgo.Request) (*http.Response, error) {
+				requestCount++
+				assert.Equal(t, tc.expectUser, string(req.Signon.UserID))
+				if tc.responseErr != nil {
+					return nil, tc.responseErr
+				}
+				body := ofxResponseBody(t, tc.statusCode)
+				return &http.Response{Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+			}
+
+			report := ConnectivityReport{
+				Probes: checkConnectivity(connector, tc.signon, lookupHost, probeTLS, requestNoParse, time.Now),
+				Signon: tc.signon,
+			}
+			var probes []string
+			for _, probe := range report.Probes {
+				probes = append(probes, probe.Name)
+				assert.NotContains(t, probe.Error, "some password")
+			}
+			assert.Equal(t, tc.expectProbes, probes)
+			assert.True(t, requestCount <= 1, "Connectivity checks must not retry requests")
+			assert.Equal(t, tc.expectAuthErr, report.AuthFailed())
+			if tc.expectErr == "" {
+				assert.NoError(t, report.Err())
+				return
+			}
+			require.Error(t, report.Err())
+			assert.IsType(t, ConnectivityError{}, report.Err())
+			assert.True(t, strings.HasPrefix(report.Err().Error(), tc.expectErr), report.Err().Error())
+		})
+	}
+}
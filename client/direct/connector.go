@@ -2,7 +2,9 @@ package direct
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/aclindsa/ofxgo"
@@ -21,6 +23,10 @@ const (
 var (
 	// ErrAuthFailed is returned whenever a signon request fails with an authentication problem
 	ErrAuthFailed = errors.New("Username or password is incorrect")
+	// ErrLockedOut is returned whenever a signon request fails because the institution locked the account
+	ErrLockedOut = errors.New("Account is locked out. Contact the institution before trying again")
+	// ErrAccountInfoUnsupported is returned when the institution doesn't answer account info requests from the signup message set
+	ErrAccountInfoUnsupported = errors.New("Institution does not support account info requests")
 )
 
 // Connector downloads statements directly from an institution's OFX/QFX API
@@ -32,6 +38,7 @@ type Connector interface {
 	Password() redactor.String
 	SetPassword(redactor.String)
 	Config() Config
+	SetConfig(Config)
 }
 
 // Requestor can annotate an ofxgo.Request to fetch statements
@@ -90,6 +97,10 @@ func (d *directConnect) Config() Config {
 	return d.ConnectorConfig
 }
 
+func (d *directConnect) SetConfig(config Config) {
+	d.ConnectorConfig = config
+}
+
 // UnmarshalConnector unmarshals the given bytes into a direct connector
 func UnmarshalConnector(b []byte) (Connector, error) {
 	var dc directConnect
@@ -117,29 +128,80 @@ func ValidateConnector(connector Connector) error {
 	config := connector.Config()
 	errs.ErrIf(config.AppID == "", "Institution app ID must not be empty")
 	errs.ErrIf(config.AppVersion == "", "Institution app version must not be empty")
+	if config.ClientID != "" {
+		errs.AddErr(ValidateClientID(config.ClientID))
+	}
 	if !errs.ErrIf(config.OFXVersion == "", "Institution OFX version must not be empty") {
 		_, err := ofxgo.NewOfxVersion(config.OFXVersion)
 		errs.AddErr(err)
 	}
+	if config.Retry != nil {
+		errs.AddErr(config.Retry.Validate())
+	}
+	errs.ErrIf(config.KeepAliveDays < 0, "Institution keepalive days must not be negative: %d", config.KeepAliveDays)
+	errs.ErrIf(config.MaxHistoryDays < 0, "Institution max history days must not be negative: %d", config.MaxHistoryDays)
+	if config.AmountPlaces != nil {
+		errs.ErrIf(*config.AmountPlaces < 0 || *config.AmountPlaces > maxAmountPlaces, "Institution amount places must be between 0 and %d: %d", maxAmountPlaces, *config.AmountPlaces)
+	}
+	errs.ErrIf(config.RequestDelayMillis < 0 || config.RequestDelayMillis > maxRequestDelayMillis, "Institution request delay must be between 0 and %d milliseconds: %d", maxRequestDelayMillis, config.RequestDelayMillis)
+	errs.ErrIf(config.AccountDiscoveryDays < 0, "Institution account discovery days must not be negative: %d", config.AccountDiscoveryDays)
+	if config.DefaultAcctType != "" {
+		errs.ErrIf(ParseAccountType(config.DefaultAcctType) == 0, "Institution default account type must be %q or %q: %q", CheckingType, SavingsType, config.DefaultAcctType)
+	}
+	for keyword, kind := range config.AcctTypeKeywords {
+		errs.ErrIf(strings.TrimSpace(keyword) == "", "Institution account type keywords must not be empty")
+		errs.ErrIf(kind != "" && ParseAccountType(kind) == 0, "Institution account type keyword %q must have type %q or %q: %q", keyword, CheckingType, SavingsType, kind)
+	}
 	return errs.ErrOrNil()
 }
 
-// Statement downloads and returns transactions from a direct connector for the given time period
-func Statement(connector Connector, start, end time.Time, requestors []Requestor, parser model.TransactionParser) ([]ledger.Transaction, error) {
+// SignonWarning is a nonzero signon status with a non-fatal severity, like a password which expires soon
+type SignonWarning struct {
+	Code     int
+	Severity string
+	Meaning  string
+	Message  string
+}
+
+func (w SignonWarning) String() string {
+	warning := fmt.Sprintf("Signon status %d", w.Code)
+	if w.Meaning != "" {
+		warning += ": " + w.Meaning
+	}
+	if w.Message != "" {
+		warning += ": " + w.Message
+	}
+	return warning
+}
+
+// Statement downloads and returns transactions from a direct connector for the given time period.
+// Also returns the signon status if the institution signed on with a warning, which doesn't prevent the download.
+func Statement(connector Connector, start, end time.Time, requestors []Requestor, parser model.TransactionParser) ([]ledger.Transaction, *SignonWarning, error) {
 	client, err := newSimpleClient(connector.URL(), connector.Config())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return fetchTransactions(
+	txns, warning, err := fetchTransactions(
 		connector,
 		start, end,
 		requestors,
 		// TODO it seems the ledger balance is nearly always the current balance, rather than the statement close. Restore this when a true closing balance can be found
 		//balanceTransactions,
-		client.Request,
-		parser,
+		withRetries(connector.Config().RetryPolicy(), client.Request, time.Sleep),
+		roundingParser(connector.Config().AmountPlaces, parser),
 	)
+	if warning != nil {
+		if logger, logErr := getLoggerFromEnv(); logErr == nil {
+			logger.Warn("Institution signed on with a warning",
+				zap.String("institution", connector.Description()),
+				zap.Int("code", warning.Code),
+				zap.String("severity", warning.Severity),
+				zap.String("message", warning.Message),
+			)
+		}
+	}
+	return txns, warning, err
 }
 
 func fetchTransactions(
@@ -148,47 +210,138 @@ func fetchTransactions(
 	requestors []Requestor,
 	doRequest func(*ofxgo.Request) (*ofxgo.Response, error),
 	parse model.TransactionParser,
-) ([]ledger.Transaction, error) {
+) ([]ledger.Transaction, *SignonWarning, error) {
 	var query ofxgo.Request
 	for _, r := range requestors {
 		if err := r.Statement(&query, start, end); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 	if len(query.Bank) == 0 && len(query.CreditCard) == 0 {
-		return nil, errors.Errorf("Invalid statement query: does not contain any statement requests: %+v", query)
+		return nil, nil, errors.Errorf("Invalid statement query: does not contain any statement requests: %+v", query)
 	}
 
 	addSignonRequest(connector, &query)
 
 	response, err := doRequest(&query)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if response.Signon.Status.Code != 0 {
-		if response.Signon.Status.Code == ofxAuthFailed {
-			return nil, ErrAuthFailed
-		}
-		meaning, err := response.Signon.Status.CodeMeaning()
-		if err != nil {
-			return nil, errors.Wrap(err, "Failed to parse OFX response code")
-		}
-		return nil, errors.Errorf("Nonzero signon status (%d: %s) with message: %s", response.Signon.Status.Code, meaning, response.Signon.Status.Message)
+	if err := signonError(response); err != nil {
+		return nil, nil, err
 	}
 
 	_, txns, err := parse(response)
-	return txns, err
+	return txns, signonWarning(response), err
+}
+
+// isSignonWarning returns true if 'status' is nonzero, but its severity doesn't prevent using the rest of the response
+func isSignonWarning(status ofxgo.Status) bool {
+	if status.Code == 0 {
+		return false
+	}
+	switch status.Severity {
+	case "INFO", "WARN":
+		return true
+	default:
+		return false
+	}
+}
+
+// signonWarning returns response's signon status if it is a warning, nil otherwise
+func signonWarning(response *ofxgo.Response) *SignonWarning {
+	status := response.Signon.Status
+	if !isSignonWarning(status) {
+		return nil
+	}
+	meaning, _ := status.CodeMeaning()
+	return &SignonWarning{
+		Code:     int(status.Code),
+		Severity: string(status.Severity),
+		Meaning:  meaning,
+		Message:  string(status.Message),
+	}
+}
+
+// signonError returns an error if response's signon status is nonzero with an error severity. Authentication failures are always errors.
+func signonError(response *ofxgo.Response) error {
+	if response.Signon.Status.Code == 0 {
+		return nil
+	}
+	switch response.Signon.Status.Code {
+	case ofxAuthFailed:
+		return ErrAuthFailed
+	case ofxPasswordLockout:
+		return ErrLockedOut
+	}
+	if isSignonWarning(response.Signon.Status) {
+		return nil
+	}
+	meaning, err := response.Signon.Status.CodeMeaning()
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse OFX response code")
+	}
+	return errors.Errorf("Nonzero signon status (%d: %s) with message: %s", response.Signon.Status.Code, meaning, response.Signon.Status.Message)
+}
+
+// KeepAlive sends a signon-only request to keep the connector's access active. No statements are downloaded.
+func KeepAlive(connector Connector) error {
+	client, err := newSimpleClient(connector.URL(), connector.Config())
+	if err != nil {
+		return err
+	}
+	return keepAlive(connector, withRetries(connector.Config().RetryPolicy(), client.Request, time.Sleep))
+}
+
+func keepAlive(connector Connector, doRequest func(*ofxgo.Request) (*ofxgo.Response, error)) error {
+	var query ofxgo.Request
+	addSignonRequest(connector, &query)
+	response, err := doRequest(&query)
+	if err != nil {
+		return err
+	}
+	return signonError(response)
 }
 
 // Verify attempts to sign in with the given account. Returns any encountered errors
 func Verify(connector Connector, requestor Requestor, parser model.TransactionParser) error {
 	end := time.Now()
 	start := end.Add(-24 * time.Hour)
-	_, err := Statement(connector, start, end, []Requestor{requestor}, parser)
+	_, _, err := Statement(connector, start, end, []Requestor{requestor}, parser)
 	return err
 }
 
+// VerifyConnector attempts to sign in with the connector's credentials, without an account. Also requests account info if 'accountInfo' is true.
+func VerifyConnector(connector Connector, accountInfo bool) error {
+	client, err := newSimpleClient(connector.URL(), connector.Config())
+	if err != nil {
+		return err
+	}
+	return verifyConnector(connector, accountInfo, withRetries(connector.Config().RetryPolicy(), client.Request, time.Sleep))
+}
+
+func verifyConnector(connector Connector, accountInfo bool, doRequest func(*ofxgo.Request) (*ofxgo.Response, error)) error {
+	if !accountInfo {
+		return keepAlive(connector, doRequest)
+	}
+	query, err := accountInfoRequest(connector)
+	if err != nil {
+		return err
+	}
+	resp, err := doRequest(&query)
+	if err != nil {
+		return err
+	}
+	if err := signonError(resp); err != nil {
+		return err
+	}
+	if len(resp.Signup) == 0 {
+		return errors.Wrap(ErrAccountInfoUnsupported, "Response did not contain any messages")
+	}
+	return nil
+}
+
 func addSignonRequest(connector Connector, req *ofxgo.Request) {
 	config := connector.Config()
 	req.URL = connector.URL()
@@ -207,31 +360,25 @@ func Accounts(connector Connector, logger *zap.Logger) ([]model.Account, error)
 	if err != nil {
 		return nil, err
 	}
-	return accounts(connector, logger, client.Request)
+	return accounts(connector, logger, withRetries(connector.Config().RetryPolicy(), client.Request, time.Sleep))
 }
 
 func accounts(connector Connector, logger *zap.Logger, doRequest func(*ofxgo.Request) (*ofxgo.Response, error)) ([]model.Account, error) {
-	var query ofxgo.Request
-	uid, err := ofxgo.RandomUID()
+	query, err := accountInfoRequest(connector)
 	if err != nil {
 		return nil, err
 	}
-	query.Signup = append(query.Signup, &ofxgo.AcctInfoRequest{
-		TrnUID: *uid,
-	})
-	addSignonRequest(connector, &query)
-
 	resp, err := doRequest(&query)
 	if err != nil {
 		return nil, err
 	}
 	if len(resp.Signup) == 0 {
-		return nil, errors.New("Response did not contain any messages")
+		return nil, errors.Wrap(ErrAccountInfoUnsupported, "Response did not contain any messages")
 	}
 
 	acctInfoResp, ok := resp.Signup[0].(*ofxgo.AcctInfoResponse)
 	if !ok {
-		return nil, errors.Errorf("Unknown account info response type: %T", resp.Signup[0])
+		return nil, errors.Wrapf(ErrAccountInfoUnsupported, "Unknown account info response type: %T", resp.Signup[0])
 	}
 	var accounts []model.Account
 	for _, acctInfo := range acctInfoResp.AcctInfo {
@@ -242,6 +389,21 @@ func accounts(connector Connector, logger *zap.Logger, doRequest func(*ofxgo.Req
 	return accounts, nil
 }
 
+// accountInfoRequest creates a signon and account info request for the connector's institution
+func accountInfoRequest(connector Connector) (ofxgo.Request, error) {
+	var query ofxgo.Request
+	uid, err := ofxgo.RandomUID()
+	if err != nil {
+		return query, err
+	}
+	query.Signup = append(query.Signup, &ofxgo.AcctInfoRequest{
+		TrnUID:   *uid,
+		DtAcctUp: ofxgo.Date{Time: connector.Config().AccountInfoSince()},
+	})
+	addSignonRequest(connector, &query)
+	return query, nil
+}
+
 func parseAcctInfo(connector Connector, acctInfo ofxgo.AcctInfo, logger *zap.Logger) (model.Account, bool) {
 	accountName := acctInfo.Desc.String()
 	if accountName == "" {
@@ -264,15 +426,24 @@ func parseAcctInfo(connector Connector, acctInfo ofxgo.AcctInfo, logger *zap.Log
 		if accountName == "" {
 			accountName = accountID
 		}
-		switch accountType {
-		case CheckingType:
-			return NewCheckingAccount(accountID, bankID, accountName, connector), true
-		case SavingsType:
-			return NewSavingsAccount(accountID, bankID, accountName, connector), true
-		default:
-			logger.Warn("Bank account is of unsupported type", zap.String("type", accountTypeStr))
-			return nil, false
+		inferred := false
+		if accountType == 0 {
+			var reason string
+			accountType, reason = InferAccountType(accountName, connector.Config())
+			if accountType == 0 {
+				logger.Warn("Bank account is of unsupported type and its type could not be inferred", zap.String("type", accountTypeStr))
+				return nil, false
+			}
+			inferred = true
+			logger.Warn("Bank account is of unsupported type, inferred its type instead. Correct it by updating the account if needed",
+				zap.String("type", accountTypeStr),
+				zap.String("inferredType", accountType.String()),
+				zap.String("reason", reason),
+			)
 		}
+		account := newBankAccount(accountType, accountID, bankID, accountName, connector).(*bankAccount)
+		account.AcctTypeInferred = inferred
+		return account, true
 	case acctInfo.CCAcctInfo != nil:
 		accountID := acctInfo.CCAcctInfo.CCAcctFrom.AcctID.String()
 		logger = logger.With(zap.String("accountID", accountID))
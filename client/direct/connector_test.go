@@ -145,7 +145,7 @@ func TestFetchTransactions(t *testing.T) {
 				return nil, someTransactions, nil
 			}
 
-			txns, err := fetchTransactions(
+			txns, warning, err := fetchTransactions(
 				account.DirectConnect,
 				tc.startTime,
 				tc.endTime,
@@ -166,6 +166,155 @@ func TestFetchTransactions(t *testing.T) {
 
 			require.NoError(t, err)
 			assert.Equal(t, someTransactions, txns, "returned txns must be equal to result of parse")
+			assert.Nil(t, warning)
+		})
+	}
+}
+
+func TestSignonStatus(t *testing.T) {
+	for _, tc := range []struct {
+		description   string
+		status        ofxgo.Status
+		expectErr     string
+		expectWarning string
+	}{
+		{
+			description: "success",
+			status:      ofxgo.Status{Code: 0, Severity: "INFO"},
+		},
+		{
+			description:   "warning",
+			status:        ofxgo.Status{Code: 15000, Severity: "WARN", Message: "Password expires in 5 days"},
+			expectWarning: "Signon status 15000: Must change USERPASS: Password expires in 5 days",
+		},
+		{
+			description:   "info",
+			status:        ofxgo.Status{Code: 1, Severity: "INFO"},
+			expectWarning: "Signon status 1: Client is up-to-date",
+		},
+		{
+			description: "error",
+			status:      ofxgo.Status{Code: 2000, Severity: "ERROR", Message: "down for maintenance"},
+			expectErr:   "Nonzero signon status (2000: General error) with message: down for maintenance",
+		},
+		{
+			description: "auth failure is always an error",
+			status:      ofxgo.Status{Code: ofxAuthFailed, Severity: "WARN"},
+			expectErr:   ErrAuthFailed.Error(),
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			var resp ofxgo.Response
+			resp.Signon.Status = tc.status
+			err := signonError(&resp)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			warning := signonWarning(&resp)
+			if tc.expectWarning == "" {
+				assert.Nil(t, warning)
+				return
+			}
+			require.NotNil(t, warning)
+			assert.Equal(t, tc.expectWarning, warning.String())
+		})
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	connector := &directConnect{
+		ConnectorPassword: "some password",
+		ConnectorURL:      "some URL",
+		ConnectorUsername: "some username",
+		BasicInstitution:  model.BasicInstitution{InstFID: "some FID", InstOrg: "some org"},
+	}
+	requestErr := errors.New("some error")
+	for _, tc := range []struct {
+		description string
+		requestErr  error
+		statusCode  ofxgo.Int
+		expectErr   error
+	}{
+		{description: "happy path"},
+		{description: "request error", requestErr: requestErr, expectErr: requestErr},
+		{description: "auth failed", statusCode: ofxAuthFailed, expectErr: ErrAuthFailed},
+		{description: "locked out", statusCode: ofxPasswordLockout, expectErr: ErrLockedOut},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			err := keepAlive(connector, func(req *ofxgo.Request) (*ofxgo.Response, error) {
+				assert.Equal(t, &ofxgo.Request{
+					URL: "some URL",
+					Signon: ofxgo.SignonRequest{
+						Fid:      "some FID",
+						Org:      "some org",
+						UserID:   "some username",
+						UserPass: "some password",
+					},
+				}, req, "Keepalive should only sign on")
+				if tc.requestErr != nil {
+					return nil, tc.requestErr
+				}
+				var resp ofxgo.Response
+				resp.Signon.Status.Code = tc.statusCode
+				return &resp, nil
+			})
+			assert.Equal(t, tc.expectErr, err)
+		})
+	}
+}
+
+func TestVerifyConnector(t *testing.T) {
+	connector := &directConnect{
+		ConnectorPassword: "some password",
+		ConnectorURL:      "some URL",
+		ConnectorUsername: "some username",
+		BasicInstitution:  model.BasicInstitution{InstFID: "some FID", InstOrg: "some org"},
+	}
+	requestErr := errors.New("some error")
+	for _, tc := range []struct {
+		description string
+		accountInfo bool
+		requestErr  error
+		statusCode  ofxgo.Int
+		noSignup    bool
+		expectErr   string
+	}{
+		{description: "signon only"},
+		{description: "signon auth failed", statusCode: ofxAuthFailed, expectErr: ErrAuthFailed.Error()},
+		{description: "account info", accountInfo: true},
+		{description: "account info request error", accountInfo: true, requestErr: requestErr, expectErr: "some error"},
+		{description: "account info auth failed", accountInfo: true, statusCode: ofxAuthFailed, expectErr: ErrAuthFailed.Error()},
+		{description: "account info unsupported", accountInfo: true, noSignup: true, expectErr: "Response did not contain any messages: " + ErrAccountInfoUnsupported.Error()},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			err := verifyConnector(connector, tc.accountInfo, func(req *ofxgo.Request) (*ofxgo.Response, error) {
+				assert.Equal(t, "some username", req.Signon.UserID.String())
+				if tc.accountInfo {
+					require.Len(t, req.Signup, 1)
+					assert.IsType(t, &ofxgo.AcctInfoRequest{}, req.Signup[0])
+				} else {
+					assert.Empty(t, req.Signup, "Verifying without account info should only sign on")
+				}
+				if tc.requestErr != nil {
+					return nil, tc.requestErr
+				}
+				var resp ofxgo.Response
+				resp.Signon.Status.Code = tc.statusCode
+				if tc.accountInfo && !tc.noSignup {
+					resp.Signup = []ofxgo.Message{&ofxgo.AcctInfoResponse{}}
+				}
+				return &resp, nil
+			})
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				if tc.statusCode == ofxAuthFailed {
+					assert.Equal(t, ErrAuthFailed, err)
+				}
+				return
+			}
+			assert.NoError(t, err)
 		})
 	}
 }
@@ -283,6 +432,17 @@ func TestValidateConnector(t *testing.T) {
 				`Invalid OfxVersion: "ABC"`,
 			},
 		},
+		{
+			name: "request delay too long",
+			connector: &directConnect{
+				ConnectorConfig: Config{
+					RequestDelayMillis: 60 * 1000,
+				},
+			},
+			errors: []string{
+				"Institution request delay must be between 0 and 10000 milliseconds: 60000",
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			err := ValidateConnector(tc.connector)
@@ -304,7 +464,7 @@ func TestValidateConnector(t *testing.T) {
 
 func TestStatement(t *testing.T) {
 	connector := &directConnect{}
-	_, err := Statement(connector, time.Now(), time.Now(), nil, nil)
+	_, _, err := Statement(connector, time.Now(), time.Now(), nil, nil)
 	assert.Error(t, err)
 }
 
@@ -352,6 +512,10 @@ func TestAccountsImpl(t *testing.T) {
 		},
 	}
 	doRequest := func(req *ofxgo.Request) (*ofxgo.Response, error) {
+		require.Len(t, req.Signup, 1)
+		acctInfoReq, ok := req.Signup[0].(*ofxgo.AcctInfoRequest)
+		require.True(t, ok)
+		assert.Equal(t, DefaultAccountInfoSince, acctInfoReq.DtAcctUp.Time, "DTACCTUP should default to long ago")
 		return someResp, nil
 	}
 
@@ -368,6 +532,18 @@ func TestAccountsImpl(t *testing.T) {
 	}, accounts)
 }
 
+func TestAccountsDtAcctUp(t *testing.T) {
+	since := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	connector := &directConnect{ConnectorConfig: Config{AcctInfoSince: &since}}
+	_, _ = accounts(connector, zap.NewNop(), func(req *ofxgo.Request) (*ofxgo.Response, error) {
+		require.Len(t, req.Signup, 1)
+		acctInfoReq, ok := req.Signup[0].(*ofxgo.AcctInfoRequest)
+		require.True(t, ok)
+		assert.Equal(t, since, acctInfoReq.DtAcctUp.Time)
+		return nil, errors.New("some error")
+	})
+}
+
 func TestParseAcctInfo(t *testing.T) {
 	connector := &directConnect{}
 	for _, tc := range []struct {
@@ -437,6 +613,29 @@ func TestParseAcctInfo(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			description: "bank account type inferred from description",
+			acctInfo: ofxgo.AcctInfo{
+				Desc: "Premier Checking",
+				BankAcctInfo: &ofxgo.BankAcctInfo{
+					BankAcctFrom: ofxgo.BankAcct{
+						AcctID: "some account ID",
+						BankID: "some bank ID",
+					},
+					SupTxDl: true,
+				},
+			},
+			expectAccount: &bankAccount{
+				BankAccountType:  CheckingType.String(),
+				RoutingNumber:    "some bank ID",
+				AcctTypeInferred: true,
+				directAccount: directAccount{
+					AccountID:          "some account ID",
+					AccountDescription: "Premier Checking",
+					DirectConnect:      connector,
+				},
+			},
+		},
 		{
 			description: "credit card account",
 			acctInfo: ofxgo.AcctInfo{
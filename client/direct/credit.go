@@ -23,6 +23,13 @@ func NewCreditCard(id, description string, connector Connector) Account {
 	}
 }
 
+// WithInstitution implements InstitutionReference
+func (cc *CreditCard) WithInstitution(id string, connector Connector) InstitutionReference {
+	account := *cc
+	account.setInstitution(id, connector)
+	return &account
+}
+
 // Statement implements Requestor
 func (cc *CreditCard) Statement(req *ofxgo.Request, start, end time.Time) error {
 	return generateCCStatement(cc, req, start, end, ofxgo.RandomUID)
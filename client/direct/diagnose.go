@@ -0,0 +1,305 @@
+package direct
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/pkg/errors"
+)
+
+const (
+	tlsProbeTimeout     = 10 * time.Second
+	maxProbeBodySize    = 1 << 20
+	probeExcerptLength  = 500
+	redactedPlaceholder = "****"
+
+	ofxClientUIDError  = 15510
+	ofxPasswordLockout = 15502
+	ofxGeneralError    = 2000
+)
+
+const (
+	// TLSProbe checks the TLS handshake and certificate chain
+	TLSProbe = "TLS handshake"
+	// ProfileProbe sends an OFX profile request
+	ProfileProbe = "Profile request"
+	// SignonProbe sends a signon-only request
+	SignonProbe = "Signon request"
+	// AccountInfoProbe sends an account info request
+	AccountInfoProbe = "Account info request"
+)
+
+var (
+	credentialElements = regexp.MustCompile(`(?i)(<(USERID|USERPASS|USERKEY|NEWUSERPASS)>)[^<\r\n]*`)
+	htmlResponse       = regexp.MustCompile(`(?i)^\s*(<!DOCTYPE\s+html|<html)`)
+
+	errHTMLResponse = errors.New("Received an HTML response instead of OFX")
+)
+
+// DiagnosticReport contains the results of each probe run against a connector, along with suggested fixes
+type DiagnosticReport struct {
+	Probes      []ProbeResult
+	Suggestions []string
+}
+
+// ProbeResult is the outcome of a single diagnostic probe. Credentials are always redacted.
+type ProbeResult struct {
+	Name          string
+	Passed        bool
+	Skipped       bool              `json:",omitempty"`
+	ElapsedMillis int64             `json:",omitempty"`
+	Details       map[string]string `json:",omitempty"`
+	StatusCode    int               `json:",omitempty"`
+	Error         string            `json:",omitempty"`
+	Excerpt       string            `json:",omitempty"`
+}
+
+type tlsProber func(u *url.URL) (tls.ConnectionState, error)
+
+// Diagnose runs a series of probes against connector to help debug its setup. Nothing is persisted.
+// Probes run in order: TLS handshake, profile request, signon, then account info. Stops early on failures which prevent later probes from succeeding.
+func Diagnose(connector Connector) DiagnosticReport {
+	client, err := newSimpleClient(connector.URL(), connector.Config())
+	if err != nil {
+		return DiagnosticReport{
+			Probes:      []ProbeResult{{Name: "Client setup", Error: redactCredentials(connector, err.Error())}},
+			Suggestions: []string{"Check the institution's OFX version and app details"},
+		}
+	}
+	return diagnose(connector, dialTLS, client.RequestNoParse, time.Now)
+}
+
+func diagnose(
+	connector Connector,
+	probeTLS tlsProber,
+	requestNoParse func(*ofxgo.Request) (*http.Response, error),
+	now func() time.Time,
+) (report DiagnosticReport) {
+	defer func() {
+		report.Suggestions = suggestions(report.Probes)
+	}()
+
+	tlsResult, ok := runTLSProbe(connector, probeTLS, now)
+	report.Probes = append(report.Probes, tlsResult)
+	if !ok {
+		return report
+	}
+
+	uid, err := ofxgo.RandomUID()
+	if err != nil {
+		report.Probes = append(report.Probes, ProbeResult{Name: ProfileProbe, Error: err.Error()})
+		return report
+	}
+
+	var profileQuery ofxgo.Request
+	profileQuery.Prof = append(profileQuery.Prof, &ofxgo.ProfileRequest{
+		TrnUID:        *uid,
+		ClientRouting: "NONE",
+		DtProfUp:      ofxgo.Date{Time: time.Unix(0, 0).UTC()},
+	})
+	profileResult, _, hardFailure := runOFXProbe(ProfileProbe, connector, &profileQuery, requestNoParse, now)
+	report.Probes = append(report.Probes, profileResult)
+	if hardFailure {
+		return report
+	}
+
+	var signonQuery ofxgo.Request
+	signonResult, _, hardFailure := runOFXProbe(SignonProbe, connector, &signonQuery, requestNoParse, now)
+	report.Probes = append(report.Probes, signonResult)
+	if hardFailure || !signonResult.Passed {
+		// account info requires a successful signon
+		return report
+	}
+
+	var accountQuery ofxgo.Request
+	accountQuery.Signup = append(accountQuery.Signup, &ofxgo.AcctInfoRequest{
+		TrnUID:   *uid,
+		DtAcctUp: ofxgo.Date{Time: connector.Config().AccountInfoSince()},
+	})
+	accountResult, resp, _ := runOFXProbe(AccountInfoProbe, connector, &accountQuery, requestNoParse, now)
+	if accountResult.Passed {
+		accounts, err := countAccounts(resp)
+		if err != nil {
+			accountResult.Passed = false
+			accountResult.Error = err.Error()
+		} else {
+			accountResult.Details = map[string]string{"Accounts": fmt.Sprintf("%d", accounts)}
+		}
+	}
+	report.Probes = append(report.Probes, accountResult)
+	return report
+}
+
+func runTLSProbe(connector Connector, probeTLS tlsProber, now func() time.Time) (ProbeResult, bool) {
+	result := ProbeResult{Name: TLSProbe}
+	u, err := url.Parse(connector.URL())
+	if err != nil {
+		result.Error = errors.Wrap(err, "Institution URL is malformed").Error()
+		return result, false
+	}
+	if u.Scheme != "https" {
+		result.Passed = true
+		result.Skipped = true
+		result.Details = map[string]string{"Reason": "URL does not use HTTPS"}
+		return result, true
+	}
+
+	start := now()
+	state, err := probeTLS(u)
+	result.ElapsedMillis = now().Sub(start).Nanoseconds() / int64(time.Millisecond)
+	if err != nil {
+		result.Error = redactCredentials(connector, tlsVersionError(err).Error())
+		return result, false
+	}
+	result.Passed = true
+	result.Details = map[string]string{
+		"Protocol":         tlsVersionName(state.Version),
+		"Cipher":           tls.CipherSuiteName(state.CipherSuite),
+		"Minimum protocol": tlsVersionName(MinTLSVersion()),
+	}
+	for i, cert := range state.PeerCertificates {
+		result.Details[fmt.Sprintf("Certificate %d", i)] = fmt.Sprintf("%s (expires %s)", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+	}
+	return result, true
+}
+
+// runOFXProbe sends query and records the result. Hard failures indicate the server could not be reached or did not respond with OFX.
+func runOFXProbe(
+	name string,
+	connector Connector,
+	query *ofxgo.Request,
+	requestNoParse func(*ofxgo.Request) (*http.Response, error),
+	now func() time.Time,
+) (result ProbeResult, resp *ofxgo.Response, hardFailure bool) {
+	result.Name = name
+	addSignonRequest(connector, query)
+	start := now()
+	defer func() {
+		result.ElapsedMillis = now().Sub(start).Nanoseconds() / int64(time.Millisecond)
+	}()
+
+	httpResp, err := requestNoParse(query)
+	if err != nil {
+		if code, ok := responseStatusCode(err); ok {
+			result.Details = map[string]string{"HTTP status": fmt.Sprintf("%d", code)}
+		}
+		result.Error = redactCredentials(connector, err.Error())
+		return result, nil, true
+	}
+	defer httpResp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, maxProbeBodySize))
+	if err != nil {
+		result.Error = redactCredentials(connector, err.Error())
+		return result, nil, true
+	}
+	result.Excerpt = excerpt(connector, body)
+	if htmlResponse.Match(body) {
+		result.Error = errHTMLResponse.Error()
+		return result, nil, true
+	}
+
+	resp, err = responseParser(connector.Config())(bytes.NewReader(body))
+	if err != nil {
+		result.Error = redactCredentials(connector, errors.Wrap(err, "Failed to parse OFX response").Error())
+		return result, nil, true
+	}
+	if code := resp.Signon.Status.Code; code != 0 {
+		result.StatusCode = int(code)
+		meaning, _ := resp.Signon.Status.CodeMeaning()
+		result.Error = fmt.Sprintf("Signon status %d: %s %s", code, meaning, resp.Signon.Status.Message)
+		return result, resp, false
+	}
+	result.Passed = true
+	return result, resp, false
+}
+
+func countAccounts(resp *ofxgo.Response) (int, error) {
+	if resp == nil || len(resp.Signup) == 0 {
+		return 0, errors.New("Response did not contain any account info messages")
+	}
+	acctInfoResp, ok := resp.Signup[0].(*ofxgo.AcctInfoResponse)
+	if !ok {
+		return 0, errors.Errorf("Unknown account info response type: %T", resp.Signup[0])
+	}
+	return len(acctInfoResp.AcctInfo), nil
+}
+
+// excerpt returns the beginning of body with credentials removed
+func excerpt(connector Connector, body []byte) string {
+	s := redactCredentials(connector, string(body))
+	if len(s) > probeExcerptLength {
+		s = s[:probeExcerptLength] + "..."
+	}
+	return s
+}
+
+// redactCredentials removes the connector's username and password from s, along with any OFX credential elements
+func redactCredentials(connector Connector, s string) string {
+	s = credentialElements.ReplaceAllString(s, "${1}"+redactedPlaceholder)
+	for _, secret := range []string{string(connector.Password()), connector.Username()} {
+		if secret != "" {
+			s = strings.Replace(s, secret, redactedPlaceholder, -1)
+		}
+	}
+	return s
+}
+
+// suggestions maps known failure signatures to concrete fixes
+func suggestions(probes []ProbeResult) []string {
+	var results []string
+	add := func(format string, args ...interface{}) {
+		results = append(results, fmt.Sprintf(format, args...))
+	}
+	passed := make(map[string]bool)
+	for _, probe := range probes {
+		passed[probe.Name] = probe.Passed
+		if probe.Passed {
+			continue
+		}
+		switch {
+		case probe.Name == TLSProbe && strings.HasPrefix(probe.Error, tlsVersionErrorPrefix):
+			add("Server only supports older TLS versions — contact the institution, or lower the minimum TLS version if your security policy allows it")
+		case probe.Name == TLSProbe && strings.Contains(probe.Error, x509.UnknownAuthorityError{}.Error()):
+			add("TLS certificate is not trusted — verify the institution URL is correct")
+		case probe.Name == TLSProbe:
+			add("TLS handshake failed — verify the institution URL and that the server is reachable")
+		case probe.Error == errHTMLResponse.Error():
+			add("HTML response received — institution likely requires a Quicken User-Agent, or the URL is a web page instead of an OFX server")
+		case probe.Details["HTTP status"] != "":
+			add("HTTP status %s — verify the institution URL, OFX version, and app ID", probe.Details["HTTP status"])
+		case probe.StatusCode == ofxClientUIDError:
+			add("status %d — ClientUID not yet authorized. Approve this client with the institution, often by email or on their website, then try again", probe.StatusCode)
+		case probe.StatusCode == ofxAuthFailed:
+			add("status %d — username or password is incorrect", probe.StatusCode)
+		case probe.StatusCode == ofxPasswordLockout:
+			add("status %d — account is locked out. Contact the institution before trying again", probe.StatusCode)
+		case probe.StatusCode == ofxGeneralError:
+			add("status %d — general error. Verify the ORG and FID values", probe.StatusCode)
+		case probe.Name == ProfileProbe && probe.StatusCode != 0:
+			// many institutions don't support profile requests, which is usually harmless
+		case strings.Contains(probe.Error, "Failed to parse OFX response"):
+			add("Response could not be parsed — try a different OFX version, e.g. 102 or 220")
+		case probe.StatusCode != 0:
+			add("status %d — %s", probe.StatusCode, probe.Error)
+		}
+	}
+	if passed[SignonProbe] && !passed[ProfileProbe] {
+		add("Profile request failed but signon succeeded — the institution likely doesn't support profile requests, which is usually harmless")
+	}
+	for _, probe := range probes {
+		if probe.Name == AccountInfoProbe && probe.Passed && probe.Details["Accounts"] == "0" {
+			add("No accounts returned — direct connect access may need to be enabled on the institution's website")
+		}
+	}
+	return results
+}
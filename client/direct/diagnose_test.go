@@ -0,0 +1,173 @@
+package direct
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ofxResponseBody(t *testing.T, statusCode int, signup ...ofxgo.Message) string {
+	status := ofxgo.Status{Code: ofxgo.Int(statusCode), Severity: ofxgo.String("INFO")}
+	if statusCode != 0 {
+		status.Severity = "ERROR"
+	}
+	resp := ofxgo.Response{
+		Version: ofxgo.OfxVersion102,
+		Signon: ofxgo.SignonResponse{
+			Status:   status,
+			DtServer: ofxgo.Date{Time: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)},
+			Language: "ENG",
+			Org:      "some org",
+			Fid:      "1234",
+		},
+		Signup: signup,
+	}
+	buf, err := resp.Marshal()
+	require.NoError(t, err)
+	return buf.String()
+}
+
+func TestDiagnose(t *testing.T) {
+	now := time.Now()
+	certs := []*x509.Certificate{{Subject: pkix.Name{CommonName: "example.com"}, NotAfter: now}}
+	htmlBody := "<!DOCTYPE html><html><body>Unsupported client</body></html>"
+
+	for _, tc := range []struct {
+		description       string
+		url               string
+		tlsErr            error
+		responses         []string
+		responseErrs      []error
+		expectProbes      []string
+		expectPassed      []bool
+		expectSuggestions []string
+	}{
+		{
+			description:  "all probes pass",
+			url:          "https://example.com",
+			responses:    []string{"profile", "signon", "accounts"},
+			expectProbes: []string{TLSProbe, ProfileProbe, SignonProbe, AccountInfoProbe},
+			expectPassed: []bool{true, true, true, true},
+		},
+		{
+			description:       "TLS failure stops early",
+			url:               "https://example.com",
+			tlsErr:            x509.UnknownAuthorityError{},
+			expectProbes:      []string{TLSProbe},
+			expectPassed:      []bool{false},
+			expectSuggestions: []string{"TLS certificate is not trusted — verify the institution URL is correct"},
+		},
+		{
+			description:       "HTML response stops early",
+			url:               "https://example.com",
+			responses:         []string{htmlBody},
+			expectProbes:      []string{TLSProbe, ProfileProbe},
+			expectPassed:      []bool{true, false},
+			expectSuggestions: []string{"HTML response received — institution likely requires a Quicken User-Agent, or the URL is a web page instead of an OFX server"},
+		},
+		{
+			description:       "HTTP status error",
+			url:               "https://example.com",
+			responseErrs:      []error{errors.New(requestStatusPrefix + "403 Forbidden")},
+			expectProbes:      []string{TLSProbe, ProfileProbe},
+			expectPassed:      []bool{true, false},
+			expectSuggestions: []string{"HTTP status 403 — verify the institution URL, OFX version, and app ID"},
+		},
+		{
+			description:  "unauthorized client UID",
+			url:          "https://example.com",
+			responses:    []string{"profile", "15510"},
+			expectProbes: []string{TLSProbe, ProfileProbe, SignonProbe},
+			expectPassed: []bool{true, true, false},
+			expectSuggestions: []string{
+				"status 15510 — ClientUID not yet authorized. Approve this client with the institution, often by email or on their website, then try again",
+			},
+		},
+		{
+			description:  "profile unsupported",
+			url:          "https://example.com",
+			responses:    []string{"2000", "signon", "accounts"},
+			expectProbes: []string{TLSProbe, ProfileProbe, SignonProbe, AccountInfoProbe},
+			expectPassed: []bool{true, false, true, true},
+			expectSuggestions: []string{
+				"status 2000 — general error. Verify the ORG and FID values",
+				"Profile request failed but signon succeeded — the institution likely doesn't support profile requests, which is usually harmless",
+			},
+		},
+		{
+			description:  "localhost skips TLS",
+			url:          "http://localhost:8000",
+			responses:    []string{"profile", "signon", "accounts"},
+			expectProbes: []string{TLSProbe, ProfileProbe, SignonProbe, AccountInfoProbe},
+			expectPassed: []bool{true, true, true, true},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			connector := New("Some Bank", "1234", "some org", tc.url, "some user", "some password", Config{})
+			probeTLS := func(u *url.URL) (tls.ConnectionState, error) {
+				assert.Equal(t, tc.url, u.String())
+				return tls.ConnectionState{Version: tls.VersionTLS12, PeerCertificates: certs}, tc.tlsErr
+			}
+			requestCount := 0
+			requestNoParse := func(req *ofxgo.Request) (*http.Response, error) {
+				defer func() { requestCount++ }()
+				assert.Equal(t, "some user", string(req.Signon.UserID))
+				if requestCount < len(tc.responseErrs) && tc.responseErrs[requestCount] != nil {
+					return nil, tc.responseErrs[requestCount]
+				}
+				require.True(t, requestCount < len(tc.responses), "Too many requests")
+				var body string
+				switch tc.responses[requestCount] {
+				case "profile", "signon":
+					body = ofxResponseBody(t, 0)
+				case "accounts":
+					body = ofxResponseBody(t, 0, &ofxgo.AcctInfoResponse{
+						TrnUID:   "1",
+						Status:   ofxgo.Status{Code: 0, Severity: "INFO"},
+						DtAcctUp: ofxgo.Date{Time: now},
+						AcctInfo: []ofxgo.AcctInfo{{Desc: "some account"}},
+					})
+				case "2000":
+					body = ofxResponseBody(t, 2000)
+				case "15510":
+					body = ofxResponseBody(t, 15510)
+				default:
+					body = tc.responses[requestCount]
+				}
+				return &http.Response{Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+			}
+
+			report := diagnose(connector, probeTLS, requestNoParse, time.Now)
+			var probes []string
+			var passed []bool
+			for _, probe := range report.Probes {
+				probes = append(probes, probe.Name)
+				passed = append(passed, probe.Passed)
+				assert.NotContains(t, probe.Excerpt, "some password")
+				assert.NotContains(t, probe.Error, "some password")
+			}
+			assert.Equal(t, tc.expectProbes, probes)
+			assert.Equal(t, tc.expectPassed, passed)
+			assert.Equal(t, tc.expectSuggestions, report.Suggestions)
+		})
+	}
+}
+
+func TestRedactCredentials(t *testing.T) {
+	connector := New("Some Bank", "1234", "some org", "https://example.com", "some user", "some password", Config{})
+	assert.Equal(t,
+		"<USERID>****<USERPASS>****</USERPASS> **** said **** is invalid",
+		redactCredentials(connector, "<USERID>jdoe<USERPASS>hunter2</USERPASS> some user said some password is invalid"),
+	)
+}
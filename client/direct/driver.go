@@ -1,6 +1,8 @@
 package direct
 
 import (
+	"strings"
+
 	"github.com/johnstarich/sage/search"
 )
 
@@ -44,6 +46,27 @@ func supportedDriver(d Driver) bool {
 	return false
 }
 
+// FindDriver returns the registered driver with the same FID and URL as 'connector'
+func FindDriver(connector Connector) (Driver, bool) {
+	url := strings.TrimRight(connector.URL(), "/")
+	for _, driver := range directConnectInstitutions {
+		if driver.FID() == connector.FID() && strings.TrimRight(driver.URL(), "/") == url {
+			return driver, true
+		}
+	}
+	return nil, false
+}
+
+// SupportsMessage returns true if 'driver' supports the 'message' message set
+func SupportsMessage(driver Driver, message DriverMessage) bool {
+	for _, support := range driver.MessageSupport() {
+		if support == message {
+			return true
+		}
+	}
+	return false
+}
+
 func Search(query string) []Driver {
 	driverNames := make([]string, 0, len(directConnectInstitutions))
 	drivers := make([]Driver, 0, len(directConnectInstitutions))
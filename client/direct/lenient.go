@@ -0,0 +1,94 @@
+package direct
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/pkg/errors"
+)
+
+const defaultSGMLVersion = "103"
+
+// sgmlHeaders are the OFX 1XX headers in the order they're written
+var sgmlHeaders = []string{
+	"OFXHEADER",
+	"DATA",
+	"VERSION",
+	"SECURITY",
+	"ENCODING",
+	"CHARSET",
+	"COMPRESSION",
+	"OLDFILEUID",
+	"NEWFILEUID",
+}
+
+// responseParser returns the OFX response parser for 'config'. Repairs malformed SGML headers before parsing if LenientParse is set.
+func responseParser(config Config) func(io.Reader) (*ofxgo.Response, error) {
+	if !config.LenientParse {
+		return ofxgo.ParseResponse
+	}
+	return parseLenientResponse
+}
+
+func parseLenientResponse(r io.Reader) (*ofxgo.Response, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read response body")
+	}
+	return ofxgo.ParseResponse(bytes.NewReader(repairSGMLHeaders(data)))
+}
+
+// repairSGMLHeaders rewrites the headers preceding an OFX 1XX SGML document so ofxgo can parse them.
+// Drops any preamble and unrecognized header lines, normalizes newlines, and fills in missing OFXHEADER, DATA, and VERSION headers.
+// XML documents and data without an <OFX> element are returned unchanged.
+func repairSGMLHeaders(data []byte) []byte {
+	ofxStart := bytes.Index(bytes.ToUpper(data), []byte("<OFX>"))
+	if ofxStart < 0 {
+		return data
+	}
+	preamble := string(data[:ofxStart])
+	if strings.Contains(preamble, "<?xml") || strings.Contains(preamble, "OFXHEADER=") {
+		return data
+	}
+
+	preamble = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(preamble)
+	headers := make(map[string]string)
+	for _, line := range strings.Split(preamble, "\n") {
+		tokens := strings.SplitN(line, ":", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		key := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(tokens[0], "\ufeff")))
+		value := strings.TrimSpace(tokens[1])
+		if value != "" && isSGMLHeader(key) {
+			headers[key] = value
+		}
+	}
+	headers["OFXHEADER"] = "100"
+	headers["DATA"] = "OFXSGML"
+	if headers["VERSION"] == "" {
+		headers["VERSION"] = defaultSGMLVersion
+	}
+
+	var buf bytes.Buffer
+	for _, key := range sgmlHeaders {
+		if value, ok := headers[key]; ok {
+			buf.WriteString(key + ":" + value + "\r\n")
+		}
+	}
+	buf.WriteString("\r\n")
+	buf.Write(data[ofxStart:])
+	return buf.Bytes()
+}
+
+func isSGMLHeader(key string) bool {
+	for _, header := range sgmlHeaders {
+		if key == header {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package direct
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lenientTestBody = `<OFX>
+<SIGNONMSGSRSV1>
+<SONRS>
+<STATUS>
+<CODE>0
+<SEVERITY>INFO
+</STATUS>
+<DTSERVER>20200101120000
+<LANGUAGE>ENG
+<FI>
+<ORG>SOMEORG
+<FID>1234
+</FI>
+</SONRS>
+</SIGNONMSGSRSV1>
+</OFX>
+`
+
+func TestLenientParse(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		headers     string
+		version     string
+	}{
+		{
+			description: "missing OFXHEADER",
+			headers:     "DATA:OFXSGML\nVERSION:102\nSECURITY:NONE\nENCODING:USASCII\n\n",
+			version:     "102",
+		},
+		{
+			description: "no headers",
+			headers:     "",
+			version:     "103",
+		},
+		{
+			description: "carriage returns only",
+			headers:     "OFXHEADER:100\rDATA:OFXSGML\rVERSION:103\r\r",
+			version:     "103",
+		},
+		{
+			description: "content type preamble",
+			headers:     "Content-Type: application/x-ofx\r\n\r\nOFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\n\r\n",
+			version:     "102",
+		},
+		{
+			description: "lowercase keys and byte order mark",
+			headers:     "\ufeffofxheader: 100\ndata: OFXSGML\nversion: 103\n\n",
+			version:     "103",
+		},
+		{
+			description: "unknown header",
+			headers:     "OFXHEADER:100\nDATA:OFXSGML\nVERSION:103\nX-SERVER:something\nNEWFILEUID:NONE\n\n",
+			version:     "103",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := responseParser(Config{})(strings.NewReader(tc.headers + lenientTestBody))
+			assert.Error(t, err, "Strict parse should fail")
+
+			resp, err := responseParser(Config{LenientParse: true})(strings.NewReader(tc.headers + lenientTestBody))
+			require.NoError(t, err)
+			assert.Equal(t, tc.version, resp.Version.String())
+			assert.Equal(t, ofxgo.String("SOMEORG"), resp.Signon.Org)
+		})
+	}
+}
+
+func TestRepairSGMLHeadersLeavesXML(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="203" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX></OFX>`
+	assert.Equal(t, xml, string(repairSGMLHeaders([]byte(xml))))
+	assert.Equal(t, "not ofx", string(repairSGMLHeaders([]byte("not ofx"))))
+}
@@ -37,7 +37,11 @@ func newLocalClient(url string, client *ofxgo.BasicClient) (ofxgo.Client, error)
 
 // RawRequest runs a raw request for the given URL and reader against localhost. Errors if the host isn't for localhost OR a password field is included.
 func (l *localClient) RawRequest(url string, r io.Reader) (*http.Response, error) {
-	return l.rawRequest(url, r, http.DefaultClient.Do)
+	client, err := pooledClient(url)
+	if err != nil {
+		return nil, err
+	}
+	return l.rawRequest(url, r, client.Do)
 }
 
 func (l *localClient) rawRequest(url string, r io.Reader, doRequest func(*http.Request) (*http.Response, error)) (*http.Response, error) {
@@ -64,7 +68,7 @@ func (l *localClient) rawRequest(url string, r io.Reader, doRequest func(*http.R
 	}
 
 	if response.StatusCode/100 != 2 {
-		return nil, errors.New("OFXQuery request status: " + response.Status)
+		return nil, errors.New(requestStatusPrefix + response.Status)
 	}
 
 	return response, nil
@@ -0,0 +1,104 @@
+package direct
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// pooledConnsPerHost limits concurrent connections to one institution, and is the number of idle connections kept alive between requests
+	pooledConnsPerHost = 4
+	pooledIdleTimeout  = 90 * time.Second
+	pooledKeepAlive    = 30 * time.Second
+	pooledDialTimeout  = 30 * time.Second
+	pooledTLSTimeout   = 10 * time.Second
+	// pooledRequestTimeout bounds a whole request, including reading the response. Some institutions take minutes to serve long statements.
+	pooledRequestTimeout = 5 * time.Minute
+)
+
+var (
+	clientPoolMu sync.Mutex
+	clientPool   = make(map[string]*http.Client)
+
+	errInsecureRequest = errors.New("Refusing to send OFX request with possible plain-text password over non-https protocol")
+)
+
+// pooledClient returns the shared HTTP client for urlStr's host, so requests to the same institution reuse connections
+func pooledClient(urlStr string) (*http.Client, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid institution URL")
+	}
+	host := strings.ToLower(u.Host)
+	clientPoolMu.Lock()
+	defer clientPoolMu.Unlock()
+	if client, ok := clientPool[host]; ok {
+		return client, nil
+	}
+	client := &http.Client{
+		Timeout:   pooledRequestTimeout,
+		Transport: newPooledTransport(),
+	}
+	clientPool[host] = client
+	return client, nil
+}
+
+// newPooledTransport returns a transport with the same proxy behavior as http.DefaultTransport, tuned to keep a few connections per institution alive.
+// Connections require at least MinTLSVersion.
+func newPooledTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   pooledDialTimeout,
+			KeepAlive: pooledKeepAlive,
+		}).DialContext,
+		MaxIdleConnsPerHost:   pooledConnsPerHost,
+		MaxConnsPerHost:       pooledConnsPerHost,
+		IdleConnTimeout:       pooledIdleTimeout,
+		TLSClientConfig:       newTLSConfig(""),
+		TLSHandshakeTimeout:   pooledTLSTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// CloseConnections closes every pooled connection and empties the pool. Requests afterward open new connections.
+func CloseConnections() {
+	clientPoolMu.Lock()
+	defer clientPoolMu.Unlock()
+	for host, client := range clientPool {
+		client.CloseIdleConnections()
+		delete(clientPool, host)
+	}
+}
+
+// pooledRawRequest POSTs an OFX request to urlStr over the institution's pooled connections. Mirrors ofxgo.BasicClient's RawRequest.
+func pooledRawRequest(urlStr string, r io.Reader) (*http.Response, error) {
+	if !strings.HasPrefix(urlStr, "https://") {
+		return nil, errInsecureRequest
+	}
+	client, err := pooledClient(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	response, err := postOFX(client, urlStr, r)
+	return response, tlsVersionError(err)
+}
+
+func postOFX(client *http.Client, urlStr string, r io.Reader) (*http.Response, error) {
+	response, err := client.Post(urlStr, "application/x-ofx", r)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, errors.New(requestStatusPrefix + response.Status)
+	}
+	return response, nil
+}
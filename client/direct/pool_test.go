@@ -0,0 +1,71 @@
+package direct
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPooledClient(t *testing.T) {
+	defer CloseConnections()
+	client1, err := pooledClient("https://ofx.example.com/path1")
+	require.NoError(t, err)
+	client2, err := pooledClient("https://OFX.example.com/path2")
+	require.NoError(t, err)
+	other, err := pooledClient("https://ofx.other.example.com")
+	require.NoError(t, err)
+	assert.True(t, client1 == client2, "Requests to the same host should share a client")
+	assert.False(t, client1 == other, "Requests to different hosts should not share a client")
+
+	CloseConnections()
+	client3, err := pooledClient("https://ofx.example.com")
+	require.NoError(t, err)
+	assert.False(t, client1 == client3, "Closing connections should empty the pool")
+}
+
+func TestPooledRequestsShareConnections(t *testing.T) {
+	defer CloseConnections()
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("OFXHEADER:100"))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client, err := pooledClient(server.URL)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		resp, err := postOFX(client, server.URL, strings.NewReader("request"))
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "OFXHEADER:100", string(body))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections), "Sequential requests should reuse the same connection")
+
+	_, err = postOFX(client, server.URL+"/fail", strings.NewReader("request"))
+	require.Error(t, err)
+	assert.Equal(t, "OFXQuery request status: 503 Service Unavailable", err.Error())
+}
+
+func TestPooledRawRequestRequiresHTTPS(t *testing.T) {
+	_, err := pooledRawRequest("http://ofx.example.com", strings.NewReader("request"))
+	assert.Equal(t, errInsecureRequest, err)
+}
@@ -0,0 +1,167 @@
+package direct
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	sErrors "github.com/johnstarich/sage/errors"
+	"github.com/pkg/errors"
+)
+
+const (
+	// requestStatusPrefix prefixes ofxgo's error message for non-200 HTTP responses
+	requestStatusPrefix = "OFXQuery request status: "
+
+	maxRetryAttempts      = 10
+	maxRetryBackoffMillis = 60 * 1000
+	// tlsHandshakeTimeoutMessage is http.Transport's unexported TLS handshake timeout error
+	tlsHandshakeTimeoutMessage = "TLS handshake timeout"
+)
+
+// DefaultRetryPolicy is used for institutions without a configured retry policy
+// Requests are not retried by default, since some institutions count each attempt against a rate limit or lock the account after repeated failures.
+// Connections are still retried, since the institution never received the request.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:          1,
+	BackoffMillis:        1000,
+	MaxConnectAttempts:   4,
+	ConnectBackoffMillis: 250,
+	RetryableStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// RetryPolicy controls how failed requests to an institution are retried.
+// Connection failures are retried separately from requests, since the institution never received the request.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per request. Set to 1 to disable retries.
+	MaxAttempts int
+	// BackoffMillis is the delay before the first retry. Doubles on each subsequent retry.
+	BackoffMillis int
+	// RetryableStatusCodes are the HTTP response status codes which trigger a retry
+	RetryableStatusCodes []int
+	// MaxConnectAttempts is the total number of attempts to establish a TCP and TLS connection for each request attempt.
+	// Set to 1 to disable connection retries. 0 uses DefaultRetryPolicy's connection retries.
+	MaxConnectAttempts int `json:",omitempty"`
+	// ConnectBackoffMillis is the delay before the first connection retry. Doubles on each subsequent retry.
+	ConnectBackoffMillis int `json:",omitempty"`
+}
+
+// Validate checks the retry policy for invalid values
+func (r RetryPolicy) Validate() error {
+	var errs sErrors.Errors
+	errs.ErrIf(r.MaxAttempts < 1 || r.MaxAttempts > maxRetryAttempts, "Retry max attempts must be between 1 and %d: %d", maxRetryAttempts, r.MaxAttempts)
+	errs.ErrIf(r.BackoffMillis < 0 || r.BackoffMillis > maxRetryBackoffMillis, "Retry backoff must be between 0 and %d milliseconds: %d", maxRetryBackoffMillis, r.BackoffMillis)
+	for _, code := range r.RetryableStatusCodes {
+		errs.ErrIf(code < 400 || code > 599, "Retryable status codes must be HTTP error codes: %d", code)
+	}
+	errs.ErrIf(r.MaxConnectAttempts < 0 || r.MaxConnectAttempts > maxRetryAttempts, "Connection retry max attempts must be between 0 and %d: %d", maxRetryAttempts, r.MaxConnectAttempts)
+	errs.ErrIf(r.ConnectBackoffMillis < 0 || r.ConnectBackoffMillis > maxRetryBackoffMillis, "Connection retry backoff must be between 0 and %d milliseconds: %d", maxRetryBackoffMillis, r.ConnectBackoffMillis)
+	return errs.ErrOrNil()
+}
+
+// withConnectDefaults returns 'r' with DefaultRetryPolicy's connection retries if unset, i.e. for policies saved before connection retries were configurable
+func (r RetryPolicy) withConnectDefaults() RetryPolicy {
+	if r.MaxConnectAttempts == 0 {
+		r.MaxConnectAttempts = DefaultRetryPolicy.MaxConnectAttempts
+		r.ConnectBackoffMillis = DefaultRetryPolicy.ConnectBackoffMillis
+	}
+	return r
+}
+
+// backoff returns the delay before the retry following 'attempt'
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	return time.Duration(r.BackoffMillis) * time.Millisecond << uint(attempt-1)
+}
+
+// connectBackoff returns the delay before the connection retry following 'attempt'
+func (r RetryPolicy) connectBackoff(attempt int) time.Duration {
+	return time.Duration(r.ConnectBackoffMillis) * time.Millisecond << uint(attempt-1)
+}
+
+func (r RetryPolicy) retryable(err error) bool {
+	code, ok := responseStatusCode(err)
+	if !ok {
+		return false
+	}
+	for _, retryableCode := range r.RetryableStatusCodes {
+		if code == retryableCode {
+			return true
+		}
+	}
+	return false
+}
+
+// responseStatusCode returns the HTTP status code of a failed OFX request, if available
+func responseStatusCode(err error) (int, bool) {
+	message := errors.Cause(err).Error()
+	if !strings.HasPrefix(message, requestStatusPrefix) {
+		return 0, false
+	}
+	status := strings.Fields(strings.TrimPrefix(message, requestStatusPrefix))
+	if len(status) == 0 {
+		return 0, false
+	}
+	code, err := strconv.Atoi(status[0])
+	return code, err == nil
+}
+
+// withRetries wraps doRequest to retry failed requests according to 'policy'
+func withRetries(
+	policy RetryPolicy,
+	doRequest func(*ofxgo.Request) (*ofxgo.Response, error),
+	sleep func(time.Duration),
+) func(*ofxgo.Request) (*ofxgo.Response, error) {
+	return func(req *ofxgo.Request) (*ofxgo.Response, error) {
+		for attempt := 1; ; attempt++ {
+			resp, err := doRequest(req)
+			if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+				return resp, err
+			}
+			sleep(policy.backoff(attempt))
+		}
+	}
+}
+
+// isConnectError returns true if 'err' occurred while establishing a TCP or TLS connection, before any of the request was sent.
+// Certificate and TLS version errors aren't transient, so they aren't connection errors.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if sErrors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return strings.Contains(err.Error(), tlsHandshakeTimeoutMessage)
+}
+
+// withConnectRetries wraps 'post' to retry connection failures according to 'policy', without ever sending a request twice.
+// The request body is buffered, so each attempt can send it in full.
+func withConnectRetries(
+	policy RetryPolicy,
+	post func(io.Reader) (*http.Response, error),
+	sleep func(time.Duration),
+) func(io.Reader) (*http.Response, error) {
+	return func(r io.Reader) (*http.Response, error) {
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		for attempt := 1; ; attempt++ {
+			resp, err := post(bytes.NewReader(body))
+			if err == nil || attempt >= policy.MaxConnectAttempts || !isConnectError(err) {
+				return resp, err
+			}
+			sleep(policy.connectBackoff(attempt))
+		}
+	}
+}
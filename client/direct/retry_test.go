@@ -0,0 +1,269 @@
+package direct
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		policy      RetryPolicy
+		expectErr   string
+	}{
+		{
+			description: "default",
+			policy:      DefaultRetryPolicy,
+		},
+		{
+			description: "no retries",
+			policy:      RetryPolicy{MaxAttempts: 1},
+		},
+		{
+			description: "zero attempts",
+			policy:      RetryPolicy{MaxAttempts: 0},
+			expectErr:   "Retry max attempts must be between 1 and 10: 0",
+		},
+		{
+			description: "negative backoff",
+			policy:      RetryPolicy{MaxAttempts: 2, BackoffMillis: -1},
+			expectErr:   "Retry backoff must be between 0 and 60000 milliseconds: -1",
+		},
+		{
+			description: "non-error status code",
+			policy:      RetryPolicy{MaxAttempts: 2, RetryableStatusCodes: []int{200}},
+			expectErr:   "Retryable status codes must be HTTP error codes: 200",
+		},
+		{
+			description: "too many connection attempts",
+			policy:      RetryPolicy{MaxAttempts: 1, MaxConnectAttempts: 11},
+			expectErr:   "Connection retry max attempts must be between 0 and 10: 11",
+		},
+		{
+			description: "negative connection backoff",
+			policy:      RetryPolicy{MaxAttempts: 1, MaxConnectAttempts: 2, ConnectBackoffMillis: -1},
+			expectErr:   "Connection retry backoff must be between 0 and 60000 milliseconds: -1",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.policy.Validate()
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectErr, err.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConfigRetryPolicy(t *testing.T) {
+	assert.Equal(t, DefaultRetryPolicy, Config{}.RetryPolicy())
+	noRetries := RetryPolicy{MaxAttempts: 1}
+	assert.Equal(t, noRetries, Config{Retry: &noRetries}.RetryPolicy())
+}
+
+func TestRetryPolicyWithConnectDefaults(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 1}.withConnectDefaults()
+	assert.Equal(t, DefaultRetryPolicy.MaxConnectAttempts, policy.MaxConnectAttempts, "Policies saved before connection retries should use the defaults")
+	assert.Equal(t, DefaultRetryPolicy.ConnectBackoffMillis, policy.ConnectBackoffMillis)
+	assert.Equal(t, 1, policy.MaxAttempts)
+
+	noConnectRetries := RetryPolicy{MaxAttempts: 3, MaxConnectAttempts: 1}
+	assert.Equal(t, noConnectRetries, noConnectRetries.withConnectDefaults())
+}
+
+func TestResponseStatusCode(t *testing.T) {
+	code, ok := responseStatusCode(errors.Wrap(errors.New(requestStatusPrefix+"503 Service Unavailable"), "Error sending request"))
+	assert.True(t, ok)
+	assert.Equal(t, 503, code)
+
+	_, ok = responseStatusCode(errors.New("connection refused"))
+	assert.False(t, ok)
+}
+
+func TestWithRetries(t *testing.T) {
+	unavailable := errors.New(requestStatusPrefix + "503 Service Unavailable")
+	for _, tc := range []struct {
+		description    string
+		policy         RetryPolicy
+		errs           []error
+		expectAttempts int
+		expectSleeps   []time.Duration
+		expectErr      bool
+	}{
+		{
+			description:    "success",
+			policy:         DefaultRetryPolicy,
+			errs:           []error{nil},
+			expectAttempts: 1,
+		},
+		{
+			description:    "default does not retry",
+			policy:         DefaultRetryPolicy,
+			errs:           []error{unavailable, nil},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+		{
+			description:    "retry then succeed",
+			policy:         RetryPolicy{MaxAttempts: 3, BackoffMillis: 1000, RetryableStatusCodes: []int{503}},
+			errs:           []error{unavailable, unavailable, nil},
+			expectAttempts: 3,
+			expectSleeps:   []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			description:    "exhaust attempts",
+			policy:         RetryPolicy{MaxAttempts: 2, BackoffMillis: 10, RetryableStatusCodes: []int{503}},
+			errs:           []error{unavailable, unavailable, nil},
+			expectAttempts: 2,
+			expectSleeps:   []time.Duration{10 * time.Millisecond},
+			expectErr:      true,
+		},
+		{
+			description:    "no retries",
+			policy:         RetryPolicy{MaxAttempts: 1, RetryableStatusCodes: []int{503}},
+			errs:           []error{unavailable, nil},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+		{
+			description:    "non-retryable status",
+			policy:         RetryPolicy{MaxAttempts: 3, RetryableStatusCodes: []int{500}},
+			errs:           []error{unavailable, nil},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+		{
+			description:    "non-status error",
+			policy:         DefaultRetryPolicy,
+			errs:           []error{errors.New("some error"), nil},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			attempts := 0
+			doRequest := func(*ofxgo.Request) (*ofxgo.Response, error) {
+				err := tc.errs[attempts]
+				attempts++
+				if err != nil {
+					return nil, err
+				}
+				return &ofxgo.Response{}, nil
+			}
+			var sleeps []time.Duration
+			sleep := func(d time.Duration) {
+				sleeps = append(sleeps, d)
+			}
+
+			resp, err := withRetries(tc.policy, doRequest, sleep)(&ofxgo.Request{})
+			assert.Equal(t, tc.expectAttempts, attempts)
+			assert.Equal(t, tc.expectSleeps, sleeps)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, resp)
+		})
+	}
+}
+
+func TestWithConnectRetries(t *testing.T) {
+	dialErr := &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	handshakeErr := &url.Error{Op: "Post", URL: "https://example.com", Err: errors.New("net/http: TLS handshake timeout")}
+	resetErr := &url.Error{Op: "Post", URL: "https://example.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}
+	policy := RetryPolicy{MaxAttempts: 1, MaxConnectAttempts: 3, ConnectBackoffMillis: 10}
+	for _, tc := range []struct {
+		description    string
+		policy         RetryPolicy
+		errs           []error
+		expectAttempts int
+		expectSleeps   []time.Duration
+		expectErr      bool
+	}{
+		{
+			description:    "success",
+			policy:         policy,
+			errs:           []error{nil},
+			expectAttempts: 1,
+		},
+		{
+			description:    "dial failures then succeed",
+			policy:         policy,
+			errs:           []error{dialErr, handshakeErr, nil},
+			expectAttempts: 3,
+			expectSleeps:   []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		},
+		{
+			description:    "exhaust attempts",
+			policy:         policy,
+			errs:           []error{dialErr, dialErr, dialErr, nil},
+			expectAttempts: 3,
+			expectSleeps:   []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+			expectErr:      true,
+		},
+		{
+			description:    "request may have been sent",
+			policy:         policy,
+			errs:           []error{resetErr, nil},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+		{
+			description:    "status errors are for request retries",
+			policy:         policy,
+			errs:           []error{errors.New(requestStatusPrefix + "503 Service Unavailable"), nil},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+		{
+			description:    "no connection retries",
+			policy:         RetryPolicy{MaxAttempts: 3, MaxConnectAttempts: 1},
+			errs:           []error{dialErr, nil},
+			expectAttempts: 1,
+			expectErr:      true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			attempts := 0
+			post := func(r io.Reader) (*http.Response, error) {
+				body, err := ioutil.ReadAll(r)
+				require.NoError(t, err)
+				assert.Equal(t, "some request", string(body), "Every attempt should send the whole request")
+				err = tc.errs[attempts]
+				attempts++
+				if err != nil {
+					return nil, err
+				}
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}
+			var sleeps []time.Duration
+			sleep := func(d time.Duration) {
+				sleeps = append(sleeps, d)
+			}
+
+			resp, err := withConnectRetries(tc.policy, post, sleep)(strings.NewReader("some request"))
+			assert.Equal(t, tc.expectAttempts, attempts)
+			assert.Equal(t, tc.expectSleeps, sleeps)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, resp)
+		})
+	}
+}
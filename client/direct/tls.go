@@ -0,0 +1,125 @@
+package direct
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMinTLSVersion is the oldest TLS version OFX connections accept when not configured
+const DefaultMinTLSVersion = tls.VersionTLS12
+
+const tlsVersionErrorPrefix = "Institution's server doesn't support the minimum TLS version"
+
+var (
+	tlsMu         sync.Mutex
+	minTLSVersion uint16 = DefaultMinTLSVersion
+	// tlsVerifiedHosts are hosts known to support minTLSVersion, for clients whose transports can't be configured
+	tlsVerifiedHosts = make(map[string]bool)
+
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// ParseTLSVersion parses a TLS version number, like "1.2"
+func ParseTLSVersion(version string) (uint16, error) {
+	tlsVersion, ok := tlsVersions[strings.TrimPrefix(strings.TrimSpace(version), "TLS ")]
+	if !ok {
+		return 0, errors.Errorf("Invalid TLS version, must be one of 1.0, 1.1, 1.2, or 1.3: %q", version)
+	}
+	return tlsVersion, nil
+}
+
+// SetMinTLSVersion sets the oldest TLS version OFX connections accept. Closes pooled connections, so every new request uses it.
+func SetMinTLSVersion(version uint16) {
+	tlsMu.Lock()
+	minTLSVersion = version
+	tlsVerifiedHosts = make(map[string]bool)
+	tlsMu.Unlock()
+	CloseConnections()
+}
+
+// MinTLSVersion returns the oldest TLS version OFX connections accept
+func MinTLSVersion() uint16 {
+	tlsMu.Lock()
+	defer tlsMu.Unlock()
+	return minTLSVersion
+}
+
+func newTLSConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		ServerName: serverName,
+		MinVersion: MinTLSVersion(),
+	}
+}
+
+// tlsVersionError explains err if the handshake failed because the server doesn't support the minimum TLS version
+func tlsVersionError(err error) error {
+	if err == nil || !strings.Contains(err.Error(), "protocol version") {
+		return err
+	}
+	return errors.Wrapf(err, "%s (%s)", tlsVersionErrorPrefix, tlsVersionName(MinTLSVersion()))
+}
+
+// requireMinTLS checks urlStr's host supports the minimum TLS version, for clients whose transports can't be configured.
+// Skips hosts which already passed and non-https URLs.
+func requireMinTLS(urlStr string) error {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return errors.Wrap(err, "Invalid institution URL")
+	}
+	if u.Scheme != "https" {
+		return nil
+	}
+	host := strings.ToLower(u.Host)
+	tlsMu.Lock()
+	verified := tlsVerifiedHosts[host]
+	tlsMu.Unlock()
+	if verified {
+		return nil
+	}
+	if _, err := dialTLS(u); err != nil {
+		return tlsVersionError(err)
+	}
+	tlsMu.Lock()
+	tlsVerifiedHosts[host] = true
+	tlsMu.Unlock()
+	return nil
+}
+
+func dialTLS(u *url.URL) (tls.ConnectionState, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: tlsProbeTimeout}, "tcp", host, newTLSConfig(u.Hostname()))
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("Unknown (0x%04x)", version)
+	}
+}
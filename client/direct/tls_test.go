@@ -0,0 +1,67 @@
+package direct
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version   string
+		expect    uint16
+		expectErr bool
+	}{
+		{version: "1.0", expect: tls.VersionTLS10},
+		{version: "1.2", expect: tls.VersionTLS12},
+		{version: " TLS 1.3 ", expect: tls.VersionTLS13},
+		{version: "1.4", expectErr: true},
+		{version: "", expectErr: true},
+	} {
+		t.Run(tc.version, func(t *testing.T) {
+			version, err := ParseTLSVersion(tc.version)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, version)
+		})
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	defer SetMinTLSVersion(DefaultMinTLSVersion)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OFXHEADER:100"))
+	}))
+	server.TLS = &tls.Config{
+		MinVersion: tls.VersionTLS10,
+		MaxVersion: tls.VersionTLS11,
+	}
+	server.StartTLS()
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint16(DefaultMinTLSVersion), MinTLSVersion())
+	_, err = pooledRawRequest(server.URL, strings.NewReader("request"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Institution's server doesn't support the minimum TLS version (TLS 1.2)")
+
+	err = requireMinTLS(server.URL)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Institution's server doesn't support the minimum TLS version (TLS 1.2)")
+
+	SetMinTLSVersion(tls.VersionTLS10)
+	_, err = dialTLS(u)
+	require.Error(t, err)
+	assert.NotContains(t, tlsVersionError(err).Error(), "minimum TLS version", "Older versions should negotiate, failing on the untrusted test certificate instead")
+	assert.NoError(t, requireMinTLS("http://localhost:8000"), "Plain HTTP URLs are not checked")
+}
@@ -0,0 +1,294 @@
+package direct
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/aclindsa/xml"
+	"github.com/johnstarich/sage/client/model"
+	sErrors "github.com/johnstarich/sage/errors"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const bankResponseSet = "BANKMSGSRSV1"
+
+// transferLeafElements are the transfer elements without closing tags in OFX 1XX SGML. ofxgo doesn't support intra-bank transfers, so they're encoded here instead.
+var transferLeafElements = []string{
+	"TRNUID", "CODE", "SEVERITY", "MESSAGE",
+	"CURDEF", "SRVRTID",
+	"BANKID", "BRANCHID", "ACCTID", "ACCTTYPE", "ACCTKEY", "TRNAMT",
+	"DTXFERPRJ", "DTPOSTED", "XFERPRCCODE", "DTXFERPRC",
+}
+
+// TransferConfirmation is an institution's confirmation of an intra-bank transfer
+type TransferConfirmation struct {
+	// ServerID is the institution's ID for the transfer
+	ServerID string
+	Currency string `json:",omitempty"`
+	Amount   decimal.Decimal
+	// Projected is when the transfer is expected to post, if it hasn't posted yet
+	Projected *time.Time `json:",omitempty"`
+	Posted    *time.Time `json:",omitempty"`
+	// Status is the transfer's latest processing status, like WILLPROCESSON or POSTEDON
+	Status string `json:",omitempty"`
+}
+
+type xferInfo struct {
+	BankAcctFrom ofxgo.BankAcct  `xml:"BANKACCTFROM"`
+	BankAcctTo   *ofxgo.BankAcct `xml:"BANKACCTTO,omitempty"`
+	CCAcctTo     *ofxgo.CCAcct   `xml:"CCACCTTO,omitempty"`
+	TrnAmt       ofxgo.Amount    `xml:"TRNAMT"`
+}
+
+type intraTransferRequest struct {
+	XMLName  xml.Name  `xml:"INTRATRNRQ"`
+	TrnUID   ofxgo.UID `xml:"TRNUID"`
+	XferInfo xferInfo  `xml:"INTRARQ>XFERINFO"`
+}
+
+type intraTransferResponse struct {
+	TrnUID ofxgo.UID    `xml:"TRNUID"`
+	Status ofxgo.Status `xml:"STATUS"`
+	Intra  *struct {
+		CurDef     ofxgo.String `xml:"CURDEF"`
+		SrvrTID    ofxgo.String `xml:"SRVRTID"`
+		XferInfo   xferInfo     `xml:"XFERINFO"`
+		DtXferPrj  *ofxgo.Date  `xml:"DTXFERPRJ,omitempty"`
+		DtPosted   *ofxgo.Date  `xml:"DTPOSTED,omitempty"`
+		XferPrcSts *struct {
+			XferPrcCode ofxgo.String `xml:"XFERPRCCODE"`
+		} `xml:"XFERPRCSTS,omitempty"`
+	} `xml:"INTRARS,omitempty"`
+}
+
+// transfersEnabled returns true if account opted in to transfers
+func transfersEnabled(account model.Account) bool {
+	transferrer, ok := account.(Transferrer)
+	return ok && transferrer.TransfersEnabled()
+}
+
+// sameLogin returns true if both connectors sign in to the same institution with the same user
+func sameLogin(a, b Connector) bool {
+	return strings.TrimRight(a.URL(), "/") == strings.TrimRight(b.URL(), "/") &&
+		a.FID() == b.FID() &&
+		a.Org() == b.Org() &&
+		a.Username() == b.Username()
+}
+
+// ValidateTransfer checks a transfer of 'amount' from bank account 'from' to bank or credit card account 'to' before it's sent.
+// Both accounts must have transfers enabled, be open, and share the same institution login.
+func ValidateTransfer(from, to model.Account, amount decimal.Decimal) error {
+	var errs sErrors.Errors
+	errs.ErrIf(amount.Sign() <= 0, "Transfer amount must be positive: %s", amount)
+	errs.ErrIf(!amount.Equal(amount.Round(2)), "Transfer amount must not have more than 2 decimal places: %s", amount)
+	if errs.ErrIf(from == nil || to == nil, "Transfer source and destination accounts must not be empty") {
+		return errs.ErrOrNil()
+	}
+	errs.ErrIf(from.ID() == to.ID(), "Transfer source and destination accounts must be different: %q", from.ID())
+	for _, account := range []model.Account{from, to} {
+		errs.ErrIf(!transfersEnabled(account), "Transfers are not enabled for account %q", account.ID())
+		if closer, ok := account.(model.Closer); ok {
+			errs.ErrIf(closer.ClosedDate() != nil, "Account is closed: %q", account.ID())
+		}
+	}
+
+	_, isBank := from.(Bank)
+	errs.ErrIf(!isBank, "Transfer source must be a bank account: %q", from.ID())
+	_, toBank := to.(Bank)
+	_, toCreditCard := to.(*CreditCard)
+	errs.ErrIf(!toBank && !toCreditCard, "Transfer destination must be a bank or credit card account: %q", to.ID())
+	fromConnector, fromOK := from.Institution().(Connector)
+	toConnector, toOK := to.Institution().(Connector)
+	if !errs.ErrIf(!fromOK || !toOK, "Transfer accounts must both be direct connect accounts") {
+		errs.ErrIf(!sameLogin(fromConnector, toConnector), "Transfer accounts must share the same institution login")
+	}
+	return errs.ErrOrNil()
+}
+
+// Transfer sends an intra-bank transfer of 'amount' from bank account 'from' to bank or credit card account 'to', then returns the institution's confirmation.
+// The request is never retried, since a retry could move the money twice.
+func Transfer(from, to Account, amount decimal.Decimal) (*TransferConfirmation, error) {
+	if err := ValidateTransfer(from, to, amount); err != nil {
+		return nil, err
+	}
+	connector := from.Institution().(Connector)
+	client, err := newSimpleClient(connector.URL(), connector.Config())
+	if err != nil {
+		return nil, err
+	}
+	marshaler, ok := client.(requestMarshaler)
+	if !ok {
+		return nil, errors.Errorf("Transfers are not supported by client: %T", client)
+	}
+	uid, err := ofxgo.RandomUID()
+	if err != nil {
+		return nil, err
+	}
+	return transfer(connector, from.(Bank), to, amount, *uid, marshaler.MarshalRequest, client.RawRequest, responseParser(connector.Config()))
+}
+
+func transfer(
+	connector Connector,
+	from Bank, to model.Account,
+	amount decimal.Decimal,
+	uid ofxgo.UID,
+	marshal func(*ofxgo.Request) (io.Reader, error),
+	doPost func(string, io.Reader) (*http.Response, error),
+	parse func(io.Reader) (*ofxgo.Response, error),
+) (*TransferConfirmation, error) {
+	var query ofxgo.Request
+	addSignonRequest(connector, &query)
+	r, err := marshal(&query)
+	if err != nil {
+		return nil, err
+	}
+	request, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	transferRequest, err := marshalTransferRequest(from, to, amount, uid, query.Version < ofxgo.OfxVersion200)
+	if err != nil {
+		return nil, err
+	}
+	end := bytes.LastIndex(bytes.ToUpper(request), []byte("</OFX>"))
+	if end < 0 {
+		return nil, errors.New("Failed to add transfer to request: no closing OFX element")
+	}
+	request = append(request[:end:end], append(transferRequest, request[end:]...)...)
+
+	response, err := doPost(connector.URL(), bytes.NewReader(request))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error sending transfer request")
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read response body")
+	}
+	return parseTransferResponse(data, uid, parse)
+}
+
+// marshalTransferRequest encodes an intra-bank transfer's bank message set, leaving off leaf closing tags for OFX 1XX SGML
+func marshalTransferRequest(from Bank, to model.Account, amount decimal.Decimal, uid ofxgo.UID, sgml bool) ([]byte, error) {
+	fromType, err := ofxgo.NewAcctType(from.AcctType())
+	if err != nil {
+		return nil, err
+	}
+	var trnAmt ofxgo.Amount
+	if _, ok := trnAmt.SetString(amount.StringFixed(2)); !ok {
+		return nil, errors.Errorf("Invalid transfer amount: %s", amount)
+	}
+	info := xferInfo{
+		BankAcctFrom: ofxgo.BankAcct{
+			BankID:   ofxgo.String(from.BankID()),
+			AcctID:   ofxgo.String(from.ID()),
+			AcctType: fromType,
+		},
+		TrnAmt: trnAmt,
+	}
+	switch to := to.(type) {
+	case Bank:
+		toType, err := ofxgo.NewAcctType(to.AcctType())
+		if err != nil {
+			return nil, err
+		}
+		info.BankAcctTo = &ofxgo.BankAcct{
+			BankID:   ofxgo.String(to.BankID()),
+			AcctID:   ofxgo.String(to.ID()),
+			AcctType: toType,
+		}
+	default:
+		info.CCAcctTo = &ofxgo.CCAcct{AcctID: ofxgo.String(to.ID())}
+	}
+
+	var b bytes.Buffer
+	encoder := xml.NewEncoder(&b)
+	if sgml {
+		encoder.SetDisableAutoClose(transferLeafElements...)
+	}
+	messageSet := struct {
+		XMLName xml.Name `xml:"BANKMSGSRQV1"`
+		Request intraTransferRequest
+	}{Request: intraTransferRequest{TrnUID: uid, XferInfo: info}}
+	if err := encoder.Encode(&messageSet); err != nil {
+		return nil, errors.Wrap(err, "Failed to marshal transfer request")
+	}
+	return b.Bytes(), nil
+}
+
+// parseTransferResponse checks the response's signon status, then returns the confirmation for transfer 'uid'.
+// The bank message set is removed before parsing the rest with 'parse', since ofxgo can't parse transfer responses.
+func parseTransferResponse(data []byte, uid ofxgo.UID, parse func(io.Reader) (*ofxgo.Response, error)) (*TransferConfirmation, error) {
+	upper := bytes.ToUpper(data)
+	endTag := []byte("</" + bankResponseSet + ">")
+	start := bytes.Index(upper, []byte("<"+bankResponseSet+">"))
+	end := bytes.Index(upper, endTag)
+	signonData := data
+	var transferData []byte
+	if start >= 0 && end > start {
+		end += len(endTag)
+		transferData = data[start:end]
+		signonData = append(append([]byte(nil), data[:start]...), data[end:]...)
+	}
+
+	signonResponse, err := parse(bytes.NewReader(signonData))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing response body")
+	}
+	if err := signonError(signonResponse); err != nil {
+		return nil, err
+	}
+	if transferData == nil {
+		return nil, errors.New("Response did not contain a transfer response")
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(transferData))
+	if signonResponse.Version < ofxgo.OfxVersion200 {
+		decoder.Strict = false
+		decoder.AutoCloseAfterCharData = transferLeafElements
+	}
+	var messageSet struct {
+		Responses []intraTransferResponse `xml:"INTRATRNRS"`
+	}
+	if err := decoder.Decode(&messageSet); err != nil {
+		return nil, errors.Wrap(err, "Error parsing transfer response")
+	}
+	for _, response := range messageSet.Responses {
+		if response.TrnUID != uid {
+			continue
+		}
+		if response.Status.Code != 0 {
+			meaning, _ := response.Status.CodeMeaning()
+			return nil, errors.Errorf("Transfer failed (%d: %s) with message: %s", response.Status.Code, meaning, response.Status.Message)
+		}
+		if response.Intra == nil {
+			return nil, errors.New("Transfer response did not contain a confirmation")
+		}
+		amount, err := decimal.NewFromString(response.Intra.XferInfo.TrnAmt.String())
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid transfer response amount")
+		}
+		confirmation := &TransferConfirmation{
+			ServerID: string(response.Intra.SrvrTID),
+			Currency: string(response.Intra.CurDef),
+			Amount:   amount,
+		}
+		if response.Intra.DtXferPrj != nil {
+			confirmation.Projected = &response.Intra.DtXferPrj.Time
+		}
+		if response.Intra.DtPosted != nil {
+			confirmation.Posted = &response.Intra.DtPosted.Time
+		}
+		if response.Intra.XferPrcSts != nil {
+			confirmation.Status = string(response.Intra.XferPrcSts.XferPrcCode)
+		}
+		return confirmation, nil
+	}
+	return nil, errors.Errorf("Response did not contain a transfer response for request %q", uid)
+}
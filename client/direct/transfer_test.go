@@ -0,0 +1,308 @@
+package direct
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transferTestAccounts() (checking, savings *bankAccount, creditCard *CreditCard) {
+	connector := &directConnect{
+		BasicInstitution:  model.BasicInstitution{InstFID: "1234", InstOrg: "some org"},
+		ConnectorURL:      "https://bank.example/ofx",
+		ConnectorUsername: "some username",
+		ConnectorPassword: "some password",
+	}
+	checking = NewCheckingAccount("1111", "111", "checking", connector).(*bankAccount)
+	checking.AllowTransfers = true
+	savings = NewSavingsAccount("2222", "111", "savings", connector).(*bankAccount)
+	savings.AllowTransfers = true
+	creditCard = NewCreditCard("3333", "credit card", connector).(*CreditCard)
+	creditCard.AllowTransfers = true
+	return
+}
+
+func TestValidateTransfer(t *testing.T) {
+	closed := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		description string
+		amount      string
+		setup       func(checking, savings *bankAccount, creditCard *CreditCard) (from, to model.Account)
+		expectErr   string
+	}{
+		{
+			description: "checking to savings",
+			amount:      "12.50",
+		},
+		{
+			description: "savings to credit card",
+			amount:      "1",
+			setup: func(checking, savings *bankAccount, creditCard *CreditCard) (model.Account, model.Account) {
+				return savings, creditCard
+			},
+		},
+		{
+			description: "zero amount",
+			amount:      "0",
+			expectErr:   "Transfer amount must be positive: 0",
+		},
+		{
+			description: "negative amount",
+			amount:      "-5",
+			expectErr:   "Transfer amount must be positive: -5",
+		},
+		{
+			description: "fractional cents",
+			amount:      "1.005",
+			expectErr:   "Transfer amount must not have more than 2 decimal places: 1.005",
+		},
+		{
+			description: "same account",
+			amount:      "1",
+			setup: func(checking, savings *bankAccount, creditCard *CreditCard) (model.Account, model.Account) {
+				return checking, checking
+			},
+			expectErr: `Transfer source and destination accounts must be different: "1111"`,
+		},
+		{
+			description: "transfers disabled by default",
+			amount:      "1",
+			setup: func(checking, savings *bankAccount, creditCard *CreditCard) (model.Account, model.Account) {
+				savings.AllowTransfers = false
+				return checking, savings
+			},
+			expectErr: `Transfers are not enabled for account "2222"`,
+		},
+		{
+			description: "closed account",
+			amount:      "1",
+			setup: func(checking, savings *bankAccount, creditCard *CreditCard) (model.Account, model.Account) {
+				checking.Closed = &closed
+				return checking, savings
+			},
+			expectErr: `Account is closed: "1111"`,
+		},
+		{
+			description: "credit card source",
+			amount:      "1",
+			setup: func(checking, savings *bankAccount, creditCard *CreditCard) (model.Account, model.Account) {
+				return creditCard, checking
+			},
+			expectErr: `Transfer source must be a bank account: "3333"`,
+		},
+		{
+			description: "different logins",
+			amount:      "1",
+			setup: func(checking, savings *bankAccount, creditCard *CreditCard) (model.Account, model.Account) {
+				other := *savings.DirectConnect.(*directConnect)
+				other.ConnectorUsername = "someone else"
+				savings.DirectConnect = &other
+				return checking, savings
+			},
+			expectErr: "Transfer accounts must share the same institution login",
+		},
+		{
+			description: "missing account",
+			amount:      "1",
+			setup: func(checking, savings *bankAccount, creditCard *CreditCard) (model.Account, model.Account) {
+				return checking, nil
+			},
+			expectErr: "Transfer source and destination accounts must not be empty",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			checking, savings, creditCard := transferTestAccounts()
+			var from, to model.Account = checking, savings
+			if tc.setup != nil {
+				from, to = tc.setup(checking, savings, creditCard)
+			}
+			err := ValidateTransfer(from, to, decimal.RequireFromString(tc.amount))
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+const (
+	sgmlTransferResponseHeader = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+COMPRESSION:NONE
+OLDFILEUID:NONE
+NEWFILEUID:NONE
+
+`
+	xmlTransferResponseHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="203" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+)
+
+func sgmlTransferResponse(signonCode int, bankMessages string) string {
+	return sgmlTransferResponseHeader + fmt.Sprintf(`<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>%d<SEVERITY>%s</STATUS><DTSERVER>20200102120000<LANGUAGE>ENG</SONRS></SIGNONMSGSRSV1>
+%s
+</OFX>
+`, signonCode, map[bool]string{true: "INFO", false: "ERROR"}[signonCode == 0], bankMessages)
+}
+
+func TestTransfer(t *testing.T) {
+	const uid = ofxgo.UID("some-uid")
+	projected := time.Date(2020, 1, 3, 12, 0, 0, 0, time.UTC)
+	posted := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	someErr := errors.New("some error")
+	for _, tc := range []struct {
+		description   string
+		version       string
+		toCreditCard  bool
+		response      string
+		postErr       error
+		expectRequest []string
+		expectConfirm *TransferConfirmation
+		expectErr     string
+	}{
+		{
+			description: "SGML checking to savings",
+			version:     "102",
+			response: sgmlTransferResponse(0, `<BANKMSGSRSV1><INTRATRNRS><TRNUID>some-uid<STATUS><CODE>0<SEVERITY>INFO</STATUS>
+<INTRARS><CURDEF>USD<SRVRTID>T123
+<XFERINFO><BANKACCTFROM><BANKID>111<ACCTID>1111<ACCTTYPE>CHECKING</BANKACCTFROM><BANKACCTTO><BANKID>111<ACCTID>2222<ACCTTYPE>SAVINGS</BANKACCTTO><TRNAMT>12.50</XFERINFO>
+<DTXFERPRJ>20200103120000<XFERPRCSTS><XFERPRCCODE>WILLPROCESSON<DTXFERPRC>20200103120000</XFERPRCSTS>
+</INTRARS></INTRATRNRS></BANKMSGSRSV1>`),
+			expectRequest: []string{
+				"<BANKMSGSRQV1><INTRATRNRQ><TRNUID>some-uid<INTRARQ><XFERINFO>",
+				"<BANKACCTFROM><BANKID>111<ACCTID>1111<ACCTTYPE>CHECKING</BANKACCTFROM>",
+				"<BANKACCTTO><BANKID>111<ACCTID>2222<ACCTTYPE>SAVINGS</BANKACCTTO>",
+				"<TRNAMT>12.5</XFERINFO></INTRARQ></INTRATRNRQ></BANKMSGSRQV1></OFX>",
+			},
+			expectConfirm: &TransferConfirmation{
+				ServerID:  "T123",
+				Currency:  "USD",
+				Amount:    decimal.RequireFromString("12.5"),
+				Projected: &projected,
+				Status:    "WILLPROCESSON",
+			},
+		},
+		{
+			description:  "XML savings to credit card",
+			version:      "203",
+			toCreditCard: true,
+			response: xmlTransferResponseHeader + `<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS><DTSERVER>20200102120000</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><INTRATRNRS><TRNUID>some-uid</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<INTRARS><CURDEF>USD</CURDEF><SRVRTID>T456</SRVRTID>
+<XFERINFO><BANKACCTFROM><BANKID>111</BANKID><ACCTID>1111</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM><CCACCTTO><ACCTID>3333</ACCTID></CCACCTTO><TRNAMT>12.50</TRNAMT></XFERINFO>
+<DTPOSTED>20200102120000</DTPOSTED>
+</INTRARS></INTRATRNRS></BANKMSGSRSV1>
+</OFX>
+`,
+			expectRequest: []string{
+				"<CCACCTTO><ACCTID>3333</ACCTID></CCACCTTO><TRNAMT>12.5</TRNAMT>",
+			},
+			expectConfirm: &TransferConfirmation{
+				ServerID: "T456",
+				Currency: "USD",
+				Amount:   decimal.RequireFromString("12.5"),
+				Posted:   &posted,
+			},
+		},
+		{
+			description: "request error",
+			version:     "102",
+			postErr:     someErr,
+			expectErr:   "Error sending transfer request: some error",
+		},
+		{
+			description: "auth failed",
+			version:     "102",
+			response:    sgmlTransferResponse(ofxAuthFailed, ""),
+			expectErr:   ErrAuthFailed.Error(),
+		},
+		{
+			description: "transfer failed",
+			version:     "102",
+			response: sgmlTransferResponse(0, `<BANKMSGSRSV1><INTRATRNRS><TRNUID>some-uid<STATUS><CODE>2000<SEVERITY>ERROR<MESSAGE>Insufficient funds</STATUS>
+</INTRATRNRS></BANKMSGSRSV1>`),
+			expectErr: "Transfer failed (2000: General error) with message: Insufficient funds",
+		},
+		{
+			description: "missing transfer response",
+			version:     "102",
+			response:    sgmlTransferResponse(0, ""),
+			expectErr:   "Response did not contain a transfer response",
+		},
+		{
+			description: "different transfer response",
+			version:     "102",
+			response: sgmlTransferResponse(0, `<BANKMSGSRSV1><INTRATRNRS><TRNUID>other-uid<STATUS><CODE>0<SEVERITY>INFO</STATUS>
+</INTRATRNRS></BANKMSGSRSV1>`),
+			expectErr: `Response did not contain a transfer response for request "some-uid"`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			checking, savings, creditCard := transferTestAccounts()
+			var to model.Account = savings
+			if tc.toCreditCard {
+				to = creditCard
+			}
+			version, err := ofxgo.NewOfxVersion(tc.version)
+			require.NoError(t, err)
+			marshal := func(req *ofxgo.Request) (io.Reader, error) {
+				req.SetClientFields(&ofxgo.BasicClient{AppID: "QWIN", AppVer: "2500", SpecVersion: version})
+				return req.Marshal()
+			}
+			posts := 0
+			doPost := func(url string, r io.Reader) (*http.Response, error) {
+				posts++
+				assert.Equal(t, "https://bank.example/ofx", url)
+				request, err := ioutil.ReadAll(r)
+				require.NoError(t, err)
+				for _, expected := range tc.expectRequest {
+					assert.Contains(t, string(request), expected)
+				}
+				if tc.postErr != nil {
+					return nil, tc.postErr
+				}
+				return &http.Response{Body: ioutil.NopCloser(strings.NewReader(tc.response))}, nil
+			}
+
+			confirmation, err := transfer(checking.DirectConnect, checking, to, decimal.RequireFromString("12.50"), uid, marshal, doPost, ofxgo.ParseResponse)
+			assert.Equal(t, 1, posts, "Transfers should never be retried")
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectConfirm.ServerID, confirmation.ServerID)
+			assert.Equal(t, tc.expectConfirm.Currency, confirmation.Currency)
+			assert.True(t, tc.expectConfirm.Amount.Equal(confirmation.Amount), "Amount %s should equal %s", confirmation.Amount, tc.expectConfirm.Amount)
+			assert.Equal(t, tc.expectConfirm.Status, confirmation.Status)
+			for _, times := range [][2]*time.Time{
+				{tc.expectConfirm.Projected, confirmation.Projected},
+				{tc.expectConfirm.Posted, confirmation.Posted},
+			} {
+				if times[0] == nil {
+					assert.Nil(t, times[1])
+				} else if assert.NotNil(t, times[1]) {
+					assert.True(t, times[0].Equal(*times[1]), "Time %s should equal %s", times[1], times[0])
+				}
+			}
+		})
+	}
+}
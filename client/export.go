@@ -0,0 +1,167 @@
+package client
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// maxOFXNameLength is the longest NAME allowed by OFX 102 Section 11.4.3
+	maxOFXNameLength = 32
+	// defaultExportCurrency is used for accounts without any postings
+	defaultExportCurrency = "USD"
+)
+
+// WriteOFX writes account's postings in txns between start and end as an OFX statement, the inverse of ReadOFX.
+// 'balance' is the account's balance as of 'end'.
+func WriteOFX(w io.Writer, account model.Account, txns []ledger.Transaction, balance decimal.Decimal, start, end, now time.Time) error {
+	accountName := model.LedgerAccountName(account)
+	var fid, org string
+	if inst := account.Institution(); inst != nil {
+		fid, org = inst.FID(), inst.Org()
+	}
+
+	var currency string
+	tranList := &ofxgo.TransactionList{
+		DtStart: ofxgo.Date{Time: start},
+		DtEnd:   ofxgo.Date{Time: end},
+	}
+	for _, txn := range txns {
+		if ledger.IsBalanceAssertion(txn) || txn.Date.Before(start) || txn.Date.After(end) {
+			continue
+		}
+		for i, p := range txn.Postings {
+			if p.Account != accountName {
+				continue
+			}
+			if currency == "" {
+				currency = p.Currency
+			}
+			ofxTxn, err := exportTransaction(txn, p, i, fid, account.ID())
+			if err != nil {
+				return err
+			}
+			tranList.Transactions = append(tranList.Transactions, ofxTxn)
+		}
+	}
+
+	curDef, err := ofxgo.NewCurrSymbol(denormalizeCurrency(currency))
+	if err != nil {
+		return errors.Wrap(err, "Unsupported currency for OFX export")
+	}
+	trnUID, err := ofxgo.RandomUID()
+	if err != nil {
+		return err
+	}
+	var balAmt ofxgo.Amount
+	balAmt.SetString(balance.String())
+
+	resp := ofxgo.Response{
+		Version: ofxgo.OfxVersion102,
+		Signon: ofxgo.SignonResponse{
+			Status:   ofxgo.Status{Code: 0, Severity: "INFO"},
+			DtServer: ofxgo.Date{Time: now},
+			Language: "ENG",
+			Org:      ofxgo.String(org),
+			Fid:      ofxgo.String(fid),
+		},
+	}
+	switch account.Type() {
+	case model.AssetAccount:
+		bank, isBank := account.(direct.Bank)
+		if !isBank || bank.BankID() == "" {
+			return errors.New("Bank accounts must have a routing number to export as OFX")
+		}
+		acctType, err := ofxgo.NewAcctType(bank.AcctType())
+		if err != nil {
+			return errors.Wrap(err, "Invalid bank account type")
+		}
+		resp.Bank = append(resp.Bank, &ofxgo.StatementResponse{
+			TrnUID: *trnUID,
+			Status: ofxgo.Status{Code: 0, Severity: "INFO"},
+			CurDef: *curDef,
+			BankAcctFrom: ofxgo.BankAcct{
+				BankID:   ofxgo.String(bank.BankID()),
+				AcctID:   ofxgo.String(account.ID()),
+				AcctType: acctType,
+			},
+			BankTranList: tranList,
+			BalAmt:       balAmt,
+			DtAsOf:       ofxgo.Date{Time: end},
+		})
+	case model.LiabilityAccount:
+		resp.CreditCard = append(resp.CreditCard, &ofxgo.CCStatementResponse{
+			TrnUID:       *trnUID,
+			Status:       ofxgo.Status{Code: 0, Severity: "INFO"},
+			CurDef:       *curDef,
+			CCAcctFrom:   ofxgo.CCAcct{AcctID: ofxgo.String(account.ID())},
+			BankTranList: tranList,
+			BalAmt:       balAmt,
+			DtAsOf:       ofxgo.Date{Time: end},
+		})
+	default:
+		return errors.Errorf("Unsupported account type for OFX export: %q", account.Type())
+	}
+
+	b, err := resp.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "Failed to write OFX")
+	}
+	_, err = b.WriteTo(w)
+	return err
+}
+
+// exportTransaction converts posting 'p' of txn to an OFX transaction. Restores the original FITID for imported postings.
+func exportTransaction(txn ledger.Transaction, p ledger.Posting, postingIndex int, fid, accountID string) (ofxgo.Transaction, error) {
+	fitID := p.ID()
+	if fitID == "" {
+		fitID = txn.ID() + "-" + strconv.Itoa(postingIndex)
+	}
+	fitID = strings.TrimPrefix(fitID, MakeUniqueTxnID(fid, accountID)(""))
+
+	trnType := ofxgo.TrnTypeDebit
+	if p.Amount.IsPositive() {
+		trnType = ofxgo.TrnTypeCredit
+	}
+	var amount ofxgo.Amount
+	amount.SetString(p.Amount.String())
+	name := []rune(txn.Payee)
+	if len(name) > maxOFXNameLength {
+		name = name[:maxOFXNameLength]
+	}
+	ofxTxn := ofxgo.Transaction{
+		TrnType:  trnType,
+		DtPosted: ofxgo.Date{Time: txn.Date},
+		TrnAmt:   amount,
+		FiTID:    ofxgo.String(fitID),
+		Name:     ofxgo.String(string(name)),
+		Memo:     ofxgo.String(txn.Comment),
+	}
+	if code := p.Tags[model.CategoryCodeTag]; code != "" {
+		sic, err := strconv.Atoi(code)
+		if err != nil {
+			return ofxgo.Transaction{}, errors.Wrapf(err, "Invalid category code on transaction %s", txn.ID())
+		}
+		ofxTxn.SIC = ofxgo.Int(sic)
+	}
+	return ofxTxn, nil
+}
+
+// denormalizeCurrency is the inverse of normalizeCurrency
+func denormalizeCurrency(currency string) string {
+	switch currency {
+	case "$", "":
+		return defaultExportCurrency
+	default:
+		return currency
+	}
+}
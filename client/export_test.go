@@ -0,0 +1,100 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteOFXRoundTrip(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		description string
+		account     model.Account
+	}{
+		{
+			description: "checking",
+			account:     direct.NewCheckingAccount("123456789", "987654321", "checking", testConnector("user", "password")),
+		},
+		{
+			description: "credit card",
+			account:     direct.NewCreditCard("4111111111111111", "card", testConnector("user", "password")),
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			accountName := model.LedgerAccountName(tc.account)
+			makeID := MakeUniqueTxnID(tc.account.Institution().FID(), tc.account.ID())
+			txns := []ledger.Transaction{
+				{
+					Date:  time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC),
+					Payee: "Before the range",
+					Postings: []ledger.Posting{
+						{Account: accountName, Amount: decimal.NewFromFloat(-1), Currency: "$", Tags: map[string]string{"id": makeID("0")}},
+						{Account: "expenses:misc", Amount: decimal.NewFromFloat(1), Currency: "$"},
+					},
+				},
+				{
+					Date:  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+					Payee: "A payee with a very long name that OFX cannot hold",
+					Postings: []ledger.Posting{
+						{Account: accountName, Amount: decimal.NewFromFloat(-12.34), Currency: "$", Tags: map[string]string{"id": makeID("1"), model.CategoryCodeTag: "5411"}},
+						{Account: "expenses:groceries", Amount: decimal.NewFromFloat(12.34), Currency: "$"},
+					},
+				},
+				{
+					Date:  time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+					Payee: "Refund",
+					Postings: []ledger.Posting{
+						{Account: accountName, Amount: decimal.NewFromFloat(5), Currency: "$", Tags: map[string]string{"id": makeID("2")}},
+						{Account: "expenses:groceries", Amount: decimal.NewFromFloat(-5), Currency: "$"},
+					},
+				},
+				{
+					Date:  time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC),
+					Payee: "Other account",
+					Postings: []ledger.Posting{
+						{Account: "assets:other", Amount: decimal.NewFromFloat(-2), Currency: "$", Tags: map[string]string{"id": "other"}},
+						{Account: "expenses:misc", Amount: decimal.NewFromFloat(2), Currency: "$"},
+					},
+				},
+			}
+
+			var buf bytes.Buffer
+			require.NoError(t, WriteOFX(&buf, tc.account, txns, decimal.NewFromFloat(-8.34), start, end, end))
+
+			accounts, imported, err := ReadOFX(&buf)
+			require.NoError(t, err)
+			require.Len(t, accounts, 1)
+			assert.Equal(t, tc.account.ID(), accounts[0].ID())
+			assert.Equal(t, tc.account.Type(), accounts[0].Type())
+
+			imported, assertions := ledger.SplitBalanceAssertions(imported)
+			require.Len(t, imported, 2)
+			assert.Equal(t, makeID("1"), imported[0].Postings[0].ID())
+			assert.Equal(t, "A payee with a very long name th", imported[0].Payee)
+			assert.Equal(t, "-12.34", imported[0].Postings[0].Amount.String())
+			assert.Equal(t, "5411", imported[0].Postings[0].Tags[model.CategoryCodeTag])
+			assert.Equal(t, accountName, imported[0].Postings[0].Account)
+			assert.Equal(t, makeID("2"), imported[1].Postings[0].ID())
+			assert.Equal(t, "5", imported[1].Postings[0].Amount.String())
+
+			require.Len(t, assertions, 1)
+			assert.Equal(t, "-8.34", assertions[0].Postings[0].Balance.String())
+		})
+	}
+}
+
+func TestWriteOFXRequiresRoutingNumber(t *testing.T) {
+	account := model.NewManualAccount("1234", "cash", model.AssetAccount, "wallet")
+	err := WriteOFX(&bytes.Buffer{}, account, nil, decimal.Zero, time.Time{}, time.Now(), time.Now())
+	require.Error(t, err)
+	assert.Equal(t, "Bank accounts must have a routing number to export as OFX", err.Error())
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +29,8 @@ func importTransactions(
 	for _, message := range messages {
 		var ofxTxns []ofxgo.Transaction
 		var currency string
+		var balance ofxgo.Amount
+		var balanceDate ofxgo.Date
 		account := model.LedgerAccountFormat{Institution: org}
 		switch statement := message.(type) {
 		case *ofxgo.CCStatementResponse:
@@ -37,6 +40,7 @@ func importTransactions(
 				ofxTxns = statement.BankTranList.Transactions
 			}
 			currency = normalizeCurrency(statement.CurDef.String())
+			balance, balanceDate = statement.BalAmt, statement.DtAsOf
 		case *ofxgo.StatementResponse:
 			account.AccountType = model.AssetAccount
 			account.AccountID = statement.BankAcctFrom.AcctID.String()
@@ -44,6 +48,7 @@ func importTransactions(
 				ofxTxns = statement.BankTranList.Transactions
 			}
 			currency = normalizeCurrency(statement.CurDef.String())
+			balance, balanceDate = statement.BalAmt, statement.DtAsOf
 		default:
 			return nil, nil, errors.Errorf("Invalid statement type: %T", message)
 		}
@@ -52,6 +57,10 @@ func importTransactions(
 			parsedTxn := parseTransaction(ofxTxn, currency, account.String(), MakeUniqueTxnID(fid, account.AccountID))
 			txns = append(txns, parsedTxn)
 		}
+		if !balanceDate.Time.IsZero() {
+			statementBalance := parseAmount(balance)
+			txns = append(txns, ledger.NewBalanceAssertion(account.String(), balanceDate.Time, statementBalance, currency))
+		}
 
 		skeletonAccounts = append(skeletonAccounts, &model.BasicAccount{
 			AccountDescription: fmt.Sprintf("%s - %s", org, account.AccountID),
@@ -88,6 +97,70 @@ func ParseOFX(resp *ofxgo.Response) ([]model.Account, []ledger.Transaction, erro
 	return importTransactions(*resp, parseTransaction)
 }
 
+// MatchImportedAccounts moves each imported account's transactions onto the stored account with the same type and ID.
+// Falls back to a single stored account of the same type with the same ID suffix, since imported IDs are often masked.
+// Returns the imported accounts which matched no stored account.
+func MatchImportedAccounts(imported []model.Account, txns []ledger.Transaction, accounts []model.Account) (unmatched []model.Account) {
+	renames := make(map[string]string)
+	for _, importedAccount := range imported {
+		match := matchAccount(importedAccount, accounts)
+		if match == nil {
+			unmatched = append(unmatched, importedAccount)
+			continue
+		}
+		renames[model.LedgerAccountName(importedAccount)] = model.LedgerAccountName(match)
+	}
+	for i := range txns {
+		if name, ok := renames[txns[i].Postings[0].Account]; ok {
+			txns[i].Postings[0].Account = name
+		}
+	}
+	return unmatched
+}
+
+func matchAccount(imported model.Account, accounts []model.Account) model.Account {
+	var suffixMatches []model.Account
+	for _, account := range accounts {
+		if account.Type() != imported.Type() {
+			continue
+		}
+		if account.ID() == imported.ID() {
+			return account
+		}
+		if idSuffix(account.ID()) == idSuffix(imported.ID()) {
+			suffixMatches = append(suffixMatches, account)
+		}
+	}
+	if len(suffixMatches) == 1 {
+		return suffixMatches[0]
+	}
+	return nil
+}
+
+func idSuffix(id string) string {
+	if len(id) > model.RedactSuffixLength {
+		return id[len(id)-model.RedactSuffixLength:]
+	}
+	return id
+}
+
+// FilterBalanceAssertions removes balance assertions for any accounts which have not opted in to them
+func FilterBalanceAssertions(txns []ledger.Transaction, accounts []model.Account) []ledger.Transaction {
+	assertAccounts := make(map[string]bool)
+	for _, account := range accounts {
+		if model.AssertsBalance(account) {
+			assertAccounts[model.LedgerAccountName(account)] = true
+		}
+	}
+	filtered := make([]ledger.Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if !ledger.IsBalanceAssertion(txn) || assertAccounts[txn.Postings[0].Account] {
+			filtered = append(filtered, txn)
+		}
+	}
+	return filtered
+}
+
 type transactionParser func(txn ofxgo.Transaction, currency, accountName string, makeTxnID func(string) string) ledger.Transaction
 
 func normalizeCurrency(currency string) string {
@@ -124,11 +197,24 @@ func parseTransaction(txn ofxgo.Transaction, currency, accountName string, makeT
 		name = string(txn.Payee.Name)
 	}
 
-	// TODO can ofxgo lib support a decimal type instead of big.Rat?
-	// NOTE: TrnAmt uses big.Rat internally, which can't form an invalid number with .String()
-	amount := decimal.RequireFromString(txn.TrnAmt.String())
+	amount := parseAmount(txn.TrnAmt)
 
 	id := makeTxnID(string(txn.FiTID))
+	tags := map[string]string{"id": id}
+	if txn.SIC != 0 {
+		tags[model.CategoryCodeTag] = strconv.FormatInt(int64(txn.SIC), 10)
+	}
+	// kept until SetTransactionCodes chooses the account's code field
+	if checkNumber := strings.TrimSpace(string(txn.CheckNum)); checkNumber != "" {
+		tags[model.CheckNumberTag] = checkNumber
+	}
+	if referenceNumber := strings.TrimSpace(string(txn.RefNum)); referenceNumber != "" {
+		tags[model.ReferenceNumberTag] = referenceNumber
+	}
+	// kept until RouteCashWithdrawals checks if the account tracks cash
+	if txn.TrnType == ofxgo.TrnTypeATM || txn.TrnType == ofxgo.TrnTypeCash {
+		tags[model.CashWithdrawalTag] = "true"
+	}
 
 	return ledger.Transaction{
 		Date:  txn.DtPosted.Time,
@@ -139,7 +225,7 @@ func parseTransaction(txn ofxgo.Transaction, currency, accountName string, makeT
 				Amount:   amount,
 				Balance:  nil, // set balance in next section
 				Currency: currency,
-				Tags:     map[string]string{"id": id},
+				Tags:     tags,
 			},
 			{
 				Account:  model.Uncategorized,
@@ -196,6 +196,91 @@ func TestImportTransactions(t *testing.T) {
 			},
 			expectTxns: []ledger.Transaction{someTxn},
 		},
+		{
+			description: "statement balance",
+			resp: ofxgo.Response{
+				Signon: ofxgo.SignonResponse{
+					Fid: ofxgo.String("some FID"),
+					Org: ofxgo.String("some org"),
+				},
+				Bank: []ofxgo.Message{
+					&ofxgo.StatementResponse{
+						CurDef: *someCurrency,
+						BankAcctFrom: ofxgo.BankAcct{
+							AcctID: ofxgo.String("1234"),
+						},
+						BalAmt: makeOFXAmount(12.5),
+						DtAsOf: ofxgo.Date{Time: parseDate("2020/01/02")},
+					},
+				},
+			},
+			expectAccounts: []model.Account{
+				&model.BasicAccount{
+					AccountID:          "1234",
+					AccountType:        model.AssetAccount,
+					AccountDescription: "some org - 1234",
+					BasicInstitution: model.BasicInstitution{
+						InstDescription: "some org",
+						InstFID:         "some FID",
+						InstOrg:         "some org",
+					},
+				},
+			},
+			expectTxns: []ledger.Transaction{
+				ledger.NewBalanceAssertion("assets:some org:****1234", parseDate("2020/01/02"), decimal.NewFromFloat(12.5), "$"),
+			},
+		},
+		{
+			description: "mixed bank and credit card statements",
+			resp: ofxgo.Response{
+				Signon: ofxgo.SignonResponse{
+					Fid: ofxgo.String("some FID"),
+					Org: ofxgo.String("some org"),
+				},
+				Bank: []ofxgo.Message{
+					&ofxgo.StatementResponse{
+						CurDef:       *someCurrency,
+						BankAcctFrom: ofxgo.BankAcct{AcctID: ofxgo.String("1234")},
+						BalAmt:       makeOFXAmount(12.5),
+						DtAsOf:       ofxgo.Date{Time: parseDate("2020/01/02")},
+					},
+				},
+				CreditCard: []ofxgo.Message{
+					&ofxgo.CCStatementResponse{
+						CurDef:     *someCurrency,
+						CCAcctFrom: ofxgo.CCAcct{AcctID: ofxgo.String("1234")},
+						BalAmt:     makeOFXAmount(-3),
+						DtAsOf:     ofxgo.Date{Time: parseDate("2020/01/02")},
+					},
+				},
+			},
+			expectAccounts: []model.Account{
+				&model.BasicAccount{
+					AccountID:          "1234",
+					AccountType:        model.AssetAccount,
+					AccountDescription: "some org - 1234",
+					BasicInstitution: model.BasicInstitution{
+						InstDescription: "some org",
+						InstFID:         "some FID",
+						InstOrg:         "some org",
+					},
+				},
+				&model.BasicAccount{
+					AccountID:          "1234",
+					AccountType:        model.LiabilityAccount,
+					AccountDescription: "some org - 1234",
+					BasicInstitution: model.BasicInstitution{
+						InstDescription: "some org",
+						InstFID:         "some FID",
+						InstOrg:         "some org",
+					},
+				},
+			},
+			expectTxns: []ledger.Transaction{
+				ledger.NewBalanceAssertion("assets:some org:****1234", parseDate("2020/01/02"), decimal.NewFromFloat(12.5), "$"),
+				ledger.NewBalanceAssertion("liabilities:some org:****1234", parseDate("2020/01/02"), decimal.NewFromFloat(-3), "$"),
+			},
+		},
 		{
 			description: "bad institution type",
 			resp: ofxgo.Response{
@@ -227,6 +312,65 @@ func TestImportTransactions(t *testing.T) {
 	}
 }
 
+func TestFilterBalanceAssertions(t *testing.T) {
+	optIn := &model.BasicAccount{
+		AccountID:         "1234",
+		AccountType:       model.AssetAccount,
+		BasicInstitution:  model.BasicInstitution{InstDescription: "some org"},
+		BalanceAssertions: true,
+	}
+	optOut := &model.BasicAccount{
+		AccountID:        "5678",
+		AccountType:      model.AssetAccount,
+		BasicInstitution: model.BasicInstitution{InstDescription: "some org"},
+	}
+	someTxn := makeTxn("2020/01/01", 1)
+	optInAssertion := ledger.NewBalanceAssertion(model.LedgerAccountName(optIn), parseDate("2020/01/02"), decimal.NewFromFloat(1), "$")
+	optOutAssertion := ledger.NewBalanceAssertion(model.LedgerAccountName(optOut), parseDate("2020/01/02"), decimal.NewFromFloat(1), "$")
+
+	txns := FilterBalanceAssertions(
+		[]ledger.Transaction{someTxn, optInAssertion, optOutAssertion},
+		[]model.Account{optIn, optOut},
+	)
+	assert.Equal(t, []ledger.Transaction{someTxn, optInAssertion}, txns)
+}
+
+func TestMatchImportedAccounts(t *testing.T) {
+	inst := model.BasicInstitution{InstOrg: "some org"}
+	fileInst := model.BasicInstitution{InstOrg: "file org"}
+	checking := &model.BasicAccount{AccountID: "11111234", AccountType: model.AssetAccount, BasicInstitution: inst}
+	card := &model.BasicAccount{AccountID: "99991234", AccountType: model.LiabilityAccount, BasicInstitution: inst}
+	savings := &model.BasicAccount{AccountID: "5678", AccountType: model.AssetAccount, BasicInstitution: inst}
+
+	importedChecking := &model.BasicAccount{AccountID: "XXXX1234", AccountType: model.AssetAccount, BasicInstitution: fileInst}
+	importedCard := &model.BasicAccount{AccountID: "99991234", AccountType: model.LiabilityAccount, BasicInstitution: fileInst}
+	importedUnknown := &model.BasicAccount{AccountID: "0000", AccountType: model.LiabilityAccount, BasicInstitution: fileInst}
+
+	txns := []ledger.Transaction{
+		{Postings: []ledger.Posting{{Account: model.LedgerAccountName(importedChecking)}, {Account: model.Uncategorized}}},
+		{Postings: []ledger.Posting{{Account: model.LedgerAccountName(importedCard)}, {Account: model.Uncategorized}}},
+		{Postings: []ledger.Posting{{Account: model.LedgerAccountName(importedUnknown)}, {Account: model.Uncategorized}}},
+	}
+	unmatched := MatchImportedAccounts(
+		[]model.Account{importedChecking, importedCard, importedUnknown},
+		txns,
+		[]model.Account{card, checking, savings},
+	)
+	assert.Equal(t, []model.Account{importedUnknown}, unmatched)
+	assert.Equal(t, model.LedgerAccountName(checking), txns[0].Postings[0].Account, "Checking should match by type and ID suffix, not the credit card with the same suffix")
+	assert.Equal(t, model.LedgerAccountName(card), txns[1].Postings[0].Account)
+	assert.Equal(t, model.LedgerAccountName(importedUnknown), txns[2].Postings[0].Account)
+	assert.Equal(t, model.Uncategorized, txns[0].Postings[1].Account)
+}
+
+func TestMatchAccountAmbiguousSuffix(t *testing.T) {
+	first := &model.BasicAccount{AccountID: "11111234", AccountType: model.AssetAccount}
+	second := &model.BasicAccount{AccountID: "22221234", AccountType: model.AssetAccount}
+	imported := &model.BasicAccount{AccountID: "XXXX1234", AccountType: model.AssetAccount}
+	assert.Nil(t, matchAccount(imported, []model.Account{first, second}))
+	assert.Equal(t, second, matchAccount(&model.BasicAccount{AccountID: "22221234", AccountType: model.AssetAccount}, []model.Account{first, second}))
+}
+
 func TestReadOFX(t *testing.T) {
 	t.Run("no signon", func(t *testing.T) {
 		_, _, err := ReadOFX(strings.NewReader(`
@@ -363,6 +507,23 @@ func TestParseTransaction(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "category code",
+			accountName: "assets:Bank 1",
+			txn: ofxgo.Transaction{
+				Currency: usdCurrency,
+				Name:     ofxgo.String("Grocery store"),
+				TrnAmt:   makeOFXAmount(-1.25),
+				SIC:      5411,
+			},
+			expectedTxn: ledger.Transaction{
+				Payee: "Grocery store",
+				Postings: []ledger.Posting{
+					{Account: "assets:Bank 1", Currency: usd, Amount: decimal.NewFromFloat(-1.25), Tags: map[string]string{"id": "some FID", "sic": "5411"}},
+					{Account: model.Uncategorized, Currency: usd, Amount: decimal.NewFromFloat(1.25)},
+				},
+			},
+		},
 	} {
 		someFID := "some FID"
 		makeTxnID := func(id string) string {
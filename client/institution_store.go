@@ -0,0 +1,197 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+)
+
+const (
+	institutionsBucket        = "institutions"
+	institutionsBucketVersion = "1"
+
+	institutionIDLength = 8
+)
+
+// institutionStore contains direct connect institutions shared by one or more accounts
+type institutionStore struct {
+	plaindb.Bucket
+}
+
+func newInstitutionStore(db plaindb.DB) (*institutionStore, error) {
+	bucket, err := db.Bucket(institutionsBucket, institutionsBucketVersion, &institutionStoreUpgrader{})
+	return &institutionStore{
+		Bucket: bucket,
+	}, err
+}
+
+func (s *institutionStore) get(id string) (direct.Connector, bool, error) {
+	var connector direct.Connector
+	found, err := s.Get(id, &connector)
+	return connector, found, err
+}
+
+// match returns the ID of an institution with the same URL, username, and FID as 'connector'
+func (s *institutionStore) match(connector direct.Connector) (matchID string, found bool, err error) {
+	var inst direct.Connector
+	err = s.Iter(&inst, func(id string) bool {
+		if sameInstitution(inst, connector) {
+			matchID, found = id, true
+			return false
+		}
+		return true
+	})
+	return matchID, found, err
+}
+
+// save updates the matching institution with 'connector', or adds a new one if none match
+func (s *institutionStore) save(connector direct.Connector) (string, error) {
+	id, found, err := s.match(connector)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		id, err = newInstitutionID()
+		if err != nil {
+			return "", err
+		}
+	}
+	return id, s.Put(id, connector)
+}
+
+func sameInstitution(a, b direct.Connector) bool {
+	return strings.TrimRight(a.URL(), "/") == strings.TrimRight(b.URL(), "/") &&
+		a.Username() == b.Username() &&
+		a.FID() == b.FID()
+}
+
+func newInstitutionID() (string, error) {
+	b := make([]byte, institutionIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type institutionStoreUpgrader struct{}
+
+func (u *institutionStoreUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		return direct.UnmarshalConnector(data)
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+// ParseLegacy only accepts empty files, which are treated the same as the accounts bucket: no data
+func (u *institutionStoreUpgrader) ParseLegacy(legacyData json.RawMessage) (version string, data map[string]json.RawMessage, err error) {
+	if len(legacyData) == 0 {
+		return "", nil, nil
+	}
+	return "", nil, errors.New("Unrecognized institutions format")
+}
+
+func (u *institutionStoreUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
+
+// Institution is a direct connect institution shared by one or more accounts
+type Institution struct {
+	ID          string
+	Institution direct.Connector
+	AccountIDs  []string
+}
+
+// Institutions returns all shared institutions and the IDs of the accounts referencing them, sorted by ID
+func (s *AccountStore) Institutions() ([]Institution, error) {
+	references, err := s.institutionReferences()
+	if err != nil {
+		return nil, err
+	}
+	var institutions []Institution
+	var connector direct.Connector
+	err = s.institutions.Iter(&connector, func(id string) bool {
+		institutions = append(institutions, Institution{
+			ID:          id,
+			Institution: connector,
+			AccountIDs:  references[id],
+		})
+		return true
+	})
+	sort.Slice(institutions, func(a, b int) bool {
+		return institutions[a].ID < institutions[b].ID
+	})
+	return institutions, err
+}
+
+// Institution returns the shared institution with the given ID
+func (s *AccountStore) Institution(id string) (direct.Connector, bool, error) {
+	return s.institutions.get(id)
+}
+
+// AddInstitution adds 'connector' as a shared institution, or updates an institution with the same URL, username, and FID. Returns the institution's ID.
+func (s *AccountStore) AddInstitution(connector direct.Connector) (string, error) {
+	return s.institutions.save(connector)
+}
+
+// UpdateInstitution replaces the institution with ID 'id'. Changes immediately apply to all accounts referencing it.
+func (s *AccountStore) UpdateInstitution(id string, connector direct.Connector) error {
+	_, found, err := s.institutions.get(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("Institution not found by ID: %q", id)
+	}
+	matchID, found, err := s.institutions.match(connector)
+	if err != nil {
+		return err
+	}
+	if found && matchID != id {
+		return errors.Errorf("Institution already exists with that URL, username, and FID: %q", matchID)
+	}
+	return s.institutions.Put(id, connector)
+}
+
+// RemoveInstitution deletes the institution with ID 'id'. Fails if any accounts still reference it.
+func (s *AccountStore) RemoveInstitution(id string) error {
+	_, found, err := s.institutions.get(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("Institution not found by ID: %q", id)
+	}
+	references, err := s.institutionReferences()
+	if err != nil {
+		return err
+	}
+	if accountIDs := references[id]; len(accountIDs) > 0 {
+		return errors.Errorf("Institution is still used by accounts: %s", strings.Join(accountIDs, ", "))
+	}
+	return s.institutions.Put(id, nil)
+}
+
+// institutionReferences returns a map of institution IDs to the sorted IDs of accounts referencing them
+func (s *AccountStore) institutionReferences() (map[string][]string, error) {
+	references := make(map[string][]string)
+	var account model.Account
+	err := s.Bucket.Iter(&account, func(id string) bool {
+		if ref, ok := account.(direct.InstitutionReference); ok && ref.InstitutionRef() != "" {
+			references[ref.InstitutionRef()] = append(references[ref.InstitutionRef()], id)
+		}
+		return true
+	})
+	for _, accountIDs := range references {
+		sort.Strings(accountIDs)
+	}
+	return references, err
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/redactor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConnector(username, password string) direct.Connector {
+	return direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", username, password, direct.Config{
+		AppID:      "QWIN",
+		AppVersion: "2500",
+		OFXVersion: "102",
+	})
+}
+
+func getConnector(t *testing.T, store *AccountStore, id string) direct.Connector {
+	var account model.Account
+	found, err := store.Get(id, &account)
+	require.NoError(t, err)
+	require.True(t, found)
+	connector, ok := account.Institution().(direct.Connector)
+	require.True(t, ok)
+	return connector
+}
+
+func TestMigrateInstitutions(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{})
+	store, err := NewAccountStore(db)
+	require.NoError(t, err)
+	require.NoError(t, store.Bucket.Put("1", direct.NewCreditCard("1", "card 1", testConnector("user", "old password"))))
+	require.NoError(t, store.Bucket.Put("2", direct.NewCreditCard("2", "card 2", testConnector("user", "old password"))))
+	require.NoError(t, store.Bucket.Put("3", direct.NewCreditCard("3", "card 3", testConnector("other user", "password"))))
+	require.NoError(t, store.Bucket.Put("4", &model.BasicAccount{AccountID: "4"}))
+
+	require.NoError(t, store.migrateInstitutions())
+	institutions, err := store.Institutions()
+	require.NoError(t, err)
+	require.Len(t, institutions, 2)
+	accountIDs := [][]string{institutions[0].AccountIDs, institutions[1].AccountIDs}
+	assert.ElementsMatch(t, [][]string{{"1", "2"}, {"3"}}, accountIDs)
+
+	var stored model.Account
+	_, err = store.Bucket.Get("1", &stored)
+	require.NoError(t, err)
+	assert.Nil(t, stored.Institution(), "Accounts should only store a reference to the institution")
+	assert.Equal(t, "user", getConnector(t, store, "1").Username())
+
+	require.NoError(t, store.migrateInstitutions())
+	institutions, err = store.Institutions()
+	require.NoError(t, err)
+	assert.Len(t, institutions, 2, "Migration should be idempotent")
+}
+
+func TestAccountStorePutMatchesInstitution(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{})
+	store, err := NewAccountStore(db)
+	require.NoError(t, err)
+	require.NoError(t, store.Add(direct.NewCreditCard("1", "card 1", testConnector("user", "password"))))
+	require.NoError(t, store.Add(direct.NewCreditCard("2", "card 2", testConnector("user", "new password"))))
+
+	institutions, err := store.Institutions()
+	require.NoError(t, err)
+	require.Len(t, institutions, 1)
+	assert.Equal(t, []string{"1", "2"}, institutions[0].AccountIDs)
+	assert.Equal(t, redactor.String("new password"), getConnector(t, store, "1").Password(), "Embedded institutions should update the matching institution")
+}
+
+func TestUpdateInstitution(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{})
+	store, err := NewAccountStore(db)
+	require.NoError(t, err)
+	require.NoError(t, store.Add(direct.NewCreditCard("1", "card 1", testConnector("user", "password"))))
+	require.NoError(t, store.Add(direct.NewCreditCard("2", "card 2", testConnector("user", "password"))))
+	otherID, err := store.AddInstitution(testConnector("other user", "password"))
+	require.NoError(t, err)
+	institutions, err := store.Institutions()
+	require.NoError(t, err)
+	var id string
+	for _, inst := range institutions {
+		if inst.ID != otherID {
+			id = inst.ID
+		}
+	}
+
+	require.NoError(t, store.UpdateInstitution(id, testConnector("user", "new password")))
+	assert.Equal(t, redactor.String("new password"), getConnector(t, store, "1").Password())
+	assert.Equal(t, redactor.String("new password"), getConnector(t, store, "2").Password())
+
+	err = store.UpdateInstitution(id, testConnector("other user", "password"))
+	require.Error(t, err)
+	assert.Equal(t, `Institution already exists with that URL, username, and FID: "`+otherID+`"`, err.Error())
+
+	err = store.UpdateInstitution("missing", testConnector("user", "password"))
+	require.Error(t, err)
+	assert.Equal(t, `Institution not found by ID: "missing"`, err.Error())
+}
+
+func TestRemoveInstitution(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{})
+	store, err := NewAccountStore(db)
+	require.NoError(t, err)
+	require.NoError(t, store.Add(direct.NewCreditCard("1", "card 1", testConnector("user", "password"))))
+	require.NoError(t, store.Add(direct.NewCreditCard("2", "card 2", testConnector("user", "password"))))
+	institutions, err := store.Institutions()
+	require.NoError(t, err)
+	require.Len(t, institutions, 1)
+	id := institutions[0].ID
+
+	err = store.RemoveInstitution(id)
+	require.Error(t, err)
+	assert.Equal(t, "Institution is still used by accounts: 1, 2", err.Error())
+
+	require.NoError(t, store.Remove("1"))
+	require.NoError(t, store.Remove("2"))
+	require.NoError(t, store.RemoveInstitution(id))
+	institutions, err = store.Institutions()
+	require.NoError(t, err)
+	assert.Empty(t, institutions)
+}
+
+func TestAccountStoreMissingInstitution(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{})
+	store, err := NewAccountStore(db)
+	require.NoError(t, err)
+	account := direct.NewCreditCard("1", "card 1", nil).(direct.InstitutionReference).WithInstitution("missing", nil)
+	require.NoError(t, store.Bucket.Put("1", account))
+
+	var lookup model.Account
+	_, err = store.Get("1", &lookup)
+	require.Error(t, err)
+	assert.Equal(t, `Institution not found for account "1": "missing"`, err.Error())
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"strings"
+	"time"
 
 	sErrors "github.com/johnstarich/sage/errors"
 	"github.com/pkg/errors"
@@ -10,6 +11,25 @@ import (
 const (
 	// Uncategorized is used as the default account2 on an imported transaction
 	Uncategorized = "uncategorized"
+	// CategoryCodeTag is the posting tag holding an institution-provided SIC/MCC code on an imported transaction
+	CategoryCodeTag = "sic"
+	// ZeroAmountTag marks imported zero-amount transactions for accounts with the ZeroAmountTagged policy
+	ZeroAmountTag = "zero_amount"
+
+	// Zero-amount transaction policies, which decide what happens to an account's imported transactions with no amount
+	ZeroAmountKeep   = "keep"
+	ZeroAmountDrop   = "drop"
+	ZeroAmountTagged = "tag"
+
+	// CheckNumberTag and ReferenceNumberTag are posting tags holding an imported transaction's OFX check and reference numbers, until client.SetTransactionCodes removes them
+	CheckNumberTag     = "checknum"
+	ReferenceNumberTag = "refnum"
+	// CashWithdrawalTag is a posting tag marking an imported ATM or cash withdrawal, until client.RouteCashWithdrawals removes it
+	CashWithdrawalTag = "cash_withdrawal"
+
+	// Transaction code fields, which choose the OFX field imported as an account's ledger transaction codes
+	CodeFieldCheckNumber     = "checknum"
+	CodeFieldReferenceNumber = "refnum"
 
 	// Ledger account types
 	AssetAccount     = "assets"
@@ -31,11 +51,185 @@ type Account interface {
 	Type() string
 }
 
+// BalanceAsserter is implemented by accounts which can opt in to writing statement balances into the ledger as balance assertions
+type BalanceAsserter interface {
+	AssertBalance() bool
+}
+
+// AssertsBalance returns true if account opted in to ledger balance assertions
+func AssertsBalance(account Account) bool {
+	asserter, ok := account.(BalanceAsserter)
+	return ok && asserter.AssertBalance()
+}
+
+// ZeroAmountHandler is implemented by accounts which can choose how to import zero-amount transactions, like informational memos
+type ZeroAmountHandler interface {
+	ZeroAmountPolicy() string
+}
+
+// ZeroAmountPolicy returns account's zero-amount transaction policy, defaulting to ZeroAmountKeep
+func ZeroAmountPolicy(account Account) string {
+	if handler, ok := account.(ZeroAmountHandler); ok && handler.ZeroAmountPolicy() != "" {
+		return handler.ZeroAmountPolicy()
+	}
+	return ZeroAmountKeep
+}
+
+// ValidateZeroAmountPolicy returns an error if policy is not a zero-amount transaction policy. An empty policy uses the default.
+func ValidateZeroAmountPolicy(policy string) error {
+	switch policy {
+	case "", ZeroAmountKeep, ZeroAmountDrop, ZeroAmountTagged:
+		return nil
+	default:
+		return errors.Errorf("Zero amount policy must be %q, %q, or %q: %q", ZeroAmountKeep, ZeroAmountDrop, ZeroAmountTagged, policy)
+	}
+}
+
+// TransactionCoder is implemented by accounts which can choose the OFX field imported as their transactions' ledger codes
+type TransactionCoder interface {
+	TransactionCodeField() string
+}
+
+// TransactionCodeField returns the OFX field account's transaction codes are imported from. Empty if unset, which omits codes.
+func TransactionCodeField(account Account) string {
+	if coder, ok := account.(TransactionCoder); ok {
+		return coder.TransactionCodeField()
+	}
+	return ""
+}
+
+// ValidateTransactionCodeField returns an error if field is not a transaction code field. An empty field omits codes.
+func ValidateTransactionCodeField(field string) error {
+	switch field {
+	case "", CodeFieldCheckNumber, CodeFieldReferenceNumber:
+		return nil
+	default:
+		return errors.Errorf("Transaction code field must be %q or %q: %q", CodeFieldCheckNumber, CodeFieldReferenceNumber, field)
+	}
+}
+
+// CashTracker is implemented by accounts which can route their cash withdrawals into the cash wallet account, instead of categorizing them as spending
+type CashTracker interface {
+	TracksCash() bool
+}
+
+// TracksCash returns true if account opted in to routing its cash withdrawals into the cash wallet account
+func TracksCash(account Account) bool {
+	tracker, ok := account.(CashTracker)
+	return ok && tracker.TracksCash()
+}
+
+// TimeZoner is implemented by accounts which can set the time zone their institution's dates are in, as an IANA name like "America/Denver"
+type TimeZoner interface {
+	InstitutionTimeZone() string
+}
+
+// InstitutionTimeZone returns the IANA time zone account's institution-provided dates are in. Empty if unset, which uses the ledger's time zone.
+func InstitutionTimeZone(account Account) string {
+	if zoner, ok := account.(TimeZoner); ok {
+		return zoner.InstitutionTimeZone()
+	}
+	return ""
+}
+
+// ValidateTimeZone returns an error if name is not an IANA time zone name. An empty name uses the ledger's time zone.
+func ValidateTimeZone(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(name); err != nil || name == "Local" {
+		return errors.Errorf("Time zone must be an IANA time zone name, like \"America/Denver\": %q", name)
+	}
+	return nil
+}
+
+// Archiver is implemented by accounts which can be archived. Archived accounts are excluded from syncs.
+type Archiver interface {
+	IsArchived() bool
+	SetArchived(archived bool)
+}
+
+// IsArchived returns true if account has been archived
+func IsArchived(account Account) bool {
+	archiver, ok := account.(Archiver)
+	return ok && archiver.IsArchived()
+}
+
+// SyncBookmarker is implemented by accounts which record how far they have been synced.
+// A nil bookmark syncs from the ledger's most recent transaction. A zero bookmark re-fetches from the start of the ledger.
+type SyncBookmarker interface {
+	SyncBookmark() *time.Time
+	SetSyncBookmark(bookmark *time.Time)
+}
+
+// SyncBookmark returns account's sync bookmark, or nil if it has none
+func SyncBookmark(account Account) *time.Time {
+	if bookmarker, ok := account.(SyncBookmarker); ok {
+		return bookmarker.SyncBookmark()
+	}
+	return nil
+}
+
+// SyncSuccessRecorder is implemented by accounts which record when they last synced without errors
+type SyncSuccessRecorder interface {
+	LastSyncSuccessTime() *time.Time
+	SetLastSyncSuccessTime(t *time.Time)
+}
+
+// LastSyncSuccess returns when account last synced without errors, or nil if it never has
+func LastSyncSuccess(account Account) *time.Time {
+	if recorder, ok := account.(SyncSuccessRecorder); ok {
+		return recorder.LastSyncSuccessTime()
+	}
+	return nil
+}
+
+// Closer is implemented by accounts which can be closed. Closed accounts reject transactions dated after their closure date.
+type Closer interface {
+	ClosedDate() *time.Time
+	SetClosedDate(closed *time.Time)
+}
+
+// ClosedDate returns the date account was closed, or nil if it is open
+func ClosedDate(account Account) *time.Time {
+	if closer, ok := account.(Closer); ok {
+		return closer.ClosedDate()
+	}
+	return nil
+}
+
+// DisplayNamer is implemented by accounts with a human-friendly name for display, independent of their ledger account name
+type DisplayNamer interface {
+	DisplayName() string
+	SetDisplayName(name string)
+}
+
+// DisplayName returns account's display name, or its description if it has none
+func DisplayName(account Account) string {
+	if namer, ok := account.(DisplayNamer); ok {
+		if name := namer.DisplayName(); name != "" {
+			return name
+		}
+	}
+	return account.Description()
+}
+
 type BasicAccount struct {
 	AccountDescription string
+	AccountDisplayName string `json:",omitempty"`
 	AccountID          string
 	AccountType        string
 	BasicInstitution   BasicInstitution
+	BalanceAssertions  bool            `json:",omitempty"`
+	ZeroAmounts        string          `json:",omitempty"`
+	TimeZone           string          `json:",omitempty"`
+	CodeField          string          `json:",omitempty"`
+	TrackCash          bool            `json:",omitempty"`
+	Currency           *CurrencyFormat `json:",omitempty"`
+	Archived           bool            `json:",omitempty"`
+	LastSync           *time.Time      `json:",omitempty"`
+	LastSyncSuccess    *time.Time      `json:",omitempty"`
+	Closed             *time.Time      `json:",omitempty"`
 }
 
 func (b *BasicAccount) Institution() Institution {
@@ -55,6 +249,86 @@ func (b *BasicAccount) Type() string {
 	return b.AccountType
 }
 
+// AssertBalance implements BalanceAsserter
+func (b *BasicAccount) AssertBalance() bool {
+	return b.BalanceAssertions
+}
+
+// ZeroAmountPolicy implements ZeroAmountHandler
+func (b *BasicAccount) ZeroAmountPolicy() string {
+	return b.ZeroAmounts
+}
+
+// InstitutionTimeZone implements TimeZoner
+func (b *BasicAccount) InstitutionTimeZone() string {
+	return b.TimeZone
+}
+
+// TransactionCodeField implements TransactionCoder
+func (b *BasicAccount) TransactionCodeField() string {
+	return b.CodeField
+}
+
+// TracksCash implements CashTracker
+func (b *BasicAccount) TracksCash() bool {
+	return b.TrackCash
+}
+
+// CurrencyFormat implements CurrencyFormatter
+func (b *BasicAccount) CurrencyFormat() *CurrencyFormat {
+	return b.Currency
+}
+
+// IsArchived implements Archiver
+func (b *BasicAccount) IsArchived() bool {
+	return b.Archived
+}
+
+// SetArchived implements Archiver
+func (b *BasicAccount) SetArchived(archived bool) {
+	b.Archived = archived
+}
+
+// SyncBookmark implements SyncBookmarker
+func (b *BasicAccount) SyncBookmark() *time.Time {
+	return b.LastSync
+}
+
+// SetSyncBookmark implements SyncBookmarker
+func (b *BasicAccount) SetSyncBookmark(bookmark *time.Time) {
+	b.LastSync = bookmark
+}
+
+// LastSyncSuccessTime implements SyncSuccessRecorder
+func (b *BasicAccount) LastSyncSuccessTime() *time.Time {
+	return b.LastSyncSuccess
+}
+
+// SetLastSyncSuccessTime implements SyncSuccessRecorder
+func (b *BasicAccount) SetLastSyncSuccessTime(t *time.Time) {
+	b.LastSyncSuccess = t
+}
+
+// ClosedDate implements Closer
+func (b *BasicAccount) ClosedDate() *time.Time {
+	return b.Closed
+}
+
+// SetClosedDate implements Closer
+func (b *BasicAccount) SetClosedDate(closed *time.Time) {
+	b.Closed = closed
+}
+
+// DisplayName implements DisplayNamer
+func (b *BasicAccount) DisplayName() string {
+	return b.AccountDisplayName
+}
+
+// SetDisplayName implements DisplayNamer
+func (b *BasicAccount) SetDisplayName(name string) {
+	b.AccountDisplayName = name
+}
+
 func ValidatePartialAccount(account interface {
 	ID() string
 	Description() string
@@ -71,6 +345,14 @@ func ValidateAccount(account Account) error {
 	if !errs.ErrIf(account.Type() == "", "Account type must not be empty") {
 		errs.ErrIf(account.Type() != AssetAccount && account.Type() != LiabilityAccount, "Account type must be %q or %q: %q", AssetAccount, LiabilityAccount, account.Type())
 	}
+	if handler, ok := account.(ZeroAmountHandler); ok {
+		errs.AddErr(ValidateZeroAmountPolicy(handler.ZeroAmountPolicy()))
+	}
+	errs.AddErr(ValidateTimeZone(InstitutionTimeZone(account)))
+	errs.AddErr(ValidateTransactionCodeField(TransactionCodeField(account)))
+	if format := AccountCurrencyFormat(account); format != nil {
+		errs.AddErr(format.Validate())
+	}
 	errs.AddErr(ValidateInstitution(account.Institution()))
 	return errs.ErrOrNil()
 }
@@ -130,7 +412,7 @@ func ParseLedgerFormat(account string) (*LedgerAccountFormat, error) {
 
 func (l *LedgerAccountFormat) String() string {
 	result := ""
-	for _, s := range []string{l.AccountType, l.Institution, redactPrefix(l.AccountID), l.Remaining} {
+	for _, s := range []string{l.AccountType, l.Institution, RedactPrefix(l.AccountID), l.Remaining} {
 		if s != "" {
 			result += s + ":"
 		}
@@ -146,7 +428,8 @@ func LedgerAccountName(a Account) string {
 	return LedgerFormat(a).String()
 }
 
-func redactPrefix(s string) string {
+// RedactPrefix replaces all but the last few characters of 's' with stars, i.e. "12345678" becomes "****5678"
+func RedactPrefix(s string) string {
 	if s == "" {
 		return s
 	}
@@ -9,7 +9,7 @@ import (
 )
 
 func TestLedgerAccountFormat(t *testing.T) {
-	// NOTE: since this skips NewLedgerFormat, redactPrefix isn't being run
+	// NOTE: since this skips NewLedgerFormat, RedactPrefix isn't being run
 	for _, tc := range []struct {
 		description string
 		format      LedgerAccountFormat
@@ -44,6 +44,19 @@ func TestBaseAccount(t *testing.T) {
 	assert.Equal(t, "some description", a.Description())
 	assert.Equal(t, inst, a.Institution())
 	assert.Equal(t, "some type", a.Type())
+	assert.False(t, IsArchived(&a))
+	a.SetArchived(true)
+	assert.True(t, IsArchived(&a))
+}
+
+func TestDisplayName(t *testing.T) {
+	a := BasicAccount{AccountDescription: "some description", AccountID: "1234", AccountType: AssetAccount}
+	assert.Equal(t, "some description", DisplayName(&a), "Display name should fall back to the description")
+	ledgerName := LedgerAccountName(&a)
+
+	a.SetDisplayName("Everyday checking")
+	assert.Equal(t, "Everyday checking", DisplayName(&a))
+	assert.Equal(t, ledgerName, LedgerAccountName(&a), "Display names should not change the ledger account name")
 }
 
 func TestRedactPrefix(t *testing.T) {
@@ -55,7 +68,7 @@ func TestRedactPrefix(t *testing.T) {
 		{"smol", "****smol"},
 	} {
 		t.Run(fmt.Sprintf("#%d - %s", ix, tc.expected), func(t *testing.T) {
-			assert.Equal(t, tc.expected, redactPrefix(tc.str))
+			assert.Equal(t, tc.expected, RedactPrefix(tc.str))
 		})
 	}
 }
@@ -87,6 +100,16 @@ func TestValidateAccount(t *testing.T) {
 			account:     BasicAccount{AccountType: "not normal"},
 			errors:      []string{`Account type must be "assets" or "liabilities": "not normal"`},
 		},
+		{
+			description: "bad zero amount policy",
+			account:     BasicAccount{ZeroAmounts: "ignore"},
+			errors:      []string{`Zero amount policy must be "keep", "drop", or "tag": "ignore"`},
+		},
+		{
+			description: "bad time zone",
+			account:     BasicAccount{TimeZone: "Mars/Olympus_Mons"},
+			errors:      []string{`Time zone must be an IANA time zone name, like "America/Denver": "Mars/Olympus_Mons"`},
+		},
 	} {
 		t.Run(tc.description, func(t *testing.T) {
 			errs := ValidateAccount(&tc.account)
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Capability is a feature supported by an account's institution connector
+type Capability string
+
+// Known capabilities
+const (
+	CapabilityVerifySignon         Capability = "verify-signon"
+	CapabilityAccountDiscovery     Capability = "account-discovery"
+	CapabilityBalance              Capability = "balance"
+	CapabilityDocuments            Capability = "documents"
+	CapabilityClosingStatement     Capability = "closing-statement"
+	CapabilityTransfer             Capability = "transfer"
+	CapabilityIncrementalStatement Capability = "incremental-statement"
+)
+
+// Capabilities is a sorted set of capabilities
+type Capabilities []Capability
+
+// NewCapabilities returns a sorted set of 'capabilities'. Never returns nil, so it always encodes as a JSON array.
+func NewCapabilities(capabilities ...Capability) Capabilities {
+	set := make(map[Capability]bool, len(capabilities))
+	result := make(Capabilities, 0, len(capabilities))
+	for _, c := range capabilities {
+		if !set[c] {
+			set[c] = true
+			result = append(result, c)
+		}
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a] < result[b]
+	})
+	return result
+}
+
+// Has returns true if 'capability' is in the set
+func (c Capabilities) Has(capability Capability) bool {
+	for _, existing := range c {
+		if existing == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingCapabilityError is returned when a connector does not support the requested feature
+type MissingCapabilityError struct {
+	Capability Capability
+}
+
+func (e MissingCapabilityError) Error() string {
+	return fmt.Sprintf("Institution connector does not support %s", e.Capability)
+}
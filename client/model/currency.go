@@ -0,0 +1,141 @@
+package model
+
+import (
+	"strings"
+
+	sErrors "github.com/johnstarich/sage/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// DefaultCurrencyCode is the home currency when none is configured
+	DefaultCurrencyCode = "USD"
+
+	maxCurrencyDecimals = 4
+)
+
+// CurrencyFormat describes how to render amounts in a currency
+type CurrencyFormat struct {
+	// Code is the ISO 4217 currency code, like "USD"
+	Code string
+	// Decimals is the number of digits after the decimal point, like 2 for "USD" or 0 for "JPY"
+	Decimals int
+	// Symbol prefixes rendered amounts, like "$"
+	Symbol string
+}
+
+var knownCurrencies = map[string]CurrencyFormat{
+	"AUD": {Code: "AUD", Decimals: 2, Symbol: "A$"},
+	"CAD": {Code: "CAD", Decimals: 2, Symbol: "CA$"},
+	"CHF": {Code: "CHF", Decimals: 2, Symbol: "CHF"},
+	"CNY": {Code: "CNY", Decimals: 2, Symbol: "CN¥"},
+	"EUR": {Code: "EUR", Decimals: 2, Symbol: "€"},
+	"GBP": {Code: "GBP", Decimals: 2, Symbol: "£"},
+	"INR": {Code: "INR", Decimals: 2, Symbol: "₹"},
+	"JPY": {Code: "JPY", Decimals: 0, Symbol: "¥"},
+	"KRW": {Code: "KRW", Decimals: 0, Symbol: "₩"},
+	"MXN": {Code: "MXN", Decimals: 2, Symbol: "MX$"},
+	"USD": {Code: "USD", Decimals: 2, Symbol: "$"},
+}
+
+// NewCurrencyFormat returns the usual format for ISO 4217 currency 'code'. Unrecognized codes use 2 decimals and the code as the symbol.
+func NewCurrencyFormat(code string) CurrencyFormat {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if format, ok := knownCurrencies[code]; ok {
+		return format
+	}
+	return CurrencyFormat{Code: code, Decimals: 2, Symbol: code}
+}
+
+// LedgerCurrencyFormat returns the format for a ledger posting's currency, like "$" for postings imported with an OFX CURDEF of "USD".
+// Returns false if the currency is neither a known currency symbol, like "$" or "€", nor an ISO 4217 code.
+func LedgerCurrencyFormat(currency string) (CurrencyFormat, bool) {
+	for _, format := range knownCurrencies {
+		if currency == format.Symbol {
+			return format, true
+		}
+	}
+	if !isCurrencyCode(currency) {
+		return CurrencyFormat{}, false
+	}
+	return NewCurrencyFormat(currency), true
+}
+
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate returns an error if the format's code isn't an ISO 4217 code, or it has an unusable decimals or symbol
+func (f CurrencyFormat) Validate() error {
+	var errs sErrors.Errors
+	errs.ErrIf(!isCurrencyCode(f.Code), "Currency code must be a 3 letter ISO 4217 code, like \"USD\": %q", f.Code)
+	errs.ErrIf(f.Decimals < 0 || f.Decimals > maxCurrencyDecimals, "Currency decimals must be between 0 and %d: %d", maxCurrencyDecimals, f.Decimals)
+	errs.ErrIf(strings.ContainsAny(f.Symbol, "\n\t;0123456789-"), "Currency symbol must not contain digits, minus signs, semicolons, or whitespace other than spaces: %q", f.Symbol)
+	return errs.ErrOrNil()
+}
+
+// Fixed renders 'amount' rounded to the currency's decimals without a symbol, for machine-readable text like CSV files
+func (f CurrencyFormat) Fixed(amount decimal.Decimal) string {
+	return amount.StringFixed(int32(f.Decimals))
+}
+
+// Format renders 'amount' rounded to the currency's decimals with its symbol, like "-$1.50" or "CHF 2.00"
+func (f CurrencyFormat) Format(amount decimal.Decimal) string {
+	sign := ""
+	if amount.IsNegative() {
+		sign = "-"
+		amount = amount.Neg()
+	}
+	return sign + f.PrefixSymbol() + f.Fixed(amount)
+}
+
+// PrefixSymbol returns the text to prefix amounts with, like "$" or "CHF ". Uses the currency code if the symbol is empty.
+func (f CurrencyFormat) PrefixSymbol() string {
+	symbol := f.Symbol
+	if symbol == "" {
+		symbol = f.Code
+	}
+	if isCurrencyCode(symbol) {
+		// codes need a space to stay readable, like "CHF 2.00"
+		symbol += " "
+	}
+	return symbol
+}
+
+// CurrencyFormatter is implemented by accounts which can set the currency their amounts are rendered in
+type CurrencyFormatter interface {
+	CurrencyFormat() *CurrencyFormat
+}
+
+// AccountCurrencyFormat returns account's explicitly set currency format, or nil if unset
+func AccountCurrencyFormat(account Account) *CurrencyFormat {
+	if formatter, ok := account.(CurrencyFormatter); ok {
+		return formatter.CurrencyFormat()
+	}
+	return nil
+}
+
+// ResolveCurrencyFormat returns account's currency format if set. Otherwise derives one from 'ledgerCurrency', the currency of the account's ledger postings, before falling back to 'home'.
+// A nil account only uses the ledger currency and home currency.
+func ResolveCurrencyFormat(account Account, ledgerCurrency string, home CurrencyFormat) CurrencyFormat {
+	if account != nil {
+		if format := AccountCurrencyFormat(account); format != nil {
+			return *format
+		}
+	}
+	if format, ok := LedgerCurrencyFormat(ledgerCurrency); ok {
+		if format.Code == home.Code {
+			return home
+		}
+		return format
+	}
+	return home
+}
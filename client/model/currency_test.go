@@ -0,0 +1,75 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrencyFormat(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		code        string
+		amount      float64
+		expected    CurrencyFormat
+		fixed       string
+		formatted   string
+	}{
+		{
+			description: "dollars",
+			code:        "usd",
+			amount:      -1.5,
+			expected:    CurrencyFormat{Code: "USD", Decimals: 2, Symbol: "$"},
+			fixed:       "-1.50",
+			formatted:   "-$1.50",
+		},
+		{
+			description: "yen have no decimals",
+			code:        "JPY",
+			amount:      1234.56,
+			expected:    CurrencyFormat{Code: "JPY", Decimals: 0, Symbol: "¥"},
+			fixed:       "1235",
+			formatted:   "¥1235",
+		},
+		{
+			description: "unknown code",
+			code:        "SEK",
+			amount:      2,
+			expected:    CurrencyFormat{Code: "SEK", Decimals: 2, Symbol: "SEK"},
+			fixed:       "2.00",
+			formatted:   "SEK 2.00",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			format := NewCurrencyFormat(tc.code)
+			assert.Equal(t, tc.expected, format)
+			assert.NoError(t, format.Validate())
+			amount := decimal.NewFromFloat(tc.amount)
+			assert.Equal(t, tc.fixed, format.Fixed(amount))
+			assert.Equal(t, tc.formatted, format.Format(amount))
+		})
+	}
+}
+
+func TestCurrencyFormatValidate(t *testing.T) {
+	assert.Error(t, CurrencyFormat{Code: "dollars", Decimals: 2}.Validate())
+	assert.Error(t, CurrencyFormat{Code: "USD", Decimals: -1}.Validate())
+	assert.Error(t, CurrencyFormat{Code: "USD", Decimals: 2, Symbol: "$;"}.Validate())
+}
+
+func TestResolveCurrencyFormat(t *testing.T) {
+	home := CurrencyFormat{Code: "EUR", Decimals: 2, Symbol: "EUR"}
+	euros := NewCurrencyFormat("EUR")
+	yen := NewCurrencyFormat("JPY")
+	account := &BasicAccount{}
+	assert.Equal(t, home, ResolveCurrencyFormat(account, "", home), "Accounts without postings or metadata use the home currency")
+	assert.Equal(t, home, ResolveCurrencyFormat(nil, "EUR", home), "Postings in the home currency use the home currency's format")
+	assert.Equal(t, yen, ResolveCurrencyFormat(account, "JPY", home))
+	assert.Equal(t, NewCurrencyFormat("USD"), ResolveCurrencyFormat(account, "$", home))
+	assert.Equal(t, NewCurrencyFormat("GBP"), ResolveCurrencyFormat(account, "£", home), "Postings may use a currency symbol instead of a code")
+	assert.Equal(t, home, ResolveCurrencyFormat(account, "shares", home), "Non-currency commodities use the home currency")
+
+	account.Currency = &euros
+	assert.Equal(t, euros, ResolveCurrencyFormat(account, "JPY", home), "Explicit metadata takes precedence")
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	sErrors "github.com/johnstarich/sage/errors"
+)
+
+// ManualAccount is tracked by hand with balance snapshots, instead of syncing transactions from an institution.
+// Useful for cash or accounts without OFX support, like a retirement account checked quarterly.
+type ManualAccount struct {
+	BasicAccount
+	// Manual identifies manual accounts when unmarshaling, it is always true
+	Manual bool
+}
+
+// NewManualAccount returns a manual account of 'accountType' held at 'institution'
+func NewManualAccount(id, description, accountType, institution string) *ManualAccount {
+	return &ManualAccount{
+		BasicAccount: BasicAccount{
+			AccountDescription: description,
+			AccountID:          id,
+			AccountType:        accountType,
+			BasicInstitution: BasicInstitution{
+				InstDescription: institution,
+				InstOrg:         institution,
+			},
+		},
+		Manual: true,
+	}
+}
+
+// IsManual returns true if account is tracked by hand
+func IsManual(account Account) bool {
+	_, ok := account.(*ManualAccount)
+	return ok
+}
+
+// ValidateManualAccount checks account for invalid data. Manual accounts never connect to their institution, so it only needs a name.
+func ValidateManualAccount(account *ManualAccount) error {
+	var errs sErrors.Errors
+	errs.AddErr(ValidatePartialAccount(account))
+	if !errs.ErrIf(account.Type() == "", "Account type must not be empty") {
+		errs.ErrIf(account.Type() != AssetAccount && account.Type() != LiabilityAccount, "Account type must be %q or %q: %q", AssetAccount, LiabilityAccount, account.Type())
+	}
+	errs.ErrIf(account.Institution().Description() == "", "Institution name must not be empty")
+	errs.ErrIf(account.Institution().Org() == "", "Institution org must not be empty")
+	return errs.ErrOrNil()
+}
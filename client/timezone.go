@@ -0,0 +1,71 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+)
+
+var (
+	ledgerTimeZoneMu sync.Mutex
+	ledgerTimeZone   = time.UTC
+)
+
+// SetLedgerTimeZone sets the time zone posting dates are in, when converting from institutions in other time zones
+func SetLedgerTimeZone(loc *time.Location) {
+	ledgerTimeZoneMu.Lock()
+	ledgerTimeZone = loc
+	ledgerTimeZoneMu.Unlock()
+}
+
+// LedgerTimeZone returns the time zone posting dates are in. Defaults to UTC.
+func LedgerTimeZone() *time.Location {
+	ledgerTimeZoneMu.Lock()
+	defer ledgerTimeZoneMu.Unlock()
+	return ledgerTimeZone
+}
+
+// LocalizeDates returns copies of txns where dates without a UTC offset from accounts with a time zone are converted into the ledger's time zone.
+// OFX parsing reads dates without an offset as GMT, so any date with a zero offset is treated as a wall clock time in the account's time zone.
+// Accounts without a time zone keep their dates, since those dates are already read in the ledger's time zone.
+func LocalizeDates(txns []ledger.Transaction, accounts []model.Account) []ledger.Transaction {
+	locations := make(map[string]*time.Location)
+	for _, account := range accounts {
+		if name := model.InstitutionTimeZone(account); name != "" {
+			if loc, err := time.LoadLocation(name); err == nil {
+				locations[model.LedgerAccountName(account)] = loc
+			}
+		}
+	}
+	if len(locations) == 0 {
+		return txns
+	}
+
+	ledgerLoc := LedgerTimeZone()
+	localized := make([]ledger.Transaction, len(txns))
+	for i, txn := range txns {
+		if len(txn.Postings) > 0 {
+			if loc, ok := locations[txn.Postings[0].Account]; ok {
+				txn.Date = localizeDate(txn.Date, loc, ledgerLoc)
+			}
+		}
+		localized[i] = txn
+	}
+	return localized
+}
+
+// localizeDate reads t as a wall clock time in 'from' and returns its date in 'to', at midnight UTC like parsed ledger dates.
+// Dates with an offset or no time of day are returned as-is, since date-only values already name the posting date.
+func localizeDate(t time.Time, from, to *time.Location) time.Time {
+	if _, offset := t.Zone(); offset != 0 {
+		return t
+	}
+	hour, min, sec := t.Clock()
+	if hour == 0 && min == 0 && sec == 0 && t.Nanosecond() == 0 {
+		return t
+	}
+	local := time.Date(t.Year(), t.Month(), t.Day(), hour, min, sec, t.Nanosecond(), from).In(to)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
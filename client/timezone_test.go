@@ -0,0 +1,120 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	require.NoError(t, err)
+	return loc
+}
+
+func TestLocalizeDate(t *testing.T) {
+	gmt := time.FixedZone("GMT", 0)
+	naive := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, gmt)
+	}
+	for _, tc := range []struct {
+		description string
+		date        time.Time
+		from, to    string
+		expect      time.Time
+	}{
+		{
+			description: "late evening in the ledger's time zone is the previous day at the institution",
+			date:        naive(2020, time.January, 4, 3, 30),
+			from:        "UTC",
+			to:          "America/Los_Angeles",
+			expect:      parseDate("2020/01/03"),
+		},
+		{
+			description: "late evening at the institution is the next day in the ledger's time zone",
+			date:        naive(2020, time.January, 3, 20, 0),
+			from:        "America/Los_Angeles",
+			to:          "UTC",
+			expect:      parseDate("2020/01/04"),
+		},
+		{
+			description: "same day",
+			date:        naive(2020, time.January, 3, 12, 0),
+			from:        "UTC",
+			to:          "America/Los_Angeles",
+			expect:      parseDate("2020/01/03"),
+		},
+		{
+			description: "before daylight saving time starts",
+			date:        naive(2020, time.March, 8, 6, 30), // 23:30 MST
+			from:        "UTC",
+			to:          "America/Denver",
+			expect:      parseDate("2020/03/07"),
+		},
+		{
+			description: "after daylight saving time starts",
+			date:        naive(2020, time.March, 9, 6, 30), // 00:30 MDT, would be 23:30 in MST
+			from:        "UTC",
+			to:          "America/Denver",
+			expect:      parseDate("2020/03/09"),
+		},
+		{
+			description: "explicit offsets are kept",
+			date:        time.Date(2020, time.January, 4, 3, 30, 0, 0, time.FixedZone("EST", -5*60*60)),
+			from:        "UTC",
+			to:          "America/Los_Angeles",
+			expect:      time.Date(2020, time.January, 4, 3, 30, 0, 0, time.FixedZone("EST", -5*60*60)),
+		},
+		{
+			description: "date-only values are kept",
+			date:        naive(2020, time.January, 4, 0, 0),
+			from:        "UTC",
+			to:          "America/Los_Angeles",
+			expect:      naive(2020, time.January, 4, 0, 0),
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			date := localizeDate(tc.date, loadLocation(t, tc.from), loadLocation(t, tc.to))
+			assert.Equal(t, tc.expect, date)
+		})
+	}
+}
+
+func TestLocalizeDates(t *testing.T) {
+	defer SetLedgerTimeZone(time.UTC)
+	SetLedgerTimeZone(loadLocation(t, "America/Los_Angeles"))
+	newAccount := func(id, timeZone string) *model.BasicAccount {
+		return &model.BasicAccount{
+			AccountID:        id,
+			AccountType:      model.AssetAccount,
+			BasicInstitution: model.BasicInstitution{InstDescription: "some org"},
+			TimeZone:         timeZone,
+		}
+	}
+	utc := newAccount("1111", "UTC")
+	unset := newAccount("2222", "")
+	lateNight := time.Date(2020, time.January, 4, 3, 30, 0, 0, time.FixedZone("GMT", 0))
+	txnFor := func(account model.Account) ledger.Transaction {
+		return ledger.Transaction{
+			Date:  lateNight,
+			Payee: "dinner",
+			Postings: []ledger.Posting{
+				{Account: model.LedgerAccountName(account), Amount: decimal.New(-1, 0)},
+				{Account: model.Uncategorized, Amount: decimal.New(1, 0)},
+			},
+		}
+	}
+	txns := []ledger.Transaction{txnFor(utc), txnFor(unset)}
+
+	localized := LocalizeDates(txns, []model.Account{utc, unset})
+	require.Len(t, localized, 2)
+	assert.Equal(t, parseDate("2020/01/03"), localized[0].Date)
+	assert.Equal(t, lateNight, localized[1].Date, "Accounts without a time zone should keep their dates")
+	assert.Equal(t, lateNight, txns[0].Date, "Original transactions should not be modified")
+}
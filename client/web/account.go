@@ -2,6 +2,7 @@ package web
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/johnstarich/sage/client/model"
 	"github.com/johnstarich/sage/redactor"
@@ -16,8 +17,19 @@ type Account interface {
 type webAccount struct {
 	AccountID          string
 	AccountDescription string
+	AccountDisplayName string `json:",omitempty"`
 	AccountType        string
 	WebConnect         driverContainer
+	BalanceAssertions  bool                  `json:",omitempty"`
+	ZeroAmounts        string                `json:",omitempty"`
+	TimeZone           string                `json:",omitempty"`
+	CodeField          string                `json:",omitempty"`
+	TrackCash          bool                  `json:",omitempty"`
+	Currency           *model.CurrencyFormat `json:",omitempty"`
+	Archived           bool                  `json:",omitempty"`
+	LastSync           *time.Time            `json:",omitempty"`
+	LastSyncSuccess    *time.Time            `json:",omitempty"`
+	Closed             *time.Time            `json:",omitempty"`
 }
 
 func (w *webAccount) ID() string {
@@ -28,6 +40,14 @@ func (w *webAccount) Description() string {
 	return w.AccountDescription
 }
 
+func (w *webAccount) DisplayName() string {
+	return w.AccountDisplayName
+}
+
+func (w *webAccount) SetDisplayName(name string) {
+	w.AccountDisplayName = name
+}
+
 func (w *webAccount) Institution() model.Institution {
 	return w.WebConnect.Data
 }
@@ -36,6 +56,62 @@ func (w *webAccount) Type() string {
 	return w.AccountType
 }
 
+func (w *webAccount) AssertBalance() bool {
+	return w.BalanceAssertions
+}
+
+func (w *webAccount) ZeroAmountPolicy() string {
+	return w.ZeroAmounts
+}
+
+func (w *webAccount) InstitutionTimeZone() string {
+	return w.TimeZone
+}
+
+func (w *webAccount) TransactionCodeField() string {
+	return w.CodeField
+}
+
+func (w *webAccount) TracksCash() bool {
+	return w.TrackCash
+}
+
+func (w *webAccount) CurrencyFormat() *model.CurrencyFormat {
+	return w.Currency
+}
+
+func (w *webAccount) IsArchived() bool {
+	return w.Archived
+}
+
+func (w *webAccount) SetArchived(archived bool) {
+	w.Archived = archived
+}
+
+func (w *webAccount) SyncBookmark() *time.Time {
+	return w.LastSync
+}
+
+func (w *webAccount) SetSyncBookmark(bookmark *time.Time) {
+	w.LastSync = bookmark
+}
+
+func (w *webAccount) LastSyncSuccessTime() *time.Time {
+	return w.LastSyncSuccess
+}
+
+func (w *webAccount) SetLastSyncSuccessTime(t *time.Time) {
+	w.LastSyncSuccess = t
+}
+
+func (w *webAccount) ClosedDate() *time.Time {
+	return w.Closed
+}
+
+func (w *webAccount) SetClosedDate(closed *time.Time) {
+	w.Closed = closed
+}
+
 type driverContainer struct {
 	Driver string
 	Data   Connector
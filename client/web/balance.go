@@ -0,0 +1,29 @@
+package web
+
+import (
+	"context"
+	"time"
+
+	"github.com/johnstarich/sage/prompter"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// BalanceRequestor fetches an account's current balance from an institution's website, without downloading a statement
+type BalanceRequestor interface {
+	Balance(accountID string, browser Browser, prompt prompter.Prompter) (amount decimal.Decimal, asOf time.Time, err error)
+}
+
+// Balance fetches the current balance for 'accountID'. Fails if the connector's driver can't fetch balances on their own, or if 'ctx' is done first.
+// Balance refreshes can't be answered by the user, so any driver prompt waits until 'ctx' is done.
+func Balance(ctx context.Context, connector Connector, accountID string) (decimal.Decimal, time.Time, error) {
+	requestor, ok := connector.(BalanceRequestor)
+	if !ok {
+		return decimal.Zero, time.Time{}, errors.Errorf("Institution driver does not support balance refresh: %q", connector.Driver())
+	}
+	browser, err := NewBrowser(ctx, BrowserConfig{})
+	if err != nil {
+		return decimal.Zero, time.Time{}, err
+	}
+	return requestor.Balance(accountID, browser, prompter.New())
+}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/aclindsa/ofxgo"
@@ -13,6 +14,9 @@ import (
 	"github.com/johnstarich/sage/redactor"
 )
 
+// fitIDCleaner matches client.MakeUniqueTxnID's cleanup of transaction IDs
+var fitIDCleaner = strings.NewReplacer(",", "", ":", "")
+
 // Connector downloads statements from an institution's website
 type Connector interface {
 	model.Institution
@@ -26,6 +30,13 @@ type Requestor interface {
 	Statement(start, end time.Time, accountID string, browser Browser, prompt prompter.Prompter) (*ofxgo.Response, error)
 }
 
+// MerchantRequestor is implemented by drivers which scrape structured merchant details alongside their statements
+type MerchantRequestor interface {
+	// MerchantStatement is like Statement, but also returns merchant details keyed by each transaction's FITID.
+	// Transactions without merchant details may be omitted.
+	MerchantStatement(start, end time.Time, accountID string, browser Browser, prompt prompter.Prompter) (*ofxgo.Response, map[string]ledger.Merchant, error)
+}
+
 // CredConnector is used by a Driver to create a full Connector
 type CredConnector interface {
 	// Driver is the name of the driver
@@ -122,11 +133,12 @@ func fetchTransactions(
 ) ([]ledger.Transaction, error) {
 	var allTxns []ledger.Transaction
 	for _, account := range accountIDs {
-		resp, err := connector.Statement(start, end, account, browser, prompt)
+		resp, merchants, err := statement(connector, start, end, account, browser, prompt)
 		if err != nil {
 			return allTxns, err
 		}
 		_, txns, err := parser(resp)
+		applyMerchants(resp, txns, merchants)
 		allTxns = append(allTxns, txns...)
 		if err != nil {
 			return allTxns, err
@@ -134,3 +146,49 @@ func fetchTransactions(
 	}
 	return allTxns, nil
 }
+
+func statement(connector Connector, start, end time.Time, accountID string, browser Browser, prompt prompter.Prompter) (*ofxgo.Response, map[string]ledger.Merchant, error) {
+	if requestor, ok := connector.(MerchantRequestor); ok {
+		return requestor.MerchantStatement(start, end, accountID, browser, prompt)
+	}
+	resp, err := connector.Statement(start, end, accountID, browser, prompt)
+	return resp, nil, err
+}
+
+// applyMerchants adds merchant details to each of txns parsed from resp with a matching FITID
+func applyMerchants(resp *ofxgo.Response, txns []ledger.Transaction, merchants map[string]ledger.Merchant) {
+	if resp == nil || len(merchants) == 0 {
+		return
+	}
+	// imported IDs combine the FID, account ID, and FITID, matching client.MakeUniqueTxnID
+	fid := resp.Signon.Fid.String()
+	byID := make(map[string]ledger.Merchant)
+	addStatement := func(accountID string, tranList *ofxgo.TransactionList) {
+		if tranList == nil {
+			return
+		}
+		for _, txn := range tranList.Transactions {
+			if merchant, ok := merchants[txn.FiTID.String()]; ok && !merchant.IsEmpty() {
+				byID[fitIDCleaner.Replace(fid+"-"+accountID+"-"+txn.FiTID.String())] = merchant
+			}
+		}
+	}
+	for _, message := range resp.Bank {
+		if statement, ok := message.(*ofxgo.StatementResponse); ok {
+			addStatement(statement.BankAcctFrom.AcctID.String(), statement.BankTranList)
+		}
+	}
+	for _, message := range resp.CreditCard {
+		if statement, ok := message.(*ofxgo.CCStatementResponse); ok {
+			addStatement(statement.CCAcctFrom.AcctID.String(), statement.BankTranList)
+		}
+	}
+	for i := range txns {
+		if len(txns[i].Postings) == 0 {
+			continue
+		}
+		if merchant, ok := byID[txns[i].Postings[0].ID()]; ok {
+			txns[i].SetMerchant(merchant)
+		}
+	}
+}
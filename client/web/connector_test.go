@@ -0,0 +1,43 @@
+package web
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aclindsa/ofxgo"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyMerchants(t *testing.T) {
+	resp := &ofxgo.Response{
+		Signon: ofxgo.SignonResponse{Fid: "1234"},
+		CreditCard: []ofxgo.Message{&ofxgo.CCStatementResponse{
+			CCAcctFrom: ofxgo.CCAcct{AcctID: "5678"},
+			BankTranList: &ofxgo.TransactionList{Transactions: []ofxgo.Transaction{
+				{FiTID: "a:1"},
+				{FiTID: "b"},
+			}},
+		}},
+	}
+	makeTxn := func(id string) ledger.Transaction {
+		return ledger.Transaction{
+			Date:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Payee: "RAW PAYEE " + id,
+			Postings: []ledger.Posting{
+				{Account: "liabilities:some card", Tags: map[string]string{"id": id}},
+				{Account: "uncategorized"},
+			},
+		}
+	}
+	txns := []ledger.Transaction{makeTxn("1234-5678-a1"), makeTxn("1234-5678-b")}
+
+	applyMerchants(resp, txns, map[string]ledger.Merchant{
+		"a:1": {Name: "Clean Name", City: "Austin"},
+	})
+	assert.Equal(t, "Clean Name", txns[0].Payee)
+	assert.Equal(t, "RAW PAYEE 1234-5678-a1", txns[0].RawPayee())
+	assert.Equal(t, "Austin", txns[0].Merchant().City)
+	assert.Equal(t, "RAW PAYEE 1234-5678-b", txns[1].Payee, "Transactions without merchant details should be unchanged")
+	assert.Nil(t, txns[1].Tags)
+}
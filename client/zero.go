@@ -0,0 +1,55 @@
+package client
+
+import (
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+)
+
+// FilterZeroAmounts applies each account's zero-amount policy to its transactions, which some institutions send as informational memos.
+// Returns the remaining transactions, including tagged ones, and the dropped transactions. Balance assertions are always kept.
+func FilterZeroAmounts(txns []ledger.Transaction, accounts []model.Account) (kept, dropped []ledger.Transaction) {
+	policies := make(map[string]string)
+	for _, account := range accounts {
+		if policy := model.ZeroAmountPolicy(account); policy != model.ZeroAmountKeep {
+			policies[model.LedgerAccountName(account)] = policy
+		}
+	}
+	if len(policies) == 0 {
+		return txns, nil
+	}
+
+	kept = make([]ledger.Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if !isZeroAmount(txn) {
+			kept = append(kept, txn)
+			continue
+		}
+		switch policies[txn.Postings[0].Account] {
+		case model.ZeroAmountDrop:
+			dropped = append(dropped, txn)
+		case model.ZeroAmountTagged:
+			tags := make(map[string]string, len(txn.Tags)+1)
+			for key, value := range txn.Tags {
+				tags[key] = value
+			}
+			tags[model.ZeroAmountTag] = "true"
+			txn.Tags = tags
+			kept = append(kept, txn)
+		default:
+			kept = append(kept, txn)
+		}
+	}
+	return kept, dropped
+}
+
+func isZeroAmount(txn ledger.Transaction) bool {
+	if len(txn.Postings) == 0 || ledger.IsBalanceAssertion(txn) {
+		return false
+	}
+	for _, p := range txn.Postings {
+		if !p.Amount.IsZero() {
+			return false
+		}
+	}
+	return true
+}
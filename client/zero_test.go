@@ -0,0 +1,54 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterZeroAmounts(t *testing.T) {
+	newAccount := func(id, policy string) *model.BasicAccount {
+		return &model.BasicAccount{
+			AccountID:        id,
+			AccountType:      model.AssetAccount,
+			BasicInstitution: model.BasicInstitution{InstDescription: "some org"},
+			ZeroAmounts:      policy,
+		}
+	}
+	keep := newAccount("1111", "")
+	drop := newAccount("2222", model.ZeroAmountDrop)
+	tag := newAccount("3333", model.ZeroAmountTagged)
+	txnFor := func(account model.Account, amount int64) ledger.Transaction {
+		return ledger.Transaction{
+			Date:  parseDate("2020/01/01"),
+			Payee: "memo",
+			Postings: []ledger.Posting{
+				{Account: model.LedgerAccountName(account), Amount: decimal.New(amount, 0)},
+				{Account: model.Uncategorized, Amount: decimal.New(-amount, 0)},
+			},
+		}
+	}
+	dropAssertion := ledger.NewBalanceAssertion(model.LedgerAccountName(drop), parseDate("2020/01/01"), decimal.Zero, "$")
+
+	txns := []ledger.Transaction{
+		txnFor(keep, 0),
+		txnFor(drop, 0),
+		txnFor(drop, 1),
+		txnFor(tag, 0),
+		txnFor(tag, 1),
+		dropAssertion,
+	}
+	kept, dropped := FilterZeroAmounts(txns, []model.Account{keep, drop, tag})
+	assert.Equal(t, []ledger.Transaction{txns[1]}, dropped)
+	tagged := txns[3]
+	tagged.Tags = map[string]string{model.ZeroAmountTag: "true"}
+	assert.Equal(t, []ledger.Transaction{txns[0], txns[2], tagged, txns[4], dropAssertion}, kept)
+	assert.Empty(t, txns[3].Tags, "Original transactions should not be modified")
+
+	kept, dropped = FilterZeroAmounts(txns, []model.Account{keep})
+	assert.Equal(t, txns, kept, "Keep should be the default policy")
+	assert.Empty(t, dropped)
+}
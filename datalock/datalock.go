@@ -0,0 +1,256 @@
+// Package datalock prevents multiple Sage processes from writing to the same data directory
+package datalock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FileName is the lock file's name inside the data directory. Hidden to keep it out of version control.
+	FileName = ".sage.lock"
+
+	// DefaultKeepAliveInterval is how often a held lock's Updated time should be refreshed
+	DefaultKeepAliveInterval = time.Minute
+)
+
+var (
+	// ErrReleased is returned when asserting a lock which has been released
+	ErrReleased = errors.New("Data directory lock was released")
+)
+
+// Owner identifies the process holding a lock
+type Owner struct {
+	PID      int
+	Hostname string
+	Acquired time.Time
+	Updated  time.Time
+}
+
+func (o Owner) String() string {
+	return fmt.Sprintf("PID %d on host %q since %s", o.PID, o.Hostname, o.Acquired.Format(time.RFC3339))
+}
+
+func (o Owner) same(other Owner) bool {
+	return o.PID == other.PID && o.Hostname == other.Hostname && o.Acquired.Equal(other.Acquired)
+}
+
+// HeldError is returned when another process holds the lock
+type HeldError struct {
+	Path  string
+	Owner Owner
+}
+
+func (e HeldError) Error() string {
+	return fmt.Sprintf("Data directory is locked by %s. Stop the other Sage instance, or start in read-only mode. Lock file: %s", e.Owner, e.Path)
+}
+
+// Options configure how a lock is acquired
+type Options struct {
+	// TakeoverAge allows taking over locks held by other hosts, or by this host with our own PID, which have not been updated within this duration. Zero disables takeover.
+	TakeoverAge time.Duration
+}
+
+// Lock is an exclusive lock on a data directory
+type Lock struct {
+	mu       sync.Mutex
+	path     string
+	owner    Owner
+	released bool
+	stop     chan struct{}
+
+	now          func() time.Time
+	processAlive func(pid int) bool
+}
+
+// Acquire creates a lock file in 'dir'. Returns a HeldError if another live process holds it.
+// Stale locks are taken over if their process is no longer running on this host, or if they are older than opts.TakeoverAge and held by another host or our own PID.
+func Acquire(dir string, opts Options) (*Lock, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return acquire(dir, opts, os.Getpid(), hostname, time.Now, processAlive)
+}
+
+func acquire(dir string, opts Options, pid int, hostname string, now func() time.Time, isAlive func(int) bool) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	lock := &Lock{
+		path:         filepath.Join(dir, FileName),
+		stop:         make(chan struct{}),
+		now:          now,
+		processAlive: isAlive,
+	}
+	acquired := now()
+	lock.owner = Owner{PID: pid, Hostname: hostname, Acquired: acquired, Updated: acquired}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := lock.create()
+		if !os.IsExist(err) {
+			return lock, err
+		}
+		holder, err := readOwner(lock.path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Data directory lock file is unreadable, remove it if no other Sage instance is running: %s", lock.path)
+		}
+		if !lock.stale(holder, opts) {
+			return nil, HeldError{Path: lock.path, Owner: holder}
+		}
+		if err := os.Remove(lock.path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, errors.Errorf("Failed to take over stale data directory lock: %s", lock.path)
+}
+
+func (l *Lock) create() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(file).Encode(l.owner)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(l.path)
+	}
+	return err
+}
+
+// stale returns true if 'holder' no longer holds a valid lock
+func (l *Lock) stale(holder Owner, opts Options) bool {
+	if holder.Hostname == l.owner.Hostname {
+		if holder.PID != l.owner.PID {
+			return !l.processAlive(holder.PID)
+		}
+		// a matching PID may be a previous run or a live process in another container, e.g. both PID 1
+	}
+	return opts.TakeoverAge > 0 && l.now().Sub(holder.Updated) > opts.TakeoverAge
+}
+
+func readOwner(path string) (Owner, error) {
+	var owner Owner
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return owner, err
+	}
+	err = json.Unmarshal(b, &owner)
+	return owner, err
+}
+
+// Owner returns the identity of this lock's holder
+func (l *Lock) Owner() Owner {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.owner
+}
+
+// AssertHeld returns an error if this lock was released or taken over by another process
+func (l *Lock) AssertHeld() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.assertHeld()
+}
+
+func (l *Lock) assertHeld() error {
+	if l.released {
+		return ErrReleased
+	}
+	holder, err := readOwner(l.path)
+	if os.IsNotExist(err) {
+		return errors.Errorf("Data directory lock file was removed: %s", l.path)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Failed to read data directory lock")
+	}
+	if !holder.same(l.owner) {
+		return HeldError{Path: l.path, Owner: holder}
+	}
+	return nil
+}
+
+// KeepAlive refreshes the lock's Updated time every 'interval' until the lock is released, preventing takeover by other hosts
+func (l *Lock) KeepAlive(interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				if err := l.refresh(); err != nil {
+					onErr(err)
+				}
+			}
+		}
+	}()
+}
+
+func (l *Lock) refresh() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.assertHeld(); err != nil {
+		return err
+	}
+	owner := l.owner
+	owner.Updated = l.now()
+	b, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	tmpPath := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, l.path); err != nil {
+		return err
+	}
+	l.owner = owner
+	return nil
+}
+
+// Release removes the lock file, allowing other processes to acquire it. Safe to call more than once.
+func (l *Lock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return nil
+	}
+	err := l.assertHeld()
+	l.released = true
+	close(l.stop)
+	if err != nil {
+		// don't remove a lock taken over by another process
+		return err
+	}
+	return os.Remove(l.path)
+}
+
+// ReadOnlyGuard returns a write guard which always fails, naming the lock's holder
+func ReadOnlyGuard(holder Owner) func() error {
+	return func() error {
+		return errors.Errorf("Sage is in read-only mode, the data directory is locked by %s", holder)
+	}
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	// permission errors mean the process exists, but is owned by another user
+	return err == nil || os.IsPermission(err)
+}
@@ -0,0 +1,215 @@
+package datalock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	return dir
+}
+
+func alive(pids ...int) func(int) bool {
+	return func(pid int) bool {
+		for _, p := range pids {
+			if p == pid {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	someTime := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return someTime }
+	laterNow := func() time.Time { return someTime.Add(2 * time.Hour) }
+
+	for _, tc := range []struct {
+		description string
+		holder      *Owner
+		opts        Options
+		pid         int
+		hostname    string
+		now         func() time.Time
+		alive       func(int) bool
+		expectHeld  bool
+	}{
+		{
+			description: "no lock",
+			pid:         1,
+			hostname:    "host",
+			now:         now,
+			alive:       alive(),
+		},
+		{
+			description: "held by live process on same host",
+			holder:      &Owner{PID: 2, Hostname: "host", Acquired: someTime, Updated: someTime},
+			pid:         1,
+			hostname:    "host",
+			now:         now,
+			alive:       alive(2),
+			expectHeld:  true,
+		},
+		{
+			description: "held by dead process on same host",
+			holder:      &Owner{PID: 2, Hostname: "host", Acquired: someTime, Updated: someTime},
+			pid:         1,
+			hostname:    "host",
+			now:         now,
+			alive:       alive(),
+		},
+		{
+			description: "held by same host and PID without takeover",
+			holder:      &Owner{PID: 1, Hostname: "host", Acquired: someTime, Updated: someTime},
+			pid:         1,
+			hostname:    "host",
+			now:         laterNow,
+			alive:       alive(1),
+			expectHeld:  true,
+		},
+		{
+			description: "held by same host and PID within takeover age",
+			holder:      &Owner{PID: 1, Hostname: "host", Acquired: someTime, Updated: someTime},
+			opts:        Options{TakeoverAge: 3 * time.Hour},
+			pid:         1,
+			hostname:    "host",
+			now:         laterNow,
+			alive:       alive(1),
+			expectHeld:  true,
+		},
+		{
+			description: "held by same host and PID past takeover age",
+			holder:      &Owner{PID: 1, Hostname: "host", Acquired: someTime, Updated: someTime},
+			opts:        Options{TakeoverAge: time.Hour},
+			pid:         1,
+			hostname:    "host",
+			now:         laterNow,
+			alive:       alive(1),
+		},
+		{
+			description: "held by other host without takeover",
+			holder:      &Owner{PID: 2, Hostname: "other host", Acquired: someTime, Updated: someTime},
+			pid:         1,
+			hostname:    "host",
+			now:         laterNow,
+			alive:       alive(),
+			expectHeld:  true,
+		},
+		{
+			description: "held by other host within takeover age",
+			holder:      &Owner{PID: 2, Hostname: "other host", Acquired: someTime, Updated: someTime},
+			opts:        Options{TakeoverAge: 3 * time.Hour},
+			pid:         1,
+			hostname:    "host",
+			now:         laterNow,
+			alive:       alive(),
+			expectHeld:  true,
+		},
+		{
+			description: "held by other host past takeover age",
+			holder:      &Owner{PID: 2, Hostname: "other host", Acquired: someTime, Updated: someTime},
+			opts:        Options{TakeoverAge: time.Hour},
+			pid:         1,
+			hostname:    "host",
+			now:         laterNow,
+			alive:       alive(),
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			if tc.holder != nil {
+				holderLock, err := acquire(dir, Options{}, tc.holder.PID, tc.holder.Hostname, func() time.Time { return tc.holder.Acquired }, alive())
+				require.NoError(t, err)
+				require.NotNil(t, holderLock)
+			}
+
+			lock, err := acquire(dir, tc.opts, tc.pid, tc.hostname, tc.now, tc.alive)
+			if tc.expectHeld {
+				require.Error(t, err)
+				assert.Equal(t, HeldError{Path: filepath.Join(dir, FileName), Owner: *tc.holder}, err)
+				assert.Contains(t, err.Error(), tc.holder.Hostname)
+				return
+			}
+			require.NoError(t, err)
+			expectOwner := Owner{PID: tc.pid, Hostname: tc.hostname, Acquired: tc.now(), Updated: tc.now()}
+			assert.Equal(t, expectOwner, lock.Owner())
+			owner, err := readOwner(filepath.Join(dir, FileName))
+			require.NoError(t, err)
+			assert.True(t, expectOwner.same(owner))
+			assert.NoError(t, lock.AssertHeld())
+		})
+	}
+}
+
+func TestAcquireUnreadable(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, FileName), []byte("not json"), 0600))
+
+	_, err := acquire(dir, Options{}, 1, "host", time.Now, alive())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Data directory lock file is unreadable")
+}
+
+func TestAssertHeld(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	lock, err := acquire(dir, Options{}, 1, "host", time.Now, alive())
+	require.NoError(t, err)
+	require.NoError(t, lock.AssertHeld())
+
+	// another host takes over the lock
+	otherLock, err := acquire(dir, Options{TakeoverAge: time.Nanosecond}, 2, "other host", func() time.Time {
+		return time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	}, alive())
+	require.NoError(t, err)
+	err = lock.AssertHeld()
+	assert.Equal(t, HeldError{Path: filepath.Join(dir, FileName), Owner: otherLock.Owner()}, err)
+	assert.Equal(t, err, lock.Release(), "Release should not remove another process's lock")
+	assert.NoError(t, otherLock.AssertHeld())
+
+	assert.NoError(t, otherLock.Release())
+	assert.Equal(t, ErrReleased, otherLock.AssertHeld())
+	_, err = os.Stat(filepath.Join(dir, FileName))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, otherLock.Release(), "Release should be idempotent")
+}
+
+func TestRefresh(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	someTime := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	currentTime := someTime
+	lock, err := acquire(dir, Options{}, 1, "host", func() time.Time { return currentTime }, alive())
+	require.NoError(t, err)
+
+	currentTime = someTime.Add(time.Hour)
+	require.NoError(t, lock.refresh())
+	owner, err := readOwner(filepath.Join(dir, FileName))
+	require.NoError(t, err)
+	assert.Equal(t, someTime, owner.Acquired)
+	assert.Equal(t, currentTime, owner.Updated)
+	assert.NoError(t, lock.AssertHeld())
+}
+
+func TestReadOnlyGuard(t *testing.T) {
+	holder := Owner{PID: 2, Hostname: "other host", Acquired: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	err := ReadOnlyGuard(holder)()
+	require.Error(t, err)
+	assert.Equal(t, `Sage is in read-only mode, the data directory is locked by PID 2 on host "other host" since 2019-01-01T00:00:00Z`, err.Error())
+}
+
+func TestProcessAlive(t *testing.T) {
+	assert.True(t, processAlive(os.Getpid()))
+}
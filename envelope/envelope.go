@@ -0,0 +1,87 @@
+// Package envelope divides real accounts' balances into virtual sub-balances, like an "emergency fund" inside a savings account
+package envelope
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Entry kinds
+const (
+	// FundEntry allocates money from the account's unallocated balance, or releases it back if negative
+	FundEntry = "fund"
+	// MoveEntry moves money between envelopes of the same account
+	MoveEntry = "move"
+	// SpendEntry links a real ledger transaction which spent the envelope's money
+	SpendEntry = "spend"
+)
+
+// Envelope is a virtual sub-balance of a real ledger account
+type Envelope struct {
+	Name string
+	// Account is the ledger account which holds the envelope's money
+	Account string
+	// Target is the balance the envelope should be funded to, if set
+	Target  *decimal.Decimal `json:",omitempty"`
+	Entries []Entry          `json:",omitempty"`
+}
+
+// Entry is one change to an envelope's balance. Only spend entries refer to the ledger, the rest are bookkeeping.
+type Entry struct {
+	Kind   string
+	Date   time.Time
+	Amount decimal.Decimal
+	// Envelope is the other envelope of a move
+	Envelope string `json:",omitempty"`
+	// TransactionID is the ledger transaction a spend entry links to
+	TransactionID string `json:",omitempty"`
+}
+
+// Balance returns the sum of the envelope's entries
+func (e Envelope) Balance() decimal.Decimal {
+	balance := decimal.Zero
+	for _, entry := range e.Entries {
+		balance = balance.Add(entry.Amount)
+	}
+	return balance
+}
+
+// Spent returns the amount spent from the envelope by ledger transaction 'id'
+func (e Envelope) Spent(id string) decimal.Decimal {
+	spent := decimal.Zero
+	for _, entry := range e.Entries {
+		if entry.Kind == SpendEntry && entry.TransactionID == id {
+			spent = spent.Sub(entry.Amount)
+		}
+	}
+	return spent
+}
+
+// AccountSummary is a real account's balance divided into its envelopes
+type AccountSummary struct {
+	Account   string
+	Balance   decimal.Decimal
+	Envelopes []Balance
+	// Unallocated is the account's balance not in any envelope. It's only negative if spending not linked to an envelope dropped the balance below the allocations.
+	Unallocated decimal.Decimal
+}
+
+// Balance is an envelope's current balance
+type Balance struct {
+	Name    string
+	Target  *decimal.Decimal `json:",omitempty"`
+	Balance decimal.Decimal
+}
+
+// ShortfallError is returned when allocating more money than an account's unallocated balance, or spending more than an envelope holds
+type ShortfallError struct {
+	// Name is the account or envelope without enough money
+	Name      string
+	Shortfall decimal.Decimal
+}
+
+func (e ShortfallError) Error() string {
+	return fmt.Sprintf("Not enough money in %s, short by %s", e.Name, e.Shortfall)
+}
@@ -0,0 +1,303 @@
+package envelope
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	envelopesBucket        = "envelopes"
+	envelopesBucketVersion = "1"
+)
+
+// AccountBalance returns the real balance of ledger account 'account'
+type AccountBalance func(account string) decimal.Decimal
+
+// Store manages envelopes
+type Store struct {
+	mu     sync.Mutex
+	bucket plaindb.Bucket
+	now    func() time.Time
+}
+
+// NewStore returns the envelopes bucket
+func NewStore(db plaindb.DB) (*Store, error) {
+	bucket, err := db.Bucket(envelopesBucket, envelopesBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket: bucket,
+		now:    time.Now,
+	}, err
+}
+
+func envelopeKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (s *Store) get(name string) (Envelope, error) {
+	var envelope Envelope
+	found, err := s.bucket.Get(envelopeKey(name), &envelope)
+	if err != nil {
+		return Envelope{}, err
+	}
+	if !found {
+		return Envelope{}, errors.Errorf("Envelope not found: %q", name)
+	}
+	return envelope, nil
+}
+
+func (s *Store) put(envelope Envelope) error {
+	return s.bucket.Put(envelopeKey(envelope.Name), envelope)
+}
+
+func (s *Store) all() ([]Envelope, error) {
+	var envelopes []Envelope
+	var envelope Envelope
+	err := s.bucket.Iter(&envelope, func(string) bool {
+		envelopes = append(envelopes, envelope)
+		return true
+	})
+	sort.Slice(envelopes, func(a, b int) bool {
+		if envelopes[a].Account != envelopes[b].Account {
+			return envelopes[a].Account < envelopes[b].Account
+		}
+		return envelopeKey(envelopes[a].Name) < envelopeKey(envelopes[b].Name)
+	})
+	return envelopes, err
+}
+
+// unallocated returns 'account's balance not in any envelope
+func (s *Store) unallocated(account string, balance AccountBalance) (decimal.Decimal, error) {
+	envelopes, err := s.all()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	unallocated := balance(account)
+	for _, envelope := range envelopes {
+		if envelope.Account == account {
+			unallocated = unallocated.Sub(envelope.Balance())
+		}
+	}
+	return unallocated, nil
+}
+
+// Get returns the envelope named 'name'
+func (s *Store) Get(name string) (Envelope, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(name)
+}
+
+// Summaries returns each account with envelopes, divided into its envelopes' balances and the unallocated remainder
+func (s *Store) Summaries(balance AccountBalance) ([]AccountSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	envelopes, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+	var summaries []AccountSummary
+	for _, envelope := range envelopes {
+		if len(summaries) == 0 || summaries[len(summaries)-1].Account != envelope.Account {
+			accountBalance := balance(envelope.Account)
+			summaries = append(summaries, AccountSummary{
+				Account:     envelope.Account,
+				Balance:     accountBalance,
+				Unallocated: accountBalance,
+			})
+		}
+		summary := &summaries[len(summaries)-1]
+		envelopeBalance := envelope.Balance()
+		summary.Envelopes = append(summary.Envelopes, Balance{
+			Name:    envelope.Name,
+			Target:  envelope.Target,
+			Balance: envelopeBalance,
+		})
+		summary.Unallocated = summary.Unallocated.Sub(envelopeBalance)
+	}
+	return summaries, nil
+}
+
+// Add creates an empty envelope. Fund it with Fund.
+func (s *Store) Add(envelope Envelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	envelope.Name = strings.TrimSpace(envelope.Name)
+	envelope.Account = strings.TrimSpace(envelope.Account)
+	envelope.Entries = nil
+	if envelope.Name == "" {
+		return errors.New("Envelope name must not be empty")
+	}
+	if envelope.Account == "" {
+		return errors.New("Envelope account must not be empty")
+	}
+	if envelope.Target != nil && envelope.Target.IsNegative() {
+		return errors.Errorf("Envelope target must not be negative: %s", envelope.Target)
+	}
+	var existing Envelope
+	found, err := s.bucket.Get(envelopeKey(envelope.Name), &existing)
+	if err != nil {
+		return err
+	}
+	if found {
+		return errors.Errorf("Envelope already exists: %q", envelope.Name)
+	}
+	return s.put(envelope)
+}
+
+// Fund allocates 'amount' of the account's unallocated balance to envelope 'name'. A negative amount releases money back to the account.
+// Returns a ShortfallError if the account or envelope doesn't have enough money.
+func (s *Store) Fund(name string, amount decimal.Decimal, balance AccountBalance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if amount.IsZero() {
+		return errors.New("Amount must not be zero")
+	}
+	envelope, err := s.get(name)
+	if err != nil {
+		return err
+	}
+	if amount.IsPositive() {
+		unallocated, err := s.unallocated(envelope.Account, balance)
+		if err != nil {
+			return err
+		}
+		if amount.GreaterThan(unallocated) {
+			return ShortfallError{Name: envelope.Account, Shortfall: amount.Sub(decimal.Max(unallocated, decimal.Zero))}
+		}
+	} else if remaining := envelope.Balance().Add(amount); remaining.IsNegative() {
+		return ShortfallError{Name: envelope.Name, Shortfall: remaining.Neg()}
+	}
+	envelope.Entries = append(envelope.Entries, Entry{Kind: FundEntry, Date: s.now(), Amount: amount})
+	return s.put(envelope)
+}
+
+// Move moves a positive 'amount' between envelopes of the same account. The ledger doesn't change.
+func (s *Store) Move(from, to string, amount decimal.Decimal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !amount.IsPositive() {
+		return errors.Errorf("Amount must be positive: %s", amount)
+	}
+	return s.move(from, to, amount)
+}
+
+func (s *Store) move(from, to string, amount decimal.Decimal) error {
+	if envelopeKey(from) == envelopeKey(to) {
+		return errors.New("Can't move money to the same envelope")
+	}
+	source, err := s.get(from)
+	if err != nil {
+		return err
+	}
+	destination, err := s.get(to)
+	if err != nil {
+		return err
+	}
+	if source.Account != destination.Account {
+		return errors.Errorf("Envelopes must be in the same account to move money: %q is in %q, %q is in %q", source.Name, source.Account, destination.Name, destination.Account)
+	}
+	if remaining := source.Balance().Sub(amount); remaining.IsNegative() {
+		return ShortfallError{Name: source.Name, Shortfall: remaining.Neg()}
+	}
+	now := s.now()
+	source.Entries = append(source.Entries, Entry{Kind: MoveEntry, Date: now, Amount: amount.Neg(), Envelope: destination.Name})
+	destination.Entries = append(destination.Entries, Entry{Kind: MoveEntry, Date: now, Amount: amount, Envelope: source.Name})
+	if err := s.put(source); err != nil {
+		return err
+	}
+	return s.put(destination)
+}
+
+// Spend links ledger transaction 'txn' to envelope 'name', spending 'amount' from it.
+// 'txn' must spend from the envelope's account. If 'amount' is zero, the rest of the transaction's unlinked spending is used.
+func (s *Store) Spend(name string, txn ledger.Transaction, amount decimal.Decimal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if amount.IsNegative() {
+		return errors.Errorf("Amount must not be negative: %s", amount)
+	}
+	envelope, err := s.get(name)
+	if err != nil {
+		return err
+	}
+	outflow := decimal.Zero
+	for _, posting := range txn.Postings {
+		if posting.Account == envelope.Account {
+			outflow = outflow.Sub(posting.Amount)
+		}
+	}
+	if !outflow.IsPositive() {
+		return errors.Errorf("Transaction %q doesn't spend from the envelope's account %q", txn.ID(), envelope.Account)
+	}
+
+	envelopes, err := s.all()
+	if err != nil {
+		return err
+	}
+	unlinked := outflow
+	for _, other := range envelopes {
+		unlinked = unlinked.Sub(other.Spent(txn.ID()))
+	}
+	if amount.IsZero() {
+		amount = unlinked
+	}
+	if !amount.IsPositive() || amount.GreaterThan(unlinked) {
+		return errors.Errorf("Transaction %q only has %s of spending not linked to an envelope", txn.ID(), decimal.Max(unlinked, decimal.Zero))
+	}
+	if remaining := envelope.Balance().Sub(amount); remaining.IsNegative() {
+		return ShortfallError{Name: envelope.Name, Shortfall: remaining.Neg()}
+	}
+	envelope.Entries = append(envelope.Entries, Entry{Kind: SpendEntry, Date: txn.Date, Amount: amount.Neg(), TransactionID: txn.ID()})
+	return s.put(envelope)
+}
+
+// Remove deletes envelope 'name'. If its balance isn't zero, it must be moved to envelope 'moveTo' or released to the account's unallocated balance.
+func (s *Store) Remove(name, moveTo string, release bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	envelope, err := s.get(name)
+	if err != nil {
+		return err
+	}
+	balance := envelope.Balance()
+	switch {
+	case moveTo != "" && release:
+		return errors.New("Choose either an envelope to move the balance to or releasing it, not both")
+	case balance.IsZero() || release:
+	case moveTo != "":
+		if balance.IsNegative() {
+			return errors.Errorf("Envelope %q has a negative balance, release it instead", envelope.Name)
+		}
+		if err := s.move(envelope.Name, moveTo, balance); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("Envelope %q has a balance of %s, choose an envelope to move it to or release it to the account", envelope.Name, balance)
+	}
+	return s.bucket.Put(envelopeKey(envelope.Name), nil)
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var envelope Envelope
+		err := json.Unmarshal(data, &envelope)
+		return envelope, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
@@ -0,0 +1,139 @@
+package envelope
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const savings = "assets:Some Bank:****1234"
+
+func mockDBStore(t *testing.T) *Store {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	store, err := NewStore(db)
+	require.NoError(t, err)
+	store.now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return store
+}
+
+func dec(f float64) decimal.Decimal {
+	return decimal.NewFromFloat(f)
+}
+
+func requireBalances(t *testing.T, store *Store, balance AccountBalance, unallocated float64, envelopes map[string]float64) {
+	t.Helper()
+	summaries, err := store.Summaries(balance)
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, savings, summaries[0].Account)
+	assert.Equal(t, dec(unallocated).String(), summaries[0].Unallocated.String(), "Unallocated")
+	actual := make(map[string]float64)
+	for _, envelope := range summaries[0].Envelopes {
+		f, _ := envelope.Balance.Float64()
+		actual[envelope.Name] = f
+	}
+	assert.Equal(t, envelopes, actual)
+}
+
+func TestStoreFundAndMove(t *testing.T) {
+	store := mockDBStore(t)
+	realBalance := dec(1000)
+	balance := func(account string) decimal.Decimal {
+		if account == savings {
+			return realBalance
+		}
+		return decimal.Zero
+	}
+	target := dec(500)
+	require.NoError(t, store.Add(Envelope{Name: "Emergency fund", Account: savings, Target: &target}))
+	require.NoError(t, store.Add(Envelope{Name: "Vacation", Account: savings}))
+	require.NoError(t, store.Add(Envelope{Name: "Checking buffer", Account: "assets:other"}))
+	assert.EqualError(t, store.Add(Envelope{Name: "vacation ", Account: savings}), `Envelope already exists: "vacation"`)
+
+	require.NoError(t, store.Fund("emergency fund", dec(600), balance))
+	require.NoError(t, store.Fund("Vacation", dec(300), balance))
+	err := store.Fund("Vacation", dec(150), balance)
+	require.IsType(t, ShortfallError{}, err, "Allocations must not exceed the unallocated balance")
+	assert.Equal(t, savings, err.(ShortfallError).Name)
+	assert.Equal(t, "50", err.(ShortfallError).Shortfall.String())
+
+	require.NoError(t, store.Move("Emergency fund", "Vacation", dec(100)))
+	err = store.Move("Vacation", "Emergency fund", dec(1000))
+	require.IsType(t, ShortfallError{}, err)
+	assert.Equal(t, "Not enough money in Vacation, short by 600", err.Error())
+	assert.Error(t, store.Move("Vacation", "Checking buffer", dec(1)), "Moves between accounts should fail")
+
+	require.NoError(t, store.Fund("Vacation", dec(-50), balance))
+	summaries, err := store.Summaries(balance)
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	assert.Equal(t, savings, summaries[0].Account)
+	assert.Equal(t, "1000", summaries[0].Balance.String())
+	assert.Equal(t, "150", summaries[0].Unallocated.String())
+	require.Len(t, summaries[0].Envelopes, 2)
+	assert.Equal(t, "Emergency fund", summaries[0].Envelopes[0].Name)
+	assert.Equal(t, &target, summaries[0].Envelopes[0].Target)
+	assert.Equal(t, "500", summaries[0].Envelopes[0].Balance.String())
+	assert.Equal(t, "Vacation", summaries[0].Envelopes[1].Name)
+	assert.Equal(t, "350", summaries[0].Envelopes[1].Balance.String())
+	assert.Equal(t, "assets:other", summaries[1].Account)
+}
+
+func TestStoreSpend(t *testing.T) {
+	store := mockDBStore(t)
+	realBalance := dec(1000)
+	balance := func(string) decimal.Decimal { return realBalance }
+	require.NoError(t, store.Add(Envelope{Name: "Car repairs", Account: savings}))
+	require.NoError(t, store.Add(Envelope{Name: "Vacation", Account: savings}))
+	require.NoError(t, store.Fund("Car repairs", dec(400), balance))
+	require.NoError(t, store.Fund("Vacation", dec(100), balance))
+
+	txn := ledger.Transaction{
+		Date:  time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+		Payee: "Mechanic",
+		Postings: []ledger.Posting{
+			{Account: savings, Amount: dec(-300), Tags: map[string]string{"id": "txn-1"}},
+			{Account: "expenses:auto", Amount: dec(300)},
+		},
+	}
+	realBalance = realBalance.Sub(dec(300))
+	requireBalances(t, store, balance, 200, map[string]float64{"Car repairs": 400, "Vacation": 100})
+
+	require.NoError(t, store.Spend("Car repairs", txn, dec(250)))
+	require.NoError(t, store.Spend("Vacation", txn, decimal.Zero), "Zero amounts should spend the rest of the transaction")
+	assert.Error(t, store.Spend("Vacation", txn, dec(1)), "Transactions should not be linked beyond their amount")
+	requireBalances(t, store, balance, 500, map[string]float64{"Car repairs": 150, "Vacation": 50})
+
+	income := txn
+	income.Postings = []ledger.Posting{
+		{Account: savings, Amount: dec(10), Tags: map[string]string{"id": "txn-2"}},
+		{Account: "revenues:interest", Amount: dec(-10)},
+	}
+	assert.Error(t, store.Spend("Vacation", income, decimal.Zero), "Only spending should be linked")
+}
+
+func TestStoreRemove(t *testing.T) {
+	store := mockDBStore(t)
+	balance := func(string) decimal.Decimal { return dec(100) }
+	require.NoError(t, store.Add(Envelope{Name: "Gifts", Account: savings}))
+	require.NoError(t, store.Add(Envelope{Name: "Vacation", Account: savings}))
+	require.NoError(t, store.Add(Envelope{Name: "Empty", Account: savings}))
+	require.NoError(t, store.Fund("Gifts", dec(40), balance))
+
+	assert.Error(t, store.Remove("Gifts", "", false), "Nonzero balances need a destination")
+	require.NoError(t, store.Remove("Empty", "", false))
+	require.NoError(t, store.Remove("Gifts", "Vacation", false))
+	requireBalances(t, store, balance, 60, map[string]float64{"Vacation": 40})
+
+	require.NoError(t, store.Remove("Vacation", "", true))
+	summaries, err := store.Summaries(balance)
+	require.NoError(t, err)
+	assert.Empty(t, summaries)
+}
@@ -2,11 +2,14 @@ package errors
 
 import (
 	"encoding/json"
+	"reflect"
 	"strings"
 
 	"github.com/pkg/errors"
 )
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
 // Errors makes it easy to combine multiple errors into a single string
 type Errors []error
 
@@ -66,3 +69,44 @@ func (e Errors) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(errs)
 }
+
+// As finds the first error in err's chain that matches target, and if so, sets target to that error value and returns true.
+// Mirrors Go 1.13's errors.As, but also follows pkg/errors causes (i.e. from errors.Wrap).
+// Panics if target is not a non-nil pointer to either a type that implements error, or to any interface type.
+func As(err error, target interface{}) bool {
+	if target == nil {
+		panic("errors: target cannot be nil")
+	}
+	val := reflect.ValueOf(target)
+	typ := val.Type()
+	if typ.Kind() != reflect.Ptr || val.IsNil() {
+		panic("errors: target must be a non-nil pointer")
+	}
+	targetType := typ.Elem()
+	if targetType.Kind() != reflect.Interface && !targetType.Implements(errorType) {
+		panic("errors: *target must be interface or implement error")
+	}
+	for err != nil {
+		if reflect.TypeOf(err).AssignableTo(targetType) {
+			val.Elem().Set(reflect.ValueOf(err))
+			return true
+		}
+		if x, ok := err.(interface{ As(interface{}) bool }); ok && x.As(target) {
+			return true
+		}
+		err = unwrap(err)
+	}
+	return false
+}
+
+// unwrap returns the next error in err's chain, or nil
+func unwrap(err error) error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	case interface{ Cause() error }:
+		return e.Cause()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package fx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// ManualSource marks a rate entered by hand
+	ManualSource = "manual"
+	// ImportSource marks a rate imported from a file
+	ImportSource = "import"
+)
+
+// Rate is the value of 1 unit of the 'From' currency in the 'To' currency on a particular date
+type Rate struct {
+	From, To string
+	Date     time.Time
+	Rate     decimal.Decimal
+	Source   string `json:",omitempty"`
+}
+
+// Rates is a date-sorted list of rates for a single currency pair
+type Rates []Rate
+
+// MissingRate is reported when an amount could not be converted because no rate exists for a currency pair
+type MissingRate struct {
+	From, To string
+}
+
+// MissingRateError indicates no rate exists to convert between two currencies
+type MissingRateError struct {
+	MissingRate
+}
+
+func (m MissingRateError) Error() string {
+	return fmt.Sprintf("No exchange rate found from %q to %q", m.From, m.To)
+}
+
+func pairKey(from, to string) string {
+	return strings.ToUpper(from) + ":" + strings.ToUpper(to)
+}
+
+// set adds or replaces the rate for rate's date
+func (r Rates) set(rate Rate) Rates {
+	rate.Date = startOfDay(rate.Date)
+	ix := sort.Search(len(r), func(i int) bool {
+		return !r[i].Date.Before(rate.Date)
+	})
+	if ix < len(r) && r[ix].Date.Equal(rate.Date) {
+		r[ix] = rate
+		return r
+	}
+	r = append(r, Rate{})
+	copy(r[ix+1:], r[ix:])
+	r[ix] = rate
+	return r
+}
+
+// nearest returns the rate with a date closest to 'date'. Ties are broken in favor of the earlier rate.
+func (r Rates) nearest(date time.Time) (Rate, bool) {
+	if len(r) == 0 {
+		return Rate{}, false
+	}
+	ix := sort.Search(len(r), func(i int) bool {
+		return r[i].Date.After(date)
+	})
+	switch {
+	case ix == 0:
+		return r[0], true
+	case ix == len(r):
+		return r[len(r)-1], true
+	}
+	before, after := r[ix-1], r[ix]
+	if after.Date.Sub(date) < date.Sub(before.Date) {
+		return after, true
+	}
+	return before, true
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,57 @@
+package fx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse("2006/01/02", s)
+	require.NoError(t, err)
+	return d
+}
+
+func TestRatesSet(t *testing.T) {
+	var rates Rates
+	rates = rates.set(Rate{Date: date(t, "2020/01/03"), Rate: decimal.NewFromFloat(3)})
+	rates = rates.set(Rate{Date: date(t, "2020/01/01"), Rate: decimal.NewFromFloat(1)})
+	rates = rates.set(Rate{Date: date(t, "2020/01/02"), Rate: decimal.NewFromFloat(2)})
+	rates = rates.set(Rate{Date: date(t, "2020/01/03").Add(time.Hour), Rate: decimal.NewFromFloat(4)})
+	require.Len(t, rates, 3)
+	for i, expected := range []string{"1", "2", "4"} {
+		assert.Equal(t, expected, rates[i].Rate.String())
+	}
+	assert.Equal(t, date(t, "2020/01/03"), rates[2].Date)
+}
+
+func TestRatesNearest(t *testing.T) {
+	_, found := Rates(nil).nearest(date(t, "2020/01/01"))
+	assert.False(t, found)
+
+	rates := Rates{
+		{Date: date(t, "2020/01/01"), Rate: decimal.NewFromFloat(1)},
+		{Date: date(t, "2020/01/05"), Rate: decimal.NewFromFloat(5)},
+	}
+	for _, tc := range []struct {
+		date       string
+		expectRate string
+	}{
+		{"2019/12/01", "1"},
+		{"2020/01/01", "1"},
+		{"2020/01/02", "1"},
+		{"2020/01/03", "1"}, // tie uses earlier rate
+		{"2020/01/04", "5"},
+		{"2020/02/01", "5"},
+	} {
+		t.Run(tc.date, func(t *testing.T) {
+			rate, found := rates.nearest(date(t, tc.date))
+			require.True(t, found)
+			assert.Equal(t, tc.expectRate, rate.Rate.String())
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package fx
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/pipe"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Store manages exchange rates
+type Store struct {
+	mu     sync.Mutex
+	bucket plaindb.Bucket
+}
+
+const (
+	ratesBucket        = "fxrates"
+	ratesBucketVersion = "1"
+)
+
+var importDateFormats = []string{"2006/01/02", "2006-01-02"}
+
+// NewStore returns the exchange rates bucket
+func NewStore(db plaindb.DB) (*Store, error) {
+	bucket, err := db.Bucket(ratesBucket, ratesBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket: bucket,
+	}, err
+}
+
+// Add adds or replaces the rate for the rate's currency pair and date
+func (s *Store) Add(rate Rate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(rate)
+}
+
+func (s *Store) add(rate Rate) error {
+	rate.From = strings.TrimSpace(rate.From)
+	rate.To = strings.TrimSpace(rate.To)
+	if rate.From == "" || rate.To == "" {
+		return errors.New("Rate currencies must not be empty")
+	}
+	if strings.EqualFold(rate.From, rate.To) {
+		return errors.Errorf("Rate currencies must be different: %q", rate.From)
+	}
+	if !rate.Rate.IsPositive() {
+		return errors.Errorf("Rate must be positive: %s", rate.Rate)
+	}
+	if rate.Date.IsZero() {
+		return errors.New("Rate date must be set")
+	}
+	if rate.Source == "" {
+		rate.Source = ManualSource
+	}
+
+	key := pairKey(rate.From, rate.To)
+	var rates Rates
+	return pipe.OpFuncs{
+		func() error {
+			_, err := s.bucket.Get(key, &rates)
+			return err
+		},
+		func() error {
+			return s.bucket.Put(key, rates.set(rate))
+		},
+	}.Do()
+}
+
+// Import reads CSV records with the columns: date, from currency, to currency, rate
+// A header row is skipped if its rate column is not a number. Returns the number of rates imported.
+func (s *Store) Import(r io.Reader) (int, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	var rates []Rate
+	for ix, record := range records {
+		if len(record) != 4 {
+			return 0, errors.Errorf("Line %d: Expected 4 columns (date, from, to, rate), found %d", ix+1, len(record))
+		}
+		rate, err := decimal.NewFromString(strings.TrimSpace(record[3]))
+		if err != nil {
+			if ix == 0 {
+				// skip header
+				continue
+			}
+			return 0, errors.Wrapf(err, "Line %d: Invalid rate", ix+1)
+		}
+		date, err := parseImportDate(strings.TrimSpace(record[0]))
+		if err != nil {
+			return 0, errors.Wrapf(err, "Line %d: Invalid date", ix+1)
+		}
+		rates = append(rates, Rate{
+			From:   record[1],
+			To:     record[2],
+			Date:   date,
+			Rate:   rate,
+			Source: ImportSource,
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ix, rate := range rates {
+		if err := s.add(rate); err != nil {
+			return ix, err
+		}
+	}
+	return len(rates), nil
+}
+
+func parseImportDate(s string) (time.Time, error) {
+	var err error
+	for _, format := range importDateFormats {
+		var date time.Time
+		date, err = time.Parse(format, s)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// All returns all rates, sorted by currency pair then date
+func (s *Store) All() ([]Rate, error) {
+	var allRates []Rate
+	var rates Rates
+	err := s.bucket.Iter(&rates, func(id string) bool {
+		allRates = append(allRates, rates...)
+		return true
+	})
+	sort.SliceStable(allRates, func(a, b int) bool {
+		keyA, keyB := pairKey(allRates[a].From, allRates[a].To), pairKey(allRates[b].From, allRates[b].To)
+		if keyA != keyB {
+			return keyA < keyB
+		}
+		return allRates[a].Date.Before(allRates[b].Date)
+	})
+	return allRates, err
+}
+
+// Convert converts 'amount' in the 'from' currency to the 'to' currency, using the nearest-dated rate to 'date'
+// If only the inverse pair has rates, the inverse rate is used. Returns a MissingRateError if neither pair has any rates.
+func (s *Store) Convert(amount decimal.Decimal, from, to string, date time.Time) (decimal.Decimal, error) {
+	if strings.EqualFold(from, to) {
+		return amount, nil
+	}
+	var rates Rates
+	found, err := s.bucket.Get(pairKey(from, to), &rates)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if rate, ok := rates.nearest(date); found && ok {
+		return amount.Mul(rate.Rate), nil
+	}
+
+	rates = nil
+	found, err = s.bucket.Get(pairKey(to, from), &rates)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if rate, ok := rates.nearest(date); found && ok {
+		return amount.Div(rate.Rate), nil
+	}
+	return decimal.Zero, MissingRateError{MissingRate{From: from, To: to}}
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var rates Rates
+		err := json.Unmarshal(data, &rates)
+		return rates, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
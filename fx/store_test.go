@@ -0,0 +1,151 @@
+package fx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockDBStore(t *testing.T) *Store {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	store, err := NewStore(db)
+	require.NoError(t, err)
+	return store
+}
+
+func TestStoreAdd(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		rate        Rate
+		expectErr   string
+	}{
+		{
+			description: "happy path",
+			rate:        Rate{From: "EUR", To: "$", Date: date(t, "2020/01/01"), Rate: decimal.NewFromFloat(1.1)},
+		},
+		{
+			description: "missing currency",
+			rate:        Rate{From: "EUR", Date: date(t, "2020/01/01"), Rate: decimal.NewFromFloat(1.1)},
+			expectErr:   "Rate currencies must not be empty",
+		},
+		{
+			description: "same currency",
+			rate:        Rate{From: "EUR", To: "eur", Date: date(t, "2020/01/01"), Rate: decimal.NewFromFloat(1.1)},
+			expectErr:   `Rate currencies must be different: "EUR"`,
+		},
+		{
+			description: "non-positive rate",
+			rate:        Rate{From: "EUR", To: "$", Date: date(t, "2020/01/01")},
+			expectErr:   "Rate must be positive: 0",
+		},
+		{
+			description: "missing date",
+			rate:        Rate{From: "EUR", To: "$", Rate: decimal.NewFromFloat(1.1)},
+			expectErr:   "Rate date must be set",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			store := mockDBStore(t)
+			err := store.Add(tc.rate)
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			rates, err := store.All()
+			require.NoError(t, err)
+			tc.rate.Source = ManualSource
+			assert.Equal(t, []Rate{tc.rate}, rates)
+		})
+	}
+}
+
+func TestStoreImport(t *testing.T) {
+	store := mockDBStore(t)
+	imported, err := store.Import(strings.NewReader(`Date,From,To,Rate
+2020/01/02,EUR,$,1.2
+2020-01-01,EUR,$,1.1
+2020/01/01,GBP,$,1.3
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, imported)
+
+	rates, err := store.All()
+	require.NoError(t, err)
+	require.Len(t, rates, 3)
+	assert.Equal(t, "1.1", rates[0].Rate.String())
+	assert.Equal(t, "1.2", rates[1].Rate.String())
+	assert.Equal(t, "GBP", rates[2].From)
+	assert.Equal(t, ImportSource, rates[2].Source)
+
+	_, err = store.Import(strings.NewReader("2020/01/02,EUR,$,abc\n2020/01/02,EUR,$,def\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Line 2: Invalid rate")
+
+	_, err = store.Import(strings.NewReader("2020/01/02,EUR,$\n"))
+	require.Error(t, err)
+	assert.Equal(t, "Line 1: Expected 4 columns (date, from, to, rate), found 3", err.Error())
+}
+
+func TestStoreConvert(t *testing.T) {
+	store := mockDBStore(t)
+	require.NoError(t, store.Add(Rate{From: "EUR", To: "$", Date: date(t, "2020/01/01"), Rate: decimal.NewFromFloat(1.1)}))
+	require.NoError(t, store.Add(Rate{From: "EUR", To: "$", Date: date(t, "2020/02/01"), Rate: decimal.NewFromFloat(1.2)}))
+	amount := decimal.NewFromFloat(120)
+
+	for _, tc := range []struct {
+		description  string
+		from, to     string
+		date         string
+		expectAmount string
+		expectErr    string
+	}{
+		{
+			description:  "same currency",
+			from:         "$",
+			to:           "$",
+			date:         "2020/01/01",
+			expectAmount: "120",
+		},
+		{
+			description:  "nearest rate",
+			from:         "EUR",
+			to:           "$",
+			date:         "2020/01/31",
+			expectAmount: "144",
+		},
+		{
+			description:  "inverse rate",
+			from:         "$",
+			to:           "EUR",
+			date:         "2020/01/05",
+			expectAmount: "109.0909090909090909",
+		},
+		{
+			description: "missing rate",
+			from:        "GBP",
+			to:          "$",
+			date:        "2020/01/01",
+			expectErr:   `No exchange rate found from "GBP" to "$"`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			converted, err := store.Convert(amount, tc.from, tc.to, date(t, tc.date))
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.IsType(t, MissingRateError{}, err)
+				assert.Equal(t, tc.expectErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectAmount, converted.String())
+		})
+	}
+}
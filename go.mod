@@ -14,6 +14,7 @@ require (
 	github.com/johnstarich/go/regext v0.0.1
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/pkg/errors v0.8.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/shopspring/decimal v0.0.0-20180709203117-cd690d0c9e24
 	github.com/stretchr/testify v1.4.0
 	go.uber.org/atomic v1.4.0
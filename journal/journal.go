@@ -0,0 +1,117 @@
+// Package journal records an audit trail of significant changes to Sage's data
+package journal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+)
+
+const (
+	journalBucket        = "journal"
+	journalBucketVersion = "1"
+
+	idRandomBytes = 4
+)
+
+// Journal actions
+const (
+	// AccountClosed is recorded when an account is closed. Subject is the account ID.
+	AccountClosed = "account-closed"
+	// AccountReopened is recorded when a closed account is reopened. Subject is the account ID.
+	AccountReopened = "account-reopened"
+	// BatchApproved is recorded when a quarantined batch is imported into the ledger. Subject is the account ID.
+	BatchApproved = "batch-approved"
+	// BatchDiscarded is recorded when a quarantined batch is dropped. Subject is the account ID.
+	BatchDiscarded = "batch-discarded"
+	// FailedReleased is recorded when a quarantined failed transaction is added to the ledger. Subject is the transaction's account.
+	FailedReleased = "failed-released"
+	// FailedDiscarded is recorded when a quarantined failed transaction is dropped. Subject is the transaction's account.
+	FailedDiscarded = "failed-discarded"
+	// DuplicateRemoved is recorded when a duplicate transaction is removed by deduping. Subject is the transaction's account.
+	DuplicateRemoved = "duplicate-removed"
+)
+
+// Entry is a single audited change
+type Entry struct {
+	ID      string
+	Time    time.Time
+	Action  string
+	Subject string
+	Details map[string]string `json:",omitempty"`
+}
+
+// Store is an append-only list of journal entries
+type Store struct {
+	mu     sync.Mutex
+	bucket plaindb.Bucket
+}
+
+// NewStore returns the journal bucket
+func NewStore(db plaindb.DB) (*Store, error) {
+	bucket, err := db.Bucket(journalBucket, journalBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket: bucket,
+	}, err
+}
+
+// Record appends an entry for 'action' on 'subject' at time 'now'
+func (s *Store) Record(now time.Time, action, subject string, details map[string]string) (Entry, error) {
+	suffix := make([]byte, idRandomBytes)
+	if _, err := rand.Read(suffix); err != nil {
+		return Entry{}, err
+	}
+	entry := Entry{
+		ID:      fmt.Sprintf("%d-%s", now.UnixNano(), hex.EncodeToString(suffix)),
+		Time:    now,
+		Action:  action,
+		Subject: subject,
+		Details: details,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return entry, s.bucket.Put(entry.ID, entry)
+}
+
+// Entries returns all entries for 'subject', oldest first. Returns every entry if subject is empty.
+func (s *Store) Entries(subject string) ([]Entry, error) {
+	var entries []Entry
+	var entry Entry
+	err := s.bucket.Iter(&entry, func(id string) bool {
+		if subject == "" || entry.Subject == subject {
+			entries = append(entries, entry)
+		}
+		return true
+	})
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].Time.Equal(entries[b].Time) {
+			return entries[a].ID < entries[b].ID
+		}
+		return entries[a].Time.Before(entries[b].Time)
+	})
+	return entries, err
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var entry Entry
+		err := json.Unmarshal(data, &entry)
+		return entry, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
@@ -0,0 +1,42 @@
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordEntries(t *testing.T) {
+	store, err := NewStore(plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}}))
+	require.NoError(t, err)
+
+	first := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	third := second.Add(time.Hour)
+	_, err = store.Record(third, AccountReopened, "1", nil)
+	require.NoError(t, err)
+	closed, err := store.Record(first, AccountClosed, "1", map[string]string{"date": "2019-01-01"})
+	require.NoError(t, err)
+	_, err = store.Record(second, AccountClosed, "2", nil)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, closed.ID)
+	assert.Equal(t, AccountClosed, closed.Action)
+	assert.Equal(t, "1", closed.Subject)
+
+	entries, err := store.Entries("1")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, closed, entries[0])
+	assert.Equal(t, AccountReopened, entries[1].Action)
+
+	entries, err = store.Entries("")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{"1", "2", "1"}, []string{entries[0].Subject, entries[1].Subject, entries[2].Subject})
+}
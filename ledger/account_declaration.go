@@ -0,0 +1,204 @@
+package ledger
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	accountDirective = "account "
+	accountTypeTag   = "type"
+
+	// Account types, named like each type's conventional top-level account
+	AssetType     = "assets"
+	LiabilityType = "liabilities"
+	EquityType    = "equity"
+	RevenueType   = "revenues"
+	ExpenseType   = "expenses"
+)
+
+// accountTypeCodes maps hledger's account type tag values to account types
+var accountTypeCodes = map[string]string{
+	"a": AssetType, "asset": AssetType, "assets": AssetType,
+	"c": AssetType, "cash": AssetType,
+	"l": LiabilityType, "liability": LiabilityType, "liabilities": LiabilityType,
+	"e": EquityType, "equity": EquityType,
+	"v": EquityType, "conversion": EquityType,
+	"r": RevenueType, "revenue": RevenueType, "revenues": RevenueType, "income": RevenueType,
+	"x": ExpenseType, "expense": ExpenseType, "expenses": ExpenseType,
+}
+
+// typeCodes maps account types back to hledger's type tag values, for writing new declarations
+var typeCodes = map[string]string{
+	AssetType:     "A",
+	LiabilityType: "L",
+	EquityType:    "E",
+	RevenueType:   "R",
+	ExpenseType:   "X",
+}
+
+// AccountDeclaration is an hledger-style "account" directive. Its lines are kept verbatim, so rewriting the ledger file preserves them.
+type AccountDeclaration struct {
+	Account string
+	// Type is the declared account type, like "assets", or empty if the directive has no type tag
+	Type string
+	// Transfer is set if the directive has a transfer tag. Reports exclude income and expense postings to transfer accounts.
+	Transfer bool
+	// Lines are the directive's original lines, including indented subdirectives and comments
+	Lines []string
+}
+
+// NewAccountDeclaration returns a declaration for 'account' with an optional account type tag
+func NewAccountDeclaration(account, accountType string) (AccountDeclaration, error) {
+	account = NormalizeAccountName(account)
+	if account == "" {
+		return AccountDeclaration{}, errors.New("Account name must not be empty")
+	}
+	line := accountDirective + account
+	if accountType != "" {
+		code, ok := typeCodes[accountType]
+		if !ok {
+			return AccountDeclaration{}, errors.Errorf("Unrecognized account type: %q", accountType)
+		}
+		line += "  ; " + accountTypeTag + ": " + code
+	}
+	return AccountDeclaration{
+		Account: account,
+		Type:    accountType,
+		Lines:   []string{line},
+	}, nil
+}
+
+// parseAccountDirective parses an "account" directive's first line
+func parseAccountDirective(line string) (AccountDeclaration, error) {
+	decl := AccountDeclaration{Lines: []string{line}}
+	name := strings.TrimPrefix(line, accountDirective)
+	if ix := strings.IndexRune(name, ';'); ix != -1 {
+		decl.addComment(name[ix+1:])
+		name = name[:ix]
+	}
+	// like postings, two or more spaces end the account name
+	if ix := strings.Index(name, "  "); ix != -1 {
+		name = name[:ix]
+	}
+	if ix := strings.Index(name, "\t"); ix != -1 {
+		name = name[:ix]
+	}
+	decl.Account = NormalizeAccountName(strings.TrimSpace(name))
+	if decl.Account == "" {
+		return decl, errors.Errorf("Account directive must have an account name: %s", line)
+	}
+	return decl, nil
+}
+
+// addSubdirective adds an indented line following the directive. Comments may contain the account type tag.
+func (a *AccountDeclaration) addSubdirective(line string) {
+	a.Lines = append(a.Lines, line)
+	if trimLine := strings.TrimSpace(line); strings.HasPrefix(trimLine, ";") {
+		a.addComment(trimLine[1:])
+	}
+}
+
+func (a *AccountDeclaration) addComment(comment string) {
+	_, tags := parseTags(strings.TrimSpace(comment))
+	if accountType, ok := accountTypeCodes[strings.ToLower(tags[accountTypeTag])]; ok {
+		a.Type = accountType
+	}
+	if isTrueTag(tags, TransferTag) {
+		a.Transfer = true
+	}
+}
+
+func (a AccountDeclaration) String() string {
+	return strings.Join(a.Lines, "\n") + "\n"
+}
+
+// AccountType returns the type of 'account', like "assets".
+// Uses the type of the closest declared parent account, or the account name's top-level prefix if none are declared.
+// Returns an empty string if neither determine the type.
+func (l *Ledger) AccountType(account string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.accountType(account)
+}
+
+// accountType is AccountType, but must be called with the lock held
+func (l *Ledger) accountType(account string) string {
+	key := AccountKey(account)
+	accountType, declaredLength := "", -1
+	for _, decl := range l.declarations {
+		if decl.Type == "" {
+			continue
+		}
+		declKey := AccountKey(decl.Account)
+		if (key == declKey || strings.HasPrefix(key, declKey+":")) && len(declKey) > declaredLength {
+			accountType, declaredLength = decl.Type, len(declKey)
+		}
+	}
+	if declaredLength != -1 {
+		return accountType
+	}
+	topLevel := strings.SplitN(key, ":", 2)[0]
+	if _, isType := typeCodes[topLevel]; isType {
+		return topLevel
+	}
+	return ""
+}
+
+// AccountDeclarations returns the ledger's account directives, in file order
+func (l *Ledger) AccountDeclarations() []AccountDeclaration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	declarations := make([]AccountDeclaration, len(l.declarations))
+	copy(declarations, l.declarations)
+	return declarations
+}
+
+// UndeclaredAccounts returns the sorted names of accounts with postings or balance assertions but no account directive
+func (l *Ledger) UndeclaredAccounts() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	declared := make(map[string]bool, len(l.declarations))
+	for _, decl := range l.declarations {
+		declared[AccountKey(decl.Account)] = true
+	}
+	undeclaredSet := make(map[string]bool)
+	addPostings := func(txn Transaction) {
+		for _, p := range txn.Postings {
+			if !declared[AccountKey(p.Account)] {
+				undeclaredSet[p.Account] = true
+			}
+		}
+	}
+	for _, txn := range l.transactions {
+		addPostings(*txn)
+	}
+	for _, assertion := range l.assertions {
+		addPostings(assertion)
+	}
+	undeclared := make([]string, 0, len(undeclaredSet))
+	for account := range undeclaredSet {
+		undeclared = append(undeclared, account)
+	}
+	sort.Strings(undeclared)
+	return undeclared
+}
+
+// DeclareAccount adds an account directive for decl's account, unless one already exists. Returns true if it was added.
+func (l *Ledger) DeclareAccount(decl AccountDeclaration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := AccountKey(decl.Account)
+	for _, existing := range l.declarations {
+		if AccountKey(existing.Account) == key {
+			return false
+		}
+	}
+	// never append in place, since derived ledgers may share the declarations slice
+	declarations := make([]AccountDeclaration, len(l.declarations), len(l.declarations)+1)
+	copy(declarations, l.declarations)
+	l.declarations = append(declarations, decl)
+	return true
+}
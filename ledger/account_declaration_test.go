@@ -0,0 +1,92 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const declaredLedger = `account Assets:Checking  ; type: A
+account Credit Card
+    ; type: L
+    ; note: the family card
+account expenses:food
+
+2019/01/02 Groceries
+    Credit Card              $-10
+    expenses:food:groceries   $10
+
+2019/01/03 Paycheck
+    Assets:Checking          $100
+    revenues:salary         $-100
+`
+
+func TestParseAccountDeclarations(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(declaredLedger))
+	require.NoError(t, err)
+	assert.Equal(t, []AccountDeclaration{
+		{Account: "Assets:Checking", Type: AssetType, Lines: []string{"account Assets:Checking  ; type: A"}},
+		{Account: "Credit Card", Type: LiabilityType, Lines: []string{
+			"account Credit Card",
+			"    ; type: L",
+			"    ; note: the family card",
+		}},
+		{Account: "expenses:food", Lines: []string{"account expenses:food"}},
+	}, ldg.AccountDeclarations())
+	assert.Len(t, ldg.transactions, 2)
+
+	written := ldg.String()
+	assert.True(t, strings.HasPrefix(written, `account Assets:Checking  ; type: A
+account Credit Card
+    ; type: L
+    ; note: the family card
+account expenses:food
+
+2019/01/02`), "Directives should be preserved verbatim:\n%s", written)
+
+	reread, err := NewFromReader(strings.NewReader(written))
+	require.NoError(t, err)
+	assert.Equal(t, ldg.AccountDeclarations(), reread.AccountDeclarations())
+	assert.Equal(t, written, reread.String())
+}
+
+func TestParseAccountDirectiveInvalid(t *testing.T) {
+	_, err := NewFromReader(strings.NewReader("account   ; type: A\n"))
+	assert.Error(t, err)
+}
+
+func TestAccountType(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(declaredLedger))
+	require.NoError(t, err)
+	for account, expected := range map[string]string{
+		"Assets:Checking":         AssetType,
+		"assets:checking:sub":     AssetType,
+		"Credit Card":             LiabilityType,
+		"credit card:rewards":     LiabilityType,
+		"Credit Cardholder":       "",
+		"expenses:food:groceries": ExpenseType,
+		"revenues:salary":         RevenueType,
+		"equity:opening":          EquityType,
+		"uncategorized":           "",
+	} {
+		assert.Equal(t, expected, ldg.AccountType(account), account)
+	}
+}
+
+func TestUndeclaredAccounts(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(declaredLedger))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"expenses:food:groceries", "revenues:salary"}, ldg.UndeclaredAccounts())
+
+	decl, err := NewAccountDeclaration("revenues:salary", RevenueType)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"account revenues:salary  ; type: R"}, decl.Lines)
+	assert.True(t, ldg.DeclareAccount(decl))
+	assert.False(t, ldg.DeclareAccount(decl), "Declaring an account twice should do nothing")
+	assert.Equal(t, []string{"expenses:food:groceries"}, ldg.UndeclaredAccounts())
+
+	_, err = NewAccountDeclaration("stuff", "things")
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package ledger
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// AccountCollision is a set of account names which only differ by case or whitespace, and so refer to the same account
+type AccountCollision struct {
+	// Accounts are the colliding account names as they appear in the ledger
+	Accounts []string
+	// Suggested is the name each of Accounts should be merged into
+	Suggested string
+}
+
+// NormalizeAccountName returns the canonical display form of 'name'.
+// Whitespace around each ':' separated component is trimmed and internal runs of whitespace, including non-breaking spaces, collapse to one space. Case is preserved.
+func NormalizeAccountName(name string) string {
+	components := strings.Split(name, ":")
+	for i, component := range components {
+		components[i] = strings.Join(strings.Fields(component), " ")
+	}
+	return strings.Join(components, ":")
+}
+
+// ReplaceAccountPrefix returns 'account' with its leading 'oldPrefix' components replaced by 'newPrefix', so subaccounts move too.
+// Components are compared like AccountKey. Returns false if 'account' isn't 'oldPrefix' or one of its subaccounts.
+func ReplaceAccountPrefix(account, oldPrefix, newPrefix string) (string, bool) {
+	oldComponents := strings.Split(oldPrefix, ":")
+	components := strings.Split(account, ":")
+	if len(components) < len(oldComponents) ||
+		AccountKey(strings.Join(components[:len(oldComponents)], ":")) != AccountKey(oldPrefix) {
+		return account, false
+	}
+	return strings.Join(append([]string{newPrefix}, components[len(oldComponents):]...), ":"), true
+}
+
+// AccountKey returns a case-insensitive comparison key for 'name'. Account names with equal keys refer to the same account.
+func AccountKey(name string) string {
+	return strings.Map(foldRune, NormalizeAccountName(name))
+}
+
+// foldRune maps r to a single case, including runes with multiple case forms like 'ſ' and 'ς'
+func foldRune(r rune) rune {
+	return unicode.ToLower(unicode.ToUpper(r))
+}
+
+// AccountCollisions returns all account names which only differ by case or whitespace
+func (l *Ledger) AccountCollisions() []AccountCollision {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	usage := make(map[string]int)
+	for _, txn := range l.transactions {
+		for _, p := range txn.Postings {
+			usage[p.Account]++
+		}
+	}
+	variants := make(map[string][]string)
+	for account := range usage {
+		key := AccountKey(account)
+		variants[key] = append(variants[key], account)
+	}
+
+	var collisions []AccountCollision
+	for _, accounts := range variants {
+		if len(accounts) < 2 {
+			continue
+		}
+		sort.Slice(accounts, func(a, b int) bool {
+			// prefer already normalized names, then the most used name
+			aNormal, bNormal := accounts[a] == NormalizeAccountName(accounts[a]), accounts[b] == NormalizeAccountName(accounts[b])
+			if aNormal != bNormal {
+				return aNormal
+			}
+			if usage[accounts[a]] != usage[accounts[b]] {
+				return usage[accounts[a]] > usage[accounts[b]]
+			}
+			return accounts[a] < accounts[b]
+		})
+		collisions = append(collisions, AccountCollision{
+			Accounts:  accounts,
+			Suggested: NormalizeAccountName(accounts[0]),
+		})
+	}
+	sort.Slice(collisions, func(a, b int) bool {
+		return collisions[a].Suggested < collisions[b].Suggested
+	})
+	return collisions
+}
+
+// canonicalAccount normalizes 'name' and returns the most used existing ledger account it refers to, if any. Must be called with the lock held.
+func (l *Ledger) canonicalAccount(name string) string {
+	name = NormalizeAccountName(name)
+	key := AccountKey(name)
+	usage := make(map[string]int)
+	for _, txn := range l.transactions {
+		for _, p := range txn.Postings {
+			if p.Account == NormalizeAccountName(p.Account) && AccountKey(p.Account) == key {
+				usage[p.Account]++
+			}
+		}
+	}
+	canonical, canonicalUsage := name, 0
+	for account, count := range usage {
+		if count > canonicalUsage || (count == canonicalUsage && account < canonical) {
+			canonical, canonicalUsage = account, count
+		}
+	}
+	return canonical
+}
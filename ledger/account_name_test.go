@@ -0,0 +1,110 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeAccountName(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		name        string
+		normalized  string
+	}{
+		{description: "already normal", name: "expenses:food", normalized: "expenses:food"},
+		{description: "preserves case", name: "Expenses:Food", normalized: "Expenses:Food"},
+		{description: "trailing space", name: "expenses:food ", normalized: "expenses:food"},
+		{description: "space around separator", name: " expenses : food", normalized: "expenses:food"},
+		{description: "internal runs", name: "expenses:car  rental", normalized: "expenses:car rental"},
+		{description: "tabs", name: "expenses:car\trental", normalized: "expenses:car rental"},
+		{description: "non-breaking space", name: "expenses:car\u00a0rental\u00a0", normalized: "expenses:car rental"},
+		{description: "empty", name: "  ", normalized: ""},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.normalized, NormalizeAccountName(tc.name))
+		})
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		a, b        string
+		equal       bool
+	}{
+		{description: "case", a: "Expenses:Food", b: "expenses:food ", equal: true},
+		{description: "non-breaking space", a: "expenses:car rental", b: "expenses:car\u00a0rental", equal: true},
+		{description: "accented", a: "expenses:café", b: "EXPENSES:CAFÉ", equal: true},
+		{description: "long s", a: "expenses:ſushi", b: "expenses:Sushi", equal: true},
+		{description: "final sigma", a: "expenses:ταξίδις", b: "expenses:ΤΑΞΊΔΙΣ", equal: true},
+		{description: "kelvin sign", a: "expenses:\u212aitchen", b: "expenses:kitchen", equal: true},
+		{description: "different accents", a: "expenses:cafe", b: "expenses:café", equal: false},
+		{description: "different components", a: "expenses:car rental", b: "expenses:car:rental", equal: false},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.equal, AccountKey(tc.a) == AccountKey(tc.b))
+		})
+	}
+}
+
+func TestReplaceAccountPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		account, expected string
+		replaced          bool
+	}{
+		{account: "expenses:dining", expected: "expenses:food:restaurants", replaced: true},
+		{account: "Expenses:Dining:Coffee", expected: "expenses:food:restaurants:Coffee", replaced: true},
+		{account: "expenses:dining out", expected: "expenses:dining out"},
+		{account: "expenses", expected: "expenses"},
+		{account: "revenues:dining", expected: "revenues:dining"},
+	} {
+		t.Run(tc.account, func(t *testing.T) {
+			account, replaced := ReplaceAccountPrefix(tc.account, "expenses:dining", "expenses:food:restaurants")
+			assert.Equal(t, tc.expected, account)
+			assert.Equal(t, tc.replaced, replaced)
+		})
+	}
+}
+
+func TestAccountCollisions(t *testing.T) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	makeTxn := func(id, category string) Transaction {
+		return Transaction{
+			Date:  date,
+			Payee: "Some Shop",
+			Postings: []Posting{
+				{Account: "assets:bank", Amount: *decFloat(-1), Tags: makeIDTag(id)},
+				{Account: category, Amount: *decFloat(1)},
+			},
+		}
+	}
+	l, err := New([]Transaction{
+		makeTxn("1", "expenses:food "),
+		makeTxn("2", "Expenses:Food"),
+		makeTxn("3", "expenses:food"),
+		makeTxn("4", "expenses:food"),
+		makeTxn("5", "expenses:shopping"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []AccountCollision{
+		{
+			Accounts:  []string{"expenses:food", "Expenses:Food", "expenses:food "},
+			Suggested: "expenses:food",
+		},
+	}, l.AccountCollisions())
+
+	require.NoError(t, l.UpdateTransaction("5", Transaction{Postings: []Posting{
+		{Account: "assets:bank", Amount: *decFloat(-1), Tags: makeIDTag("5")},
+		{Account: "EXPENSES:FOOD\u00a0", Amount: *decFloat(1)},
+	}}))
+	txn, _ := l.Transaction("5")
+	assert.Equal(t, "expenses:food", txn.Postings[1].Account, "Updates should reuse the most used display form")
+
+	l.RenameAccount("Expenses:Food", "expenses:food", "", "")
+	l.RenameAccount("expenses:food ", "expenses:food", "", "")
+	assert.Empty(t, l.AccountCollisions())
+}
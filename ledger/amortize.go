@@ -0,0 +1,169 @@
+package ledger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// AmortizeTag spreads a transaction's expenses and revenues over several months in reports, e.g. "amortize: 12 months"
+	AmortizeTag = "amortize"
+	// AmortizedFromTag is set on each amortized share to the ID of the real transaction it came from
+	AmortizedFromTag = "amortized_from"
+	// AmortizedShareTag is set on each amortized share to its position in the amortization, e.g. "1/12"
+	AmortizedShareTag = "amortized_share"
+
+	maxAmortizeMonths = 120
+	amortizePlaces    = 2
+)
+
+// ParseAmortization parses an AmortizeTag value into a number of months. Accepts forms like "12 months", "1 month", or "12".
+func ParseAmortization(value string) (months int, err error) {
+	value = strings.TrimSpace(value)
+	fields := strings.Fields(value)
+	if len(fields) == 2 && (fields[1] == "months" || fields[1] == "month") {
+		value = fields[0]
+	}
+	months, err = strconv.Atoi(value)
+	if err != nil || months < 1 || months > maxAmortizeMonths {
+		return 0, errors.Errorf("Invalid amortization, must be a number of months between 1 and %d: %q", maxAmortizeMonths, value)
+	}
+	return months, nil
+}
+
+// amortizeMonths returns the number of months txn is amortized over, or 1 if it is not amortized or the tag is invalid
+func amortizeMonths(txn Transaction) int {
+	value, ok := txn.Tags[AmortizeTag]
+	if !ok {
+		return 1
+	}
+	months, err := ParseAmortization(value)
+	if err != nil {
+		return 1
+	}
+	return months
+}
+
+// Amortized returns a copy of the ledger for reports, where each transaction tagged with AmortizeTag spreads its expense and revenue postings evenly over that many months.
+// Asset and liability postings remain on the original date, so account balances still reflect real cash.
+// Returns l itself if no transactions are amortized.
+func (l *Ledger) Amortized() *Ledger {
+	l.mu.RLock()
+	if !l.hasAmortized() {
+		l.mu.RUnlock()
+		return l
+	}
+	txns := make([]Transaction, 0, len(l.transactions))
+	for _, txn := range l.transactions {
+		txns = append(txns, amortize(txn.copy())...)
+	}
+	dialect, declarations := l.dialect, l.declarations
+	l.mu.RUnlock()
+
+	transactionPtrs := makeTransactionPtrs(txns)
+	Transactions(transactionPtrs).Sort()
+	idSet, _, _ := makeIDSet(transactionPtrs)
+	return &Ledger{
+		transactions: transactionPtrs,
+		idSet:        idSet,
+		dialect:      dialect,
+		declarations: declarations,
+	}
+}
+
+// hasAmortized returns true if any transactions are amortized. Must be called with the lock held.
+func (l *Ledger) hasAmortized() bool {
+	for _, txn := range l.transactions {
+		if amortizeMonths(*txn) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// amortize splits txn into one share per month. The first share keeps txn's other postings and any rounding remainder.
+func amortize(txn Transaction) []Transaction {
+	months := amortizeMonths(txn)
+	if months == 1 || !hasCategoryPosting(txn) {
+		return []Transaction{txn}
+	}
+	id := txn.ID()
+	if id == "" && len(txn.Postings) > 0 {
+		id = txn.Postings[0].ID()
+	}
+	count := decimal.New(int64(months), 0)
+	shares := make([]Transaction, months)
+	for i := range shares {
+		share := txn
+		share.Date = addMonthsClamped(txn.Date, i)
+		if txn.EffectiveDate != nil {
+			effective := addMonthsClamped(*txn.EffectiveDate, i)
+			share.EffectiveDate = &effective
+		}
+		share.Tags = map[string]string{
+			AmortizedFromTag:  id,
+			AmortizedShareTag: fmt.Sprintf("%d/%d", i+1, months),
+		}
+		if note, ok := txn.Tags[NoteTag]; ok {
+			share.Tags[NoteTag] = note
+		}
+		share.Postings = nil
+		shares[i] = share
+	}
+	if txnID := txn.ID(); txnID != "" {
+		// only the first share keeps the ID, so lookups find the real transaction's postings
+		shares[0].Tags[idTag] = txnID
+	}
+	for _, p := range txn.Postings {
+		if !isCategoryAccount(p.Account) {
+			shares[0].Postings = append(shares[0].Postings, p)
+			continue
+		}
+		amount := p.Amount.Div(count).Truncate(amortizePlaces)
+		remainder := p.Amount.Sub(amount.Mul(count.Sub(decimal.New(1, 0))))
+		for i := range shares {
+			share := p
+			share.Tags = nil
+			share.Amount = amount
+			if i == 0 {
+				share.Amount = remainder
+			}
+			shares[i].Postings = append(shares[i].Postings, share)
+		}
+	}
+	return shares
+}
+
+func hasCategoryPosting(txn Transaction) bool {
+	for _, p := range txn.Postings {
+		if isCategoryAccount(p.Account) {
+			return true
+		}
+	}
+	return false
+}
+
+func isCategoryAccount(account string) bool {
+	for _, prefix := range []string{"expenses", "revenues"} {
+		if account == prefix || strings.HasPrefix(account, prefix+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// addMonthsClamped adds 'months' to t, clamping the day to the end of shorter months. i.e. Jan 31 + 1 month is Feb 28 or 29
+func addMonthsClamped(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,108 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAmortization(t *testing.T) {
+	for _, tc := range []struct {
+		value  string
+		months int
+		err    bool
+	}{
+		{value: "12 months", months: 12},
+		{value: "1 month", months: 1},
+		{value: " 6 ", months: 6},
+		{value: "0", err: true},
+		{value: "121 months", err: true},
+		{value: "12 weeks", err: true},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			months, err := ParseAmortization(tc.value)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.months, months)
+		})
+	}
+}
+
+func TestAmortized(t *testing.T) {
+	premium := Transaction{
+		Date:  time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+		Payee: "Insurance",
+		Tags:  map[string]string{AmortizeTag: "3 months"},
+		Postings: []Posting{
+			{Account: "assets:bank", Amount: *decFloat(-100), Tags: makeIDTag("premium")},
+			{Account: "expenses:insurance", Amount: *decFloat(100)},
+		},
+	}
+	other := Transaction{
+		Date:  time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+		Payee: "Groceries",
+		Postings: []Posting{
+			{Account: "assets:bank", Amount: *decFloat(-10), Tags: makeIDTag("groceries")},
+			{Account: "expenses:food", Amount: *decFloat(10)},
+		},
+	}
+	l, err := New([]Transaction{premium, other})
+	require.NoError(t, err)
+
+	amortized := l.Amortized()
+	require.Equal(t, 4, amortized.Size())
+	assert.Equal(t, 2, l.Size(), "Amortizing should not change the ledger")
+
+	jan := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	endOfMonth := func(t time.Time) time.Time { return t.AddDate(0, 1, 0).Add(-time.Nanosecond) }
+	assert.Equal(t, "33.34", amortized.AccountBalance("expenses:insurance", jan, endOfMonth(jan)).String(), "First month should include the rounding remainder")
+	assert.Equal(t, "33.33", amortized.AccountBalance("expenses:insurance", feb, endOfMonth(feb)).String())
+	assert.Equal(t, "33.33", amortized.AccountBalance("expenses:insurance", mar, endOfMonth(mar)).String())
+	assert.Equal(t, "-100", amortized.AccountBalance("assets:bank", jan, endOfMonth(jan)).String(), "Cash should remain on the real date")
+	assert.Equal(t, "100", l.AccountBalance("expenses:insurance", jan, endOfMonth(jan)).String())
+
+	result := amortized.Query(QueryOptions{Accounts: []string{"expenses:insurance"}}, 1, 10)
+	require.Len(t, result.Transactions, 3)
+	first, last := result.Transactions[0], result.Transactions[2]
+	assert.Equal(t, premium.Date, first.Date)
+	assert.Equal(t, map[string]string{AmortizedFromTag: "premium", AmortizedShareTag: "1/3"}, first.Tags)
+	assert.Equal(t, "premium", first.Postings[0].ID(), "First share should keep the real transaction's postings")
+	assert.Equal(t, time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC), last.Date)
+	assert.Equal(t, map[string]string{AmortizedFromTag: "premium", AmortizedShareTag: "3/3"}, last.Tags)
+	feb29 := result.Transactions[1]
+	assert.Equal(t, time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC), feb29.Date, "Shares should clamp to the end of shorter months")
+
+	plain, err := New([]Transaction{other})
+	require.NoError(t, err)
+	assert.Same(t, plain, plain.Amortized())
+}
+
+func TestUpdateTransactionTags(t *testing.T) {
+	l, err := New([]Transaction{{
+		Date:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Payee: "Insurance",
+		Postings: []Posting{
+			{Account: "assets:bank", Amount: *decFloat(-600), Tags: makeIDTag("premium")},
+			{Account: "expenses:insurance", Amount: *decFloat(600)},
+		},
+	}})
+	require.NoError(t, err)
+
+	require.NoError(t, l.UpdateTransaction("premium", Transaction{Tags: map[string]string{AmortizeTag: "12 months"}}))
+	txn, _ := l.Transaction("premium")
+	assert.Equal(t, map[string]string{AmortizeTag: "12 months"}, txn.Tags)
+
+	err = l.UpdateTransaction("premium", Transaction{Tags: map[string]string{AmortizeTag: "forever"}})
+	assert.Error(t, err)
+
+	require.NoError(t, l.UpdateTransaction("premium", Transaction{Tags: map[string]string{AmortizeTag: ""}}))
+	txn, _ = l.Transaction("premium")
+	assert.Empty(t, txn.Tags)
+}
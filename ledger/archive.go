@@ -0,0 +1,123 @@
+package ledger
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const openingBalanceAccount = "equity:Opening Balances"
+
+// ArchiveBefore returns a copy of the ledger where all transactions dated before 'cutoff' are replaced by a single opening balance transaction.
+// The new opening balances contain each asset and liability account's balance at the cutoff, so balances on and after the cutoff are unchanged.
+// Also returns the removed transactions, including any previous opening balance transaction.
+func (l *Ledger) ArchiveBefore(cutoff time.Time) (remaining *Ledger, archived []Transaction, err error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.archiveBefore(cutoff)
+}
+
+// archiveInPlace replaces l's contents with ArchiveBefore's remaining ledger under a single write lock, so concurrent edits are not overwritten.
+// Returns the previous contents for rolling back with Replace.
+func (l *Ledger) archiveInPlace(cutoff time.Time) (previous *Ledger, archived []Transaction, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	remaining, archived, err := l.archiveBefore(cutoff)
+	if err != nil {
+		return nil, nil, err
+	}
+	previous = &Ledger{
+		transactions: l.transactions,
+		idSet:        l.idSet,
+		assertions:   l.assertions,
+		declarations: l.declarations,
+	}
+	l.transactions, l.idSet, l.assertions = remaining.transactions, remaining.idSet, remaining.assertions
+	return previous, archived, nil
+}
+
+func (l *Ledger) archiveBefore(cutoff time.Time) (remaining *Ledger, archived []Transaction, err error) {
+	cutoff = startOfDay(cutoff)
+	var kept Transactions
+	var keptOpening *Transaction
+	balances := make(map[string]decimal.Decimal)
+	currencies := make(map[string]string)
+	for _, txn := range l.transactions {
+		if !txn.Date.Before(cutoff) {
+			if isOpeningTransaction(*txn) {
+				keptOpening = txn
+			}
+			kept = append(kept, txn)
+			continue
+		}
+		archived = append(archived, *txn)
+		for _, p := range txn.Postings {
+			if isBalanceAccount(p.Account) {
+				balances[p.Account] = balances[p.Account].Add(p.Amount)
+				currencies[p.Account] = p.Currency
+			}
+		}
+	}
+	if len(archived) == 0 {
+		return nil, nil, errors.Errorf("No transactions found before %s", cutoff.Format(DateFormat))
+	}
+	if keptOpening != nil {
+		return nil, nil, errors.Errorf("Opening balances must be before the archive date: %s", keptOpening.Date.Format(DateFormat))
+	}
+
+	accounts := make([]string, 0, len(balances))
+	for account, balance := range balances {
+		if !balance.IsZero() {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Strings(accounts)
+	opening := Transaction{
+		Date:  cutoff,
+		Payee: "* Opening Balance",
+	}
+	var total decimal.Decimal
+	for _, account := range accounts {
+		currency := currencies[account]
+		if currency == "" {
+			currency = usd
+		}
+		opening.Postings = append(opening.Postings, Posting{
+			Account:  account,
+			Amount:   balances[account],
+			Currency: currency,
+		})
+		total = total.Sub(balances[account])
+	}
+	opening.Postings = append(opening.Postings, Posting{
+		Account:  openingBalanceAccount,
+		Amount:   total,
+		Currency: usd,
+		Tags:     map[string]string{idTag: OpeningBalanceID},
+	})
+
+	newTransactions := kept
+	if len(accounts) > 0 {
+		// opening balances come first on the cutoff date
+		newTransactions = append(Transactions{&opening}, kept...)
+	}
+	idSet, _, duplicates := makeIDSet(newTransactions)
+	if len(duplicates) > 0 {
+		return nil, nil, duplicateTransactionError(duplicates[0])
+	}
+	remaining = &Ledger{
+		transactions: newTransactions,
+		idSet:        idSet,
+		dialect:      l.dialect,
+		declarations: l.declarations,
+	}
+	if len(l.assertions) > 0 {
+		remaining.assertions = make(map[string]Transaction, len(l.assertions))
+		for account, assertion := range l.assertions {
+			remaining.assertions[account] = assertion
+		}
+	}
+	return remaining, archived, nil
+}
@@ -0,0 +1,150 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func archiveTxns(t *testing.T) []Transaction {
+	return []Transaction{
+		{
+			Date:  parseDate(t, "2019/12/01"),
+			Payee: "* Opening Balance",
+			Postings: []Posting{
+				{Account: "assets:Bank", Amount: *decFloat(100), Currency: usd},
+				{Account: openingBalanceAccount, Amount: *decFloat(-100), Currency: usd, Tags: makeIDTag(OpeningBalanceID)},
+			},
+		},
+		{
+			Date:  parseDate(t, "2019/12/15"),
+			Payee: "Groceries",
+			Postings: []Posting{
+				{Account: "liabilities:Credit Card", Amount: *decFloat(-30), Currency: usd, Tags: makeIDTag("1")},
+				{Account: "expenses:food", Amount: *decFloat(30), Currency: usd},
+			},
+		},
+		{
+			Date:  parseDate(t, "2019/12/20"),
+			Payee: "Pay card",
+			Postings: []Posting{
+				{Account: "assets:Bank", Amount: *decFloat(-30), Currency: usd, Tags: makeIDTag("2")},
+				{Account: "liabilities:Credit Card", Amount: *decFloat(30), Currency: usd},
+			},
+		},
+		{
+			Date:  parseDate(t, "2020/01/01"),
+			Payee: "Paycheck",
+			Postings: []Posting{
+				{Account: "assets:Bank", Amount: *decFloat(50), Currency: usd, Tags: makeIDTag("3")},
+				{Account: "revenues:work", Amount: *decFloat(-50), Currency: usd},
+			},
+		},
+	}
+}
+
+func TestArchiveBefore(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		txns := archiveTxns(t)
+		ldg, err := New(txns)
+		require.NoError(t, err)
+
+		remaining, archived, err := ldg.ArchiveBefore(parseDate(t, "2020/01/01"))
+		require.NoError(t, err)
+		assert.Equal(t, txns[:3], archived)
+		assert.Equal(t, 4, ldg.Size(), "Original ledger must not be modified")
+
+		opening, found := remaining.OpeningBalances()
+		require.True(t, found)
+		assert.Equal(t, parseDate(t, "2020/01/01"), opening.Date)
+		require.Len(t, opening.Postings, 2)
+		assert.Equal(t, "assets:Bank", opening.Postings[0].Account)
+		assert.Equal(t, "70", opening.Postings[0].Amount.String())
+		assert.Equal(t, openingBalanceAccount, opening.Postings[1].Account)
+		assert.Equal(t, "-70", opening.Postings[1].Amount.String())
+		assert.Equal(t, []Transaction{opening, txns[3]}, dereferenceTransactions(remaining.transactions))
+
+		_, _, balances := remaining.Balances()
+		assert.Equal(t, "120", balances["assets:Bank"][0].String())
+		assert.NoError(t, remaining.Validate())
+	})
+
+	t.Run("nothing to archive", func(t *testing.T) {
+		ldg, err := New(archiveTxns(t))
+		require.NoError(t, err)
+		_, _, err = ldg.ArchiveBefore(parseDate(t, "2019/01/01"))
+		require.Error(t, err)
+		assert.Equal(t, "No transactions found before 2019/01/01", err.Error())
+	})
+
+	t.Run("opening balance after cutoff", func(t *testing.T) {
+		txns := append([]Transaction{{
+			Date:  parseDate(t, "2019/11/15"),
+			Payee: "Before opening",
+			Postings: []Posting{
+				{Account: "assets:Bank", Amount: *decFloat(-5), Currency: usd, Tags: makeIDTag("0")},
+				{Account: "expenses:food", Amount: *decFloat(5), Currency: usd},
+			},
+		}}, archiveTxns(t)...)
+		ldg, err := New(txns)
+		require.NoError(t, err)
+		_, _, err = ldg.ArchiveBefore(parseDate(t, "2019/11/20"))
+		require.Error(t, err)
+		assert.Equal(t, "Opening balances must be before the archive date: 2019/12/01", err.Error())
+	})
+}
+
+func TestStoreArchiveBefore(t *testing.T) {
+	t.Run("no archive file", func(t *testing.T) {
+		store := starterStore(t)
+		_, err := store.ArchiveBefore(parseDate(t, "2020/01/01"))
+		require.Error(t, err)
+		assert.Equal(t, "No archive file is configured", err.Error())
+	})
+
+	t.Run("happy path", func(t *testing.T) {
+		store := starterStore(t)
+		require.NoError(t, store.Ledger.AddTransactions(archiveTxns(t)))
+		archiveFile := &mockFile{}
+		store.SetArchiveFile(archiveFile)
+
+		archived, err := store.ArchiveBefore(parseDate(t, "2020/01/01"))
+		require.NoError(t, err)
+		assert.Equal(t, 3, archived)
+		assert.Equal(t, 2, store.Size())
+		assert.True(t, store.startSync(), "Syncs should resume after archiving")
+
+		archiveLdg, err := NewFromReader(strings.NewReader(archiveFile.buf.String()))
+		require.NoError(t, err)
+		assert.Equal(t, 3, archiveLdg.Size())
+	})
+
+	t.Run("archive write failure", func(t *testing.T) {
+		store := starterStore(t)
+		require.NoError(t, store.Ledger.AddTransactions(archiveTxns(t)))
+		store.SetArchiveFile(&mockFile{writeErr: errors.New("some error")})
+
+		_, err := store.ArchiveBefore(parseDate(t, "2020/01/01"))
+		require.Error(t, err)
+		assert.Equal(t, "Error writing ledger archive: some error", err.Error())
+		assert.Equal(t, 4, store.Size(), "Ledger must not change if the archive fails")
+	})
+
+	t.Run("ledger write failure", func(t *testing.T) {
+		store := starterStore(t)
+		require.NoError(t, store.Ledger.AddTransactions(archiveTxns(t)))
+		store.syncFile = func() error { return errors.New("some error") }
+		archiveFile := &mockFile{}
+		require.NoError(t, archiveFile.Write([]byte("; previous archive\n")))
+		store.SetArchiveFile(archiveFile)
+
+		_, err := store.ArchiveBefore(parseDate(t, "2020/01/01"))
+		require.Error(t, err)
+		assert.Equal(t, "some error", err.Error())
+		assert.Equal(t, 4, store.Size(), "Ledger must not change if the ledger write fails")
+		assert.Equal(t, "; previous archive\n", archiveFile.buf.String(), "Archive must be restored if the ledger write fails")
+	})
+}
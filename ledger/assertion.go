@@ -0,0 +1,135 @@
+package ledger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// AssertionDialect selects the plain-text accounting syntax used for balance assertions
+type AssertionDialect string
+
+const (
+	// LedgerDialect writes ledger-cli balance assertions, e.g. "= $ 100"
+	LedgerDialect AssertionDialect = "ledger"
+	// HledgerDialect writes hledger total balance assertions, e.g. "== $ 100"
+	HledgerDialect AssertionDialect = "hledger"
+
+	assertionTag   = "sage_assertion"
+	assertionPayee = "Balance assertion"
+)
+
+// ParseAssertionDialect returns the dialect matching 'dialect', defaults to ledger-cli if empty
+func ParseAssertionDialect(dialect string) (AssertionDialect, error) {
+	switch AssertionDialect(dialect) {
+	case "", LedgerDialect:
+		return LedgerDialect, nil
+	case HledgerDialect:
+		return HledgerDialect, nil
+	default:
+		return "", errors.Errorf("Unrecognized balance assertion dialect: %q. Must be %q or %q", dialect, LedgerDialect, HledgerDialect)
+	}
+}
+
+// NewBalanceAssertion returns a Sage-generated balance assertion for 'account' as of 'date'
+// The assertion is a single, zero-amount posting asserting the account's balance.
+func NewBalanceAssertion(account string, date time.Time, balance decimal.Decimal, currency string) Transaction {
+	return Transaction{
+		Date:  date,
+		Payee: assertionPayee,
+		Tags:  map[string]string{assertionTag: "true"},
+		Postings: []Posting{
+			{
+				Account:  account,
+				Balance:  &balance,
+				Currency: currency,
+			},
+		},
+	}
+}
+
+// IsBalanceAssertion returns true if txn is a Sage-generated balance assertion
+func IsBalanceAssertion(txn Transaction) bool {
+	return txn.Tags[assertionTag] != "" && len(txn.Postings) == 1 && txn.Postings[0].Balance != nil
+}
+
+// SplitBalanceAssertions separates Sage-generated balance assertions from regular transactions
+func SplitBalanceAssertions(txns []Transaction) (transactions, assertions []Transaction) {
+	transactions = make([]Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if IsBalanceAssertion(txn) {
+			assertions = append(assertions, txn)
+		} else {
+			transactions = append(transactions, txn)
+		}
+	}
+	return transactions, assertions
+}
+
+// BalanceAssertions returns the current balance assertion for each account
+func (l *Ledger) BalanceAssertions() []Transaction {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	assertions := make([]Transaction, 0, len(l.assertions))
+	for _, assertion := range l.assertions {
+		assertions = append(assertions, assertion)
+	}
+	sortAssertions(assertions)
+	return assertions
+}
+
+// SetAssertionDialect changes the balance assertion syntax used when writing the ledger
+func (l *Ledger) SetAssertionDialect(dialect AssertionDialect) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dialect = dialect
+}
+
+// setAssertions replaces any older assertions for the same accounts. Must be called with the write lock held.
+func (l *Ledger) setAssertions(assertions []Transaction) {
+	if len(assertions) == 0 {
+		return
+	}
+	if l.assertions == nil {
+		l.assertions = make(map[string]Transaction)
+	}
+	for _, assertion := range assertions {
+		assertion.Date = assertion.Date.UTC()
+		account := assertion.Postings[0].Account
+		if previous, exists := l.assertions[account]; exists && assertion.Date.Before(previous.Date) {
+			continue
+		}
+		l.assertions[account] = assertion
+	}
+}
+
+func sortAssertions(assertions []Transaction) {
+	ptrs := makeTransactionPtrs(assertions)
+	Transactions(ptrs).Sort()
+	sorted := dereferenceTransactions(ptrs)
+	copy(assertions, sorted)
+}
+
+// assertionString formats a balance assertion for the given dialect
+func assertionString(assertion Transaction, dialect AssertionDialect) string {
+	p := assertion.Postings[0]
+	operator := "="
+	if dialect == HledgerDialect {
+		operator = "=="
+	}
+	return fmt.Sprintf(
+		"%4d/%02d/%02d %s%s\n    %s  %s 0 %s %s %s\n",
+		assertion.Date.Year(),
+		assertion.Date.Month(),
+		assertion.Date.Day(),
+		assertion.Payee,
+		serializeComment(assertion.Comment, assertion.Tags),
+		p.Account,
+		p.Currency,
+		operator,
+		p.Currency,
+		p.Balance.String(),
+	)
+}
@@ -0,0 +1,92 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAssertionDialect(t *testing.T) {
+	for _, tc := range []struct {
+		dialect       string
+		expectDialect AssertionDialect
+		expectErr     bool
+	}{
+		{dialect: "", expectDialect: LedgerDialect},
+		{dialect: "ledger", expectDialect: LedgerDialect},
+		{dialect: "hledger", expectDialect: HledgerDialect},
+		{dialect: "beancount", expectErr: true},
+	} {
+		t.Run(tc.dialect, func(t *testing.T) {
+			dialect, err := ParseAssertionDialect(tc.dialect)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectDialect, dialect)
+		})
+	}
+}
+
+func TestBalanceAssertions(t *testing.T) {
+	const account = "assets:Super Bank:****1234"
+	txn := Transaction{
+		Date:  parseDate(t, "2020/01/02"),
+		Payee: "some payee",
+		Postings: []Posting{
+			{Account: account, Amount: *decFloat(-10), Currency: usd, Tags: makeIDTag("1")},
+			{Account: "expenses:food", Amount: *decFloat(10), Currency: usd},
+		},
+	}
+	laterTxn := txn
+	laterTxn.Date = parseDate(t, "2020/01/03")
+	laterTxn.Postings = []Posting{
+		{Account: account, Amount: *decFloat(-5), Currency: usd, Tags: makeIDTag("2")},
+		{Account: "expenses:food", Amount: *decFloat(5), Currency: usd},
+	}
+	oldAssertion := NewBalanceAssertion(account, parseDate(t, "2020/01/01"), *decFloat(100), usd)
+	assertion := NewBalanceAssertion(account, parseDate(t, "2020/01/02"), *decFloat(90), usd)
+
+	ldg, err := New([]Transaction{txn, laterTxn, oldAssertion})
+	require.NoError(t, err)
+	assert.Equal(t, 2, ldg.Size())
+	require.NoError(t, ldg.AddTransactions([]Transaction{assertion}))
+	require.NoError(t, ldg.AddTransactions([]Transaction{oldAssertion}))
+	assert.Equal(t, []Transaction{assertion}, ldg.BalanceAssertions(), "Older assertions should not replace newer ones")
+
+	for _, tc := range []struct {
+		dialect        AssertionDialect
+		expectAsserted string
+	}{
+		{LedgerDialect, "$ 0 = $ 90"},
+		{HledgerDialect, "$ 0 == $ 90"},
+	} {
+		t.Run(string(tc.dialect), func(t *testing.T) {
+			ldg.SetAssertionDialect(tc.dialect)
+			ldgStr := ldg.String()
+			assert.Equal(t, strings.Join([]string{
+				txn.String(),
+				"2020/01/02 Balance assertion ; sage_assertion: true\n    " + account + "  " + tc.expectAsserted + "\n",
+				laterTxn.String(),
+			}, "\n")+"\n", ldgStr)
+
+			readLdg, err := NewFromReader(strings.NewReader(ldgStr))
+			require.NoError(t, err)
+			assert.Equal(t, 2, readLdg.Size())
+			readAssertions := readLdg.BalanceAssertions()
+			require.Len(t, readAssertions, 1)
+			assert.Equal(t, account, readAssertions[0].Postings[0].Account)
+			assert.Equal(t, "90", readAssertions[0].Postings[0].Balance.String())
+		})
+	}
+
+	t.Run("rename account", func(t *testing.T) {
+		ldg.RenameAccount("assets:Super Bank", "assets:Super Duper Bank", "", "")
+		assertions := ldg.BalanceAssertions()
+		require.Len(t, assertions, 1)
+		assert.Equal(t, "assets:Super Duper Bank:****1234", assertions[0].Postings[0].Account)
+	})
+}
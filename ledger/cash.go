@@ -0,0 +1,40 @@
+package ledger
+
+import (
+	"time"
+)
+
+const (
+	// CashAccount is the wallet account tracking cash on hand. Accounts can route their ATM withdrawals into it as transfers, then cash spending is recorded against it by hand.
+	CashAccount = "assets:Cash"
+	// UnaccountedCashAccount is the other side of cash balance adjustments, for cash spending that was never recorded
+	UnaccountedCashAccount = "expenses:Cash:Unaccounted"
+)
+
+// IsCashAccount returns true if 'account' is CashAccount or one of its subaccounts
+func IsCashAccount(account string) bool {
+	_, isCash := ReplaceAccountPrefix(account, CashAccount, CashAccount)
+	return isCash
+}
+
+// LastSyncedTransactionTime is like LastTransactionTime, but skips transactions posting to the cash wallet.
+// Cash is recorded by hand, often after the fact, so it must not move the start of the next sync past institutions' newer transactions.
+func (l *Ledger) LastSyncedTransactionTime() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for i := len(l.transactions) - 1; i >= 0; i-- {
+		if !postsToCash(l.transactions[i]) {
+			return l.transactions[i].Date
+		}
+	}
+	return time.Time{}
+}
+
+func postsToCash(txn *Transaction) bool {
+	for _, p := range txn.Postings {
+		if IsCashAccount(p.Account) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsCashAccount(t *testing.T) {
+	assert.True(t, IsCashAccount(CashAccount))
+	assert.True(t, IsCashAccount("Assets:cash"))
+	assert.True(t, IsCashAccount("assets:Cash:Wallet"))
+	assert.False(t, IsCashAccount("assets:Cash Back"))
+	assert.False(t, IsCashAccount(UnaccountedCashAccount))
+}
+
+func TestLastSyncedTransactionTime(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(`
+2020/01/02 Corner Bank
+    assets:Bank   $-40 ; id: atm
+    assets:Cash
+
+2020/01/03 Paycheck
+    assets:Bank   $100 ; id: pay
+    revenues:salary
+
+2020/01/10 Lunch
+    assets:Cash   $-10 ; id: lunch
+    expenses:food
+`))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC), ldg.LastTransactionTime())
+	assert.Equal(t, time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), ldg.LastSyncedTransactionTime(), "Cash transactions should not move the next sync's start date")
+
+	ldg, err = New(nil)
+	require.NoError(t, err)
+	assert.Zero(t, ldg.LastSyncedTransactionTime())
+}
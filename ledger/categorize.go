@@ -0,0 +1,63 @@
+package ledger
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Categorization statuses, one for each requested transaction
+const (
+	CategorizeApplied   = "applied"
+	CategorizeNotFound  = "not found"
+	CategorizeSplit     = "split"
+	CategorizeUnchanged = "unchanged"
+	// CategorizeAlreadyCategorized means the transaction was categorized since it was exported, like by a sync
+	CategorizeAlreadyCategorized = "already categorized"
+)
+
+// ValidateCategory returns an error if 'category' can't be written as a posting's account name
+func ValidateCategory(category string) error {
+	if strings.ContainsAny(category, ";\t\r\n") {
+		return errors.Errorf("Category must not contain semicolons, tabs, or line breaks: %q", category)
+	}
+	normalized := NormalizeAccountName(category)
+	if normalized == "" {
+		return errors.New("Category must not be empty")
+	}
+	for _, component := range strings.Split(normalized, ":") {
+		if component == "" {
+			return errors.Errorf("Category must not have empty components between colons: %q", category)
+		}
+	}
+	return nil
+}
+
+// Categorize replaces the category posting of each transaction ID in 'categories', and returns each ID's categorization status.
+// Transactions are only changed if isUncategorized returns true for their current category, unless 'overwrite' is set.
+// Checks and changes happen under one lock, so a sync can't categorize a transaction between the check and the change.
+// Categories must be valid, see ValidateCategory.
+func (l *Ledger) Categorize(categories map[string]string, isUncategorized func(account string) bool, overwrite bool) map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	results := make(map[string]string, len(categories))
+	for id, category := range categories {
+		txn := l.idSet[id]
+		switch {
+		case txn == nil:
+			results[id] = CategorizeNotFound
+		case len(txn.Postings) != 2:
+			results[id] = CategorizeSplit
+		case txn.Postings[1].Account == NormalizeAccountName(category):
+			results[id] = CategorizeUnchanged
+		case !overwrite && !isUncategorized(txn.Postings[1].Account):
+			results[id] = CategorizeAlreadyCategorized
+		default:
+			updated := txn.copy()
+			updated.Postings[1].Account = NormalizeAccountName(category)
+			*txn = updated
+			results[id] = CategorizeApplied
+		}
+	}
+	return results
+}
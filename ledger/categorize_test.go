@@ -0,0 +1,72 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCategory(t *testing.T) {
+	assert.NoError(t, ValidateCategory("expenses:food"))
+	assert.NoError(t, ValidateCategory(" expenses : eating  out "))
+	for _, invalid := range []string{"", "  ", "expenses::food", "expenses:", "food; type: X", "food\tgroceries", "food\n"} {
+		assert.Error(t, ValidateCategory(invalid), "%q", invalid)
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(`
+2019/01/02 Groceries
+    assets:bank   $-10 ; id: groceries
+    uncategorized
+
+2019/01/03 Restaurant
+    assets:bank   $-20 ; id: restaurant
+    expenses:uncategorized
+
+2019/01/04 Paycheck
+    assets:bank   $100 ; id: paycheck
+    revenues:salary
+
+2019/01/05 Split
+    assets:bank   $-30 ; id: split
+    expenses:food   $20
+    expenses:home
+`))
+	require.NoError(t, err)
+	isUncategorized := func(account string) bool {
+		return account == "uncategorized" || account == "expenses:uncategorized"
+	}
+
+	results := ldg.Categorize(map[string]string{
+		"groceries":  "expenses:food",
+		"restaurant": "expenses:eating  out",
+		"paycheck":   "revenues:bonus",
+		"split":      "expenses:food",
+		"missing":    "expenses:food",
+	}, isUncategorized, false)
+	assert.Equal(t, map[string]string{
+		"groceries":  CategorizeApplied,
+		"restaurant": CategorizeApplied,
+		"paycheck":   CategorizeAlreadyCategorized,
+		"split":      CategorizeSplit,
+		"missing":    CategorizeNotFound,
+	}, results)
+	txn, _ := ldg.Transaction("restaurant")
+	assert.Equal(t, "expenses:eating out", txn.Postings[1].Account)
+	txn, _ = ldg.Transaction("paycheck")
+	assert.Equal(t, "revenues:salary", txn.Postings[1].Account)
+
+	results = ldg.Categorize(map[string]string{
+		"groceries": "expenses:food",
+		"paycheck":  "revenues:bonus",
+	}, isUncategorized, true)
+	assert.Equal(t, map[string]string{
+		"groceries": CategorizeUnchanged,
+		"paycheck":  CategorizeApplied,
+	}, results)
+	txn, _ = ldg.Transaction("paycheck")
+	assert.Equal(t, "revenues:bonus", txn.Postings[1].Account)
+}
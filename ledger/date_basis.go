@@ -0,0 +1,35 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DateBasis selects which of a transaction's dates to use when grouping it by time
+type DateBasis string
+
+const (
+	// PostingBasis uses the date the transaction posted to the account
+	PostingBasis DateBasis = "posting"
+	// EffectiveBasis uses the transaction's effective (auxiliary) date, falling back to its posting date
+	EffectiveBasis DateBasis = "effective"
+)
+
+// ParseDateBasis returns the DateBasis named 'basis'
+func ParseDateBasis(basis string) (DateBasis, error) {
+	switch DateBasis(basis) {
+	case PostingBasis, EffectiveBasis:
+		return DateBasis(basis), nil
+	default:
+		return "", errors.Errorf("Invalid date basis, must be %q or %q: %q", PostingBasis, EffectiveBasis, basis)
+	}
+}
+
+// DateFor returns t's date for 'basis'. Transactions without an effective date always use their posting date.
+func (t Transaction) DateFor(basis DateBasis) time.Time {
+	if basis == EffectiveBasis && t.EffectiveDate != nil {
+		return *t.EffectiveDate
+	}
+	return t.Date
+}
@@ -0,0 +1,417 @@
+package ledger
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// minPayeeSimilarity is the lowest payee similarity, from 0 to 1, for two transactions to count as duplicates
+	minPayeeSimilarity = 0.8
+	// minPayeeContainsLength is the shortest normalized payee which may match a longer payee containing it, e.g. "amazon" in "amazon mktp"
+	minPayeeContainsLength = 4
+)
+
+// ErrStaleDedupe is returned when the ledger's duplicates changed since the dry run which produced the dedupe token
+var ErrStaleDedupe = errors.New("Duplicates changed since the dry run, review them again before removing")
+
+// DuplicateCluster is a set of transactions which appear to be the same transaction imported more than once
+type DuplicateCluster struct {
+	// ID is a hash of the cluster's transactions, which changes if any of them change
+	ID      string
+	Account string
+	Date    time.Time
+	Amount  decimal.Decimal
+	// Score is the lowest payee similarity between the kept transaction and a duplicate, from 0 to 1. Identical IDs score 1.
+	Score float64
+	// Keep is the transaction which remains after deduping, preferring one with notes, tags, or a cleared status
+	Keep   Transaction
+	Remove []Transaction
+	// Merged lists the tags copied from duplicates onto the kept transaction
+	Merged []string `json:",omitempty"`
+	// Conflict explains why the cluster must be reviewed by hand, i.e. more than one transaction has different user edits
+	Conflict string `json:",omitempty"`
+}
+
+// DedupeReport describes duplicate transactions in the ledger and what deduping changes
+type DedupeReport struct {
+	// Clusters are the duplicates which can be removed automatically
+	Clusters []DuplicateCluster
+	// Conflicts are the duplicates which must be resolved by hand. They are never removed.
+	Conflicts []DuplicateCluster
+	// Impact is the total amount removed from each account's balance, the sum of the removed duplicates' postings
+	Impact map[string]decimal.Decimal
+	// Token identifies this set of clusters. Removing duplicates requires the token from a dry run.
+	Token string
+	// Removed is the number of transactions removed, only set once applied
+	Removed int
+	// Snapshot is the snapshot ID of the ledger file before removing duplicates
+	Snapshot string `json:",omitempty"`
+}
+
+// FindDuplicates scans for transactions in the same account with identical amounts and dates, and either similar payees or identical IDs.
+// Does not modify the ledger.
+func (l *Ledger) FindDuplicates() DedupeReport {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	report, _ := l.findDuplicates()
+	return report
+}
+
+// Dedupe removes the duplicates found by FindDuplicates and merges their notes and tags onto the kept transactions.
+// Returns ErrStaleDedupe if 'token' doesn't match the current report's token.
+func (l *Ledger) Dedupe(token string) (DedupeReport, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	report, clusters := l.findDuplicates()
+	if token == "" || token != report.Token {
+		return report, ErrStaleDedupe
+	}
+
+	removed := make(map[*Transaction]bool)
+	for i, cluster := range clusters {
+		keep := cluster[0]
+		merged := keep.copy()
+		for _, txn := range cluster[1:] {
+			mergeDuplicateTags(&merged, *txn)
+			removed[txn] = true
+		}
+		*keep = merged
+		report.Clusters[i].Keep = merged.copy()
+	}
+	remaining := make([]*Transaction, 0, len(l.transactions))
+	for _, txn := range l.transactions {
+		if !removed[txn] {
+			remaining = append(remaining, txn)
+		}
+	}
+	for id, txn := range l.idSet {
+		if removed[txn] {
+			delete(l.idSet, id)
+		}
+	}
+	for _, cluster := range clusters {
+		// duplicates may share the kept transaction's IDs
+		for _, id := range transactionIDs(*cluster[0]) {
+			l.idSet[id] = cluster[0]
+		}
+	}
+	l.transactions = remaining
+	report.Removed = len(removed)
+	return report, nil
+}
+
+// findDuplicates returns the dedupe report and the transactions in each of its Clusters, kept transaction first. Must be called with the lock held.
+func (l *Ledger) findDuplicates() (DedupeReport, [][]*Transaction) {
+	groups := make(map[string][]*Transaction)
+	var groupKeys []string
+	for _, txn := range l.transactions {
+		if len(txn.Postings) == 0 || IsBalanceAssertion(*txn) || isOpeningTransaction(*txn) || IsSimulated(*txn) {
+			continue
+		}
+		key := duplicateKey(*txn)
+		if _, exists := groups[key]; !exists {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], txn)
+	}
+
+	report := DedupeReport{Impact: make(map[string]decimal.Decimal)}
+	var clusters [][]*Transaction
+	var tokenParts []string
+	for _, key := range groupKeys {
+		for _, members := range clusterDuplicates(groups[key]) {
+			cluster, ordered := newDuplicateCluster(members)
+			if cluster.Conflict != "" {
+				report.Conflicts = append(report.Conflicts, cluster)
+				continue
+			}
+			report.Clusters = append(report.Clusters, cluster)
+			clusters = append(clusters, ordered)
+			tokenParts = append(tokenParts, cluster.ID)
+			for _, txn := range cluster.Remove {
+				for _, p := range txn.Postings {
+					report.Impact[p.Account] = report.Impact[p.Account].Add(p.Amount)
+				}
+			}
+		}
+	}
+	if len(report.Clusters) > 0 {
+		report.Token = shortHash(strings.Join(tokenParts, ","))
+	}
+	return report, clusters
+}
+
+// duplicateKey groups transactions by their first posting's account, date, and amount
+func duplicateKey(txn Transaction) string {
+	p := txn.Postings[0]
+	return strings.Join([]string{p.Account, txn.Date.Format("2006-01-02"), p.Currency, p.Amount.String()}, ";")
+}
+
+// clusterDuplicates links transactions with similar payees or a shared ID, and returns each linked set of 2 or more transactions in ledger order
+func clusterDuplicates(txns []*Transaction) [][]*Transaction {
+	if len(txns) < 2 {
+		return nil
+	}
+	parents := make([]int, len(txns))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+	for a := range txns {
+		for b := a + 1; b < len(txns); b++ {
+			if duplicateScore(*txns[a], *txns[b]) >= minPayeeSimilarity {
+				parents[find(b)] = find(a)
+			}
+		}
+	}
+	sets := make(map[int][]*Transaction)
+	var roots []int
+	for i, txn := range txns {
+		root := find(i)
+		if _, exists := sets[root]; !exists {
+			roots = append(roots, root)
+		}
+		sets[root] = append(sets[root], txn)
+	}
+	var clusters [][]*Transaction
+	for _, root := range roots {
+		if len(sets[root]) > 1 {
+			clusters = append(clusters, sets[root])
+		}
+	}
+	return clusters
+}
+
+// newDuplicateCluster chooses the transaction to keep from 'members' and describes the cluster.
+// Returns the members reordered with the kept transaction first.
+func newDuplicateCluster(members []*Transaction) (DuplicateCluster, []*Transaction) {
+	keepIndex := 0
+	for i, txn := range members {
+		if userEditScore(*txn) > userEditScore(*members[keepIndex]) {
+			keepIndex = i
+		}
+	}
+	ordered := append([]*Transaction{members[keepIndex]}, members[:keepIndex]...)
+	ordered = append(ordered, members[keepIndex+1:]...)
+
+	keep := ordered[0]
+	cluster := DuplicateCluster{
+		Account:  keep.Postings[0].Account,
+		Date:     keep.Date,
+		Amount:   keep.Postings[0].Amount,
+		Score:    1,
+		Keep:     keep.copy(),
+		Conflict: duplicateConflict(ordered),
+	}
+	revisions := []string{keep.Revision()}
+	merged := keep.copy()
+	for _, txn := range ordered[1:] {
+		if score := duplicateScore(*keep, *txn); score < cluster.Score {
+			cluster.Score = score
+		}
+		cluster.Remove = append(cluster.Remove, txn.copy())
+		cluster.Merged = append(cluster.Merged, mergeDuplicateTags(&merged, *txn)...)
+		revisions = append(revisions, txn.Revision())
+	}
+	sort.Strings(cluster.Merged)
+	cluster.ID = shortHash(strings.Join(revisions, ","))
+	return cluster, ordered
+}
+
+// duplicateScore returns how likely 'a' and 'b' are the same transaction, from 0 to 1. Shared IDs score 1.
+func duplicateScore(a, b Transaction) float64 {
+	for _, idA := range transactionIDs(a) {
+		for _, idB := range transactionIDs(b) {
+			if idA == idB {
+				return 1
+			}
+		}
+	}
+	return payeeSimilarity(a.Payee, b.Payee)
+}
+
+// transactionIDs returns all of txn's transaction and posting IDs
+func transactionIDs(txn Transaction) []string {
+	var ids []string
+	if id := txn.ID(); id != "" {
+		ids = append(ids, id)
+	}
+	for _, p := range txn.Postings {
+		if id := p.ID(); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// payeeSimilarity compares payees ignoring case, punctuation, and spacing. Returns 1 for identical payees and 0 for entirely different ones.
+func payeeSimilarity(a, b string) float64 {
+	a, b = normalizePayee(a), normalizePayee(b)
+	if a == b {
+		return 1
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) >= minPayeeContainsLength && strings.Contains(b, a) {
+		return minPayeeSimilarity
+	}
+	runesA, runesB := []rune(a), []rune(b)
+	return 1 - float64(editDistance(runesA, runesB))/float64(len(runesB))
+}
+
+func normalizePayee(payee string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, payee)
+}
+
+// editDistance returns the Levenshtein distance between 'a' and 'b'
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// userTags returns txn's tags set by the user, like notes and transfer marks. IDs and the reconciliation status are excluded.
+func userTags(txn Transaction) map[string]string {
+	tags := make(map[string]string)
+	for key, value := range txn.Tags {
+		if key == idTag || key == StatusTag || isLegacyIDTagKey(key) {
+			continue
+		}
+		tags[key] = value
+	}
+	return tags
+}
+
+func isLegacyIDTagKey(key string) bool {
+	for _, legacyKey := range legacyIDTags {
+		if key == legacyKey {
+			return true
+		}
+	}
+	return false
+}
+
+// userEditScore ranks how much the user changed 'txn', so the most edited duplicate is kept
+func userEditScore(txn Transaction) int {
+	score := 0
+	if txn.Note() != "" {
+		score += 4
+	}
+	if len(userTags(txn)) > 0 {
+		score += 2
+	}
+	return score + statusRank(txn.Status())
+}
+
+// statusRank orders reconciliation statuses from uncleared to reconciled
+func statusRank(status string) int {
+	switch status {
+	case StatusReconciled:
+		return 2
+	case StatusCleared:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// duplicateConflict returns a reason the cluster must be reviewed by hand, or an empty string if its user edits can be merged
+func duplicateConflict(txns []*Transaction) string {
+	values := make(map[string]string)
+	var categories string
+	for i, txn := range txns {
+		for key, value := range userTags(*txn) {
+			if existing, ok := values[key]; ok && existing != value {
+				if key == NoteTag {
+					return "Duplicates have different notes"
+				}
+				return "Duplicates have different " + key + " tags"
+			}
+			values[key] = value
+		}
+		var accounts []string
+		for _, p := range txn.Postings[1:] {
+			accounts = append(accounts, p.Account)
+		}
+		txnCategories := strings.Join(accounts, ",")
+		if i > 0 && txnCategories != categories {
+			return "Duplicates have different categories"
+		}
+		categories = txnCategories
+	}
+	return ""
+}
+
+// mergeDuplicateTags copies the user tags 'keep' doesn't have from 'duplicate', and keeps the more reconciled status. Returns the merged tag keys.
+func mergeDuplicateTags(keep *Transaction, duplicate Transaction) []string {
+	var merged []string
+	for key, value := range userTags(duplicate) {
+		if _, exists := keep.Tags[key]; !exists {
+			setTag(keep, key, value)
+			merged = append(merged, key)
+		}
+	}
+	if statusRank(duplicate.Status()) > statusRank(keep.Status()) {
+		setTag(keep, StatusTag, duplicate.Status())
+		merged = append(merged, StatusTag)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// Dedupe snapshots the ledger file, then removes the duplicates found by a dry run with the same 'token'
+func (s *Store) Dedupe(token string) (DedupeReport, error) {
+	report := s.FindDuplicates()
+	if token == "" || token != report.Token {
+		return report, ErrStaleDedupe
+	}
+	snapshot, err := s.snapshotFile()
+	if err != nil {
+		return DedupeReport{}, errors.Wrap(err, "Failed to snapshot ledger before removing duplicates")
+	}
+	report, err = s.Ledger.Dedupe(token)
+	if err != nil {
+		return report, err
+	}
+	report.Snapshot = snapshot
+	return report, s.syncFile()
+}
@@ -0,0 +1,123 @@
+package ledger
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/vcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func dedupeFixture() []Transaction {
+	date := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	makeTxn := func(id, payee string, amount float64, tags map[string]string) Transaction {
+		return Transaction{
+			Date:  date,
+			Payee: payee,
+			Postings: []Posting{
+				{Account: "assets:Bank", Amount: *decFloat(amount), Currency: usd, Tags: makeIDTag(id)},
+				{Account: "expenses:shopping", Amount: *decFloat(-amount), Currency: usd},
+			},
+			Tags: tags,
+		}
+	}
+	return []Transaction{
+		makeTxn("amazon 1", "AMAZON.COM", -10, map[string]string{"trip": "hawaii"}),
+		makeTxn("amazon 2", "Amazon.com*", -10, map[string]string{NoteTag: "gift", StatusTag: StatusCleared}),
+		makeTxn("gas", "Some Gas Station", -10, nil),
+		makeTxn("cafe 1", "Cafe", -5, map[string]string{NoteTag: "lunch"}),
+		makeTxn("cafe 2", "Cafe", -5, map[string]string{NoteTag: "dinner"}),
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	l, err := New(dedupeFixture())
+	require.NoError(t, err)
+	report := l.FindDuplicates()
+
+	require.Len(t, report.Clusters, 1)
+	cluster := report.Clusters[0]
+	assert.Equal(t, "amazon 2", cluster.Keep.Postings[0].ID(), "Transactions with user edits should be kept")
+	require.Len(t, cluster.Remove, 1)
+	assert.Equal(t, "amazon 1", cluster.Remove[0].Postings[0].ID())
+	assert.Equal(t, []string{"trip"}, cluster.Merged)
+	assert.True(t, cluster.Score >= minPayeeSimilarity)
+	assert.Equal(t, "-10", report.Impact["assets:Bank"].String())
+	assert.Equal(t, "10", report.Impact["expenses:shopping"].String())
+	assert.NotEmpty(t, report.Token)
+
+	require.Len(t, report.Conflicts, 1, "Duplicates with different notes should be reviewed by hand")
+	assert.Equal(t, "Duplicates have different notes", report.Conflicts[0].Conflict)
+	assert.Len(t, l.transactions, 5, "Finding duplicates should not modify the ledger")
+}
+
+func TestDedupe(t *testing.T) {
+	l, err := New(dedupeFixture())
+	require.NoError(t, err)
+	token := l.FindDuplicates().Token
+
+	_, err = l.Dedupe("")
+	assert.Equal(t, ErrStaleDedupe, err)
+	_, err = l.Dedupe("wrong token")
+	assert.Equal(t, ErrStaleDedupe, err)
+
+	report, err := l.Dedupe(token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Removed)
+	assert.Len(t, l.transactions, 4)
+	_, found := l.Transaction("amazon 1")
+	assert.False(t, found)
+	kept, found := l.Transaction("amazon 2")
+	require.True(t, found)
+	assert.Equal(t, "gift", kept.Note())
+	assert.Equal(t, StatusCleared, kept.Status())
+	assert.Equal(t, "hawaii", kept.Tags["trip"], "Duplicates' tags should be merged onto the kept transaction")
+	_, found = l.Transaction("cafe 1")
+	assert.True(t, found, "Conflicting duplicates should not be removed")
+
+	assert.Empty(t, l.FindDuplicates().Clusters)
+}
+
+func TestPayeeSimilarity(t *testing.T) {
+	for _, tc := range []struct {
+		a, b    string
+		similar bool
+	}{
+		{a: "Coffee Shop", b: "COFFEE SHOP", similar: true},
+		{a: "Coffee Shop #123", b: "Coffee Shop #124", similar: true},
+		{a: "Amazon", b: "Amazon Mktp US", similar: true},
+		{a: "Amazon", b: "Some Gas Station", similar: false},
+		{a: "", b: "Coffee Shop", similar: false},
+	} {
+		assert.Equal(t, tc.similar, payeeSimilarity(tc.a, tc.b) >= minPayeeSimilarity, "%q and %q", tc.a, tc.b)
+	}
+}
+
+func TestStoreDedupe(t *testing.T) {
+	require.NoError(t, os.Mkdir("deduperepo", 0700))
+	defer func() { require.NoError(t, os.RemoveAll("deduperepo")) }()
+	repo, err := vcs.Open("deduperepo", nil)
+	require.NoError(t, err)
+	file := repo.File("deduperepo/ledger.journal")
+	l, err := New(dedupeFixture())
+	require.NoError(t, err)
+	require.NoError(t, file.Write([]byte(l.String())))
+
+	store, err := NewStore(file, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	report, err := store.Dedupe(store.FindDuplicates().Token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Removed)
+	require.NotEmpty(t, report.Snapshot)
+
+	contents, err := file.Read()
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), "amazon 1")
+	snapshot, err := store.Snapshot(report.Snapshot)
+	require.NoError(t, err)
+	_, found := snapshot.Transaction("amazon 1")
+	assert.True(t, found, "Snapshot should hold the ledger from before deduping")
+}
@@ -1,7 +1,12 @@
 package ledger
 
-import "fmt"
+import (
+	"fmt"
 
+	sErrors "github.com/johnstarich/sage/errors"
+)
+
+// Error is a ledger validation error. Transactions before the first failed transaction are still valid, making this a partial failure.
 type Error struct {
 	firstFailedTxnIndex int
 	cause               error
@@ -17,3 +22,52 @@ func NewValidateError(firstFailure int, cause error) error {
 func (e Error) Error() string {
 	return fmt.Sprintf("Failed to validate ledger at transaction index #%d: %s", e.firstFailedTxnIndex, e.cause)
 }
+
+// Unwrap returns the underlying validation failure
+func (e Error) Unwrap() error {
+	return e.cause
+}
+
+// Partial always returns true, since successful changes prior to a validation error are still kept
+func (e Error) Partial() bool {
+	return true
+}
+
+// PartialError is implemented by errors which only partially failed, i.e. any successful changes should still be saved
+type PartialError interface {
+	error
+	Partial() bool
+}
+
+// IsPartial returns true if err is a partial failure. Wrapped errors are unwrapped with errors.Wrap-compatible causes.
+// If err combines multiple errors, all of them must be partial failures.
+func IsPartial(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errs, ok := err.(sErrors.Errors); ok {
+		for _, e := range errs {
+			if !IsPartial(e) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+	var partial PartialError
+	return sErrors.As(err, &partial) && partial.Partial()
+}
+
+// FileParseError means the ledger file exists but couldn't be parsed. The file is never written after this, so it can be fixed or restored by hand.
+type FileParseError struct {
+	Path  string
+	cause error
+}
+
+func (e FileParseError) Error() string {
+	return fmt.Sprintf("Failed to parse ledger file %q, leaving it unchanged. Fix or restore the file, then start Sage again: %s", e.Path, e.cause)
+}
+
+// Unwrap returns the underlying parse failure
+func (e FileParseError) Unwrap() error {
+	return e.cause
+}
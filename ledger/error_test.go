@@ -3,6 +3,7 @@ package ledger
 import (
 	"testing"
 
+	sErrors "github.com/johnstarich/sage/errors"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,3 +17,31 @@ func TestNewValidateError(t *testing.T) {
 	require.Error(t, validateErr)
 	assert.Equal(t, "Failed to validate ledger at transaction index #1: "+e.Error(), validateErr.Error())
 }
+
+type somePartialError struct{ partial bool }
+
+func (s somePartialError) Error() string { return "some partial error" }
+func (s somePartialError) Partial() bool { return s.partial }
+
+func TestIsPartial(t *testing.T) {
+	validateErr := NewValidateError(1, errors.New("some error"))
+	for _, tc := range []struct {
+		description   string
+		err           error
+		expectPartial bool
+	}{
+		{description: "nil"},
+		{description: "plain error", err: errors.New("some error")},
+		{description: "validate error", err: validateErr, expectPartial: true},
+		{description: "wrapped validate error", err: errors.Wrap(errors.Wrap(validateErr, "layer 1"), "layer 2"), expectPartial: true},
+		{description: "custom partial error", err: errors.Wrap(somePartialError{true}, "layer 1"), expectPartial: true},
+		{description: "custom non-partial error", err: somePartialError{false}},
+		{description: "all partial errors", err: sErrors.Errors{validateErr, somePartialError{true}}, expectPartial: true},
+		{description: "some partial errors", err: sErrors.Errors{validateErr, errors.New("some error")}},
+		{description: "no errors", err: sErrors.Errors{}},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectPartial, IsPartial(tc.err))
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package ledger
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// FeeLinkTag links a foreign transaction fee to its purchase. Both transactions are tagged with the purchase's ID.
+	FeeLinkTag = "fee_link"
+	// DefaultFeeCategory is the category for foreign transaction fees, unless a rule categorizes them
+	DefaultFeeCategory = "expenses:Fees:Foreign"
+
+	maxFeeDays = 31
+)
+
+// FeeRule identifies foreign transaction fees, so they can be linked to the purchase which caused them
+type FeeRule struct {
+	// Payee is a case-insensitive regular expression matching fee payees. Empty disables fee linking.
+	Payee string
+	// MaxAmount is the largest amount a fee can be
+	MaxAmount decimal.Decimal
+	// Days is the most days a fee can post after its purchase
+	Days int
+	// Category is the default category for fees
+	Category string
+}
+
+// DefaultFeeRule returns the fee rule used when none is configured
+func DefaultFeeRule() FeeRule {
+	return FeeRule{
+		Payee:     `\bforeign\b.*\bfee\b`,
+		MaxAmount: decimal.New(25, 0),
+		Days:      3,
+		Category:  DefaultFeeCategory,
+	}
+}
+
+// Validate returns an error if r is enabled and invalid
+func (r FeeRule) Validate() error {
+	if r.Payee == "" {
+		return nil
+	}
+	if _, err := r.pattern(); err != nil {
+		return errors.Errorf("Invalid fee payee pattern: %s", err)
+	}
+	if !r.MaxAmount.IsPositive() {
+		return errors.New("Fee max amount must be greater than zero")
+	}
+	if r.Days < 0 || r.Days > maxFeeDays {
+		return errors.Errorf("Fee days must be between 0 and %d", maxFeeDays)
+	}
+	if r.Category == "" || NormalizeAccountName(r.Category) != r.Category || strings.ContainsAny(r.Category, ";\t\n") {
+		return errors.Errorf("Invalid fee category: %q", r.Category)
+	}
+	return nil
+}
+
+func (r FeeRule) pattern() (*regexp.Regexp, error) {
+	return regexp.Compile(`(?i)` + r.Payee)
+}
+
+// Matcher returns a func which reports whether a transaction is a fee. Returns nil if r is disabled or invalid.
+func (r FeeRule) Matcher() func(txn Transaction) bool {
+	if r.Validate() != nil || r.Payee == "" {
+		return nil
+	}
+	pattern, _ := r.pattern()
+	return func(txn Transaction) bool {
+		if len(txn.Postings) < 2 || !pattern.MatchString(txn.Payee) {
+			return false
+		}
+		amount := txn.Postings[0].Amount
+		return !amount.IsZero() && amount.Abs().LessThanOrEqual(r.MaxAmount)
+	}
+}
+
+// LinkFees links each new fee in 'txns' to the nearest preceding purchase on the same account within the rule's days.
+// A purchase matches if it's in a different currency than the fee, or the fee's payee names the purchase's merchant.
+// Purchases may be in 'txns' or already in the ledger. Fees already in the ledger, already linked, or without a matching purchase are skipped.
+func (l *Ledger) LinkFees(rule FeeRule, txns []Transaction) {
+	isFee := rule.Matcher()
+	if isFee == nil {
+		return
+	}
+	pattern, _ := rule.pattern()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := range txns {
+		fee := &txns[i]
+		if !isFee(*fee) || fee.Tags[FeeLinkTag] != "" || l.idSet[fee.Postings[0].ID()] != nil {
+			continue
+		}
+		merchant := feeMerchant(pattern, fee.Payee)
+		var parent *Transaction
+		parentMerchant := false
+		consider := func(candidate *Transaction) {
+			if candidate == fee || !isFeeParent(rule, *fee, *candidate) || isFee(*candidate) {
+				return
+			}
+			sameMerchant := merchant != "" && strings.Contains(strings.ToLower(candidate.Payee), merchant)
+			if !sameMerchant && candidate.Postings[0].Currency == fee.Postings[0].Currency {
+				return
+			}
+			if parent == nil || candidate.Date.After(parent.Date) || (candidate.Date.Equal(parent.Date) && sameMerchant && !parentMerchant) {
+				parent, parentMerchant = candidate, sameMerchant
+			}
+		}
+		for _, candidate := range l.transactions {
+			consider(candidate)
+		}
+		for j := range txns {
+			consider(&txns[j])
+		}
+		if parent == nil {
+			continue
+		}
+
+		linkID := parent.Postings[0].ID()
+		if existing := l.idSet[linkID]; existing == parent {
+			linked := existing.copy()
+			setTag(&linked, FeeLinkTag, linkID)
+			*existing = linked
+		} else {
+			setTag(parent, FeeLinkTag, linkID)
+		}
+		setTag(fee, FeeLinkTag, linkID)
+	}
+}
+
+// isFeeParent returns true if 'candidate' is an unlinked transaction on the same account as 'fee', dated within the rule's days before it
+func isFeeParent(rule FeeRule, fee, candidate Transaction) bool {
+	if len(candidate.Postings) < 2 || candidate.Tags[FeeLinkTag] != "" || candidate.Postings[0].ID() == "" {
+		return false
+	}
+	if candidate.Postings[0].Account != fee.Postings[0].Account {
+		return false
+	}
+	earliest := fee.Date.AddDate(0, 0, -rule.Days)
+	return !candidate.Date.After(fee.Date) && !candidate.Date.Before(earliest)
+}
+
+// feeMerchant returns the lowercase merchant name in a fee's payee, if any. i.e. "FOREIGN TRANSACTION FEE - SOME SHOP" returns "some shop"
+func feeMerchant(pattern *regexp.Regexp, payee string) string {
+	merchant := pattern.ReplaceAllString(payee, " ")
+	merchant = strings.Join(strings.Fields(merchant), " ")
+	merchant = strings.Trim(merchant, " -*#:/")
+	const minMerchantLen = 3
+	if len(merchant) < minMerchantLen {
+		return ""
+	}
+	return strings.ToLower(merchant)
+}
+
+func setTag(txn *Transaction, key, value string) {
+	if txn.Tags == nil {
+		txn.Tags = make(map[string]string)
+	}
+	txn.Tags[key] = value
+}
+
+// unlinkFees removes FeeLinkTag from every transaction linked by 'linkID'. Must be called with the write lock held.
+func (l *Ledger) unlinkFees(linkID string) {
+	for _, txn := range l.transactions {
+		if txn.Tags[FeeLinkTag] == linkID {
+			unlinked := txn.copy()
+			delete(unlinked.Tags, FeeLinkTag)
+			*txn = unlinked
+		}
+	}
+}
+
+// FoldedFees returns a copy of the ledger for reports, where each linked fee is categorized the same as its purchase.
+// Returns l itself if no fees are linked.
+func (l *Ledger) FoldedFees() *Ledger {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	folded := false
+	txns := make([]Transaction, 0, len(l.transactions))
+	for _, txn := range l.transactions {
+		txnCopy := txn.copy()
+		linkID := txn.Tags[FeeLinkTag]
+		parent := l.idSet[linkID]
+		if linkID != "" && linkID != txn.Postings[0].ID() && parent != nil && len(parent.Postings) > 1 {
+			category := parent.Postings[len(parent.Postings)-1].Account
+			for i := 1; i < len(txnCopy.Postings); i++ {
+				txnCopy.Postings[i].Account = category
+			}
+			folded = true
+		}
+		txns = append(txns, txnCopy)
+	}
+	if !folded {
+		return l
+	}
+
+	transactionPtrs := makeTransactionPtrs(txns)
+	idSet, _, _ := makeIDSet(transactionPtrs)
+	return &Ledger{
+		transactions: transactionPtrs,
+		idSet:        idSet,
+		dialect:      l.dialect,
+		declarations: l.declarations,
+	}
+}
@@ -0,0 +1,120 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeRuleValidate(t *testing.T) {
+	assert.NoError(t, DefaultFeeRule().Validate())
+	assert.NoError(t, FeeRule{}.Validate(), "Disabled rules are valid")
+
+	rule := DefaultFeeRule()
+	rule.Payee = "("
+	assert.Error(t, rule.Validate())
+
+	rule = DefaultFeeRule()
+	rule.MaxAmount = *decFloat(0)
+	assert.Error(t, rule.Validate())
+
+	rule = DefaultFeeRule()
+	rule.Days = maxFeeDays + 1
+	assert.Error(t, rule.Validate())
+
+	rule = DefaultFeeRule()
+	rule.Category = "expenses:fees "
+	assert.Error(t, rule.Validate())
+}
+
+func TestLinkFees(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	makeTxn := func(id string, date time.Time, payee, currency string, amount float64) Transaction {
+		return Transaction{
+			Date:  date,
+			Payee: payee,
+			Postings: []Posting{
+				{Account: "liabilities:Some Card", Amount: *decFloat(-amount), Currency: currency, Tags: makeIDTag(id)},
+				{Account: "expenses:shopping", Amount: *decFloat(amount), Currency: currency},
+			},
+		}
+	}
+	l, err := New([]Transaction{
+		makeTxn("existing purchase", day(1), "Some Hotel", "EUR", 200),
+	})
+	require.NoError(t, err)
+
+	txns := []Transaction{
+		makeTxn("existing fee", day(3), "FOREIGN TRANSACTION FEE", "$", 6),
+		makeTxn("local purchase", day(9), "Some Shop", "$", 20),
+		makeTxn("new purchase", day(10), "Some Cafe", "GBP", 30),
+		makeTxn("new fee", day(11), "FOREIGN TRANSACTION FEE", "$", 0.9),
+		makeTxn("merchant purchase", day(20), "SOME SHOP LONDON", "$", 40),
+		makeTxn("merchant fee", day(21), "FOREIGN TRANSACTION FEE - SOME SHOP", "$", 1.2),
+		makeTxn("late fee", day(30), "FOREIGN TRANSACTION FEE", "$", 1),
+		makeTxn("large fee", day(20), "FOREIGN TRANSACTION FEE", "$", 100),
+	}
+	l.LinkFees(DefaultFeeRule(), txns)
+
+	links := make(map[string]string)
+	for _, txn := range txns {
+		links[txn.Postings[0].ID()] = txn.Tags[FeeLinkTag]
+	}
+	assert.Equal(t, map[string]string{
+		"existing fee":      "existing purchase",
+		"local purchase":    "",
+		"new purchase":      "new purchase",
+		"new fee":           "new purchase",
+		"merchant purchase": "merchant purchase",
+		"merchant fee":      "merchant purchase",
+		"late fee":          "",
+		"large fee":         "",
+	}, links)
+	existing, _ := l.Transaction("existing purchase")
+	assert.Equal(t, "existing purchase", existing.Tags[FeeLinkTag])
+
+	l.LinkFees(FeeRule{}, txns)
+	assert.Equal(t, "new purchase", txns[3].Tags[FeeLinkTag], "Disabled rules don't change links")
+}
+
+func TestFoldedAndUnlinkedFees(t *testing.T) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	purchase := Transaction{
+		Date:  date,
+		Payee: "Some Cafe",
+		Tags:  map[string]string{FeeLinkTag: "purchase"},
+		Postings: []Posting{
+			{Account: "liabilities:Some Card", Amount: *decFloat(-30), Currency: "GBP", Tags: makeIDTag("purchase")},
+			{Account: "expenses:food", Amount: *decFloat(30), Currency: "GBP"},
+		},
+	}
+	fee := Transaction{
+		Date:  date.AddDate(0, 0, 1),
+		Payee: "FOREIGN TRANSACTION FEE",
+		Tags:  map[string]string{FeeLinkTag: "purchase"},
+		Postings: []Posting{
+			{Account: "liabilities:Some Card", Amount: *decFloat(-0.9), Tags: makeIDTag("fee")},
+			{Account: DefaultFeeCategory, Amount: *decFloat(0.9)},
+		},
+	}
+	l, err := New([]Transaction{purchase, fee})
+	require.NoError(t, err)
+
+	folded := l.FoldedFees()
+	foldedFee, _ := folded.Transaction("fee")
+	assert.Equal(t, "expenses:food", foldedFee.Postings[1].Account)
+	ldgFee, _ := l.Transaction("fee")
+	assert.Equal(t, DefaultFeeCategory, ldgFee.Postings[1].Account, "Folding must not change the ledger")
+
+	assert.Error(t, l.UpdateTransaction("fee", Transaction{Tags: map[string]string{FeeLinkTag: "other"}}))
+	require.NoError(t, l.UpdateTransaction("fee", Transaction{Tags: map[string]string{FeeLinkTag: ""}}))
+	for _, id := range []string{"purchase", "fee"} {
+		txn, _ := l.Transaction(id)
+		assert.NotContains(t, txn.Tags, FeeLinkTag)
+	}
+	assert.Equal(t, l, l.FoldedFees())
+}
@@ -0,0 +1,129 @@
+package ledger
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// ForecastRecurring marks a projected entry derived from a detected recurring series
+	ForecastRecurring = "recurring"
+	// ForecastScheduled marks a projected entry from a future-dated transaction already in the ledger
+	ForecastScheduled = "scheduled"
+)
+
+// ForecastEntry is a projected change to an account's balance
+type ForecastEntry struct {
+	Date     time.Time
+	Account  string
+	Payee    string
+	Amount   decimal.Decimal
+	Source   string
+	SeriesID string `json:",omitempty"`
+}
+
+// ForecastDay contains the projected balances at the end of a day and the entries which changed them
+type ForecastDay struct {
+	Date     time.Time
+	Balances map[string]decimal.Decimal
+	Entries  []ForecastEntry `json:",omitempty"`
+}
+
+// Forecast projects asset and liability balances forward from 'start' for the given number of days.
+// Uses detected recurring series, excluding any series with IDs in 'excludeSeries', and future-dated (scheduled) transactions.
+// Entries from simulated transactions are marked with ForecastSimulated.
+func (l *Ledger) Forecast(start time.Time, days int, excludeSeries []string) []ForecastDay {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	start = startOfDay(start)
+	end := start.AddDate(0, 0, days)
+	excluded := make(map[string]bool, len(excludeSeries))
+	for _, id := range excludeSeries {
+		excluded[id] = true
+	}
+
+	balances := make(map[string]decimal.Decimal)
+	var entries []ForecastEntry
+	for _, txn := range l.transactions {
+		source := ForecastScheduled
+		if IsSimulated(*txn) {
+			source = ForecastSimulated
+		}
+		for _, p := range txn.Postings {
+			if !isBalanceAccount(p.Account) {
+				continue
+			}
+			switch {
+			case txn.Date.Before(start):
+				balances[p.Account] = balances[p.Account].Add(p.Amount)
+			case txn.Date.Before(end):
+				entries = append(entries, ForecastEntry{
+					Date:    txn.Date,
+					Account: p.Account,
+					Payee:   txn.Payee,
+					Amount:  p.Amount,
+					Source:  source,
+				})
+			}
+		}
+	}
+
+	for _, series := range l.recurring() {
+		c, ok := findCadence(series.Cadence)
+		if excluded[series.ID] || !ok || !isBalanceAccount(series.Account) {
+			continue
+		}
+		for i, date := 0, series.NextDate; date.Before(end); i, date = i+1, c.add(series.NextDate, i+1) {
+			if date.Before(start) {
+				continue
+			}
+			entries = append(entries, ForecastEntry{
+				Date:     date,
+				Account:  series.Account,
+				Payee:    series.Payee,
+				Amount:   series.NextAmount,
+				Source:   ForecastRecurring,
+				SeriesID: series.ID,
+			})
+		}
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Date.Before(entries[b].Date)
+	})
+
+	forecast := make([]ForecastDay, 0, days)
+	for day := 0; day < days; day++ {
+		date := start.AddDate(0, 0, day)
+		nextDate := date.AddDate(0, 0, 1)
+		var dayEntries []ForecastEntry
+		for len(entries) > 0 && entries[0].Date.Before(nextDate) {
+			entry := entries[0]
+			entries = entries[1:]
+			balances[entry.Account] = balances[entry.Account].Add(entry.Amount)
+			dayEntries = append(dayEntries, entry)
+		}
+		dayBalances := make(map[string]decimal.Decimal, len(balances))
+		for account, balance := range balances {
+			dayBalances[account] = balance
+		}
+		forecast = append(forecast, ForecastDay{
+			Date:     date,
+			Balances: dayBalances,
+			Entries:  dayEntries,
+		})
+	}
+	return forecast
+}
+
+func isBalanceAccount(account string) bool {
+	return strings.HasPrefix(account, "assets:") || strings.HasPrefix(account, "liabilities:")
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
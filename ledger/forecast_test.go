@@ -0,0 +1,53 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForecast(t *testing.T) {
+	txns := recurringTxns(t, "Streaming", []string{"2020/01/15", "2020/02/15", "2020/03/15"}, []float64{10, 10, 10})
+	txns = append(txns, Transaction{
+		Date:  parseDate(t, "2020/04/03"),
+		Payee: "Rent",
+		Postings: []Posting{
+			{Account: "assets:Super Bank:****1234", Amount: *decFloat(-500), Currency: usd, Tags: makeIDTag("rent")},
+			{Account: "expenses:rent", Amount: *decFloat(500), Currency: usd},
+		},
+	})
+	ldg, err := New(txns)
+	require.NoError(t, err)
+	series := ldg.Recurring()
+	require.Len(t, series, 1)
+
+	const account = "assets:Super Bank:****1234"
+	start := parseDate(t, "2020/04/01")
+
+	t.Run("recurring and scheduled", func(t *testing.T) {
+		forecast := ldg.Forecast(start, 30, nil)
+		require.Len(t, forecast, 30)
+		assert.Equal(t, start, forecast[0].Date)
+		assert.Equal(t, "-30", forecast[0].Balances[account].String())
+
+		rentDay := forecast[2]
+		require.Len(t, rentDay.Entries, 1)
+		assert.Equal(t, ForecastScheduled, rentDay.Entries[0].Source)
+		assert.Equal(t, "-530", rentDay.Balances[account].String())
+
+		streamingDay := forecast[14]
+		require.Len(t, streamingDay.Entries, 1)
+		assert.Equal(t, ForecastRecurring, streamingDay.Entries[0].Source)
+		assert.Equal(t, series[0].ID, streamingDay.Entries[0].SeriesID)
+		assert.Equal(t, "-540", streamingDay.Balances[account].String())
+		assert.Equal(t, "-540", forecast[29].Balances[account].String())
+	})
+
+	t.Run("exclude series", func(t *testing.T) {
+		forecast := ldg.Forecast(start, 30, []string{series[0].ID})
+		require.Len(t, forecast, 30)
+		assert.Empty(t, forecast[14].Entries)
+		assert.Equal(t, "-530", forecast[29].Balances[account].String())
+	})
+}
@@ -0,0 +1,209 @@
+package ledger
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/johnstarich/sage/vcs"
+	"github.com/pkg/errors"
+)
+
+// legacyIDTags are the tag keys past versions of Sage wrote transaction IDs under, oldest first.
+// When the canonical ID tag format changes, add the old format here and a fixture to fsck_test.go.
+var legacyIDTags = []string{
+	"ID",    // upper case key, e.g. "; ID: 1234-5678"
+	"ofxid", // OFX-prefixed key, e.g. "; ofxid: 1234-5678"
+}
+
+// canonicalID returns the ID in 'tags', recognizing every historical ID tag format
+func canonicalID(tags map[string]string) string {
+	if id, ok := tags[idTag]; ok {
+		return normalizeIDValue(id)
+	}
+	for _, key := range legacyIDTags {
+		if id, ok := tags[key]; ok {
+			return normalizeIDValue(id)
+		}
+	}
+	return ""
+}
+
+// normalizeIDValue removes the quotes some past versions wrapped IDs in, e.g. `id: "1234-5678"`
+func normalizeIDValue(id string) string {
+	id = strings.TrimSpace(id)
+	if len(id) >= 2 && id[0] == '"' && id[len(id)-1] == '"' {
+		id = strings.TrimSpace(id[1 : len(id)-1])
+	}
+	return id
+}
+
+// isLegacyIDTag returns true if 'tags' holds an ID which isn't written in the canonical format
+func isLegacyIDTag(tags map[string]string) bool {
+	id := canonicalID(tags)
+	return id != "" && tags[idTag] != id
+}
+
+// normalizeIDTag rewrites a historical ID tag in 'tags' to the canonical format. Returns true if 'tags' changed.
+func normalizeIDTag(tags map[string]string) bool {
+	if !isLegacyIDTag(tags) {
+		return false
+	}
+	tags[idTag] = canonicalID(tags)
+	for _, key := range legacyIDTags {
+		delete(tags, key)
+	}
+	return true
+}
+
+// exactDuplicateIDs returns the IDs written in the canonical format more than once.
+// Unlike makeIDSet, IDs are not normalized, so old and new formats of the same ID are left for CheckIntegrity to report.
+func exactDuplicateIDs(transactions []*Transaction) []string {
+	seen := make(map[string]*Transaction)
+	var duplicates []string
+	check := func(txn *Transaction, tags map[string]string) {
+		id := tags[idTag]
+		if id == "" {
+			return
+		}
+		if seen[id] != nil {
+			duplicates = append(duplicates, id)
+			return
+		}
+		seen[id] = txn
+	}
+	for _, txn := range transactions {
+		check(txn, txn.Tags)
+		for _, p := range txn.Postings {
+			check(txn, p.Tags)
+		}
+	}
+	return duplicates
+}
+
+// IDCollision is a set of transactions which share an ID once their ID tags are normalized
+type IDCollision struct {
+	ID           string
+	Transactions []Transaction
+}
+
+// IntegrityReport describes the ledger's transaction ID tags which need repair
+type IntegrityReport struct {
+	// LegacyIDs are the IDs written in a historical ID tag format
+	LegacyIDs []string
+	// Collisions are IDs shared by more than one transaction once normalized. These must be resolved by hand before healing.
+	Collisions []IDCollision
+	// Healed is the number of ID tags rewritten in the canonical format
+	Healed int
+	// Snapshot is the snapshot ID of the ledger file before healing
+	Snapshot string `json:",omitempty"`
+}
+
+// CheckIntegrity scans all transactions for ID tags in historical formats and IDs which collide once normalized. Does not modify the ledger.
+func (l *Ledger) CheckIntegrity() IntegrityReport {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.checkIntegrity()
+}
+
+// checkIntegrity must be called with the lock held
+func (l *Ledger) checkIntegrity() IntegrityReport {
+	var report IntegrityReport
+	owners := make(map[string][]*Transaction)
+	addOwner := func(txn *Transaction, tags map[string]string) {
+		id := canonicalID(tags)
+		if id == "" {
+			return
+		}
+		if isLegacyIDTag(tags) {
+			report.LegacyIDs = append(report.LegacyIDs, id)
+		}
+		for _, owner := range owners[id] {
+			if owner == txn {
+				return
+			}
+		}
+		owners[id] = append(owners[id], txn)
+	}
+	for _, txn := range l.transactions {
+		addOwner(txn, txn.Tags)
+		for _, p := range txn.Postings {
+			addOwner(txn, p.Tags)
+		}
+	}
+	for id, txns := range owners {
+		if len(txns) > 1 {
+			report.Collisions = append(report.Collisions, IDCollision{ID: id, Transactions: dereferenceTransactions(txns)})
+		}
+	}
+	sort.Strings(report.LegacyIDs)
+	sort.Slice(report.Collisions, func(a, b int) bool {
+		return report.Collisions[a].ID < report.Collisions[b].ID
+	})
+	return report
+}
+
+// HealIDTags rewrites all historical ID tags in the canonical format. Fails if any IDs collide once normalized.
+func (l *Ledger) HealIDTags() (IntegrityReport, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	report := l.checkIntegrity()
+	if len(report.Collisions) > 0 {
+		ids := make([]string, 0, len(report.Collisions))
+		for _, collision := range report.Collisions {
+			ids = append(ids, collision.ID)
+		}
+		return report, errors.Errorf("Resolve colliding transaction IDs before healing: %s", strings.Join(ids, ", "))
+	}
+	for _, txn := range l.transactions {
+		if normalizeIDTag(txn.Tags) {
+			report.Healed++
+		}
+		for _, p := range txn.Postings {
+			if normalizeIDTag(p.Tags) {
+				report.Healed++
+			}
+		}
+	}
+	return report, nil
+}
+
+// HealIDTags snapshots the ledger file, then rewrites all historical ID tags in the canonical format
+func (s *Store) HealIDTags() (IntegrityReport, error) {
+	if report := s.CheckIntegrity(); len(report.LegacyIDs) == 0 {
+		return report, nil
+	}
+	snapshot, err := s.snapshotFile()
+	if err != nil {
+		return IntegrityReport{}, errors.Wrap(err, "Failed to snapshot ledger before healing")
+	}
+	report, err := s.Ledger.HealIDTags()
+	if err != nil {
+		return report, err
+	}
+	report.Snapshot = snapshot
+	return report, s.syncFile()
+}
+
+// snapshotFile commits the ledger file as it is on disk and returns its snapshot ID
+func (s *Store) snapshotFile() (string, error) {
+	file, ok := s.file.(vcs.VersionedFile)
+	if !ok {
+		return "", errSnapshotsUnsupported
+	}
+	contents, err := file.Read()
+	if err != nil {
+		return "", err
+	}
+	// writing unchanged contents doesn't create a new version
+	if err := file.Write(contents); err != nil {
+		return "", err
+	}
+	versions, err := file.Versions()
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", ErrSnapshotNotFound
+	}
+	return versions[0].ID, nil
+}
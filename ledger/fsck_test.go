@@ -0,0 +1,135 @@
+package ledger
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/vcs"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// idTagFixtures holds a transaction for every ID tag format Sage has written. Add one here whenever the canonical format changes.
+var idTagFixtures = []struct {
+	description string
+	tagKey      string
+	tag         string
+}{
+	{description: "canonical", tagKey: idTag, tag: "id: some-id"},
+	{description: "upper case key", tagKey: "ID", tag: "ID: some-id"},
+	{description: "OFX-prefixed key", tagKey: "ofxid", tag: "ofxid: some-id"},
+	{description: "quoted value", tagKey: idTag, tag: `id: "some-id"`},
+}
+
+func idTagFixtureLedger(tag string) string {
+	return `
+2020/01/01 some payee
+    assets:Bank   $-1.00 ; ` + tag + `
+    expenses:food   $1.00
+`
+}
+
+func TestIDTagFixturesCoverLegacyTags(t *testing.T) {
+	for _, key := range legacyIDTags {
+		found := false
+		for _, fixture := range idTagFixtures {
+			found = found || fixture.tagKey == key
+		}
+		assert.True(t, found, "Legacy ID tag %q must have a fixture in idTagFixtures", key)
+	}
+}
+
+func TestIDTagFormats(t *testing.T) {
+	for _, fixture := range idTagFixtures {
+		t.Run(fixture.description, func(t *testing.T) {
+			ldg, err := NewFromReader(strings.NewReader(idTagFixtureLedger(fixture.tag)))
+			require.NoError(t, err)
+
+			txn, found := ldg.Transaction("some-id")
+			require.True(t, found, "Every historical format should be indexed by its normalized ID")
+			assert.Equal(t, "some-id", txn.Postings[0].ID())
+
+			report := ldg.CheckIntegrity()
+			if fixture.tag == "id: some-id" {
+				assert.Empty(t, report.LegacyIDs)
+			} else {
+				assert.Equal(t, []string{"some-id"}, report.LegacyIDs)
+			}
+			assert.Empty(t, report.Collisions)
+
+			err = ldg.AddTransactions([]Transaction{{
+				Date:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				Payee: "some payee",
+				Postings: []Posting{
+					{Account: "assets:Bank", Amount: decimal.NewFromFloat(-1), Currency: usd, Tags: makeIDTag("some-id")},
+					{Account: "expenses:food", Amount: decimal.NewFromFloat(1), Currency: usd},
+				},
+			}})
+			require.NoError(t, err)
+			assert.Equal(t, 1, ldg.Size(), "Re-importing an old format transaction should be deduplicated")
+
+			report, err = ldg.HealIDTags()
+			require.NoError(t, err)
+			assert.Equal(t, len(report.LegacyIDs), report.Healed)
+			assert.Contains(t, ldg.String(), "; id: some-id")
+			assert.Empty(t, ldg.CheckIntegrity().LegacyIDs)
+		})
+	}
+}
+
+func TestCheckIntegrityCollisions(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(
+		idTagFixtureLedger("ID: some-id") + idTagFixtureLedger("id: some-id") + idTagFixtureLedger("id: other-id"),
+	))
+	require.NoError(t, err, "IDs which only collide after normalizing should not prevent loading the ledger")
+
+	report := ldg.CheckIntegrity()
+	assert.Equal(t, []string{"some-id"}, report.LegacyIDs)
+	require.Len(t, report.Collisions, 1)
+	assert.Equal(t, "some-id", report.Collisions[0].ID)
+	assert.Len(t, report.Collisions[0].Transactions, 2)
+
+	before := ldg.String()
+	_, err = ldg.HealIDTags()
+	require.Error(t, err)
+	assert.Equal(t, "Resolve colliding transaction IDs before healing: some-id", err.Error())
+	assert.Equal(t, before, ldg.String(), "Failed heals should not change the ledger")
+
+	_, err = NewFromReader(strings.NewReader(idTagFixtureLedger("id: some-id") + idTagFixtureLedger("id: some-id")))
+	assert.Error(t, err, "Exact duplicate IDs should still be rejected")
+}
+
+func TestStoreHealIDTags(t *testing.T) {
+	require.NoError(t, os.Mkdir("fsckrepo", 0700))
+	defer func() { require.NoError(t, os.RemoveAll("fsckrepo")) }()
+	repo, err := vcs.Open("fsckrepo", nil)
+	require.NoError(t, err)
+	file := repo.File("fsckrepo/ledger.journal")
+	original := idTagFixtureLedger("ofxid: some-id")
+	require.NoError(t, file.Write([]byte(original)))
+
+	store, err := NewStore(file, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	report, err := store.HealIDTags()
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Healed)
+	require.NotEmpty(t, report.Snapshot)
+
+	contents, err := file.Read()
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "; id: some-id")
+	assert.NotContains(t, string(contents), "ofxid")
+
+	snapshot, err := store.Snapshot(report.Snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"some-id"}, snapshot.CheckIntegrity().LegacyIDs, "Snapshot should hold the ledger from before healing")
+
+	report, err = store.HealIDTags()
+	require.NoError(t, err)
+	assert.Zero(t, report.Healed)
+	assert.Empty(t, report.Snapshot, "Healing a clean ledger should not snapshot")
+}
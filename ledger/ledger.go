@@ -4,44 +4,63 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	sErrors "github.com/johnstarich/sage/errors"
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 )
 
 // Ledger tracks transactions from multiple institutions. Include error checking and validation for all ledger changes.
 // Serializes into a "plain-text accounting" ledger file.
+// Safe for concurrent use: all access to transactions goes through mu, and transactions are deep copied in and out of the ledger.
 type Ledger struct {
 	transactions Transactions
 	idSet        map[string]*Transaction
+	assertions   map[string]Transaction // account name -> latest balance assertion
+	declarations []AccountDeclaration
+	dialect      AssertionDialect
+	tombstones   Tombstones
 	mu           sync.RWMutex
 }
 
 // New creates a ledger with the given transactions. Must not contain any duplicate IDs
+// Sage-generated balance assertions are kept separately from transactions, one per account.
+// IDs which only collide once historical ID tag formats are normalized are indexed by their first transaction, and reported by CheckIntegrity.
 func New(transactions []Transaction) (*Ledger, error) {
+	transactions, assertions := SplitBalanceAssertions(transactions)
 	transactionPtrs := makeTransactionPtrs(transactions)
-	idSet, _, duplicates := makeIDSet(transactionPtrs)
-	if len(duplicates) > 0 {
+	// keep transactions date-sorted like every other change does, even if the file was edited out of order
+	Transactions(transactionPtrs).Sort()
+	idSet, _, _ := makeIDSet(transactionPtrs)
+	if duplicates := exactDuplicateIDs(transactionPtrs); len(duplicates) > 0 {
 		return nil, duplicateTransactionError(strings.Join(duplicates, ", "))
 	}
-	return &Ledger{
+	ldg := &Ledger{
 		transactions: transactionPtrs,
 		idSet:        idSet,
-	}, nil
+	}
+	ldg.setAssertions(assertions)
+	return ldg, nil
 }
 
 // NewFromReader creates a ledger from the given "plain-text accounting" ledger-encoded reader
 func NewFromReader(reader io.Reader) (*Ledger, error) {
 	var transactions []Transaction
 	scanner := bufio.NewScanner(reader)
-	transactions, err := readAllTransactions(scanner)
+	transactions, declarations, err := readAllTransactions(scanner)
+	if err != nil {
+		return nil, err
+	}
+	ldg, err := New(transactions)
 	if err != nil {
 		return nil, err
 	}
-	return New(transactions)
+	ldg.declarations = declarations
+	return ldg, nil
 }
 
 // makeTransactionPtrs converts to a slice of txn pointers. NOTE: does not copy the underlying txn
@@ -53,10 +72,11 @@ func makeTransactionPtrs(transactions []Transaction) []*Transaction {
 	return transactionPtrs
 }
 
+// dereferenceTransactions returns deep copies of the txns, safe to use without holding the ledger's lock
 func dereferenceTransactions(transactionPtrs Transactions) []Transaction {
 	transactions := make([]Transaction, len(transactionPtrs))
 	for i := range transactionPtrs {
-		transactions[i] = *transactionPtrs[i]
+		transactions[i] = transactionPtrs[i].copy()
 	}
 	return transactions
 }
@@ -97,11 +117,33 @@ func (l *Ledger) String() string {
 	sortedTxns := make(Transactions, len(l.transactions))
 	copy(sortedTxns, l.transactions)
 	sortedTxns.Sort()
+	assertions := make([]Transaction, 0, len(l.assertions))
+	for _, assertion := range l.assertions {
+		assertions = append(assertions, assertion)
+	}
+	sortAssertions(assertions)
+
 	var buf bytes.Buffer
+	for _, decl := range l.declarations {
+		buf.WriteString(decl.String())
+	}
+	if len(l.declarations) > 0 {
+		buf.WriteRune('\n')
+	}
+	writeAssertions := func(before *time.Time) {
+		// write assertions after all transactions on the same day
+		for len(assertions) > 0 && (before == nil || startOfDay(assertions[0].Date).Before(startOfDay(*before))) {
+			buf.WriteString(assertionString(assertions[0], l.dialect))
+			buf.WriteRune('\n')
+			assertions = assertions[1:]
+		}
+	}
 	for _, txn := range sortedTxns {
+		writeAssertions(&txn.Date)
 		buf.WriteString(txn.String())
 		buf.WriteRune('\n')
 	}
+	writeAssertions(nil)
 	return buf.String()
 }
 
@@ -121,14 +163,45 @@ func duplicateTransactionError(id string) error {
 	return errors.Errorf("Duplicate transaction IDs found: %s", id)
 }
 
+// Transaction returns the transaction with the given ID
 func (l *Ledger) Transaction(id string) (txn Transaction, found bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	txnPtr, found := l.idSet[id]
 	if found {
-		return *txnPtr, found
+		return txnPtr.copy(), found
 	}
 	return Transaction{}, found
 }
 
+// Replace swaps this ledger's transactions and account declarations with other's
+func (l *Ledger) Replace(other *Ledger) {
+	other.mu.RLock()
+	transactions, idSet, assertions, declarations := other.transactions, other.idSet, other.assertions, other.declarations
+	other.mu.RUnlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.transactions, l.idSet, l.assertions, l.declarations = transactions, idSet, assertions, declarations
+}
+
+// snapshot returns a deep copy of l's transactions and balance assertions, for restoring later with Replace
+func (l *Ledger) snapshot() *Ledger {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	transactions := makeTransactionPtrs(dereferenceTransactions(l.transactions))
+	idSet, _, _ := makeIDSet(transactions)
+	assertions := make(map[string]Transaction, len(l.assertions))
+	for account, assertion := range l.assertions {
+		assertions[account] = assertion.copy()
+	}
+	return &Ledger{
+		transactions: transactions,
+		idSet:        idSet,
+		assertions:   assertions,
+		declarations: l.declarations,
+	}
+}
+
 // FirstTransactionTime returns the first transaction's Date field. Returns 0 if there are no transactions
 func (l *Ledger) FirstTransactionTime() time.Time {
 	l.mu.RLock()
@@ -154,11 +227,19 @@ func (l *Ledger) LastTransactionTime() time.Time {
 // AddTransactions attempts to add the provided transactions.
 // Returns an error if the ledger fails validation (i.e. fail balance assertions).
 // In the event of an error, attempts to add all valid transactions up to the error.
+// Transactions recorded as deleted by the ledger's tombstones are skipped.
 func (l *Ledger) AddTransactions(txns []Transaction) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.addTransactions(l.skipDeleted(txns))
+}
+
+// addTransactions adds copies of txns. Must be called with the write lock held.
+func (l *Ledger) addTransactions(txns []Transaction) error {
+	txns, assertions := SplitBalanceAssertions(txns)
 	transactionPtrs := makeTransactionPtrs(txns)
 	for i := range transactionPtrs {
+		*transactionPtrs[i] = transactionPtrs[i].copy()
 		transactionPtrs[i].Date = transactionPtrs[i].Date.UTC()
 	}
 	idSet, newTransactions, _ := makeIDSet(append(l.transactions, transactionPtrs...))
@@ -180,6 +261,9 @@ func (l *Ledger) AddTransactions(txns []Transaction) error {
 	}
 	l.idSet = idSet
 	l.transactions = newTransactions
+	if err == nil {
+		l.setAssertions(assertions)
+	}
 	return err
 }
 
@@ -199,11 +283,11 @@ func (l *Ledger) RenameAccount(oldName, newName, oldID, newID string) int {
 	if oldID != "" {
 		// if old & new IDs specified, require old matches too
 		postingTransform = func(p *Posting) {
-			if strings.HasPrefix(p.Account, oldName) && strings.HasPrefix(p.Tags[idTag], oldID) {
+			if strings.HasPrefix(p.Account, oldName) && strings.HasPrefix(p.ID(), oldID) {
 				// strip off old prefix by length, prepend new
 				p.Account = newName + p.Account[len(oldName):]
 
-				oldIDValue := p.Tags[idTag]
+				oldIDValue := p.ID()
 				// strip off old prefix by length, prepend new
 				newIDValue := newID + oldIDValue[len(oldID):]
 
@@ -212,7 +296,8 @@ func (l *Ledger) RenameAccount(oldName, newName, oldID, newID string) int {
 				delete(l.idSet, oldIDValue)
 				l.idSet[newIDValue] = txn
 
-				// replace ID
+				// replace ID, writing it in the canonical format
+				normalizeIDTag(p.Tags)
 				p.Tags[idTag] = newIDValue
 				count++
 			}
@@ -224,25 +309,42 @@ func (l *Ledger) RenameAccount(oldName, newName, oldID, newID string) int {
 			postingTransform(&txn.Postings[posting])
 		}
 	}
+	var renamedAssertions []Transaction
+	for account, assertion := range l.assertions {
+		if strings.HasPrefix(account, oldName) {
+			delete(l.assertions, account)
+			posting := assertion.Postings[0]
+			posting.Account = newName + account[len(oldName):]
+			assertion.Postings = []Posting{posting}
+			renamedAssertions = append(renamedAssertions, assertion)
+		}
+	}
+	l.setAssertions(renamedAssertions)
 	return count
 }
 
 // Balances returns a cumulative balance sheet for all accounts over the given time period.
-// Current interval is monthly.
+// Current interval is monthly. Income and expense postings of transfers are excluded.
 func (l *Ledger) Balances() (start, end *time.Time, balances map[string][]decimal.Decimal) {
+	return l.BalancesBy(PostingBasis)
+}
+
+// BalancesBy is like Balances, but groups transactions into months by their date for 'basis'
+func (l *Ledger) BalancesBy(basis DateBasis) (start, end *time.Time, balances map[string][]decimal.Decimal) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	if len(l.transactions) == 0 {
 		return
 	}
 	balances = make(map[string][]decimal.Decimal)
-	start, end = timePtr(l.transactions[0].Date), timePtr(l.transactions[0].Date)
+	start, end = timePtr(l.transactions[0].DateFor(basis)), timePtr(l.transactions[0].DateFor(basis))
 	for _, txn := range l.transactions {
-		if txn.Date.Before(*start) {
-			start = timePtr(txn.Date)
+		date := txn.DateFor(basis)
+		if date.Before(*start) {
+			start = timePtr(date)
 		}
-		if txn.Date.After(*end) {
-			end = timePtr(txn.Date)
+		if date.After(*end) {
+			end = timePtr(date)
 		}
 	}
 
@@ -253,11 +355,15 @@ func (l *Ledger) Balances() (start, end *time.Time, balances map[string][]decima
 	intervals := getMonthNum(*end) - startMonthNum + 1
 
 	for _, txn := range l.transactions {
-		index := getMonthNum(txn.Date) - startMonthNum
+		index := getMonthNum(txn.DateFor(basis)) - startMonthNum
 		for _, p := range txn.Postings {
 			if _, ok := balances[p.Account]; !ok {
 				balances[p.Account] = make([]decimal.Decimal, intervals)
 			}
+			if l.excludedFromReports(txn, p) {
+				// keep the account, so transfer categories are still listed
+				continue
+			}
 			balances[p.Account][index] = balances[p.Account][index].Add(p.Amount)
 		}
 	}
@@ -273,20 +379,96 @@ func (l *Ledger) Balances() (start, end *time.Time, balances map[string][]decima
 	return
 }
 
+// BalancesAsOf returns each account's balance from all transactions up to and including the date of 'asOf'. Income and expense postings of transfers are excluded.
+func (l *Ledger) BalancesAsOf(asOf time.Time) map[string]decimal.Decimal {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	cutoff := time.Date(asOf.Year(), asOf.Month(), asOf.Day()+1, 0, 0, 0, 0, asOf.Location())
+	// transactions are date-sorted, so walk back from the end to skip everything after the cutoff. As-of dates are usually recent.
+	end := len(l.transactions)
+	for end > 0 && !l.transactions[end-1].Date.Before(cutoff) {
+		end--
+	}
+	balances := make(map[string]decimal.Decimal)
+	for _, txn := range l.transactions[:end] {
+		for _, p := range txn.Postings {
+			amount := p.Amount
+			if l.excludedFromReports(txn, p) {
+				amount = decimal.Zero
+			}
+			balances[p.Account] = balances[p.Account].Add(amount)
+		}
+	}
+	return balances
+}
+
+// LastPostingTime returns the date of the most recent transaction posting to 'account', or the zero time if there are none
+func (l *Ledger) LastPostingTime(account string) time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var last time.Time
+	for _, txn := range l.transactions {
+		for _, p := range txn.Postings {
+			if p.Account == account && txn.Date.After(last) {
+				last = txn.Date
+			}
+		}
+	}
+	return last
+}
+
+// AccountCurrencies returns the currency used by each account's most recent posting
+func (l *Ledger) AccountCurrencies() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	currencies := make(map[string]string)
+	for _, txn := range l.transactions {
+		for _, p := range txn.Postings {
+			if p.Currency != "" {
+				currencies[p.Account] = p.Currency
+			}
+		}
+	}
+	return currencies
+}
+
+// PostingCurrencies returns the distinct currencies of postings to 'account', sorted
+func (l *Ledger) PostingCurrencies(account string) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	seen := make(map[string]bool)
+	var currencies []string
+	for _, txn := range l.transactions {
+		for _, p := range txn.Postings {
+			if p.Account == account && p.Currency != "" && !seen[p.Currency] {
+				seen[p.Currency] = true
+				currencies = append(currencies, p.Currency)
+			}
+		}
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
 func timePtr(t time.Time) *time.Time {
 	return &t
 }
 
-// AccountBalance returns the cumulative sum of all postings for 'account' between start and end times
+// AccountBalance returns the cumulative sum of all postings for 'account' between start and end times, excluding income and expense postings of transfers
 func (l *Ledger) AccountBalance(account string, start, end time.Time) decimal.Decimal {
+	return l.AccountBalanceBy(account, start, end, PostingBasis)
+}
+
+// AccountBalanceBy is like AccountBalance, but compares start and end to each transaction's date for 'basis'
+func (l *Ledger) AccountBalanceBy(account string, start, end time.Time, basis DateBasis) decimal.Decimal {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	var sum decimal.Decimal
 	account = strings.ToLower(account)
 	for _, txn := range l.transactions {
-		if !txn.Date.Before(start) && !txn.Date.After(end) {
+		if date := txn.DateFor(basis); !date.Before(start) && !date.After(end) {
 			for _, p := range txn.Postings {
-				if strings.HasPrefix(p.Account, account) {
+				if strings.HasPrefix(p.Account, account) && !l.excludedFromReports(txn, p) {
 					sum = sum.Add(p.Amount)
 				}
 			}
@@ -295,8 +477,13 @@ func (l *Ledger) AccountBalance(account string, start, end time.Time) decimal.De
 	return sum
 }
 
-// LeftOverAccountBalances retrieves balances for any accounts or account prefixes not found in 'accounts' between start and end times
+// LeftOverAccountBalances retrieves balances for any accounts or account prefixes not found in 'accounts' between start and end times, excluding income and expense postings of transfers
 func (l *Ledger) LeftOverAccountBalances(start, end time.Time, accounts ...string) map[string]decimal.Decimal {
+	return l.LeftOverAccountBalancesBy(start, end, PostingBasis, accounts...)
+}
+
+// LeftOverAccountBalancesBy is like LeftOverAccountBalances, but compares start and end to each transaction's date for 'basis'
+func (l *Ledger) LeftOverAccountBalancesBy(start, end time.Time, basis DateBasis, accounts ...string) map[string]decimal.Decimal {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	accountEntries := make([][]string, 0, len(accounts))
@@ -307,10 +494,10 @@ func (l *Ledger) LeftOverAccountBalances(start, end time.Time, accounts ...strin
 
 	leftOver := make(map[string]decimal.Decimal)
 	for _, txn := range l.transactions {
-		if !txn.Date.Before(start) && !txn.Date.After(end) {
+		if date := txn.DateFor(basis); !date.Before(start) && !date.After(end) {
 			for _, p := range txn.Postings {
 				lowerAccount := strings.ToLower(p.Account)
-				if !lookup.HasPrefixTo(strings.Split(lowerAccount, ":")) {
+				if !lookup.HasPrefixTo(strings.Split(lowerAccount, ":")) && !l.excludedFromReports(txn, p) {
 					leftOver[lowerAccount] = leftOver[lowerAccount].Add(p.Amount)
 				}
 			}
@@ -325,24 +512,81 @@ func (l *Ledger) UpdateTransaction(id string, transaction Transaction) error {
 	if id == OpeningBalanceID {
 		return NewValidateError(0, errors.New("Update opening balances with /api/v1/updateOpeningBalance"))
 	}
-	return l.updateTransaction(id, transaction)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.updateTransaction(id, "", transaction)
+}
+
+// UpdateTransactionRevision is the same as UpdateTransaction, but first requires the existing transaction's revision matches 'revision'
+// Returns a RevisionError on mismatch. An empty revision skips the check.
+func (l *Ledger) UpdateTransactionRevision(id, revision string, transaction Transaction) error {
+	if id == OpeningBalanceID {
+		return NewValidateError(0, errors.New("Update opening balances with /api/v1/updateOpeningBalance"))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.updateTransaction(id, revision, transaction)
 }
 
-func (l *Ledger) updateTransaction(id string, transaction Transaction) error {
+// updateTransactions updates each transaction in 'txns' by ID, as one change.
+// If any expected revisions in 'revisions' don't match, returns RevisionErrors and makes no changes.
+// Otherwise, returns validation failures in ledgerErr, separate from more critical failures in err.
+func (l *Ledger) updateTransactions(txns map[string]Transaction, revisions map[string]string) (ledgerErr, err error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if err := l.checkRevisions(revisions); err != nil {
+		return nil, err
+	}
+	var ledgerErrs, errs sErrors.Errors
+	for id, txn := range txns {
+		if id == OpeningBalanceID {
+			ledgerErrs.AddErr(NewValidateError(0, errors.New("Update opening balances with /api/v1/updateOpeningBalance")))
+			continue
+		}
+		switch err := l.updateTransaction(id, revisions[id], txn).(type) {
+		case Error:
+			ledgerErrs.AddErr(err)
+		default:
+			errs.AddErr(err)
+		}
+	}
+	return ledgerErrs.ErrOrNil(), errs.ErrOrNil()
+}
+
+// updateTransaction applies 'transaction' to the existing transaction 'id'. Must be called with the write lock held.
+func (l *Ledger) updateTransaction(id, revision string, transaction Transaction) error {
 	existingTxn := l.idSet[id]
 	if existingTxn == nil {
 		return errors.New("Transaction not found by ID: " + id)
 	}
+	if err := checkRevision(id, revision, *existingTxn); err != nil {
+		return err
+	}
 
-	txnCopy := *existingTxn
+	originalTxn := *existingTxn
+	txnCopy := originalTxn
 	if !transaction.Date.IsZero() {
 		txnCopy.Date = transaction.Date.UTC()
 	}
+	if transaction.EffectiveDate != nil {
+		if transaction.EffectiveDate.IsZero() {
+			// a zero effective date clears it
+			txnCopy.EffectiveDate = nil
+		} else {
+			effective := transaction.EffectiveDate.UTC()
+			txnCopy.EffectiveDate = &effective
+		}
+	}
 	if transaction.Comment != "" {
 		txnCopy.Comment = transaction.Comment
 	}
+	if len(transaction.Tags) > 0 {
+		tags, err := mergeTags(txnCopy.Tags, transaction.Tags)
+		if err != nil {
+			return NewValidateError(0, err)
+		}
+		txnCopy.Tags = tags
+	}
 	if len(transaction.Postings) > 0 {
 		if !isOpeningTransaction(transaction) {
 			var field string
@@ -361,17 +605,63 @@ func (l *Ledger) updateTransaction(id string, transaction Transaction) error {
 				return NewValidateError(0, errors.Errorf("First posting must not change: Attempted to update field %q", field))
 			}
 		}
-		txnCopy.Postings = transaction.Postings
+		txnCopy.Postings = transaction.copy().Postings
+		for i := 1; i < len(txnCopy.Postings); i++ {
+			// normalize categories so updates can't introduce new variants of existing accounts
+			txnCopy.Postings[i].Account = l.canonicalAccount(txnCopy.Postings[i].Account)
+		}
 	}
 	if err := txnCopy.Validate(); err != nil {
 		return err
 	}
+	markManualSplit(originalTxn, &txnCopy)
 
 	*existingTxn = txnCopy
+	if linkID := originalTxn.Tags[FeeLinkTag]; linkID != "" && txnCopy.Tags[FeeLinkTag] == "" {
+		// breaking a fee link removes it from both the fee and its purchase
+		l.unlinkFees(linkID)
+	}
 	l.transactions.Sort()
 	return nil
 }
 
+// mergeTags returns a copy of 'tags' with each of 'updates' applied. An empty value removes the tag. The ID tag must not change.
+func mergeTags(tags, updates map[string]string) (map[string]string, error) {
+	merged := copyTags(tags)
+	if merged == nil {
+		merged = make(map[string]string, len(updates))
+	}
+	for key, value := range updates {
+		switch key {
+		case idTag:
+			if value != merged[idTag] {
+				return nil, errors.Errorf("Transaction tag %q must not change", idTag)
+			}
+			continue
+		case StatusTag:
+			if err := ValidateStatus(value); err != nil {
+				return nil, err
+			}
+		case FeeLinkTag:
+			if value != "" && value != merged[FeeLinkTag] {
+				return nil, errors.Errorf("Transaction tag %q can only be removed", FeeLinkTag)
+			}
+		case AmortizeTag:
+			if value != "" {
+				if _, err := ParseAmortization(value); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if value == "" {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged, nil
+}
+
 // UpdateAccount changes all transactions' accounts matching oldAccount to newAccount
 func (l *Ledger) UpdateAccount(oldAccount, newAccount string) error {
 	if newAccount == "" {
@@ -397,7 +687,7 @@ func (l *Ledger) OpeningBalances() (opening Transaction, found bool) {
 	if existingTxn == nil {
 		return
 	}
-	return *existingTxn, true
+	return existingTxn.copy(), true
 }
 
 // UpdateOpeningBalance inserts or updates an account's opening balance for this ledger.
@@ -421,10 +711,12 @@ func (l *Ledger) UpdateOpeningBalance(opening Transaction) error {
 		Postings: opening.Postings,
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if l.idSet[OpeningBalanceID] == nil {
-		return l.AddTransactions([]Transaction{newOpening})
+		return l.addTransactions([]Transaction{newOpening})
 	}
-	return l.updateTransaction(OpeningBalanceID, newOpening)
+	return l.updateTransaction(OpeningBalanceID, "", newOpening)
 }
 
 func isOpeningTransaction(txn Transaction) bool {
@@ -436,6 +728,9 @@ func isOpeningTransaction(txn Transaction) bool {
 	return false
 }
 
+// Size returns the number of transactions in the ledger
 func (l *Ledger) Size() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return len(l.transactions)
 }
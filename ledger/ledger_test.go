@@ -2,12 +2,17 @@ package ledger
 
 import (
 	"bytes"
+	"fmt"
+	"sort"
 	"strings"
+	gosync "sync"
 	"testing"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
 )
 
 const (
@@ -164,6 +169,41 @@ func TestLedgerString(t *testing.T) {
 	`)+"\n\n", ldg.String())
 }
 
+func TestLedgerRoundTripCurrencies(t *testing.T) {
+	ldg, err := New([]Transaction{
+		{
+			Date:  parseDate(t, "2019/01/02"),
+			Payee: "some cafe in Paris",
+			Tags:  makeIDTag("A"),
+			Postings: []Posting{
+				{Account: "assets:eur", Amount: *decFloat(-5), Currency: "EUR", Tags: makeIDTag("B")},
+				{Account: "expenses:food", Amount: *decFloat(5), Currency: "EUR"},
+			},
+		},
+		{
+			Date:  parseDate(t, "2019/01/03"),
+			Payee: "some cafe in London",
+			Tags:  makeIDTag("C"),
+			Postings: []Posting{
+				{Account: "assets:gbp", Amount: *decFloat(-2.5), Currency: "£", Tags: makeIDTag("D")},
+				{Account: "expenses:food", Amount: *decFloat(2.5), Currency: "£"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	reread, err := NewFromReader(strings.NewReader(ldg.String()))
+	require.NoError(t, err)
+	assert.Equal(t, ldg.String(), reread.String())
+	assert.Equal(t, map[string]string{
+		"assets:eur":    "EUR",
+		"assets:gbp":    "£",
+		"expenses:food": "£",
+	}, reread.AccountCurrencies())
+	_, _, balances := reread.Balances()
+	assert.Equal(t, "-5", balances["assets:eur"][0].String())
+}
+
 func TestLedgerValidate(t *testing.T) {
 	for _, tc := range []struct {
 		description string
@@ -799,6 +839,177 @@ func TestBalances(t *testing.T) {
 	}, floatBalances)
 }
 
+func TestBalancesAsOf(t *testing.T) {
+	makeTxn := func(date string, num float64) Transaction {
+		return Transaction{
+			Date:  parseDate(t, date),
+			Payee: "some payee",
+			Postings: []Posting{
+				{Account: "assets:something", Amount: *decFloat(-num)},
+				{Account: "expenses:food", Amount: *decFloat(num)},
+			},
+		}
+	}
+	ldg, err := New([]Transaction{
+		makeTxn("2019/06/20", 4),
+		makeTxn("2019/06/01", 1),
+		makeTxn("2019/06/15", 2),
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		asOf   string
+		expect map[string]string
+	}{
+		{asOf: "2019/05/31", expect: map[string]string{}},
+		{asOf: "2019/06/14", expect: map[string]string{"assets:something": "-1", "expenses:food": "1"}},
+		{asOf: "2019/06/15", expect: map[string]string{"assets:something": "-3", "expenses:food": "3"}},
+		{asOf: "2020/01/01", expect: map[string]string{"assets:something": "-7", "expenses:food": "7"}},
+	} {
+		t.Run(tc.asOf, func(t *testing.T) {
+			balances := make(map[string]string)
+			for account, balance := range ldg.BalancesAsOf(parseDate(t, tc.asOf)) {
+				balances[account] = balance.String()
+			}
+			assert.Equal(t, tc.expect, balances)
+		})
+	}
+
+	t.Run("out of order file", func(t *testing.T) {
+		file := &mockFile{}
+		file.buf.WriteString(`
+2019/06/20 some payee
+    assets:something   $-4
+    expenses:food   $4
+
+2019/06/01 some payee
+    assets:something   $-1
+    expenses:food   $1
+
+2019/06/15 some payee
+    assets:something   $-2
+    expenses:food   $2
+`)
+		store, err := NewStore(file, zaptest.NewLogger(t))
+		require.NoError(t, err)
+		assert.Equal(t, "-3", store.BalancesAsOf(parseDate(t, "2019/06/15"))["assets:something"].String())
+
+		require.NoError(t, store.AddTransactions([]Transaction{makeTxn("2019/06/10", 8)}))
+		assert.Equal(t, "-11", store.BalancesAsOf(parseDate(t, "2019/06/15"))["assets:something"].String())
+		written := file.buf.String()
+		var indexes []int
+		for _, date := range []string{"2019/06/01", "2019/06/10", "2019/06/15", "2019/06/20"} {
+			index := strings.Index(written, date)
+			require.NotEqual(t, -1, index, "Written file should contain %s:\n%s", date, written)
+			indexes = append(indexes, index)
+		}
+		assert.True(t, sort.IntsAreSorted(indexes), "Written file should be sorted by date:\n%s", written)
+	})
+}
+
+func TestLastPostingTime(t *testing.T) {
+	ldg, err := New([]Transaction{
+		{
+			Date:  parseDate(t, "2019/06/20"),
+			Payee: "some payee",
+			Postings: []Posting{
+				{Account: "assets:something", Amount: *decFloat(-1)},
+				{Account: "expenses:food", Amount: *decFloat(1)},
+			},
+		},
+		{
+			Date:  parseDate(t, "2019/06/01"),
+			Payee: "some payee",
+			Postings: []Posting{
+				{Account: "assets:something", Amount: *decFloat(-1)},
+				{Account: "expenses:rent", Amount: *decFloat(1)},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, parseDate(t, "2019/06/20"), ldg.LastPostingTime("assets:something"))
+	assert.Equal(t, parseDate(t, "2019/06/01"), ldg.LastPostingTime("expenses:rent"))
+	assert.True(t, ldg.LastPostingTime("assets:other").IsZero())
+}
+
+func TestAccountCurrencies(t *testing.T) {
+	ldg, err := New([]Transaction{
+		{
+			Date:  parseDate(t, "2020/01/01"),
+			Payee: "some payee",
+			Postings: []Posting{
+				{Account: "assets:euro bank", Amount: *decFloat(-1), Currency: "EUR", Tags: makeIDTag("1")},
+				{Account: "expenses:food", Amount: *decFloat(1), Currency: "EUR"},
+			},
+		},
+		{
+			Date:  parseDate(t, "2020/01/02"),
+			Payee: "some payee",
+			Postings: []Posting{
+				{Account: "assets:bank", Amount: *decFloat(-1), Currency: usd, Tags: makeIDTag("2")},
+				{Account: "expenses:food", Amount: *decFloat(1), Currency: usd},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"assets:euro bank": "EUR",
+		"assets:bank":      usd,
+		"expenses:food":    usd,
+	}, ldg.AccountCurrencies())
+}
+
+func TestBalancesByEffectiveDate(t *testing.T) {
+	jan3, feb1 := parseDate(t, "2019/01/03"), parseDate(t, "2019/02/01")
+	dec31 := parseDate(t, "2018/12/31")
+	ldg, err := New([]Transaction{
+		{
+			Date:          jan3,
+			EffectiveDate: &dec31,
+			Payee:         "rent",
+			Postings: []Posting{
+				{Account: "expenses:rent", Amount: *decFloat(100)},
+				{Account: "assets:bank", Amount: *decFloat(-100)},
+			},
+			Tags: map[string]string{idTag: "1"},
+		},
+		{
+			Date:  feb1,
+			Payee: "food",
+			Postings: []Posting{
+				{Account: "expenses:food", Amount: *decFloat(5)},
+				{Account: "assets:bank", Amount: *decFloat(-5)},
+			},
+			Tags: map[string]string{idTag: "2"},
+		},
+	})
+	require.NoError(t, err)
+
+	start, end, balances := ldg.BalancesBy(EffectiveBasis)
+	assert.Equal(t, dec31, *start)
+	assert.Equal(t, feb1, *end)
+	assert.Len(t, balances["expenses:rent"], 3)
+	assert.Equal(t, "100", balances["expenses:rent"][0].String())
+
+	start, _, balances = ldg.Balances()
+	assert.Equal(t, jan3, *start)
+	assert.Len(t, balances["expenses:rent"], 2)
+
+	january := parseDate(t, "2019/01/01")
+	assert.Equal(t, "100", ldg.AccountBalance("expenses:rent", january, feb1).String())
+	assert.True(t, ldg.AccountBalanceBy("expenses:rent", january, feb1, EffectiveBasis).IsZero())
+	assert.Equal(t, map[string]decimal.Decimal{"expenses:food": *decFloat(5)}, ldg.LeftOverAccountBalancesBy(january, feb1, EffectiveBasis, "assets"))
+
+	err = ldg.UpdateTransaction("2", Transaction{EffectiveDate: &jan3})
+	require.NoError(t, err)
+	txn, _ := ldg.Transaction("2")
+	assert.Equal(t, &jan3, txn.EffectiveDate)
+	err = ldg.UpdateTransaction("2", Transaction{EffectiveDate: &time.Time{}})
+	require.NoError(t, err)
+	txn, _ = ldg.Transaction("2")
+	assert.Nil(t, txn.EffectiveDate)
+}
+
 func TestAccountBalance(t *testing.T) {
 	var date time.Time
 	makeTxn := func(account string, num float64, increment time.Duration) Transaction {
@@ -914,6 +1125,81 @@ func TestSize(t *testing.T) {
 	assert.Equal(t, len(txns), l.Size())
 }
 
+func TestTransactionsAreCopied(t *testing.T) {
+	txns := []Transaction{
+		{
+			Date:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Payee: "some payee",
+			Postings: []Posting{
+				{Account: "assets:bank", Amount: *decFloat(-1), Tags: makeIDTag("some-id")},
+				{Account: "expenses", Amount: *decFloat(1)},
+			},
+		},
+	}
+	l, err := New(nil)
+	require.NoError(t, err)
+	require.NoError(t, l.AddTransactions(txns))
+	txns[0].Postings[1].Account = "expenses:added"
+
+	txn, found := l.Transaction("some-id")
+	require.True(t, found)
+	assert.Equal(t, "expenses", txn.Postings[1].Account, "Added transactions should not share postings with the caller")
+	txn.Postings[1].Account = "expenses:read"
+	txn.Postings[0].Tags["other"] = "tag"
+
+	result := l.Query(QueryOptions{}, 1, 1)
+	require.Len(t, result.Transactions, 1)
+	assert.Equal(t, "expenses", result.Transactions[0].Postings[1].Account, "Returned transactions should not share postings with the ledger")
+	assert.Equal(t, makeIDTag("some-id"), result.Transactions[0].Postings[0].Tags)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	// run with -race to detect unsynchronized access
+	l, err := New(nil)
+	require.NoError(t, err)
+	const writes = 50
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var wg gosync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			id := fmt.Sprintf("txn-%d", i)
+			assert.NoError(t, l.AddTransactions([]Transaction{{
+				Date:  start.AddDate(0, 0, i),
+				Payee: "some payee",
+				Postings: []Posting{
+					{Account: "assets:bank", Amount: *decFloat(-1), Tags: makeIDTag(id)},
+					{Account: "expenses", Amount: *decFloat(1)},
+				},
+			}}))
+			assert.NoError(t, l.UpdateTransaction(id, Transaction{Payee: "updated payee"}))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			l.RenameAccount("expenses", "expenses", "", "")
+			assert.NoError(t, l.UpdateAccount("expenses", "expenses"))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			for _, txn := range l.Query(QueryOptions{}, 1, writes).Transactions {
+				for _, p := range txn.Postings {
+					_ = p.Account + p.Tags[idTag]
+				}
+			}
+			_ = l.String()
+			_ = l.Size()
+			_, _, _ = l.Balances()
+		}
+	}()
+	wg.Wait()
+	assert.Equal(t, writes, l.Size())
+}
+
 func TestOpeningBalances(t *testing.T) {
 	l, err := New(nil)
 	require.NoError(t, err)
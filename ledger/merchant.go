@@ -0,0 +1,88 @@
+package ledger
+
+import (
+	"strings"
+)
+
+const (
+	// MerchantTag holds a cleaned merchant name, which replaces the institution's raw payee
+	MerchantTag = "merchant"
+	// MerchantCityTag holds the merchant's city
+	MerchantCityTag = "merchant_city"
+	// MerchantRegionTag holds the merchant's state or region
+	MerchantRegionTag = "merchant_region"
+	// MerchantWebsiteTag holds the merchant's website, without its scheme
+	MerchantWebsiteTag = "merchant_website"
+	// RawPayeeTag holds the institution's original payee when a merchant name replaced it
+	RawPayeeTag = "raw_payee"
+
+	// maxMerchantTagLength keeps merchant tags from growing the payee line too much
+	maxMerchantTagLength = 64
+)
+
+// Merchant is structured merchant detail for a transaction, usually more descriptive than the institution's payee
+type Merchant struct {
+	Name    string `json:",omitempty"`
+	City    string `json:",omitempty"`
+	Region  string `json:",omitempty"`
+	Website string `json:",omitempty"`
+}
+
+// IsEmpty returns true if m has no details
+func (m Merchant) IsEmpty() bool {
+	return m == Merchant{}
+}
+
+// SetMerchant stores m's details as tags on t. If m has a name, it replaces t's payee and the original payee is kept in RawPayeeTag.
+// Long details are truncated and escaped like notes, so they can't break the ledger's tag syntax.
+func (t *Transaction) SetMerchant(m Merchant) {
+	tags := copyTags(t.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	setTag := func(key, value string) {
+		if value = encodeMerchantTag(value); value != "" {
+			tags[key] = value
+		}
+	}
+	setTag(MerchantCityTag, m.City)
+	setTag(MerchantRegionTag, m.Region)
+	website := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(m.Website), "https://"), "http://")
+	setTag(MerchantWebsiteTag, strings.TrimSuffix(website, "/"))
+	// semicolons would start a comment on the payee line
+	if name := strings.Join(strings.Fields(strings.Replace(m.Name, ";", " ", -1)), " "); name != "" {
+		setTag(MerchantTag, name)
+		if name != t.Payee {
+			if _, exists := tags[RawPayeeTag]; !exists {
+				tags[RawPayeeTag] = EncodeNote(t.Payee)
+			}
+			t.Payee = name
+		}
+	}
+	if len(tags) > 0 {
+		t.Tags = tags
+	}
+}
+
+// Merchant returns t's merchant details, which are empty if none were stored
+func (t Transaction) Merchant() Merchant {
+	return Merchant{
+		Name:    noteDecoder.Replace(t.Tags[MerchantTag]),
+		City:    noteDecoder.Replace(t.Tags[MerchantCityTag]),
+		Region:  noteDecoder.Replace(t.Tags[MerchantRegionTag]),
+		Website: noteDecoder.Replace(t.Tags[MerchantWebsiteTag]),
+	}
+}
+
+// RawPayee returns the institution's original payee. Returns an empty string if t's payee was never replaced.
+func (t Transaction) RawPayee() string {
+	return noteDecoder.Replace(t.Tags[RawPayeeTag])
+}
+
+func encodeMerchantTag(value string) string {
+	runes := []rune(strings.TrimSpace(value))
+	if len(runes) > maxMerchantTagLength {
+		runes = runes[:maxMerchantTagLength]
+	}
+	return EncodeNote(string(runes))
+}
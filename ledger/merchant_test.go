@@ -0,0 +1,58 @@
+package ledger
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerchantRoundTrip(t *testing.T) {
+	txn := Transaction{
+		Date:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Payee: "SQ *CORNER CAFE, 0123 AUSTIN",
+		Postings: []Posting{
+			{Account: "assets:bank", Amount: *decFloat(-10), Tags: makeIDTag("1")},
+			{Account: "expenses:food", Amount: *decFloat(10)},
+		},
+	}
+	txn.SetMerchant(Merchant{
+		Name:    " Corner  Cafe; Downtown ",
+		City:    "Austin",
+		Region:  "TX",
+		Website: "https://cornercafe.example.com/",
+	})
+	assert.Equal(t, "Corner Cafe Downtown", txn.Payee)
+	assert.Equal(t, "SQ *CORNER CAFE, 0123 AUSTIN", txn.RawPayee())
+
+	txns, _, err := readAllTransactions(bufio.NewScanner(strings.NewReader(txn.String())))
+	require.NoError(t, err)
+	require.Len(t, txns, 1)
+	assert.Equal(t, "Corner Cafe Downtown", txns[0].Payee)
+	assert.Equal(t, "SQ *CORNER CAFE, 0123 AUSTIN", txns[0].RawPayee())
+	assert.Equal(t, Merchant{
+		Name:    "Corner Cafe Downtown",
+		City:    "Austin",
+		Region:  "TX",
+		Website: "cornercafe.example.com",
+	}, txns[0].Merchant())
+	assert.Equal(t, "1", txns[0].Postings[0].ID())
+
+	txns[0].SetMerchant(Merchant{Name: "Corner Cafe"})
+	assert.Equal(t, "SQ *CORNER CAFE, 0123 AUSTIN", txns[0].RawPayee(), "The original raw payee should be kept")
+}
+
+func TestSetMerchantPartial(t *testing.T) {
+	txn := Transaction{Payee: "some payee"}
+	txn.SetMerchant(Merchant{})
+	assert.Nil(t, txn.Tags)
+	assert.True(t, txn.Merchant().IsEmpty())
+
+	txn.SetMerchant(Merchant{City: strings.Repeat("a", 100)})
+	assert.Equal(t, "some payee", txn.Payee, "Payee should be unchanged without a merchant name")
+	assert.Empty(t, txn.RawPayee())
+	assert.Len(t, txn.Merchant().City, maxMerchantTagLength)
+}
@@ -0,0 +1,63 @@
+package ledger
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NoteTag holds the user's own note on a transaction, kept separate from the bank-provided memo in Comment
+const NoteTag = "note"
+
+var (
+	// noteEncoder escapes characters which would otherwise break tag parsing
+	noteEncoder = strings.NewReplacer(
+		"%", "%25",
+		",", "%2C",
+		"\n", "%0A",
+		"\r", "%0D",
+	)
+	noteDecoder = strings.NewReplacer(
+		"%25", "%",
+		"%2C", ",",
+		"%0A", "\n",
+		"%0D", "\r",
+	)
+)
+
+// EncodeNote returns 'note' in its NoteTag form
+func EncodeNote(note string) string {
+	return noteEncoder.Replace(strings.TrimSpace(note))
+}
+
+// Note returns the user's note on t, or an empty string if there isn't one
+func (t Transaction) Note() string {
+	return noteDecoder.Replace(t.Tags[NoteTag])
+}
+
+// SetNote sets the user's note on t. An empty note removes it.
+func (t *Transaction) SetNote(note string) {
+	value := EncodeNote(note)
+	if value == "" {
+		delete(t.Tags, NoteTag)
+		return
+	}
+	if t.Tags == nil {
+		t.Tags = make(map[string]string)
+	}
+	t.Tags[NoteTag] = value
+}
+
+// SetNote sets the user's note on the transaction with ID 'id'. An empty note removes it.
+func (l *Ledger) SetNote(id, note string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	existingTxn := l.idSet[id]
+	if existingTxn == nil {
+		return errors.New("Transaction not found by ID: " + id)
+	}
+	txn := existingTxn.copy()
+	txn.SetNote(note)
+	*existingTxn = txn
+	return nil
+}
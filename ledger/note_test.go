@@ -0,0 +1,76 @@
+package ledger
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoteRoundTrip(t *testing.T) {
+	note := "split with Sam, 50%\nwarranty: expires 2026"
+	txn := Transaction{
+		Date:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Payee:   "Some Shop",
+		Comment: "bank memo",
+		Postings: []Posting{
+			{Account: "assets:bank", Amount: *decFloat(-10), Tags: makeIDTag("1")},
+			{Account: "expenses:shopping", Amount: *decFloat(10)},
+		},
+	}
+	txn.SetNote(note)
+
+	txns, _, err := readAllTransactions(bufio.NewScanner(strings.NewReader(txn.String())))
+	require.NoError(t, err)
+	require.Len(t, txns, 1)
+	assert.Equal(t, note, txns[0].Note())
+	assert.Equal(t, "bank memo", txns[0].Comment)
+	assert.Equal(t, "1", txns[0].Postings[0].ID())
+
+	txns[0].SetNote("  ")
+	assert.NotContains(t, txns[0].Tags, NoteTag)
+}
+
+func TestNoteSurvivesPostedReplacement(t *testing.T) {
+	pending := Transaction{
+		Date:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Payee:   "Some Shop",
+		Comment: "pending",
+		Postings: []Posting{
+			{Account: "assets:bank", Amount: *decFloat(-10), Tags: makeIDTag("1")},
+			{Account: "expenses:uncategorized", Amount: *decFloat(10)},
+		},
+	}
+	l, err := New([]Transaction{pending})
+	require.NoError(t, err)
+	require.NoError(t, l.SetNote("1", "warranty expires 2026"))
+
+	posted := Transaction{
+		Date:    time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+		Payee:   "Some Shop",
+		Comment: "posted",
+		Tags:    map[string]string{"bank": "something"},
+		Postings: []Posting{
+			{Account: "assets:bank", Amount: *decFloat(-10), Tags: makeIDTag("1")},
+			{Account: "expenses:shopping", Amount: *decFloat(10)},
+		},
+	}
+	require.NoError(t, l.UpdateTransaction("1", posted))
+	txn, found := l.Transaction("1")
+	require.True(t, found)
+	assert.Equal(t, time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), txn.Date)
+	assert.Equal(t, "posted", txn.Comment)
+	assert.Equal(t, "expenses:shopping", txn.Postings[1].Account)
+	assert.Equal(t, "something", txn.Tags["bank"])
+	assert.Equal(t, "warranty expires 2026", txn.Note())
+
+	// syncing the same transaction again keeps the existing one
+	require.NoError(t, l.AddTransactions([]Transaction{posted}))
+	txn, _ = l.Transaction("1")
+	assert.Equal(t, "warranty expires 2026", txn.Note())
+
+	assert.Equal(t, 1, txn.matches("warranty"))
+}
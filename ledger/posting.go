@@ -3,6 +3,7 @@ package ledger
 import (
 	"fmt"
 	"strings"
+	"unicode"
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
@@ -26,7 +27,6 @@ type Posting struct {
 
 func NewPostingFromString(line string) (Posting, error) {
 	var posting Posting
-	// TODO support more than USD
 	// comment / tags
 	tokens := strings.SplitN(line, ";", 2)
 	line = strings.TrimSpace(tokens[0])
@@ -48,14 +48,15 @@ func NewPostingFromString(line string) (Posting, error) {
 	// amount / balance
 	tokens = strings.SplitN(line, "=", 2)
 	var err error
-	posting.Amount, err = parseAmount(strings.TrimSpace(tokens[0]))
+	posting.Amount, posting.Currency, err = parseAmount(strings.TrimSpace(tokens[0]))
 	if err != nil {
 		return posting, errors.Wrap(err, "Invalid amount")
 	}
-	posting.Currency = usd
 	if len(tokens) == 2 {
 		var balance decimal.Decimal
-		balance, err = parseAmount(strings.TrimSpace(tokens[1]))
+		// hledger's total assertions use '==', and either dialect may include subaccounts with '*'
+		balanceStr := strings.TrimLeft(strings.TrimSpace(tokens[1]), "=*")
+		balance, _, err = parseAmount(strings.TrimSpace(balanceStr))
 		posting.Balance = &balance
 		if err != nil {
 			return posting, errors.Wrap(err, "Invalid balance")
@@ -64,16 +65,47 @@ func NewPostingFromString(line string) (Posting, error) {
 	return posting, nil
 }
 
-func parseAmount(amount string) (decimal.Decimal, error) {
-	amount = strings.TrimPrefix(amount, usd)
+// parseAmount parses an amount and its commodity, like "$ -5", "-$5", "EUR 5", or "5 EUR". Amounts without a commodity are in USD.
+func parseAmount(amount string) (decimal.Decimal, string, error) {
 	amount = strings.TrimSpace(amount)
+	negative := false
+	if len(amount) > 1 && amount[0] == '-' && !isAmountNumber(rune(amount[1])) {
+		// sign before the commodity symbol, like -$5
+		negative = true
+		amount = amount[1:]
+	}
+	start := strings.IndexFunc(amount, isAmountNumber)
+	end := strings.LastIndexFunc(amount, unicode.IsDigit) + 1
+	if start < 0 || end <= start {
+		return decimal.Zero, "", errors.Errorf("can't convert %s to decimal", amount)
+	}
+	prefix := strings.Trim(strings.TrimSpace(amount[:start]), `"`)
+	suffix := strings.Trim(strings.TrimSpace(amount[end:]), `"`)
+	if prefix != "" && suffix != "" {
+		return decimal.Zero, "", errors.Errorf("can't convert %s to decimal: amounts must have only one commodity", amount)
+	}
+	currency := prefix + suffix
+	if currency == "" {
+		currency = usd
+	}
 	// TODO support thousands delimiter other than ','
-	amount = strings.Replace(amount, ",", "", -1)
-	return decimal.NewFromString(amount)
+	value, err := decimal.NewFromString(strings.Replace(amount[start:end], ",", "", -1))
+	if err != nil {
+		return decimal.Zero, "", err
+	}
+	if negative {
+		value = value.Neg()
+	}
+	return value, currency, nil
+}
+
+func isAmountNumber(r rune) bool {
+	return unicode.IsDigit(r) || r == '-' || r == '+' || r == '.'
 }
 
+// ID returns the posting's transaction ID, recognizing every historical ID tag format
 func (p Posting) ID() string {
-	return p.Tags[idTag]
+	return canonicalID(p.Tags)
 }
 
 func stringPad(s string, amount int) string {
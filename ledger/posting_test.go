@@ -112,6 +112,48 @@ func TestNewPostingFromString(t *testing.T) {
 				Currency: usd,
 			},
 		},
+		{
+			description: "currency code",
+			str:         "assets:Bank1  EUR -5 = EUR 10.5",
+			posting: Posting{
+				Account:  "assets:Bank1",
+				Amount:   *decFloat(-5),
+				Balance:  decFloat(10.5),
+				Currency: "EUR",
+			},
+		},
+		{
+			description: "currency code after amount",
+			str:         "assets:Bank1  5.50 EUR",
+			posting: Posting{
+				Account:  "assets:Bank1",
+				Amount:   *decFloat(5.50),
+				Currency: "EUR",
+			},
+		},
+		{
+			description: "currency symbol after sign",
+			str:         "assets:Bank1  -€5",
+			posting: Posting{
+				Account:  "assets:Bank1",
+				Amount:   *decFloat(-5),
+				Currency: "€",
+			},
+		},
+		{
+			description: "no currency",
+			str:         "assets:Bank1  5",
+			posting: Posting{
+				Account:  "assets:Bank1",
+				Amount:   *decFloat(5),
+				Currency: usd,
+			},
+		},
+		{
+			description: "currency on both sides",
+			str:         "assets:Bank1  EUR 5 EUR",
+			shouldErr:   true,
+		},
 	} {
 		t.Run(tc.description, func(t *testing.T) {
 			posting, err := NewPostingFromString(tc.str)
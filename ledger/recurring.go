@@ -0,0 +1,165 @@
+package ledger
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// Weekly is the cadence of a recurring series occurring every week
+	Weekly = "weekly"
+	// Monthly is the cadence of a recurring series occurring every month
+	Monthly = "monthly"
+
+	minRecurringOccurrences = 3
+	minRecurringConfidence  = 0.5
+	// recurringAmountTolerance is the maximum ratio an amount may vary from the typical amount and still be considered the same charge
+	recurringAmountTolerance = 0.1
+)
+
+// RecurringSeries is a set of transactions with the same payee and similar amounts on a regular cadence
+type RecurringSeries struct {
+	ID           string // stable identifier for the series, based on its account, payee, and direction of money flow
+	Payee        string
+	Account      string
+	Category     string
+	Cadence      string
+	Confidence   float64
+	Occurrences  int
+	LastDate     time.Time
+	NextDate     time.Time
+	NextAmount   decimal.Decimal
+	Transactions []string // IDs of transactions in this series, oldest first
+}
+
+type cadence struct {
+	name             string
+	minDays, maxDays int
+	// add returns the date 'n' occurrences after 't'. Monthly days are clamped to shorter months without drifting later occurrences.
+	add func(t time.Time, n int) time.Time
+}
+
+// next returns the occurrence after 't'
+func (c cadence) next(t time.Time) time.Time {
+	return c.add(t, 1)
+}
+
+var cadences = []cadence{
+	{name: Weekly, minDays: 6, maxDays: 8, add: func(t time.Time, n int) time.Time { return t.AddDate(0, 0, 7*n) }},
+	{name: Monthly, minDays: 26, maxDays: 35, add: addMonthsClamped},
+}
+
+func findCadence(name string) (cadence, bool) {
+	for _, c := range cadences {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return cadence{}, false
+}
+
+// Recurring detects recurring transaction series, i.e. subscriptions, and forecasts their next occurrence.
+// Series are sorted by their next expected date.
+func (l *Ledger) Recurring() []RecurringSeries {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.recurring()
+}
+
+func (l *Ledger) recurring() []RecurringSeries {
+	groups := make(map[string][]*Transaction)
+	var groupKeys []string
+	for _, txn := range l.transactions {
+		if len(txn.Postings) < 2 || isOpeningTransaction(*txn) || IsSimulated(*txn) {
+			continue
+		}
+		key := recurringKey(*txn)
+		if _, exists := groups[key]; !exists {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], txn)
+	}
+
+	var series []RecurringSeries
+	for _, key := range groupKeys {
+		Transactions(groups[key]).Sort()
+		if s, ok := detectRecurring(groups[key]); ok {
+			s.ID = shortHash(key)
+			series = append(series, s)
+		}
+	}
+	sort.SliceStable(series, func(a, b int) bool {
+		return series[a].NextDate.Before(series[b].NextDate)
+	})
+	return series
+}
+
+// recurringKey groups transactions by account, payee, and direction of money flow
+func recurringKey(txn Transaction) string {
+	direction := "+"
+	if txn.Postings[0].Amount.IsNegative() {
+		direction = "-"
+	}
+	return txn.Postings[0].Account + ";" + strings.ToLower(strings.TrimSpace(txn.Payee)) + ";" + direction
+}
+
+// detectRecurring attempts to find a cadence for the given transactions. Transactions must be sorted by date.
+func detectRecurring(txns []*Transaction) (RecurringSeries, bool) {
+	if len(txns) < minRecurringOccurrences {
+		return RecurringSeries{}, false
+	}
+
+	last := txns[len(txns)-1]
+	typicalAmount := last.Postings[0].Amount.Abs()
+	tolerance := typicalAmount.Mul(decimal.NewFromFloat(recurringAmountTolerance))
+	similarAmounts := 0
+	for _, txn := range txns {
+		if txn.Postings[0].Amount.Abs().Sub(typicalAmount).Abs().LessThanOrEqual(tolerance) {
+			similarAmounts++
+		}
+	}
+
+	var best cadence
+	bestMatches := 0
+	for _, c := range cadences {
+		matches := 0
+		for i := 1; i < len(txns); i++ {
+			days := int(txns[i].Date.Sub(txns[i-1].Date).Hours() / 24)
+			if days >= c.minDays && days <= c.maxDays {
+				matches++
+			}
+		}
+		if matches > bestMatches {
+			best, bestMatches = c, matches
+		}
+	}
+	if bestMatches == 0 {
+		return RecurringSeries{}, false
+	}
+
+	intervals := len(txns) - 1
+	confidence := float64(bestMatches) / float64(intervals) * float64(similarAmounts) / float64(len(txns))
+	if confidence < minRecurringConfidence {
+		return RecurringSeries{}, false
+	}
+
+	ids := make([]string, 0, len(txns))
+	for _, txn := range txns {
+		ids = append(ids, txn.Postings[0].ID())
+	}
+	return RecurringSeries{
+		Payee:        last.Payee,
+		Account:      last.Postings[0].Account,
+		Category:     last.Postings[len(last.Postings)-1].Account,
+		Cadence:      best.name,
+		Confidence:   confidence,
+		Occurrences:  len(txns),
+		LastDate:     last.Date,
+		NextDate:     best.next(last.Date),
+		NextAmount:   last.Postings[0].Amount,
+		Transactions: ids,
+	}, true
+}
@@ -0,0 +1,111 @@
+package ledger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recurringTxns(t *testing.T, payee string, dates []string, amounts []float64) []Transaction {
+	var txns []Transaction
+	for i, date := range dates {
+		txns = append(txns, Transaction{
+			Date:  parseDate(t, date),
+			Payee: payee,
+			Postings: []Posting{
+				{Account: "assets:Super Bank:****1234", Amount: *decFloat(-amounts[i]), Currency: usd, Tags: makeIDTag(fmt.Sprintf("%s-%d", payee, i))},
+				{Account: "expenses:subscriptions", Amount: *decFloat(amounts[i]), Currency: usd},
+			},
+		})
+	}
+	return txns
+}
+
+func TestRecurring(t *testing.T) {
+	for _, tc := range []struct {
+		description     string
+		txns            []Transaction
+		expectCadence   string
+		expectNextDate  string
+		expectNoResults bool
+	}{
+		{
+			description:    "monthly",
+			txns:           recurringTxns(t, "Streaming", []string{"2020/01/15", "2020/02/15", "2020/03/16", "2020/04/15"}, []float64{10, 10, 10, 11}),
+			expectCadence:  Monthly,
+			expectNextDate: "2020/05/15",
+		},
+		{
+			description:    "monthly on the 31st",
+			txns:           recurringTxns(t, "Streaming", []string{"2018/10/31", "2018/11/30", "2018/12/31", "2019/01/31"}, []float64{10, 10, 10, 10}),
+			expectCadence:  Monthly,
+			expectNextDate: "2019/02/28",
+		},
+		{
+			description:    "monthly on the 31st in a leap year",
+			txns:           recurringTxns(t, "Streaming", []string{"2019/10/31", "2019/11/30", "2019/12/31", "2020/01/31"}, []float64{10, 10, 10, 10}),
+			expectCadence:  Monthly,
+			expectNextDate: "2020/02/29",
+		},
+		{
+			description:    "monthly ending on Feb 28",
+			txns:           recurringTxns(t, "Streaming", []string{"2018/11/28", "2018/12/28", "2019/01/28", "2019/02/28"}, []float64{10, 10, 10, 10}),
+			expectCadence:  Monthly,
+			expectNextDate: "2019/03/28",
+		},
+		{
+			description:    "weekly",
+			txns:           recurringTxns(t, "Groceries", []string{"2020/01/01", "2020/01/08", "2020/01/15"}, []float64{50, 52, 50}),
+			expectCadence:  Weekly,
+			expectNextDate: "2020/01/22",
+		},
+		{
+			description:     "too few occurrences",
+			txns:            recurringTxns(t, "Streaming", []string{"2020/01/15", "2020/02/15"}, []float64{10, 10}),
+			expectNoResults: true,
+		},
+		{
+			description:     "irregular dates",
+			txns:            recurringTxns(t, "Hardware", []string{"2020/01/01", "2020/01/20", "2020/04/01"}, []float64{10, 10, 10}),
+			expectNoResults: true,
+		},
+		{
+			description:     "varying amounts",
+			txns:            recurringTxns(t, "Restaurant", []string{"2020/01/01", "2020/02/01", "2020/03/01"}, []float64{10, 40, 90}),
+			expectNoResults: true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ldg, err := New(tc.txns)
+			require.NoError(t, err)
+			series := ldg.Recurring()
+			if tc.expectNoResults {
+				assert.Empty(t, series)
+				return
+			}
+			require.Len(t, series, 1)
+			assert.Equal(t, tc.expectCadence, series[0].Cadence)
+			assert.Equal(t, parseDate(t, tc.expectNextDate), series[0].NextDate)
+			assert.Equal(t, len(tc.txns), series[0].Occurrences)
+			assert.True(t, series[0].Confidence >= minRecurringConfidence && series[0].Confidence <= 1)
+			last := tc.txns[len(tc.txns)-1]
+			assert.Equal(t, last.Postings[0].Amount.String(), series[0].NextAmount.String())
+			assert.Equal(t, "expenses:subscriptions", series[0].Category)
+		})
+	}
+}
+
+func TestRecurringSortsByNextDate(t *testing.T) {
+	txns := recurringTxns(t, "Streaming", []string{"2020/01/15", "2020/02/15", "2020/03/15"}, []float64{10, 10, 10})
+	txns = append(txns, recurringTxns(t, "Gym", []string{"2020/01/01", "2020/02/01", "2020/03/01"}, []float64{30, 30, 30})...)
+	ldg, err := New(txns)
+	require.NoError(t, err)
+	series := ldg.Recurring()
+	require.Len(t, series, 2)
+	assert.Equal(t, "Gym", series[0].Payee)
+	assert.Equal(t, "Streaming", series[1].Payee)
+	assert.Equal(t, time.April, series[1].NextDate.Month())
+}
@@ -0,0 +1,63 @@
+package ledger
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// RegisterRow is a transaction in an account's register, with the account's running balance after it
+type RegisterRow struct {
+	Transaction Transaction
+	// Amount is the transaction's total change to the account
+	Amount  decimal.Decimal
+	Balance decimal.Decimal
+}
+
+// Register returns the transactions posting to 'account' or its subaccounts between start and end times, in date order with the account's running balance after each one.
+// 'opening' is the account's balance before start. Balances are computed in a single pass over the ledger.
+func (l *Ledger) Register(account string, start, end time.Time) (opening decimal.Decimal, rows []RegisterRow) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	type match struct {
+		txn    *Transaction
+		amount decimal.Decimal
+	}
+	var matches []match
+	for _, txn := range l.transactions {
+		if txn.Date.After(end) {
+			continue
+		}
+		var amount decimal.Decimal
+		posts := false
+		for _, p := range txn.Postings {
+			if HasAccountPrefix(p.Account, account) {
+				amount = amount.Add(p.Amount)
+				posts = true
+			}
+		}
+		switch {
+		case !posts:
+		case txn.Date.Before(start):
+			opening = opening.Add(amount)
+		default:
+			matches = append(matches, match{txn: txn, amount: amount})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].txn.Date.Before(matches[b].txn.Date)
+	})
+
+	rows = make([]RegisterRow, 0, len(matches))
+	balance := opening
+	for _, m := range matches {
+		balance = balance.Add(m.amount)
+		rows = append(rows, RegisterRow{
+			Transaction: m.txn.copy(),
+			Amount:      m.amount,
+			Balance:     balance,
+		})
+	}
+	return opening, rows
+}
@@ -0,0 +1,49 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	makeTxn := func(date, account string, num float64) Transaction {
+		return Transaction{
+			Date:  parseDate(t, date),
+			Payee: "some payee " + date,
+			Postings: []Posting{
+				{Account: account, Amount: *decFloat(-num)},
+				{Account: "expenses:food", Amount: *decFloat(num)},
+			},
+		}
+	}
+	ldg, err := New([]Transaction{
+		makeTxn("2019/06/20", "assets:bank:checking", 4),
+		makeTxn("2019/05/01", "assets:bank:savings", 10),
+		makeTxn("2019/06/01", "assets:bank:checking", 1),
+		makeTxn("2019/07/01", "assets:bank:checking", 8),
+		makeTxn("2019/06/15", "assets:bank:savings", 2),
+		makeTxn("2019/06/16", "assets:banking", 100),
+	})
+	require.NoError(t, err)
+
+	opening, rows := ldg.Register("assets:bank", parseDate(t, "2019/06/01"), parseDate(t, "2019/06/20"))
+	assert.Equal(t, "-10", opening.String())
+	var payees, amounts, balances []string
+	for _, row := range rows {
+		payees = append(payees, row.Transaction.Payee)
+		amounts = append(amounts, row.Amount.String())
+		balances = append(balances, row.Balance.String())
+	}
+	assert.Equal(t, []string{"some payee 2019/06/01", "some payee 2019/06/15", "some payee 2019/06/20"}, payees)
+	assert.Equal(t, []string{"-1", "-2", "-4"}, amounts)
+	assert.Equal(t, []string{"-11", "-13", "-17"}, balances)
+
+	lastBalance := rows[len(rows)-1].Balance
+	assert.Equal(t, ldg.BalancesAsOf(parseDate(t, "2019/06/20"))["assets:bank:checking"].Add(ldg.BalancesAsOf(parseDate(t, "2019/06/20"))["assets:bank:savings"]).String(), lastBalance.String(), "Running balances should match BalancesAsOf")
+
+	opening, rows = ldg.Register("expenses:rent", parseDate(t, "2019/01/01"), parseDate(t, "2020/01/01"))
+	assert.True(t, opening.IsZero())
+	assert.Empty(t, rows)
+}
@@ -0,0 +1,83 @@
+package ledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+const revisionLength = 16
+
+// Revision returns a short hash of the transaction's ledger-encoded form.
+// Any change to the transaction, including changes from syncs or renames, results in a new revision.
+func (t Transaction) Revision() string {
+	return shortHash(t.String())
+}
+
+// Revision returns a short hash of the whole ledger's encoded form, which changes whenever the ledger changes
+func (l *Ledger) Revision() string {
+	return shortHash(l.String())
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:revisionLength]
+}
+
+// RevisionError is returned when an update's expected revision does not match the transaction's current revision
+type RevisionError struct {
+	ID      string
+	Current Transaction
+}
+
+func (r RevisionError) Error() string {
+	return "Transaction was modified by someone else, refresh and try again: " + r.ID
+}
+
+// checkRevision returns a RevisionError if revision is set and doesn't match txn's current revision
+func checkRevision(id, revision string, txn Transaction) error {
+	if revision != "" && revision != txn.Revision() {
+		return RevisionError{ID: id, Current: txn}
+	}
+	return nil
+}
+
+// RevisionErrors combines multiple RevisionError's, i.e. from a batch update
+type RevisionErrors []RevisionError
+
+func (r RevisionErrors) Error() string {
+	ids := make([]string, 0, len(r))
+	for _, err := range r {
+		ids = append(ids, err.ID)
+	}
+	return "Transactions were modified by someone else, refresh and try again: " + strings.Join(ids, ", ")
+}
+
+// CheckRevisions returns RevisionErrors for any transaction IDs whose current revision doesn't match the expected revision
+func (l *Ledger) CheckRevisions(revisions map[string]string) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.checkRevisions(revisions)
+}
+
+// checkRevisions is CheckRevisions without locking. Must be called with the lock held.
+func (l *Ledger) checkRevisions(revisions map[string]string) error {
+	var revisionErrs RevisionErrors
+	for id, revision := range revisions {
+		txn := l.idSet[id]
+		if txn == nil {
+			continue
+		}
+		if err, ok := checkRevision(id, revision, *txn).(RevisionError); ok {
+			revisionErrs = append(revisionErrs, err)
+		}
+	}
+	if len(revisionErrs) == 0 {
+		return nil
+	}
+	sort.Slice(revisionErrs, func(a, b int) bool {
+		return revisionErrs[a].ID < revisionErrs[b].ID
+	})
+	return revisionErrs
+}
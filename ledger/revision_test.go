@@ -0,0 +1,110 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func revisionTxn(id, account string) Transaction {
+	return Transaction{
+		Payee: "some payee",
+		Postings: []Posting{
+			{Account: "assets:Super Bank:****1234", Amount: *decFloat(10), Tags: makeIDTag(id)},
+			{Account: account, Amount: *decFloat(-10)},
+		},
+	}
+}
+
+func TestRevision(t *testing.T) {
+	txn := revisionTxn("txn1", "expenses:uncategorized")
+	assert.Len(t, txn.Revision(), revisionLength)
+	assert.Equal(t, txn.Revision(), revisionTxn("txn1", "expenses:uncategorized").Revision(), "Identical txns must have the same revision")
+	assert.NotEqual(t, txn.Revision(), revisionTxn("txn1", "expenses:travel").Revision(), "Changed txns must have a new revision")
+}
+
+func TestUpdateTransactionRevision(t *testing.T) {
+	original := revisionTxn("txn1", "expenses:uncategorized")
+	for _, tc := range []struct {
+		description string
+		revision    string
+		expectErr   bool
+	}{
+		{
+			description: "no revision",
+		},
+		{
+			description: "matching revision",
+			revision:    original.Revision(),
+		},
+		{
+			description: "stale revision",
+			revision:    "some old revision",
+			expectErr:   true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ldg, err := New([]Transaction{original})
+			require.NoError(t, err)
+			err = ldg.UpdateTransactionRevision("txn1", tc.revision, revisionTxn("txn1", "expenses:travel"))
+			if tc.expectErr {
+				require.IsType(t, RevisionError{}, err)
+				revisionErr := err.(RevisionError)
+				assert.Equal(t, "txn1", revisionErr.ID)
+				assert.Equal(t, original.String(), revisionErr.Current.String())
+				assert.Equal(t, "expenses:uncategorized", ldg.idSet["txn1"].Postings[1].Account, "Stale updates must not be applied")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "expenses:travel", ldg.idSet["txn1"].Postings[1].Account)
+		})
+	}
+}
+
+func TestCheckRevisions(t *testing.T) {
+	txn1, txn2 := revisionTxn("txn1", "expenses:uncategorized"), revisionTxn("txn2", "expenses:uncategorized")
+	ldg, err := New([]Transaction{txn1, txn2})
+	require.NoError(t, err)
+
+	assert.NoError(t, ldg.CheckRevisions(nil))
+	assert.NoError(t, ldg.CheckRevisions(map[string]string{
+		"txn1":    txn1.Revision(),
+		"txn2":    txn2.Revision(),
+		"missing": "some revision",
+	}))
+
+	err = ldg.CheckRevisions(map[string]string{
+		"txn1": txn1.Revision(),
+		"txn2": "some old revision",
+	})
+	require.IsType(t, RevisionErrors{}, err)
+	revisionErrs := err.(RevisionErrors)
+	require.Len(t, revisionErrs, 1)
+	assert.Equal(t, "txn2", revisionErrs[0].ID)
+	assert.Equal(t, "Transactions were modified by someone else, refresh and try again: txn2", err.Error())
+}
+
+func TestStoreUpdateTransactionsStaleRevision(t *testing.T) {
+	txn1, txn2 := revisionTxn("txn1", "expenses:uncategorized"), revisionTxn("txn2", "expenses:uncategorized")
+	ldg, err := New([]Transaction{txn1, txn2})
+	require.NoError(t, err)
+	ranSync := false
+	store := starterStore(t)
+	store.Ledger = ldg
+	store.syncFile = func() error {
+		ranSync = true
+		return nil
+	}
+
+	err = store.UpdateTransactions(map[string]Transaction{
+		"txn1": revisionTxn("txn1", "expenses:travel"),
+		"txn2": revisionTxn("txn2", "expenses:travel"),
+	}, map[string]string{
+		"txn1": txn1.Revision(),
+		"txn2": "some old revision",
+	})
+	assert.IsType(t, RevisionErrors{}, err)
+	assert.False(t, ranSync)
+	assert.Equal(t, "expenses:uncategorized", ldg.idSet["txn1"].Postings[1].Account, "No txns should be updated if any revision is stale")
+}
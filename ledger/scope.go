@@ -0,0 +1,74 @@
+package ledger
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// RedactedAccount replaces postings which are outside a scoped ledger's allowed accounts and categories
+const RedactedAccount = "redacted"
+
+// Scoped returns a copy of l with only the transactions which post to an allowed asset or liability account.
+// If any other posting in a transaction is to a disallowed account or category, those postings are all replaced by a single RedactedAccount posting balancing the allowed postings.
+// The result never contains the names or amounts of disallowed accounts, so their existence can't be inferred.
+func (l *Ledger) Scoped(allowAccount, allowCategory func(name string) bool) *Ledger {
+	l.mu.RLock()
+	var txns []Transaction
+	for _, txn := range l.transactions {
+		if scoped, ok := scopeTransaction(*txn, allowAccount, allowCategory); ok {
+			txns = append(txns, scoped)
+		}
+	}
+	dialect, declarations := l.dialect, l.declarations
+	l.mu.RUnlock()
+
+	transactionPtrs := makeTransactionPtrs(txns)
+	idSet, _, _ := makeIDSet(transactionPtrs)
+	return &Ledger{
+		transactions: transactionPtrs,
+		idSet:        idSet,
+		dialect:      dialect,
+		declarations: declarations,
+	}
+}
+
+// scopeTransaction returns a copy of txn with its disallowed postings redacted. Returns false if txn has no allowed account postings.
+func scopeTransaction(txn Transaction, allowAccount, allowCategory func(name string) bool) (Transaction, bool) {
+	var allowed []Posting
+	var sum decimal.Decimal
+	redact := false
+	for _, p := range txn.Postings {
+		switch {
+		case isBalanceAccount(p.Account) && allowAccount(p.Account):
+			allowed = append(allowed, p)
+			sum = sum.Add(p.Amount)
+		case isBalanceAccount(p.Account) || !allowCategory(p.Account):
+			redact = true
+		}
+	}
+	if len(allowed) == 0 {
+		return Transaction{}, false
+	}
+	txn = txn.copy()
+	if !redact {
+		return txn, true
+	}
+	postings := make([]Posting, 0, len(allowed)+1)
+	for _, p := range txn.Postings {
+		if isBalanceAccount(p.Account) && allowAccount(p.Account) {
+			postings = append(postings, p)
+		}
+	}
+	txn.Postings = append(postings, Posting{
+		Account:  RedactedAccount,
+		Amount:   sum.Neg(),
+		Currency: allowed[0].Currency,
+	})
+	return txn, true
+}
+
+// HasAccountPrefix returns true if 'account' is 'prefix' or one of its subaccounts
+func HasAccountPrefix(account, prefix string) bool {
+	return account == prefix || strings.HasPrefix(account, prefix+":")
+}
@@ -0,0 +1,60 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoped(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(`
+2020/01/01 opening balances
+    assets:Bank:1   $100.00
+    assets:Bank:2   $200.00
+    equity:Opening Balances
+
+2020/01/02 groceries
+    assets:Bank:1   $-10.00 ; id: 1
+    expenses:food:groceries
+
+2020/01/03 movie
+    assets:Bank:1   $-20.00 ; id: 2
+    expenses:entertainment
+
+2020/01/04 other account
+    assets:Bank:2   $-30.00 ; id: 3
+    expenses:food
+`))
+	require.NoError(t, err)
+	before := ldg.String()
+
+	scoped := ldg.Scoped(
+		func(account string) bool { return HasAccountPrefix(account, "assets:Bank:1") },
+		func(category string) bool { return HasAccountPrefix(category, "expenses:food") },
+	)
+	assert.Equal(t, strings.TrimSpace(`
+2020/01/01 opening balances
+    assets:Bank:1   $ 100
+    redacted       $ -100
+
+2020/01/02 groceries
+    assets:Bank:1            $ -10 ; id: 1
+    expenses:food:groceries   $ 10
+
+2020/01/03 movie
+    assets:Bank:1  $ -20 ; id: 2
+    redacted        $ 20
+`), strings.TrimSpace(scoped.String()))
+	assert.Equal(t, before, ldg.String(), "Scoping should not change the original ledger")
+
+	_, found := scoped.Transaction("3")
+	assert.False(t, found, "Transactions without allowed accounts should be removed")
+}
+
+func TestHasAccountPrefix(t *testing.T) {
+	assert.True(t, HasAccountPrefix("expenses:food", "expenses:food"))
+	assert.True(t, HasAccountPrefix("expenses:food:groceries", "expenses:food"))
+	assert.False(t, HasAccountPrefix("expenses:foodstuffs", "expenses:food"))
+}
@@ -0,0 +1,44 @@
+package ledger
+
+import "github.com/pkg/errors"
+
+// Rejection is a transaction which can never be added to a ledger, and the reason why
+type Rejection struct {
+	Transaction Transaction
+	Reason      string
+}
+
+// ScreenTransactions separates transactions which would fail ledger validation from 'txns', so the rest can still be added. Balance assertions are always kept.
+func ScreenTransactions(txns []Transaction) (valid []Transaction, rejected []Rejection) {
+	valid = make([]Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if err := ScreenTransaction(txn); err != nil {
+			rejected = append(rejected, Rejection{Transaction: txn, Reason: err.Error()})
+			continue
+		}
+		valid = append(valid, txn)
+	}
+	return valid, rejected
+}
+
+// ScreenTransaction returns an error if txn could never be added to a ledger, i.e. it's unbalanced or missing a date, ID, or account
+func ScreenTransaction(txn Transaction) error {
+	if IsBalanceAssertion(txn) {
+		return nil
+	}
+	if err := txn.Validate(); err != nil {
+		return err
+	}
+	if txn.Date.IsZero() {
+		return errors.New("Transaction is missing a date")
+	}
+	if txn.Postings[0].ID() == "" {
+		return errors.New("Transaction is missing an ID")
+	}
+	for _, p := range txn.Postings {
+		if NormalizeAccountName(p.Account) == "" {
+			return errors.New("Transaction has a posting without an account")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScreenTransactions(t *testing.T) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	valid := Transaction{
+		Date: date,
+		Postings: []Posting{
+			{Account: "assets:bank", Amount: *decFloat(-1), Tags: makeIDTag("valid")},
+			{Account: "expenses:food", Amount: *decFloat(1)},
+		},
+	}
+	assertion := NewBalanceAssertion("assets:bank", date, *decFloat(10), "$")
+	unbalanced := valid.copy()
+	unbalanced.Postings[1].Amount = *decFloat(2)
+	noDate := valid.copy()
+	noDate.Date = time.Time{}
+	noID := valid.copy()
+	noID.Postings[0].Tags = nil
+	noAccount := valid.copy()
+	noAccount.Postings[1].Account = " "
+
+	kept, rejected := ScreenTransactions([]Transaction{valid, unbalanced, noDate, assertion, noID, noAccount})
+	assert.Equal(t, []Transaction{valid, assertion}, kept)
+	reasons := make([]string, 0, len(rejected))
+	for _, rejection := range rejected {
+		reasons = append(reasons, rejection.Reason)
+	}
+	assert.Len(t, reasons, 4)
+	assert.Contains(t, reasons[0], "Transaction is not balanced")
+	assert.Equal(t, []string{
+		"Transaction is missing a date",
+		"Transaction is missing an ID",
+		"Transaction has a posting without an account",
+	}, reasons[1:])
+}
@@ -0,0 +1,227 @@
+package ledger
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// ReimbursableAccount is the account prefix used to track money owed back by counterparties
+	ReimbursableAccount = "assets:Reimbursable"
+	sharedTag           = "shared"
+)
+
+// Share describes a counterparty's portion of a shared expense. Exactly one of Percent or Amount must be set.
+type Share struct {
+	Name    string
+	Percent *decimal.Decimal `json:",omitempty"`
+	Amount  *decimal.Decimal `json:",omitempty"`
+}
+
+// Settlement is a suggested transaction which pays back a counterparty's outstanding reimbursable balance
+type Settlement struct {
+	ID     string
+	Name   string
+	Amount decimal.Decimal
+}
+
+var hundred = decimal.NewFromFloat(100)
+
+// ReimbursableAccountName returns the reimbursable account name for the given counterparty
+func ReimbursableAccountName(name string) string {
+	return ReimbursableAccount + ":" + name
+}
+
+// MarkShared splits the transaction's category posting into a reimbursable posting for each share.
+// Any existing shares are replaced. An empty list of shares restores the original, unshared transaction.
+func (l *Ledger) MarkShared(id string, shares []Share) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	existingTxn := l.idSet[id]
+	if existingTxn == nil {
+		return errors.New("Transaction not found by ID: " + id)
+	}
+	txn, err := markShared(*existingTxn, shares)
+	if err != nil {
+		return err
+	}
+	*existingTxn = txn
+	return nil
+}
+
+func markShared(txn Transaction, shares []Share) (Transaction, error) {
+	txn = unshare(txn)
+	if len(shares) == 0 {
+		return txn, nil
+	}
+	if len(txn.Postings) < 2 {
+		return txn, errors.New("Transactions must have a minimum of 2 postings")
+	}
+	category := txn.Postings[len(txn.Postings)-1]
+	if category.Amount.IsZero() {
+		return txn, errors.New("Transaction category amount must not be zero")
+	}
+
+	total := category.Amount.Abs()
+	var sharedTotal decimal.Decimal
+	sharedPostings := make([]Posting, 0, len(shares))
+	for _, share := range shares {
+		if strings.TrimSpace(share.Name) == "" || strings.ContainsAny(share.Name, ":;") {
+			return txn, errors.Errorf("Invalid reimbursable name: %q", share.Name)
+		}
+		var amount decimal.Decimal
+		switch {
+		case share.Percent != nil && share.Amount != nil:
+			return txn, errors.Errorf("Share for %s must not set both Percent and Amount", share.Name)
+		case share.Percent != nil:
+			amount = total.Mul(*share.Percent).Div(hundred).Round(2)
+		case share.Amount != nil:
+			amount = share.Amount.Abs()
+		default:
+			return txn, errors.Errorf("Share for %s must set one of Percent or Amount", share.Name)
+		}
+		if !amount.IsPositive() {
+			return txn, errors.Errorf("Share for %s must be greater than zero", share.Name)
+		}
+		sharedTotal = sharedTotal.Add(amount)
+		if category.Amount.IsNegative() {
+			amount = amount.Neg()
+		}
+		sharedPostings = append(sharedPostings, Posting{
+			Account:  ReimbursableAccountName(share.Name),
+			Amount:   amount,
+			Currency: category.Currency,
+			Tags:     map[string]string{sharedTag: share.Name},
+		})
+	}
+	if sharedTotal.GreaterThan(total) {
+		return txn, errors.Errorf("Shares must not exceed the transaction's total: %s > %s", sharedTotal, total)
+	}
+
+	// copy postings to avoid modifying the original txn
+	// the category posting is always kept, even if fully shared, so unsharing can restore it
+	postings := make([]Posting, 0, len(txn.Postings)+len(sharedPostings))
+	postings = append(postings, txn.Postings[:len(txn.Postings)-1]...)
+	postings = append(postings, sharedPostings...)
+	remaining := total.Sub(sharedTotal)
+	if category.Amount.IsNegative() {
+		remaining = remaining.Neg()
+	}
+	category.Amount = remaining
+	postings = append(postings, category)
+	txn.Postings = postings
+	return txn, txn.Validate()
+}
+
+// unshare returns txn with all shared postings merged back into the category posting
+func unshare(txn Transaction) Transaction {
+	var sharedTotal decimal.Decimal
+	isShared := false
+	postings := make([]Posting, 0, len(txn.Postings))
+	for _, p := range txn.Postings {
+		if _, ok := p.Tags[sharedTag]; ok {
+			sharedTotal = sharedTotal.Add(p.Amount)
+			isShared = true
+			continue
+		}
+		postings = append(postings, p)
+	}
+	if !isShared || len(postings) == 0 {
+		return txn
+	}
+	postings[len(postings)-1].Amount = postings[len(postings)-1].Amount.Add(sharedTotal)
+	txn.Postings = postings
+	return txn
+}
+
+// Reimbursables returns the outstanding balance owed by each counterparty
+func (l *Ledger) Reimbursables() map[string]decimal.Decimal {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.reimbursables()
+}
+
+func (l *Ledger) reimbursables() map[string]decimal.Decimal {
+	balances := make(map[string]decimal.Decimal)
+	prefix := ReimbursableAccount + ":"
+	for _, txn := range l.transactions {
+		for _, p := range txn.Postings {
+			if strings.HasPrefix(p.Account, prefix) {
+				name := strings.TrimPrefix(p.Account, prefix)
+				balances[name] = balances[name].Add(p.Amount)
+			}
+		}
+	}
+	for name, balance := range balances {
+		if balance.IsZero() {
+			delete(balances, name)
+		}
+	}
+	return balances
+}
+
+// Settlements returns suggested deposits which could settle outstanding reimbursables.
+// A deposit matches if its amount is no more than the outstanding balance and its payee or comment contains the counterparty's name.
+func (l *Ledger) Settlements() []Settlement {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var settlements []Settlement
+	for name, balance := range l.reimbursables() {
+		if !balance.IsPositive() {
+			continue
+		}
+		lowerName := strings.ToLower(name)
+		for _, txn := range l.transactions {
+			if len(txn.Postings) != 2 || strings.HasPrefix(txn.Postings[1].Account, ReimbursableAccount+":") {
+				continue
+			}
+			amount := txn.Postings[0].Amount
+			if !amount.IsPositive() || amount.GreaterThan(balance) {
+				continue
+			}
+			if strings.Contains(strings.ToLower(txn.Payee), lowerName) || strings.Contains(strings.ToLower(txn.Comment), lowerName) {
+				settlements = append(settlements, Settlement{
+					ID:     txn.Postings[0].ID(),
+					Name:   name,
+					Amount: amount,
+				})
+			}
+		}
+	}
+	sort.Slice(settlements, func(a, b int) bool {
+		if settlements[a].Name != settlements[b].Name {
+			return settlements[a].Name < settlements[b].Name
+		}
+		return settlements[a].ID < settlements[b].ID
+	})
+	return settlements
+}
+
+// SettleReimbursable recategorizes a deposit to pay back the counterparty's reimbursable account
+// Returns a validation error if the deposit isn't positive or is larger than the counterparty's outstanding balance.
+func (l *Ledger) SettleReimbursable(id, name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	txn := l.idSet[id]
+	if txn == nil {
+		return errors.New("Transaction not found by ID: " + id)
+	}
+	if strings.TrimSpace(name) == "" || strings.ContainsAny(name, ":;") {
+		return errors.Errorf("Invalid reimbursable name: %q", name)
+	}
+	if len(txn.Postings) != 2 {
+		return errors.New("Only transactions with exactly 2 postings can settle a reimbursable")
+	}
+	deposit := txn.Postings[0].Amount
+	if !deposit.IsPositive() {
+		return NewValidateError(0, errors.Errorf("Settlement must be a positive deposit: %s", deposit))
+	}
+	if outstanding := l.reimbursables()[name]; deposit.GreaterThan(outstanding) {
+		return NewValidateError(0, errors.Errorf("Settlement of %s must not be larger than %s's outstanding balance: %s", deposit, name, outstanding))
+	}
+	txn.Postings[1].Account = ReimbursableAccountName(name)
+	return nil
+}
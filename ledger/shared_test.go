@@ -0,0 +1,150 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sharedTxn() Transaction {
+	return Transaction{
+		Payee: "Restaurant",
+		Postings: []Posting{
+			{Account: "assets:Super Bank:****1234", Amount: *decFloat(-30), Currency: usd, Tags: makeIDTag("txn1")},
+			{Account: "expenses:food", Amount: *decFloat(30), Currency: usd},
+		},
+	}
+}
+
+func TestMarkShared(t *testing.T) {
+	for _, tc := range []struct {
+		description      string
+		shares           []Share
+		expectErr        bool
+		expectedPostings []Posting
+	}{
+		{
+			description: "unshared",
+			expectedPostings: []Posting{
+				{Account: "assets:Super Bank:****1234", Amount: *decFloat(-30), Currency: usd, Tags: makeIDTag("txn1")},
+				{Account: "expenses:food", Amount: *decFloat(30), Currency: usd},
+			},
+		},
+		{
+			description: "percent and amount",
+			shares: []Share{
+				{Name: "Alice", Percent: decFloat(33.333)},
+				{Name: "Bob", Amount: decFloat(5)},
+			},
+			expectedPostings: []Posting{
+				{Account: "assets:Super Bank:****1234", Amount: *decFloat(-30), Currency: usd, Tags: makeIDTag("txn1")},
+				{Account: "assets:Reimbursable:Alice", Amount: *decFloat(10), Currency: usd, Tags: map[string]string{sharedTag: "Alice"}},
+				{Account: "assets:Reimbursable:Bob", Amount: *decFloat(5), Currency: usd, Tags: map[string]string{sharedTag: "Bob"}},
+				{Account: "expenses:food", Amount: *decFloat(15), Currency: usd},
+			},
+		},
+		{
+			description: "shares exceed total",
+			shares: []Share{
+				{Name: "Alice", Percent: decFloat(80)},
+				{Name: "Bob", Percent: decFloat(80)},
+			},
+			expectErr: true,
+		},
+		{
+			description: "missing share amount",
+			shares:      []Share{{Name: "Alice"}},
+			expectErr:   true,
+		},
+		{
+			description: "invalid name",
+			shares:      []Share{{Name: "Alice:Bob", Amount: decFloat(1)}},
+			expectErr:   true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ldg, err := New([]Transaction{sharedTxn()})
+			require.NoError(t, err)
+			err = ldg.MarkShared("txn1", tc.shares)
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Equal(t, sharedTxn().String(), ldg.idSet["txn1"].String(), "Failed shares must not modify the txn")
+				return
+			}
+			require.NoError(t, err)
+			txn := ldg.idSet["txn1"]
+			require.Len(t, txn.Postings, len(tc.expectedPostings))
+			for i := range tc.expectedPostings {
+				assert.Equal(t, tc.expectedPostings[i].String(), txn.Postings[i].String())
+			}
+			assert.True(t, txn.Balanced())
+		})
+	}
+}
+
+func TestUnshare(t *testing.T) {
+	ldg, err := New([]Transaction{sharedTxn()})
+	require.NoError(t, err)
+	require.NoError(t, ldg.MarkShared("txn1", []Share{{Name: "Alice", Percent: decFloat(100)}}))
+	assert.Equal(t, map[string]string{"Alice": "30"}, stringBalances(ldg.Reimbursables()))
+
+	require.NoError(t, ldg.MarkShared("txn1", nil))
+	assert.Equal(t, sharedTxn().String(), ldg.idSet["txn1"].String())
+	assert.Empty(t, ldg.Reimbursables())
+}
+
+func TestSettleReimbursable(t *testing.T) {
+	deposit := Transaction{
+		Payee: "Venmo from Alice",
+		Postings: []Posting{
+			{Account: "assets:Super Bank:****1234", Amount: *decFloat(15), Currency: usd, Tags: makeIDTag("txn2")},
+			{Account: "uncategorized", Amount: *decFloat(-15), Currency: usd},
+		},
+	}
+	withdrawal := Transaction{
+		Payee: "Venmo to Alice",
+		Postings: []Posting{
+			{Account: "assets:Super Bank:****1234", Amount: *decFloat(-5), Currency: usd, Tags: makeIDTag("txn4")},
+			{Account: "uncategorized", Amount: *decFloat(5), Currency: usd},
+		},
+	}
+	unrelated := Transaction{
+		Payee: "Paycheck",
+		Postings: []Posting{
+			{Account: "assets:Super Bank:****1234", Amount: *decFloat(15), Currency: usd, Tags: makeIDTag("txn3")},
+			{Account: "revenues:work", Amount: *decFloat(-15), Currency: usd},
+		},
+	}
+	ldg, err := New([]Transaction{sharedTxn(), deposit, unrelated, withdrawal})
+	require.NoError(t, err)
+	require.NoError(t, ldg.MarkShared("txn1", []Share{{Name: "Alice", Percent: decFloat(50)}}))
+
+	err = ldg.SettleReimbursable("txn4", "Alice")
+	assert.EqualError(t, err, "Failed to validate ledger at transaction index #0: Settlement must be a positive deposit: -5")
+	assert.IsType(t, Error{}, err)
+	err = ldg.SettleReimbursable("txn3", "Bob")
+	assert.EqualError(t, err, "Failed to validate ledger at transaction index #0: Settlement of 15 must not be larger than Bob's outstanding balance: 0")
+	assert.Equal(t, "revenues:work", ldg.idSet["txn3"].Postings[1].Account)
+
+	assert.Equal(t, []Settlement{
+		{ID: "txn2", Name: "Alice", Amount: *decFloat(15)},
+	}, ldg.Settlements())
+
+	require.NoError(t, ldg.SettleReimbursable("txn2", "Alice"))
+	assert.Equal(t, "assets:Reimbursable:Alice", ldg.idSet["txn2"].Postings[1].Account)
+	assert.Empty(t, ldg.Reimbursables())
+	assert.Empty(t, ldg.Settlements())
+
+	assert.Error(t, ldg.SettleReimbursable("txn100", "Alice"))
+	assert.Error(t, ldg.SettleReimbursable("txn3", ""))
+}
+
+func stringBalances(balances map[string]decimal.Decimal) map[string]string {
+	result := make(map[string]string, len(balances))
+	for name, balance := range balances {
+		result[name] = balance.String()
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package ledger
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// SimulatedTag marks a hypothetical transaction added by Simulated. Simulated transactions are never written to the ledger.
+	SimulatedTag = "simulated"
+	// ForecastSimulated marks a projected entry from a simulated transaction
+	ForecastSimulated = "simulated"
+
+	maxSimulatedOccurrences = 1000
+)
+
+// HypotheticalExpense is a recurring expense which isn't in the ledger, used to simulate its impact on budgets and forecasts
+type HypotheticalExpense struct {
+	Payee string
+	// Account is the asset or liability account paying the expense
+	Account string
+	// Category is the expense account charged
+	Category  string
+	Amount    decimal.Decimal
+	Frequency string
+	Start     time.Time
+}
+
+// Validate returns an error if the expense can't be simulated
+func (e HypotheticalExpense) Validate() error {
+	switch {
+	case strings.TrimSpace(e.Payee) == "":
+		return errors.New("Payee must not be empty")
+	case !isBalanceAccount(e.Account):
+		return errors.Errorf("Account must be an asset or liability account: %q", e.Account)
+	case strings.TrimSpace(e.Category) == "" || isBalanceAccount(e.Category):
+		return errors.Errorf("Category must be an expense or revenue account: %q", e.Category)
+	case !e.Amount.IsPositive():
+		return errors.Errorf("Amount must be positive: %s", e.Amount)
+	case e.Start.IsZero():
+		return errors.New("Start date must be set")
+	}
+	if _, ok := findCadence(e.Frequency); !ok {
+		return errors.Errorf("Frequency must be %q or %q: %q", Weekly, Monthly, e.Frequency)
+	}
+	return nil
+}
+
+// Transactions returns each occurrence of the expense before 'end', starting on its start date. Each is tagged with SimulatedTag.
+func (e HypotheticalExpense) Transactions(end time.Time) []Transaction {
+	c, ok := findCadence(e.Frequency)
+	if !ok {
+		return nil
+	}
+	var txns []Transaction
+	start := startOfDay(e.Start)
+	for date := start; date.Before(end) && len(txns) < maxSimulatedOccurrences; date = c.add(start, len(txns)) {
+		txns = append(txns, Transaction{
+			Date:  date,
+			Payee: e.Payee,
+			Postings: []Posting{
+				{Account: e.Account, Amount: e.Amount.Neg(), Currency: usd},
+				{Account: e.Category, Amount: e.Amount, Currency: usd},
+			},
+			Tags: map[string]string{SimulatedTag: "true"},
+		})
+	}
+	return txns
+}
+
+// Simulated returns a copy of the ledger for what-if reports, with 'txns' added and tagged with SimulatedTag.
+// The ledger itself is unchanged.
+func (l *Ledger) Simulated(txns []Transaction) *Ledger {
+	l.mu.RLock()
+	all := make([]Transaction, 0, len(l.transactions)+len(txns))
+	for _, txn := range l.transactions {
+		all = append(all, txn.copy())
+	}
+	dialect, declarations := l.dialect, l.declarations
+	l.mu.RUnlock()
+
+	for _, txn := range txns {
+		txn = txn.copy()
+		if txn.Tags == nil {
+			txn.Tags = make(map[string]string, 1)
+		}
+		txn.Tags[SimulatedTag] = "true"
+		all = append(all, txn)
+	}
+	transactionPtrs := makeTransactionPtrs(all)
+	Transactions(transactionPtrs).Sort()
+	idSet, _, _ := makeIDSet(transactionPtrs)
+	return &Ledger{
+		transactions: transactionPtrs,
+		idSet:        idSet,
+		dialect:      dialect,
+		declarations: declarations,
+	}
+}
+
+// IsSimulated returns true if txn was added by Simulated
+func IsSimulated(txn Transaction) bool {
+	_, simulated := txn.Tags[SimulatedTag]
+	return simulated
+}
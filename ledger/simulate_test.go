@@ -0,0 +1,78 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHypotheticalExpenseValidate(t *testing.T) {
+	valid := HypotheticalExpense{
+		Payee:     "Gym",
+		Account:   "assets:Super Bank:****1234",
+		Category:  "expenses:fitness",
+		Amount:    *decFloat(40),
+		Frequency: Monthly,
+		Start:     parseDate(t, "2020/04/10"),
+	}
+	assert.NoError(t, valid.Validate())
+
+	invalid := valid
+	invalid.Frequency = "yearly"
+	assert.EqualError(t, invalid.Validate(), `Frequency must be "weekly" or "monthly": "yearly"`)
+	invalid = valid
+	invalid.Amount = *decFloat(-40)
+	assert.Error(t, invalid.Validate())
+	invalid = valid
+	invalid.Category = "assets:other"
+	assert.Error(t, invalid.Validate())
+}
+
+func TestSimulated(t *testing.T) {
+	const account = "assets:Super Bank:****1234"
+	txns := recurringTxns(t, "Streaming", []string{"2020/01/15", "2020/02/15", "2020/03/15"}, []float64{10, 10, 10})
+	ldg, err := New(txns)
+	require.NoError(t, err)
+
+	gym := HypotheticalExpense{
+		Payee:     "Gym",
+		Account:   account,
+		Category:  "expenses:fitness",
+		Amount:    *decFloat(40),
+		Frequency: Weekly,
+		Start:     parseDate(t, "2020/04/03"),
+	}
+	simulatedTxns := gym.Transactions(parseDate(t, "2020/05/01"))
+	require.Len(t, simulatedTxns, 4)
+	assert.Equal(t, parseDate(t, "2020/04/24"), simulatedTxns[3].Date)
+
+	simulated := ldg.Simulated(simulatedTxns)
+	assert.Equal(t, 3, ldg.Size(), "The original ledger must not change")
+	assert.Equal(t, 7, simulated.Size())
+	assert.Len(t, simulated.Recurring(), 1, "Simulated transactions must not be detected as recurring series")
+
+	start := parseDate(t, "2020/04/01")
+	forecast := simulated.Forecast(start, 30, nil)
+	require.Len(t, forecast[2].Entries, 1)
+	assert.Equal(t, ForecastSimulated, forecast[2].Entries[0].Source)
+	assert.Equal(t, "-200", forecast[29].Balances[account].String())
+	assert.Equal(t, "-40", ldg.Forecast(start, 30, nil)[29].Balances[account].String())
+}
+
+func TestHypotheticalExpenseTransactionsMonthEnd(t *testing.T) {
+	rent := HypotheticalExpense{
+		Payee:     "Landlord",
+		Account:   "assets:Super Bank:****1234",
+		Category:  "expenses:rent",
+		Amount:    *decFloat(1000),
+		Frequency: Monthly,
+		Start:     parseDate(t, "2020/01/31"),
+	}
+	txns := rent.Transactions(parseDate(t, "2020/05/01"))
+	var dates []string
+	for _, txn := range txns {
+		dates = append(dates, txn.Date.Format("2006/01/02"))
+	}
+	assert.Equal(t, []string{"2020/01/31", "2020/02/29", "2020/03/31", "2020/04/30"}, dates, "Monthly occurrences should clamp to shorter months without drifting")
+}
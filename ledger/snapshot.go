@@ -0,0 +1,124 @@
+package ledger
+
+import (
+	"bytes"
+	"container/list"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/vcs"
+	"github.com/pkg/errors"
+)
+
+const snapshotCacheSize = 4
+
+var (
+	// ErrSnapshotNotFound is returned when the ledger file has no snapshot with the requested ID
+	ErrSnapshotNotFound = errors.New("Snapshot not found")
+
+	errSnapshotsUnsupported = errors.New("Ledger file does not support snapshots")
+)
+
+// Snapshot is a ledger loaded from a past version of the ledger file.
+// Snapshots are shared between callers and are never saved, so they must not be modified.
+type Snapshot struct {
+	*Ledger
+	ID   string
+	Time time.Time
+}
+
+// snapshotCache holds recently used snapshots, evicting the least recently used when full
+type snapshotCache struct {
+	mu      sync.Mutex
+	size    int
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+func newSnapshotCache(size int) *snapshotCache {
+	return &snapshotCache{
+		size:    size,
+		entries: list.New(),
+		index:   make(map[string]*list.Element),
+	}
+}
+
+func (c *snapshotCache) get(id string) (*Snapshot, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.index[id]
+	if !ok {
+		return nil, false
+	}
+	c.entries.MoveToFront(elem)
+	return elem.Value.(*Snapshot), true
+}
+
+func (c *snapshotCache) add(snapshot *Snapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.index[snapshot.ID]; ok {
+		c.entries.MoveToFront(elem)
+		return
+	}
+	c.index[snapshot.ID] = c.entries.PushFront(snapshot)
+	for c.entries.Len() > c.size {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.index, oldest.Value.(*Snapshot).ID)
+	}
+}
+
+// Snapshots returns the available ledger snapshots, newest first
+func (s *Store) Snapshots() ([]vcs.Version, error) {
+	file, ok := s.file.(vcs.VersionedFile)
+	if !ok {
+		return nil, errSnapshotsUnsupported
+	}
+	return file.Versions()
+}
+
+// Snapshot loads the ledger as it was in snapshot 'id'. Returns ErrSnapshotNotFound if it does not exist.
+// Loading a snapshot does not lock or otherwise affect the live ledger.
+func (s *Store) Snapshot(id string) (*Snapshot, error) {
+	if snapshot, ok := s.snapshots.get(id); ok {
+		return snapshot, nil
+	}
+	file, ok := s.file.(vcs.VersionedFile)
+	if !ok {
+		return nil, errSnapshotsUnsupported
+	}
+	versions, err := file.Versions()
+	if err != nil {
+		return nil, err
+	}
+	var version *vcs.Version
+	for i := range versions {
+		if versions[i].ID == id {
+			version = &versions[i]
+			break
+		}
+	}
+	if version == nil {
+		return nil, ErrSnapshotNotFound
+	}
+	contents, err := file.ReadVersion(id)
+	if err == vcs.ErrVersionNotFound {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	ldg, err := NewFromReader(ioutil.NopCloser(bytes.NewReader(contents)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse snapshot %q", id)
+	}
+	snapshot := &Snapshot{
+		Ledger: ldg,
+		ID:     version.ID,
+		Time:   version.Time,
+	}
+	s.snapshots.add(snapshot)
+	return snapshot, nil
+}
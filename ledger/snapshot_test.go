@@ -0,0 +1,81 @@
+package ledger
+
+import (
+	"os"
+	"testing"
+
+	"github.com/johnstarich/sage/vcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	snapshotLedger1 = `
+2019/01/01 first
+    assets:Bank   $1.00
+    expenses:food   $-1.00
+`
+	snapshotLedger2 = snapshotLedger1 + `
+2019/01/02 second
+    assets:Bank   $2.00
+    expenses:food   $-2.00
+`
+)
+
+func TestStoreSnapshot(t *testing.T) {
+	require.NoError(t, os.Mkdir("snapshotrepo", 0700))
+	defer func() { require.NoError(t, os.RemoveAll("snapshotrepo")) }()
+	repo, err := vcs.Open("snapshotrepo", nil)
+	require.NoError(t, err)
+	file := repo.File("snapshotrepo/ledger.journal")
+	require.NoError(t, file.Write([]byte(snapshotLedger1)))
+	require.NoError(t, file.Write([]byte(snapshotLedger2)))
+
+	store, err := NewStore(file, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	require.Equal(t, 2, store.Size())
+
+	versions, err := store.Snapshots()
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+
+	snapshot, err := store.Snapshot(versions[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, versions[1].ID, snapshot.ID)
+	assert.Equal(t, versions[1].Time, snapshot.Time)
+	assert.Equal(t, 1, snapshot.Size())
+	assert.Equal(t, 2, store.Size(), "Live ledger should be unaffected")
+
+	cached, err := store.Snapshot(versions[1].ID)
+	require.NoError(t, err)
+	assert.Same(t, snapshot, cached)
+
+	_, err = store.Snapshot("missing")
+	assert.Equal(t, ErrSnapshotNotFound, err)
+}
+
+func TestStoreSnapshotUnsupported(t *testing.T) {
+	store, err := NewStore(&mockFile{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	_, err = store.Snapshots()
+	assert.Equal(t, errSnapshotsUnsupported, err)
+	_, err = store.Snapshot("some ID")
+	assert.Equal(t, errSnapshotsUnsupported, err)
+}
+
+func TestSnapshotCacheEviction(t *testing.T) {
+	cache := newSnapshotCache(2)
+	cache.add(&Snapshot{ID: "1"})
+	cache.add(&Snapshot{ID: "2"})
+	_, found := cache.get("1")
+	assert.True(t, found)
+
+	cache.add(&Snapshot{ID: "3"})
+	_, found = cache.get("2")
+	assert.False(t, found, "Least recently used snapshot should be evicted")
+	_, found = cache.get("1")
+	assert.True(t, found)
+	_, found = cache.get("3")
+	assert.True(t, found)
+}
@@ -0,0 +1,35 @@
+package ledger
+
+const (
+	// SplitTemplateTag is the name of the split template which split a transaction's categories
+	SplitTemplateTag = "split_template"
+	// ManualSplitTag marks a templated transaction the user re-categorized, so split templates no longer apply to it
+	ManualSplitTag = "manual_split"
+)
+
+// markManualSplit replaces updated's split template tag with ManualSplitTag if the user changed the categories of a templated transaction
+func markManualSplit(original Transaction, updated *Transaction) {
+	if original.Tags[SplitTemplateTag] == "" || sameCategories(original, *updated) {
+		return
+	}
+	tags := copyTags(updated.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	delete(tags, SplitTemplateTag)
+	tags[ManualSplitTag] = "true"
+	updated.Tags = tags
+}
+
+// sameCategories returns true if a and b have the same balancing postings' accounts and amounts
+func sameCategories(a, b Transaction) bool {
+	if len(a.Postings) != len(b.Postings) {
+		return false
+	}
+	for i := 1; i < len(a.Postings); i++ {
+		if a.Postings[i].Account != b.Postings[i].Account || !a.Postings[i].Amount.Equal(b.Postings[i].Amount) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateTransactionMarksManualSplit(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(`
+2020/01/01 Costco ; split_template: costco
+    assets:bank   $-10.00 ; id: 1
+    expenses:groceries   $7.00
+    expenses:household   $3.00
+
+2020/01/02 Costco ; split_template: costco
+    assets:bank   $-10.00 ; id: 2
+    expenses:groceries   $7.00
+    expenses:household   $3.00
+`))
+	require.NoError(t, err)
+
+	txn, _ := ldg.Transaction("1")
+	txn.Comment = "Bulk snacks"
+	require.NoError(t, ldg.UpdateTransaction("1", txn))
+	txn, _ = ldg.Transaction("1")
+	assert.Equal(t, "costco", txn.Tags[SplitTemplateTag], "Updates without category changes should keep the template")
+	assert.Empty(t, txn.Tags[ManualSplitTag])
+
+	txn, _ = ldg.Transaction("2")
+	txn.Postings = txn.Postings[:2]
+	txn.Postings[1].Amount = txn.Postings[0].Amount.Neg()
+	require.NoError(t, ldg.UpdateTransaction("2", txn))
+	txn, _ = ldg.Transaction("2")
+	assert.Empty(t, txn.Tags[SplitTemplateTag])
+	assert.Equal(t, "true", txn.Tags[ManualSplitTag])
+}
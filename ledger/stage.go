@@ -0,0 +1,81 @@
+package ledger
+
+import (
+	"github.com/pkg/errors"
+)
+
+// stagedLedger holds the ledger from before staging, and whether it changed since
+type stagedLedger struct {
+	snapshot   *Ledger
+	dirty      bool
+	resumeSync func()
+}
+
+var errAlreadyStaged = errors.New("Ledger is already staged")
+
+// Stage holds ledger file writes in memory until Unstage, and returns a func which restores the ledger from before staging
+// Waits for any running sync to finish and prevents new syncs until Unstage, so downloaded transactions are never rolled back with the staged change.
+func (s *Store) Stage() (func(), error) {
+	s.stageMu.Lock()
+	alreadyStaged := s.staged != nil
+	s.stageMu.Unlock()
+	if alreadyStaged {
+		return nil, errAlreadyStaged
+	}
+	// pause without holding stageMu: a finishing sync's syncFile needs it
+	resumeSync, err := s.PauseSync(stageSyncTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s.stageMu.Lock()
+	defer s.stageMu.Unlock()
+	if s.staged != nil {
+		resumeSync()
+		return nil, errAlreadyStaged
+	}
+	s.staged = &stagedLedger{snapshot: s.Ledger.snapshot(), resumeSync: resumeSync}
+	snapshot := s.staged.snapshot
+	return func() {
+		s.Ledger.Replace(snapshot)
+	}, nil
+}
+
+// Files returns the ledger file's new contents, if it changed while staged
+func (s *Store) Files() (map[string][]byte, error) {
+	s.stageMu.Lock()
+	defer s.stageMu.Unlock()
+	if s.staged == nil || !s.staged.dirty {
+		return nil, nil
+	}
+	return map[string][]byte{
+		s.file.Path(): []byte(s.Ledger.String()),
+	}, nil
+}
+
+// Unstage resumes writing the ledger file and syncing. Changes held while staged are not written.
+func (s *Store) Unstage() {
+	s.stageMu.Lock()
+	staged := s.staged
+	s.staged = nil
+	s.stageMu.Unlock()
+	if staged != nil {
+		staged.resumeSync()
+	}
+}
+
+// stagedSyncFile holds writes in memory while the store is staged, otherwise writes with 'syncFile'
+func (s *Store) stagedSyncFile(syncFile func() error) func() error {
+	return func() error {
+		s.stageMu.Lock()
+		staged := s.staged
+		if staged != nil {
+			staged.dirty = true
+		}
+		s.stageMu.Unlock()
+		if staged != nil {
+			return nil
+		}
+		return syncFile()
+	}
+}
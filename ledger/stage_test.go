@@ -0,0 +1,55 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestStoreStage(t *testing.T) {
+	file := &mockFile{}
+	file.buf.WriteString(`
+2020/01/01 coffee
+    assets:checking   $-1.00 ; id: coffee-1
+    expenses:food
+`)
+	store, err := NewStore(file, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	original := file.buf.String()
+
+	restore, err := store.Stage()
+	require.NoError(t, err)
+	_, err = store.Stage()
+	assert.EqualError(t, err, "Ledger is already staged")
+	assert.False(t, store.startSync(), "Syncs should pause while staged")
+	files, err := store.Files()
+	require.NoError(t, err)
+	assert.Empty(t, files, "Unchanged ledgers should not be written")
+
+	require.NoError(t, store.UpdateAccount("assets:checking", "assets:joint checking"))
+	require.NoError(t, store.AddTransactions([]Transaction{{
+		Date:  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Payee: "tea",
+		Postings: []Posting{
+			{Account: "assets:joint checking", Amount: decimal.NewFromFloat(-2), Currency: "$", Tags: map[string]string{"id": "tea-1"}},
+			{Account: "expenses:food", Amount: decimal.NewFromFloat(2), Currency: "$"},
+		},
+	}}))
+	assert.Equal(t, original, file.buf.String(), "Staged changes should not be written")
+	files, err = store.Files()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"": []byte(store.String())}, files)
+
+	restore()
+	store.Unstage()
+	assert.True(t, store.startSync(), "Syncs should resume after unstaging")
+	_, found := store.Transaction("tea-1")
+	assert.False(t, found)
+	txn, found := store.Transaction("coffee-1")
+	require.True(t, found)
+	assert.Equal(t, "assets:checking", txn.Postings[0].Account)
+}
@@ -0,0 +1,133 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// StatusTag holds a transaction's reconciliation status. Untagged transactions are uncleared.
+	StatusTag = "status"
+	// StatusCleared marks a transaction which appeared on a statement, but isn't reconciled yet
+	StatusCleared = "cleared"
+	// StatusReconciled marks a transaction which is part of a reconciled statement
+	StatusReconciled = "reconciled"
+)
+
+// ValidateStatus returns an error if 'status' is not a valid StatusTag value. An empty status is uncleared.
+func ValidateStatus(status string) error {
+	switch status {
+	case "", StatusCleared, StatusReconciled:
+		return nil
+	default:
+		return errors.Errorf("Invalid transaction status %q, must be %q, %q, or empty", status, StatusCleared, StatusReconciled)
+	}
+}
+
+// Status returns t's reconciliation status, or an empty string if it's uncleared
+func (t Transaction) Status() string {
+	if isOpeningTransaction(t) {
+		// opening balances are the starting point for reconciliation
+		return StatusReconciled
+	}
+	return t.Tags[StatusTag]
+}
+
+// ToggleCleared marks the transaction 'id' cleared if it's uncleared, or uncleared if it's cleared. Returns the new status.
+// Reconciled transactions can't be toggled.
+func (l *Ledger) ToggleCleared(id string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	existingTxn := l.idSet[id]
+	if existingTxn == nil {
+		return "", errors.New("Transaction not found by ID: " + id)
+	}
+	txn := existingTxn.copy()
+	switch txn.Status() {
+	case StatusReconciled:
+		return "", errors.Errorf("Transaction is already reconciled: %s", id)
+	case StatusCleared:
+		delete(txn.Tags, StatusTag)
+	default:
+		setTag(&txn, StatusTag, StatusCleared)
+	}
+	*existingTxn = txn
+	return txn.Status(), nil
+}
+
+// Unreconciled returns the cleared balance of 'account' as of 'date', including reconciled transactions, and copies of the account's unreconciled transactions up to 'date'
+func (l *Ledger) Unreconciled(account string, date time.Time) (cleared decimal.Decimal, txns []Transaction) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	cleared = l.clearedBalance(account, date)
+	for _, txn := range l.transactions {
+		if startOfDay(txn.Date).After(startOfDay(date)) {
+			break
+		}
+		if txn.Status() != StatusReconciled && hasAccountPosting(*txn, account) {
+			txns = append(txns, txn.copy())
+		}
+	}
+	return cleared, txns
+}
+
+// clearedBalance returns the total of 'account' postings in cleared or reconciled transactions up to 'date'. Must be called with the lock held.
+func (l *Ledger) clearedBalance(account string, date time.Time) decimal.Decimal {
+	var balance decimal.Decimal
+	for _, txn := range l.transactions {
+		if startOfDay(txn.Date).After(startOfDay(date)) {
+			break
+		}
+		if txn.Status() == "" {
+			continue
+		}
+		for _, p := range txn.Postings {
+			if p.Account == account {
+				balance = balance.Add(p.Amount)
+			}
+		}
+	}
+	return balance
+}
+
+// Reconcile marks each of account's cleared transactions up to 'date' reconciled, and records 'balance' as the account's balance assertion on 'date'.
+// Returns the number of reconciled transactions. Fails without changes if the cleared balance doesn't match 'balance'.
+func (l *Ledger) Reconcile(account string, date time.Time, balance decimal.Decimal) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cleared := l.clearedBalance(account, date); !cleared.Equal(balance) {
+		return 0, errors.Errorf("Cleared balance %s does not match statement balance %s, off by %s", cleared, balance, balance.Sub(cleared))
+	}
+
+	currency := usd
+	count := 0
+	for _, txn := range l.transactions {
+		if startOfDay(txn.Date).After(startOfDay(date)) {
+			break
+		}
+		for _, p := range txn.Postings {
+			if p.Account == account && p.Currency != "" {
+				currency = p.Currency
+			}
+		}
+		if txn.Tags[StatusTag] == StatusCleared && hasAccountPosting(*txn, account) {
+			reconciled := txn.copy()
+			reconciled.Tags[StatusTag] = StatusReconciled
+			*txn = reconciled
+			count++
+		}
+	}
+	l.setAssertions([]Transaction{NewBalanceAssertion(account, date, balance, currency)})
+	return count, nil
+}
+
+func hasAccountPosting(txn Transaction, account string) bool {
+	for _, p := range txn.Postings {
+		if p.Account == account {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	makeTxn := func(id string, date time.Time, amount float64) Transaction {
+		return Transaction{
+			Date:  date,
+			Payee: "Some Shop",
+			Postings: []Posting{
+				{Account: "assets:Bank", Amount: *decFloat(amount), Currency: usd, Tags: makeIDTag(id)},
+				{Account: "expenses:shopping", Amount: *decFloat(-amount), Currency: usd},
+			},
+		}
+	}
+	l, err := New([]Transaction{
+		{
+			Date:  day(1),
+			Payee: "* Opening Balance",
+			Postings: []Posting{
+				{Account: "assets:Bank", Amount: *decFloat(100), Currency: usd},
+				{Account: "equity:Opening Balances", Amount: *decFloat(-100), Currency: usd, Tags: makeIDTag(OpeningBalanceID)},
+			},
+		},
+		makeTxn("1", day(2), -10),
+		makeTxn("2", day(3), -20),
+		makeTxn("3", day(4), -30),
+		makeTxn("after statement", day(20), -40),
+	})
+	require.NoError(t, err)
+	statementDate, balance := day(10), *decFloat(70)
+
+	cleared, txns := l.Unreconciled("assets:Bank", statementDate)
+	assert.Equal(t, "100", cleared.String(), "Opening balances are always reconciled")
+	require.Len(t, txns, 3)
+
+	for _, id := range []string{"1", "3"} {
+		status, err := l.ToggleCleared(id)
+		require.NoError(t, err)
+		assert.Equal(t, StatusCleared, status)
+	}
+	cleared, _ = l.Unreconciled("assets:Bank", statementDate)
+	assert.Equal(t, "60", cleared.String())
+	_, err = l.Reconcile("assets:Bank", statementDate, balance)
+	assert.EqualError(t, err, "Cleared balance 60 does not match statement balance 70, off by 10")
+
+	status, err := l.ToggleCleared("3")
+	require.NoError(t, err)
+	assert.Equal(t, "", status)
+	_, err = l.ToggleCleared("2")
+	require.NoError(t, err)
+
+	count, err := l.Reconcile("assets:Bank", statementDate, balance)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	for id, expected := range map[string]string{"1": StatusReconciled, "2": StatusReconciled, "3": "", "after statement": ""} {
+		txn, _ := l.Transaction(id)
+		assert.Equal(t, expected, txn.Status(), id)
+	}
+	_, err = l.ToggleCleared("1")
+	assert.Error(t, err, "Reconciled transactions can't be toggled")
+
+	assertions := l.BalanceAssertions()
+	require.Len(t, assertions, 1)
+	assert.Equal(t, statementDate, assertions[0].Date)
+	assert.Equal(t, "70", assertions[0].Postings[0].Balance.String())
+
+	_, txns = l.Unreconciled("assets:Bank", statementDate)
+	require.Len(t, txns, 1)
+	assert.Equal(t, "3", txns[0].Postings[0].ID())
+}
+
+func TestUpdateTransactionStatus(t *testing.T) {
+	l, err := New([]Transaction{{
+		Date:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Payee: "Some Shop",
+		Postings: []Posting{
+			{Account: "assets:Bank", Amount: *decFloat(-1), Tags: makeIDTag("1")},
+			{Account: "expenses:shopping", Amount: *decFloat(1)},
+		},
+	}})
+	require.NoError(t, err)
+	assert.Error(t, l.UpdateTransaction("1", Transaction{Tags: map[string]string{StatusTag: "done"}}))
+	require.NoError(t, l.UpdateTransaction("1", Transaction{Tags: map[string]string{StatusTag: StatusCleared}}))
+	txn, _ := l.Transaction("1")
+	assert.Equal(t, StatusCleared, txn.Status())
+}
@@ -3,6 +3,7 @@ package ledger
 import (
 	"bytes"
 	"io/ioutil"
+	"sync"
 	"time"
 
 	sErrors "github.com/johnstarich/sage/errors"
@@ -10,41 +11,48 @@ import (
 	"github.com/johnstarich/sage/prompter"
 	"github.com/johnstarich/sage/vcs"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
 const (
 	day = 24 * time.Hour
+
+	archiveSyncTimeout = 30 * time.Second
+	stageSyncTimeout   = 30 * time.Second
 )
 
 // Store enables ledger syncing both in memory and on disk
 type Store struct {
 	*Ledger
-	file     vcs.File
-	logger   *zap.Logger
-	prompter prompter.Prompter
+	file        vcs.File
+	archiveFile vcs.File
+	logger      *zap.Logger
+	prompter    prompter.Prompter
 
 	syncPromptRequest *atomic.Value
 	syncing           *atomic.Bool
 	lastSyncErr       *atomic.Error
+	snapshots         *snapshotCache
+
+	stageMu sync.Mutex
+	staged  *stagedLedger // nil unless staged
 
 	syncFile   func() error
 	syncLedger func(start, end time.Time, download downloader, processTxns txnMutator, ldg *Ledger, logger *zap.Logger, prompter prompter.Prompter) error
 }
 
 // NewStore creates a Ledger Store from the given file
+// A missing or empty file starts an empty ledger. A file which fails to parse returns a FileParseError.
 func NewStore(file vcs.File, logger *zap.Logger) (*Store, error) {
-	ledgerBytes, err := file.Read()
-	if err != nil {
-		return nil, errors.Wrap(err, "Error reading ledger file")
-	}
-	r := ioutil.NopCloser(bytes.NewBuffer(ledgerBytes))
-
-	ldg, err := NewFromReader(r)
+	ldg, empty, err := readLedgerFile(file)
 	if err != nil {
 		return nil, err
 	}
+	if empty {
+		logger.Info("Ledger file is missing or empty, starting with an empty ledger", zap.String("path", file.Path()))
+	}
 
 	store := &Store{
 		Ledger:            ldg,
@@ -54,13 +62,63 @@ func NewStore(file vcs.File, logger *zap.Logger) (*Store, error) {
 		syncPromptRequest: &atomic.Value{},
 		syncing:           atomic.NewBool(false),
 		lastSyncErr:       atomic.NewError(nil),
-		syncFile:          syncLedgerFile(ldg, file),
+		snapshots:         newSnapshotCache(snapshotCacheSize),
 		syncLedger:        syncLedger,
 	}
+	store.syncFile = store.stagedSyncFile(syncLedgerFile(ldg, file))
+	if collisions := ldg.AccountCollisions(); len(collisions) > 0 {
+		logger.Warn("Ledger has accounts which only differ by case or whitespace", zap.Any("collisions", collisions))
+	}
+	if report := ldg.CheckIntegrity(); len(report.LegacyIDs) > 0 || len(report.Collisions) > 0 {
+		logger.Warn("Ledger has transaction ID tags which need repair. Review them with the fsck API and confirm healing to rewrite them",
+			zap.Int("legacyIDs", len(report.LegacyIDs)),
+			zap.Int("collisions", len(report.Collisions)),
+		)
+	}
 	go store.listenPromptRequests()
 	return store, nil
 }
 
+// readLedgerFile parses 'file', or returns an empty ledger if the file is missing or empty
+func readLedgerFile(file vcs.File) (ldg *Ledger, empty bool, err error) {
+	ledgerBytes, err := file.Read()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "Error reading ledger file")
+	}
+	if len(bytes.TrimSpace(ledgerBytes)) == 0 {
+		ldg, err := New(nil)
+		return ldg, true, err
+	}
+	r := ioutil.NopCloser(bytes.NewBuffer(ledgerBytes))
+	ldg, err = NewFromReader(r)
+	if err != nil {
+		return nil, false, FileParseError{Path: file.Path(), cause: err}
+	}
+	return ldg, false, nil
+}
+
+// ReadFile reads and validates the ledger file from disk, without modifying the store. Use with Ledger.Replace to reload the store.
+func (s *Store) ReadFile() (*Ledger, error) {
+	ldg, _, err := readLedgerFile(s.file)
+	if err != nil {
+		return nil, err
+	}
+	return ldg, ldg.Validate()
+}
+
+// PauseSync waits up to 'timeout' for a running sync to finish, then prevents new syncs from starting until resume is called
+func (s *Store) PauseSync(timeout time.Duration) (resume func(), err error) {
+	const pollInterval = 100 * time.Millisecond
+	deadline := time.Now().Add(timeout)
+	for !s.startSync() {
+		if time.Now().After(deadline) {
+			return nil, errors.New("Timed out waiting for sync to finish")
+		}
+		time.Sleep(pollInterval)
+	}
+	return func() { s.syncing.Store(false) }, nil
+}
+
 type downloader func(start, end time.Time, prompter prompter.Prompter) ([]Transaction, error)
 
 type txnMutator func(txns []Transaction)
@@ -68,19 +126,30 @@ type txnMutator func(txns []Transaction)
 // StartSync asynchronously downloads and processes new transactions between the start and end dates
 // If a partial failure occurs during the sync, writes to disk anyway
 func (s *Store) StartSync(start, end time.Time, download downloader, processTxns txnMutator) {
+	s.StartSyncThen(start, end, download, processTxns, nil)
+}
+
+// StartSyncThen runs StartSync, then calls 'done' with the sync's result before the sync is marked finished.
+// 'done' is not called if a sync is already running, and may be nil.
+// Returns false if a sync is already running.
+func (s *Store) StartSyncThen(start, end time.Time, download downloader, processTxns txnMutator, done func(err error)) bool {
 	if !s.startSync() {
 		// sync already running
-		return
+		return false
 	}
 	go func() {
 		err := s.sync(start, end, download, processTxns)
+		if done != nil {
+			done(err)
+		}
 		s.stopSync(err)
 	}()
+	return true
 }
 
 func (s *Store) sync(start, end time.Time, download downloader, processTxns txnMutator) error {
 	ledgerErr := s.syncLedger(start, end, download, processTxns, s.Ledger, s.logger, s.prompter)
-	if _, ok := ledgerErr.(Error); ledgerErr != nil && !ok {
+	if ledgerErr != nil && !IsPartial(ledgerErr) {
 		return ledgerErr
 	}
 
@@ -126,6 +195,8 @@ func syncLedger(start, end time.Time, download downloader, processTxns txnMutato
 		logger.Warn("Failed to download some transactions", zap.Error(errs))
 	}
 
+	allTxns, assertions := SplitBalanceAssertions(allTxns)
+
 	// throw out extra transactions that were included by the institution responses
 	filteredTxns := make([]Transaction, 0, len(allTxns))
 	for _, t := range allTxns {
@@ -138,7 +209,7 @@ func syncLedger(start, end time.Time, download downloader, processTxns txnMutato
 
 	processTxns(allTxns)
 
-	if err := ldg.AddTransactions(allTxns); err != nil {
+	if err := ldg.AddTransactions(append(allTxns, assertions...)); err != nil {
 		logger.Warn("Failed to add transactions to ledger", zap.Error(err))
 		return err
 	}
@@ -195,14 +266,30 @@ func (s *Store) SubmitSyncPrompt(response prompter.Response) {
 
 // SyncRecent runs Sync for any new transactions since the last sync. Currently assumes last the last txn's date should be the start date.
 func (s *Store) SyncRecent(download downloader, processTxns txnMutator) {
+	start, end := s.RecentSyncRange()
+	s.StartSync(start, end, download, processTxns)
+}
+
+// SyncRecentNow runs the same sync as SyncRecent, but waits for it to finish. Fails if a sync is already running.
+func (s *Store) SyncRecentNow(download downloader, processTxns txnMutator) error {
+	if !s.startSync() {
+		return errors.New("Sync is already running")
+	}
+	start, end := s.RecentSyncRange()
+	err := s.sync(start, end, download, processTxns)
+	s.stopSync(err)
+	return err
+}
+
+// RecentSyncRange returns the date range SyncRecent downloads, from the last transaction until now. Cash wallet transactions are skipped.
+func (s *Store) RecentSyncRange() (start, end time.Time) {
 	now := currentDate()
-	// TODO inline LastTransactionTime?
 	// TODO use smart first date selection on a per-account basis
-	lastTxnTime := s.Ledger.LastTransactionTime()
+	lastTxnTime := s.Ledger.LastSyncedTransactionTime()
 	if lastTxnTime.IsZero() {
 		lastTxnTime = now.Add(-30 * day)
 	}
-	s.StartSync(lastTxnTime, now, download, processTxns)
+	return lastTxnTime, now
 }
 
 // Resync runs Sync from the first date in the ledger until now
@@ -217,6 +304,14 @@ func (s *Store) RenameAccount(oldName, newName, oldID, newID string) (int, error
 	return updatedCount, s.syncFile()
 }
 
+// DeclareAccount wraps ledger.DeclareAccount and syncs changes to disk if the declaration was added
+func (s *Store) DeclareAccount(decl AccountDeclaration) error {
+	if !s.Ledger.DeclareAccount(decl) {
+		return nil
+	}
+	return s.syncFile()
+}
+
 // UpdateAccount wraps ledger.UpdateAccount and syncs changes to disk
 func (s *Store) UpdateAccount(oldAccount, newAccount string) error {
 	return pipe.OpFuncs{
@@ -241,24 +336,36 @@ func (s *Store) UpdateTransaction(id string, txn Transaction) error {
 	}.Do()
 }
 
-// UpdateTransactions wraps ledger.UpdateTransactions and syncs changes to disk
-func (s *Store) UpdateTransactions(txns map[string]Transaction) error {
-	var ledgerErrs, errs sErrors.Errors
-	for id, txn := range txns {
-		switch err := s.Ledger.UpdateTransaction(id, txn).(type) {
-		case Error:
-			ledgerErrs.AddErr(err)
-		default:
-			errs.AddErr(err)
-		}
-	}
+// UpdateTransactionRevision wraps ledger.UpdateTransactionRevision and syncs changes to disk
+func (s *Store) UpdateTransactionRevision(id, revision string, txn Transaction) error {
+	return pipe.OpFuncs{
+		func() error { return s.Ledger.UpdateTransactionRevision(id, revision, txn) },
+		s.syncFile,
+	}.Do()
+}
+
+// UpdateTransactions wraps ledger.UpdateTransactionRevision for each txn and syncs changes to disk
+// If any expected revisions in 'revisions' don't match, returns RevisionErrors and makes no changes
+func (s *Store) UpdateTransactions(txns map[string]Transaction, revisions map[string]string) error {
+	ledgerErr, err := s.Ledger.updateTransactions(txns, revisions)
 	return pipe.OpFuncs{
-		errs.ErrOrNil,
-		s.syncFile,          // sync file even if there are validation errors
-		ledgerErrs.ErrOrNil, // return least critical errors last
+		func() error { return err },
+		s.syncFile, // sync file even if there are validation errors
+		func() error { return ledgerErr },
 	}.Do()
 }
 
+// Categorize wraps ledger.Categorize and syncs changes to disk in one write, if any were applied
+func (s *Store) Categorize(categories map[string]string, isUncategorized func(account string) bool, overwrite bool) (map[string]string, error) {
+	results := s.Ledger.Categorize(categories, isUncategorized, overwrite)
+	for _, result := range results {
+		if result == CategorizeApplied {
+			return results, s.syncFile()
+		}
+	}
+	return results, nil
+}
+
 // UpdateOpeningBalance wraps ledger.UpdateOpeningBalance and syncs changes to disk
 func (s *Store) UpdateOpeningBalance(opening Transaction) error {
 	return pipe.OpFuncs{
@@ -266,3 +373,103 @@ func (s *Store) UpdateOpeningBalance(opening Transaction) error {
 		s.syncFile,
 	}.Do()
 }
+
+// MarkShared wraps ledger.MarkShared and syncs changes to disk
+func (s *Store) MarkShared(id string, shares []Share) error {
+	return pipe.OpFuncs{
+		func() error { return s.Ledger.MarkShared(id, shares) },
+		s.syncFile,
+	}.Do()
+}
+
+// MarkTransfer wraps ledger.MarkTransfer and syncs changes to disk
+func (s *Store) MarkTransfer(id string, transfer bool) error {
+	return pipe.OpFuncs{
+		func() error { return s.Ledger.MarkTransfer(id, transfer) },
+		s.syncFile,
+	}.Do()
+}
+
+// SetNote wraps ledger.SetNote and syncs changes to disk
+func (s *Store) SetNote(id, note string) error {
+	return pipe.OpFuncs{
+		func() error { return s.Ledger.SetNote(id, note) },
+		s.syncFile,
+	}.Do()
+}
+
+// RemoveTransaction wraps ledger.RemoveTransaction and syncs changes to disk
+func (s *Store) RemoveTransaction(id string) (Transaction, error) {
+	txn, err := s.Ledger.RemoveTransaction(id)
+	if err != nil {
+		return Transaction{}, err
+	}
+	return txn, s.syncFile()
+}
+
+// ToggleCleared wraps ledger.ToggleCleared and syncs changes to disk
+func (s *Store) ToggleCleared(id string) (string, error) {
+	status, err := s.Ledger.ToggleCleared(id)
+	if err != nil {
+		return "", err
+	}
+	return status, s.syncFile()
+}
+
+// Reconcile wraps ledger.Reconcile and syncs changes to disk
+func (s *Store) Reconcile(account string, date time.Time, balance decimal.Decimal) (int, error) {
+	count, err := s.Ledger.Reconcile(account, date, balance)
+	if err != nil {
+		return 0, err
+	}
+	return count, s.syncFile()
+}
+
+// SettleReimbursable wraps ledger.SettleReimbursable and syncs changes to disk
+func (s *Store) SettleReimbursable(id, name string) error {
+	return pipe.OpFuncs{
+		func() error { return s.Ledger.SettleReimbursable(id, name) },
+		s.syncFile,
+	}.Do()
+}
+
+// SetArchiveFile sets the file where ArchiveBefore writes archived transactions
+func (s *Store) SetArchiveFile(file vcs.File) {
+	s.archiveFile = file
+}
+
+// ArchiveBefore wraps ledger.ArchiveBefore, appends the archived transactions to the archive file, then syncs changes to disk
+// Waits for any running sync to finish and prevents new syncs during the archive.
+// If either write fails, the archive file and ledger are rolled back to their previous contents.
+func (s *Store) ArchiveBefore(cutoff time.Time) (archivedCount int, err error) {
+	if s.archiveFile == nil {
+		return 0, errors.New("No archive file is configured")
+	}
+	resume, err := s.PauseSync(archiveSyncTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer resume()
+
+	previousArchive, err := s.archiveFile.Read()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error reading ledger archive")
+	}
+	previous, archived, err := s.Ledger.archiveInPlace(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	archivedLedger := &Ledger{transactions: makeTransactionPtrs(archived)}
+	if err := s.archiveFile.Write(append(previousArchive, []byte(archivedLedger.String())...)); err != nil {
+		s.Ledger.Replace(previous)
+		return 0, errors.Wrap(err, "Error writing ledger archive")
+	}
+	if err := s.syncFile(); err != nil {
+		s.Ledger.Replace(previous)
+		if rollbackErr := s.archiveFile.Write(previousArchive); rollbackErr != nil {
+			return 0, errors.Wrap(rollbackErr, "Error restoring ledger archive")
+		}
+		return 0, err
+	}
+	return len(archived), nil
+}
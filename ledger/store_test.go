@@ -36,7 +36,7 @@ func TestNewStore(t *testing.T) {
 	require.NoError(t, os.Mkdir("repo", 0700))
 	defer func() { require.NoError(t, os.RemoveAll("repo")) }()
 
-	repo, err := vcs.Open("repo")
+	repo, err := vcs.Open("repo", nil)
 	require.NoError(t, err)
 	logger := zaptest.NewLogger(t)
 	store, err := NewStore(repo.File("someFile.ledger"), logger)
@@ -61,10 +61,15 @@ func (m *mockFile) Write(b []byte) error {
 	if m.writeErr != nil {
 		return m.writeErr
 	}
+	m.buf.Reset()
 	_, err := m.buf.Write(b)
 	return err
 }
 
+func (m *mockFile) Path() string {
+	return ""
+}
+
 func (m *mockFile) Read() ([]byte, error) {
 	return m.buf.Bytes(), m.readErr
 }
@@ -91,6 +96,26 @@ func TestNewStoreDeps(t *testing.T) {
 		require.Error(t, err)
 		assert.Equal(t, "Error reading ledger file: some error", err.Error())
 	})
+
+	t.Run("missing or empty file", func(t *testing.T) {
+		logger := zaptest.NewLogger(t)
+		someFile := &mockFile{}
+		someFile.buf.WriteString("\n  \n")
+		store, err := NewStore(someFile, logger)
+		require.NoError(t, err)
+		assert.Equal(t, 0, store.Size())
+	})
+
+	t.Run("unparseable file", func(t *testing.T) {
+		logger := zaptest.NewLogger(t)
+		someFile := &mockFile{}
+		someFile.buf.WriteString("not a ledger\n")
+		_, err := NewStore(someFile, logger)
+		require.Error(t, err)
+		assert.IsType(t, FileParseError{}, err)
+		assert.Contains(t, err.Error(), "leaving it unchanged")
+		assert.Equal(t, "not a ledger\n", someFile.buf.String(), "Unparseable ledger files must not be written")
+	})
 }
 
 func TestSync(t *testing.T) {
@@ -118,6 +143,12 @@ func TestSync(t *testing.T) {
 			syncFileErr:   errors.New("some error"),
 			expectSyncErr: "Error writing ledger to disk: some error",
 		},
+		{
+			description:   "wrapped ledger sync validation error",
+			syncLedgerErr: errors.Wrap(errors.Wrap(NewValidateError(0, errors.New("some error")), "layer 1"), "layer 2"),
+			syncFileErr:   errors.New("some file error"),
+			expectSyncErr: "Error writing ledger to disk: some file error",
+		},
 		{
 			description:   "ledger sync validation error hidden if file sync error",
 			syncLedgerErr: NewValidateError(0, errors.New("some validation error")),
@@ -494,6 +525,43 @@ func TestResync(t *testing.T) {
 	assert.True(t, ranProcess.Load())
 }
 
+func TestSyncRecentNow(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		store := starterStore(t)
+		var ranSync bool
+		store.syncLedger = func(start, end time.Time, download downloader, processTxns txnMutator, ldg *Ledger, logger *zap.Logger, prompt prompter.Prompter) error {
+			ranSync = true
+			assert.Equal(t, currentDate().Add(-30*day), start, "Start date is incorrect")
+			assert.Equal(t, currentDate(), end, "End date is incorrect")
+			return nil
+		}
+		require.NoError(t, store.SyncRecentNow(nil, nil))
+		assert.True(t, ranSync)
+		syncing, _, _ := store.SyncStatus()
+		assert.False(t, syncing)
+	})
+
+	t.Run("sync failed", func(t *testing.T) {
+		store := starterStore(t)
+		store.syncLedger = func(start, end time.Time, download downloader, processTxns txnMutator, ldg *Ledger, logger *zap.Logger, prompt prompter.Prompter) error {
+			return errors.New("some error")
+		}
+		err := store.SyncRecentNow(nil, nil)
+		require.Error(t, err)
+		assert.Equal(t, "some error", err.Error())
+		_, _, lastErr := store.SyncStatus()
+		assert.Equal(t, err, lastErr)
+	})
+
+	t.Run("already syncing", func(t *testing.T) {
+		store := starterStore(t)
+		require.True(t, store.startSync())
+		err := store.SyncRecentNow(nil, nil)
+		require.Error(t, err)
+		assert.Equal(t, "Sync is already running", err.Error())
+	})
+}
+
 func TestStoreRenameAccount(t *testing.T) {
 	ranSync := false
 	syncFile := func() error {
@@ -612,7 +680,7 @@ func TestUpdateTransactions(t *testing.T) {
 			store := starterStore(t)
 			store.Ledger = ldg
 			store.syncFile = syncFile
-			err = store.UpdateTransactions(tc.txns)
+			err = store.UpdateTransactions(tc.txns, nil)
 			assert.Equal(t, tc.expectSync, ranSync, "Sync run didn't match expectation")
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -641,3 +709,57 @@ func TestStoreUpdateOpeningBalance(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, ranSync)
 }
+
+func TestStoreReadFile(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		contents    string
+		expectErr   bool
+	}{
+		{
+			description: "happy path",
+			contents: `2020/01/01 Some payee
+    assets:Super Bank:****1234  $ -1.00 ; id: txn1
+    expenses:uncategorized
+`,
+		},
+		{
+			description: "invalid ledger",
+			contents:    "not a ledger",
+			expectErr:   true,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			store := starterStore(t)
+			file := &mockFile{}
+			require.NoError(t, file.Write([]byte(tc.contents)))
+			store.file = file
+			ldg, err := store.ReadFile()
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, ldg.Size())
+			assert.Equal(t, 0, store.Size(), "Reading the file must not modify the store")
+
+			store.Replace(ldg)
+			assert.Equal(t, 1, store.Size())
+			_, found := store.Transaction("txn1")
+			assert.True(t, found)
+		})
+	}
+}
+
+func TestStorePauseSync(t *testing.T) {
+	store := starterStore(t)
+	resume, err := store.PauseSync(time.Second)
+	require.NoError(t, err)
+	assert.False(t, store.startSync(), "Syncs must not start while paused")
+
+	_, err = store.PauseSync(0)
+	assert.Error(t, err, "Pause should time out while sync is running")
+
+	resume()
+	assert.True(t, store.startSync())
+}
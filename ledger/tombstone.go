@@ -0,0 +1,71 @@
+package ledger
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Tombstones records transactions which were deliberately deleted, so imports skip them instead of adding them again
+type Tombstones interface {
+	// IsDeleted returns true if the transaction 'id' on 'account' was deleted
+	IsDeleted(account, id string) bool
+}
+
+// SetTombstones makes AddTransactions skip new transactions recorded in 'tombstones'. nil imports every transaction.
+func (l *Ledger) SetTombstones(tombstones Tombstones) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tombstones = tombstones
+}
+
+// IsDeleted returns true if AddTransactions would skip 'txn' because it was deleted and isn't already in the ledger
+func (l *Ledger) IsDeleted(txn Transaction) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.isDeleted(txn)
+}
+
+// isDeleted returns true if 'txn' is recorded as deleted and isn't already in the ledger. Must be called with the lock held.
+func (l *Ledger) isDeleted(txn Transaction) bool {
+	if l.tombstones == nil || len(txn.Postings) == 0 || IsBalanceAssertion(txn) {
+		return false
+	}
+	id := txn.Postings[0].ID()
+	return id != "" && l.idSet[id] == nil && l.tombstones.IsDeleted(txn.Postings[0].Account, id)
+}
+
+// skipDeleted removes transactions which are recorded as deleted and aren't already in the ledger. Must be called with the lock held.
+func (l *Ledger) skipDeleted(txns []Transaction) []Transaction {
+	if l.tombstones == nil {
+		return txns
+	}
+	kept := make([]Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if !l.isDeleted(txn) {
+			kept = append(kept, txn)
+		}
+	}
+	return kept
+}
+
+// RemoveTransaction deletes the transaction with ID 'id' and returns it
+func (l *Ledger) RemoveTransaction(id string) (Transaction, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	existingTxn := l.idSet[id]
+	if existingTxn == nil {
+		return Transaction{}, errors.New("Transaction not found by ID: " + id)
+	}
+	remaining := make([]*Transaction, 0, len(l.transactions))
+	for _, txn := range l.transactions {
+		if txn != existingTxn {
+			remaining = append(remaining, txn)
+		}
+	}
+	for txnID, txn := range l.idSet {
+		if txn == existingTxn {
+			delete(l.idSet, txnID)
+		}
+	}
+	l.transactions = remaining
+	return existingTxn.copy(), nil
+}
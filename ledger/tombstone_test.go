@@ -0,0 +1,53 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTombstones map[string]bool
+
+func (t testTombstones) IsDeleted(account, id string) bool {
+	return t[account+"/"+id]
+}
+
+func TestRemoveTransactionTombstones(t *testing.T) {
+	makeTxn := func(id string, amount float64) Transaction {
+		return Transaction{
+			Date:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Payee: "some payee " + id,
+			Postings: []Posting{
+				{Account: "assets:bank", Amount: *decFloat(-amount), Tags: makeIDTag(id)},
+				{Account: "expenses:uncategorized", Amount: *decFloat(amount)},
+			},
+		}
+	}
+	l, err := New([]Transaction{makeTxn("1", 10), makeTxn("2", 5)})
+	require.NoError(t, err)
+
+	removed, err := l.RemoveTransaction("1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", removed.Postings[0].ID())
+	_, found := l.Transaction("1")
+	assert.False(t, found)
+	assert.Equal(t, 1, l.Size())
+	_, err = l.RemoveTransaction("1")
+	assert.EqualError(t, err, "Transaction not found by ID: 1")
+
+	l.SetTombstones(testTombstones{"assets:bank/1": true, "assets:bank/2": true})
+	require.NoError(t, l.AddTransactions([]Transaction{makeTxn("1", 10), makeTxn("2", 5), makeTxn("3", 1)}))
+	_, found = l.Transaction("1")
+	assert.False(t, found, "Deleted transactions should not be imported again")
+	_, found = l.Transaction("2")
+	assert.True(t, found, "Existing transactions should be kept")
+	_, found = l.Transaction("3")
+	assert.True(t, found)
+
+	l.SetTombstones(nil)
+	require.NoError(t, l.AddTransactions([]Transaction{makeTxn("1", 10)}))
+	_, found = l.Transaction("1")
+	assert.True(t, found, "Cleared tombstones should import again")
+}
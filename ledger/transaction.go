@@ -2,6 +2,7 @@ package ledger
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -15,6 +16,8 @@ import (
 const (
 	idTag      = "id"
 	DateFormat = "2006/01/02"
+	// ISODateFormat is the ISO-8601 calendar date format used in the API, independent of the server's locale and time zone
+	ISODateFormat = "2006-01-02"
 )
 
 var (
@@ -23,8 +26,12 @@ var (
 
 // Transaction is a strict(er) representation of a ledger transaction. The extra restrictions are used to verify correctness more easily.
 type Transaction struct {
-	Comment  string `json:",omitempty"`
-	Date     time.Time
+	Comment string `json:",omitempty"`
+	Date    time.Time
+	// EffectiveDate is the optional auxiliary date, written as "posting=effective" like ledger-cli
+	EffectiveDate *time.Time `json:",omitempty"`
+	// Code is the optional transaction code, written as "(code)" before the payee like ledger-cli
+	Code     string `json:",omitempty"`
 	Payee    string
 	Postings []Posting
 	Tags     map[string]string `json:",omitempty"`
@@ -32,21 +39,53 @@ type Transaction struct {
 
 type Transactions []*Transaction
 
-func readAllTransactions(scanner *bufio.Scanner) ([]Transaction, error) {
+// MarshalJSON implements json.Marshaler. Adds ISODate and ISOEffectiveDate, the dates in ISODateFormat, alongside the RFC 3339 Date and EffectiveDate.
+// API clients should read the ISO dates. Date and EffectiveDate remain for one release so existing clients keep working.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	type transaction Transaction // drops MarshalJSON to prevent recursion
+	var isoEffectiveDate string
+	if t.EffectiveDate != nil {
+		isoEffectiveDate = t.EffectiveDate.Format(ISODateFormat)
+	}
+	return json.Marshal(struct {
+		transaction
+		ISODate          string
+		ISOEffectiveDate string `json:",omitempty"`
+	}{
+		transaction:      transaction(t),
+		ISODate:          t.Date.Format(ISODateFormat),
+		ISOEffectiveDate: isoEffectiveDate,
+	})
+}
+
+// readAllTransactions parses transactions and account directives from a ledger file
+func readAllTransactions(scanner *bufio.Scanner) ([]Transaction, []AccountDeclaration, error) {
 	var transactions []Transaction
+	var declarations []AccountDeclaration
 	type readerState struct {
 		txn             Transaction
 		readingPostings bool
 		missingAmount   bool
 		sum             decimal.Decimal
+		declaration     *AccountDeclaration
 	}
 
 	var state readerState
 
 	endTxn := func() error {
+		if state.declaration != nil {
+			declarations = append(declarations, *state.declaration)
+			state = readerState{}
+			return nil
+		}
 		if !state.readingPostings {
 			return nil
 		}
+		if IsBalanceAssertion(state.txn) {
+			transactions = append(transactions, state.txn)
+			state = readerState{}
+			return nil
+		}
 		if len(state.txn.Postings) < 2 {
 			return fmt.Errorf("A transaction must have at least two postings:\n%s", state.txn.String())
 		}
@@ -67,26 +106,39 @@ func readAllTransactions(scanner *bufio.Scanner) ([]Transaction, error) {
 	for scanner.Scan() {
 		line := scanner.Text()
 		trimLine := strings.TrimSpace(line)
+		indented := strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
 		switch {
+		case state.declaration != nil && indented && trimLine != "":
+			// is account directive's subdirective or comment
+			state.declaration.addSubdirective(line)
 		case trimLine == "" || trimLine[0] == ';':
 			// is blank line
 			if err := endTxn(); err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+		case !indented && strings.HasPrefix(line, accountDirective):
+			if err := endTxn(); err != nil {
+				return nil, nil, err
+			}
+			decl, err := parseAccountDirective(line)
+			if err != nil {
+				return nil, nil, err
 			}
-		case !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t"):
+			state.declaration = &decl
+		case !indented:
 			if err := endTxn(); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			// is txn payee line
 			err := parsePayeeLine(&state.txn, line)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			state.readingPostings = true
 		case state.readingPostings:
 			// is posting line
 			if state.missingAmount {
-				return nil, fmt.Errorf("Missing amount is only allowed on the last posting.")
+				return nil, nil, fmt.Errorf("Missing amount is only allowed on the last posting.")
 			}
 			posting, err := NewPostingFromString(line)
 			switch {
@@ -94,18 +146,21 @@ func readAllTransactions(scanner *bufio.Scanner) ([]Transaction, error) {
 				state.missingAmount = true
 				posting.Amount = state.sum
 				posting.Currency = usd
+				if len(state.txn.Postings) > 0 {
+					posting.Currency = state.txn.Postings[0].Currency
+				}
 			case err != nil:
-				return nil, err
+				return nil, nil, err
 			default:
 				state.sum = state.sum.Sub(posting.Amount)
 			}
 			state.txn.Postings = append(state.txn.Postings, posting)
 		default:
-			return nil, fmt.Errorf("Unknown line format detected: %s", line)
+			return nil, nil, fmt.Errorf("Unknown line format detected: %s", line)
 		}
 	}
 	err := endTxn()
-	return transactions, err
+	return transactions, declarations, err
 }
 
 func parsePayeeLine(txn *Transaction, line string) error {
@@ -117,16 +172,42 @@ func parsePayeeLine(txn *Transaction, line string) error {
 	tokens = strings.SplitN(line, " ", 2)
 	date := strings.TrimSpace(tokens[0])
 	if len(tokens) == 2 {
-		txn.Payee = strings.TrimSpace(tokens[1])
+		txn.Code, txn.Payee = parseCode(strings.TrimSpace(tokens[1]))
 	}
+	dates := strings.SplitN(date, "=", 2)
 	var err error
-	txn.Date, err = time.Parse(DateFormat, date)
+	txn.Date, err = time.Parse(DateFormat, dates[0])
 	if err != nil {
 		return err
 	}
+	if len(dates) == 2 {
+		effective, err := parseEffectiveDate(dates[1], txn.Date)
+		if err != nil {
+			return err
+		}
+		txn.EffectiveDate = &effective
+	}
 	return nil
 }
 
+// parseCode splits a leading "(code)" from the rest of a payee line
+func parseCode(line string) (code, payee string) {
+	end := strings.IndexByte(line, ')')
+	if !strings.HasPrefix(line, "(") || end == -1 {
+		return "", line
+	}
+	return strings.TrimSpace(line[1:end]), strings.TrimSpace(line[end+1:])
+}
+
+// parseEffectiveDate parses an auxiliary date, which may omit the year to use the posting date's year
+func parseEffectiveDate(date string, posting time.Time) (time.Time, error) {
+	if strings.Count(date, "/") == 1 {
+		date = fmt.Sprintf("%04d/%s", posting.Year(), date)
+	}
+	effective, err := time.Parse(DateFormat, date)
+	return effective, errors.Wrap(err, "Invalid effective date")
+}
+
 func parseTags(comment string) (string, map[string]string) {
 	if !strings.ContainsRune(comment, ':') {
 		return comment, nil
@@ -168,8 +249,42 @@ func serializeComment(comment string, tags map[string]string) string {
 	return comment
 }
 
+// copy returns a deep copy of t, so the ledger's transactions never share postings or tags with callers
+func (t Transaction) copy() Transaction {
+	if t.EffectiveDate != nil {
+		effective := *t.EffectiveDate
+		t.EffectiveDate = &effective
+	}
+	t.Tags = copyTags(t.Tags)
+	if t.Postings != nil {
+		postings := make([]Posting, len(t.Postings))
+		for i, p := range t.Postings {
+			if p.Balance != nil {
+				balance := *p.Balance
+				p.Balance = &balance
+			}
+			p.Tags = copyTags(p.Tags)
+			postings[i] = p
+		}
+		t.Postings = postings
+	}
+	return t
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+	tagsCopy := make(map[string]string, len(tags))
+	for key, value := range tags {
+		tagsCopy[key] = value
+	}
+	return tagsCopy
+}
+
+// ID returns the transaction's ID, recognizing every historical ID tag format
 func (t Transaction) ID() string {
-	return t.Tags[idTag]
+	return canonicalID(t.Tags)
 }
 
 func (t Transaction) Balanced() bool {
@@ -200,11 +315,21 @@ func (t Transaction) String() string {
 	for _, posting := range t.Postings {
 		postings = append(postings, posting.FormatTable(-accountLen, amountLen))
 	}
+	var effectiveDate string
+	if t.EffectiveDate != nil {
+		effectiveDate = "=" + t.EffectiveDate.Format(DateFormat)
+	}
+	var code string
+	if t.Code != "" {
+		code = "(" + t.Code + ") "
+	}
 	return fmt.Sprintf(
-		"%4d/%02d/%02d %s%s\n    %s\n",
+		"%4d/%02d/%02d%s %s%s%s\n    %s\n",
 		t.Date.Year(),
 		t.Date.Month(),
 		t.Date.Day(),
+		effectiveDate,
+		code,
 		t.Payee,
 		serializeComment(t.Comment, t.Tags),
 		strings.Join(postings, "\n    "),
@@ -220,6 +345,7 @@ func (txns Transactions) Sort() {
 func (t Transaction) matches(search string) int {
 	payee := strings.ToLower(t.Payee)
 	comment := strings.ToLower(t.Comment)
+	note := strings.ToLower(t.Note())
 	date := strings.ToLower(t.Date.Format("Monday 2 January 2006"))
 	postings := make([]string, 0, len(t.Postings))
 	for _, p := range t.Postings {
@@ -235,6 +361,9 @@ func (t Transaction) matches(search string) int {
 		if strings.Contains(comment, token) {
 			score++
 		}
+		if note != "" && strings.Contains(note, token) {
+			score++
+		}
 		if strings.Contains(date, token) {
 			score++
 		}
@@ -3,6 +3,9 @@ package ledger
 import (
 	"bufio"
 	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"strings"
 	"testing"
 	"time"
@@ -252,7 +255,7 @@ func TestReadAllTransactions(t *testing.T) {
 		},
 	} {
 		t.Run(tc.description, func(t *testing.T) {
-			txns, err := readAllTransactions(scanFromStr(tc.input))
+			txns, _, err := readAllTransactions(scanFromStr(tc.input))
 			if tc.shouldErr {
 				assert.Error(t, err)
 				return
@@ -342,6 +345,23 @@ func TestTransactionString(t *testing.T) {
 				`    assets:Bank 1  $ -1.25`,
 			),
 		},
+		{
+			description: "effective date",
+			txn: Transaction{
+				Date:          parseDate(t, "2019/01/05"),
+				EffectiveDate: timePtr(parseDate(t, "2019/01/01")),
+				Payee:         "somebody",
+				Postings: []Posting{
+					{Account: "expenses:rent", Amount: *decFloat(1.25), Currency: usd},
+					{Account: "assets:Bank 1", Amount: *decFloat(-1.25), Currency: usd},
+				},
+			},
+			str: prep(
+				`2019/01/05=2019/01/01 somebody`,
+				`    expenses:rent   $ 1.25`,
+				`    assets:Bank 1  $ -1.25`,
+			),
+		},
 		{
 			description: "no comment or tags",
 			txn: Transaction{
@@ -468,3 +488,86 @@ func TestTransactionValidate(t *testing.T) {
 		assert.True(t, strings.HasPrefix(err.Error(), "Transaction is not balanced - postings do not sum to zero:"))
 	})
 }
+
+func TestEffectiveDateRoundTrip(t *testing.T) {
+	ledgerText := strings.Join([]string{
+		`2019/01/03=2019/01/01 rent ; id: 1`,
+		`    expenses:rent   $ 100`,
+		`    assets:Bank 1  $ -100`,
+		``,
+		`2019/12/30=01/02 paycheck ; id: 2`,
+		`    revenues:salary  $ -10`,
+		`    assets:Bank 1     $ 10`,
+		``,
+		`2019/01/04 groceries ; id: 3`,
+		`    expenses:food   $ 5`,
+		`    assets:Bank 1  $ -5`,
+		``,
+	}, "\n")
+	txns, _, err := readAllTransactions(bufio.NewScanner(strings.NewReader(ledgerText)))
+	require.NoError(t, err)
+	require.Len(t, txns, 3)
+	assert.Equal(t, parseDate(t, "2019/01/03"), txns[0].Date)
+	assert.Equal(t, timePtr(parseDate(t, "2019/01/01")), txns[0].EffectiveDate)
+	assert.Equal(t, timePtr(parseDate(t, "2019/01/02")), txns[1].EffectiveDate, "Effective dates without a year should use the posting date's year")
+	assert.Nil(t, txns[2].EffectiveDate)
+	assert.Equal(t, parseDate(t, "2019/01/01"), txns[0].DateFor(EffectiveBasis))
+	assert.Equal(t, parseDate(t, "2019/01/03"), txns[0].DateFor(PostingBasis))
+	assert.Equal(t, parseDate(t, "2019/01/04"), txns[2].DateFor(EffectiveBasis))
+
+	var buf bytes.Buffer
+	for _, txn := range txns {
+		buf.WriteString(txn.String())
+		buf.WriteRune('\n')
+	}
+	assert.Contains(t, buf.String(), "2019/01/03=2019/01/01 rent")
+	assert.Contains(t, buf.String(), "2019/01/04 groceries")
+	reread, _, err := readAllTransactions(bufio.NewScanner(bytes.NewReader(buf.Bytes())))
+	require.NoError(t, err)
+	assert.Equal(t, txns, reread)
+
+	ledgerCLI, err := exec.LookPath("ledger")
+	if err != nil {
+		t.Skip("ledger-cli not installed, skipping parse check")
+	}
+	file, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.Write(buf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	out, err := exec.Command(ledgerCLI, "--file", file.Name(), "--aux-date", "register", "expenses:rent").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Contains(t, string(out), "19-Jan-01")
+}
+
+func TestCodeRoundTrip(t *testing.T) {
+	ledgerText := strings.Join([]string{
+		`2019/01/03=2019/01/01 (1234) rent ; id: 1`,
+		`    expenses:rent   $ 100`,
+		`    assets:Bank 1  $ -100`,
+		``,
+		`2019/01/04 groceries (bulk) ; id: 2`,
+		`    expenses:food   $ 5`,
+		`    assets:Bank 1  $ -5`,
+		``,
+	}, "\n")
+	txns, _, err := readAllTransactions(bufio.NewScanner(strings.NewReader(ledgerText)))
+	require.NoError(t, err)
+	require.Len(t, txns, 2)
+	assert.Equal(t, "1234", txns[0].Code)
+	assert.Equal(t, "rent", txns[0].Payee)
+	assert.Empty(t, txns[1].Code, "Parentheses after the payee's start are part of the payee")
+	assert.Equal(t, "groceries (bulk)", txns[1].Payee)
+
+	var buf bytes.Buffer
+	for _, txn := range txns {
+		buf.WriteString(txn.String())
+		buf.WriteRune('\n')
+	}
+	assert.Contains(t, buf.String(), "2019/01/03=2019/01/01 (1234) rent ; id: 1")
+	assert.Contains(t, buf.String(), "2019/01/04 groceries (bulk) ; id: 2")
+	reread, _, err := readAllTransactions(bufio.NewScanner(bytes.NewReader(buf.Bytes())))
+	require.NoError(t, err)
+	assert.Equal(t, txns, reread)
+}
@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TransferTag marks a transaction, or an account directive, as a transfer between the user's own accounts.
+// Income and expense reports exclude transfers, but asset and liability balances still include them.
+const TransferTag = "transfer"
+
+// IsTransfer returns true if 'txn' is tagged as a transfer
+func IsTransfer(txn Transaction) bool {
+	return isTrueTag(txn.Tags, TransferTag)
+}
+
+// isTrueTag returns true if 'tags' contains 'key', unless its value is explicitly false
+func isTrueTag(tags map[string]string, key string) bool {
+	value, ok := tags[key]
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(value) {
+	case "false", "no", "n", "0":
+		return false
+	default:
+		return true
+	}
+}
+
+// MarkTransfer tags or untags the transaction with ID 'id' as a transfer
+func (l *Ledger) MarkTransfer(id string, transfer bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	existingTxn := l.idSet[id]
+	if existingTxn == nil {
+		return errors.New("Transaction not found by ID: " + id)
+	}
+	txn := existingTxn.copy()
+	if transfer {
+		if txn.Tags == nil {
+			txn.Tags = make(map[string]string)
+		}
+		txn.Tags[TransferTag] = "true"
+	} else {
+		delete(txn.Tags, TransferTag)
+	}
+	*existingTxn = txn
+	return nil
+}
+
+// IsTransferAccount returns true if 'account' or one of its parents is declared as a transfer account
+func (l *Ledger) IsTransferAccount(account string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.isTransferAccount(account)
+}
+
+// isTransferAccount is IsTransferAccount, but must be called with the lock held
+func (l *Ledger) isTransferAccount(account string) bool {
+	key := AccountKey(account)
+	for _, decl := range l.declarations {
+		if !decl.Transfer {
+			continue
+		}
+		declKey := AccountKey(decl.Account)
+		if key == declKey || strings.HasPrefix(key, declKey+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedFromReports returns true if 'p' is an income or expense posting of a transfer, which reports shouldn't count.
+// Balance sheet postings are never excluded, so account balances stay correct. Must be called with the lock held.
+func (l *Ledger) excludedFromReports(txn *Transaction, p Posting) bool {
+	if !IsTransfer(*txn) && !l.isTransferAccount(p.Account) {
+		return false
+	}
+	switch l.accountType(p.Account) {
+	case AssetType, LiabilityType, EquityType:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,70 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const transferLedger = `account expenses:transfers  ; transfer: true
+account expenses:food
+
+2019/01/02 Groceries
+    assets:checking    $-10 ; id: groceries
+    expenses:food       $10
+
+2019/01/03 Pay off card
+    assets:checking    $-50 ; id: card-payment
+    expenses:transfers  $50
+
+2019/01/04 Move to savings ; transfer: yes
+    assets:checking    $-20 ; id: savings
+    expenses:misc       $20
+`
+
+func TestTransfersExcludedFromReports(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(transferLedger))
+	require.NoError(t, err)
+	assert.True(t, ldg.IsTransferAccount("Expenses:Transfers:Card"))
+	assert.False(t, ldg.IsTransferAccount("expenses:food"))
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC)
+	leftOver := ldg.LeftOverAccountBalances(start, end, "assets")
+	assert.Equal(t, "10", leftOver["expenses:food"].String())
+	assert.NotContains(t, leftOver, "expenses:transfers")
+	assert.NotContains(t, leftOver, "expenses:misc")
+	assert.Equal(t, "10", ldg.AccountBalance("expenses:", start, end).String())
+	assert.Equal(t, "-80", ldg.AccountBalance("assets:checking", start, end).String(), "Balance sheet accounts should include transfers")
+
+	balances := ldg.BalancesAsOf(end)
+	assert.Equal(t, "-80", balances["assets:checking"].String())
+	require.Contains(t, balances, "expenses:transfers", "Transfer categories should still be listed")
+	assert.True(t, balances["expenses:transfers"].IsZero())
+	_, _, monthly := ldg.Balances()
+	assert.Equal(t, "0", monthly["expenses:misc"][0].String())
+	assert.Equal(t, "10", monthly["expenses:food"][0].String())
+}
+
+func TestMarkTransfer(t *testing.T) {
+	ldg, err := NewFromReader(strings.NewReader(transferLedger))
+	require.NoError(t, err)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, ldg.MarkTransfer("groceries", true))
+	txn, _ := ldg.Transaction("groceries")
+	assert.True(t, IsTransfer(txn))
+	assert.True(t, ldg.AccountBalance("expenses:", start, end).IsZero())
+	assert.Contains(t, ldg.String(), "Groceries ; transfer: true")
+
+	require.NoError(t, ldg.MarkTransfer("savings", false))
+	txn, _ = ldg.Transaction("savings")
+	assert.False(t, IsTransfer(txn))
+	assert.Equal(t, "20", ldg.AccountBalance("expenses:", start, end).String())
+
+	assert.Error(t, ldg.MarkTransfer("missing", true))
+}
@@ -6,33 +6,77 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/audit"
+	"github.com/johnstarich/sage/changeset"
 	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
 	_ "github.com/johnstarich/sage/client/direct/drivers"
 	_ "github.com/johnstarich/sage/client/web/drivers"
 	"github.com/johnstarich/sage/consts"
+	"github.com/johnstarich/sage/datalock"
+	"github.com/johnstarich/sage/journal"
 	"github.com/johnstarich/sage/ledger"
 	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/quarantine"
 	"github.com/johnstarich/sage/redactor"
+	"github.com/johnstarich/sage/report"
 	"github.com/johnstarich/sage/rules"
 	"github.com/johnstarich/sage/server"
+	"github.com/johnstarich/sage/settings"
 	"github.com/johnstarich/sage/sync"
+	"github.com/johnstarich/sage/tombstone"
 	"github.com/johnstarich/sage/vcs"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
-func loadRules(fileName string) (rules.Rules, error) {
-	rulesFile, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0600)
+func loadRules(fileName string, readOnly bool) (rules.Rules, rules.CategoryCodes, rules.SplitTemplates, error) {
+	flags := os.O_RDWR | os.O_CREATE
+	if readOnly {
+		flags = os.O_RDONLY
+	}
+	rulesFile, err := os.OpenFile(fileName, flags, 0600)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error opening rules file '%s'", fileName)
+		return nil, nil, nil, errors.Wrapf(err, "Error opening rules file '%s'", fileName)
 	}
 	defer rulesFile.Close()
-	r, err := rules.NewCSVRulesFromReader(rulesFile)
-	return r, errors.Wrapf(err, "Error reading rules from file '%s'", fileName)
+	r, codes, templates, err := rules.NewCSVRulesFileFromReader(rulesFile)
+	return r, codes, templates, errors.Wrapf(err, "Error reading rules from file '%s'", fileName)
+}
+
+// loadSettings opens the settings store, bootstrapped by flag defaults. Flags set on the command line override and replace the saved settings.
+func loadSettings(db plaindb.DB, flagSet *flag.FlagSet, readOnly bool, syncInterval time.Duration, syncGuardMultiple float64) (*settings.Store, error) {
+	store, err := settings.NewStore(db, settings.Settings{
+		SyncInterval:      settings.Duration(syncInterval),
+		Report:            report.Settings{DateBasis: ledger.PostingBasis},
+		SyncGuardMultiple: syncGuardMultiple,
+		ForeignFees:       ledger.DefaultFeeRule(),
+	})
+	if err != nil || readOnly {
+		return store, err
+	}
+	var overrides settings.Update
+	overridden := false
+	flagSet.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "sync-interval":
+			interval := settings.Duration(syncInterval)
+			overrides.SyncInterval = &interval
+			overridden = true
+		case "sync-guard-multiple":
+			overrides.SyncGuardMultiple = &syncGuardMultiple
+			overridden = true
+		}
+	})
+	if overridden {
+		_, err = store.Update(overrides)
+	}
+	return store, errors.Wrap(err, "Invalid settings flags")
 }
 
 func getLogger() (*zap.Logger, error) {
@@ -52,7 +96,7 @@ func start(
 	options server.Options,
 ) error {
 	if !isServer {
-		sync.Sync(ldgStore, accountStore, rulesStore, false)
+		sync.Sync(ldgStore, accountStore, rulesStore, options.AuditLog, options.SyncSummary, options.SyncGuard, false)
 		for {
 			// TODO add CLI prompt support
 			syncing, _, err := ldgStore.SyncStatus()
@@ -96,16 +140,40 @@ func requireFlags(flagSet *flag.FlagSet) (err error) {
 	return nil
 }
 
-func handleErrors(db *plaindb.DB) (usageErr bool, err error) {
+func handleErrors(db *plaindb.DB, lock **datalock.Lock) (usageErr bool, err error) {
 	flagSet := flag.NewFlagSet("sage", flag.ContinueOnError)
 	isServer := flagSet.Bool("server", false, "Starts the Sage http server and sync on an interval until terminated")
 	serverPort := flagSet.Uint("port", 0, "Sets the port the server listens on. Defaults to 8080. Implies -server")
 	noSyncLoop := flagSet.Bool("no-auto-sync", false, "Disables ledger auto-sync")
 	rulesFileName := flagSet.String("rules", "", "Required: Path to an hledger CSV import rules file")
+	payeeCategoriesFileName := flagSet.String("payee-categories", "", "Path to a two column CSV file of payees and default categories, used when no rule matches. Reloaded by the reload API")
 	ledgerFileName := flagSet.String("ledger", "", "Required: Path to a ledger file")
+	ledgerArchiveFileName := flagSet.String("ledger-archive", "", "Path to a ledger file for archived transactions. Defaults to the ledger path with an '.archive' suffix")
 	dbDirName := flagSet.String("data", "", "Required: Path to a database directory")
 	requestVersion := flagSet.Bool("version", false, "Print the version and exit")
 	serverPassword := flagSet.String("password", "", "A password to lock the web UI and API")
+	assertionDialect := flagSet.String("assertion-dialect", string(ledger.LedgerDialect), "Balance assertion syntax to write into the ledger, either 'ledger' or 'hledger'")
+	readOnly := flagSet.Bool("read-only", false, "Starts the server in read-only mode if another Sage instance holds the data directory lock, instead of exiting. Implies -no-auto-sync")
+	webDir := flagSet.String("web-dir", "", "Serves the web UI from this directory instead of the built-in assets, e.g. web/build")
+	auditLogFileName := flagSet.String("audit-log", "", "Path to a JSON lines audit log recording each sync's per-account outcomes. Disabled by default")
+	auditLogMaxSize := flagSet.Int64("audit-log-max-size", audit.DefaultMaxSize, "Rotates the audit log once it grows past this many bytes")
+	syncSummaryFileName := flagSet.String("sync-summary", "", "Path to a JSON file replaced with a summary of each sync run. Defaults to 'sync-summary.json' inside the data directory")
+	syncSummaryVerbose := flagSet.Bool("sync-summary-verbose", false, "Includes each new transaction's date, account, payee, and amount in the sync summary")
+	syncGuardMultiple := flagSet.Float64("sync-guard-multiple", sync.DefaultGuardMultiple, "Quarantines an account's sync batch when its new transactions exceed this multiple of the account's typical count or amount. Set to 0 to disable. Saved to settings when set")
+	syncFutureTolerance := flagSet.Duration("sync-future-tolerance", sync.DefaultFutureTolerance, "Defers downloaded transactions dated more than this far past today until a later sync, since they're usually caused by an institution's clock bug")
+	syncImportFuture := flagSet.Bool("sync-import-future", false, "Imports future-dated transactions immediately with their date clamped to today, instead of deferring them. The original date is kept in a '"+sync.ClaimedDateTag+"' tag")
+	syncInterval := flagSet.Duration("sync-interval", settings.DefaultSyncInterval, "Time between automatic syncs. Saved to settings when set")
+	syncSchedule := flagSet.String("sync-schedule", "", "Cron expression for automatic sync times, like '0 6,18 * * *' for 6am and 6pm. Replaces -sync-interval when set")
+	syncScheduleTimeZone := flagSet.String("sync-schedule-timezone", "", "IANA time zone for -sync-schedule times, like America/Denver. Defaults to the local time zone")
+	corsOrigins := flagSet.String("cors-origins", "", "Comma-separated origins allowed to call the API from a separately hosted frontend, e.g. https://dashboard.example.com. Use '*' to allow every origin. Only same-origin requests are allowed by default")
+	corsCredentials := flagSet.Bool("cors-credentials", false, "Allows the -cors-origins to send cookies and authorization headers. Can't be combined with '*'")
+	corsMaxAge := flagSet.Duration("cors-max-age", server.DefaultCORSMaxAge, "How long browsers may cache CORS preflight responses")
+	accountInfoCacheTTL := flagSet.Duration("account-info-cache-ttl", server.DefaultAccountInfoCacheTTL, "Reuses account discovery results for the same institution and credentials for this long, reducing institution logins. Set to 0 to disable")
+	maxUploadSize := flagSet.Int64("max-upload-size", server.DefaultMaxUploadSize, "Largest file upload in bytes accepted by the API, like OFX statements and CSV files. Other requests are limited to 1 MiB")
+	accountsWatchInterval := flagSet.Duration("accounts-watch-interval", 0, "Checks the accounts files for changes made outside Sage this often, e.g. by secret rotation tooling, and reloads them without a restart. Disabled by default")
+	minTLSVersion := flagSet.String("min-tls-version", "1.2", "Oldest TLS version allowed for OFX connections, one of 1.0, 1.1, 1.2, or 1.3. Institutions only supporting older versions fail to connect")
+	timeZone := flagSet.String("timezone", "UTC", "IANA time zone for ledger posting dates, like America/Denver. Accounts with their own time zone have institution dates converted into this one")
+	lockTakeoverAge := flagSet.Duration("lock-takeover-age", 0, "Takes over data directory locks held by other hosts or by a process with our PID if they have not been refreshed within this duration, e.g. 1h. Disabled by default")
 	if err := flagSet.Parse(os.Args[1:]); err != nil {
 		return true, err
 	}
@@ -118,6 +186,27 @@ func handleErrors(db *plaindb.DB) (usageErr bool, err error) {
 		return true, errors.Errorf("%s\n%s", err.Error(), usage(flagSet))
 	}
 
+	dialect, err := ledger.ParseAssertionDialect(*assertionDialect)
+	if err != nil {
+		return true, err
+	}
+	tlsVersion, err := direct.ParseTLSVersion(*minTLSVersion)
+	if err != nil {
+		return true, err
+	}
+	direct.SetMinTLSVersion(tlsVersion)
+	ledgerTimeZone, err := time.LoadLocation(*timeZone)
+	if err != nil || *timeZone == "" || *timeZone == "Local" {
+		return true, errors.Errorf("Invalid time zone, must be an IANA time zone name like America/Denver: %q", *timeZone)
+	}
+	client.SetLedgerTimeZone(ledgerTimeZone)
+	if *maxUploadSize <= 0 {
+		return true, errors.Errorf("Max upload size must be positive: %d", *maxUploadSize)
+	}
+	if *syncFutureTolerance < 0 {
+		return true, errors.Errorf("Sync future tolerance must not be negative: %s", *syncFutureTolerance)
+	}
+
 	*isServer = *isServer || *serverPort != 0
 	if *serverPort == 0 {
 		*serverPort = 8080
@@ -129,44 +218,168 @@ func handleErrors(db *plaindb.DB) (usageErr bool, err error) {
 			return true, errors.Errorf("Port number must be a positive 16-bit integer: %d", *serverPort)
 		}
 	}
+	if *readOnly && !*isServer {
+		return true, errors.New("Read-only mode requires -server")
+	}
+
+	options := server.Options{
+		Address:               fmt.Sprintf("0.0.0.0:%d", port),
+		AutoSync:              !*noSyncLoop,
+		Password:              redactor.String(*serverPassword),
+		WebDir:                *webDir,
+		AccountInfoCacheTTL:   *accountInfoCacheTTL,
+		AccountsWatchInterval: *accountsWatchInterval,
+		MaxUploadSize:         *maxUploadSize,
+		CORS: server.CORS{
+			AllowCredentials: *corsCredentials,
+			MaxAge:           *corsMaxAge,
+		},
+		SyncSchedule: server.SyncSchedule{
+			Cron:     *syncSchedule,
+			TimeZone: *syncScheduleTimeZone,
+		},
+	}
+	if err := options.SyncSchedule.Validate(); err != nil {
+		return true, err
+	}
+	for _, origin := range strings.Split(*corsOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			options.CORS.Origins = append(options.CORS.Origins, origin)
+		}
+	}
+	if err := options.CORS.Validate(); err != nil {
+		return true, err
+	}
+	if *auditLogFileName != "" && !*readOnly {
+		options.AuditLog = audit.New(*auditLogFileName, *auditLogMaxSize)
+	}
+	if *syncSummaryFileName == "" {
+		*syncSummaryFileName = filepath.Join(*dbDirName, "sync-summary.json")
+	}
+	options.SyncSummary = audit.NewSummaryFile(*syncSummaryFileName, *syncSummaryVerbose)
+	var guard vcs.WriteGuard
+	dataLock, err := datalock.Acquire(*dbDirName, datalock.Options{TakeoverAge: *lockTakeoverAge})
+	if heldErr, isHeld := err.(datalock.HeldError); isHeld && *readOnly {
+		options.ReadOnly = true
+		options.LockHolder = &heldErr.Owner
+		guard = datalock.ReadOnlyGuard(heldErr.Owner)
+	} else if err != nil {
+		return false, err
+	} else {
+		*lock = dataLock
+		options.Lock = dataLock
+		guard = dataLock.AssertHeld
+	}
 
 	var repo vcs.Repository
-	*db, err = plaindb.Open(*dbDirName, plaindb.VersionControl(&repo))
+	*db, err = plaindb.Open(*dbDirName, plaindb.WriteGuard(guard), plaindb.VersionControl(&repo))
 	if err != nil {
 		return false, err
 	}
+	var recoveredChange bool
+	if !options.ReadOnly {
+		recoveredChange, err = changeset.Recover(*dbDirName, repo)
+		if err != nil {
+			return false, err
+		}
+	}
 
 	accountStore, err := client.NewAccountStore(*db)
 	if err != nil {
 		return false, err
 	}
+	settingsStore, err := loadSettings(*db, flagSet, options.ReadOnly, *syncInterval, *syncGuardMultiple)
+	if err != nil {
+		return false, err
+	}
+	options.Settings = settingsStore
+	currentSettings, err := settingsStore.Settings()
+	if err != nil {
+		return false, err
+	}
+	if !options.ReadOnly {
+		quarantineStore, err := quarantine.NewStore(*db)
+		if err != nil {
+			return false, err
+		}
+		journalStore, err := journal.NewStore(*db)
+		if err != nil {
+			return false, err
+		}
+		options.SyncGuard = sync.NewGuard(quarantineStore, journalStore, currentSettings.SyncGuardMultiple)
+		options.SyncGuard.SetFutureDates(*syncFutureTolerance, *syncImportFuture)
+	}
 
 	logger, err := getLogger()
 	if err != nil {
 		return false, err
 	}
+	if recoveredChange {
+		logger.Warn("Finished applying changes interrupted by the last shutdown")
+	}
+	if options.ReadOnly {
+		logger.Warn("Starting in read-only mode", zap.String("lockHolder", options.LockHolder.String()))
+	} else {
+		dataLock.KeepAlive(datalock.DefaultKeepAliveInterval, func(err error) {
+			logger.Error("Failed to refresh data directory lock", zap.Error(err))
+		})
+	}
 
 	ldgStore, err := ledger.NewStore(repo.File(*ledgerFileName), logger)
 	if err != nil {
 		return false, err
 	}
+	ldgStore.SetAssertionDialect(dialect)
+	if *ledgerArchiveFileName == "" {
+		*ledgerArchiveFileName = *ledgerFileName + ".archive"
+	}
+	ldgStore.SetArchiveFile(repo.File(*ledgerArchiveFileName))
+	tombstoneStore, err := tombstone.NewStore(*db)
+	if err != nil {
+		return false, err
+	}
+	ldgStore.SetTombstones(tombstoneStore)
 
-	r, err := loadRules(*rulesFileName)
+	r, codes, templates, err := loadRules(*rulesFileName, options.ReadOnly)
 	if err != nil {
 		return false, err
 	}
 	rulesStore := rules.NewStore(r)
+	if err := rulesStore.SetCategoryCodes(codes); err != nil {
+		return false, err
+	}
+	if err := rulesStore.SetSplitTemplates(templates); err != nil {
+		return false, err
+	}
+	payees, err := rules.ReadPayeeCategoriesFile(*payeeCategoriesFileName)
+	if err != nil {
+		return false, err
+	}
+	rulesStore.SetPayeeCategories(payees, *payeeCategoriesFileName)
 	rulesFile := repo.File(*rulesFileName)
+	options.Changes = changeset.New(*dbDirName, repo, guard, *db, ldgStore, sync.RulesChanges(rulesFile, rulesStore))
 
-	return false, start(*isServer, *db, ldgStore, accountStore, rulesFile, rulesStore, logger, server.Options{
-		Address:  fmt.Sprintf("0.0.0.0:%d", port),
-		AutoSync: !*noSyncLoop,
-		Password: redactor.String(*serverPassword),
+	rulesStore.SetDefaultCategory(currentSettings.DefaultCategory)
+	rulesStore.SetFeeRule(currentSettings.ForeignFees)
+	if err := rulesStore.SetPrecedence(currentSettings.ClassifierPrecedence); err != nil {
+		return false, err
+	}
+	settingsStore.OnChange(func(updated settings.Settings) {
+		rulesStore.SetDefaultCategory(updated.DefaultCategory)
+		rulesStore.SetFeeRule(updated.ForeignFees)
+		// updates are validated, and only transactions classified after this point use the new order
+		_ = rulesStore.SetPrecedence(updated.ClassifierPrecedence)
+		if options.SyncGuard != nil {
+			options.SyncGuard.SetMultiple(updated.SyncGuardMultiple)
+		}
 	})
+
+	return false, start(*isServer, *db, ldgStore, accountStore, rulesFile, rulesStore, logger, options)
 }
 
 func main() {
 	var db plaindb.DB
+	var lock *datalock.Lock
 
 	go func() {
 		c := make(chan os.Signal, 1)
@@ -176,18 +389,21 @@ func main() {
 			fmt.Println(`{"level":"info","msg":"Handling signal: ` + s.String() + `"}`)
 			switch s {
 			case os.Interrupt:
-				sync.Shutdown(db, 0)
+				sync.Shutdown(db, lock, 0)
 			case os.Kill:
-				sync.Shutdown(db, 1)
+				sync.Shutdown(db, lock, 1)
 			}
 		}
 	}()
-	usageErr, err := handleErrors(&db)
+	usageErr, err := handleErrors(&db, &lock)
 	if err != nil && err != flag.ErrHelp {
 		fmt.Fprintln(os.Stderr, err)
 		if usageErr {
-			sync.Shutdown(db, 2)
+			sync.Shutdown(db, lock, 2)
 		}
-		sync.Shutdown(db, 1)
+		sync.Shutdown(db, lock, 1)
+	}
+	if lock != nil {
+		_ = lock.Release()
 	}
 }
@@ -29,8 +29,9 @@ type bucket struct {
 	mu    sync.RWMutex
 	saver func(*bucket) error
 
-	version string
-	data    map[string]interface{}
+	upgrader Upgrader
+	version  string
+	data     map[string]interface{}
 }
 
 type unmarshalBucket struct {
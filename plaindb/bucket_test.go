@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/johnstarich/sage/vcs"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -249,3 +250,20 @@ func TestVersionControl(t *testing.T) {
 	err = b.Put("some other ID", "hello there")
 	require.NoError(t, err)
 }
+
+func TestWriteGuard(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	guardErr := errors.New("some guard error")
+	db, err := Open(tmpDir, WriteGuard(func() error { return guardErr }))
+	require.NoError(t, err)
+
+	b, err := db.Bucket("bucket", "", &mockUpgrader{})
+	require.NoError(t, err)
+	err = b.Put("some ID", "hello world")
+	assert.Equal(t, guardErr, err)
+	_, err = os.Stat(filepath.Join(tmpDir, "bucket.json"))
+	assert.True(t, os.IsNotExist(err), "guarded bucket should not be written to disk")
+}
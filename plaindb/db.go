@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/johnstarich/sage/vcs"
 	"github.com/pkg/errors"
@@ -47,12 +48,25 @@ type DB interface {
 	io.Closer
 	// Bucket returns a bucket with 'name.json' on disk, and auto-upgraded to 'version'
 	Bucket(name, version string, upgrader Upgrader) (Bucket, error)
+	// ReloadBucket re-reads 'name.json' from disk without modifying the existing bucket.
+	// Returns the reloaded bucket for inspection and a swap func to replace the existing bucket's records with the reloaded ones.
+	ReloadBucket(name, version string, upgrader Upgrader) (reloaded Bucket, swap func(), err error)
+	// Stage holds all bucket writes in memory until Unstage, and returns a func which restores every bucket's records from before staging
+	Stage() (restore func(), err error)
+	// Files returns the contents of every bucket written while staged, keyed by path
+	Files() (map[string][]byte, error)
+	// Unstage resumes writing buckets to disk. Writes held while staged are not written.
+	Unstage()
 }
 
 type database struct {
 	path    string
 	repo    vcs.Repository
+	guard   vcs.WriteGuard
 	buckets map[string]*bucket
+
+	stageMu sync.Mutex
+	staged  map[string]*stagedBucket // nil unless staged
 }
 
 type bucketSaver func(*bucket) error
@@ -76,11 +90,32 @@ func Open(path string, opts ...DBOpt) (DB, error) {
 }
 
 func (db *database) Bucket(name, version string, upgrader Upgrader) (Bucket, error) {
+	return db.bucket(name, version, upgrader, ioutil.ReadFile, db.saver())
+}
+
+func (db *database) ReloadBucket(name, version string, upgrader Upgrader) (Bucket, func(), error) {
+	return db.reloadBucket(name, version, upgrader, ioutil.ReadFile, db.saver())
+}
+
+// saver returns the bucket saver for this DB. All writes are checked against the DB's write guard, and held in memory while staged.
+func (db *database) saver() bucketSaver {
 	saver := saveBucketToDisk
 	if db.repo != nil {
 		saver = repoSaveBucket(db.repo)
 	}
-	return db.bucket(name, version, upgrader, ioutil.ReadFile, saver)
+	return db.stagedSaver(func(b *bucket) error {
+		if err := db.checkWritable(); err != nil {
+			return err
+		}
+		return saver(b)
+	})
+}
+
+func (db *database) checkWritable() error {
+	if db.guard == nil {
+		return nil
+	}
+	return db.guard()
 }
 
 func (db *database) bucket(
@@ -95,7 +130,54 @@ func (db *database) bucket(
 	if b, exists := db.buckets[name]; exists {
 		return b, nil
 	}
+	b, err := db.readBucket(name, version, upgrader, readFile, saver)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.stageBucket(b); err != nil {
+		return nil, err
+	}
+	db.buckets[name] = b
+	return b, nil
+}
+
+func (db *database) reloadBucket(
+	name, version string,
+	upgrader Upgrader,
+	readFile func(string) ([]byte, error),
+	saver bucketSaver,
+) (Bucket, func(), error) {
+	if upgrader == nil {
+		return nil, nil, errors.New("Upgrader must not be nil")
+	}
+	reloaded, err := db.readBucket(name, version, upgrader, readFile, saver)
+	if err != nil {
+		return nil, nil, err
+	}
+	swap := func() {
+		existing, exists := db.buckets[name]
+		if !exists {
+			db.buckets[name] = reloaded
+			return
+		}
+		reloaded.mu.RLock()
+		data := reloaded.data
+		reloaded.mu.RUnlock()
+		existing.mu.Lock()
+		existing.data = data
+		existing.mu.Unlock()
+		db.buckets[name] = existing
+	}
+	return reloaded, swap, nil
+}
 
+// readBucket reads and upgrades the bucket from disk. Does not cache the result.
+func (db *database) readBucket(
+	name, version string,
+	upgrader Upgrader,
+	readFile func(string) ([]byte, error),
+	saver bucketSaver,
+) (*bucket, error) {
 	path := filepath.Join(db.path, name+".json")
 	dataBytes, err := readFile(path)
 	if err != nil {
@@ -152,14 +234,13 @@ func (db *database) bucket(
 	}
 
 	b := &bucket{
-		name:    name,
-		path:    path,
-		saver:   saver,
-		version: version,
-		data:    data,
+		name:     name,
+		path:     path,
+		saver:    saver,
+		upgrader: upgrader,
+		version:  version,
+		data:     data,
 	}
-
-	db.buckets[name] = b
 	return b, nil
 }
 
@@ -248,6 +329,10 @@ func (db *mockDatabase) Bucket(name, version string, upgrader Upgrader) (Bucket,
 	return db.bucket(name, version, upgrader, db.FileReader, func(b *bucket) error { return db.Saver(b) })
 }
 
+func (db *mockDatabase) ReloadBucket(name, version string, upgrader Upgrader) (Bucket, func(), error) {
+	return db.reloadBucket(name, version, upgrader, db.FileReader, func(b *bucket) error { return db.Saver(b) })
+}
+
 func (db *mockDatabase) Dump(b Bucket) string {
 	bucketStruct, ok := b.(*bucket)
 	if !ok {
@@ -68,15 +68,17 @@ func TestOpenNewBucket(t *testing.T) {
 	}
 
 	// Bucket
-	b, err := db.Bucket("accounts", "1", &mockUpgrader{})
+	upgrader := &mockUpgrader{}
+	b, err := db.Bucket("accounts", "1", upgrader)
 	assert.NoError(t, err)
 	b.(*bucket).saver = nil // can't compare functions
 	assert.Equal(t, &bucket{
-		name:    "accounts",
-		path:    filepath.Join(tmpDir, "accounts.json"),
-		saver:   nil,
-		version: "1",
-		data:    map[string]interface{}{},
+		name:     "accounts",
+		path:     filepath.Join(tmpDir, "accounts.json"),
+		saver:    nil,
+		upgrader: upgrader,
+		version:  "1",
+		data:     map[string]interface{}{},
 	}, b)
 }
 
@@ -302,9 +304,10 @@ func TestBucket(t *testing.T) {
 
 			b.(*bucket).saver = nil // can't compare functions
 			assert.Equal(t, &bucket{
-				name:  tc.name,
-				path:  expectedBucketPath,
-				saver: nil,
+				name:     tc.name,
+				path:     expectedBucketPath,
+				saver:    nil,
+				upgrader: tc.upgrader,
 
 				version: tc.version,
 				data:    tc.expectedData,
@@ -352,9 +355,10 @@ func TestLegacyParse(t *testing.T) {
 
 	b.(*bucket).saver = nil // can't compare functions
 	assert.Equal(t, &bucket{
-		name:  "accounts",
-		path:  "mock/accounts.json",
-		saver: nil,
+		name:     "accounts",
+		path:     "mock/accounts.json",
+		saver:    nil,
+		upgrader: upgrader,
 
 		version: "2",
 		data: map[string]interface{}{
@@ -469,3 +473,45 @@ func TestBucketUpgrader(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 1, num)
 }
+
+func TestReloadBucket(t *testing.T) {
+	fileContents := `{"Version": "1", "Data": {"a": "1"}}`
+	db := NewMockDB(MockConfig{
+		FileReader: func(path string) ([]byte, error) {
+			return []byte(fileContents), nil
+		},
+	})
+	upgrader := &mockUpgrader{
+		parser: func(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+			var s string
+			err := json.Unmarshal(data, &s)
+			return s, err
+		},
+	}
+	b, err := db.Bucket("something", "1", upgrader)
+	require.NoError(t, err)
+
+	fileContents = `{"Version": "1", "Data": {"b": "2"}}`
+	reloaded, swap, err := db.ReloadBucket("something", "1", upgrader)
+	require.NoError(t, err)
+	var value string
+	found, err := reloaded.Get("b", &value)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "2", value)
+	found, _ = b.Get("b", &value)
+	assert.False(t, found, "Existing bucket must not change until swapped")
+
+	swap()
+	found, err = b.Get("b", &value)
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, _ = b.Get("a", &value)
+	assert.False(t, found)
+
+	fileContents = `not json`
+	_, _, err = db.ReloadBucket("something", "1", upgrader)
+	assert.Error(t, err)
+	found, _ = b.Get("b", &value)
+	assert.True(t, found, "Failed reloads must not modify the existing bucket")
+}
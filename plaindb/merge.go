@@ -0,0 +1,142 @@
+package plaindb
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Records returns the JSON encoding of each of b's records by ID, including redacted values, the same way they're saved to disk
+func Records(b Bucket) (map[string]json.RawMessage, error) {
+	bucketStruct, ok := b.(*bucket)
+	if !ok {
+		return nil, errors.Errorf("Invalid bucket struct for Records: %T", b)
+	}
+	bucketStruct.mu.RLock()
+	defer bucketStruct.mu.RUnlock()
+	return bucketStruct.records()
+}
+
+// records encodes b's records. Must be called with the lock held.
+func (b *bucket) records() (map[string]json.RawMessage, error) {
+	var buf bytes.Buffer
+	if err := encodeBucket(&buf, b); err != nil {
+		return nil, b.wrapErr(err)
+	}
+	var bucketBytes unmarshalBucket
+	if err := json.Unmarshal(buf.Bytes(), &bucketBytes); err != nil {
+		return nil, b.wrapErr(err)
+	}
+	return bucketBytes.Data, nil
+}
+
+// Path returns the file path b is saved to
+func Path(b Bucket) string {
+	if bucketStruct, ok := b.(*bucket); ok {
+		return bucketStruct.path
+	}
+	return ""
+}
+
+// Merge merges changes made to b's file outside this process into b, then saves b.
+// 'base' contains the records as they were last read from disk, and 'disk' contains the records read from disk now, e.g. from ReloadBucket and Records.
+// Fields of records which changed on disk since 'base' take precedence to b's fields, the rest of b's changes are kept.
+// Records added or removed on disk are added or removed from b. Returns the IDs of changed records, sorted.
+func Merge(b Bucket, base, disk map[string]json.RawMessage) ([]string, error) {
+	bucketStruct, ok := b.(*bucket)
+	if !ok {
+		return nil, errors.Errorf("Invalid bucket struct for Merge: %T", b)
+	}
+	bucketStruct.mu.Lock()
+	memory, err := bucketStruct.records()
+	if err != nil {
+		bucketStruct.mu.Unlock()
+		return nil, err
+	}
+	updates := make(map[string]interface{})
+	var changed []string
+	for id := range unionKeys(base, disk, memory) {
+		merged, err := mergeRecord(base[id], memory[id], disk[id])
+		if err != nil {
+			bucketStruct.mu.Unlock()
+			return nil, bucketStruct.wrapErr(errors.Wrapf(err, "Failed to merge record %q", id))
+		}
+		if equalJSON(merged, memory[id]) {
+			continue
+		}
+		var item interface{}
+		if merged != nil {
+			item, err = bucketStruct.upgrader.Parse(bucketStruct.version, id, merged)
+			if err != nil {
+				bucketStruct.mu.Unlock()
+				return nil, bucketStruct.wrapErr(err)
+			}
+		}
+		updates[id] = item
+		changed = append(changed, id)
+	}
+	for id, item := range updates {
+		if item == nil {
+			delete(bucketStruct.data, id)
+		} else {
+			bucketStruct.data[id] = item
+		}
+	}
+	bucketStruct.mu.Unlock()
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	sort.Strings(changed)
+	return changed, bucketStruct.saver(bucketStruct)
+}
+
+// mergeRecord returns 'memory' with every top-level field changed between 'base' and 'disk' taken from 'disk'. Nil records don't exist.
+func mergeRecord(base, memory, disk json.RawMessage) (json.RawMessage, error) {
+	switch {
+	case equalJSON(base, disk):
+		return memory, nil
+	case disk == nil, memory == nil, base == nil:
+		// added or removed on disk, or re-added on disk after being removed in memory
+		return disk, nil
+	}
+	var baseFields, memoryFields, diskFields map[string]json.RawMessage
+	if json.Unmarshal(base, &baseFields) != nil || json.Unmarshal(memory, &memoryFields) != nil || json.Unmarshal(disk, &diskFields) != nil {
+		// not objects, so the whole record changed on disk
+		return disk, nil
+	}
+	merged := make(map[string]json.RawMessage, len(memoryFields))
+	for field := range unionKeys(baseFields, memoryFields, diskFields) {
+		value := memoryFields[field]
+		if !equalJSON(baseFields[field], diskFields[field]) {
+			value = diskFields[field]
+		}
+		if value != nil {
+			merged[field] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+func unionKeys(maps ...map[string]json.RawMessage) map[string]bool {
+	keys := make(map[string]bool)
+	for _, m := range maps {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// equalJSON returns true if a and b are the same JSON, ignoring whitespace. Nil is only equal to nil.
+func equalJSON(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
@@ -0,0 +1,90 @@
+package plaindb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mergeItem struct {
+	Name     string
+	Password string `json:",omitempty"`
+}
+
+func TestMerge(t *testing.T) {
+	fileContents := `{"Version": "1", "Data": {
+		"a": {"Name": "account a", "Password": "old"},
+		"b": {"Name": "account b"},
+		"c": {"Name": "account c"}
+	}}`
+	var saves int
+	db := NewMockDB(MockConfig{
+		FileReader: func(path string) ([]byte, error) {
+			return []byte(fileContents), nil
+		},
+		Saver: func(Bucket) error {
+			saves++
+			return nil
+		},
+	})
+	upgrader := &mockUpgrader{
+		parser: func(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+			var item mergeItem
+			err := json.Unmarshal(data, &item)
+			return &item, err
+		},
+	}
+	b, err := db.Bucket("something", "1", upgrader)
+	require.NoError(t, err)
+	base, err := Records(b)
+	require.NoError(t, err)
+
+	// in-flight changes
+	require.NoError(t, b.Put("a", &mergeItem{Name: "renamed a", Password: "old"}))
+	require.NoError(t, b.Put("d", &mergeItem{Name: "account d"}))
+	saves = 0
+
+	// changes on disk
+	fileContents = `{"Version": "1", "Data": {
+		"a": {"Name": "account a", "Password": "new"},
+		"b": {"Name": "renamed b"},
+		"e": {"Name": "account e"}
+	}}`
+	reloaded, _, err := db.ReloadBucket("something", "1", upgrader)
+	require.NoError(t, err)
+	disk, err := Records(reloaded)
+	require.NoError(t, err)
+
+	changed, err := Merge(b, base, disk)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "e"}, changed)
+	assert.Equal(t, 1, saves)
+
+	var item *mergeItem
+	_, err = b.Get("a", &item)
+	require.NoError(t, err)
+	assert.Equal(t, &mergeItem{Name: "renamed a", Password: "new"}, item, "Fields changed on disk and in memory should both be kept")
+	_, err = b.Get("b", &item)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed b", item.Name)
+	found, _ := b.Get("c", &item)
+	assert.False(t, found, "Records removed on disk should be removed")
+	found, _ = b.Get("d", &item)
+	assert.True(t, found, "Records added in memory should be kept")
+	found, _ = b.Get("e", &item)
+	assert.True(t, found, "Records added on disk should be added")
+
+	changed, err = Merge(b, disk, disk)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, 1, saves, "Unchanged merges should not save")
+}
+
+func TestEqualJSON(t *testing.T) {
+	assert.True(t, equalJSON(nil, nil))
+	assert.False(t, equalJSON(nil, json.RawMessage(`null`)))
+	assert.True(t, equalJSON(json.RawMessage(`{"a": 1}`), json.RawMessage(`{"a":1}`)))
+	assert.False(t, equalJSON(json.RawMessage(`{"a": 1}`), json.RawMessage(`{"a": 2}`)))
+}
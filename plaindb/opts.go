@@ -15,11 +15,20 @@ func (opt dbOpt) do(db *database) error {
 	return opt(db)
 }
 
+// VersionControl commits all bucket writes to a Git repo in the DB directory, and stores the repo in 'setRepo'
 func VersionControl(setRepo *vcs.Repository) DBOpt {
 	return dbOpt(func(db *database) error {
-		repo, err := vcs.Open(db.path)
+		repo, err := vcs.Open(db.path, db.checkWritable)
 		db.repo = repo
 		*setRepo = repo
 		return err
 	})
 }
+
+// WriteGuard rejects all bucket writes when 'guard' returns an error
+func WriteGuard(guard vcs.WriteGuard) DBOpt {
+	return dbOpt(func(db *database) error {
+		db.guard = guard
+		return nil
+	})
+}
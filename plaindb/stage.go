@@ -0,0 +1,124 @@
+package plaindb
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// stagedBucket holds a bucket's records from before staging, and whether it was written since
+type stagedBucket struct {
+	bucket   *bucket
+	snapshot map[string]interface{}
+	dirty    bool
+}
+
+func (db *database) Stage() (func(), error) {
+	db.stageMu.Lock()
+	if db.staged != nil {
+		db.stageMu.Unlock()
+		return nil, errors.New("DB is already staged")
+	}
+	db.staged = make(map[string]*stagedBucket, len(db.buckets))
+	db.stageMu.Unlock()
+
+	for _, b := range db.buckets {
+		if err := db.stageBucket(b); err != nil {
+			db.Unstage()
+			return nil, err
+		}
+	}
+	return db.restoreStaged, nil
+}
+
+// stageBucket snapshots b's records, if the DB is staged
+func (db *database) stageBucket(b *bucket) error {
+	db.stageMu.Lock()
+	defer db.stageMu.Unlock()
+	if db.staged == nil {
+		return nil
+	}
+	snapshot, err := copyBucketData(b)
+	if err != nil {
+		return err
+	}
+	db.staged[b.name] = &stagedBucket{bucket: b, snapshot: snapshot}
+	return nil
+}
+
+func (db *database) restoreStaged() {
+	db.stageMu.Lock()
+	defer db.stageMu.Unlock()
+	for _, staged := range db.staged {
+		staged.bucket.mu.Lock()
+		staged.bucket.data = staged.snapshot
+		staged.bucket.mu.Unlock()
+	}
+}
+
+func (db *database) Files() (map[string][]byte, error) {
+	db.stageMu.Lock()
+	defer db.stageMu.Unlock()
+	files := make(map[string][]byte)
+	for _, staged := range db.staged {
+		if !staged.dirty {
+			continue
+		}
+		var buf bytes.Buffer
+		staged.bucket.mu.RLock()
+		err := encodeBucket(&buf, staged.bucket)
+		staged.bucket.mu.RUnlock()
+		if err != nil {
+			return nil, staged.bucket.wrapErr(err)
+		}
+		files[staged.bucket.path] = buf.Bytes()
+	}
+	return files, nil
+}
+
+func (db *database) Unstage() {
+	db.stageMu.Lock()
+	db.staged = nil
+	db.stageMu.Unlock()
+}
+
+// stagedSaver holds writes in memory while the DB is staged, otherwise saves with 'saver'
+func (db *database) stagedSaver(saver bucketSaver) bucketSaver {
+	return func(b *bucket) error {
+		db.stageMu.Lock()
+		staged, isStaged := db.staged[b.name]
+		if isStaged {
+			staged.dirty = true
+		}
+		db.stageMu.Unlock()
+		if isStaged {
+			return nil
+		}
+		return saver(b)
+	}
+}
+
+// copyBucketData deep copies b's records by encoding and parsing them again, the same way they're saved and loaded
+func copyBucketData(b *bucket) (map[string]interface{}, error) {
+	var buf bytes.Buffer
+	b.mu.RLock()
+	err := encodeBucket(&buf, b)
+	b.mu.RUnlock()
+	if err != nil {
+		return nil, b.wrapErr(err)
+	}
+	var bucketBytes unmarshalBucket
+	if err := json.Unmarshal(buf.Bytes(), &bucketBytes); err != nil {
+		return nil, b.wrapErr(err)
+	}
+	data := make(map[string]interface{}, len(bucketBytes.Data))
+	for id, itemBytes := range bucketBytes.Data {
+		item, err := b.upgrader.Parse(bucketBytes.Version, id, itemBytes)
+		if err != nil {
+			return nil, b.wrapErr(err)
+		}
+		data[id] = item
+	}
+	return data, nil
+}
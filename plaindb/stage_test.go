@@ -0,0 +1,68 @@
+package plaindb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStage(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	db, err := Open(tmpDir)
+	require.NoError(t, err)
+	upgrader := &mockUpgrader{parser: intParser}
+	b, err := db.Bucket("numbers", "1", upgrader)
+	require.NoError(t, err)
+	require.NoError(t, b.Put("one", 1))
+	bucketPath := filepath.Join(tmpDir, "numbers.json")
+	original, err := ioutil.ReadFile(bucketPath)
+	require.NoError(t, err)
+
+	restore, err := db.Stage()
+	require.NoError(t, err)
+	_, err = db.Stage()
+	assert.EqualError(t, err, "DB is already staged")
+	require.NoError(t, b.Put("two", 2))
+	require.NoError(t, b.Put("one", nil))
+	other, err := db.Bucket("others", "1", upgrader)
+	require.NoError(t, err)
+	require.NoError(t, other.Put("three", 3))
+
+	onDisk, err := ioutil.ReadFile(bucketPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(onDisk), "Staged writes should not be saved")
+	files, err := db.Files()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		bucketPath:                           []byte("{\n    \"Version\": \"1\",\n    \"Data\": {\n        \"two\": 2\n    }\n}\n"),
+		filepath.Join(tmpDir, "others.json"): []byte("{\n    \"Version\": \"1\",\n    \"Data\": {\n        \"three\": 3\n    }\n}\n"),
+	}, files)
+
+	restore()
+	db.Unstage()
+	var value int
+	found, err := b.Get("one", &value)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+	found, err = b.Get("two", &value)
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, err = other.Get("three", &value)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	files, err = db.Files()
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	require.NoError(t, b.Put("two", 2))
+	onDisk, err = ioutil.ReadFile(bucketPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(onDisk), `"two": 2`, "Writes should be saved after unstaging")
+}
@@ -0,0 +1,250 @@
+// Package quarantine holds downloaded transactions out of the ledger until they're approved or discarded
+package quarantine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	batchesBucket        = "quarantine"
+	batchesBucketVersion = "1"
+	normsBucket          = "syncnorms"
+	normsBucketVersion   = "1"
+	failedBucket         = "failedtxns"
+	failedBucketVersion  = "1"
+
+	idRandomBytes = 4
+)
+
+// Batch is a set of an account's downloaded transactions, held out of the ledger
+type Batch struct {
+	ID          string
+	AccountID   string
+	Account     string
+	Description string
+	Time        time.Time
+	Reason      string
+	// Count is the number of new transactions in the batch, excluding any already in the ledger
+	Count int
+	// Amount is the total absolute amount of the new transactions
+	Amount       decimal.Decimal
+	Transactions []ledger.Transaction
+}
+
+// Failed is a transaction which failed validation, held out of the ledger until it's fixed and released or discarded
+type Failed struct {
+	ID          string
+	Time        time.Time
+	Reason      string
+	Transaction ledger.Transaction
+}
+
+// Norm is an account's typical number of new transactions and total absolute amount per sync
+type Norm struct {
+	Syncs  int
+	Count  float64
+	Amount decimal.Decimal
+}
+
+// Store persists held batches and each account's sync norms
+type Store struct {
+	mu      sync.Mutex
+	batches plaindb.Bucket
+	norms   plaindb.Bucket
+	failed  plaindb.Bucket
+}
+
+// NewStore returns the quarantine buckets
+func NewStore(db plaindb.DB) (*Store, error) {
+	batches, err := db.Bucket(batchesBucket, batchesBucketVersion, &storeUpgrader{parse: parseBatch})
+	if err != nil {
+		return nil, err
+	}
+	norms, err := db.Bucket(normsBucket, normsBucketVersion, &storeUpgrader{parse: parseNorm})
+	if err != nil {
+		return nil, err
+	}
+	failed, err := db.Bucket(failedBucket, failedBucketVersion, &storeUpgrader{parse: parseFailed})
+	return &Store{
+		batches: batches,
+		norms:   norms,
+		failed:  failed,
+	}, err
+}
+
+func newID(t time.Time) (string, error) {
+	suffix := make([]byte, idRandomBytes)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%s", t.UnixNano(), hex.EncodeToString(suffix)), nil
+}
+
+// Hold saves 'batch' with a new ID, which is returned
+func (s *Store) Hold(batch Batch) (Batch, error) {
+	id, err := newID(batch.Time)
+	if err != nil {
+		return Batch{}, err
+	}
+	batch.ID = id
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return batch, s.batches.Put(batch.ID, batch)
+}
+
+// Batches returns all held batches, oldest first
+func (s *Store) Batches() ([]Batch, error) {
+	batches := []Batch{}
+	var batch Batch
+	err := s.batches.Iter(&batch, func(id string) bool {
+		batches = append(batches, batch)
+		return true
+	})
+	sort.Slice(batches, func(a, b int) bool {
+		if batches[a].Time.Equal(batches[b].Time) {
+			return batches[a].ID < batches[b].ID
+		}
+		return batches[a].Time.Before(batches[b].Time)
+	})
+	return batches, err
+}
+
+// Remove deletes and returns the batch with ID 'id'
+func (s *Store) Remove(id string) (Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var batch Batch
+	found, err := s.batches.Get(id, &batch)
+	if err != nil {
+		return Batch{}, err
+	}
+	if !found {
+		return Batch{}, errors.Errorf("Quarantined batch not found by ID: %q", id)
+	}
+	return batch, s.batches.Put(id, nil)
+}
+
+// HoldFailed saves 'failed' with a new ID, which is returned
+func (s *Store) HoldFailed(failed Failed) (Failed, error) {
+	id, err := newID(failed.Time)
+	if err != nil {
+		return Failed{}, err
+	}
+	failed.ID = id
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return failed, s.failed.Put(failed.ID, failed)
+}
+
+// FailedTransactions returns all held failed transactions, oldest first
+func (s *Store) FailedTransactions() ([]Failed, error) {
+	failedTxns := []Failed{}
+	var failed Failed
+	err := s.failed.Iter(&failed, func(id string) bool {
+		failedTxns = append(failedTxns, failed)
+		return true
+	})
+	sort.Slice(failedTxns, func(a, b int) bool {
+		if failedTxns[a].Time.Equal(failedTxns[b].Time) {
+			return failedTxns[a].ID < failedTxns[b].ID
+		}
+		return failedTxns[a].Time.Before(failedTxns[b].Time)
+	})
+	return failedTxns, err
+}
+
+// GetFailed returns the failed transaction with ID 'id'
+func (s *Store) GetFailed(id string) (Failed, error) {
+	var failed Failed
+	found, err := s.failed.Get(id, &failed)
+	if err != nil {
+		return Failed{}, err
+	}
+	if !found {
+		return Failed{}, errors.Errorf("Quarantined transaction not found by ID: %q", id)
+	}
+	return failed, nil
+}
+
+// RemoveFailed deletes and returns the failed transaction with ID 'id'
+func (s *Store) RemoveFailed(id string) (Failed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed, err := s.GetFailed(id)
+	if err != nil {
+		return Failed{}, err
+	}
+	return failed, s.failed.Put(id, nil)
+}
+
+// Norm returns the sync norm for account 'accountID'. Returns a zero Norm if the account has never synced.
+func (s *Store) Norm(accountID string) (Norm, error) {
+	var norm Norm
+	_, err := s.norms.Get(accountID, &norm)
+	return norm, err
+}
+
+// UpdateNorm adds a sync of 'count' new transactions totaling 'amount' to the account's norm.
+// Averages over at most 'window' syncs, so the norm adapts to changes over time.
+func (s *Store) UpdateNorm(accountID string, count int, amount decimal.Decimal, window int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var norm Norm
+	if _, err := s.norms.Get(accountID, &norm); err != nil {
+		return err
+	}
+	weight := norm.Syncs
+	if weight >= window {
+		weight = window - 1
+	}
+	norm.Count = (norm.Count*float64(weight) + float64(count)) / float64(weight+1)
+	norm.Amount = norm.Amount.Mul(decimal.New(int64(weight), 0)).Add(amount).DivRound(decimal.New(int64(weight+1), 0), 2)
+	norm.Syncs++
+	return s.norms.Put(accountID, norm)
+}
+
+type storeUpgrader struct {
+	parse func(data json.RawMessage) (interface{}, error)
+}
+
+func parseBatch(data json.RawMessage) (interface{}, error) {
+	var batch Batch
+	err := json.Unmarshal(data, &batch)
+	return batch, err
+}
+
+func parseFailed(data json.RawMessage) (interface{}, error) {
+	var failed Failed
+	err := json.Unmarshal(data, &failed)
+	return failed, err
+}
+
+func parseNorm(data json.RawMessage) (interface{}, error) {
+	var norm Norm
+	err := json.Unmarshal(data, &norm)
+	return norm, err
+}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		return u.parse(data)
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
@@ -0,0 +1,96 @@
+package quarantine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore(plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}}))
+	require.NoError(t, err)
+	return store
+}
+
+func TestHoldRemove(t *testing.T) {
+	store := newTestStore(t)
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	txns := []ledger.Transaction{{Payee: "some payee"}}
+	second, err := store.Hold(Batch{AccountID: "2", Time: first.Add(time.Hour), Transactions: txns})
+	require.NoError(t, err)
+	held, err := store.Hold(Batch{AccountID: "1", Time: first, Count: 1})
+	require.NoError(t, err)
+	assert.NotEmpty(t, held.ID)
+
+	batches, err := store.Batches()
+	require.NoError(t, err)
+	assert.Equal(t, []Batch{held, second}, batches)
+
+	removed, err := store.Remove(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, txns, removed.Transactions)
+	_, err = store.Remove(second.ID)
+	assert.Error(t, err)
+
+	batches, err = store.Batches()
+	require.NoError(t, err)
+	assert.Equal(t, []Batch{held}, batches)
+}
+
+func TestUpdateNorm(t *testing.T) {
+	store := newTestStore(t)
+	norm, err := store.Norm("1")
+	require.NoError(t, err)
+	assert.Equal(t, Norm{}, norm)
+
+	require.NoError(t, store.UpdateNorm("1", 10, decimal.NewFromFloat(100), 2))
+	require.NoError(t, store.UpdateNorm("1", 20, decimal.NewFromFloat(300), 2))
+	norm, err = store.Norm("1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, norm.Syncs)
+	assert.Equal(t, 15.0, norm.Count)
+	assert.Equal(t, "200", norm.Amount.String())
+
+	require.NoError(t, store.UpdateNorm("1", 5, decimal.NewFromFloat(0), 2))
+	norm, err = store.Norm("1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, norm.Syncs)
+	assert.Equal(t, 10.0, norm.Count, "Norms should only average over the window")
+	assert.Equal(t, "100", norm.Amount.String())
+}
+
+func TestHoldRemoveFailed(t *testing.T) {
+	store := newTestStore(t)
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	second, err := store.HoldFailed(Failed{Time: first.Add(time.Hour), Reason: "some reason", Transaction: ledger.Transaction{Payee: "some payee"}})
+	require.NoError(t, err)
+	held, err := store.HoldFailed(Failed{Time: first})
+	require.NoError(t, err)
+	assert.NotEmpty(t, held.ID)
+
+	failed, err := store.FailedTransactions()
+	require.NoError(t, err)
+	assert.Equal(t, []Failed{held, second}, failed)
+
+	got, err := store.GetFailed(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, second, got)
+
+	removed, err := store.RemoveFailed(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "some payee", removed.Transaction.Payee)
+	_, err = store.RemoveFailed(second.ID)
+	assert.Error(t, err)
+
+	failed, err = store.FailedTransactions()
+	require.NoError(t, err)
+	assert.Equal(t, []Failed{held}, failed)
+}
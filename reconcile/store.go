@@ -0,0 +1,95 @@
+// Package reconcile tracks in-progress reconciliation sessions, where an account's transactions are cleared against a statement
+package reconcile
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	sessionsBucket        = "reconcile"
+	sessionsBucketVersion = "1"
+)
+
+// Session is an in-progress reconciliation of an account against a statement's ending balance and date
+type Session struct {
+	Account string
+	Date    time.Time
+	Balance decimal.Decimal
+	Started time.Time
+}
+
+// Validate returns an error if the session is missing any fields
+func (s Session) Validate() error {
+	switch {
+	case strings.TrimSpace(s.Account) == "":
+		return errors.New("Account must not be empty")
+	case s.Date.IsZero():
+		return errors.New("Statement date must be set")
+	default:
+		return nil
+	}
+}
+
+// Store persists reconciliation sessions, one per account
+type Store struct {
+	mu     sync.Mutex
+	bucket plaindb.Bucket
+}
+
+// NewStore returns the reconciliation sessions bucket
+func NewStore(db plaindb.DB) (*Store, error) {
+	bucket, err := db.Bucket(sessionsBucket, sessionsBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket: bucket,
+	}, err
+}
+
+// Start begins a session, replacing any existing session for the same account
+func (s *Store) Start(session Session) error {
+	if err := session.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bucket.Put(session.Account, session)
+}
+
+// Get returns the account's session, if one is in progress
+func (s *Store) Get(account string) (Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var session Session
+	found, err := s.bucket.Get(account, &session)
+	return session, found, err
+}
+
+// End removes the account's session
+func (s *Store) End(account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bucket.Put(account, nil)
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var session Session
+		err := json.Unmarshal(data, &session)
+		return session, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
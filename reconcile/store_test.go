@@ -0,0 +1,40 @@
+package reconcile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	store, err := NewStore(db)
+	require.NoError(t, err)
+
+	_, found, err := store.Get("assets:Bank")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	assert.Error(t, store.Start(Session{Account: "assets:Bank"}), "Statement date is required")
+	session := Session{
+		Account: "assets:Bank",
+		Date:    time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+		Balance: decimal.New(1234, -2),
+	}
+	require.NoError(t, store.Start(session))
+	stored, found, err := store.Get("assets:Bank")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, session, stored)
+
+	require.NoError(t, store.End("assets:Bank"))
+	_, found, err = store.Get("assets:Bank")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
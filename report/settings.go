@@ -0,0 +1,18 @@
+// Package report contains the default settings for reports
+package report
+
+import (
+	"github.com/johnstarich/sage/ledger"
+)
+
+// Settings are the defaults for reports, used when a request doesn't override them
+type Settings struct {
+	// DateBasis chooses which transaction date groups transactions into months
+	DateBasis ledger.DateBasis
+}
+
+// Validate returns an error if any setting is invalid
+func (s Settings) Validate() error {
+	_, err := ledger.ParseDateBasis(string(s.DateBasis))
+	return err
+}
@@ -0,0 +1,15 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Settings{DateBasis: ledger.PostingBasis}.Validate())
+	assert.NoError(t, Settings{DateBasis: ledger.EffectiveBasis}.Validate())
+	assert.Error(t, Settings{DateBasis: "accrual"}.Validate())
+	assert.Error(t, Settings{}.Validate())
+}
@@ -0,0 +1,74 @@
+// Package reported stores the latest balance each institution reported for its accounts, separately from the ledger
+package reported
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	balancesBucket        = "reported_balances"
+	balancesBucketVersion = "1"
+)
+
+// Balance is an account's balance as reported by its institution
+type Balance struct {
+	Amount   decimal.Decimal
+	Currency string `json:",omitempty"`
+	// AsOf is when the institution last updated the balance
+	AsOf time.Time
+	// Fetched is when Sage received the balance
+	Fetched time.Time
+}
+
+// Store persists the latest reported balance for each account ID
+type Store struct {
+	mu     sync.Mutex
+	bucket plaindb.Bucket
+}
+
+// NewStore returns the reported balances bucket
+func NewStore(db plaindb.DB) (*Store, error) {
+	bucket, err := db.Bucket(balancesBucket, balancesBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket: bucket,
+	}, err
+}
+
+// Put replaces the reported balance for account 'id'
+func (s *Store) Put(id string, balance Balance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bucket.Put(id, balance)
+}
+
+// Get returns the latest reported balance for account 'id', if any
+func (s *Store) Get(id string) (Balance, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var balance Balance
+	found, err := s.bucket.Get(id, &balance)
+	return balance, found, err
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var balance Balance
+		err := json.Unmarshal(data, &balance)
+		return balance, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
@@ -0,0 +1,138 @@
+package rules
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+)
+
+const categoryCodePrefix = "# category code "
+
+// CategoryCodes maps SIC/MCC codes to categories (account2)
+type CategoryCodes map[string]string
+
+// DefaultCategoryCodes maps common merchant category codes to default categories
+var DefaultCategoryCodes = CategoryCodes{
+	"4111": "expenses:travel:transit",
+	"4121": "expenses:travel:transit",
+	"4131": "expenses:travel:transit",
+	"4511": "expenses:travel:airlines",
+	"4722": "expenses:travel",
+	"4814": "expenses:home:utilities",
+	"4899": "expenses:home:utilities",
+	"4900": "expenses:home:utilities",
+	"5200": "expenses:home",
+	"5251": "expenses:home",
+	"5311": "expenses:shopping",
+	"5399": "expenses:shopping",
+	"5411": "expenses:shopping:food:groceries",
+	"5422": "expenses:shopping:food:groceries",
+	"5441": "expenses:shopping:food:groceries",
+	"5451": "expenses:shopping:food:groceries",
+	"5499": "expenses:shopping:food:groceries",
+	"5541": "expenses:car:gas",
+	"5542": "expenses:car:gas",
+	"5651": "expenses:shopping:clothing",
+	"5691": "expenses:shopping:clothing",
+	"5732": "expenses:shopping:electronics",
+	"5812": "expenses:shopping:food:restaurants",
+	"5813": "expenses:shopping:food:restaurants",
+	"5814": "expenses:shopping:food:restaurants",
+	"5912": "expenses:health",
+	"5942": "expenses:shopping",
+	"7011": "expenses:travel:lodging",
+	"7512": "expenses:travel:car rental",
+	"7523": "expenses:car:parking",
+	"7832": "expenses:entertainment",
+	"8011": "expenses:health",
+	"8021": "expenses:health",
+	"8062": "expenses:health",
+	"8099": "expenses:health",
+}
+
+// airlineCodes is the range of MCCs assigned to individual airlines
+const (
+	airlineCodesStart = 3000
+	airlineCodesEnd   = 3299
+)
+
+// CategoryCode returns the SIC/MCC code attached to txn, if any
+func CategoryCode(txn ledger.Transaction) string {
+	if len(txn.Postings) == 0 {
+		return ""
+	}
+	return txn.Postings[0].Tags[model.CategoryCodeTag]
+}
+
+// Category returns the category for 'code', preferring entries in c over the default mapping
+func (c CategoryCodes) Category(code string) string {
+	if code == "" {
+		return ""
+	}
+	if category, ok := c[code]; ok {
+		return category
+	}
+	if category, ok := DefaultCategoryCodes[code]; ok {
+		return category
+	}
+	if num, err := strconv.Atoi(code); err == nil && num >= airlineCodesStart && num <= airlineCodesEnd {
+		return DefaultCategoryCodes["4511"]
+	}
+	return ""
+}
+
+// Apply categorizes txn by its SIC/MCC code. Returns true if a category was applied.
+func (c CategoryCodes) Apply(txn *ledger.Transaction) bool {
+	if len(txn.Postings) != 2 {
+		return false
+	}
+	category := c.Category(CategoryCode(*txn))
+	if category == "" {
+		return false
+	}
+	txn.Postings[1].Account = category
+	return true
+}
+
+// String formats c as comment lines, which hledger ignores
+func (c CategoryCodes) String() string {
+	codes := make([]string, 0, len(c))
+	for code := range c {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	var buf strings.Builder
+	for _, code := range codes {
+		buf.WriteString(categoryCodePrefix)
+		buf.WriteString(code)
+		buf.WriteRune(' ')
+		buf.WriteString(c[code])
+		buf.WriteRune('\n')
+	}
+	return buf.String()
+}
+
+// Validate returns an error if any code or category is malformed
+func (c CategoryCodes) Validate() error {
+	for code, category := range c {
+		if code == "" || strings.ContainsAny(code, " \t\n") {
+			return errors.Errorf("Invalid category code: %q", code)
+		}
+		if strings.TrimSpace(category) == "" || strings.Contains(category, "\n") {
+			return errors.Errorf("Invalid category for code %s: %q", code, category)
+		}
+	}
+	return nil
+}
+
+func parseCategoryCode(line string) (code, category string, err error) {
+	tokens := strings.SplitN(strings.TrimPrefix(line, categoryCodePrefix), " ", 2)
+	if len(tokens) != 2 || strings.TrimSpace(tokens[1]) == "" {
+		return "", "", errors.Errorf("Category code line must have both code and category: '%s'", line)
+	}
+	return tokens[0], ledger.NormalizeAccountName(tokens[1]), nil
+}
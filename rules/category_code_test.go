@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func codeTxn(payee, code string) ledger.Transaction {
+	var tags map[string]string
+	if code != "" {
+		tags = map[string]string{"sic": code}
+	}
+	return ledger.Transaction{
+		Payee: payee,
+		Postings: []ledger.Posting{
+			{Account: "assets:Some Bank", Tags: tags},
+			{Account: "uncategorized"},
+		},
+	}
+}
+
+func TestCategoryCodesCategory(t *testing.T) {
+	codes := CategoryCodes{"5411": "expenses:costco"}
+	assert.Equal(t, "expenses:costco", codes.Category("5411"))
+	assert.Equal(t, "expenses:car:gas", codes.Category("5541"))
+	assert.Equal(t, "expenses:travel:airlines", codes.Category("3001"), "Airline codes should map to airlines")
+	assert.Empty(t, codes.Category("1234"))
+	assert.Empty(t, codes.Category(""))
+}
+
+func TestStoreApplyAllCategoryCodes(t *testing.T) {
+	rule, err := NewCSVRule("", "expenses:burgers", "", "Hank's burgers")
+	require.NoError(t, err)
+	store := NewStore(Rules{rule})
+	txns := []ledger.Transaction{
+		codeTxn("Hank's burgers", "5411"),
+		codeTxn("Corner market", "5411"),
+		codeTxn("coffee", "5541"),
+		codeTxn("Corner market", ""),
+		codeTxn("Corner market", "1234"),
+	}
+	store.ApplyAll(txns)
+	assert.Equal(t, "expenses:burgers", txns[0].Postings[1].Account, "Custom rules take precedence")
+	assert.Equal(t, "expenses:shopping:food:groceries", txns[1].Postings[1].Account)
+	assert.Equal(t, "expenses:car:gas", txns[2].Postings[1].Account, "Category codes take precedence to default rules")
+	assert.Equal(t, "uncategorized", txns[3].Postings[1].Account)
+	assert.Equal(t, "uncategorized", txns[4].Postings[1].Account)
+
+	require.NoError(t, store.SetCategoryCodes(CategoryCodes{"5411": "expenses:warehouse"}))
+	txns = []ledger.Transaction{codeTxn("Corner market", "5411")}
+	store.ApplyAll(txns)
+	assert.Equal(t, "expenses:warehouse", txns[0].Postings[1].Account)
+
+	assert.Equal(t, "5411", store.ClassifiedBy(codeTxn("Corner market", "5411")))
+	assert.Empty(t, store.ClassifiedBy(codeTxn("Hank's burgers", "5411")))
+	assert.Empty(t, store.ClassifiedBy(codeTxn("Corner market", "")))
+
+	assert.Error(t, store.SetCategoryCodes(CategoryCodes{"54 11": "expenses:warehouse"}))
+}
+
+func TestCategoryCodesRoundTrip(t *testing.T) {
+	rule, err := NewCSVRule("", "expenses:burgers", "", "Hank's burgers")
+	require.NoError(t, err)
+	store := NewStore(Rules{rule})
+	require.NoError(t, store.SetCategoryCodes(CategoryCodes{"5812": "expenses:dining out", "5411": "expenses:warehouse"}))
+	assert.Equal(t, `if
+Hank's burgers
+  account2 expenses:burgers
+
+# category code 5411 expenses:warehouse
+# category code 5812 expenses:dining out
+`, store.String())
+
+	rules, codes, _, err := NewCSVRulesFileFromReader(strings.NewReader(store.String() + "; some comment\n"))
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, CategoryCodes{"5812": "expenses:dining out", "5411": "expenses:warehouse"}, codes)
+
+	_, _, _, err = NewCSVRulesFileFromReader(strings.NewReader("# category code 5411\n"))
+	assert.Error(t, err)
+}
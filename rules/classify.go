@@ -0,0 +1,245 @@
+package rules
+
+import (
+	"strings"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+)
+
+// Classifier stages, each able to categorize a transaction. A matching stage takes precedence to every stage after it.
+const (
+	StageRules         = "rules"
+	StageTemplates     = "templates"
+	StagePayees        = "payees"
+	StageCategoryCodes = "codes"
+	StageTransfers     = "transfers"
+	StageDefaults      = "defaults"
+	StageFees          = "fees"
+)
+
+// transferCategory is the parent category of the default rules' transfer categories
+const transferCategory = "expenses:transfers"
+
+// DefaultPrecedence is the classifier stage order used when none is configured
+var DefaultPrecedence = []string{
+	StageRules,
+	StageTemplates,
+	StagePayees,
+	StageCategoryCodes,
+	StageTransfers,
+	StageDefaults,
+	StageFees,
+}
+
+// StageResult is a single classifier stage's outcome for a transaction
+type StageResult struct {
+	Stage   string
+	Matched bool
+	// Categories are the accounts of every posting after the first once the stage applied, if it matched
+	Categories []string `json:",omitempty"`
+}
+
+// Classification describes how a transaction was categorized
+type Classification struct {
+	// Stage is the matching stage with the highest precedence, or empty if only the catch-all categories applied
+	Stage string
+	// Stages are every stage's result, in precedence order
+	Stages []StageResult
+}
+
+// Disagreement returns true if more than one stage matched and they chose different categories
+func (c Classification) Disagreement() bool {
+	var first []string
+	matched := false
+	for _, result := range c.Stages {
+		if !result.Matched {
+			continue
+		}
+		if !matched {
+			first, matched = result.Categories, true
+		} else if strings.Join(first, "\n") != strings.Join(result.Categories, "\n") {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizePrecedence validates 'precedence' and returns a complete stage order.
+// Stages missing from 'precedence' are appended in their DefaultPrecedence order. An empty precedence returns DefaultPrecedence.
+func NormalizePrecedence(precedence []string) ([]string, error) {
+	known := make(map[string]bool, len(DefaultPrecedence))
+	for _, stage := range DefaultPrecedence {
+		known[stage] = true
+	}
+	normalized := make([]string, 0, len(DefaultPrecedence))
+	seen := make(map[string]bool, len(precedence))
+	for _, stage := range precedence {
+		stage = strings.ToLower(strings.TrimSpace(stage))
+		if !known[stage] {
+			return nil, errors.Errorf("Unrecognized classifier stage %q, must be one of: %s", stage, strings.Join(DefaultPrecedence, ", "))
+		}
+		if seen[stage] {
+			return nil, errors.Errorf("Classifier stage must not be repeated: %q", stage)
+		}
+		seen[stage] = true
+		normalized = append(normalized, stage)
+	}
+	for _, stage := range DefaultPrecedence {
+		if !seen[stage] {
+			normalized = append(normalized, stage)
+		}
+	}
+	return normalized, nil
+}
+
+// SetPrecedence sets the classifier stage order for future classifications. An empty precedence restores DefaultPrecedence.
+func (s *Store) SetPrecedence(precedence []string) error {
+	normalized, err := NormalizePrecedence(precedence)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.precedence = normalized
+	return nil
+}
+
+// Precedence returns the classifier stage order, highest precedence first
+func (s *Store) Precedence() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stages()
+}
+
+// stages is Precedence, but must be called with the lock held
+func (s *Store) stages() []string {
+	if len(s.precedence) == 0 {
+		return append([]string(nil), DefaultPrecedence...)
+	}
+	return append([]string(nil), s.precedence...)
+}
+
+// splitDefaultRules separates the default catch-all rules from the payee pattern rules, and the transfer pattern rules from the rest
+func splitDefaultRules() (catchAll, transfers, defaults Rules) {
+	for _, rule := range Default {
+		c, ok := rule.(category)
+		switch {
+		case ok && c.PayeeContains == nil:
+			catchAll = append(catchAll, rule)
+		case ok && (c.Category == transferCategory || strings.HasPrefix(c.Category, transferCategory+":")):
+			transfers = append(transfers, rule)
+		default:
+			defaults = append(defaults, rule)
+		}
+	}
+	return
+}
+
+// Classify categorizes txns like ApplyAll and returns how each was categorized.
+// Starting from the catch-all categories, stages are applied from lowest to highest precedence, so the highest precedence matching stage decides the category.
+// Withdrawals routed into the cash wallet account are transfers, so they are left unchanged.
+func (s *Store) Classify(txns []ledger.Transaction) []Classification {
+	catchAll, transfers, defaults := splitDefaultRules()
+	for i := range txns {
+		if !isCashWithdrawal(txns[i]) {
+			catchAll.Apply(&txns[i])
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	precedence := s.stages()
+	isFee := s.feeRule.Matcher()
+	applyPatterns := func(patterns Rules) func(txn *ledger.Transaction) bool {
+		return func(txn *ledger.Transaction) bool {
+			if len(txn.Postings) != 2 || len(patterns.Matches(txn)) == 0 {
+				return false
+			}
+			patterns.Apply(txn)
+			return true
+		}
+	}
+	apply := map[string]func(txn *ledger.Transaction) bool{
+		StageRules: func(txn *ledger.Transaction) bool {
+			if len(s.rules.Matches(txn)) == 0 {
+				return false
+			}
+			s.rules.Apply(txn)
+			return true
+		},
+		StageTemplates: func(txn *ledger.Transaction) bool {
+			template := s.templates.Match(*txn)
+			if template == nil {
+				return false
+			}
+			template.Apply(txn)
+			return true
+		},
+		StagePayees:        s.payees.Apply,
+		StageCategoryCodes: s.codes.Apply,
+		StageTransfers:     applyPatterns(transfers),
+		StageDefaults:      applyPatterns(defaults),
+		StageFees: func(txn *ledger.Transaction) bool {
+			// fees are charges, refunded fees are left to the other stages
+			if isFee == nil || len(txn.Postings) != 2 || !txn.Postings[0].Amount.IsNegative() || !isFee(*txn) {
+				return false
+			}
+			txn.Postings[1].Account = s.feeRule.Category
+			return true
+		},
+	}
+
+	classifications := make([]Classification, len(txns))
+	for i := range txns {
+		txn := &txns[i]
+		if isCashWithdrawal(*txn) {
+			continue
+		}
+		if s.defaultCategory != "" && len(txn.Postings) == 2 && txn.Postings[1].Account == UncategorizedExpense {
+			txn.Postings[1].Account = s.defaultCategory
+		}
+		baseline := copyTransaction(*txn)
+		results := make([]StageResult, len(precedence))
+		for ix := len(precedence) - 1; ix >= 0; ix-- {
+			stage := precedence[ix]
+			results[ix].Stage = stage
+			applied := copyTransaction(*txn)
+			if len(txn.Postings) != len(baseline.Postings) {
+				// a lower precedence stage split txn, so start over from the catch-all categories
+				applied = copyTransaction(baseline)
+			}
+			if !apply[stage](&applied) {
+				continue
+			}
+			*txn = applied
+			results[ix].Matched = true
+			results[ix].Categories = categories(*txn)
+		}
+		classifications[i].Stages = results
+		for _, result := range results {
+			if result.Matched {
+				classifications[i].Stage = result.Stage
+				break
+			}
+		}
+	}
+	return classifications
+}
+
+// isCashWithdrawal returns true if txn is a withdrawal routed into the cash wallet account, which is a transfer and never categorized
+func isCashWithdrawal(txn ledger.Transaction) bool {
+	return len(txn.Postings) == 2 && ledger.IsCashAccount(txn.Postings[1].Account)
+}
+
+// copyTransaction returns a copy of txn which stages can modify without changing txn
+func copyTransaction(txn ledger.Transaction) ledger.Transaction {
+	txn.Postings = append([]ledger.Posting(nil), txn.Postings...)
+	if txn.Tags != nil {
+		tags := make(map[string]string, len(txn.Tags))
+		for key, value := range txn.Tags {
+			tags[key] = value
+		}
+		txn.Tags = tags
+	}
+	return txn
+}
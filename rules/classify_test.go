@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func classifyTxn(payee string, amount float64) ledger.Transaction {
+	return ledger.Transaction{
+		Payee: payee,
+		Postings: []ledger.Posting{
+			{Account: "assets:Some Bank", Amount: decimal.NewFromFloat(amount)},
+			{Account: "uncategorized", Amount: decimal.NewFromFloat(-amount)},
+		},
+	}
+}
+
+func TestNormalizePrecedence(t *testing.T) {
+	precedence, err := NormalizePrecedence(nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPrecedence, precedence)
+
+	precedence, err = NormalizePrecedence([]string{" Transfers", "fees"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{StageTransfers, StageFees, StageRules, StageTemplates, StagePayees, StageCategoryCodes, StageDefaults}, precedence)
+
+	_, err = NormalizePrecedence([]string{"refunds"})
+	assert.Error(t, err)
+	_, err = NormalizePrecedence([]string{StageRules, StageRules})
+	assert.Error(t, err)
+}
+
+func TestClassifyPrecedence(t *testing.T) {
+	rule, err := NewCSVRule("", "expenses:meals", "", "hank's burgers")
+	require.NoError(t, err)
+	store := NewStore(Rules{rule})
+	newTxns := func() []ledger.Transaction {
+		txns := []ledger.Transaction{classifyTxn("Hank's burgers", -10), classifyTxn("some unknown payee", -10)}
+		txns[0].Postings[0].Tags = map[string]string{model.CategoryCodeTag: "4511"}
+		return txns
+	}
+
+	txns := newTxns()
+	classifications := store.Classify(txns)
+	assert.Equal(t, "expenses:meals", txns[0].Postings[1].Account)
+	assert.Equal(t, StageRules, classifications[0].Stage)
+	assert.True(t, classifications[0].Disagreement(), "Rules, codes, and defaults chose different categories")
+	assert.Equal(t, []StageResult{
+		{Stage: StageRules, Matched: true, Categories: []string{"expenses:meals"}},
+		{Stage: StageTemplates},
+		{Stage: StagePayees},
+		{Stage: StageCategoryCodes, Matched: true, Categories: []string{"expenses:travel:airlines"}},
+		{Stage: StageTransfers},
+		{Stage: StageDefaults, Matched: true, Categories: []string{"expenses:shopping:food:restaurants"}},
+		{Stage: StageFees},
+	}, classifications[0].Stages)
+	assert.Equal(t, UncategorizedExpense, txns[1].Postings[1].Account)
+	assert.Empty(t, classifications[1].Stage)
+	assert.False(t, classifications[1].Disagreement())
+
+	require.NoError(t, store.SetPrecedence([]string{StageCategoryCodes}))
+	txns = newTxns()
+	classifications = store.Classify(txns)
+	assert.Equal(t, "expenses:travel:airlines", txns[0].Postings[1].Account)
+	assert.Equal(t, StageCategoryCodes, classifications[0].Stage)
+	assert.Equal(t, StageCategoryCodes, classifications[0].Stages[0].Stage)
+
+	assert.Error(t, store.SetPrecedence([]string{"trntype"}))
+	assert.Equal(t, StageCategoryCodes, store.Precedence()[0], "Invalid precedence should not change the current order")
+}
+
+func TestClassifyFees(t *testing.T) {
+	store := NewStore(nil)
+	store.SetFeeRule(ledger.FeeRule{Payee: "foreign transaction fee", Category: "expenses:fees", MaxAmount: decimal.NewFromFloat(5), Days: 3})
+	store.SetDefaultCategory("expenses:review")
+
+	txns := []ledger.Transaction{
+		classifyTxn("Foreign transaction fee", -1),
+		classifyTxn("Foreign transaction fee refund", 1),
+		classifyTxn("some unknown payee", -1),
+	}
+	classifications := store.Classify(txns)
+	assert.Equal(t, "expenses:fees", txns[0].Postings[1].Account)
+	assert.Equal(t, StageFees, classifications[0].Stage)
+	assert.Equal(t, "revenues:uncategorized", txns[1].Postings[1].Account, "Refunded fees should not be categorized as fees")
+	assert.Equal(t, "expenses:review", txns[2].Postings[1].Account)
+}
+
+func TestClassifySkipsCashWithdrawals(t *testing.T) {
+	rule, err := NewCSVRule("", "expenses:Cash", "", "atm")
+	require.NoError(t, err)
+	store := NewStore(Rules{rule})
+	txns := []ledger.Transaction{classifyTxn("ATM withdrawal", -40), classifyTxn("ATM withdrawal", -40)}
+	txns[0].Postings[1].Account = ledger.CashAccount
+
+	classifications := store.Classify(txns)
+	assert.Equal(t, ledger.CashAccount, txns[0].Postings[1].Account, "Withdrawals routed to the cash wallet should not be categorized")
+	assert.Empty(t, classifications[0].Stage)
+	assert.Equal(t, "expenses:Cash", txns[1].Postings[1].Account)
+}
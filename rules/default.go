@@ -7,10 +7,13 @@ import (
 	"github.com/johnstarich/sage/ledger"
 )
 
+// UncategorizedExpense is the default rules' category for outgoing transactions
+const UncategorizedExpense = "expenses:uncategorized"
+
 var (
 	// Default is the set of rules applied to incoming transaction, always
 	Default = Rules{
-		category{Negative: true, Category: "expenses:uncategorized"},
+		category{Negative: true, Category: UncategorizedExpense},
 		category{
 			PayeeContains: containsPattern(
 				"'s",
@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"sort"
+
+	"github.com/johnstarich/sage/ledger"
+)
+
+// Evaluation is the result of categorizing a single transaction
+type Evaluation struct {
+	// Transaction is the categorized transaction
+	Transaction ledger.Transaction
+	// Categories are the accounts of every posting after the first
+	Categories []string
+	// Rules are the indexes of the matching rules, in the order they were applied
+	Rules []int
+	// MatchedRule is the index of the last matching rule, which takes precedence to any earlier ones. Nil if no rules matched.
+	MatchedRule *int
+	// ClassifiedBy is the category code used to categorize the transaction, if any
+	ClassifiedBy string
+	// SplitTemplate is the name of the split template which split the transaction, if any
+	SplitTemplate string `json:",omitempty"`
+	// Stage is the classifier stage which decided the category, see Classification
+	Stage string
+	// Stages are every classifier stage's result, in precedence order
+	Stages []StageResult
+	// Disagreement is true if matching stages chose different categories
+	Disagreement bool
+}
+
+// Evaluate categorizes a copy of txn the same way ApplyAll would, without modifying txn or any stored state. Assumes txn is valid.
+func (s *Store) Evaluate(txn ledger.Transaction) Evaluation {
+	txns := []ledger.Transaction{copyTransaction(txn)}
+	classifications := s.Classify(txns)
+
+	evaluation := Evaluation{
+		Transaction:   txns[0],
+		Categories:    categories(txns[0]),
+		Rules:         []int{},
+		ClassifiedBy:  s.ClassifiedBy(txn),
+		SplitTemplate: s.SplitTemplate(txn),
+		Stage:         classifications[0].Stage,
+		Stages:        classifications[0].Stages,
+		Disagreement:  classifications[0].Disagreement(),
+	}
+	for ix := range s.Matches(&txn) {
+		evaluation.Rules = append(evaluation.Rules, ix)
+	}
+	sort.Ints(evaluation.Rules)
+	if len(evaluation.Rules) > 0 {
+		matched := evaluation.Rules[len(evaluation.Rules)-1]
+		evaluation.MatchedRule = &matched
+	}
+	return evaluation
+}
@@ -0,0 +1,42 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	food, err := NewCSVRule("", "expenses:food", "", "Hank's")
+	require.NoError(t, err)
+	burgers, err := NewCSVRule("", "expenses:food:burgers", "", "burgers")
+	require.NoError(t, err)
+	coffee, err := NewCSVRule("", "expenses:coffee", "", "coffee")
+	require.NoError(t, err)
+	store := NewStore(Rules{food, burgers, coffee})
+
+	txn := ledger.Transaction{
+		Payee: "Hank's burgers",
+		Postings: []ledger.Posting{
+			{Account: "assets:bank", Amount: decimal.NewFromFloat(-10), Currency: "$"},
+			{Account: "expenses:uncategorized", Amount: decimal.NewFromFloat(10), Currency: "$"},
+		},
+		Tags: map[string]string{"id": "1"},
+	}
+	evaluation := store.Evaluate(txn)
+	assert.Equal(t, []string{"expenses:food:burgers"}, evaluation.Categories)
+	assert.Equal(t, []int{0, 1}, evaluation.Rules)
+	require.NotNil(t, evaluation.MatchedRule)
+	assert.Equal(t, 1, *evaluation.MatchedRule, "The last matching rule should take precedence")
+	assert.Equal(t, "expenses:food:burgers", evaluation.Transaction.Postings[1].Account)
+	assert.Equal(t, "expenses:uncategorized", txn.Postings[1].Account, "Evaluate must not modify the transaction")
+
+	txn.Payee = "somewhere else"
+	evaluation = store.Evaluate(txn)
+	assert.Empty(t, evaluation.Rules)
+	assert.Nil(t, evaluation.MatchedRule)
+	assert.Equal(t, []string{"expenses:uncategorized"}, evaluation.Categories)
+}
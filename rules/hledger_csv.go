@@ -3,6 +3,7 @@ package rules
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
 	"regexp"
 	"strconv"
@@ -18,26 +19,74 @@ type csvRule struct {
 
 	account1, Account2 string
 	comment            string
+	// Splits replace Account2 with multiple balancing postings
+	Splits []Split `json:",omitempty"`
+	// Amortize spreads matching transactions over this many months in reports, 0 disables amortization
+	Amortize int `json:",omitempty"`
 }
 
+// amortizePrefix stores a rule's amortization as a comment, since hledger has no equivalent field
+const amortizePrefix = "# amortize "
+
 func NewCSVRule(account1, account2, comment string, conditions ...string) (Rule, error) {
+	return newCSVRule(account1, account2, comment, nil, conditions)
+}
+
+// NewCSVSplitRule creates a rule which splits a transaction's balancing posting across multiple accounts
+func NewCSVSplitRule(account1, comment string, splits []Split, conditions ...string) (Rule, error) {
+	if len(splits) == 0 {
+		return nil, errors.New("Invalid split rule: At least 2 split accounts are required")
+	}
+	return newCSVRule(account1, "", comment, splits, conditions)
+}
+
+func newCSVRule(account1, account2, comment string, splits []Split, conditions []string) (Rule, error) {
 	conditions, pattern, err := validateConditions(conditions)
 	if err != nil {
 		return csvRule{}, err
 	}
+	splits, err = validateSplits(splits)
+	if err != nil {
+		return nil, err
+	}
 	rule := csvRule{
 		Conditions: conditions,
 		matchLine:  pattern,
-		account1:   strings.TrimSpace(account1),
-		Account2:   strings.TrimSpace(account2),
+		account1:   ledger.NormalizeAccountName(account1),
+		Account2:   ledger.NormalizeAccountName(account2),
 		comment:    strings.TrimSpace(comment),
+		Splits:     splits,
+	}
+	if len(rule.Splits) > 0 && rule.Account2 != "" {
+		return nil, errors.New("Invalid rule: Split rules must set account2 as the first split")
 	}
-	if rule.account1 == "" && rule.Account2 == "" && rule.comment == "" {
+	if rule.account1 == "" && rule.Account2 == "" && rule.comment == "" && len(rule.Splits) == 0 {
 		return nil, errors.New("Invalid rule: No category selected")
 	}
 	return rule, nil
 }
 
+// AmortizeRule returns a copy of 'rule' which tags matching transactions to amortize over 'months' in reports. 0 disables amortization.
+func AmortizeRule(rule Rule, months int) (Rule, error) {
+	csv, ok := rule.(csvRule)
+	if !ok {
+		return nil, errors.Errorf("Rule does not support amortization: %T", rule)
+	}
+	if err := validateAmortize(months); err != nil {
+		return nil, err
+	}
+	csv.Amortize = months
+	return csv, nil
+}
+
+func validateAmortize(months int) error {
+	if months == 0 {
+		return nil
+	}
+	_, err := ledger.ParseAmortization(strconv.Itoa(months))
+	return err
+}
+
 func validateConditions(conditions []string) (cleanedConditions []string, re *regexp.Regexp, err error) {
 	cleanedConditions = make([]string, 0, len(conditions))
 	for _, c := range conditions {
@@ -51,6 +100,14 @@ func validateConditions(conditions []string) (cleanedConditions []string, re *re
 		return nil, pattern, nil
 	}
 	pattern, err := regexp.Compile("(?i)" + strings.Join(cleanedConditions, "|"))
+	if err != nil {
+		// find the condition at fault, so callers can point to it
+		for i, c := range cleanedConditions {
+			if _, condErr := regexp.Compile(c); condErr != nil {
+				return cleanedConditions, pattern, ConditionError{Condition: i, Err: condErr}
+			}
+		}
+	}
 	return cleanedConditions, pattern, err
 }
 
@@ -70,8 +127,16 @@ func ledgerMatchLine(txn ledger.Transaction) string {
 	}, ",")
 }
 
+// Match returns true if the rule matches txn's payee, or its raw payee if a merchant name replaced it
 func (c csvRule) Match(txn ledger.Transaction) bool {
-	return c.matchLine.MatchString(ledgerMatchLine(txn))
+	if c.matchLine.MatchString(ledgerMatchLine(txn)) {
+		return true
+	}
+	if rawPayee := txn.RawPayee(); rawPayee != "" {
+		txn.Payee = rawPayee
+		return c.matchLine.MatchString(ledgerMatchLine(txn))
+	}
+	return false
 }
 
 func (c csvRule) Apply(txn *ledger.Transaction) {
@@ -85,6 +150,15 @@ func (c csvRule) Apply(txn *ledger.Transaction) {
 		comment := strings.Replace(c.comment, "%comment", txn.Postings[0].Comment, -1)
 		txn.Postings[0].Comment = comment
 	}
+	if len(c.Splits) > 0 {
+		c.applySplits(txn)
+	}
+	if c.Amortize > 0 {
+		if txn.Tags == nil {
+			txn.Tags = make(map[string]string)
+		}
+		txn.Tags[ledger.AmortizeTag] = fmt.Sprintf("%d months", c.Amortize)
+	}
 }
 
 type csvRuleJSON csvRule
@@ -98,7 +172,14 @@ func (c *csvRule) UnmarshalJSON(data []byte) error {
 	conditions, pattern, err := validateConditions(c.Conditions)
 	c.Conditions = conditions
 	c.matchLine = pattern
-	return err
+	if err != nil {
+		return err
+	}
+	c.Splits, err = validateSplits(c.Splits)
+	if err != nil {
+		return err
+	}
+	return validateAmortize(c.Amortize)
 }
 
 func (c csvRule) String() string {
@@ -126,7 +207,15 @@ func (c csvRule) String() string {
 	}
 	indent("account1", c.account1)
 	indent("account2", c.Account2)
+	for i, split := range c.Splits {
+		index := strconv.Itoa(firstSplitIndex + i)
+		indent("account"+index, split.Account)
+		indent("amount"+index, split.formatAmount())
+	}
 	indent("comment", c.comment)
+	if c.Amortize > 0 {
+		buf.WriteString(amortizePrefix + strconv.Itoa(c.Amortize) + " months\n")
+	}
 
 	return buf.String()
 }
@@ -136,11 +225,23 @@ type readerState struct {
 	foundExpressions   bool
 	account1, account2 string
 	comment            string
+	amortize           int
 	conditions         []string
+	splitAccounts      map[int]string
+	splitAmounts       map[int]string
 }
 
+// NewCSVRulesFromReader reads hledger CSV rules from reader
 func NewCSVRulesFromReader(reader io.Reader) (Rules, error) {
+	rules, _, _, err := NewCSVRulesFileFromReader(reader)
+	return rules, err
+}
+
+// NewCSVRulesFileFromReader reads hledger CSV rules from reader, along with any category code overrides and split templates stored as comments
+func NewCSVRulesFileFromReader(reader io.Reader) (Rules, CategoryCodes, SplitTemplates, error) {
 	var rules Rules
+	codes := make(CategoryCodes)
+	var templates SplitTemplates
 	scanner := bufio.NewScanner(reader)
 
 	var state readerState
@@ -153,10 +254,24 @@ func NewCSVRulesFromReader(reader io.Reader) (Rules, error) {
 			// nothing found
 			return nil
 		}
-		rule, err := NewCSVRule(state.account1, state.account2, state.comment, state.conditions...)
+		splits, err := readerSplits(state)
+		if err != nil {
+			return err
+		}
+		account2 := state.account2
+		if len(splits) > 0 {
+			account2 = ""
+		}
+		rule, err := newCSVRule(state.account1, account2, state.comment, splits, state.conditions)
 		if err != nil {
 			return err
 		}
+		if state.amortize > 0 {
+			rule, err = AmortizeRule(rule, state.amortize)
+			if err != nil {
+				return err
+			}
+		}
 		rules = append(rules, rule)
 		state = readerState{}
 		return nil
@@ -170,24 +285,51 @@ func NewCSVRulesFromReader(reader io.Reader) (Rules, error) {
 		}
 
 		switch {
+		case strings.HasPrefix(line, categoryCodePrefix):
+			code, category, err := parseCategoryCode(line)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			codes[code] = category
+		case strings.HasPrefix(line, splitTemplatePrefix):
+			template, err := parseSplitTemplate(line)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			templates = append(templates, template)
+		case strings.HasPrefix(line, amortizePrefix):
+			if !state.foundExpressions {
+				return nil, nil, nil, errors.Errorf("Amortization must follow a rule's fields: '%s'", line)
+			}
+			months, err := ledger.ParseAmortization(strings.TrimPrefix(line, amortizePrefix))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			state.amortize = months
+		case isComment(line):
+			continue
 		case line == "if" || strings.HasPrefix(line, "if "):
 			if err := foundIf(&state, line, endRule); err != nil {
-				return nil, err
+				return nil, nil, nil, err
 			}
 		case state.foundIf && !strings.HasPrefix(line, " "):
 			state.conditions = append(state.conditions, line)
 		default:
 			err := foundExpression(&state, line)
 			if err != nil {
-				return nil, err
+				return nil, nil, nil, err
 			}
 		}
 	}
 	if err := endRule(); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	return rules, nil
+	return rules, codes, templates, nil
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "*")
 }
 
 func foundIf(state *readerState, line string, endRule func() error) error {
@@ -227,7 +369,21 @@ func foundExpression(state *readerState, line string) error {
 	case "comment":
 		state.comment = value
 	default:
-		return errors.Errorf("Unrecognized rule key: '%s'", key)
+		field, index, isSplit := parseSplitKey(key)
+		if !isSplit {
+			return errors.Errorf("Unrecognized rule key: '%s'", key)
+		}
+		if field == "account" {
+			if state.splitAccounts == nil {
+				state.splitAccounts = make(map[int]string)
+			}
+			state.splitAccounts[index] = value
+		} else {
+			if state.splitAmounts == nil {
+				state.splitAmounts = make(map[int]string)
+			}
+			state.splitAmounts[index] = value
+		}
 	}
 	return nil
 }
@@ -77,6 +77,9 @@ func TestCSVRuleMatch(t *testing.T) {
 			{Account: someAccount2, Amount: amt1.Neg(), Currency: usd},
 		},
 	}
+	merchantTxn := txn2
+	merchantTxn.Payee = "SQ *CORNER CAFE 0123"
+	merchantTxn.SetMerchant(ledger.Merchant{Name: "Corner Cafe"})
 
 	for _, tc := range []struct {
 		description string
@@ -120,6 +123,18 @@ func TestCSVRuleMatch(t *testing.T) {
 			txn:         txn2,
 			shouldMatch: false,
 		},
+		{
+			description: "match merchant name",
+			conditions:  []string{"^[^,]*,\"Corner Cafe\""},
+			txn:         merchantTxn,
+			shouldMatch: true,
+		},
+		{
+			description: "match raw payee replaced by merchant name",
+			conditions:  []string{"SQ \\*CORNER"},
+			txn:         merchantTxn,
+			shouldMatch: true,
+		},
 	} {
 		t.Run(tc.description, func(t *testing.T) {
 			rule, err := NewCSVRule("", "some category", "", tc.conditions...)
@@ -154,6 +169,15 @@ func TestCSVRuleApply(t *testing.T) {
 	assert.Equal(t, someAccount1, txn.Postings[0].Account)
 	assert.Equal(t, someAccount2, txn.Postings[1].Account)
 	assert.Equal(t, "something cool", txn.Postings[0].Comment)
+	assert.Empty(t, txn.Tags)
+
+	rule, err = AmortizeRule(rule, 12)
+	require.NoError(t, err)
+	rule.Apply(&txn)
+	assert.Equal(t, map[string]string{ledger.AmortizeTag: "12 months"}, txn.Tags)
+
+	_, err = AmortizeRule(rule, -1)
+	assert.Error(t, err)
 }
 
 func TestCSVRuleString(t *testing.T) {
@@ -201,6 +225,20 @@ account2 some account 2
 comment some comment
 			`,
 		},
+		{
+			description: "amortized rule",
+			rule: csvRule{
+				account1:   "some account 1",
+				Conditions: []string{"a"},
+				Amortize:   12,
+			},
+			result: `
+if
+a
+  account1 some account 1
+# amortize 12 months
+			`,
+		},
 	} {
 		t.Run(tc.description, func(t *testing.T) {
 			assert.Equal(t, strings.TrimSpace(tc.result)+"\n", tc.rule.String())
@@ -297,6 +335,28 @@ match me
 				Conditions: []string{"match me"},
 			}},
 		},
+		{
+			description: "amortized rule",
+			input: `
+if
+match me
+  account1 some account
+# amortize 6 months
+			`,
+			rules: []Rule{csvRule{
+				account1:   "some account",
+				Conditions: []string{"match me"},
+				Amortize:   6,
+			}},
+		},
+		{
+			description: "amortize without a rule",
+			input: `
+# amortize 6 months
+			`,
+			err:        true,
+			errMessage: "Amortization must follow a rule's fields: '# amortize 6 months'",
+		},
 		{
 			description: "invalid condition",
 			input: `
@@ -358,10 +418,18 @@ account1
 		{
 			description: "unknown expression type",
 			input: `
+account0 some account
+			`,
+			err:        true,
+			errMessage: "Unrecognized rule key: 'account0'",
+		},
+		{
+			description: "split without account2",
+			input: `
 account3 some account
 			`,
 			err:        true,
-			errMessage: "Unrecognized rule key: 'account3'",
+			errMessage: "Split rule is missing account2",
 		},
 	} {
 		t.Run(tc.description, func(t *testing.T) {
@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+)
+
+// PayeeCategories are low precedence default categories for exact payees, usually maintained in a spreadsheet
+type PayeeCategories struct {
+	exact      map[string]string
+	normalized map[string]string
+}
+
+// NewPayeeCategoriesFromReader parses a two column CSV of payees and categories.
+// A header row of "payee,category" is skipped, as are blank rows and rows starting with '#'. Later rows override earlier rows for the same payee.
+func NewPayeeCategoriesFromReader(reader io.Reader) (PayeeCategories, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.Comment = '#'
+	csvReader.TrimLeadingSpace = true
+	payees := PayeeCategories{
+		exact:      make(map[string]string),
+		normalized: make(map[string]string),
+	}
+	for row := 1; ; row++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return payees, nil
+		}
+		if err != nil {
+			return PayeeCategories{}, errors.Wrap(err, "Failed to read payee categories")
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) != 2 {
+			return PayeeCategories{}, errors.Errorf("Payee categories row %d must have 2 columns, a payee and a category: found %d", row, len(record))
+		}
+		payee, category := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if row == 1 && strings.EqualFold(payee, "payee") && strings.EqualFold(category, "category") {
+			continue
+		}
+		if payee == "" || category == "" {
+			return PayeeCategories{}, errors.Errorf("Payee categories row %d must have a payee and a category", row)
+		}
+		if strings.ContainsAny(category, ";\n") || !strings.Contains(category, ":") {
+			return PayeeCategories{}, errors.Errorf("Payee categories row %d has an invalid category, must be an account name like expenses:food: %q", row, category)
+		}
+		category = ledger.NormalizeAccountName(category)
+		payees.exact[payee] = category
+		payees.normalized[normalizePayee(payee)] = category
+	}
+}
+
+// ReadPayeeCategoriesFile reads payee categories from the CSV file at 'path'. An empty path returns no payee categories.
+func ReadPayeeCategoriesFile(path string) (PayeeCategories, error) {
+	if path == "" {
+		return PayeeCategories{}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return PayeeCategories{}, errors.Wrapf(err, "Error opening payee categories file '%s'", path)
+	}
+	defer file.Close()
+	payees, err := NewPayeeCategoriesFromReader(file)
+	return payees, errors.Wrapf(err, "Error reading payee categories from file '%s'", path)
+}
+
+// Len returns the number of payees with a category
+func (p PayeeCategories) Len() int {
+	return len(p.exact)
+}
+
+// Category returns the category for 'payee', preferring an exact match to a normalized one. Returns an empty string if none match.
+func (p PayeeCategories) Category(payee string) string {
+	if category, ok := p.exact[strings.TrimSpace(payee)]; ok {
+		return category
+	}
+	return p.normalized[normalizePayee(payee)]
+}
+
+// Apply categorizes txn if its payee has a category. Returns true if txn was categorized.
+func (p PayeeCategories) Apply(txn *ledger.Transaction) bool {
+	if len(txn.Postings) != 2 {
+		return false
+	}
+	category := p.Category(txn.Payee)
+	if category == "" {
+		return false
+	}
+	txn.Postings[1].Account = category
+	return true
+}
+
+// normalizePayee lower-cases 'payee' and reduces it to its words, ignoring punctuation, digits, and extra whitespace.
+// e.g. "STARBUCKS #1234" and "Starbucks" are equivalent.
+func normalizePayee(payee string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(payee), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}), " ")
+}
@@ -0,0 +1,56 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPayeeCategoriesFromReader(t *testing.T) {
+	payees, err := NewPayeeCategoriesFromReader(strings.NewReader(`Payee,Category
+# coffee shops
+STARBUCKS #1234,expenses:coffee
+
+"Hank's Burgers, Inc.", expenses:meals
+Corner Store,expenses:groceries
+corner store,expenses:snacks
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 4, payees.Len())
+	assert.Equal(t, "expenses:coffee", payees.Category("STARBUCKS #1234"))
+	assert.Equal(t, "expenses:coffee", payees.Category("Starbucks #5678"), "Normalized payees should ignore digits and punctuation")
+	assert.Equal(t, "expenses:meals", payees.Category("hank's burgers inc"))
+	assert.Equal(t, "expenses:groceries", payees.Category("Corner Store"), "Exact matches take precedence")
+	assert.Equal(t, "expenses:snacks", payees.Category("CORNER STORE"))
+	assert.Empty(t, payees.Category("Starbucks Reserve"))
+
+	for _, input := range []string{
+		"some payee",
+		"some payee,expenses:food,extra",
+		",expenses:food",
+		"some payee,food",
+	} {
+		_, err := NewPayeeCategoriesFromReader(strings.NewReader(input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestClassifyPayees(t *testing.T) {
+	rule, err := NewCSVRule("", "expenses:meals", "", "hank's burgers")
+	require.NoError(t, err)
+	store := NewStore(Rules{rule})
+	payees, err := NewPayeeCategoriesFromReader(strings.NewReader("Hank's Burgers,expenses:fast food\nNew Gym,expenses:fitness\n"))
+	require.NoError(t, err)
+	store.SetPayeeCategories(payees, "payees.csv")
+	assert.Equal(t, "payees.csv", store.PayeeCategoriesPath())
+
+	txns := []ledger.Transaction{classifyTxn("Hank's burgers", -10), classifyTxn("NEW GYM", -40)}
+	classifications := store.Classify(txns)
+	assert.Equal(t, "expenses:meals", txns[0].Postings[1].Account, "Rules take precedence to payee categories")
+	assert.Equal(t, StageRules, classifications[0].Stage)
+	assert.Equal(t, "expenses:fitness", txns[1].Postings[1].Account)
+	assert.Equal(t, StagePayees, classifications[1].Stage)
+}
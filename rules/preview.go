@@ -0,0 +1,74 @@
+package rules
+
+import (
+	"sort"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+)
+
+// Change is a transaction's categories before and after applying rules
+type Change struct {
+	ID    string
+	Date  time.Time
+	Payee string
+	// Before and After are the accounts of every posting after the first
+	Before, After []string
+	// Rules are the indexes of the matching rules
+	Rules []int
+}
+
+// Preview returns the changes applying the current rules would make to txns, without modifying them
+func (s *Store) Preview(txns []ledger.Transaction) []Change {
+	changes := []Change{}
+	for _, txn := range txns {
+		matches := s.Matches(&txn)
+		if len(matches) == 0 {
+			continue
+		}
+		applied := txn
+		applied.Postings = append([]ledger.Posting(nil), txn.Postings...)
+		s.Apply(&applied)
+		before, after := categories(txn), categories(applied)
+		if equalStrings(before, after) {
+			continue
+		}
+		ruleIndexes := make([]int, 0, len(matches))
+		for ix := range matches {
+			ruleIndexes = append(ruleIndexes, ix)
+		}
+		sort.Ints(ruleIndexes)
+		changes = append(changes, Change{
+			ID:     txn.ID(),
+			Date:   txn.Date,
+			Payee:  txn.Payee,
+			Before: before,
+			After:  after,
+			Rules:  ruleIndexes,
+		})
+	}
+	return changes
+}
+
+func categories(txn ledger.Transaction) []string {
+	if len(txn.Postings) < 2 {
+		return nil
+	}
+	accounts := make([]string, 0, len(txn.Postings)-1)
+	for _, p := range txn.Postings[1:] {
+		accounts = append(accounts, p.Account)
+	}
+	return accounts
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
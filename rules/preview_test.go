@@ -0,0 +1,46 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreview(t *testing.T) {
+	burgers, err := NewCSVRule("", "expenses:burgers", "", "Hank's burgers")
+	require.NoError(t, err)
+	coffee, err := NewCSVRule("", "expenses:coffee", "", "coffee")
+	require.NoError(t, err)
+	store := NewStore(Rules{burgers, coffee})
+	txns := []ledger.Transaction{
+		{
+			Payee:    "Hank's burgers",
+			Postings: []ledger.Posting{{Account: "assets:bank"}, {Account: "expenses:uncategorized"}},
+			Tags:     map[string]string{"id": "1"},
+		},
+		{
+			Payee:    "coffee shop",
+			Postings: []ledger.Posting{{Account: "assets:bank"}, {Account: "expenses:coffee"}},
+			Tags:     map[string]string{"id": "2"},
+		},
+		{
+			Payee:    "somewhere else",
+			Postings: []ledger.Posting{{Account: "assets:bank"}, {Account: "expenses:uncategorized"}},
+			Tags:     map[string]string{"id": "3"},
+		},
+	}
+
+	changes := store.Preview(txns)
+	assert.Equal(t, []Change{
+		{
+			ID:     "1",
+			Payee:  "Hank's burgers",
+			Before: []string{"expenses:uncategorized"},
+			After:  []string{"expenses:burgers"},
+			Rules:  []int{0},
+		},
+	}, changes, "Only transactions with changed categories should be included")
+	assert.Equal(t, "expenses:uncategorized", txns[0].Postings[1].Account, "Preview must not modify transactions")
+}
@@ -0,0 +1,65 @@
+package rules
+
+import "github.com/johnstarich/sage/ledger"
+
+// renameSplits returns a copy of splits with accounts in the 'oldName' category renamed, or splits itself if none are in it
+func renameSplits(splits []Split, oldName, newName string) ([]Split, bool) {
+	var renamed []Split
+	for i, split := range splits {
+		if account, ok := ledger.ReplaceAccountPrefix(split.Account, oldName, newName); ok {
+			if renamed == nil {
+				renamed = append([]Split(nil), splits...)
+			}
+			renamed[i].Account = account
+		}
+	}
+	if renamed == nil {
+		return splits, false
+	}
+	return renamed, true
+}
+
+// RenameCategory points rules, category codes, and split templates which assign the 'oldName' category or its subcategories to 'newName' instead.
+// Default category codes in the category are overridden with the new name. Returns the number of rules changed.
+func (s *Store) RenameCategory(oldName, newName string) int {
+	oldName, newName = ledger.NormalizeAccountName(oldName), ledger.NormalizeAccountName(newName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	newRules := make(Rules, len(s.rules))
+	for i, rule := range s.rules {
+		newRules[i] = rule
+		csv, ok := rule.(csvRule)
+		if !ok {
+			continue
+		}
+		account2, renamedAccount := ledger.ReplaceAccountPrefix(csv.Account2, oldName, newName)
+		splits, renamedSplits := renameSplits(csv.Splits, oldName, newName)
+		if renamedAccount || renamedSplits {
+			csv.Account2, csv.Splits = account2, splits
+			newRules[i] = csv
+			count++
+		}
+	}
+	s.rules = newRules
+
+	codes := make(CategoryCodes, len(s.codes))
+	for code, category := range DefaultCategoryCodes {
+		if renamed, ok := ledger.ReplaceAccountPrefix(category, oldName, newName); ok {
+			codes[code] = renamed
+		}
+	}
+	for code, category := range s.codes {
+		codes[code], _ = ledger.ReplaceAccountPrefix(category, oldName, newName)
+	}
+	s.codes = codes
+
+	templates := make(SplitTemplates, len(s.templates))
+	for i, template := range s.templates {
+		template.Splits, _ = renameSplits(template.Splits, oldName, newName)
+		templates[i] = template
+	}
+	s.templates = templates
+	return count
+}
@@ -0,0 +1,41 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameCategory(t *testing.T) {
+	dining, err := NewCSVRule("", "expenses:dining", "", "Cafe")
+	require.NoError(t, err)
+	coffee, err := NewCSVRule("", "expenses:Dining:coffee", "", "Coffee")
+	require.NoError(t, err)
+	other, err := NewCSVRule("", "expenses:dining out", "", "Diner")
+	require.NoError(t, err)
+	half := decimal.NewFromFloat(50)
+	split, err := NewCSVSplitRule("", "", []Split{{Account: "expenses:dining", Percent: &half}, {Account: "expenses:home"}}, "Shared")
+	require.NoError(t, err)
+	store := NewStore(Rules{dining, coffee, other, split})
+	require.NoError(t, store.SetCategoryCodes(CategoryCodes{"1234": "expenses:dining:fast food"}))
+	require.NoError(t, store.SetSplitTemplates(SplitTemplates{
+		{Name: "Roommate", Payee: "Pizza", Splits: []Split{{Account: "expenses:dining", Percent: &half}, {Account: "expenses:home"}}},
+	}))
+
+	assert.Equal(t, 3, store.RenameCategory("Expenses:Dining", "expenses:food:restaurants"))
+	var categories []string
+	for _, rule := range store.Rules() {
+		categories = append(categories, rule.(csvRule).Account2)
+	}
+	assert.Equal(t, []string{"expenses:food:restaurants", "expenses:food:restaurants:coffee", "expenses:dining out", ""}, categories)
+	assert.Equal(t, "expenses:food:restaurants", store.Rules()[3].(csvRule).Splits[0].Account)
+	assert.Equal(t, "expenses:dining", split.(csvRule).Splits[0].Account, "Original rules should not change")
+
+	assert.Equal(t, "expenses:food:restaurants:fast food", store.CategoryCodes()["1234"])
+	assert.Equal(t, "expenses:food:restaurants", store.SplitTemplates()[0].Splits[0].Account)
+
+	assert.Equal(t, 0, store.RenameCategory("expenses:shopping:food:restaurants", "expenses:eating out"))
+	assert.Equal(t, "expenses:eating out", store.CategoryCodes()["5812"], "Default category codes should be overridden")
+}
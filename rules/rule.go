@@ -37,15 +37,53 @@ func (r Rules) Matches(txn *ledger.Transaction) map[int]Rule {
 	return matchingRules
 }
 
-// UnmarshalJSON parses the given bytes into rules
+// SourceAccounts returns the account names (account1) any rules assign to a transaction's first posting
+func (r Rules) SourceAccounts() []string {
+	var accounts []string
+	for _, rule := range r {
+		if csv, ok := rule.(csvRule); ok && csv.account1 != "" {
+			accounts = append(accounts, csv.account1)
+		}
+	}
+	return accounts
+}
+
+// Categories returns the account names (account2 and split accounts) any rules assign to a transaction's balancing postings
+func (r Rules) Categories() []string {
+	accounts := make([]string, 0, len(r))
+	for _, rule := range r {
+		csv, ok := rule.(csvRule)
+		if !ok {
+			continue
+		}
+		if csv.Account2 != "" {
+			accounts = append(accounts, csv.Account2)
+		}
+		for _, split := range csv.Splits {
+			accounts = append(accounts, split.Account)
+		}
+	}
+	return accounts
+}
+
+// UnmarshalJSON parses the given bytes into rules. Returns RuleErrors listing every invalid rule's position, if any.
 func (r *Rules) UnmarshalJSON(b []byte) error {
-	var rules []csvRule
-	if err := json.Unmarshal(b, &rules); err != nil {
+	var rawRules []json.RawMessage
+	if err := json.Unmarshal(b, &rawRules); err != nil {
 		return err
 	}
-	*r = make(Rules, len(rules))
-	for i := range rules {
-		(*r)[i] = rules[i]
+	*r = make(Rules, len(rawRules))
+	var ruleErrs RuleErrors
+	for i := range rawRules {
+		var rule csvRule
+		if err := json.Unmarshal(rawRules[i], &rule); err != nil {
+			ruleErrs = append(ruleErrs, newRuleError(i, err))
+			continue
+		}
+		(*r)[i] = rule
+	}
+	if len(ruleErrs) > 0 {
+		return ruleErrs
 	}
 	return nil
 }
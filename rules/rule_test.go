@@ -162,3 +162,11 @@ func TestMatches(t *testing.T) {
 		2: r[2],
 	}, results)
 }
+
+func TestRulesSourceAccounts(t *testing.T) {
+	rule1, err := NewCSVRule("assets:Super Bank:****1234", "expenses:food", "", "burger")
+	require.NoError(t, err)
+	rule2, err := NewCSVRule("", "expenses:travel", "", "airline")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"assets:Super Bank:****1234"}, Rules{rule1, rule2}.SourceAccounts())
+}
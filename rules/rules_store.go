@@ -11,7 +11,20 @@ import (
 // Store enables manipulation of rules in memory
 type Store struct {
 	rules Rules
-	mu    sync.RWMutex
+	codes CategoryCodes
+	// templates split matching transactions no custom rule matches
+	templates SplitTemplates
+	// payees categorize exact and normalized payees no custom rule matches
+	payees PayeeCategories
+	// payeesPath is the CSV file payees were read from, if any
+	payeesPath string
+	// defaultCategory replaces the default rules' uncategorized expense category, if set
+	defaultCategory string
+	// feeRule categorizes foreign transaction fees no other rule matches
+	feeRule ledger.FeeRule
+	// precedence orders the classifier stages, or DefaultPrecedence if empty
+	precedence []string
+	mu         sync.RWMutex
 }
 
 // NewStore creates a rules store from the given rules
@@ -34,22 +47,127 @@ func (s *Store) Apply(txn *ledger.Transaction) {
 }
 
 // ApplyAll transforms the given transactions based on the current rules and the default rules.
-// Custom rules take precedence to default rules.
+// By default, custom rules take precedence to split templates, then payee categories, then category codes, then default rules. See SetPrecedence.
 func (s *Store) ApplyAll(txns []ledger.Transaction) {
-	for i := range txns {
-		Default.Apply(&txns[i])
+	s.Classify(txns)
+}
+
+func (s *Store) String() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	str := s.rules.String()
+	if len(s.codes) > 0 {
+		str += s.codes.String()
+	}
+	if len(s.templates) > 0 {
+		str += s.templates.String()
 	}
+	return str
+}
+
+// CategoryCodes returns a copy of the category code overrides
+func (s *Store) CategoryCodes() CategoryCodes {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	for i := range txns {
-		s.rules.Apply(&txns[i])
+	codes := make(CategoryCodes, len(s.codes))
+	for code, category := range s.codes {
+		codes[code] = category
 	}
+	return codes
 }
 
-func (s *Store) String() string {
+// SetCategoryCodes replaces the category code overrides, which take precedence to DefaultCategoryCodes
+func (s *Store) SetCategoryCodes(codes CategoryCodes) error {
+	if err := codes.Validate(); err != nil {
+		return err
+	}
+	normalized := make(CategoryCodes, len(codes))
+	for code, category := range codes {
+		normalized[code] = ledger.NormalizeAccountName(category)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes = normalized
+	return nil
+}
+
+// SplitTemplates returns a copy of the split templates
+func (s *Store) SplitTemplates() SplitTemplates {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append(SplitTemplates{}, s.templates...)
+}
+
+// SetSplitTemplates validates and replaces the split templates
+func (s *Store) SetSplitTemplates(templates SplitTemplates) error {
+	templates = append(SplitTemplates(nil), templates...)
+	if err := templates.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates = templates
+	return nil
+}
+
+// SplitTemplate returns the name of the split template which would split txn, if any. Custom rules matching txn take precedence.
+func (s *Store) SplitTemplate(txn ledger.Transaction) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.rules.Matches(&txn)) > 0 {
+		return ""
+	}
+	if template := s.templates.Match(txn); template != nil {
+		return template.Name
+	}
+	return ""
+}
+
+// SetPayeeCategories replaces the default categories for payees, read from the CSV file at 'path'. An empty path means payees weren't read from a file.
+func (s *Store) SetPayeeCategories(payees PayeeCategories, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payees = payees
+	s.payeesPath = path
+}
+
+// PayeeCategoriesPath returns the CSV file payee categories were read from, or an empty string if none
+func (s *Store) PayeeCategoriesPath() string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.rules.String()
+	return s.payeesPath
+}
+
+// SetDefaultCategory replaces the uncategorized expense category for transactions no other rule matches. An empty category restores the default.
+func (s *Store) SetDefaultCategory(category string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultCategory = ledger.NormalizeAccountName(category)
+}
+
+// SetFeeRule sets the rule for categorizing foreign transaction fees. A disabled rule leaves fees to the other rules.
+func (s *Store) SetFeeRule(rule ledger.FeeRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feeRule = rule
+}
+
+// FeeRule returns the rule for identifying foreign transaction fees
+func (s *Store) FeeRule() ledger.FeeRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.feeRule
+}
+
+// ClassifiedBy returns the category code used to categorize txn, if any. Custom rules, split templates, and payee categories matching txn take precedence.
+func (s *Store) ClassifiedBy(txn ledger.Transaction) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	code := CategoryCode(txn)
+	if s.codes.Category(code) == "" || len(s.rules.Matches(&txn)) > 0 || txn.Tags[ledger.SplitTemplateTag] != "" || s.templates.Match(txn) != nil || s.payees.Category(txn.Payee) != "" {
+		return ""
+	}
+	return code
 }
 
 // Replace replaces the current rules with newRules
@@ -59,17 +177,18 @@ func (s *Store) Replace(newRules Rules) {
 	s.rules = newRules
 }
 
-// Accounts returns account names (account2) for any CSV rules
+// Accounts returns account names (account2 and split accounts) for any CSV rules
 func (s *Store) Accounts() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	accounts := make([]string, 0, len(s.rules))
-	for _, rule := range s.rules {
-		if csv, ok := rule.(csvRule); ok && csv.Account2 != "" {
-			accounts = append(accounts, csv.Account2)
-		}
-	}
-	return accounts
+	return s.rules.Categories()
+}
+
+// Rules returns a copy of the current rules
+func (s *Store) Rules() Rules {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append(Rules(nil), s.rules...)
 }
 
 // Get returns the rule at 'index'
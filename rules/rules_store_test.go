@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -55,6 +56,40 @@ func TestStoreApplyAll(t *testing.T) {
 	assert.Equal(t, "expenses:burgers", txns[0].Postings[1].Account)
 }
 
+func TestStoreDefaultCategory(t *testing.T) {
+	rule, err := NewCSVRule("", "expenses:burgers", "", "Hank's burgers")
+	require.NoError(t, err)
+	store := NewStore(Rules{rule})
+	store.SetDefaultCategory("expenses:review")
+	newTxns := func() []ledger.Transaction {
+		return []ledger.Transaction{
+			{
+				Payee: "Hank's burgers",
+				Postings: []ledger.Posting{
+					{Account: "assets:Some Bank", Amount: decimal.NewFromFloat(-1)},
+					{Account: "uncategorized", Amount: decimal.NewFromFloat(1)},
+				},
+			},
+			{
+				Payee: "some unknown payee",
+				Postings: []ledger.Posting{
+					{Account: "assets:Some Bank", Amount: decimal.NewFromFloat(-1)},
+					{Account: "uncategorized", Amount: decimal.NewFromFloat(1)},
+				},
+			},
+		}
+	}
+	txns := newTxns()
+	store.ApplyAll(txns)
+	assert.Equal(t, "expenses:burgers", txns[0].Postings[1].Account)
+	assert.Equal(t, "expenses:review", txns[1].Postings[1].Account)
+
+	store.SetDefaultCategory("")
+	txns = newTxns()
+	store.ApplyAll(txns)
+	assert.Equal(t, UncategorizedExpense, txns[1].Postings[1].Account)
+}
+
 func TestStoreString(t *testing.T) {
 	rule, err := NewCSVRule("", "expenses:burgers", "", "Hank's burgers")
 	require.NoError(t, err)
@@ -173,3 +208,35 @@ func TestStoreMatches(t *testing.T) {
 		0: rule,
 	}, results)
 }
+
+func TestStoreFeeRule(t *testing.T) {
+	store := NewStore(nil)
+	store.SetDefaultCategory("expenses:review")
+	newTxns := func() []ledger.Transaction {
+		return []ledger.Transaction{
+			{
+				Payee: "FOREIGN TRANSACTION FEE",
+				Postings: []ledger.Posting{
+					{Account: "liabilities:Some Card", Amount: decimal.NewFromFloat(-1.12)},
+					{Account: "uncategorized", Amount: decimal.NewFromFloat(1.12)},
+				},
+			},
+			{
+				Payee: "FOREIGN TRANSACTION FEE",
+				Postings: []ledger.Posting{
+					{Account: "liabilities:Some Card", Amount: decimal.NewFromFloat(-100)},
+					{Account: "uncategorized", Amount: decimal.NewFromFloat(100)},
+				},
+			},
+		}
+	}
+	txns := newTxns()
+	store.ApplyAll(txns)
+	assert.Equal(t, "expenses:review", txns[0].Postings[1].Account, "Fee rule is disabled by default")
+
+	store.SetFeeRule(ledger.DefaultFeeRule())
+	txns = newTxns()
+	store.ApplyAll(txns)
+	assert.Equal(t, ledger.DefaultFeeCategory, txns[0].Postings[1].Account)
+	assert.Equal(t, "expenses:review", txns[1].Postings[1].Account, "Amounts larger than the max are not fees")
+}
@@ -0,0 +1,211 @@
+package rules
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// firstSplitIndex is the posting number of the first split, i.e. account2
+	firstSplitIndex = 2
+	percentSuffix   = "%"
+	splitPrecision  = 2
+)
+
+var (
+	splitKeyPattern = regexp.MustCompile(`^(account|amount)([0-9]+)$`)
+	hundred         = decimal.New(100, 0)
+)
+
+// Split is one balancing posting produced by a split rule.
+// Amount is a fixed amount and Percent is a percentage of the transaction total. If neither is set, the split receives the remainder.
+// Amounts are relative to the transaction's total, so positive amounts share the same sign as the balancing postings.
+type Split struct {
+	Account string
+	Amount  *decimal.Decimal `json:",omitempty"`
+	Percent *decimal.Decimal `json:",omitempty"`
+}
+
+func (s Split) isRemainder() bool {
+	return s.Amount == nil && s.Percent == nil
+}
+
+// parseSplitAmount parses a rules file amount into 'split', either a fixed amount '12.34' or a percentage '25%'
+func parseSplitAmount(split *Split, amount string) error {
+	amount = strings.TrimSpace(amount)
+	isPercent := strings.HasSuffix(amount, percentSuffix)
+	value, err := decimal.NewFromString(strings.TrimSpace(strings.TrimSuffix(amount, percentSuffix)))
+	if err != nil {
+		return errors.Errorf("Invalid split amount: '%s'", amount)
+	}
+	if isPercent {
+		split.Percent = &value
+	} else {
+		split.Amount = &value
+	}
+	return nil
+}
+
+func (s Split) formatAmount() string {
+	switch {
+	case s.Percent != nil:
+		return s.Percent.String() + percentSuffix
+	case s.Amount != nil:
+		return s.Amount.String()
+	default:
+		return ""
+	}
+}
+
+// validateSplits ensures splits always produce a balanced transaction
+func validateSplits(splits []Split) ([]Split, error) {
+	if len(splits) == 0 {
+		return nil, nil
+	}
+	cleaned, err := cleanSplits(splits)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid split rule")
+	}
+	if cleaned.remainders == 0 {
+		if cleaned.fixedAmounts > 0 {
+			return nil, errors.New("Invalid split rule: Splits with fixed amounts must include a remainder account without an amount")
+		}
+		if !cleaned.percentTotal.Equal(hundred) {
+			return nil, errors.Errorf("Invalid split rule: Percentages must total 100%%, found %s%%", cleaned.percentTotal)
+		}
+	}
+	return cleaned.splits, nil
+}
+
+type cleanedSplits struct {
+	splits                   []Split
+	remainders, fixedAmounts int
+	percentTotal             decimal.Decimal
+}
+
+// cleanSplits normalizes split accounts and checks the rules shared by every kind of split
+func cleanSplits(splits []Split) (cleanedSplits, error) {
+	if len(splits) < 2 {
+		return cleanedSplits{}, errors.New("At least 2 split accounts are required")
+	}
+	result := cleanedSplits{splits: make([]Split, 0, len(splits))}
+	for _, split := range splits {
+		split.Account = ledger.NormalizeAccountName(split.Account)
+		if split.Account == "" {
+			return cleanedSplits{}, errors.New("Every split must have an account")
+		}
+		switch {
+		case split.Amount != nil && split.Percent != nil:
+			return cleanedSplits{}, errors.Errorf("Split for '%s' must have either an amount or a percentage, not both", split.Account)
+		case split.Amount != nil:
+			result.fixedAmounts++
+		case split.Percent != nil:
+			result.percentTotal = result.percentTotal.Add(*split.Percent)
+		default:
+			result.remainders++
+		}
+		result.splits = append(result.splits, split)
+	}
+	if result.remainders > 1 {
+		return cleanedSplits{}, errors.New("Only one split may receive the remainder")
+	}
+	return result, nil
+}
+
+// splitAmounts distributes 'total' across 'splits'. Rounding differences go to the remainder split, or the last split if none exists.
+func splitAmounts(splits []Split, total decimal.Decimal) []decimal.Decimal {
+	amounts := make([]decimal.Decimal, len(splits))
+	balancingIndex := len(splits) - 1
+	sign := decimal.New(int64(total.Sign()), 0)
+	var sum decimal.Decimal
+	for i, split := range splits {
+		switch {
+		case split.Amount != nil:
+			amounts[i] = split.Amount.Mul(sign)
+		case split.Percent != nil:
+			amounts[i] = total.Mul(*split.Percent).Div(hundred).Round(splitPrecision)
+		default:
+			balancingIndex = i
+		}
+		sum = sum.Add(amounts[i])
+	}
+	amounts[balancingIndex] = amounts[balancingIndex].Add(total.Sub(sum))
+	return amounts
+}
+
+// applySplits replaces the balancing postings of 'txn' with one posting per split
+func (c csvRule) applySplits(txn *ledger.Transaction) {
+	source := txn.Postings[0]
+	amounts := splitAmounts(c.Splits, source.Amount.Neg())
+	postings := make([]ledger.Posting, 0, 1+len(c.Splits))
+	postings = append(postings, source)
+	for i, split := range c.Splits {
+		postings = append(postings, ledger.Posting{
+			Account:  split.Account,
+			Amount:   amounts[i],
+			Currency: source.Currency,
+		})
+	}
+	splitTxn := *txn
+	splitTxn.Postings = postings
+	if err := splitTxn.Validate(); err != nil {
+		// leave the original postings in place rather than write an unbalanced transaction
+		return
+	}
+	txn.Postings = postings
+}
+
+// parseSplitKey returns the posting number for an 'accountN' or 'amountN' rules file key
+func parseSplitKey(key string) (field string, index int, ok bool) {
+	matches := splitKeyPattern.FindStringSubmatch(key)
+	if matches == nil {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(matches[2])
+	if err != nil || index < firstSplitIndex {
+		return "", 0, false
+	}
+	return matches[1], index, true
+}
+
+// readerSplits assembles the splits found in a rules file, starting with account2
+func readerSplits(state readerState) ([]Split, error) {
+	if len(state.splitAccounts) == 0 && len(state.splitAmounts) == 0 {
+		return nil, nil
+	}
+	lastIndex := firstSplitIndex
+	for index := range state.splitAccounts {
+		if index > lastIndex {
+			lastIndex = index
+		}
+	}
+	for index := range state.splitAmounts {
+		if index > lastIndex {
+			lastIndex = index
+		}
+	}
+
+	splits := make([]Split, 0, lastIndex-firstSplitIndex+1)
+	for index := firstSplitIndex; index <= lastIndex; index++ {
+		account := state.splitAccounts[index]
+		if index == firstSplitIndex {
+			account = state.account2
+		}
+		if account == "" {
+			return nil, errors.Errorf("Split rule is missing account%d", index)
+		}
+		split := Split{Account: account}
+		if amount, ok := state.splitAmounts[index]; ok {
+			if err := parseSplitAmount(&split, amount); err != nil {
+				return nil, err
+			}
+		}
+		splits = append(splits, split)
+	}
+	return splits, nil
+}
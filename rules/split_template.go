@@ -0,0 +1,183 @@
+package rules
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const splitTemplatePrefix = "# split template "
+
+// SplitTemplate splits transactions from matching payees across multiple categories
+type SplitTemplate struct {
+	Name string
+	// Payee is a case-insensitive regular expression matching transaction payees
+	Payee string
+	// MinAmount, if set, only splits transactions whose absolute amount is greater than MinAmount
+	MinAmount *decimal.Decimal `json:",omitempty"`
+	// Splits are the categories to split across. Fixed amounts are taken first, then percentages are taken from what remains.
+	Splits []Split
+
+	payeePattern *regexp.Regexp
+}
+
+// SplitTemplates are applied in order, the first matching template wins
+type SplitTemplates []SplitTemplate
+
+// Validate returns an error if any template is malformed. Compiles each template's payee pattern.
+func (t SplitTemplates) Validate() error {
+	names := make(map[string]bool, len(t))
+	for i := range t {
+		if err := t[i].validate(); err != nil {
+			return err
+		}
+		if names[t[i].Name] {
+			return errors.Errorf("Invalid split template: Duplicate name %q", t[i].Name)
+		}
+		names[t[i].Name] = true
+	}
+	return nil
+}
+
+func (t *SplitTemplate) validate() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" || strings.Contains(t.Name, "\n") {
+		return errors.Errorf("Invalid split template: Name is required: %q", t.Name)
+	}
+	if strings.TrimSpace(t.Payee) == "" {
+		return errors.Errorf("Invalid split template %q: Payee pattern is required", t.Name)
+	}
+	pattern, err := regexp.Compile("(?i)" + t.Payee)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid split template %q: Malformed payee pattern", t.Name)
+	}
+	t.payeePattern = pattern
+	if t.MinAmount != nil && t.MinAmount.IsNegative() {
+		return errors.Errorf("Invalid split template %q: Minimum amount must not be negative", t.Name)
+	}
+	splits, err := cleanSplits(t.Splits)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid split template %q", t.Name)
+	}
+	if splits.remainders == 0 && !splits.percentTotal.Equal(hundred) {
+		return errors.Errorf("Invalid split template %q: Percentages must total 100%% without a remainder account, found %s%%", t.Name, splits.percentTotal)
+	}
+	if splits.remainders > 0 && splits.percentTotal.GreaterThan(hundred) {
+		return errors.Errorf("Invalid split template %q: Percentages must not exceed 100%%, found %s%%", t.Name, splits.percentTotal)
+	}
+	t.Splits = splits.splits
+	return nil
+}
+
+// Match returns true if txn is an unsplit transaction from the template's payee over its minimum amount.
+// Transactions the user re-categorized after splitting never match.
+func (t SplitTemplate) Match(txn ledger.Transaction) bool {
+	if t.payeePattern == nil || len(txn.Postings) != 2 || txn.Tags[ledger.ManualSplitTag] != "" || txn.Tags[ledger.SplitTemplateTag] != "" {
+		return false
+	}
+	if t.MinAmount != nil && !txn.Postings[0].Amount.Abs().GreaterThan(*t.MinAmount) {
+		return false
+	}
+	return t.payeePattern.MatchString(txn.Payee)
+}
+
+// Match returns the first template matching txn, or nil if none match
+func (t SplitTemplates) Match(txn ledger.Transaction) *SplitTemplate {
+	for i := range t {
+		if t[i].Match(txn) {
+			return &t[i]
+		}
+	}
+	return nil
+}
+
+// Apply replaces txn's balancing posting with one posting per split. Leaves txn unchanged if the fixed amounts exceed its total.
+func (t SplitTemplate) Apply(txn *ledger.Transaction) {
+	source := txn.Postings[0]
+	amounts, ok := templateAmounts(t.Splits, source.Amount.Neg())
+	if !ok {
+		return
+	}
+	postings := make([]ledger.Posting, 0, 1+len(t.Splits))
+	postings = append(postings, source)
+	for i, split := range t.Splits {
+		postings = append(postings, ledger.Posting{
+			Account:  split.Account,
+			Amount:   amounts[i],
+			Currency: source.Currency,
+		})
+	}
+	txn.Postings = postings
+	tags := make(map[string]string, len(txn.Tags)+1)
+	for key, value := range txn.Tags {
+		tags[key] = value
+	}
+	tags[ledger.SplitTemplateTag] = t.Name
+	txn.Tags = tags
+}
+
+// templateAmounts distributes 'total' across 'splits', taking fixed amounts first and percentages of what remains.
+// Rounding differences go to the remainder split, or the largest percentage share if none exists, so the amounts always sum to 'total'.
+func templateAmounts(splits []Split, total decimal.Decimal) ([]decimal.Decimal, bool) {
+	amounts := make([]decimal.Decimal, len(splits))
+	sign := decimal.New(int64(total.Sign()), 0)
+	rest := total
+	for i, split := range splits {
+		if split.Amount != nil {
+			amounts[i] = split.Amount.Mul(sign)
+			rest = rest.Sub(amounts[i])
+		}
+	}
+	if rest.Sign() != 0 && rest.Sign() != total.Sign() {
+		return nil, false
+	}
+
+	balancingIndex := -1
+	var sum decimal.Decimal
+	for i, split := range splits {
+		switch {
+		case split.Percent != nil:
+			amounts[i] = rest.Mul(*split.Percent).Div(hundred).Round(splitPrecision)
+		case split.isRemainder():
+			balancingIndex = i
+		}
+		sum = sum.Add(amounts[i])
+	}
+	if balancingIndex == -1 {
+		// validated templates without a remainder always have percentage splits
+		for i, split := range splits {
+			if split.Percent != nil && (balancingIndex == -1 || amounts[i].Abs().GreaterThan(amounts[balancingIndex].Abs())) {
+				balancingIndex = i
+			}
+		}
+	}
+	amounts[balancingIndex] = amounts[balancingIndex].Add(total.Sub(sum))
+	return amounts, true
+}
+
+// String formats t as comment lines, which hledger ignores
+func (t SplitTemplates) String() string {
+	var buf strings.Builder
+	for _, template := range t {
+		b, err := json.Marshal(template)
+		if err != nil {
+			panic(err)
+		}
+		buf.WriteString(splitTemplatePrefix)
+		buf.Write(b)
+		buf.WriteRune('\n')
+	}
+	return buf.String()
+}
+
+func parseSplitTemplate(line string) (SplitTemplate, error) {
+	var template SplitTemplate
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, splitTemplatePrefix)), &template); err != nil {
+		return SplitTemplate{}, errors.Wrapf(err, "Malformed split template: '%s'", line)
+	}
+	return template, nil
+}
@@ -0,0 +1,218 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func costcoTemplate() SplitTemplate {
+	return SplitTemplate{
+		Name:      "costco",
+		Payee:     "costco",
+		MinAmount: decPtr("50"),
+		Splits: []Split{
+			{Account: "expenses:groceries", Percent: decPtr("70")},
+			{Account: "expenses:household", Percent: decPtr("20")},
+			{Account: "expenses:clothing", Percent: decPtr("10")},
+		},
+	}
+}
+
+func templateTxn(payee, amount string) ledger.Transaction {
+	value := decimal.RequireFromString(amount)
+	return ledger.Transaction{
+		Payee: payee,
+		Postings: []ledger.Posting{
+			{Account: "assets:bank", Amount: value.Neg(), Currency: "$", Tags: map[string]string{"id": "1"}},
+			{Account: "expenses:uncategorized", Amount: value, Currency: "$"},
+		},
+	}
+}
+
+func TestSplitTemplatesValidate(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		template    SplitTemplate
+		expectErr   string
+	}{
+		{
+			description: "valid",
+			template:    costcoTemplate(),
+		},
+		{
+			description: "fixed amounts first",
+			template: SplitTemplate{Name: "fixed", Payee: "store", Splits: []Split{
+				{Account: "expenses:gift cards", Amount: decPtr("25")},
+				{Account: "expenses:groceries", Percent: decPtr("50")},
+				{Account: "expenses:household", Percent: decPtr("50")},
+			}},
+		},
+		{
+			description: "missing name",
+			template:    SplitTemplate{Payee: "store"},
+			expectErr:   `Invalid split template: Name is required: ""`,
+		},
+		{
+			description: "missing payee",
+			template:    SplitTemplate{Name: "store"},
+			expectErr:   `Invalid split template "store": Payee pattern is required`,
+		},
+		{
+			description: "malformed payee",
+			template:    SplitTemplate{Name: "store", Payee: "store("},
+			expectErr:   "Invalid split template \"store\": Malformed payee pattern: error parsing regexp: missing closing ): `(?i)store(`",
+		},
+		{
+			description: "too few splits",
+			template:    SplitTemplate{Name: "store", Payee: "store", Splits: []Split{{Account: "expenses:groceries"}}},
+			expectErr:   `Invalid split template "store": At least 2 split accounts are required`,
+		},
+		{
+			description: "percentages under 100",
+			template: SplitTemplate{Name: "store", Payee: "store", Splits: []Split{
+				{Account: "expenses:groceries", Percent: decPtr("70")},
+				{Account: "expenses:household", Percent: decPtr("20")},
+			}},
+			expectErr: `Invalid split template "store": Percentages must total 100% without a remainder account, found 90%`,
+		},
+		{
+			description: "percentages over 100 with remainder",
+			template: SplitTemplate{Name: "store", Payee: "store", Splits: []Split{
+				{Account: "expenses:groceries", Percent: decPtr("110")},
+				{Account: "expenses:household"},
+			}},
+			expectErr: `Invalid split template "store": Percentages must not exceed 100%, found 110%`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			err := SplitTemplates{tc.template}.Validate()
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectErr, err.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	err := SplitTemplates{costcoTemplate(), costcoTemplate()}.Validate()
+	require.Error(t, err)
+	assert.Equal(t, `Invalid split template: Duplicate name "costco"`, err.Error())
+}
+
+func TestTemplateAmounts(t *testing.T) {
+	for _, tc := range []struct {
+		description   string
+		splits        []Split
+		total         string
+		expectAmounts []string
+		expectOK      bool
+	}{
+		{
+			description:   "rounding goes to the largest share",
+			splits:        costcoTemplate().Splits,
+			total:         "100.01",
+			expectAmounts: []string{"70.01", "20", "10"},
+			expectOK:      true,
+		},
+		{
+			description:   "negative total",
+			splits:        costcoTemplate().Splits,
+			total:         "-33.33",
+			expectAmounts: []string{"-23.33", "-6.67", "-3.33"},
+			expectOK:      true,
+		},
+		{
+			description: "fixed amount first",
+			splits: []Split{
+				{Account: "expenses:gift cards", Amount: decPtr("25")},
+				{Account: "expenses:groceries", Percent: decPtr("50")},
+				{Account: "expenses:household", Percent: decPtr("50")},
+			},
+			total:         "75.01",
+			expectAmounts: []string{"25", "25", "25.01"},
+			expectOK:      true,
+		},
+		{
+			description: "remainder",
+			splits: []Split{
+				{Account: "expenses:groceries", Percent: decPtr("33.33")},
+				{Account: "expenses:household"},
+			},
+			total:         "10",
+			expectAmounts: []string{"3.33", "6.67"},
+			expectOK:      true,
+		},
+		{
+			description: "fixed amounts exceed total",
+			splits: []Split{
+				{Account: "expenses:gift cards", Amount: decPtr("25")},
+				{Account: "expenses:groceries"},
+			},
+			total: "10",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			amounts, ok := templateAmounts(tc.splits, decimal.RequireFromString(tc.total))
+			require.Equal(t, tc.expectOK, ok)
+			if !ok {
+				return
+			}
+			var sum decimal.Decimal
+			strs := make([]string, len(amounts))
+			for i, amount := range amounts {
+				sum = sum.Add(amount)
+				strs[i] = amount.String()
+			}
+			assert.Equal(t, tc.expectAmounts, strs)
+			assert.True(t, sum.Equal(decimal.RequireFromString(tc.total)), "Amounts must sum to the total: %s", sum)
+		})
+	}
+}
+
+func TestStoreApplyAllSplitTemplates(t *testing.T) {
+	rule, err := NewCSVRule("", "expenses:gas", "", "costco gas")
+	require.NoError(t, err)
+	store := NewStore(Rules{rule})
+	require.NoError(t, store.SetSplitTemplates(SplitTemplates{costcoTemplate()}))
+
+	txns := []ledger.Transaction{
+		templateTxn("COSTCO WHOLESALE", "100.00"),
+		templateTxn("COSTCO WHOLESALE", "50.00"),
+		templateTxn("costco gas", "100.00"),
+		templateTxn("COSTCO WHOLESALE", "100.00"),
+	}
+	txns[3].Tags = map[string]string{ledger.ManualSplitTag: "true"}
+	store.ApplyAll(txns)
+
+	require.Len(t, txns[0].Postings, 4)
+	assert.Equal(t, "expenses:groceries", txns[0].Postings[1].Account)
+	assert.Equal(t, "costco", txns[0].Tags[ledger.SplitTemplateTag])
+	assert.NoError(t, txns[0].Validate())
+	assert.Len(t, txns[1].Postings, 2, "Transactions under the minimum amount should not be split")
+	assert.Equal(t, []string{"expenses:gas"}, categories(txns[2]), "Custom rules should take precedence")
+	assert.Len(t, txns[3].Postings, 2, "Manually re-categorized transactions should not be split again")
+
+	assert.Equal(t, "costco", store.SplitTemplate(templateTxn("Costco", "60")))
+	assert.Empty(t, store.SplitTemplate(txns[0]), "Split transactions should not be split again")
+}
+
+func TestSplitTemplatesRoundTrip(t *testing.T) {
+	store := NewStore(nil)
+	require.NoError(t, store.SetSplitTemplates(SplitTemplates{costcoTemplate()}))
+	assert.Equal(t, `# split template {"Name":"costco","Payee":"costco","MinAmount":"50","Splits":[{"Account":"expenses:groceries","Percent":"70"},{"Account":"expenses:household","Percent":"20"},{"Account":"expenses:clothing","Percent":"10"}]}
+`, store.String())
+
+	_, _, templates, err := NewCSVRulesFileFromReader(strings.NewReader(store.String()))
+	require.NoError(t, err)
+	require.NoError(t, templates.Validate())
+	assert.Equal(t, store.SplitTemplates(), templates)
+
+	_, _, _, err = NewCSVRulesFileFromReader(strings.NewReader("# split template {\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,255 @@
+package rules
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decPtr(s string) *decimal.Decimal {
+	d := decimal.RequireFromString(s)
+	return &d
+}
+
+func TestValidateSplits(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		splits      []Split
+		expectErr   string
+	}{
+		{
+			description: "no splits",
+		},
+		{
+			description: "remainder with fixed and percent",
+			splits: []Split{
+				{Account: "revenues:salary"},
+				{Account: "expenses:taxes", Amount: decPtr("-200")},
+				{Account: "assets:401k", Percent: decPtr("5")},
+			},
+		},
+		{
+			description: "percentages total 100",
+			splits: []Split{
+				{Account: "expenses:groceries", Percent: decPtr("60")},
+				{Account: "expenses:household", Percent: decPtr("40")},
+			},
+		},
+		{
+			description: "single split",
+			splits:      []Split{{Account: "expenses:groceries"}},
+			expectErr:   "Invalid split rule: At least 2 split accounts are required",
+		},
+		{
+			description: "missing account",
+			splits:      []Split{{Account: "expenses:groceries"}, {Account: " ", Amount: decPtr("1")}},
+			expectErr:   "Invalid split rule: Every split must have an account",
+		},
+		{
+			description: "amount and percent",
+			splits:      []Split{{Account: "expenses:groceries"}, {Account: "expenses:household", Amount: decPtr("1"), Percent: decPtr("1")}},
+			expectErr:   "Invalid split rule: Split for 'expenses:household' must have either an amount or a percentage, not both",
+		},
+		{
+			description: "multiple remainders",
+			splits:      []Split{{Account: "expenses:groceries"}, {Account: "expenses:household"}},
+			expectErr:   "Invalid split rule: Only one split may receive the remainder",
+		},
+		{
+			description: "fixed amounts without remainder",
+			splits:      []Split{{Account: "expenses:groceries", Amount: decPtr("1")}, {Account: "expenses:household", Percent: decPtr("100")}},
+			expectErr:   "Invalid split rule: Splits with fixed amounts must include a remainder account without an amount",
+		},
+		{
+			description: "percentages don't total 100",
+			splits:      []Split{{Account: "expenses:groceries", Percent: decPtr("60")}, {Account: "expenses:household", Percent: decPtr("30")}},
+			expectErr:   "Invalid split rule: Percentages must total 100%, found 90%",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := validateSplits(tc.splits)
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectErr, err.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCSVSplitRuleApply(t *testing.T) {
+	date := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	newTxn := func(amount string) ledger.Transaction {
+		amt := decimal.RequireFromString(amount)
+		return ledger.Transaction{
+			Date:  date,
+			Payee: "PAYROLL",
+			Postings: []ledger.Posting{
+				{Account: "assets:checking", Amount: amt, Currency: usd, Tags: map[string]string{"id": "1"}},
+				{Account: "uncategorized", Amount: amt.Neg(), Currency: usd},
+			},
+		}
+	}
+	posting := func(account, amount string) ledger.Posting {
+		return ledger.Posting{Account: account, Amount: decimal.RequireFromString(amount), Currency: usd}
+	}
+
+	for _, tc := range []struct {
+		description string
+		amount      string
+		splits      []Split
+		expect      []ledger.Posting
+	}{
+		{
+			description: "paycheck with withholding",
+			amount:      "1000",
+			splits: []Split{
+				{Account: "revenues:salary"},
+				{Account: "expenses:taxes", Amount: decPtr("-200")},
+				{Account: "assets:401k", Amount: decPtr("-100")},
+			},
+			expect: []ledger.Posting{
+				posting("revenues:salary", "-1300"),
+				posting("expenses:taxes", "200"),
+				posting("assets:401k", "100"),
+			},
+		},
+		{
+			description: "percentages of a purchase",
+			amount:      "-100",
+			splits: []Split{
+				{Account: "expenses:groceries", Percent: decPtr("60")},
+				{Account: "expenses:household", Percent: decPtr("40")},
+			},
+			expect: []ledger.Posting{
+				posting("expenses:groceries", "60"),
+				posting("expenses:household", "40"),
+			},
+		},
+		{
+			description: "rounding goes to last split without remainder",
+			amount:      "-10",
+			splits: []Split{
+				{Account: "expenses:a", Percent: decPtr("33.33")},
+				{Account: "expenses:b", Percent: decPtr("33.33")},
+				{Account: "expenses:c", Percent: decPtr("33.34")},
+			},
+			expect: []ledger.Posting{
+				posting("expenses:a", "3.33"),
+				posting("expenses:b", "3.33"),
+				posting("expenses:c", "3.34"),
+			},
+		},
+		{
+			description: "rounding goes to remainder",
+			amount:      "-0.10",
+			splits: []Split{
+				{Account: "expenses:a"},
+				{Account: "expenses:b", Percent: decPtr("33")},
+			},
+			expect: []ledger.Posting{
+				posting("expenses:a", "0.07"),
+				posting("expenses:b", "0.03"),
+			},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			rule, err := NewCSVSplitRule("", "", tc.splits)
+			require.NoError(t, err)
+			txn := newTxn(tc.amount)
+			source := txn.Postings[0]
+			rule.Apply(&txn)
+
+			require.Len(t, txn.Postings, 1+len(tc.expect))
+			assert.Equal(t, source, txn.Postings[0])
+			for i, p := range tc.expect {
+				assert.Equal(t, p.Account, txn.Postings[i+1].Account)
+				assert.Equal(t, p.Amount.String(), txn.Postings[i+1].Amount.String())
+				assert.Equal(t, p.Currency, txn.Postings[i+1].Currency)
+			}
+			assert.NoError(t, txn.Validate())
+		})
+	}
+}
+
+func TestNewCSVSplitRule(t *testing.T) {
+	_, err := NewCSVSplitRule("", "", nil, "hi")
+	assert.Error(t, err)
+
+	_, err = NewCSVSplitRule("", "", []Split{{Account: "a"}, {Account: "b"}}, "hi")
+	assert.Error(t, err)
+
+	_, err = newCSVRule("", "c", "", []Split{{Account: "a"}, {Account: "b", Percent: decPtr("10")}}, nil)
+	require.Error(t, err)
+	assert.Equal(t, "Invalid rule: Split rules must set account2 as the first split", err.Error())
+}
+
+func TestSplitRuleRoundTrip(t *testing.T) {
+	const rulesFile = `if
+PAYROLL
+  account1 assets:checking
+  account2 revenues:salary
+  account3 expenses:taxes
+  amount3 -200
+  account4 assets:401k
+  amount4 5%
+`
+	parsedRules, err := NewCSVRulesFromReader(strings.NewReader(rulesFile))
+	require.NoError(t, err)
+	require.Len(t, parsedRules, 1)
+	assert.Equal(t, []Split{
+		{Account: "revenues:salary"},
+		{Account: "expenses:taxes", Amount: decPtr("-200")},
+		{Account: "assets:401k", Percent: decPtr("5")},
+	}, parsedRules[0].(csvRule).Splits)
+	assert.Equal(t, rulesFile+"\n", parsedRules.String())
+
+	b, err := json.Marshal(parsedRules)
+	require.NoError(t, err)
+	var jsonRules Rules
+	require.NoError(t, json.Unmarshal(b, &jsonRules))
+	require.Len(t, jsonRules, 1)
+	assert.Equal(t, parsedRules[0].(csvRule).Splits, jsonRules[0].(csvRule).Splits)
+}
+
+func TestSplitRuleReaderErrors(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		rulesFile   string
+		expectErr   string
+	}{
+		{
+			description: "missing account for amount",
+			rulesFile:   "if\nPAYROLL\n  account2 a\n  amount3 1\n",
+			expectErr:   "Split rule is missing account3",
+		},
+		{
+			description: "invalid amount",
+			rulesFile:   "if\nPAYROLL\n  account2 a\n  account3 b\n  amount3 one\n",
+			expectErr:   "Invalid split amount: 'one'",
+		},
+		{
+			description: "amount1 is not a split",
+			rulesFile:   "if\nPAYROLL\n  amount1 1\n",
+			expectErr:   "Unrecognized rule key: 'amount1'",
+		},
+		{
+			description: "unbalanced splits",
+			rulesFile:   "if\nPAYROLL\n  account2 a\n  amount2 10%\n  account3 b\n  amount3 10%\n",
+			expectErr:   "Invalid split rule: Percentages must total 100%, found 20%",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := NewCSVRulesFromReader(strings.NewReader(tc.rulesFile))
+			require.Error(t, err)
+			assert.Equal(t, tc.expectErr, err.Error())
+		})
+	}
+}
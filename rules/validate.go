@@ -0,0 +1,139 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+)
+
+const (
+	// WarningDuplicateConditions means two rules match the same transactions but assign different categories
+	WarningDuplicateConditions = "duplicate_conditions"
+	// WarningOrphanedCategory means a category is still referenced elsewhere, but no rule assigns it anymore
+	WarningOrphanedCategory = "orphaned_category"
+)
+
+// ConditionError is an invalid condition, found at index Condition in a rule's conditions
+type ConditionError struct {
+	Condition int
+	Err       error
+}
+
+func (c ConditionError) Error() string {
+	return fmt.Sprintf("Invalid condition %d: %s", c.Condition+1, c.Err)
+}
+
+// RuleError describes the invalid rule at Index of a rule set
+type RuleError struct {
+	Index int
+	// Condition is the index of the rule's invalid condition, or -1 if the error isn't caused by one condition
+	Condition int
+	Error     string
+}
+
+func newRuleError(index int, err error) RuleError {
+	ruleErr := RuleError{Index: index, Condition: -1, Error: err.Error()}
+	if condErr, ok := errors.Cause(err).(ConditionError); ok {
+		ruleErr.Condition = condErr.Condition
+	}
+	return ruleErr
+}
+
+// RuleErrors are the invalid rules in a rule set
+type RuleErrors []RuleError
+
+func (r RuleErrors) Error() string {
+	messages := make([]string, 0, len(r))
+	for _, err := range r {
+		messages = append(messages, fmt.Sprintf("Rule %d: %s", err.Index+1, err.Error))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Warning describes a likely mistake in a rule set, which doesn't prevent saving it
+type Warning struct {
+	Kind    string
+	Message string
+	// Rules are the indexes of the rules involved, if any
+	Rules []int `json:",omitempty"`
+	// Category is the category involved, if any
+	Category string `json:",omitempty"`
+	// ReferencedBy lists what still uses Category, like budgets or settings
+	ReferencedBy []string `json:",omitempty"`
+}
+
+// Check returns warnings for replacing 'oldRules' with 'newRules'.
+// 'references' maps category account keys (see ledger.AccountKey) to what refers to them, so categories only 'oldRules' assigned can be reported.
+func Check(oldRules, newRules Rules, references map[string][]string) []Warning {
+	warnings := duplicateConditions(newRules)
+	return append(warnings, orphanedCategories(oldRules, newRules, references)...)
+}
+
+func duplicateConditions(r Rules) []Warning {
+	var warnings []Warning
+	firstRule := make(map[string]int)
+	for ix, rule := range r {
+		csv, ok := rule.(csvRule)
+		if !ok {
+			continue
+		}
+		conditions := strings.Join(csv.Conditions, "\n")
+		prevIndex, exists := firstRule[conditions]
+		if !exists {
+			firstRule[conditions] = ix
+			continue
+		}
+		prev := r[prevIndex].(csvRule)
+		if ruleTarget(prev) == ruleTarget(csv) {
+			continue
+		}
+		// rules apply in order, so the later rule always overwrites the earlier rule's changes
+		warnings = append(warnings, Warning{
+			Kind:    WarningDuplicateConditions,
+			Message: fmt.Sprintf("Rules %d and %d have identical conditions but different categories, rule %d will always override rule %d", prevIndex+1, ix+1, ix+1, prevIndex+1),
+			Rules:   []int{prevIndex, ix},
+		})
+		firstRule[conditions] = ix
+	}
+	return warnings
+}
+
+// ruleTarget formats everything 'rule' changes on a match, ignoring its conditions
+func ruleTarget(rule csvRule) string {
+	rule.Conditions = nil
+	return rule.String()
+}
+
+func orphanedCategories(oldRules, newRules Rules, references map[string][]string) []Warning {
+	newCategories := make(map[string]bool)
+	for _, category := range newRules.Categories() {
+		newCategories[ledger.AccountKey(category)] = true
+	}
+	orphaned := make(map[string]string)
+	for _, category := range oldRules.Categories() {
+		key := ledger.AccountKey(category)
+		if !newCategories[key] && len(references[key]) > 0 {
+			orphaned[key] = category
+		}
+	}
+	keys := make([]string, 0, len(orphaned))
+	for key := range orphaned {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	warnings := make([]Warning, 0, len(keys))
+	for _, key := range keys {
+		category := orphaned[key]
+		warnings = append(warnings, Warning{
+			Kind:         WarningOrphanedCategory,
+			Message:      fmt.Sprintf("No rules assign %q anymore, but it's still used by %s", category, strings.Join(references[key], ", ")),
+			Category:     category,
+			ReferencedBy: references[key],
+		})
+	}
+	return warnings
+}
@@ -0,0 +1,69 @@
+package rules
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRulesUnmarshalRuleErrors(t *testing.T) {
+	var rules Rules
+	err := json.Unmarshal([]byte(`[
+		{"Conditions": ["grocery"], "Account2": "expenses:food"},
+		{"Conditions": ["coffee", "tea("], "Account2": "expenses:food"},
+		{"Conditions": ["rent"], "Account2": "expenses:rent", "Amortize": -1}
+	]`), &rules)
+	require.Error(t, err)
+	ruleErrs, ok := err.(RuleErrors)
+	require.True(t, ok, "Error should be RuleErrors: %T", err)
+	require.Len(t, ruleErrs, 2)
+	assert.Equal(t, 1, ruleErrs[0].Index)
+	assert.Equal(t, 1, ruleErrs[0].Condition)
+	assert.Equal(t, "Invalid condition 2: error parsing regexp: missing closing ): `tea(`", ruleErrs[0].Error)
+	assert.Equal(t, 2, ruleErrs[1].Index)
+	assert.Equal(t, -1, ruleErrs[1].Condition)
+	assert.Contains(t, err.Error(), "Rule 2: Invalid condition 2")
+}
+
+func TestCheckDuplicateConditions(t *testing.T) {
+	oldRules := Rules{}
+	newRules := Rules{
+		requireRule(NewCSVRule("", "expenses:food", "", "coffee")),
+		requireRule(NewCSVRule("", "expenses:shopping", "", "amazon")),
+		requireRule(NewCSVRule("", "expenses:food", "", "coffee")),
+		requireRule(NewCSVRule("", "expenses:entertainment", "", "coffee")),
+		requireRule(NewCSVRule("", "expenses:shopping", "", "Amazon")),
+	}
+	warnings := Check(oldRules, newRules, nil)
+	require.Len(t, warnings, 1)
+	assert.Equal(t, WarningDuplicateConditions, warnings[0].Kind)
+	assert.Equal(t, []int{0, 3}, warnings[0].Rules)
+	assert.Equal(t, "Rules 1 and 4 have identical conditions but different categories, rule 4 will always override rule 1", warnings[0].Message)
+}
+
+func TestCheckOrphanedCategories(t *testing.T) {
+	oldRules := Rules{
+		requireRule(NewCSVRule("", "expenses:food", "", "grocery")),
+		requireRule(NewCSVRule("", "expenses:Coffee Shops", "", "coffee")),
+		requireRule(NewCSVRule("", "expenses:travel", "", "airline")),
+	}
+	newRules := Rules{
+		requireRule(NewCSVRule("", "expenses:food", "", "grocery", "coffee")),
+	}
+	references := map[string][]string{
+		ledger.AccountKey("expenses:food"):         {"budgets"},
+		ledger.AccountKey("expenses:coffee shops"): {"budgets", "default category setting"},
+	}
+	warnings := Check(oldRules, newRules, references)
+	assert.Equal(t, []Warning{
+		{
+			Kind:         WarningOrphanedCategory,
+			Message:      `No rules assign "expenses:Coffee Shops" anymore, but it's still used by budgets, default category setting`,
+			Category:     "expenses:Coffee Shops",
+			ReferencedBy: []string{"budgets", "default category setting"},
+		},
+	}, warnings, "Unreferenced categories should not warn")
+}
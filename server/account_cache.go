@@ -0,0 +1,91 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	// DefaultAccountInfoCacheTTL is how long account discovery responses are reused when not configured
+	DefaultAccountInfoCacheTTL = 5 * time.Minute
+
+	// jsonContentType matches gin's JSON responses
+	jsonContentType = "application/json; charset=utf-8"
+)
+
+// accountInfoCache reuses recent account discovery responses, so tweaking a connector doesn't log in to the institution every time.
+// Entries are keyed by a hash of the connector's identity and credentials, and only hold the redacted JSON response.
+// A nil accountInfoCache caches nothing.
+type accountInfoCache struct {
+	responses *cache.Cache
+}
+
+// newAccountInfoCache returns a cache holding responses for 'ttl'. Returns nil if ttl is not positive, which disables caching.
+func newAccountInfoCache(ttl time.Duration) *accountInfoCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &accountInfoCache{
+		responses: cache.New(ttl, ttl*2),
+	}
+}
+
+func (a *accountInfoCache) get(key string) ([]byte, bool) {
+	if a == nil {
+		return nil, false
+	}
+	response, found := a.responses.Get(key)
+	if !found {
+		return nil, false
+	}
+	return response.([]byte), true
+}
+
+func (a *accountInfoCache) set(key string, response []byte) {
+	if a != nil {
+		a.responses.SetDefault(key, response)
+	}
+}
+
+// clear removes every cached response
+func (a *accountInfoCache) clear() {
+	if a != nil {
+		a.responses.Flush()
+	}
+}
+
+// accountInfoCacheKey hashes everything identifying connector's account discovery request, so credentials never appear in plain text
+func accountInfoCacheKey(connector direct.Connector) (string, error) {
+	config, err := json.Marshal(connector.Config())
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	for _, field := range []string{
+		connector.URL(),
+		connector.FID(),
+		connector.Org(),
+		connector.Username(),
+		string(connector.Password()),
+		string(config),
+	} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// clearAccountInfoCache drops all cached account discovery responses, so the next discovery contacts the institution
+func clearAccountInfoCache(accountCache *accountInfoCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountCache.clear()
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountInfoCacheKey(t *testing.T) {
+	newConnector := func(username, password string) direct.Connector {
+		return direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", username, password, direct.Config{})
+	}
+	key, err := accountInfoCacheKey(newConnector("user", "super secret"))
+	require.NoError(t, err)
+	sameKey, err := accountInfoCacheKey(newConnector("user", "super secret"))
+	require.NoError(t, err)
+	otherPassword, err := accountInfoCacheKey(newConnector("user", "other secret"))
+	require.NoError(t, err)
+	otherUser, err := accountInfoCacheKey(newConnector("other user", "super secret"))
+	require.NoError(t, err)
+
+	assert.Equal(t, key, sameKey)
+	assert.NotEqual(t, key, otherPassword)
+	assert.NotEqual(t, key, otherUser)
+	assert.NotContains(t, key, "super secret")
+	assert.NotContains(t, key, "user")
+}
+
+func TestAccountInfoCache(t *testing.T) {
+	accountCache := newAccountInfoCache(time.Minute)
+	_, found := accountCache.get("key")
+	assert.False(t, found)
+
+	accountCache.set("key", []byte(`[]`))
+	response, found := accountCache.get("key")
+	assert.True(t, found)
+	assert.Equal(t, []byte(`[]`), response)
+
+	accountCache.clear()
+	_, found = accountCache.get("key")
+	assert.False(t, found)
+
+	disabled := newAccountInfoCache(0)
+	assert.Nil(t, disabled)
+	disabled.set("key", []byte(`[]`))
+	_, found = disabled.get("key")
+	assert.False(t, found)
+	disabled.clear()
+}
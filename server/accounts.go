@@ -3,20 +3,30 @@ package server
 import (
 	"encoding/json"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/changeset"
 	"github.com/johnstarich/sage/client"
 	"github.com/johnstarich/sage/client/direct"
 	"github.com/johnstarich/sage/client/model"
 	"github.com/johnstarich/sage/client/web"
 	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/settings"
+	"github.com/johnstarich/sage/sync"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 func abortWithClientError(c *gin.Context, status int, err error) {
+	if tooLarge, ok := errors.Cause(err).(bodyTooLargeError); ok {
+		// reading the body past its size limit may fail anywhere, e.g. in c.ShouldBindJSON
+		status, err = http.StatusRequestEntityTooLarge, tooLarge
+	}
 	logger := c.MustGet(loggerKey).(*zap.Logger)
 	logger.WithOptions(zap.AddCallerSkip(1))
 	if status/100 == 5 {
@@ -29,9 +39,24 @@ func abortWithClientError(c *gin.Context, status int, err error) {
 	})
 }
 
+// abortWithMissingCapability aborts with a 501 naming the missing capability if err is a MissingCapabilityError. Returns true if aborted.
+func abortWithMissingCapability(c *gin.Context, err error) bool {
+	missing, ok := errors.Cause(err).(model.MissingCapabilityError)
+	if !ok {
+		return false
+	}
+	logger := c.MustGet(loggerKey).(*zap.Logger)
+	logger.Info("Aborting with missing capability", zap.String("capability", string(missing.Capability)))
+	c.AbortWithStatusJSON(http.StatusNotImplemented, map[string]interface{}{
+		"Error":             err.Error(),
+		"MissingCapability": missing.Capability,
+	})
+	return true
+}
+
 func readAndValidateAccount(r io.Reader, accountStore *client.AccountStore) (originalAccountID string, account model.Account, err error) {
-	b, err := ioutil.ReadAll(r)
-	if err != nil {
+	var b json.RawMessage
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
 		return "", nil, err
 	}
 	var original struct {
@@ -81,9 +106,9 @@ func readAndValidateAccount(r io.Reader, accountStore *client.AccountStore) (ori
 	return originalAccountID, account, err
 }
 
-func readAndValidateDirectConnector(r io.ReadCloser) (direct.Connector, error) {
-	b, err := ioutil.ReadAll(r)
-	if err != nil {
+func readAndValidateDirectConnector(r io.Reader) (direct.Connector, error) {
+	var b json.RawMessage
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
 		return nil, err
 	}
 	connector, err := direct.UnmarshalConnector(b)
@@ -107,17 +132,32 @@ func getAccount(accountStore *client.AccountStore) gin.HandlerFunc {
 			return
 		}
 		c.JSON(http.StatusOK, map[string]interface{}{
-			"Account": account,
+			"Account":      account,
+			"Capabilities": client.Capabilities(account),
 		})
 	}
 }
 
-func getAccounts(accountStore *client.AccountStore) gin.HandlerFunc {
+func getAccounts(accountStore *client.AccountStore, ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		formats, err := newCurrencyFormats(ldgStore.Ledger, accountStore, settingsStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
 		var accounts []model.Account
+		capabilities := make(map[string]model.Capabilities)
+		displayNames := make(map[string]string)
+		currencies := make(map[string]model.CurrencyFormat)
 		var account model.Account
-		err := accountStore.Iter(&account, func(id string) bool {
+		err = accountStore.Iter(&account, func(id string) bool {
+			if !scopedAccount(c, account) {
+				return true
+			}
 			accounts = append(accounts, account)
+			capabilities[id] = client.Capabilities(account)
+			displayNames[id] = model.DisplayName(account)
+			currencies[id] = formats.forAccount(account)
 			return true
 		})
 		if err != nil {
@@ -125,12 +165,17 @@ func getAccounts(accountStore *client.AccountStore) gin.HandlerFunc {
 			return
 		}
 		c.JSON(http.StatusOK, map[string]interface{}{
-			"Accounts": accounts,
+			"Accounts":     accounts,
+			"Capabilities": capabilities,
+			"DisplayNames": displayNames,
+			// Currencies maps account IDs to the currency format of their amounts
+			"Currencies":   currencies,
+			"HomeCurrency": formats.home,
 		})
 	}
 }
 
-func updateAccount(accountStore *client.AccountStore, ldgStore *ledger.Store) gin.HandlerFunc {
+func updateAccount(changes *changeset.Manager, accountStore *client.AccountStore, ldgStore *ledger.Store, prober *sync.Prober) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		accountID, account, err := readAndValidateAccount(c.Request.Body, accountStore)
 		if err != nil {
@@ -148,41 +193,111 @@ func updateAccount(accountStore *client.AccountStore, ldgStore *ledger.Store) gi
 			abortWithClientError(c, http.StatusNotFound, errors.Errorf("Account not found with ID: %q", accountID))
 			return
 		}
-
-		if err := accountStore.Update(accountID, account); err != nil {
-			abortWithClientError(c, http.StatusInternalServerError, err)
+		report, ok := checkAccountConnectivity(c, prober, account, credentialsChanged(currentAccount, account))
+		if !ok {
 			return
 		}
 
+		// check before the update, which may rename the account's postings
+		currencyWarning := currencyChangeWarning(ldgStore.Ledger, currentAccount, account)
 		oldAccountName := model.LedgerAccountName(currentAccount)
 		newAccountName := model.LedgerAccountName(account)
-		// TODO handle condition where account store was updated but ledger rename failed?
-		if oldAccountName != newAccountName {
-			if err := ldgStore.UpdateAccount(oldAccountName, newAccountName); err != nil {
-				abortWithClientError(c, http.StatusInternalServerError, err)
-				return
+		err = changes.Do("Update account "+accountID, func() error {
+			if err := accountStore.Update(accountID, account); err != nil {
+				return err
 			}
+			if oldAccountName != newAccountName {
+				return ldgStore.UpdateAccount(oldAccountName, newAccountName)
+			}
+			return nil
+		})
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		response := make(map[string]interface{})
+		if report != nil {
+			response["Connectivity"] = report
+		}
+		var warnings []string
+		if model.InstitutionTimeZone(currentAccount) != model.InstitutionTimeZone(account) {
+			// synced transactions keep their IDs, so re-syncing alone won't re-date them
+			warnings = append(warnings, "The new time zone only applies to transactions synced from now on. To re-date existing ones, remove them, then reset the account's sync state and sync again")
+		}
+		if currencyWarning != "" {
+			warnings = append(warnings, currencyWarning)
+		}
+		if len(warnings) > 0 {
+			response["Warning"] = strings.Join(warnings, ". ")
+		}
+		if len(response) > 0 {
+			c.JSON(http.StatusOK, response)
 		}
 	}
 }
 
-func addAccount(accountStore *client.AccountStore) gin.HandlerFunc {
+func addAccount(accountStore *client.AccountStore, prober *sync.Prober) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		_, account, err := readAndValidateAccount(c.Request.Body, accountStore)
 		if err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
+		report, ok := checkAccountConnectivity(c, prober, account, true)
+		if !ok {
+			return
+		}
 
 		if err := accountStore.Add(account); err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
 
+		if report != nil {
+			c.JSON(http.StatusOK, map[string]interface{}{
+				"Connectivity": report,
+			})
+			return
+		}
 		c.Status(http.StatusNoContent)
 	}
 }
 
+// checkAccountConnectivity checks a direct connect account's institution is reachable if the 'validateConnectivity' query is true.
+// Signs on with the account's credentials only if 'credentialsChanged', otherwise the check doesn't use credentials at all.
+// If the check fails, aborts with the failed probe and returns false, unless the 'saveAnyway' query is true.
+// The result is recorded as the account's latest probe, so call this before saving the account.
+func checkAccountConnectivity(c *gin.Context, prober *sync.Prober, account model.Account, credentialsChanged bool) (*direct.ConnectivityReport, bool) {
+	connector, isDirect := account.Institution().(direct.Connector)
+	if c.Query("validateConnectivity") != "true" || !isDirect {
+		return nil, true
+	}
+	report := direct.CheckConnectivity(c.Request.Context(), connector, credentialsChanged)
+	prober.RecordConnectivity(account, report)
+	if err := report.Err(); err != nil && c.Query("saveAnyway") != "true" {
+		logger := c.MustGet(loggerKey).(*zap.Logger)
+		logger.Info("Aborting with failed connectivity check", zap.String("error", err.Error()))
+		c.AbortWithStatusJSON(http.StatusBadRequest, map[string]interface{}{
+			"Error":        err.Error(),
+			"Connectivity": report,
+		})
+		return nil, false
+	}
+	return &report, true
+}
+
+// credentialsChanged returns true if 'account' signs on with different direct connect credentials than 'currentAccount'
+func credentialsChanged(currentAccount, account model.Account) bool {
+	currentConn, currentIsDirect := currentAccount.Institution().(direct.Connector)
+	connector, isDirect := account.Institution().(direct.Connector)
+	if !currentIsDirect || !isDirect {
+		return currentIsDirect != isDirect
+	}
+	return currentConn.URL() != connector.URL() ||
+		currentConn.Username() != connector.Username() ||
+		currentConn.Password() != connector.Password()
+}
+
 func removeAccount(accountStore *client.AccountStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		accountID := c.Query("id")
@@ -203,26 +318,11 @@ func verifyAccount(accountStore *client.AccountStore) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
-
-		connector, isConn := account.Institution().(direct.Connector)
-		if !isConn {
-			abortWithClientError(c, http.StatusBadRequest, errors.New("Cannot verify account: no direct connect details"))
-			return
-		}
-		requestor, isReq := account.(direct.Requestor)
-		if !isReq {
-			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Cannot verify account: account is invalid type: %T", account))
-			return
-		}
-		if err := direct.Verify(connector, requestor, client.ParseOFX); err != nil {
-			if err == direct.ErrAuthFailed {
-				abortWithClientError(c, http.StatusUnauthorized, err)
-				return
-			}
-			abortWithClientError(c, http.StatusInternalServerError, err)
+		if !verifyDirectAccount(c, account) {
 			return
 		}
 
+		connector := account.Institution().(direct.Connector)
 		pass := connector.Password()
 		if pass != "" {
 			c.Status(http.StatusNoContent)
@@ -257,7 +357,101 @@ func verifyAccount(accountStore *client.AccountStore) gin.HandlerFunc {
 	}
 }
 
-func fetchDirectConnectAccounts() gin.HandlerFunc {
+// verifyDirectAccount signs in to account's institution. Aborts and returns false if verification fails.
+func verifyDirectAccount(c *gin.Context, account model.Account) bool {
+	if err := client.RequireCapability(account, model.CapabilityVerifySignon); err != nil {
+		abortWithMissingCapability(c, err)
+		return false
+	}
+
+	connector, isConn := account.Institution().(direct.Connector)
+	if !isConn {
+		abortWithClientError(c, http.StatusBadRequest, errors.New("Cannot verify account: no direct connect details"))
+		return false
+	}
+	requestor, isReq := account.(direct.Requestor)
+	if !isReq {
+		abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Cannot verify account: account is invalid type: %T", account))
+		return false
+	}
+	if err := direct.Verify(connector, requestor, client.ParseOFX); err != nil {
+		if err == direct.ErrAuthFailed {
+			abortWithClientError(c, http.StatusUnauthorized, err)
+			return false
+		}
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+// verifyDirectConnector signs in with a connector's credentials before any account is chosen. Also requests account info if the 'accountInfo' query is true.
+func verifyDirectConnector() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		connector, err := readAndValidateDirectConnector(c.Request.Body)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := direct.VerifyConnector(connector, c.Query("accountInfo") == "true"); err != nil {
+			if err == direct.ErrAuthFailed {
+				abortWithClientError(c, http.StatusUnauthorized, err)
+				return
+			}
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// addAccountVerified verifies the account's credentials, then adds it only if verification succeeds.
+// Only adding is serialized, so slow verifications don't block each other and the account can't be added twice.
+func addAccountVerified(accountStore *client.AccountStore) gin.HandlerFunc {
+	var addMu gosync.Mutex
+	return func(c *gin.Context) {
+		_, account, err := readAndValidateAccount(c.Request.Body, accountStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if !requireNewAccount(c, accountStore, account) {
+			return
+		}
+		if !verifyDirectAccount(c, account) {
+			return
+		}
+
+		addMu.Lock()
+		defer addMu.Unlock()
+		if !requireNewAccount(c, accountStore, account) {
+			return
+		}
+		if err := accountStore.Add(account); err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// requireNewAccount aborts and returns false if an account with the same ID already exists
+func requireNewAccount(c *gin.Context, accountStore *client.AccountStore, account model.Account) bool {
+	var existing model.Account
+	found, err := accountStore.Get(account.ID(), &existing)
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return false
+	}
+	if found {
+		abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Account already exists with that ID: %q", account.ID()))
+		return false
+	}
+	return true
+}
+
+// fetchDirectConnectAccounts discovers a connector's accounts. Successful responses are reused from 'accountCache' unless the 'refresh' query is true.
+func fetchDirectConnectAccounts(accountCache *accountInfoCache) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		logger := c.MustGet(loggerKey).(*zap.Logger)
 
@@ -266,13 +460,269 @@ func fetchDirectConnectAccounts() gin.HandlerFunc {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
+		key, err := accountInfoCacheKey(connector)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if c.Query("refresh") != "true" {
+			if response, found := accountCache.get(key); found {
+				c.Data(http.StatusOK, jsonContentType, response)
+				return
+			}
+		}
 
 		accounts, err := direct.Accounts(connector, logger)
 		if err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
-		c.JSON(http.StatusOK, accounts)
+		response, err := json.Marshal(accounts)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		accountCache.set(key, response)
+		c.Data(http.StatusOK, jsonContentType, response)
+	}
+}
+
+// getDirectStatement downloads the last 'days' days of transactions for a direct connect account without importing them
+func getDirectStatement(accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Query("accountID")
+		var account model.Account
+		found, err := accountStore.Get(id, &account)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if !found {
+			abortWithClientError(c, http.StatusNotFound, errors.Errorf("Account not found by ID: %q", id))
+			return
+		}
+		connector, isConn := account.Institution().(direct.Connector)
+		requestor, isRequestor := account.(direct.Requestor)
+		if !isConn || !isRequestor {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Statements are only supported for direct connect accounts: %q", account.Description()))
+			return
+		}
+		days, err := strconv.Atoi(c.Query("days"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid days: %q", c.Query("days")))
+			return
+		}
+		if err := connector.Config().ValidateHistoryDays(days); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		start, end := direct.RelativeRange(days, time.Now())
+		txns, warning, err := direct.Statement(connector, start, end, []direct.Requestor{requestor}, client.ParseOFX)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		txns = client.SetTransactionCodes(txns, []model.Account{account})
+		txns = client.RouteCashWithdrawals(txns, []model.Account{account})
+		resp := map[string]interface{}{
+			"Start":        start,
+			"End":          end,
+			"Transactions": txns,
+		}
+		if warning != nil {
+			resp["Warning"] = warning.String()
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func diagnoseDirectConnector() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		connector, err := readAndValidateDirectConnector(c.Request.Body)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, direct.Diagnose(connector))
+	}
+}
+
+// probeNow sends a keepalive probe to the institution for account 'accountID', even if a previous probe was locked out
+func probeNow(prober *sync.Prober, accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := prober.ProbeAccount(accountStore, c.Query("accountID"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Probe": result,
+		})
+	}
+}
+
+// discoverAccounts checks the institution login of the 'accountID' query for new and missing accounts
+func discoverAccounts(prober *sync.Prober, accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := c.MustGet(loggerKey).(*zap.Logger)
+		discovery, err := prober.DiscoverAccount(accountStore, c.Query("accountID"), logger)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Discovery": discovery,
+		})
+	}
+}
+
+// fetchAllAccounts fetches account info from every active direct connect institution login, marking which reported accounts are already configured
+func fetchAllAccounts(prober *sync.Prober, accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := c.MustGet(loggerKey).(*zap.Logger)
+		institutions, err := prober.FetchAllAccounts(accountStore, logger)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Institutions": institutions,
+		})
+	}
+}
+
+// adoptDiscoveredAccount adds an account an institution newly reported in its latest discovery check
+func adoptDiscoveredAccount(prober *sync.Prober, accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			ID string
+		}
+		if !readJSON(c, &body) {
+			return
+		}
+		account, err := prober.AdoptDiscoveredAccount(accountStore, body.ID)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Account": account,
+		})
+	}
+}
+
+func getClientRegistration(prober *sync.Prober, accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registration, err := prober.ClientRegistration(accountStore, c.Query("accountID"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, registration)
+	}
+}
+
+func regenerateClientID(accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registration, err := sync.RegenerateClientID(accountStore, c.Query("accountID"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, registration)
+	}
+}
+
+func setClientID(accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			ClientID string
+		}
+		if !readJSON(c, &body) {
+			return
+		}
+		registration, err := sync.SetClientID(accountStore, c.Query("accountID"), body.ClientID)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, registration)
+	}
+}
+
+func getInstitutions(accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		institutions, err := accountStore.Institutions()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Institutions": institutions,
+		})
+	}
+}
+
+// updateInstitution adds or updates a shared direct connect institution. Include an ID to update an existing institution.
+func updateInstitution(accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var b json.RawMessage
+		if !readJSON(c, &b) {
+			return
+		}
+		var body struct {
+			ID string
+		}
+		if err := json.Unmarshal(b, &body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		connector, err := direct.UnmarshalConnector(b)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if body.ID != "" && connector.Password() == "" {
+			current, found, err := accountStore.Institution(body.ID)
+			if err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+				return
+			}
+			if found {
+				connector.SetPassword(current.Password())
+			}
+		}
+		if err := direct.ValidateConnector(connector); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		id := body.ID
+		if id == "" {
+			id, err = accountStore.AddInstitution(connector)
+		} else {
+			err = accountStore.UpdateInstitution(id, connector)
+		}
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"ID": id,
+		})
+	}
+}
+
+func removeInstitution(accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := accountStore.RemoveInstitution(c.Query("id")); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
 	}
 }
 
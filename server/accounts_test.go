@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAddAccountVerifiedAuthFailed(t *testing.T) {
+	institution := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+COMPRESSION:NONE
+OLDFILEUID:NONE
+NEWFILEUID:NONE
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>15500<SEVERITY>ERROR</STATUS><DTSERVER>20200102120000<LANGUAGE>ENG</SONRS></SIGNONMSGSRSV1>
+</OFX>
+`)
+	}))
+	defer institution.Close()
+	institutionURL := strings.Replace(institution.URL, "127.0.0.1", "localhost", 1)
+
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	engine := gin.New()
+	logger := zaptest.NewLogger(t)
+	engine.Use(func(c *gin.Context) {
+		c.Set(loggerKey, logger)
+	})
+	engine.POST("/accounts", addAccountVerified(accountStore))
+
+	resp := httptest.NewRecorder()
+	engine.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(fmt.Sprintf(`{
+		"AccountID": "1111",
+		"AccountDescription": "some bank account",
+		"DirectConnect": {
+			"InstDescription": "some bank",
+			"InstFID": "1234",
+			"InstOrg": "some org",
+			"ConnectorURL": %q,
+			"ConnectorUsername": "some username",
+			"ConnectorConfig": {"AppID": "QWIN", "AppVersion": "2500", "OFXVersion": "102"}
+		},
+		"BankAccountType": "CHECKING",
+		"RoutingNumber": "111"
+	}`, institutionURL))))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, resp.Body.String())
+	assert.Contains(t, resp.Body.String(), "Username or password is incorrect")
+
+	var account model.Account
+	found, err := accountStore.Get("1111", &account)
+	require.NoError(t, err)
+	assert.False(t, found, "Accounts which fail verification should not be added")
+}
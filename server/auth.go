@@ -103,6 +103,10 @@ func (a *authenticator) SetCookies(resp http.ResponseWriter, token string, expir
 
 func requireAuth(auth *authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if getScope(c) != nil {
+			// already authenticated by a scoped API key
+			return
+		}
 		err := auth.Authenticate(c.Writer, c.Request)
 		if err == nil {
 			return
@@ -121,7 +125,7 @@ func signIn(auth *authenticator) gin.HandlerFunc {
 		var creds struct {
 			Password redactor.String
 		}
-		if err := c.BindJSON(&creds); err != nil {
+		if err := c.ShouldBindJSON(&creds); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
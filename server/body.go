@@ -0,0 +1,138 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxUploadSize is the default body size limit in bytes for file uploads, like OFX statements and CSV files
+	DefaultMaxUploadSize = 64 << 20
+	// maxJSONBodySize is the body size limit in bytes for every other request, like account and rule JSON
+	maxJSONBodySize = 1 << 20
+	// uploadMemoryThreshold is the largest upload in bytes kept in memory, larger uploads are spooled to a temp file
+	uploadMemoryThreshold = 1 << 20
+)
+
+// bodyTooLargeError is returned when reading a request body past its endpoint's size limit
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e bodyTooLargeError) Error() string {
+	return fmt.Sprintf("Request body must not be larger than %d bytes", e.limit)
+}
+
+// limitedBody is a request body which fails with bodyTooLargeError after reading 'limit' bytes, or right away if its declared Content-Length is larger
+type limitedBody struct {
+	io.ReadCloser
+	limit, remaining, declared int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.declared > l.limit {
+		return 0, bodyTooLargeError{limit: l.limit}
+	}
+	if l.remaining <= 0 {
+		// bodies exactly at the limit are allowed, so only fail if there's more to read
+		var probe [1]byte
+		n, err := l.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, bodyTooLargeError{limit: l.limit}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// limitBody limits request bodies to 'limit' bytes. Reading past the limit fails with bodyTooLargeError, which abortWithClientError answers with 413 Request Entity Too Large.
+// Replaces any limit set by earlier middleware, so routes can raise the default limit.
+func limitBody(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := c.Request.Body
+		if body == nil {
+			return
+		}
+		if limited, ok := body.(*limitedBody); ok {
+			body = limited.ReadCloser
+		}
+		c.Request.Body = &limitedBody{ReadCloser: body, limit: limit, remaining: limit, declared: c.Request.ContentLength}
+	}
+}
+
+// readJSON decodes the request body's JSON into 'v' as it streams in, without buffering the whole body first.
+// Aborts with 400 for malformed or truncated JSON, or 413 for bodies past their size limit. Returns false if aborted.
+func readJSON(c *gin.Context, v interface{}) bool {
+	err := json.NewDecoder(c.Request.Body).Decode(v)
+	if err == io.EOF {
+		err = errors.New("Request body must not be empty")
+	}
+	if err != nil {
+		abortWithClientError(c, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// upload is a fully read request body, in memory or spooled to a temp file. Close removes the temp file.
+type upload struct {
+	io.Reader
+	file *os.File
+}
+
+// Close implements io.Closer
+func (u *upload) Close() error {
+	if u.file == nil {
+		return nil
+	}
+	closeErr := u.file.Close()
+	if err := os.Remove(u.file.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// readUpload reads the whole request body before it's processed, so uploads past their size limit fail before making any changes.
+// Bodies larger than uploadMemoryThreshold are spooled to a temp file instead of memory. Aborts on failure and returns false.
+func readUpload(c *gin.Context) (*upload, bool) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, c.Request.Body, uploadMemoryThreshold+1)
+	if err == io.EOF {
+		return &upload{Reader: &buf}, true
+	}
+	if err != nil {
+		abortWithClientError(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	file, err := ioutil.TempFile("", "sage-upload-")
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, errors.Wrap(err, "Failed to spool upload"))
+		return nil, false
+	}
+	spooled := &upload{Reader: file, file: file}
+	if _, err := io.Copy(file, io.MultiReader(&buf, c.Request.Body)); err != nil {
+		_ = spooled.Close()
+		abortWithClientError(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		_ = spooled.Close()
+		abortWithClientError(c, http.StatusInternalServerError, errors.Wrap(err, "Failed to spool upload"))
+		return nil, false
+	}
+	return spooled, true
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// repeatReader endlessly reads the same byte, for large request bodies which don't live in memory
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+// unsizedReader hides a reader's length, so requests are sent without a Content-Length like chunked uploads
+type unsizedReader struct {
+	io.Reader
+}
+
+func bodyTestEngine(t *testing.T) *gin.Engine {
+	engine := gin.New()
+	logger := zaptest.NewLogger(t)
+	engine.Use(func(c *gin.Context) {
+		c.Set(loggerKey, logger)
+	}, limitBody(10))
+	engine.POST("/json", func(c *gin.Context) {
+		var body struct {
+			ID string
+		}
+		if readJSON(c, &body) {
+			c.String(http.StatusOK, body.ID)
+		}
+	})
+	engine.POST("/bind", func(c *gin.Context) {
+		var body struct {
+			ID string
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.String(http.StatusOK, body.ID)
+	})
+	engine.POST("/upload", limitBody(20), func(c *gin.Context) {
+		body, ok := readUpload(c)
+		if !ok {
+			return
+		}
+		defer body.Close()
+		contents, err := ioutil.ReadAll(body)
+		require.NoError(t, err)
+		c.String(http.StatusOK, string(contents))
+	})
+	return engine
+}
+
+func TestLimitBody(t *testing.T) {
+	engine := bodyTestEngine(t)
+	for _, tc := range []struct {
+		description  string
+		path         string
+		body         string
+		unsized      bool
+		expectStatus int
+		expectBody   string
+	}{
+		{description: "at the limit", path: "/json", body: `{"ID":"a"}`, expectStatus: http.StatusOK, expectBody: "a"},
+		{description: "over the limit", path: "/json", body: `{"ID":"ab"}`, expectStatus: http.StatusRequestEntityTooLarge},
+		{description: "over the limit without content length", path: "/json", body: `{"ID":"ab"}`, unsized: true, expectStatus: http.StatusRequestEntityTooLarge},
+		{description: "at the limit without content length", path: "/json", body: `{"ID":"a"}`, unsized: true, expectStatus: http.StatusOK, expectBody: "a"},
+		{description: "bound JSON over the limit", path: "/bind", body: `{"ID":"ab"}`, unsized: true, expectStatus: http.StatusRequestEntityTooLarge},
+		{description: "bound JSON at the limit", path: "/bind", body: `{"ID":"a"}`, expectStatus: http.StatusOK, expectBody: "a"},
+		{description: "route raises the limit", path: "/upload", body: strings.Repeat("x", 20), expectStatus: http.StatusOK, expectBody: strings.Repeat("x", 20)},
+		{description: "over the route's limit", path: "/upload", body: strings.Repeat("x", 21), unsized: true, expectStatus: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tc.body)
+			if tc.unsized {
+				body = unsizedReader{body}
+			}
+			resp := httptest.NewRecorder()
+			engine.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, tc.path, body))
+			require.Equal(t, tc.expectStatus, resp.Code, resp.Body.String())
+			if tc.expectStatus == http.StatusRequestEntityTooLarge {
+				assert.Contains(t, resp.Body.String(), "Request body must not be larger than")
+				return
+			}
+			assert.Equal(t, tc.expectBody, resp.Body.String())
+		})
+	}
+}
+
+func TestReadJSONMalformed(t *testing.T) {
+	engine := bodyTestEngine(t)
+	for _, tc := range []struct {
+		description string
+		body        string
+		expectError string
+	}{
+		{description: "truncated", body: `{"ID":"a`, expectError: "unexpected EOF"},
+		{description: "empty", body: ``, expectError: "Request body must not be empty"},
+		{description: "not JSON", body: `ID=a`, expectError: "invalid character"},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			engine.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/json", strings.NewReader(tc.body)))
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+			assert.Contains(t, resp.Body.String(), tc.expectError)
+		})
+	}
+}
+
+func TestReadUploadSpoolsLargeBodies(t *testing.T) {
+	const size = 32 << 20
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(loggerKey, zaptest.NewLogger(t))
+	c.Request = httptest.NewRequest(http.MethodPost, "/", io.LimitReader(repeatReader('x'), size))
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	body, ok := readUpload(c)
+	runtime.ReadMemStats(&after)
+	require.True(t, ok)
+	require.NotNil(t, body.file, "Large uploads should be spooled to a temp file")
+	if !raceEnabled {
+		assert.True(t, after.TotalAlloc-before.TotalAlloc < 8*uploadMemoryThreshold, "Spooling should stay within the memory budget, allocated %d bytes", after.TotalAlloc-before.TotalAlloc)
+	}
+
+	n, err := io.Copy(ioutil.Discard, body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), n)
+	require.NoError(t, body.Close())
+	_, err = os.Stat(body.file.Name())
+	assert.True(t, os.IsNotExist(err), "Closing should remove the temp file")
+}
+
+func TestImportLargeOFXUpload(t *testing.T) {
+	const txnCount = 10000
+	var txns strings.Builder
+	for i := 0; i < txnCount; i++ {
+		fmt.Fprintf(&txns, `
+				<STMTTRN>
+					<TRNTYPE>DEBIT
+					<DTPOSTED>20200102120000
+					<TRNAMT>-1.00
+					<FITID>%d
+					<NAME>Some Shop
+				</STMTTRN>`, i)
+	}
+	statement := strings.Replace(importTestStatement("20200102120000", "first", "-1.00"), "<BANKTRANLIST>", "<BANKTRANLIST>"+txns.String(), 1)
+	require.True(t, len(statement) > uploadMemoryThreshold, "Statement should be large enough to spool")
+
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	require.NoError(t, accountStore.Add(&model.BasicAccount{
+		AccountID:          "11111234",
+		AccountDescription: "some checking",
+		AccountType:        model.AssetAccount,
+		BasicInstitution:   model.BasicInstitution{InstOrg: "SOMEORG", InstFID: "1234"},
+	}))
+	ldgStore, err := ledger.NewStore(&memFile{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	engine := gin.New()
+	logger := zaptest.NewLogger(t)
+	engine.Use(func(c *gin.Context) {
+		c.Set(loggerKey, logger)
+	}, limitBody(maxJSONBodySize))
+	engine.POST("/importOFX", limitBody(DefaultMaxUploadSize), importOFXFile(ldgStore, accountStore, rules.NewStore(nil), nil))
+
+	resp := httptest.NewRecorder()
+	engine.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/importOFX", unsizedReader{strings.NewReader(statement)}))
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var summary ofxImportSummary
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &summary))
+	assert.Equal(t, txnCount+1, summary.Added)
+	assert.Equal(t, txnCount+1, ldgStore.Size())
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/johnstarich/sage/client/model"
 	"github.com/johnstarich/sage/ledger"
 	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/settings"
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 )
@@ -65,8 +66,8 @@ func addMonths(t time.Time, months int) time.Time {
 	return time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
 }
 
-func getEverythingElseSum(accounts budget.Accounts, ldgStore *ledger.Store, start, end time.Time) decimal.Decimal {
-	leftOverAccounts := ldgStore.LeftOverAccountBalances(start, end, everythingElseAccounts(accounts)...)
+func getEverythingElseSum(accounts budget.Accounts, ldg *ledger.Ledger, start, end time.Time, dateBasis ledger.DateBasis) decimal.Decimal {
+	leftOverAccounts := ldg.LeftOverAccountBalancesBy(start, end, dateBasis, everythingElseAccounts(accounts)...)
 	var balance decimal.Decimal
 	for _, amount := range leftOverAccounts {
 		balance = balance.Add(amount.Abs()) // flip sign of revenues so nothing cancels out
@@ -74,7 +75,7 @@ func getEverythingElseSum(accounts budget.Accounts, ldgStore *ledger.Store, star
 	return balance
 }
 
-func getBudgets(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+func getBudgets(db plaindb.DB, ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
 	store, err := budget.NewStore(db)
 	if err != nil {
 		panic(err)
@@ -85,6 +86,14 @@ func getBudgets(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
+		dateBasis, ok := queryDateBasis(c, settingsStore)
+		if !ok {
+			return
+		}
+		ldg, ok := queryReportLedger(c, ldgStore.Ledger)
+		if !ok {
+			return
+		}
 		now := time.Now()
 		if end.After(now) {
 			end = now
@@ -99,7 +108,7 @@ func getBudgets(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
 			}
 			allMonthlyBudgets = append(allMonthlyBudgets, month)
 		}
-		budgetResults, err := calculateBudgetBalances(allMonthlyBudgets, ldgStore, start, end)
+		budgetResults, err := calculateBudgetBalances(allMonthlyBudgets, ldg, start, end, dateBasis)
 		if err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
@@ -116,7 +125,7 @@ func getBudgets(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
 	}
 }
 
-func calculateBudgetBalances(allMonthlyBudgets []budget.Accounts, ldgStore *ledger.Store, start, end time.Time) ([][]monthlyBudget, error) {
+func calculateBudgetBalances(allMonthlyBudgets []budget.Accounts, ldg *ledger.Ledger, start, end time.Time, dateBasis ledger.DateBasis) ([][]monthlyBudget, error) {
 	budgetResults := make([][]monthlyBudget, 0, 12)
 	for monthOffset, accounts := range allMonthlyBudgets {
 		monthStart := addMonths(start, monthOffset)
@@ -129,14 +138,14 @@ func calculateBudgetBalances(allMonthlyBudgets []budget.Accounts, ldgStore *ledg
 				switch strings.ToLower(account) {
 				case everythingElseBudget:
 					foundEverythingElse = true
-					balance = getEverythingElseSum(accounts, ldgStore, monthStart, monthEnd)
+					balance = getEverythingElseSum(accounts, ldg, monthStart, monthEnd, dateBasis)
 				default:
 					return nil, errors.Errorf("Invalid builtin account: %s", account)
 				}
 			} else {
-				balance = ldgStore.AccountBalance(account, monthStart, monthEnd)
+				balance = ldg.AccountBalanceBy(account, monthStart, monthEnd, dateBasis)
 			}
-			if strings.HasPrefix(account, model.RevenueAccount+":") || account == model.RevenueAccount {
+			if ldg.AccountType(account) == ledger.RevenueType {
 				balance = balance.Neg()
 			}
 			monthResults = append(monthResults, monthlyBudget{
@@ -149,7 +158,7 @@ func calculateBudgetBalances(allMonthlyBudgets []budget.Accounts, ldgStore *ledg
 		if !foundEverythingElse {
 			monthResults = append(monthResults, monthlyBudget{
 				Account: everythingElseBudget,
-				Balance: getEverythingElseSum(accounts, ldgStore, monthStart, monthEnd),
+				Balance: getEverythingElseSum(accounts, ldg, monthStart, monthEnd, dateBasis),
 			})
 		}
 		budgetResults = append(budgetResults, monthResults)
@@ -157,7 +166,7 @@ func calculateBudgetBalances(allMonthlyBudgets []budget.Accounts, ldgStore *ledg
 	return budgetResults, nil
 }
 
-func getBudget(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+func getBudget(db plaindb.DB, ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
 	store, err := budget.NewStore(db)
 	if err != nil {
 		panic(err)
@@ -168,6 +177,14 @@ func getBudget(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusBadRequest, errors.New("Account name is required"))
 			return
 		}
+		dateBasis, ok := queryDateBasis(c, settingsStore)
+		if !ok {
+			return
+		}
+		ldg, ok := queryReportLedger(c, ldgStore.Ledger)
+		if !ok {
+			return
+		}
 
 		var start, end time.Time
 		if endQuery := c.Query("end"); endQuery != "" {
@@ -201,8 +218,8 @@ func getBudget(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
 			return
 		}
 
-		balance := ldgStore.AccountBalance(account, start, end)
-		if strings.HasPrefix(account, model.RevenueAccount+":") {
+		balance := ldg.AccountBalanceBy(account, start, end, dateBasis)
+		if ldg.AccountType(account) == ledger.RevenueType {
 			balance = balance.Neg()
 		}
 
@@ -228,7 +245,7 @@ func updateBudget(db plaindb.DB) gin.HandlerFunc {
 	}
 	return func(c *gin.Context) {
 		var monthBudget monthlyBudget
-		if err := c.BindJSON(&monthBudget); err != nil {
+		if err := c.ShouldBindJSON(&monthBudget); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
@@ -297,7 +314,7 @@ func everythingElseAccounts(accounts budget.Accounts) []string {
 	return accountNames
 }
 
-func getEverythingElseBudgetDetails(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+func getEverythingElseBudgetDetails(db plaindb.DB, ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
 	store, err := budget.NewStore(db)
 	if err != nil {
 		panic(err)
@@ -308,6 +325,14 @@ func getEverythingElseBudgetDetails(db plaindb.DB, ldgStore *ledger.Store) gin.H
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
+		dateBasis, ok := queryDateBasis(c, settingsStore)
+		if !ok {
+			return
+		}
+		ldg, ok := queryReportLedger(c, ldgStore.Ledger)
+		if !ok {
+			return
+		}
 		if start.Year() != end.Year() || start.Month() != end.Month() {
 			start = startOfMonth(end)
 		}
@@ -318,10 +343,10 @@ func getEverythingElseBudgetDetails(db plaindb.DB, ldgStore *ledger.Store) gin.H
 			return
 		}
 
-		leftOverAccounts := ldgStore.LeftOverAccountBalances(start, end, everythingElseAccounts(accounts)...)
+		leftOverAccounts := ldg.LeftOverAccountBalancesBy(start, end, dateBasis, everythingElseAccounts(accounts)...)
 		var sum decimal.Decimal
 		for account, balance := range leftOverAccounts {
-			if strings.HasPrefix(account, model.RevenueAccount+":") {
+			if ldg.AccountType(account) == ledger.RevenueType {
 				leftOverAccounts[account] = balance.Neg()
 			}
 			sum = sum.Add(balance)
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/rules"
+	"github.com/johnstarich/sage/settings"
+	"github.com/pkg/errors"
+)
+
+const (
+	csvFormat = "csv"
+	// utf8BOM marks CSV files as UTF-8 for spreadsheet apps, which otherwise assume the system's encoding
+	utf8BOM = "\ufeff"
+
+	categorizeInvalid    = "invalid"
+	categorizeNoCategory = "no category"
+	categorizeDuplicate  = "duplicate"
+)
+
+var uncategorizedColumns = []string{"ID", "Date", "Account", "Payee", "Amount", "Category"}
+
+// categorizationResult is the outcome of one row of an imported categorizations CSV
+type categorizationResult struct {
+	// Row is the 1-based record number in the CSV, counting the header
+	Row      int
+	ID       string
+	Category string
+	Status   string
+	Error    string `json:",omitempty"`
+}
+
+// uncategorizedAccounts returns a func matching the categories used for transactions no rule matched
+func uncategorizedAccounts(settingsStore *settings.Store) (func(account string) bool, error) {
+	currentSettings, err := settingsStore.Settings()
+	if err != nil {
+		return nil, err
+	}
+	accounts := []string{model.Uncategorized, rules.UncategorizedExpense}
+	if currentSettings.DefaultCategory != "" {
+		accounts = append(accounts, currentSettings.DefaultCategory)
+	}
+	keys := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		keys[ledger.AccountKey(account)] = true
+	}
+	return func(account string) bool {
+		return keys[ledger.AccountKey(account)]
+	}, nil
+}
+
+// exportUncategorized responds with a CSV of uncategorized transactions and an empty category column, to fill in and send to importCategorizations.
+// Dates and amounts are rendered in the negotiated display locale. Only the ID and Category columns are read back in.
+func exportUncategorized(ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if format := c.DefaultQuery("format", csvFormat); format != csvFormat {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Unsupported format, must be %q: %q", csvFormat, format))
+			return
+		}
+		locale, err := negotiateLocale(c)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		isUncategorized, err := uncategorizedAccounts(settingsStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		formats, err := newCurrencyFormats(ldgStore.Ledger, accountStore, settingsStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString(utf8BOM)
+		writer := csv.NewWriter(&buf)
+		writer.UseCRLF = true
+		if err := writer.Write(uncategorizedColumns); err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		result := ldgStore.Query(ledger.QueryOptions{}, 1, ldgStore.Size()+1)
+		for _, txn := range result.Transactions {
+			if len(txn.Postings) != 2 || !isUncategorized(txn.Postings[1].Account) {
+				continue
+			}
+			id := txn.Postings[0].ID()
+			if id == "" {
+				id = txn.ID()
+			}
+			if id == "" {
+				// can't be re-imported without an ID
+				continue
+			}
+			err := writer.Write([]string{
+				id,
+				locale.Date(txn.Date),
+				txn.Postings[0].Account,
+				txn.Payee,
+				locale.Number(txn.Postings[0].Amount, formats.getWithCurrency(txn.Postings[0].Account, txn.Postings[0].Currency).Decimals),
+				"",
+			})
+			if err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		fileName := fmt.Sprintf("uncategorized-%s.csv", time.Now().Format(asOfDateFormat))
+		locale.setContentLanguage(c)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}
+}
+
+// importCategorizations applies the categories from a CSV in exportUncategorized's format, in one ledger write.
+// Only uncategorized transactions change, unless the 'overwrite' query is true.
+func importCategorizations(ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		overwrite := false
+		if overwriteQuery, ok := c.GetQuery("overwrite"); ok {
+			var err error
+			overwrite, err = strconv.ParseBool(overwriteQuery)
+			if err != nil {
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Overwrite must be true or false: %q", overwriteQuery))
+				return
+			}
+		}
+		body, ok := readUpload(c)
+		if !ok {
+			return
+		}
+		defer body.Close()
+		results, err := readCategorizations(body)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		isUncategorized, err := uncategorizedAccounts(settingsStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		categories := make(map[string]string, len(results))
+		for _, result := range results {
+			if result.Status == "" {
+				categories[result.ID] = result.Category
+			}
+		}
+		statuses, err := ldgStore.Categorize(categories, isUncategorized, overwrite)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		applied := 0
+		for i := range results {
+			if results[i].Status == "" {
+				results[i].Status = statuses[results[i].ID]
+			}
+			if results[i].Status == ledger.CategorizeApplied {
+				applied++
+			}
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Applied": applied,
+			"Results": results,
+		})
+	}
+}
+
+// readCategorizations parses a categorizations CSV, which may have been saved by a spreadsheet app.
+// Handles a UTF-8 byte order mark, CRLF line endings, quoted fields, and columns in any order.
+// Rows which can't be applied have their Status set, the rest are left empty.
+func readCategorizations(r io.Reader) ([]categorizationResult, error) {
+	bufReader := bufio.NewReader(r)
+	if prefix, err := bufReader.Peek(len(utf8BOM)); err == nil && string(prefix) == utf8BOM {
+		bufReader.Discard(len(utf8BOM))
+	}
+	reader := csv.NewReader(bufReader)
+	reader.FieldsPerRecord = -1 // spreadsheet apps may drop empty trailing columns
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV must have a header row")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid CSV")
+	}
+	idColumn, categoryColumn := -1, -1
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		switch {
+		case strings.EqualFold(column, "ID"):
+			idColumn = i
+		case strings.EqualFold(column, "Category"):
+			categoryColumn = i
+		}
+	}
+	if idColumn == -1 || categoryColumn == -1 {
+		return nil, errors.New("CSV header must include ID and Category columns")
+	}
+
+	var results []categorizationResult
+	seen := make(map[string]bool)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid CSV")
+		}
+		result := categorizationResult{Row: row}
+		if idColumn < len(record) {
+			result.ID = strings.TrimSpace(record[idColumn])
+		}
+		if categoryColumn < len(record) {
+			result.Category = ledger.NormalizeAccountName(record[categoryColumn])
+		}
+		switch {
+		case result.ID == "" && result.Category == "":
+			// skip blank rows
+			continue
+		case result.ID == "":
+			result.Status = categorizeInvalid
+			result.Error = "Transaction ID is required"
+		case result.Category == "":
+			result.Status = categorizeNoCategory
+		case seen[result.ID]:
+			result.Status = categorizeDuplicate
+			result.Error = "Transaction ID appears in an earlier row"
+		default:
+			if err := ledger.ValidateCategory(record[categoryColumn]); err != nil {
+				result.Status = categorizeInvalid
+				result.Error = err.Error()
+			}
+		}
+		if result.ID != "" {
+			seen[result.ID] = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCategorizations(t *testing.T) {
+	csv := utf8BOM + "ID,Date,Account,Payee,Amount,Category\r\n" +
+		"groceries,2019-01-02,assets:bank,\"Shop, Inc.\",-10,expenses:food\r\n" +
+		"restaurant,2019-01-03,assets:bank,\"The \"\"Diner\"\"\",-20,\r\n" +
+		",,,,,\r\n" +
+		"paycheck,2019-01-04,assets:bank,Work,100,revenues:salary;bad\r\n" +
+		"groceries,2019-01-02,assets:bank,Shop,-10,expenses:other\r\n" +
+		"coffee,2019-01-05,assets:bank,Cafe,-3\r\n"
+	results, err := readCategorizations(strings.NewReader(csv))
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+	assert.Equal(t, categorizationResult{Row: 2, ID: "groceries", Category: "expenses:food"}, results[0])
+	assert.Equal(t, categorizationResult{Row: 3, ID: "restaurant", Status: categorizeNoCategory}, results[1])
+	assert.Equal(t, 5, results[2].Row)
+	assert.Equal(t, categorizeInvalid, results[2].Status)
+	assert.Equal(t, categorizeDuplicate, results[3].Status)
+	assert.Equal(t, categorizationResult{Row: 7, ID: "coffee", Status: categorizeNoCategory}, results[4])
+}
+
+func TestReadCategorizationsInvalid(t *testing.T) {
+	for _, csv := range []string{
+		"",
+		"ID,Date,Account\n",
+		"ID,Category\n\"unterminated,expenses:food\n",
+	} {
+		_, err := readCategorizations(strings.NewReader(csv))
+		assert.Error(t, err, csv)
+	}
+}
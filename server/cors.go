@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultCORSMaxAge is how long browsers may cache preflight responses when not configured
+	DefaultCORSMaxAge = 10 * time.Minute
+
+	corsWildcardOrigin = "*"
+	corsRequestMethod  = "Access-Control-Request-Method"
+)
+
+// CORS allows browsers to call the API from other origins, like a separately hosted frontend.
+// The zero value allows no other origins, so only same-origin requests succeed.
+type CORS struct {
+	// Origins are the exact origins allowed to make cross-origin requests, e.g. "https://dashboard.example.com". "*" allows every origin.
+	Origins []string
+	// AllowCredentials lets allowed origins send cookies and authorization headers. Can't be combined with the "*" origin.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses
+	MaxAge time.Duration
+}
+
+// Validate returns an error if any origin is malformed, or credentials are allowed for every origin
+func (c CORS) Validate() error {
+	for _, origin := range c.Origins {
+		if origin == corsWildcardOrigin {
+			if c.AllowCredentials {
+				return errors.New("CORS credentials can't be allowed for every origin, list each allowed origin instead")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+			return errors.Errorf("Invalid CORS origin, must be a scheme and host like https://example.com: %q", origin)
+		}
+	}
+	if c.MaxAge < 0 {
+		return errors.Errorf("CORS max age must not be negative: %s", c.MaxAge)
+	}
+	return nil
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for 'origin', or an empty string if it isn't allowed
+func (c CORS) allowOrigin(origin string) string {
+	for _, allowed := range c.Origins {
+		switch {
+		case allowed == corsWildcardOrigin && !c.AllowCredentials:
+			return corsWildcardOrigin
+		case allowed == origin:
+			return origin
+		}
+	}
+	return ""
+}
+
+// corsHandler adds CORS headers for allowed origins and answers preflight requests for every route in 'routes'.
+// It must run before authentication, since browsers never send credentials with a preflight.
+// 'routes' is read on the first preflight, after all routes are registered.
+func corsHandler(config CORS, routes func() gin.RoutesInfo) gin.HandlerFunc {
+	var once gosync.Once
+	var table gin.RoutesInfo
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(config.Origins) == 0 || origin == "" {
+			return
+		}
+		allowOrigin := config.allowOrigin(origin)
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		if allowOrigin == "" {
+			// browsers block the response without CORS headers, same as the default same-origin behavior
+			return
+		}
+		header.Set("Access-Control-Allow-Origin", allowOrigin)
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if c.Request.Method != http.MethodOptions || c.GetHeader(corsRequestMethod) == "" {
+			return
+		}
+
+		once.Do(func() {
+			table = routes()
+		})
+		methods := routeMethods(table, c.Request.URL.Path)
+		if len(methods) == 0 {
+			// let unknown routes 404 as usual
+			return
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		header.Set("Access-Control-Allow-Headers", strings.Join(corsHeaders(methods), ", "))
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge/time.Second)))
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// routeMethods returns the sorted methods of every route in 'table' matching 'path'
+func routeMethods(table gin.RoutesInfo, path string) []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, route := range table {
+		if !seen[route.Method] && matchRoute(route.Path, path) {
+			seen[route.Method] = true
+			methods = append(methods, route.Method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoute returns true if 'path' matches the route 'pattern', including ":param" and "*catchAll" segments
+func matchRoute(pattern, path string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			if pathSegments[i] == "" {
+				return false
+			}
+		case segment != pathSegments[i]:
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
+
+// corsHeaders returns the request headers a cross-origin caller may send to a route accepting 'methods'
+func corsHeaders(methods []string) []string {
+	headers := []string{authHeaderName, apiKeyHeaderName}
+	for _, method := range methods {
+		if method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+			headers = append(headers, "Content-Type")
+			break
+		}
+	}
+	return headers
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func corsTestServer(t *testing.T, config CORS) *gin.Engine {
+	engine := gin.New()
+	logger := zaptest.NewLogger(t)
+	engine.Use(func(c *gin.Context) {
+		c.Set(loggerKey, logger)
+	})
+	engine.Use(corsHandler(config, engine.Routes))
+	api := engine.Group(apiPrefix)
+	api.Use(requireAuth(newAuthenticator("password")))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/getAccounts", ok)
+	api.POST("/getAccounts/update", ok)
+	api.GET("/accounts/:id/statement", ok)
+	api.POST("/accounts/:id/statement", ok)
+	return engine
+}
+
+func corsRequest(engine *gin.Engine, method, path, origin, requestMethod string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if requestMethod != "" {
+		req.Header.Set(corsRequestMethod, requestMethod)
+	}
+	resp := httptest.NewRecorder()
+	engine.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestCORSPreflight(t *testing.T) {
+	engine := corsTestServer(t, CORS{
+		Origins:          []string{"https://dashboard.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	resp := corsRequest(engine, http.MethodOptions, apiPrefix+"/accounts/1234/statement", "https://dashboard.example.com", http.MethodPost)
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Preflights should not require authentication")
+	assert.Equal(t, "https://dashboard.example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", resp.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST", resp.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, X-Api-Key, Content-Type", resp.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", resp.Header().Get("Access-Control-Max-Age"))
+
+	resp = corsRequest(engine, http.MethodOptions, apiPrefix+"/getAccounts", "https://dashboard.example.com", http.MethodGet)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "GET", resp.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, X-Api-Key", resp.Header().Get("Access-Control-Allow-Headers"))
+
+	resp = corsRequest(engine, http.MethodOptions, apiPrefix+"/missing", "https://dashboard.example.com", http.MethodGet)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = corsRequest(engine, http.MethodOptions, apiPrefix+"/getAccounts", "https://evil.example.com", http.MethodGet)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+
+	resp = corsRequest(engine, http.MethodGet, apiPrefix+"/getAccounts", "https://dashboard.example.com", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Actual requests should still require authentication")
+	assert.Equal(t, "https://dashboard.example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSDefaultSameOrigin(t *testing.T) {
+	engine := corsTestServer(t, CORS{})
+	resp := corsRequest(engine, http.MethodOptions, apiPrefix+"/getAccounts", "https://dashboard.example.com", http.MethodGet)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, resp.Header().Get("Vary"))
+}
+
+func TestCORSWildcard(t *testing.T) {
+	engine := corsTestServer(t, CORS{Origins: []string{"*"}})
+	resp := corsRequest(engine, http.MethodOptions, apiPrefix+"/getAccounts", "https://anywhere.example.com", http.MethodGet)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "*", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, resp.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSValidate(t *testing.T) {
+	for _, tc := range []struct {
+		description string
+		config      CORS
+		expectErr   string
+	}{
+		{description: "default", config: CORS{}},
+		{description: "exact origins", config: CORS{Origins: []string{"https://example.com", "http://localhost:3000"}, AllowCredentials: true}},
+		{description: "wildcard", config: CORS{Origins: []string{"*"}}},
+		{
+			description: "wildcard with credentials",
+			config:      CORS{Origins: []string{"*"}, AllowCredentials: true},
+			expectErr:   "CORS credentials can't be allowed for every origin, list each allowed origin instead",
+		},
+		{
+			description: "origin with path",
+			config:      CORS{Origins: []string{"https://example.com/app"}},
+			expectErr:   `Invalid CORS origin, must be a scheme and host like https://example.com: "https://example.com/app"`,
+		},
+		{
+			description: "negative max age",
+			config:      CORS{MaxAge: -time.Second},
+			expectErr:   "CORS max age must not be negative: -1s",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"/api/v1/getAccounts", "/api/v1/getAccounts", true},
+		{"/api/v1/getAccounts", "/api/v1/getAccount", false},
+		{"/api/v1/accounts/:id/statement", "/api/v1/accounts/1234/statement", true},
+		{"/api/v1/accounts/:id/statement", "/api/v1/accounts//statement", false},
+		{"/api/v1/accounts/:id", "/api/v1/accounts/1234/statement", false},
+		{"/web/*filepath", "/web/static/app.js", true},
+	} {
+		assert.Equal(t, tc.match, matchRoute(tc.pattern, tc.path), "%s %s", tc.pattern, tc.path)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/settings"
+)
+
+// homeCurrency returns the configured home currency's format, or the default currency's if settings are unavailable
+func homeCurrency(settingsStore *settings.Store) model.CurrencyFormat {
+	if settingsStore != nil {
+		if current, err := settingsStore.Settings(); err == nil {
+			return current.HomeCurrencyFormat()
+		}
+	}
+	return model.NewCurrencyFormat(model.DefaultCurrencyCode)
+}
+
+// currencyFormats resolves ledger accounts' currency formats
+type currencyFormats struct {
+	accountIDMap     txnToAccountMap
+	ledgerCurrencies map[string]string
+	home             model.CurrencyFormat
+}
+
+func newCurrencyFormats(ldg *ledger.Ledger, accountStore *client.AccountStore, settingsStore *settings.Store) (*currencyFormats, error) {
+	accountIDMap, err := newAccountIDMap(accountStore)
+	return &currencyFormats{
+		accountIDMap:     accountIDMap,
+		ledgerCurrencies: ldg.AccountCurrencies(),
+		home:             homeCurrency(settingsStore),
+	}, err
+}
+
+// get returns the currency format of ledger account 'name', from its client account's currency, its postings' currency, or the home currency in that order
+func (f *currencyFormats) get(name string) model.CurrencyFormat {
+	return f.getWithCurrency(name, f.ledgerCurrencies[name])
+}
+
+// getWithCurrency is like get, but derives the format from 'ledgerCurrency' instead of the account's latest posting
+func (f *currencyFormats) getWithCurrency(name, ledgerCurrency string) model.CurrencyFormat {
+	account, _ := f.accountIDMap.Find(name)
+	return model.ResolveCurrencyFormat(account, ledgerCurrency, f.home)
+}
+
+// forAccount returns the currency format of client account 'account'
+func (f *currencyFormats) forAccount(account model.Account) model.CurrencyFormat {
+	return model.ResolveCurrencyFormat(account, f.ledgerCurrencies[model.LedgerAccountName(account)], f.home)
+}
+
+// setCurrencyFormats sets the currency format of each account in 'resp', and the home currency they fall back to
+func setCurrencyFormats(resp *BalanceResponse, formats *currencyFormats) {
+	resp.HomeCurrency = formats.home
+	for _, accounts := range [][]AccountResponse{resp.Accounts, resp.ClosedAccounts} {
+		for i := range accounts {
+			accounts[i].CurrencyFormat = formats.getWithCurrency(accounts[i].ID, accounts[i].Currency)
+		}
+	}
+}
+
+// currencyChangeWarning returns a warning if 'account's new currency differs from the currency of its existing postings, or an empty string otherwise
+func currencyChangeWarning(ldg *ledger.Ledger, currentAccount, account model.Account) string {
+	format := model.AccountCurrencyFormat(account)
+	current := model.AccountCurrencyFormat(currentAccount)
+	if format == nil || (current != nil && current.Code == format.Code) {
+		return ""
+	}
+	var others []string
+	for _, currency := range ldg.PostingCurrencies(model.LedgerAccountName(currentAccount)) {
+		if posted, ok := model.LedgerCurrencyFormat(currency); !ok || posted.Code != format.Code {
+			others = append(others, currency)
+		}
+	}
+	if len(others) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Existing transactions for this account use %s, not %s. Changing the currency only changes how amounts are displayed, existing transactions are not converted", strings.Join(others, ", "), format.Code)
+}
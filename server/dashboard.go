@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/settings"
+	"github.com/johnstarich/sage/sync"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const defaultDashboardRecent = 10
+
+// dashboardResponse combines the data for an overview page, so it loads with a single request
+type dashboardResponse struct {
+	// Balances contains each asset and liability account's current balance
+	Balances BalanceResponse
+	// Recent contains the most recent transactions, newest last
+	Recent transactionsResponse
+	// Categories maps expense and revenue categories to their totals since the start of the month
+	Categories map[string]decimal.Decimal
+	MonthStart time.Time
+	SyncStatus map[string]interface{}
+}
+
+// getDashboard responds with balances, recent transactions, this month's category totals, and sync status.
+// Sets an ETag from the response content, so clients polling with If-None-Match only download changes.
+func getDashboard(ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store, prober *sync.Prober) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recent := defaultDashboardRecent
+		if recentQuery, ok := c.GetQuery("recent"); ok {
+			parsedRecent, err := strconv.Atoi(recentQuery)
+			if err != nil || parsedRecent < 1 || parsedRecent > MaxResults {
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Recent must be a positive integer no more than %d: %q", MaxResults, recentQuery))
+				return
+			}
+			recent = parsedRecent
+		}
+		dateBasis, ok := queryDateBasis(c, settingsStore)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		ldg := scopedLedger(c, ldgStore.Ledger)
+		balances, err := getBalancesResponse(ldg, accountStore, getScope(c), nil, &now, dateBasis)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		formats, err := newCurrencyFormats(ldg, accountStore, settingsStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		setCurrencyFormats(&balances, formats)
+		recentTxns, err := newTransactionsResponse(ldg.Query(ledger.QueryOptions{}, 1, recent), accountStore, formats.home)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		monthStart := startOfMonth(now)
+		resp := dashboardResponse{
+			Balances:   balances,
+			Recent:     recentTxns,
+			Categories: categoryTotals(ldg, monthStart, now, dateBasis),
+			MonthStart: monthStart,
+			SyncStatus: ledgerSyncStatus(ldgStore, prober),
+		}
+
+		body, err := json.Marshal(resp)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		etag := contentETag(body)
+		c.Header("ETag", etag)
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+// categoryTotals returns the sum of each expense and revenue category's postings between start and end
+func categoryTotals(ldg *ledger.Ledger, start, end time.Time, dateBasis ledger.DateBasis) map[string]decimal.Decimal {
+	totals := make(map[string]decimal.Decimal)
+	for account, balance := range ldg.LeftOverAccountBalancesBy(start, end, dateBasis, model.AssetAccount, model.LiabilityAccount) {
+		if account == model.Uncategorized || (strings.Contains(account, ":") && isCategory(ldg, account)) {
+			totals[account] = balance
+		}
+	}
+	return totals
+}
+
+// contentETag returns a strong ETag for a response body
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches returns true if an If-None-Match header value contains 'etag'
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategoryTotals(t *testing.T) {
+	ldg, err := ledger.NewFromReader(strings.NewReader(`
+2019/04/30 Last month
+	assets:bank   $-5
+	expenses:food
+
+2019/05/02 Groceries
+	assets:bank   $-10
+	expenses:food
+
+2019/05/03 Paycheck
+	assets:bank   $100
+	revenues:salary
+
+2019/05/04 Unknown
+	assets:bank   $-1
+	uncategorized
+`))
+	require.NoError(t, err)
+
+	start := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 5, 31, 0, 0, 0, 0, time.UTC)
+	totals := make(map[string]string)
+	for account, total := range categoryTotals(ldg, start, end, ledger.PostingBasis) {
+		totals[account] = total.String()
+	}
+	assert.Equal(t, map[string]string{
+		"expenses:food":   "10",
+		"revenues:salary": "-100",
+		"uncategorized":   "1",
+	}, totals)
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := contentETag([]byte(`{"Balances":{}}`))
+	assert.Equal(t, etag, contentETag([]byte(`{"Balances":{}}`)))
+	assert.NotEqual(t, etag, contentETag([]byte(`{"Balances":null}`)))
+
+	assert.True(t, etagMatches(etag, etag))
+	assert.True(t, etagMatches(`"other", W/`+etag, etag))
+	assert.True(t, etagMatches("*", etag))
+	assert.False(t, etagMatches("", etag))
+	assert.False(t, etagMatches(`"other"`, etag))
+}
@@ -4,6 +4,17 @@ import (
 	"net/http"
 	"os"
 	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	webIndexFile    = "/index.html"
+	webStaticPrefix = "/static/"
+
+	// static assets have content hashes in their names, so they never change
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	noCacheControl        = "no-cache"
 )
 
 type defaultRouteFS struct {
@@ -23,7 +34,7 @@ func newDefaultRouteFS(defaultFile string, fs http.FileSystem, staticPrefixes ..
 
 func (d *defaultRouteFS) Open(name string) (http.File, error) {
 	f, err := d.fs.Open(name)
-	if err == os.ErrNotExist && d.isNotPrefixed(name) {
+	if os.IsNotExist(err) && d.isNotPrefixed(name) {
 		return d.fs.Open(d.defaultFile)
 	}
 	return f, err
@@ -37,3 +48,34 @@ func (d *defaultRouteFS) isNotPrefixed(name string) bool {
 	}
 	return true
 }
+
+// webFS returns the web UI's file system, serving from 'dir' if set or the embedded assets otherwise.
+// Unknown routes fall back to index.html, except for missing static assets.
+func webFS(dir string) http.FileSystem {
+	var fs http.FileSystem
+	if dir != "" {
+		fs = http.Dir(dir)
+	} else {
+		fs = AssetFile()
+	}
+	return newDefaultRouteFS(webIndexFile, fs, webStaticPrefix)
+}
+
+// setupWeb serves the web UI from 'fs' on 'router' with cache headers. Existing static assets are cached indefinitely, everything else is revalidated.
+func setupWeb(router *gin.RouterGroup, fs http.FileSystem) {
+	fileServer := http.StripPrefix(router.BasePath(), http.FileServer(fs))
+	handler := func(c *gin.Context) {
+		name := c.Param("filepath")
+		cacheControl := noCacheControl
+		if strings.HasPrefix(name, webStaticPrefix) {
+			if f, err := fs.Open(name); err == nil {
+				f.Close()
+				cacheControl = immutableCacheControl
+			}
+		}
+		c.Header("Cache-Control", cacheControl)
+		fileServer.ServeHTTP(c.Writer, c.Request)
+	}
+	router.GET("/*filepath", handler)
+	router.HEAD("/*filepath", handler)
+}
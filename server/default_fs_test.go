@@ -0,0 +1,61 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebFS(t *testing.T) {
+	embedded, ok := webFS("").(*defaultRouteFS)
+	require.True(t, ok)
+	assert.IsType(t, AssetFile(), embedded.fs, "Embedded mode should serve the built-in assets")
+
+	external, ok := webFS("some dir").(*defaultRouteFS)
+	require.True(t, ok)
+	assert.Equal(t, http.Dir("some dir"), external.fs)
+	assert.Equal(t, webIndexFile, external.defaultFile)
+	assert.Equal(t, []string{webStaticPrefix}, external.staticPrefixes)
+}
+
+func TestSetupWeb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "static", "js"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "static", "js", "main.abc123.js"), []byte("script"), 0600))
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	setupWeb(engine.Group("/web"), webFS(dir))
+
+	for _, tc := range []struct {
+		path         string
+		status       int
+		body         string
+		cacheControl string
+	}{
+		{path: "/web/", status: http.StatusOK, body: "index", cacheControl: noCacheControl},
+		{path: "/web/accounts/some-account", status: http.StatusOK, body: "index", cacheControl: noCacheControl},
+		{path: "/web/static/js/main.abc123.js", status: http.StatusOK, body: "script", cacheControl: immutableCacheControl},
+		{path: "/web/static/js/missing.js", status: http.StatusNotFound, cacheControl: noCacheControl},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			engine.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.status, resp.Code)
+			assert.Equal(t, tc.cacheControl, resp.Header().Get("Cache-Control"))
+			if tc.body != "" {
+				assert.Equal(t, tc.body, resp.Body.String())
+			}
+		})
+	}
+}
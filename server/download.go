@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+)
+
+const (
+	// downloadTokenHeader identifies the snapshot a download serves. Send it back as the 'token' query to fetch more ranges of the same content.
+	downloadTokenHeader = "X-Download-Token"
+	// downloadHashHeader is the SHA-256 hash of the snapshot's full content, to verify a reassembled download
+	downloadHashHeader = "X-Content-SHA256"
+	// downloadSnapshotTTL is how long a snapshot is kept after its latest request
+	downloadSnapshotTTL = 10 * time.Minute
+	// maxDownloadSnapshots is the most snapshots kept at once. Every download without a token stores one, so the least recently used are evicted first.
+	maxDownloadSnapshots = 10
+)
+
+// downloadSnapshot is one version of a download's content, kept so ranged requests never mix bytes from different versions
+type downloadSnapshot struct {
+	name        string
+	contentType string
+	content     []byte
+	hash        string
+	etag        string
+	modTime     time.Time
+}
+
+// downloadSnapshots holds recently downloaded content by token. A nil downloadSnapshots serves every request from fresh content.
+type downloadSnapshots struct {
+	mu        sync.Mutex
+	snapshots *cache.Cache
+	max       int
+}
+
+func newDownloadSnapshots(ttl time.Duration, max int) *downloadSnapshots {
+	return &downloadSnapshots{
+		snapshots: cache.New(ttl, ttl*2),
+		max:       max,
+	}
+}
+
+// get returns the snapshot for 'token' and extends its expiration
+func (d *downloadSnapshots) get(token string) (downloadSnapshot, bool) {
+	if d == nil {
+		return downloadSnapshot{}, false
+	}
+	snapshot, found := d.snapshots.Get(token)
+	if !found {
+		return downloadSnapshot{}, false
+	}
+	d.snapshots.SetDefault(token, snapshot)
+	return snapshot.(downloadSnapshot), true
+}
+
+// add stores 'snapshot' and returns its new token. Evicts the snapshots expiring soonest if already holding the max.
+func (d *downloadSnapshots) add(snapshot downloadSnapshot) string {
+	if d == nil {
+		return ""
+	}
+	// URL-safe, since tokens are sent back in a query
+	token := strings.NewReplacer("+", "-", "/", "_", "=", "").Replace(randomToken(24))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	items := d.snapshots.Items()
+	for len(items) >= d.max {
+		var oldestToken string
+		var oldest int64
+		for itemToken, item := range items {
+			if oldestToken == "" || item.Expiration < oldest {
+				oldestToken, oldest = itemToken, item.Expiration
+			}
+		}
+		d.snapshots.Delete(oldestToken)
+		delete(items, oldestToken)
+	}
+	d.snapshots.SetDefault(token, snapshot)
+	return token
+}
+
+// serveDownload responds with content from 'generate', or from the snapshot named by the 'token' query.
+// Supports Range, If-Range, and HEAD requests. Every response includes a token for the snapshot it served.
+// Responds with 412 Precondition Failed if the token's snapshot expired, so clients restart instead of mixing versions.
+func serveDownload(c *gin.Context, downloads *downloadSnapshots, generate func() (downloadSnapshot, error)) {
+	var snapshot downloadSnapshot
+	token := c.Query("token")
+	if token != "" {
+		var found bool
+		snapshot, found = downloads.get(token)
+		if !found {
+			abortWithClientError(c, http.StatusPreconditionFailed, errors.New("Download expired or changed, restart it without a token"))
+			return
+		}
+	} else {
+		var err error
+		snapshot, err = generate()
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		sum := sha256.Sum256(snapshot.content)
+		snapshot.hash = hex.EncodeToString(sum[:])
+		snapshot.etag = contentETag(snapshot.content)
+		if snapshot.modTime.IsZero() {
+			snapshot.modTime = time.Now()
+		}
+		token = downloads.add(snapshot)
+	}
+
+	if token != "" {
+		c.Header(downloadTokenHeader, token)
+	}
+	c.Header(downloadHashHeader, snapshot.hash)
+	c.Header("ETag", snapshot.etag)
+	c.Header("Content-Type", snapshot.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", snapshot.name))
+	// ServeContent sets Accept-Ranges, handles Range and If-Range, and omits the body for HEAD requests
+	http.ServeContent(c.Writer, c.Request, snapshot.name, snapshot.modTime, bytes.NewReader(snapshot.content))
+}
+
+// getLedgerFile responds with the ledger file's contents. See serveDownload for resuming downloads.
+func getLedgerFile(ldgStore *ledger.Store, downloads *downloadSnapshots) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serveDownload(c, downloads, func() (downloadSnapshot, error) {
+			return downloadSnapshot{
+				name:        "ledger.journal",
+				contentType: "text/plain; charset=utf-8",
+				content:     []byte(ldgStore.String()),
+			}, nil
+		})
+	}
+}
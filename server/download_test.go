@@ -0,0 +1,100 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestResumableLedgerDownload(t *testing.T) {
+	ldgStore, err := ledger.NewStore(&memFile{data: []byte(scopeTestLedger)}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	downloads := newDownloadSnapshots(time.Minute, maxDownloadSnapshots)
+	engine := gin.New()
+	logger := zaptest.NewLogger(t)
+	engine.Use(func(c *gin.Context) {
+		c.Set(loggerKey, logger)
+	})
+	engine.GET("/ledgerFile", getLedgerFile(ldgStore, downloads))
+	engine.HEAD("/ledgerFile", getLedgerFile(ldgStore, downloads))
+	request := func(method, path, byteRange string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+		}
+		resp := httptest.NewRecorder()
+		engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	original := ldgStore.String()
+	head := request(http.MethodHead, "/ledgerFile", "")
+	require.Equal(t, http.StatusOK, head.Code)
+	assert.Empty(t, head.Body.String())
+	assert.Equal(t, "bytes", head.Header().Get("Accept-Ranges"))
+	assert.Equal(t, strconv.Itoa(len(original)), head.Header().Get("Content-Length"))
+	sum := sha256.Sum256([]byte(original))
+	assert.Equal(t, hex.EncodeToString(sum[:]), head.Header().Get(downloadHashHeader))
+	token := head.Header().Get(downloadTokenHeader)
+	require.NotEmpty(t, token)
+
+	const chunkSize = 50
+	var downloaded []byte
+	for start := 0; start < len(original); start += chunkSize {
+		// a sync writes to the ledger between every chunk
+		require.NoError(t, ldgStore.AddTransactions([]ledger.Transaction{{
+			Date:  time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC),
+			Payee: fmt.Sprintf("interleaved %d", start),
+			Postings: []ledger.Posting{
+				{Account: "assets:savings bank:****1111", Amount: decimal.NewFromFloat(1), Tags: map[string]string{"id": fmt.Sprintf("interleaved-%d", start)}},
+				{Account: "revenues:interest", Amount: decimal.NewFromFloat(-1)},
+			},
+		}}))
+		resp := request(http.MethodGet, "/ledgerFile?token="+token, fmt.Sprintf("bytes=%d-%d", start, start+chunkSize-1))
+		require.Equal(t, http.StatusPartialContent, resp.Code, resp.Body.String())
+		assert.Equal(t, token, resp.Header().Get(downloadTokenHeader))
+		downloaded = append(downloaded, resp.Body.Bytes()...)
+	}
+	assert.Equal(t, original, string(downloaded), "Ranges should reassemble the snapshot byte-for-byte")
+	assert.NotEqual(t, original, ldgStore.String())
+
+	fresh := request(http.MethodGet, "/ledgerFile", "")
+	require.Equal(t, http.StatusOK, fresh.Code)
+	assert.Equal(t, ldgStore.String(), fresh.Body.String(), "Downloads without a token should serve the latest content")
+	assert.NotEqual(t, token, fresh.Header().Get(downloadTokenHeader))
+
+	downloads.snapshots.Flush()
+	expired := request(http.MethodGet, "/ledgerFile?token="+token, "bytes=0-9")
+	assert.Equal(t, http.StatusPreconditionFailed, expired.Code)
+}
+
+func TestDownloadSnapshotsEvictOldest(t *testing.T) {
+	downloads := newDownloadSnapshots(time.Minute, 2)
+	first := downloads.add(downloadSnapshot{name: "first"})
+	time.Sleep(time.Millisecond)
+	second := downloads.add(downloadSnapshot{name: "second"})
+	time.Sleep(time.Millisecond)
+	_, found := downloads.get(first) // extends the first snapshot past the second
+	require.True(t, found)
+	third := downloads.add(downloadSnapshot{name: "third"})
+
+	assert.Equal(t, 2, downloads.snapshots.ItemCount())
+	_, found = downloads.get(second)
+	assert.False(t, found, "The snapshot expiring soonest should be evicted")
+	for _, token := range []string{first, third} {
+		_, found = downloads.get(token)
+		assert.True(t, found)
+	}
+}
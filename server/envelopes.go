@@ -0,0 +1,146 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/envelope"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// ledgerBalance returns an envelope.AccountBalance with accounts' current ledger balances
+func ledgerBalance(ldgStore *ledger.Store) envelope.AccountBalance {
+	return func(account string) decimal.Decimal {
+		return ldgStore.BalancesAsOf(time.Now())[account]
+	}
+}
+
+// abortWithEnvelopeError aborts with the shortfall amount for ShortfallErrors, or a bad request otherwise
+func abortWithEnvelopeError(c *gin.Context, err error) {
+	if shortfall, ok := errors.Cause(err).(envelope.ShortfallError); ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, map[string]interface{}{
+			"Error":     shortfall.Error(),
+			"Shortfall": shortfall.Shortfall,
+		})
+		return
+	}
+	abortWithClientError(c, http.StatusBadRequest, err)
+}
+
+func getEnvelopes(store *envelope.Store, ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		summaries, err := store.Summaries(ledgerBalance(ldgStore))
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Accounts": summaries,
+		})
+	}
+}
+
+func addEnvelope(store *envelope.Store, ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var newEnvelope envelope.Envelope
+		if err := c.ShouldBindJSON(&newEnvelope); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if _, exists := ldgStore.BalancesAsOf(time.Now())[newEnvelope.Account]; !exists {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Account not found in ledger: %q", newEnvelope.Account))
+			return
+		}
+		if err := store.Add(newEnvelope); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// fundEnvelope allocates money from an account's unallocated balance to an envelope, or releases it back if negative
+func fundEnvelope(store *envelope.Store, ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Name   string
+			Amount decimal.Decimal
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := store.Fund(body.Name, body.Amount, ledgerBalance(ldgStore)); err != nil {
+			abortWithEnvelopeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// moveEnvelopeMoney moves money between two envelopes of the same account without changing the ledger
+func moveEnvelopeMoney(store *envelope.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			From, To string
+			Amount   decimal.Decimal
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := store.Move(body.From, body.To, body.Amount); err != nil {
+			abortWithEnvelopeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// spendFromEnvelope links a ledger transaction to an envelope, spending its amount or the given partial amount from the envelope
+func spendFromEnvelope(store *envelope.Store, ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Name          string
+			TransactionID string
+			Amount        decimal.Decimal
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		txn, found := ldgStore.Transaction(body.TransactionID)
+		if !found {
+			abortWithClientError(c, http.StatusNotFound, errors.Errorf("Transaction not found by ID: %q", body.TransactionID))
+			return
+		}
+		if err := store.Spend(body.Name, txn, body.Amount); err != nil {
+			abortWithEnvelopeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// deleteEnvelope removes an envelope. A nonzero balance must either move to envelope 'MoveTo' or be released to the account with 'Release'.
+func deleteEnvelope(store *envelope.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Name    string
+			MoveTo  string
+			Release bool
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := store.Remove(body.Name, body.MoveTo, body.Release); err != nil {
+			abortWithEnvelopeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	sErrors "github.com/johnstarich/sage/errors"
+	"github.com/johnstarich/sage/fx"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/settings"
+	"github.com/shopspring/decimal"
+)
+
+const currencyQuery = "currency"
+
+// fxCurrency returns the ISO 4217 code for a currency symbol or code, like "USD" for "$", which exchange rates are recorded under.
+// Unknown currencies are returned unchanged.
+func fxCurrency(currency string) string {
+	if format, ok := model.LedgerCurrencyFormat(currency); ok {
+		return format.Code
+	}
+	return currency
+}
+
+func getFXRates(db plaindb.DB) gin.HandlerFunc {
+	store, err := fx.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		rates, err := store.All()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Rates": rates,
+		})
+	}
+}
+
+func updateFXRate(db plaindb.DB) gin.HandlerFunc {
+	store, err := fx.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		var rate fx.Rate
+		if err := c.ShouldBindJSON(&rate); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		rate.Source = fx.ManualSource
+		if err := store.Add(rate); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func importFXRates(db plaindb.DB) gin.HandlerFunc {
+	store, err := fx.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		body, ok := readUpload(c)
+		if !ok {
+			return
+		}
+		defer body.Close()
+		imported, err := store.Import(body)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Imported": imported,
+		})
+	}
+}
+
+func getNetWorth(db plaindb.DB, ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store) gin.HandlerFunc {
+	fxStore, err := fx.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		balances, err := getBalancesResponse(ldgStore.Ledger, accountStore, nil, nil, nil, ledger.PostingBasis)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		formats, err := newCurrencyFormats(ldgStore.Ledger, accountStore, settingsStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		setCurrencyFormats(&balances, formats)
+		currency := c.DefaultQuery(currencyQuery, formats.home.Code)
+		if err := convertBalances(&balances, fxStore, currency); err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		var netWorth []decimal.Decimal
+		var excludedAccounts []string
+		// closed accounts still count toward net worth until their closure, after which their balances are zero
+		allAccounts := append(append([]AccountResponse(nil), balances.Accounts...), balances.ClosedAccounts...)
+		for _, account := range allAccounts {
+			if !isFullyConverted(account) {
+				excludedAccounts = append(excludedAccounts, account.ID)
+				continue
+			}
+			if netWorth == nil {
+				netWorth = make([]decimal.Decimal, len(account.ConvertedBalances))
+			}
+			for i, balance := range account.ConvertedBalances {
+				netWorth[i] = netWorth[i].Add(*balance)
+			}
+		}
+
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Start":            balances.Start,
+			"End":              balances.End,
+			"Currency":         balances.Currency,
+			"NetWorth":         netWorth,
+			"MissingRates":     balances.MissingRates,
+			"ExcludedAccounts": excludedAccounts,
+		})
+	}
+}
+
+func isFullyConverted(account AccountResponse) bool {
+	for _, balance := range account.ConvertedBalances {
+		if balance == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// convertBalances fills in each account's ConvertedBalances in the 'base' currency, using the nearest-dated rate to the end of each month
+// Accounts convert from their CurrencyFormat, so call setCurrencyFormats first.
+// Accounts without an exchange rate are reported in MissingRates and Messages, rather than assuming a 1:1 rate
+func convertBalances(resp *BalanceResponse, fxStore *fx.Store, base string) error {
+	base = fxCurrency(base)
+	resp.Currency = base
+	if resp.Start == nil {
+		return nil
+	}
+	start := time.Date(resp.Start.Year(), resp.Start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	missingRates := make(map[fx.MissingRate]bool)
+	for _, accounts := range [][]AccountResponse{resp.Accounts, resp.ClosedAccounts} {
+		if err := convertAccountBalances(resp, accounts, start, missingRates, fxStore, base); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertAccountBalances(resp *BalanceResponse, accounts []AccountResponse, start time.Time, missingRates map[fx.MissingRate]bool, fxStore *fx.Store, base string) error {
+	for ix := range accounts {
+		account := &accounts[ix]
+		if len(account.Balances) == 0 {
+			continue
+		}
+		// resolved by setCurrencyFormats from the account's currency setting, its postings' commodity, or the home currency
+		account.Currency = account.CurrencyFormat.Code
+		if account.Currency == "" {
+			account.Currency = base
+		}
+		account.ConvertedBalances = make([]*decimal.Decimal, len(account.Balances))
+		for i, balance := range account.Balances {
+			date := start.AddDate(0, i+1, -1) // end of month
+			if date.After(*resp.End) {
+				date = *resp.End
+			}
+			converted, err := fxStore.Convert(balance, account.Currency, base, date)
+			var missingErr fx.MissingRateError
+			if sErrors.As(err, &missingErr) {
+				if !missingRates[missingErr.MissingRate] {
+					missingRates[missingErr.MissingRate] = true
+					resp.MissingRates = append(resp.MissingRates, missingErr.MissingRate)
+				}
+				resp.Messages = append(resp.Messages, AccountMessage{
+					AccountID:   account.ID,
+					AccountName: account.Account,
+					Message:     fmt.Sprintf("Missing exchange rate from %s to %s", account.Currency, base),
+				})
+				break
+			}
+			if err != nil {
+				return err
+			}
+			account.ConvertedBalances[i] = &converted
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/fx"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFXCurrency(t *testing.T) {
+	assert.Equal(t, "USD", fxCurrency("$"))
+	assert.Equal(t, "EUR", fxCurrency("€"))
+	assert.Equal(t, "GBP", fxCurrency("GBP"))
+	assert.Equal(t, "points", fxCurrency("points"))
+}
+
+func TestConvertBalances(t *testing.T) {
+	fxStore, err := fx.NewStore(plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}}))
+	require.NoError(t, err)
+	date := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, fxStore.Add(fx.Rate{From: "EUR", To: "USD", Date: date, Rate: decimal.NewFromFloat(1.5)}))
+
+	resp := BalanceResponse{
+		Start: &date,
+		End:   &date,
+		Accounts: []AccountResponse{
+			{ID: "assets:euros", Currency: "€", CurrencyFormat: model.NewCurrencyFormat("EUR"), Balances: []decimal.Decimal{decimal.NewFromFloat(10)}},
+			{ID: "assets:dollars", Currency: "$", CurrencyFormat: model.NewCurrencyFormat("USD"), Balances: []decimal.Decimal{decimal.NewFromFloat(2)}},
+		},
+	}
+	require.NoError(t, convertBalances(&resp, fxStore, "$"))
+	assert.Equal(t, "USD", resp.Currency, "Currency symbols should convert with their ISO code")
+	assert.Empty(t, resp.MissingRates)
+	require.Len(t, resp.Accounts[0].ConvertedBalances, 1)
+	assert.Equal(t, "15", resp.Accounts[0].ConvertedBalances[0].String())
+	require.Len(t, resp.Accounts[1].ConvertedBalances, 1)
+	assert.Equal(t, "2", resp.Accounts[1].ConvertedBalances[0].String())
+}
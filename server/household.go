@@ -0,0 +1,309 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/settings"
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+const (
+	householdPeerTimeout  = 5 * time.Second
+	householdPeerCacheTTL = time.Minute
+	// maxHouseholdPeerResponse limits how much of a peer's response is read
+	maxHouseholdPeerResponse = 10 << 20
+
+	localHouseholdSource     = "local"
+	peerHouseholdSource      = "peer"
+	defaultHouseholdPeerName = "Peer"
+)
+
+// categoryTotalsResponse contains expense and revenue category totals for the month up to End
+type categoryTotalsResponse struct {
+	Start, End time.Time
+	// Currency is the home currency, which category totals are reported in
+	Currency   model.CurrencyFormat
+	Categories map[string]decimal.Decimal
+}
+
+// getCategoryTotals responds with each category's total from the start of the 'asOf' query's month through 'asOf', defaulting to today
+func getCategoryTotals(ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		end := time.Now()
+		if asOfQuery := c.Query("asOf"); asOfQuery != "" {
+			date, err := time.Parse(asOfDateFormat, asOfQuery)
+			if err != nil {
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid as-of date, must be in YYYY-MM-DD format: %q", asOfQuery))
+				return
+			}
+			end = date
+		}
+		dateBasis, ok := queryDateBasis(c, settingsStore)
+		if !ok {
+			return
+		}
+		start := startOfMonth(end)
+		c.JSON(http.StatusOK, categoryTotalsResponse{
+			Start:      start,
+			End:        end,
+			Currency:   homeCurrency(settingsStore),
+			Categories: categoryTotals(scopedLedger(c, ldgStore.Ledger), start, end, dateBasis),
+		})
+	}
+}
+
+// householdDashboardResponse combines this instance's balances and category totals with a household peer's
+type householdDashboardResponse struct {
+	Instances []householdInstance
+	// Accounts contains every instance's asset and liability accounts. Accounts tracked by more than one instance are only included once.
+	Accounts []householdAccount
+	// NetWorth sums account balances by currency code. Currencies are never converted or combined.
+	NetWorth map[string]decimal.Decimal
+	// Categories sums each category's total this month by currency code, then category
+	Categories map[string]map[string]decimal.Decimal
+	MonthStart time.Time
+	// PeerTransactions contains the peer's recent transactions, only if enabled in the peer's settings
+	PeerTransactions json.RawMessage `json:",omitempty"`
+	// Warnings explain missing peer data, like when the peer is unreachable
+	Warnings []string `json:",omitempty"`
+}
+
+// householdInstance describes one instance's contribution to the household dashboard
+type householdInstance struct {
+	Name       string
+	Source     string
+	Currency   model.CurrencyFormat
+	Categories map[string]decimal.Decimal
+	// FetchedAt is when the peer's data was read, which may be up to a minute old
+	FetchedAt *time.Time `json:",omitempty"`
+}
+
+// householdAccount is an account's current balance, labeled with the instance it came from
+type householdAccount struct {
+	ID             string
+	Account        string
+	AccountType    string
+	Institution    string `json:",omitempty"`
+	Balance        decimal.Decimal
+	CurrencyFormat model.CurrencyFormat
+	// Sources contains the name of each instance tracking this account. The balance is from the first.
+	Sources []string
+}
+
+// householdSummary is the data read from one instance
+type householdSummary struct {
+	Balances     BalanceResponse
+	Categories   categoryTotalsResponse
+	Transactions json.RawMessage `json:",omitempty"`
+	FetchedAt    time.Time
+}
+
+// getHouseholdDashboard responds with this instance's and the household peer's balances and category totals, labeled by instance.
+// Responds with local data and a warning if the peer is unreachable.
+func getHouseholdDashboard(ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store, peer *householdPeer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current, err := settingsStore.Settings()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		dateBasis, ok := queryDateBasis(c, settingsStore)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		balances, err := getBalancesResponse(ldgStore.Ledger, accountStore, nil, nil, &now, dateBasis)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		formats, err := newCurrencyFormats(ldgStore.Ledger, accountStore, settingsStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		setCurrencyFormats(&balances, formats)
+		monthStart := startOfMonth(now)
+		local := householdSummary{
+			Balances: balances,
+			Categories: categoryTotalsResponse{
+				Start:      monthStart,
+				End:        now,
+				Currency:   formats.home,
+				Categories: categoryTotals(ldgStore.Ledger, monthStart, now, dateBasis),
+			},
+			FetchedAt: now,
+		}
+
+		resp := householdDashboardResponse{
+			NetWorth:   make(map[string]decimal.Decimal),
+			Categories: make(map[string]map[string]decimal.Decimal),
+			MonthStart: monthStart,
+		}
+		resp.add(localHouseholdSource, localHouseholdSource, local)
+		if current.Household.URL != "" {
+			name := current.Household.Name
+			if name == "" {
+				name = defaultHouseholdPeerName
+			}
+			summary, err := peer.summary(current.Household, now)
+			if err != nil {
+				logger := c.MustGet(loggerKey).(*zap.Logger)
+				logger.Warn("Household peer is unavailable, showing local data only", zap.String("peer", name), zap.Error(err))
+				resp.Warnings = append(resp.Warnings, "Showing local data only, "+name+" is unavailable: "+err.Error())
+			} else {
+				resp.add(name, peerHouseholdSource, summary)
+				resp.PeerTransactions = summary.Transactions
+			}
+		}
+		sort.Slice(resp.Accounts, func(a, b int) bool {
+			return resp.Accounts[a].ID < resp.Accounts[b].ID
+		})
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// add merges 'summary' from instance 'name' into the household totals.
+// Accounts are identified by their ledger account name, so an account both instances track only counts once.
+func (h *householdDashboardResponse) add(name, source string, summary householdSummary) {
+	instance := householdInstance{
+		Name:       name,
+		Source:     source,
+		Currency:   summary.Categories.Currency,
+		Categories: summary.Categories.Categories,
+	}
+	if source == peerHouseholdSource {
+		fetchedAt := summary.FetchedAt
+		instance.FetchedAt = &fetchedAt
+	}
+	h.Instances = append(h.Instances, instance)
+
+	for _, account := range summary.Balances.Accounts {
+		if existing := h.findAccount(account.ID); existing != nil {
+			existing.Sources = append(existing.Sources, name)
+			continue
+		}
+		var balance decimal.Decimal
+		if len(account.Balances) > 0 {
+			balance = account.Balances[len(account.Balances)-1]
+		}
+		format := account.CurrencyFormat
+		if format.Code == "" {
+			format = summary.Balances.HomeCurrency
+		}
+		h.Accounts = append(h.Accounts, householdAccount{
+			ID:             account.ID,
+			Account:        account.Account,
+			AccountType:    account.AccountType,
+			Institution:    account.Institution,
+			Balance:        balance,
+			CurrencyFormat: format,
+			Sources:        []string{name},
+		})
+		h.NetWorth[format.Code] = h.NetWorth[format.Code].Add(balance)
+	}
+
+	code := summary.Categories.Currency.Code
+	for category, total := range summary.Categories.Categories {
+		if h.Categories[code] == nil {
+			h.Categories[code] = make(map[string]decimal.Decimal)
+		}
+		h.Categories[code][category] = h.Categories[code][category].Add(total)
+	}
+}
+
+func (h *householdDashboardResponse) findAccount(id string) *householdAccount {
+	for i := range h.Accounts {
+		if h.Accounts[i].ID == id {
+			return &h.Accounts[i]
+		}
+	}
+	return nil
+}
+
+// householdPeer reads another Sage instance's balances and category totals through its API, reusing recent responses
+type householdPeer struct {
+	client    *http.Client
+	summaries *cache.Cache
+	now       func() time.Time
+}
+
+func newHouseholdPeer() *householdPeer {
+	return &householdPeer{
+		client:    &http.Client{Timeout: householdPeerTimeout},
+		summaries: cache.New(householdPeerCacheTTL, householdPeerCacheTTL*2),
+		now:       time.Now,
+	}
+}
+
+// summary returns 'peer's balances and category totals as of 'asOf'. Only reads recent transactions if the peer's settings include them.
+func (h *householdPeer) summary(peer settings.HouseholdPeer, asOf time.Time) (householdSummary, error) {
+	key := householdPeerCacheKey(peer)
+	if cached, found := h.summaries.Get(key); found {
+		return cached.(householdSummary), nil
+	}
+	asOfQuery := url.Values{"asOf": {asOf.Format(asOfDateFormat)}}
+	var summary householdSummary
+	if err := h.get(peer, "/getBalances", asOfQuery, &summary.Balances); err != nil {
+		return householdSummary{}, err
+	}
+	if err := h.get(peer, "/getCategoryTotals", asOfQuery, &summary.Categories); err != nil {
+		return householdSummary{}, err
+	}
+	if peer.IncludeTransactions {
+		query := url.Values{"results": {strconv.Itoa(defaultDashboardRecent)}}
+		if err := h.get(peer, "/getTransactions", query, &summary.Transactions); err != nil {
+			return householdSummary{}, err
+		}
+	}
+	summary.FetchedAt = h.now()
+	h.summaries.SetDefault(key, summary)
+	return summary, nil
+}
+
+func (h *householdPeer) get(peer settings.HouseholdPeer, path string, query url.Values, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, peer.URL+apiPrefix+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(apiKeyHeaderName, string(peer.APIKey))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed to contact household peer")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Household peer responded to %s with status %d", path, resp.StatusCode)
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxHouseholdPeerResponse)).Decode(v)
+	return errors.Wrapf(err, "Invalid household peer response from %s", path)
+}
+
+// householdPeerCacheKey hashes the peer's settings, so changing them skips cached responses and the API key never appears in plain text
+func householdPeerCacheKey(peer settings.HouseholdPeer) string {
+	hash := sha256.New()
+	for _, field := range []string{
+		peer.URL,
+		string(peer.APIKey),
+		strconv.FormatBool(peer.IncludeTransactions),
+	} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
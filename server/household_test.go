@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/settings"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHouseholdDashboardAdd(t *testing.T) {
+	usd, eur := model.NewCurrencyFormat("USD"), model.NewCurrencyFormat("EUR")
+	resp := householdDashboardResponse{
+		NetWorth:   make(map[string]decimal.Decimal),
+		Categories: make(map[string]map[string]decimal.Decimal),
+	}
+	resp.add(localHouseholdSource, localHouseholdSource, householdSummary{
+		Balances: BalanceResponse{
+			HomeCurrency: usd,
+			Accounts: []AccountResponse{
+				{ID: "assets:joint bank:1111", Balances: []decimal.Decimal{decimal.NewFromFloat(100)}},
+				{ID: "liabilities:card:2222", Balances: []decimal.Decimal{decimal.NewFromFloat(-30)}, CurrencyFormat: usd},
+			},
+		},
+		Categories: categoryTotalsResponse{
+			Currency:   usd,
+			Categories: map[string]decimal.Decimal{"expenses:food": decimal.NewFromFloat(30)},
+		},
+	})
+	resp.add("Alex", peerHouseholdSource, householdSummary{
+		Balances: BalanceResponse{
+			HomeCurrency: eur,
+			Accounts: []AccountResponse{
+				{ID: "assets:joint bank:1111", Balances: []decimal.Decimal{decimal.NewFromFloat(100)}, CurrencyFormat: usd},
+				{ID: "assets:savings:3333", Balances: []decimal.Decimal{decimal.NewFromFloat(50)}},
+			},
+		},
+		Categories: categoryTotalsResponse{
+			Currency:   eur,
+			Categories: map[string]decimal.Decimal{"expenses:food": decimal.NewFromFloat(20)},
+		},
+	})
+
+	require.Len(t, resp.Instances, 2)
+	assert.Nil(t, resp.Instances[0].FetchedAt)
+	assert.NotNil(t, resp.Instances[1].FetchedAt)
+	require.Len(t, resp.Accounts, 3)
+	assert.Equal(t, []string{localHouseholdSource, "Alex"}, resp.Accounts[0].Sources, "Accounts tracked by both instances should only count once")
+	assert.Equal(t, "70", resp.NetWorth["USD"].String())
+	assert.Equal(t, "50", resp.NetWorth["EUR"].String(), "Currencies should be summed separately")
+	assert.Equal(t, "30", resp.Categories["USD"]["expenses:food"].String())
+	assert.Equal(t, "20", resp.Categories["EUR"]["expenses:food"].String())
+}
+
+func TestHouseholdPeerSummary(t *testing.T) {
+	var requests []string
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(apiKeyHeaderName) != "secret key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case apiPrefix + "/getBalances":
+			w.Write([]byte(`{"Accounts": [{"ID": "assets:bank:1111", "Balances": ["12.5"]}]}`))
+		case apiPrefix + "/getCategoryTotals":
+			w.Write([]byte(`{"Currency": {"Code": "USD"}, "Categories": {"expenses:food": "5"}}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer peerServer.Close()
+
+	peer := newHouseholdPeer()
+	peerSettings := settings.HouseholdPeer{URL: peerServer.URL, APIKey: "secret key"}
+	summary, err := peer.summary(peerSettings, time.Now())
+	require.NoError(t, err)
+	require.Len(t, summary.Balances.Accounts, 1)
+	assert.Equal(t, "12.5", summary.Balances.Accounts[0].Balances[0].String())
+	assert.Equal(t, "5", summary.Categories.Categories["expenses:food"].String())
+	assert.Equal(t, []string{apiPrefix + "/getBalances", apiPrefix + "/getCategoryTotals"}, requests, "Transactions should not be read by default")
+
+	_, err = peer.summary(peerSettings, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, requests, 2, "Recent responses should be cached")
+
+	peerSettings.IncludeTransactions = true
+	_, err = peer.summary(peerSettings, time.Now())
+	assert.EqualError(t, err, "Household peer responded to /getTransactions with status 403")
+
+	peerServer.Close()
+	peerSettings.APIKey = "other key"
+	_, err = peer.summary(peerSettings, time.Now())
+	assert.Error(t, err)
+}
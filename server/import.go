@@ -0,0 +1,225 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/rules"
+	"github.com/johnstarich/sage/sync"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ofxImportSummary counts the outcome of importing one OFX file
+type ofxImportSummary struct {
+	// File is the imported file's name, only set for directory imports
+	File       string `json:",omitempty"`
+	Added      int
+	Duplicates int
+	// Deleted is the number of transactions skipped because they were deliberately deleted before
+	Deleted int
+	// Unmatched contains the ledger account names of accounts added for the file's unknown accounts
+	Unmatched   []string
+	Rejected    []string
+	Quarantined int
+	Dropped     int
+	// Error is set if the file was skipped, like when it's malformed
+	Error string `json:",omitempty"`
+}
+
+// importOFX adds parsed OFX transactions to the ledger, the same way for every import.
+// Transactions already in the ledger, by their FITID-derived IDs, are counted as duplicates and not added again.
+// Deleted transactions, recorded as tombstones, are counted separately and not added again either.
+// Unknown accounts are added as bare-bones accounts.
+func importOFX(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, guard *sync.Guard, skeletonAccounts []model.Account, txns []ledger.Transaction, logger *zap.Logger) (ofxImportSummary, error) {
+	var summary ofxImportSummary
+	var accounts []model.Account
+	var account model.Account
+	err := accountStore.Iter(&account, func(id string) bool {
+		accounts = append(accounts, account)
+		return true
+	})
+	if err != nil {
+		return summary, err
+	}
+	unmatched := client.MatchImportedAccounts(skeletonAccounts, txns, accounts)
+	txns = client.LocalizeDates(txns, accounts)
+	txns = client.SetTransactionCodes(txns, accounts)
+	txns = client.RouteCashWithdrawals(txns, accounts)
+	txns, closedErrs := client.RejectClosedTransactions(txns, accounts)
+	txns, dropped := client.FilterZeroAmounts(txns, accounts)
+	summary.Dropped = len(dropped)
+	summary.Rejected = make([]string, 0, len(closedErrs))
+	for _, closedErr := range closedErrs {
+		summary.Rejected = append(summary.Rejected, closedErr.Error())
+	}
+	if guard != nil {
+		var failed []ledger.Rejection
+		txns, failed = ledger.ScreenTransactions(txns)
+		if err := guard.HoldFailed(failed); err != nil && !ledger.IsPartial(err) {
+			return summary, err
+		}
+		summary.Quarantined = len(failed)
+	}
+	txns, assertions := ledger.SplitBalanceAssertions(txns)
+	seen := make(map[string]bool, len(txns))
+	for _, txn := range txns {
+		switch {
+		case isImportDuplicate(ldgStore, txn, seen):
+			summary.Duplicates++
+		case ldgStore.IsDeleted(txn):
+			summary.Deleted++
+		default:
+			summary.Added++
+		}
+	}
+	rulesStore.ApplyAll(txns)
+	ldgStore.LinkFees(rulesStore.FeeRule(), txns)
+	txns = append(txns, client.FilterBalanceAssertions(assertions, accounts)...)
+	if err := ldgStore.AddTransactions(txns); err != nil {
+		return summary, err
+	}
+
+	summary.Unmatched = make([]string, 0, len(unmatched))
+	for _, account := range unmatched {
+		summary.Unmatched = append(summary.Unmatched, model.LedgerAccountName(account))
+		if err := accountStore.Add(account); err != nil {
+			logger.Warn("Failed to add bare-bones account from imported file", zap.String("error", err.Error()))
+		}
+	}
+	return summary, nil
+}
+
+// isImportDuplicate returns true if any of txn's IDs are already in the ledger or 'seen', then adds them to 'seen'
+func isImportDuplicate(ldgStore *ledger.Store, txn ledger.Transaction, seen map[string]bool) bool {
+	ids := []string{txn.ID()}
+	for _, p := range txn.Postings {
+		ids = append(ids, p.ID())
+	}
+	duplicate := false
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, exists := ldgStore.Transaction(id); exists || seen[id] {
+			duplicate = true
+		}
+		seen[id] = true
+	}
+	return duplicate
+}
+
+// ofxDirectoryFile is a parsed OFX file awaiting import
+type ofxDirectoryFile struct {
+	name             string
+	skeletonAccounts []model.Account
+	txns             []ledger.Transaction
+	start            time.Time
+}
+
+// importDirectory imports every OFX and QFX file in a directory on the server, oldest statements first.
+// Malformed files are reported and skipped without stopping the rest of the import.
+func importDirectory(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, guard *sync.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := c.MustGet(loggerKey).(*zap.Logger)
+		var body struct {
+			Path string
+		}
+		if !readJSON(c, &body) {
+			return
+		}
+		if body.Path == "" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Path is required"))
+			return
+		}
+		entries, err := ioutil.ReadDir(body.Path)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Wrap(err, "Failed to read import directory"))
+			return
+		}
+
+		var files []ofxDirectoryFile
+		summaries := make([]ofxImportSummary, 0, len(entries))
+		for _, entry := range entries {
+			if entry.IsDir() || !isOFXFileName(entry.Name()) {
+				continue
+			}
+			file, err := readOFXDirectoryFile(filepath.Join(body.Path, entry.Name()))
+			if err != nil {
+				summaries = append(summaries, ofxImportSummary{File: entry.Name(), Error: err.Error()})
+				continue
+			}
+			files = append(files, file)
+		}
+		sort.SliceStable(files, func(a, b int) bool {
+			if !files[a].start.Equal(files[b].start) {
+				return files[a].start.Before(files[b].start)
+			}
+			return files[a].name < files[b].name
+		})
+
+		resp := struct {
+			Files                      []ofxImportSummary
+			Added, Duplicates, Deleted int
+			Unmatched, Failed          int
+		}{}
+		for _, file := range files {
+			summary, err := importOFX(ldgStore, accountStore, rulesStore, guard, file.skeletonAccounts, file.txns, logger)
+			summary.File = file.name
+			if err != nil {
+				logger.Warn("Skipping OFX file which failed to import", zap.String("file", file.name), zap.Error(err))
+				summary = ofxImportSummary{File: file.name, Error: err.Error()}
+			}
+			summaries = append(summaries, summary)
+		}
+		for _, summary := range summaries {
+			resp.Added += summary.Added
+			resp.Duplicates += summary.Duplicates
+			resp.Deleted += summary.Deleted
+			resp.Unmatched += len(summary.Unmatched)
+			if summary.Error != "" {
+				resp.Failed++
+			}
+		}
+		resp.Files = summaries
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func isOFXFileName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ofx", ".qfx":
+		return true
+	default:
+		return false
+	}
+}
+
+// readOFXDirectoryFile parses the OFX file at 'path', and finds its earliest transaction date for ordering imports
+func readOFXDirectoryFile(path string) (ofxDirectoryFile, error) {
+	file := ofxDirectoryFile{name: filepath.Base(path)}
+	f, err := os.Open(path)
+	if err != nil {
+		return file, err
+	}
+	defer f.Close()
+	file.skeletonAccounts, file.txns, err = client.ReadOFX(f)
+	if err != nil {
+		return file, errors.Wrap(err, "Malformed OFX file")
+	}
+	for _, txn := range file.txns {
+		if file.start.IsZero() || txn.Date.Before(file.start) {
+			file.start = txn.Date
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/rules"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func importTestStatement(start, fitID, amount string) string {
+	return `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<SIGNONMSGSRSV1>
+	<SONRS>
+		<STATUS>
+			<CODE>0
+			<SEVERITY>INFO
+		</STATUS>
+		<DTSERVER>20200110120000
+		<LANGUAGE>ENG
+		<FI>
+			<ORG>SOMEORG
+			<FID>1234
+		</FI>
+	</SONRS>
+</SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+	<STMTTRNRS>
+		<TRNUID>0
+		<STATUS>
+			<CODE>0
+			<SEVERITY>INFO
+		</STATUS>
+		<STMTRS>
+			<CURDEF>USD
+			<BANKACCTFROM>
+				<BANKID>5555
+				<ACCTID>11111234
+				<ACCTTYPE>CHECKING
+			</BANKACCTFROM>
+			<BANKTRANLIST>
+				<DTSTART>` + start + `
+				<DTEND>` + start + `
+				<STMTTRN>
+					<TRNTYPE>DEBIT
+					<DTPOSTED>` + start + `
+					<TRNAMT>` + amount + `
+					<FITID>` + fitID + `
+					<NAME>Some Shop
+				</STMTTRN>
+			</BANKTRANLIST>
+			<LEDGERBAL>
+				<BALAMT>100.00
+				<DTASOF>` + start + `
+			</LEDGERBAL>
+		</STMTRS>
+	</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+}
+
+func TestImportDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for name, contents := range map[string]string{
+		"b-january.qfx":  importTestStatement("20200102120000", "1", "-10.00"),
+		"a-february.OFX": importTestStatement("20200202120000", "2", "-20.00"),
+		"c-copy.qfx":     importTestStatement("20200102120000", "1", "-10.00"),
+		"broken.qfx":     "not OFX",
+		"notes.txt":      "not imported",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600))
+	}
+
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	require.NoError(t, accountStore.Add(&model.BasicAccount{
+		AccountID:          "11111234",
+		AccountDescription: "some checking",
+		AccountType:        model.AssetAccount,
+		BasicInstitution:   model.BasicInstitution{InstOrg: "SOMEORG", InstFID: "1234"},
+	}))
+	ldgStore, err := ledger.NewStore(&memFile{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	engine := gin.New()
+	logger := zaptest.NewLogger(t)
+	engine.Use(func(c *gin.Context) {
+		c.Set(loggerKey, logger)
+	})
+	engine.POST("/importDirectory", importDirectory(ldgStore, accountStore, rules.NewStore(nil), nil))
+
+	body, err := json.Marshal(map[string]string{"Path": dir})
+	require.NoError(t, err)
+	resp := httptest.NewRecorder()
+	engine.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/importDirectory", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var result struct {
+		Files                     []ofxImportSummary
+		Added, Duplicates, Failed int
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Added)
+	assert.Equal(t, 1, result.Duplicates)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Files, 4)
+	assert.Equal(t, "broken.qfx", result.Files[0].File)
+	assert.NotEmpty(t, result.Files[0].Error)
+	var order []string
+	for _, file := range result.Files[1:] {
+		order = append(order, file.File)
+		assert.Empty(t, file.Error)
+	}
+	assert.Equal(t, []string{"b-january.qfx", "c-copy.qfx", "a-february.OFX"}, order, "Files should import in date order")
+	assert.Equal(t, 1, result.Files[2].Duplicates)
+	assert.Equal(t, 2, ldgStore.Size())
+}
+
+func TestImportOFXCountsDeleted(t *testing.T) {
+	ldgStore, err := ledger.NewStore(&memFile{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	tombstones := newTombstoneStore(plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}}))
+	require.NoError(t, tombstones.Add("assets:bank", "deleted", time.Now()))
+	ldgStore.SetTombstones(tombstones)
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+
+	txn := func(id string) ledger.Transaction {
+		return ledger.Transaction{
+			Date:  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			Payee: "Some Shop",
+			Postings: []ledger.Posting{
+				{Account: "assets:bank", Amount: decimal.NewFromFloat(-1), Currency: "$", Tags: map[string]string{"id": id}},
+				{Account: "expenses:food", Amount: decimal.NewFromFloat(1), Currency: "$"},
+			},
+		}
+	}
+	summary, err := importOFX(ldgStore, accountStore, rules.NewStore(nil), nil, nil, []ledger.Transaction{txn("new"), txn("deleted")}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Added, "Deleted transactions should not be counted as added")
+	assert.Equal(t, 1, summary.Deleted)
+	assert.Equal(t, 0, summary.Duplicates)
+	assert.Equal(t, 1, ldgStore.Size())
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"sort"
@@ -10,13 +12,20 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/audit"
+	"github.com/johnstarich/sage/changeset"
 	"github.com/johnstarich/sage/client"
 	"github.com/johnstarich/sage/client/model"
 	sErrors "github.com/johnstarich/sage/errors"
+	"github.com/johnstarich/sage/fx"
+	"github.com/johnstarich/sage/journal"
 	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
 	"github.com/johnstarich/sage/prompter"
 	"github.com/johnstarich/sage/rules"
+	"github.com/johnstarich/sage/settings"
 	"github.com/johnstarich/sage/sync"
+	"github.com/johnstarich/sage/tombstone"
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
@@ -24,27 +33,42 @@ import (
 
 const (
 	accountTypesQuery = "accountTypes[]" // include [] suffix to support query param arrays
+	asOfDateFormat    = "2006-01-02"
+	displaySignQuery  = "displaySign"
+	// rawDisplaySign shows balances with the same signs as the ledger
+	rawDisplaySign = "raw"
+	// naturalDisplaySign flips revenue balances, so both expenses and revenues read as positive amounts
+	naturalDisplaySign = "natural"
 	// MaxResults is the maximum number of results from a paginated request
 	MaxResults = 50
 )
 
-func getLedgerSyncStatus(ldgStore *ledger.Store) gin.HandlerFunc {
+func getLedgerSyncStatus(ldgStore *ledger.Store, prober *sync.Prober) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var errs sErrors.Errors // used for its marshaler
-		syncing, prompt, err := ldgStore.SyncStatus()
-		errs.AddErr(err)
-		c.JSON(http.StatusOK, map[string]interface{}{
-			"Syncing": syncing,
-			"Prompt":  prompt,
-			"Errors":  errs.ErrOrNil(),
-		})
+		c.JSON(http.StatusOK, ledgerSyncStatus(ldgStore, prober))
+	}
+}
+
+// ledgerSyncStatus returns whether a sync is running, its prompt and errors, and the latest probe results
+func ledgerSyncStatus(ldgStore *ledger.Store, prober *sync.Prober) map[string]interface{} {
+	var errs sErrors.Errors // used for its marshaler
+	syncing, prompt, err := ldgStore.SyncStatus()
+	errs.AddErr(err)
+	return map[string]interface{}{
+		"Syncing": syncing,
+		"Prompt":  prompt,
+		"Errors":  errs.ErrOrNil(),
+		// Probes contains the latest keepalive probe for each institution, which only sign on and don't sync
+		"Probes": prober.Results(),
+		// Discoveries contains the latest account discovery check for each institution, with any new or missing accounts
+		"Discoveries": prober.Discoveries(),
 	}
 }
 
 func submitSyncPrompt(ldgStore *ledger.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var prompt prompter.Response
-		if err := c.BindJSON(&prompt); err != nil {
+		if err := c.ShouldBindJSON(&prompt); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
@@ -53,85 +77,457 @@ func submitSyncPrompt(ldgStore *ledger.Store) gin.HandlerFunc {
 	}
 }
 
-func syncLedger(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store) gin.HandlerFunc {
+// syncLedger starts a sync. If the 'wait' query is "true", responds with the sync's summary once it finishes.
+func syncLedger(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, auditLog *audit.Log, summaryFile *audit.SummaryFile, guard *sync.Guard) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		_, syncFromStart := c.GetQuery("fromLedgerStart")
-		sync.Sync(ldgStore, accountStore, rulesStore, syncFromStart)
-		c.Status(http.StatusAccepted)
+		runGuard := guard
+		if c.Query("bypassGuard") == "true" {
+			runGuard = nil
+		}
+		var results <-chan audit.Summary
+		if daysParam, isRelative := c.GetQuery("days"); isRelative {
+			if syncFromStart {
+				abortWithClientError(c, http.StatusBadRequest, errors.New("Only one of days or fromLedgerStart may be set"))
+				return
+			}
+			days, err := strconv.Atoi(daysParam)
+			if err != nil {
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid days: %q", daysParam))
+				return
+			}
+			results, err = sync.SyncDays(ldgStore, accountStore, rulesStore, auditLog, summaryFile, runGuard, days)
+			if err != nil {
+				abortWithClientError(c, http.StatusBadRequest, err)
+				return
+			}
+		} else {
+			results = sync.Sync(ldgStore, accountStore, rulesStore, auditLog, summaryFile, runGuard, syncFromStart)
+		}
+		if c.Query("wait") != "true" {
+			c.Status(http.StatusAccepted)
+			return
+		}
+		if results == nil {
+			abortWithClientError(c, http.StatusConflict, errors.New("A sync is already running"))
+			return
+		}
+		select {
+		case summary := <-results:
+			c.JSON(http.StatusOK, summary)
+		case <-c.Request.Context().Done():
+			// the sync continues in the background, its summary is still written to the summary file
+		}
 	}
 }
 
-type transactionsResponse struct {
-	ledger.QueryResult
-	AccountIDMap map[string]string
+// getLastSyncSummary returns the most recent sync's summary, including syncs from before a restart
+func getLastSyncSummary(summaryFile *audit.SummaryFile) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		summary, found, err := summaryFile.Read()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if !found {
+			abortWithClientError(c, http.StatusNotFound, errors.New("No sync summary found. Run a sync first"))
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
 }
 
-func getTransactions(ldgStore *ledger.Store, accountStore *client.AccountStore) gin.HandlerFunc {
+var errGuardDisabled = errors.New("Quarantine is unavailable in read-only mode")
+
+func getQuarantinedBatches(guard *sync.Guard) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var errs sErrors.Errors
-		var page, results int = 1, 10
-		if pageQuery, ok := c.GetQuery("page"); ok {
-			parsedPage, parseErr := strconv.ParseInt(pageQuery, 10, 64)
-			switch {
-			case parseErr != nil:
-				errs.AddErr(errors.Errorf("Invalid integer: %s", pageQuery))
-			case parsedPage < 1:
-				errs.AddErr(errors.New("Page must be a positive integer"))
-			default:
-				page = int(parsedPage)
-			}
+		if guard == nil {
+			abortWithClientError(c, http.StatusNotFound, errGuardDisabled)
+			return
 		}
-		if resultsQuery, ok := c.GetQuery("results"); ok {
-			parsedResults, parseErr := strconv.ParseInt(resultsQuery, 10, 64)
-			switch {
-			case parseErr != nil:
-				errs.AddErr(errors.Errorf("Invalid integer: %s", resultsQuery))
-			case parsedResults < 1 || parsedResults > MaxResults:
-				errs.AddErr(errors.Errorf("Results must be a positive integer no more than %d", MaxResults))
-			default:
-				results = int(parsedResults)
+		batches, err := guard.Batches()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Batches": batches,
+		})
+	}
+}
+
+func approveQuarantinedBatch(guard *sync.Guard, ldgStore *ledger.Store, rulesStore *rules.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if guard == nil {
+			abortWithClientError(c, http.StatusNotFound, errGuardDisabled)
+			return
+		}
+		if syncing, _, _ := ldgStore.SyncStatus(); syncing {
+			abortWithClientError(c, http.StatusConflict, errors.New("Sync is running, try again after it completes"))
+			return
+		}
+		if _, err := guard.Approve(ldgStore, rulesStore, c.Query("id")); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func discardQuarantinedBatch(guard *sync.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if guard == nil {
+			abortWithClientError(c, http.StatusNotFound, errGuardDisabled)
+			return
+		}
+		if _, err := guard.Discard(c.Query("id")); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// getQuarantinedTransactions lists transactions which failed validation during a sync or import
+func getQuarantinedTransactions(guard *sync.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if guard == nil {
+			abortWithClientError(c, http.StatusNotFound, errGuardDisabled)
+			return
+		}
+		failed, err := guard.FailedTransactions()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Transactions": failed,
+		})
+	}
+}
+
+// releaseQuarantined adds a quarantined transaction to the ledger. An optional request body replaces the transaction with a fixed version.
+func releaseQuarantined(guard *sync.Guard, ldgStore *ledger.Store, rulesStore *rules.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if guard == nil {
+			abortWithClientError(c, http.StatusNotFound, errGuardDisabled)
+			return
+		}
+		if syncing, _, _ := ldgStore.SyncStatus(); syncing {
+			abortWithClientError(c, http.StatusConflict, errors.New("Sync is running, try again after it completes"))
+			return
+		}
+		var fixed *ledger.Transaction
+		if c.Request.ContentLength != 0 {
+			fixed = &ledger.Transaction{}
+			if err := c.ShouldBindJSON(fixed); err != nil {
+				abortWithClientError(c, http.StatusBadRequest, err)
+				return
 			}
 		}
-		if len(errs) > 0 {
-			abortWithClientError(c, http.StatusBadRequest, errs.ErrOrNil())
+		if _, err := guard.ReleaseFailed(ldgStore, rulesStore, c.Query("id"), fixed); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
+		c.Status(http.StatusNoContent)
+	}
+}
 
-		var options ledger.QueryOptions
-		if err := c.BindQuery(&options); err != nil {
+func discardQuarantined(guard *sync.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if guard == nil {
+			abortWithClientError(c, http.StatusNotFound, errGuardDisabled)
+			return
+		}
+		if _, err := guard.DiscardFailed(c.Query("id")); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
+		c.Status(http.StatusNoContent)
+	}
+}
 
-		result := transactionsResponse{
-			QueryResult:  ldgStore.Query(options, page, results),
-			AccountIDMap: make(map[string]string),
+// getAuditLog returns the most recent 'limit' sync audit entries, oldest first
+func getAuditLog(auditLog *audit.Log) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auditLog == nil {
+			abortWithClientError(c, http.StatusNotFound, errors.New("Audit log is disabled. Start Sage with -audit-log to enable it"))
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(MaxResults)))
+		if err != nil || limit < 1 {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid limit, must be a positive integer: %q", c.Query("limit")))
+			return
 		}
-		// attempt to make asset and liability accounts more descriptive
-		accountIDMap, err := newAccountIDMap(accountStore)
+		entries, err := auditLog.Tail(limit)
 		if err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
-		for i := range result.Transactions {
-			accountName := result.Transactions[i].Postings[0].Account
-			if _, exists := result.AccountIDMap[accountName]; !exists {
-				clientAccount, ok := accountIDMap.Find(accountName)
-				if ok {
-					result.AccountIDMap[accountName] = clientAccount.Description()
-				}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Entries": entries,
+		})
+	}
+}
+
+func finalSync(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := sync.FinalSync(ldgStore, accountStore, rulesStore, c.Query("id")); err != nil {
+			if abortWithMissingCapability(c, err) {
+				return
+			}
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func resetSyncState(ldgStore *ledger.Store, accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if syncing, _, _ := ldgStore.SyncStatus(); syncing {
+			// a running sync would overwrite the reset bookmark when it finishes
+			abortWithClientError(c, http.StatusConflict, errors.New("Sync is running, try again after it completes"))
+			return
+		}
+		if err := sync.ResetBookmark(accountStore, c.Query("id")); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func closeAccount(db plaindb.DB, changes *changeset.Manager, ldgStore *ledger.Store, accountStore *client.AccountStore) gin.HandlerFunc {
+	journalStore, err := journal.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		date, err := time.Parse(asOfDateFormat, c.Query("date"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid closure date, must be in YYYY-MM-DD format: %q", c.Query("date")))
+			return
+		}
+		if syncing, _, _ := ldgStore.SyncStatus(); syncing {
+			abortWithClientError(c, http.StatusConflict, errors.New("Sync is running, try again after it completes"))
+			return
+		}
+		err = changes.Do("Close account "+c.Query("id"), func() error {
+			return sync.CloseAccount(ldgStore, accountStore, journalStore, c.Query("id"), date, c.Query("writeOffTo"))
+		})
+		var residualErr sync.ResidualBalanceError
+		if sErrors.As(err, &residualErr) {
+			c.AbortWithStatusJSON(http.StatusConflict, map[string]interface{}{
+				"Error":          residualErr.Error(),
+				"Residual":       residualErr.Residual,
+				"Currency":       residualErr.Currency,
+				"CurrencyFormat": residualErr.Format,
+			})
+			return
+		}
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func reopenAccount(db plaindb.DB, accountStore *client.AccountStore) gin.HandlerFunc {
+	journalStore, err := journal.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		if err := sync.ReopenAccount(accountStore, journalStore, c.Query("id")); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+type transactionsResponse struct {
+	ledger.QueryResult
+	AccountIDMap map[string]string
+	// Revisions maps transaction IDs to their current revision. Send these back with updates to detect conflicting edits.
+	Revisions map[string]string
+	// Notes maps transaction IDs to the user's note, if any. Kept separate from each transaction's bank-provided Comment.
+	Notes map[string]string
+	// FeeLinks maps transaction IDs to their fee link ID. A linked purchase's link ID is its own ID, so fees can nest under it.
+	FeeLinks map[string]string
+	// Merchants maps transaction IDs to their structured merchant details, if any
+	Merchants map[string]ledger.Merchant
+	// Currencies maps each posting's account name to the currency format of its amounts
+	Currencies map[string]model.CurrencyFormat
+}
+
+func getTransactions(ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if result, ok := queryTransactions(c, ldgStore.Ledger, accountStore, settingsStore); ok {
+			c.JSON(http.StatusOK, result)
+		}
+	}
+}
+
+// getRegister returns the 'account' query's transactions between the 'start' and 'end' queries, each with the account's running balance after it
+func getRegister(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account := c.Query("account")
+		if account == "" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Account is required"))
+			return
+		}
+		start, end, err := getStartEndTimes(c.Query("start"), c.Query("end"), func(time.Time) time.Time { return time.Time{} })
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if end.Before(start) {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("End must not be before start"))
+			return
+		}
+		opening, rows := ldgStore.Register(account, start, end)
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Account":        account,
+			"Start":          start,
+			"End":            end,
+			"OpeningBalance": opening,
+			"Rows":           rows,
+		})
+	}
+}
+
+// queryTransactions runs the transaction query from c's parameters against ldg. Aborts c and returns false on failure.
+func queryTransactions(c *gin.Context, ldg *ledger.Ledger, accountStore *client.AccountStore, settingsStore *settings.Store) (transactionsResponse, bool) {
+	var result transactionsResponse
+	var errs sErrors.Errors
+	var page, results int = 1, 10
+	if pageQuery, ok := c.GetQuery("page"); ok {
+		parsedPage, parseErr := strconv.ParseInt(pageQuery, 10, 64)
+		switch {
+		case parseErr != nil:
+			errs.AddErr(errors.Errorf("Invalid integer: %s", pageQuery))
+		case parsedPage < 1:
+			errs.AddErr(errors.New("Page must be a positive integer"))
+		default:
+			page = int(parsedPage)
+		}
+	}
+	if resultsQuery, ok := c.GetQuery("results"); ok {
+		parsedResults, parseErr := strconv.ParseInt(resultsQuery, 10, 64)
+		switch {
+		case parseErr != nil:
+			errs.AddErr(errors.Errorf("Invalid integer: %s", resultsQuery))
+		case parsedResults < 1 || parsedResults > MaxResults:
+			errs.AddErr(errors.Errorf("Results must be a positive integer no more than %d", MaxResults))
+		default:
+			results = int(parsedResults)
+		}
+	}
+	if len(errs) > 0 {
+		abortWithClientError(c, http.StatusBadRequest, errs.ErrOrNil())
+		return result, false
+	}
+
+	var options ledger.QueryOptions
+	if err := c.BindQuery(&options); err != nil {
+		abortWithClientError(c, http.StatusBadRequest, err)
+		return result, false
+	}
+	// amortized shares are only shown when drilling down from a report, they point back to the real transaction
+	ldg, ok := queryAmortized(c, scopedLedger(c, ldg), false)
+	if !ok {
+		return result, false
+	}
+
+	result, err := newTransactionsResponse(ldg.Query(options, page, results), accountStore, homeCurrency(settingsStore))
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return result, false
+	}
+	return result, true
+}
+
+// newTransactionsResponse adds each transaction's revision, note, and other details to 'queryResult'. Postings without a currency format of their own use 'home'.
+func newTransactionsResponse(queryResult ledger.QueryResult, accountStore *client.AccountStore, home model.CurrencyFormat) (transactionsResponse, error) {
+	result := transactionsResponse{
+		QueryResult:  queryResult,
+		AccountIDMap: make(map[string]string),
+		Revisions:    make(map[string]string),
+		Notes:        make(map[string]string),
+		FeeLinks:     make(map[string]string),
+		Merchants:    make(map[string]ledger.Merchant),
+		Currencies:   make(map[string]model.CurrencyFormat),
+	}
+	// attempt to make asset and liability accounts more descriptive
+	accountIDMap, err := newAccountIDMap(accountStore)
+	if err != nil {
+		return result, err
+	}
+	for i := range result.Transactions {
+		id := result.Transactions[i].Postings[0].ID()
+		result.Revisions[id] = result.Transactions[i].Revision()
+		if note := result.Transactions[i].Note(); note != "" {
+			result.Notes[id] = note
+		}
+		if linkID := result.Transactions[i].Tags[ledger.FeeLinkTag]; linkID != "" {
+			result.FeeLinks[id] = linkID
+		}
+		if merchant := result.Transactions[i].Merchant(); !merchant.IsEmpty() {
+			result.Merchants[id] = merchant
+		}
+		accountName := result.Transactions[i].Postings[0].Account
+		if _, exists := result.AccountIDMap[accountName]; !exists {
+			clientAccount, ok := accountIDMap.Find(accountName)
+			if ok {
+				result.AccountIDMap[accountName] = model.DisplayName(clientAccount)
+			}
+		}
+		for _, p := range result.Transactions[i].Postings {
+			if _, exists := result.Currencies[p.Account]; !exists {
+				clientAccount, _ := accountIDMap.Find(p.Account)
+				result.Currencies[p.Account] = model.ResolveCurrencyFormat(clientAccount, p.Currency, home)
 			}
 		}
-		c.JSON(http.StatusOK, result)
+	}
+	return result, nil
+}
+
+func getTransaction(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Query("id")
+		if id == "" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Transaction ID is required"))
+			return
+		}
+		txn, found := ldgStore.Transaction(id)
+		if !found {
+			abortWithClientError(c, http.StatusNotFound, errors.Errorf("Transaction not found: %q", id))
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Transaction": txn,
+			// Revision should be sent back with updates to detect conflicting edits
+			"Revision": txn.Revision(),
+		})
 	}
 }
 
 // BalanceResponse is the response type for fetching account balances
 type BalanceResponse struct {
 	Start, End         *time.Time
+	AsOf               *time.Time `json:",omitempty"`
 	OpeningBalanceDate *time.Time
 	Messages           []AccountMessage
 	Accounts           []AccountResponse
+	// ClosedAccounts contains closed accounts, with zero balances after their closure date
+	ClosedAccounts []AccountResponse `json:",omitempty"`
+	Currency       string            `json:",omitempty"`
+	MissingRates   []fx.MissingRate  `json:",omitempty"`
+	// HomeCurrency is the currency format of accounts without a currency of their own
+	HomeCurrency model.CurrencyFormat
 }
 
 // AccountResponse contains details for an account's balance over time
@@ -142,6 +538,12 @@ type AccountResponse struct {
 	OpeningBalance *decimal.Decimal
 	Balances       []decimal.Decimal
 	Institution    string `json:",omitempty"`
+	Currency       string `json:",omitempty"`
+	// CurrencyFormat describes how to render the account's amounts
+	CurrencyFormat model.CurrencyFormat
+	Closed         *time.Time `json:",omitempty"`
+	// ConvertedBalances contains Balances in the requested base currency, or nil for months without an exchange rate
+	ConvertedBalances []*decimal.Decimal `json:",omitempty"`
 }
 
 // AccountMessage contains important information for an account
@@ -195,26 +597,87 @@ func (t txnToAccountMap) Find(accountName string) (account model.Account, found
 	return clientAccount, found
 }
 
-func getBalances(ldgStore *ledger.Store, accountStore *client.AccountStore) gin.HandlerFunc {
+func getBalances(db plaindb.DB, ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store) gin.HandlerFunc {
+	fxStore, err := fx.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
 	return func(c *gin.Context) {
-		resp, err := getBalancesResponse(ldgStore, accountStore, c.QueryArray(accountTypesQuery))
+		if resp, ok := queryBalances(c, ldgStore.Ledger, accountStore, fxStore, settingsStore); ok {
+			c.JSON(http.StatusOK, resp)
+		}
+	}
+}
+
+// queryBalances computes balances from c's parameters against ldg. Aborts c and returns false on failure.
+func queryBalances(c *gin.Context, ldg *ledger.Ledger, accountStore *client.AccountStore, fxStore *fx.Store, settingsStore *settings.Store) (BalanceResponse, bool) {
+	var asOf *time.Time
+	if asOfQuery := c.Query("asOf"); asOfQuery != "" {
+		date, err := time.Parse(asOfDateFormat, asOfQuery)
 		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid as-of date, must be in YYYY-MM-DD format: %q", asOfQuery))
+			return BalanceResponse{}, false
+		}
+		asOf = &date
+	}
+	displaySign := c.DefaultQuery(displaySignQuery, rawDisplaySign)
+	if displaySign != rawDisplaySign && displaySign != naturalDisplaySign {
+		abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid display sign, must be %q or %q: %q", rawDisplaySign, naturalDisplaySign, displaySign))
+		return BalanceResponse{}, false
+	}
+	dateBasis, ok := queryDateBasis(c, settingsStore)
+	if !ok {
+		return BalanceResponse{}, false
+	}
+	ldg, ok = queryReportLedger(c, ldg)
+	if !ok {
+		return BalanceResponse{}, false
+	}
+	resp, err := getBalancesResponse(ldg, accountStore, getScope(c), c.QueryArray(accountTypesQuery), asOf, dateBasis)
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return resp, false
+	}
+	formats, err := newCurrencyFormats(ldg, accountStore, settingsStore)
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return resp, false
+	}
+	setCurrencyFormats(&resp, formats)
+	if displaySign == naturalDisplaySign {
+		naturalizeBalances(&resp)
+	}
+	if currency := c.Query(currencyQuery); currency != "" {
+		if err := convertBalances(&resp, fxStore, currency); err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
-			return
+			return resp, false
 		}
-		c.JSON(http.StatusOK, resp)
 	}
+	return resp, true
 }
 
-func getBalancesResponse(ldgStore *ledger.Store, accountStore *client.AccountStore, accountTypesQueryArray []string) (interface{}, error) {
-	start, end, balanceMap := ldgStore.Balances()
+// getBalancesResponse returns monthly balances for each account, grouped into months by 'dateBasis'.
+// If 'asOf' is set, returns only the balances as of that posting date. Only includes accounts in 'scope', or all accounts if nil.
+func getBalancesResponse(ldg *ledger.Ledger, accountStore *client.AccountStore, scope *requestScope, accountTypesQueryArray []string, asOf *time.Time, dateBasis ledger.DateBasis) (BalanceResponse, error) {
+	var start, end *time.Time
+	var balanceMap map[string][]decimal.Decimal
+	if asOf != nil {
+		start, end = asOf, asOf
+		balanceMap = make(map[string][]decimal.Decimal)
+		for account, balance := range ldg.BalancesAsOf(*asOf) {
+			balanceMap[account] = []decimal.Decimal{balance}
+		}
+	} else {
+		start, end, balanceMap = ldg.BalancesBy(dateBasis)
+	}
 	resp := BalanceResponse{
 		Start: start,
 		End:   end,
+		AsOf:  asOf,
 	}
 	accountIDMap, err := newAccountIDMap(accountStore)
 	if err != nil {
-		return nil, err
+		return resp, err
 	}
 
 	accountTypes := map[string]bool{
@@ -231,7 +694,7 @@ func getBalancesResponse(ldgStore *ledger.Store, accountStore *client.AccountSto
 	}
 
 	var openingBalances ledger.Transaction
-	if balances, found := ldgStore.OpeningBalances(); found {
+	if balances, found := ldg.OpeningBalances(); found {
 		resp.OpeningBalanceDate = &balances.Date
 		openingBalances = balances
 	}
@@ -244,13 +707,15 @@ func getBalancesResponse(ldgStore *ledger.Store, accountStore *client.AccountSto
 		return nil
 	}
 
+	currencies := ldg.AccountCurrencies()
 	for accountName, balances := range balanceMap {
 		account := AccountResponse{
 			ID:             accountName,
 			OpeningBalance: findOpeningBalance(accountName),
 			Balances:       balances,
+			Currency:       currencies[accountName],
 		}
-		if extractAccount(&account, accountName, accountTypes, accountIDMap.Find) {
+		if extractAccount(&account, accountName, ldg.AccountType(accountName), accountTypes, accountIDMap.Find) {
 			resp.Accounts = append(resp.Accounts, account)
 		}
 	}
@@ -259,13 +724,13 @@ func getBalancesResponse(ldgStore *ledger.Store, accountStore *client.AccountSto
 	var a model.Account
 	err = accountStore.Iter(&a, func(id string) bool {
 		format := model.LedgerFormat(a)
-		if len(accountTypes) == 0 || accountTypes[format.AccountType] {
+		if scope.allowsAccount(format.String()) && (len(accountTypes) == 0 || accountTypes[format.AccountType]) {
 			accounts = append(accounts, a)
 		}
 		return true
 	})
 	if err != nil {
-		return nil, err
+		return resp, err
 	}
 	for _, account := range accounts {
 		ledgerAccount := model.LedgerFormat(account)
@@ -273,7 +738,7 @@ func getBalancesResponse(ldgStore *ledger.Store, accountStore *client.AccountSto
 		if _, inBalances := balanceMap[accountName]; !inBalances {
 			resp.Accounts = append(resp.Accounts, AccountResponse{
 				ID:             accountName,
-				Account:        account.Description(),
+				Account:        model.DisplayName(account),
 				AccountType:    ledgerAccount.AccountType,
 				OpeningBalance: findOpeningBalance(accountName),
 			})
@@ -282,43 +747,127 @@ func getBalancesResponse(ldgStore *ledger.Store, accountStore *client.AccountSto
 	sort.Slice(resp.Accounts, func(a, b int) bool {
 		return resp.Accounts[a].ID < resp.Accounts[b].ID
 	})
+	groupClosedAccounts(&resp, accounts)
 
-	resp.Messages = append(resp.Messages, getOpeningBalanceMessages(ldgStore, accounts)...)
+	resp.Messages = append(resp.Messages, getOpeningBalanceMessages(ldg, accounts)...)
 	sort.Slice(resp.Messages, func(a, b int) bool {
 		return resp.Messages[a].AccountID < resp.Messages[b].AccountID
 	})
 	return resp, nil
 }
 
-// extractAccount attempts to fill in the account response, returns true if the account should be added
-func extractAccount(account *AccountResponse, accountName string, filterAccountTypes map[string]bool, getAccount func(name string) (model.Account, bool)) bool {
-	format, err := model.ParseLedgerFormat(accountName)
-	if err != nil || format.AccountType == "" {
-		return false
-	}
-	if len(filterAccountTypes) > 0 && !filterAccountTypes[format.AccountType] {
-		return false
-	}
+// isCategory returns true if 'account' is an expense or revenue account, by its declared type or name
+func isCategory(ldg *ledger.Ledger, account string) bool {
+	accountType := ldg.AccountType(account)
+	return accountType == ledger.ExpenseType || accountType == ledger.RevenueType
+}
 
-	account.AccountType = format.AccountType
-	switch format.AccountType {
-	case model.AssetAccount, model.LiabilityAccount:
-		account.Account = format.Institution + " " + format.AccountID
-		account.Institution = format.Institution
-		if clientAccount, found := getAccount(accountName); found {
-			account.Account = clientAccount.Description()
-		}
-	default:
-		account.ID = format.Remaining
-		account.Account = account.ID
-	}
-	return true
+// isNaturallyNegative returns true if 'account' is a category whose balance is negative in the ledger for typical transactions, i.e. revenues
+func isNaturallyNegative(account string) bool {
+	return account == model.RevenueAccount || strings.HasPrefix(account, model.RevenueAccount+":")
 }
 
-func getOpeningBalanceMessages(ldgStore *ledger.Store, accounts []model.Account) []AccountMessage {
-	var messages []AccountMessage
-	var openingPostings []ledger.Posting
-	if openingBalances, ok := ldgStore.OpeningBalances(); ok {
+// naturalizeBalances flips the sign of naturally negative categories' balances in resp, so they read as positive amounts.
+// Only the response is changed, never the ledger.
+func naturalizeBalances(resp *BalanceResponse) {
+	for _, accounts := range [][]AccountResponse{resp.Accounts, resp.ClosedAccounts} {
+		for ix := range accounts {
+			account := &accounts[ix]
+			if account.AccountType != model.RevenueAccount && !isNaturallyNegative(account.ID) {
+				continue
+			}
+			balances := make([]decimal.Decimal, len(account.Balances))
+			for i, balance := range account.Balances {
+				balances[i] = balance.Neg()
+			}
+			account.Balances = balances
+			if account.OpeningBalance != nil {
+				opening := account.OpeningBalance.Neg()
+				account.OpeningBalance = &opening
+			}
+		}
+	}
+}
+
+// groupClosedAccounts moves closed accounts into resp.ClosedAccounts and zeroes their balances after closure
+func groupClosedAccounts(resp *BalanceResponse, accounts []model.Account) {
+	closedDates := make(map[string]time.Time)
+	for _, account := range accounts {
+		if closed := model.ClosedDate(account); closed != nil {
+			closedDates[model.LedgerAccountName(account)] = *closed
+		}
+	}
+	if len(closedDates) == 0 {
+		return
+	}
+	openAccounts := make([]AccountResponse, 0, len(resp.Accounts))
+	for _, account := range resp.Accounts {
+		closed, isClosed := closedDates[account.ID]
+		if !isClosed {
+			openAccounts = append(openAccounts, account)
+			continue
+		}
+		account.Closed = &closed
+		firstZero := 0
+		switch {
+		case resp.Start == nil:
+			firstZero = len(account.Balances)
+		case resp.AsOf != nil:
+			if !resp.AsOf.After(closed) {
+				firstZero = len(account.Balances)
+			}
+		default:
+			// monthly balances start at resp.Start's month, zero every month after the closure month
+			firstZero = getMonthNum(closed) - getMonthNum(*resp.Start) + 1
+			if firstZero < 0 {
+				firstZero = 0
+			}
+		}
+		for i := firstZero; i < len(account.Balances); i++ {
+			account.Balances[i] = decimal.Zero
+		}
+		resp.ClosedAccounts = append(resp.ClosedAccounts, account)
+	}
+	resp.Accounts = openAccounts
+}
+
+func getMonthNum(t time.Time) int {
+	return int(t.Month()) - 1 + 12*t.Year()
+}
+
+// extractAccount attempts to fill in the account response, returns true if the account should be added
+func extractAccount(account *AccountResponse, accountName, accountType string, filterAccountTypes map[string]bool, getAccount func(name string) (model.Account, bool)) bool {
+	format, err := model.ParseLedgerFormat(accountName)
+	if err != nil || format.AccountType == "" {
+		return false
+	}
+	if accountType != "" {
+		// declared account types take precedence over the name's prefix
+		format.AccountType = accountType
+	}
+	if len(filterAccountTypes) > 0 && !filterAccountTypes[format.AccountType] {
+		return false
+	}
+
+	account.AccountType = format.AccountType
+	switch format.AccountType {
+	case model.AssetAccount, model.LiabilityAccount:
+		account.Account = format.Institution + " " + format.AccountID
+		account.Institution = format.Institution
+		if clientAccount, found := getAccount(accountName); found {
+			account.Account = model.DisplayName(clientAccount)
+		}
+	default:
+		account.ID = format.Remaining
+		account.Account = account.ID
+	}
+	return true
+}
+
+func getOpeningBalanceMessages(ldg *ledger.Ledger, accounts []model.Account) []AccountMessage {
+	var messages []AccountMessage
+	var openingPostings []ledger.Posting
+	if openingBalances, ok := ldg.OpeningBalances(); ok {
 		openingPostings = openingBalances.Postings
 	}
 	openingBalAccounts := make(map[string]bool)
@@ -332,7 +881,7 @@ func getOpeningBalanceMessages(ldgStore *ledger.Store, accounts []model.Account)
 		if !openingBalAccounts[id] {
 			messages = append(messages, AccountMessage{
 				AccountID:   id,
-				AccountName: account.Description(),
+				AccountName: model.DisplayName(account),
 				Message:     "Missing opening balance",
 			})
 		}
@@ -346,7 +895,7 @@ func getExpenseAndRevenueAccounts(ldgStore *ledger.Store, rulesStore *rules.Stor
 		accounts := make(map[string]bool, len(balanceMap)+1)
 		accounts[model.Uncategorized] = true
 		for account := range balanceMap {
-			if strings.HasPrefix(account, model.ExpenseAccount+":") || strings.HasPrefix(account, model.RevenueAccount+":") {
+			if strings.Contains(account, ":") && isCategory(ldgStore.Ledger, account) {
 				components := strings.Split(account, ":")
 				account = ""
 				for _, comp := range components {
@@ -384,7 +933,9 @@ func updateTransaction(ldgStore *ledger.Store) gin.HandlerFunc {
 		}
 
 		var txnJSON struct {
-			ID string // the original transaction's ID
+			ID       string  // the original transaction's ID
+			Revision string  // the original transaction's revision, if set must match the current revision
+			Note     *string // the user's note, if set replaces the current note. An empty note removes it.
 		}
 		if err := json.Unmarshal(body, &txnJSON); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
@@ -397,13 +948,9 @@ func updateTransaction(ldgStore *ledger.Store) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
-		switch err := ldgStore.UpdateTransaction(id, txn).(type) {
-		case ledger.Error:
-			abortWithClientError(c, http.StatusBadRequest, err)
-			return
-		case nil: // skip
-		default:
-			abortWithClientError(c, http.StatusInternalServerError, err)
+		setNoteTag(&txn, txnJSON.Note)
+		if err := ldgStore.UpdateTransactionRevision(id, txnJSON.Revision, txn); err != nil {
+			abortWithLedgerError(c, err)
 			return
 		}
 
@@ -414,32 +961,101 @@ func updateTransaction(ldgStore *ledger.Store) gin.HandlerFunc {
 func updateTransactions(ldgStore *ledger.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var txns []struct {
-			ID string `binding:"required"` // the original transaction's ID
+			ID       string  `binding:"required"` // the original transaction's ID
+			Revision string  // the original transaction's revision, if set must match the current revision
+			Note     *string // the user's note, if set replaces the current note. An empty note removes it.
 			ledger.Transaction
 		}
-		if err := c.BindJSON(&txns); err != nil {
+		if err := c.ShouldBindJSON(&txns); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
 		newTxns := make(map[string]ledger.Transaction, len(txns))
+		revisions := make(map[string]string, len(txns))
 		for _, txn := range txns {
+			setNoteTag(&txn.Transaction, txn.Note)
 			newTxns[txn.ID] = txn.Transaction
+			if txn.Revision != "" {
+				revisions[txn.ID] = txn.Revision
+			}
 		}
 
-		switch err := ldgStore.UpdateTransactions(newTxns).(type) {
-		case ledger.Error:
+		if err := ldgStore.UpdateTransactions(newTxns, revisions); err != nil {
+			abortWithLedgerError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// setNoteTag adds 'note' to txn's tag updates. A nil note leaves the current note unchanged.
+func setNoteTag(txn *ledger.Transaction, note *string) {
+	if note == nil {
+		return
+	}
+	if txn.Tags == nil {
+		txn.Tags = make(map[string]string)
+	}
+	// an empty tag value removes the note
+	txn.Tags[ledger.NoteTag] = ledger.EncodeNote(*note)
+}
+
+func setNote(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			ID   string `binding:"required"`
+			Note string
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
-		case nil: // skip
-		default:
-			abortWithClientError(c, http.StatusInternalServerError, err)
+		}
+		if !requireScopedTransaction(c, ldgStore.Ledger, body.ID) {
+			return
+		}
+		if err := ldgStore.SetNote(body.ID, body.Note); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
-
 		c.Status(http.StatusNoContent)
 	}
 }
 
+// abortWithLedgerError responds with a status code matching the type of ledger error, even if err was wrapped
+func abortWithLedgerError(c *gin.Context, err error) {
+	var revisionErrs ledger.RevisionErrors
+	var revisionErr ledger.RevisionError
+	var validateErr ledger.Error
+	switch {
+	case sErrors.As(err, &revisionErrs):
+		abortWithConflict(c, err, revisionErrs)
+	case sErrors.As(err, &revisionErr):
+		abortWithConflict(c, err, ledger.RevisionErrors{revisionErr})
+	case sErrors.As(err, &validateErr):
+		abortWithClientError(c, http.StatusBadRequest, err)
+	default:
+		abortWithClientError(c, http.StatusInternalServerError, err)
+	}
+}
+
+// abortWithConflict responds with the current state of each conflicting transaction, so clients can refresh their stale copies
+func abortWithConflict(c *gin.Context, err error, revisionErrs ledger.RevisionErrors) {
+	logger := c.MustGet(loggerKey).(*zap.Logger)
+	logger.Info("Aborting with conflict", zap.String("error", err.Error()))
+	current := make([]ledger.Transaction, 0, len(revisionErrs))
+	revisions := make(map[string]string, len(revisionErrs))
+	for _, revisionErr := range revisionErrs {
+		current = append(current, revisionErr.Current)
+		revisions[revisionErr.ID] = revisionErr.Current.Revision()
+	}
+	c.AbortWithStatusJSON(http.StatusConflict, map[string]interface{}{
+		"Error":        err.Error(),
+		"Transactions": current,
+		"Revisions":    revisions,
+	})
+}
+
 func updateOpeningBalance(ldgStore *ledger.Store, accountStore *client.AccountStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var opening ledger.Transaction
@@ -466,48 +1082,209 @@ func updateOpeningBalance(ldgStore *ledger.Store, accountStore *client.AccountSt
 			Tags:     map[string]string{"id": ledger.OpeningBalanceID},
 		})
 
-		switch err := ldgStore.UpdateOpeningBalance(opening).(type) {
-		case ledger.Error:
+		if err := ldgStore.UpdateOpeningBalance(opening); err != nil {
+			abortWithLedgerError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// recordBalance records a balance snapshot for a manual account, adding an adjustment transaction if the ledger balance differs
+func recordBalance(ldgStore *ledger.Store, accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		date, err := time.Parse(asOfDateFormat, c.Query("date"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid balance date, must be in YYYY-MM-DD format: %q", c.Query("date")))
+			return
+		}
+		amount, err := decimal.NewFromString(c.Query("amount"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid balance amount: %q", c.Query("amount")))
+			return
+		}
+		if !requireScopedAccount(c, accountStore, c.Query("id")) {
+			return
+		}
+		adjustment, err := sync.RecordBalance(ldgStore, accountStore, c.Query("id"), date, amount)
+		if err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
-		case nil: // skip
-		default:
-			abortWithClientError(c, http.StatusInternalServerError, err)
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Adjustment": adjustment,
+		})
+	}
+}
+
+// adjustCashBalance records the 'amount' query as the cash wallet's counted balance on the 'date' query.
+// Any difference from the ledger is recorded as unaccounted cash spending.
+func adjustCashBalance(ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		date, err := time.Parse(asOfDateFormat, c.Query("date"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid cash balance date, must be in YYYY-MM-DD format: %q", c.Query("date")))
+			return
+		}
+		amount, err := decimal.NewFromString(c.Query("amount"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid cash balance amount: %q", c.Query("amount")))
 			return
 		}
+		adjustment, err := sync.AdjustCashBalance(ldgStore, homeCurrency(settingsStore), date, amount)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Adjustment": adjustment,
+		})
+	}
+}
 
-		c.Status(http.StatusNoContent)
+// recordCashSpending records cash spent from the cash wallet account
+func recordCashSpending(ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		date, err := time.Parse(asOfDateFormat, c.Query("date"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid cash spending date, must be in YYYY-MM-DD format: %q", c.Query("date")))
+			return
+		}
+		amount, err := decimal.NewFromString(c.Query("amount"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid cash spending amount: %q", c.Query("amount")))
+			return
+		}
+		spending, err := sync.RecordCashSpending(ldgStore, homeCurrency(settingsStore), date, c.Query("payee"), c.Query("category"), amount)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Transaction": spending,
+		})
 	}
 }
 
-func importOFXFile(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store) gin.HandlerFunc {
+func importOFXFile(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, guard *sync.Guard) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		logger := c.MustGet(loggerKey).(*zap.Logger)
-		skeletonAccounts, txns, err := client.ReadOFX(c.Request.Body)
+		body, ok := readUpload(c)
+		if !ok {
+			return
+		}
+		defer body.Close()
+		skeletonAccounts, txns, err := client.ReadOFX(body)
 		if err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
-		rulesStore.ApplyAll(txns)
-		switch err := ldgStore.AddTransactions(txns).(type) {
-		case ledger.Error:
+		summary, err := importOFX(ldgStore, accountStore, rulesStore, guard, skeletonAccounts, txns, logger)
+		if err != nil {
+			abortWithLedgerError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// exportQFX writes one account's transactions as a QFX file, which can be imported by other tools
+func exportQFX(ldgStore *ledger.Store, accountStore *client.AccountStore, downloads *downloadSnapshots) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var options struct {
+			ID    string `form:"id" binding:"required"`
+			Start string `form:"start"`
+			End   string `form:"end"`
+		}
+		if err := c.BindQuery(&options); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
-		case nil: // skip
-		default:
+		}
+		start, end, err := getStartEndTimes(options.Start, options.End, func(time.Time) time.Time { return time.Time{} })
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		var account model.Account
+		found, err := accountStore.Get(options.ID, &account)
+		if err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
+		if !found {
+			abortWithClientError(c, http.StatusNotFound, errors.Errorf("Account not found: %q", options.ID))
+			return
+		}
 
-		accountsAdded := 0
-		for _, account := range skeletonAccounts {
-			if err := accountStore.Add(account); err != nil {
-				logger.Warn("Failed to add bare-bones account from imported file", zap.String("error", err.Error()))
-			} else {
-				accountsAdded++
+		serveDownload(c, downloads, func() (downloadSnapshot, error) {
+			result := ldgStore.Query(ledger.QueryOptions{Start: start, End: end}, 1, ldgStore.Size()+1)
+			balance := ldgStore.BalancesAsOf(end)[model.LedgerAccountName(account)]
+			var buf bytes.Buffer
+			if err := client.WriteOFX(&buf, account, result.Transactions, balance, start, end, time.Now()); err != nil {
+				return downloadSnapshot{}, err
 			}
+			return downloadSnapshot{
+				name:        fmt.Sprintf("%s-%s.qfx", options.ID, end.Format(asOfDateFormat)),
+				contentType: "application/x-ofx",
+				content:     buf.Bytes(),
+			}, nil
+		})
+	}
+}
+
+// uploadStatement imports an OFX statement file for a single account, processed like a sync of that account, and returns the sync summary
+func uploadStatement(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, auditLog *audit.Log, summaryFile *audit.SummaryFile, guard *sync.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var account model.Account
+		found, err := accountStore.Get(id, &account)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if !found {
+			abortWithClientError(c, http.StatusNotFound, errors.Errorf("Account not found by ID: %q", id))
+			return
+		}
+		body, ok := readUpload(c)
+		if !ok {
+			return
+		}
+		defer body.Close()
+		results, err := sync.UploadStatement(ldgStore, accountStore, rulesStore, auditLog, summaryFile, guard, id, body)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if results == nil {
+			abortWithClientError(c, http.StatusConflict, errors.New("A sync is already running"))
+			return
+		}
+		select {
+		case summary := <-results:
+			c.JSON(http.StatusOK, summary)
+		case <-c.Request.Context().Done():
+			// the import continues in the background, its summary is still written to the summary file
 		}
-		c.Status(http.StatusNoContent)
+	}
+}
+
+func archiveBefore(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cutoff, err := time.Parse(time.RFC3339, c.Query("date"))
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Wrap(err, "Invalid archive date"))
+			return
+		}
+		archived, err := ldgStore.ArchiveBefore(cutoff)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Archived": archived,
+		})
 	}
 }
 
@@ -517,7 +1294,7 @@ func reimportTransactions(ldgStore *ledger.Store, rulesStore *rules.Store) gin.H
 			Start, End string
 			Accounts   []string
 		}
-		if err := c.BindJSON(&body); err != nil {
+		if err := c.ShouldBindJSON(&body); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
@@ -541,7 +1318,7 @@ func reimportTransactions(ldgStore *ledger.Store, rulesStore *rules.Store) gin.H
 			updatedTxns[txn.ID()] = txn
 		}
 
-		if err := ldgStore.UpdateTransactions(updatedTxns); err != nil {
+		if err := ldgStore.UpdateTransactions(updatedTxns, nil); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
@@ -559,10 +1336,10 @@ type renameParams struct {
 	NewID string
 }
 
-func renameLedgerAccount(ldgStore *ledger.Store) gin.HandlerFunc {
+func renameLedgerAccount(ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var params renameParams
-		if err := c.BindJSON(&params); err != nil {
+		if err := c.ShouldBindJSON(&params); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
@@ -571,11 +1348,34 @@ func renameLedgerAccount(ldgStore *ledger.Store) gin.HandlerFunc {
 			return
 		}
 
+		params.New = ledger.NormalizeAccountName(params.New)
+		if params.New == "" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("New account name must not be empty"))
+			return
+		}
+
+		currentSettings, err := settingsStore.Settings()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		accountType := ldgStore.AccountType(params.Old)
 		renameCount, err := ldgStore.RenameAccount(params.Old, params.New, params.OldID, params.NewID)
 		if err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
+		if currentSettings.DeclareAccounts && renameCount > 0 {
+			// keep the renamed account's type, even if its new name doesn't start with it
+			decl, err := ledger.NewAccountDeclaration(params.New, accountType)
+			if err == nil {
+				err = ldgStore.DeclareAccount(decl)
+			}
+			if err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
 
 		c.JSON(http.StatusOK, map[string]interface{}{
 			"Renamed": renameCount,
@@ -583,6 +1383,239 @@ func renameLedgerAccount(ldgStore *ledger.Store) gin.HandlerFunc {
 	}
 }
 
+type accountCollision struct {
+	ledger.AccountCollision
+	// Renames merge each colliding account into the suggested account with renameLedgerAccount
+	Renames []renameParams
+}
+
+// validateLedger reports ledger validation errors and accounts which only differ by case or whitespace
+// renameCategory moves postings, rules, and category codes from an expense or revenue category and its subcategories to a new name, in one change
+func renameCategory(changes *changeset.Manager, ldgStore *ledger.Store, rulesStore *rules.Store, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Old string `binding:"required"`
+			New string `binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := ledger.ValidateCategory(body.New); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		oldName, newName := ledger.NormalizeAccountName(body.Old), ledger.NormalizeAccountName(body.New)
+		if !isCategory(ldgStore.Ledger, oldName) {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Only expense and revenue categories can be renamed: %q", oldName))
+			return
+		}
+		if oldName == newName {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("New category name must be different from the old one"))
+			return
+		}
+		currentSettings, err := settingsStore.Settings()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		accountType := ldgStore.AccountType(oldName)
+		_, _, balances := ldgStore.Balances()
+		renames := make(map[string]string)
+		for account := range balances {
+			if renamed, ok := ledger.ReplaceAccountPrefix(account, oldName, newName); ok {
+				renames[account] = renamed
+			}
+		}
+		for _, renamed := range renames {
+			if _, exists := balances[renamed]; exists && renames[renamed] == "" && ldgStore.AccountType(renamed) != accountType {
+				abortWithClientError(c, http.StatusConflict, errors.Errorf("Category %q collides with an existing account which isn't in %s", renamed, accountType))
+				return
+			}
+		}
+		if newType := ldgStore.AccountType(newName); newType != accountType && !(newType == "" && currentSettings.DeclareAccounts) {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("New category must also be in %s: %q", accountType, newName))
+			return
+		}
+
+		var renamedRules int
+		err = changes.Do(fmt.Sprintf("Rename category %s to %s", oldName, newName), func() error {
+			for account, renamed := range renames {
+				if err := ldgStore.UpdateAccount(account, renamed); err != nil {
+					return err
+				}
+			}
+			renamedRules = rulesStore.RenameCategory(oldName, newName)
+			if currentSettings.DeclareAccounts {
+				decl, err := ledger.NewAccountDeclaration(newName, accountType)
+				if err != nil {
+					return err
+				}
+				return ldgStore.DeclareAccount(decl)
+			}
+			return nil
+		})
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Accounts": len(renames),
+			"Rules":    renamedRules,
+		})
+	}
+}
+
+func validateLedger(ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentSettings, err := settingsStore.Settings()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		var validationErr interface{}
+		err = ldgStore.Validate()
+		if err != nil {
+			validationErr = err.Error()
+		}
+		undeclared := make([]string, 0)
+		if currentSettings.StrictAccounts {
+			undeclared = ldgStore.UndeclaredAccounts()
+		}
+
+		collisions := make([]accountCollision, 0)
+		for _, collision := range ldgStore.AccountCollisions() {
+			var renames []renameParams
+			for _, account := range collision.Accounts {
+				if account != collision.Suggested {
+					renames = append(renames, renameParams{Old: account, New: collision.Suggested})
+				}
+			}
+			collisions = append(collisions, accountCollision{AccountCollision: collision, Renames: renames})
+		}
+
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Valid":      err == nil && len(collisions) == 0 && len(undeclared) == 0,
+			"Error":      validationErr,
+			"Collisions": collisions,
+			// Undeclared lists accounts without an account directive, only when strict accounts are enabled
+			"Undeclared": undeclared,
+		})
+	}
+}
+
+// checkIntegrity reports transaction ID tags written in historical formats, and IDs which collide once normalized
+func checkIntegrity(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, ldgStore.CheckIntegrity())
+	}
+}
+
+// healIntegrity snapshots the ledger file and rewrites historical ID tags in the canonical format. Requires 'confirm=true'.
+func healIntegrity(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("confirm") != "true" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Healing rewrites the ledger file, set confirm=true to continue"))
+			return
+		}
+		report, err := ldgStore.HealIDTags()
+		if err != nil {
+			if len(report.Collisions) > 0 {
+				abortWithClientError(c, http.StatusConflict, err)
+				return
+			}
+			abortWithLedgerError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// dedupeLedger reports duplicate transactions. With 'apply=true' and the dry run's 'token', snapshots the ledger file and removes them.
+// Each removed duplicate is recorded in the journal and as a tombstone, so future syncs don't import it again.
+// Duplicates are already removed by then, so failing to record them only adds a warning to the response.
+func dedupeLedger(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+	journalStore, err := journal.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	tombstoneStore := newTombstoneStore(db)
+	return func(c *gin.Context) {
+		if c.Query("apply") != "true" {
+			c.JSON(http.StatusOK, ldgStore.FindDuplicates())
+			return
+		}
+		token := c.Query("token")
+		if token == "" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Removing duplicates requires the token from a dry run"))
+			return
+		}
+		report, err := ldgStore.Dedupe(token)
+		if err == ledger.ErrStaleDedupe {
+			abortWithClientError(c, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			abortWithLedgerError(c, err)
+			return
+		}
+		logger := c.MustGet(loggerKey).(*zap.Logger)
+		now := time.Now()
+		resp := dedupeResponse{DedupeReport: report}
+		if err := tombstoneDuplicates(tombstoneStore, report, now); err != nil {
+			logger.Error("Failed to record tombstones for removed duplicates", zap.String("snapshot", report.Snapshot), zap.Error(err))
+			resp.Warnings = append(resp.Warnings, "Removed duplicates may be imported again by future syncs: "+err.Error())
+		}
+		for _, cluster := range report.Clusters {
+			for _, txn := range cluster.Remove {
+				details := map[string]string{
+					"Cluster":  cluster.ID,
+					"Date":     txn.Date.Format(asOfDateFormat),
+					"Payee":    txn.Payee,
+					"Amount":   cluster.Amount.String(),
+					"Kept":     cluster.Keep.Postings[0].ID(),
+					"Removed":  txn.Postings[0].ID(),
+					"Merged":   strings.Join(cluster.Merged, ","),
+					"Snapshot": report.Snapshot,
+				}
+				if _, err := journalStore.Record(now, journal.DuplicateRemoved, cluster.Account, details); err != nil {
+					logger.Error("Failed to record removed duplicate in journal", zap.String("cluster", cluster.ID), zap.Error(err))
+				}
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// dedupeResponse is the report of applied duplicate removals
+type dedupeResponse struct {
+	ledger.DedupeReport
+	// Warnings explain removed duplicates which could not be recorded as tombstones
+	Warnings []string `json:",omitempty"`
+}
+
+// tombstoneDuplicates records a tombstone for each removed duplicate's IDs, except any it shared with the kept transaction
+func tombstoneDuplicates(store *tombstone.Store, report ledger.DedupeReport, deleted time.Time) error {
+	for _, cluster := range report.Clusters {
+		kept := make(map[string]bool)
+		for _, p := range cluster.Keep.Postings {
+			kept[p.ID()] = true
+		}
+		for _, txn := range cluster.Remove {
+			for _, p := range txn.Postings {
+				if id := p.ID(); id != "" && !kept[id] {
+					if err := store.Add(p.Account, id, deleted); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func renameSuggestions(accountStore *client.AccountStore) gin.HandlerFunc {
 	const DiscoverOldOrg = "Discover Financial Services"
 	return func(c *gin.Context) {
@@ -612,3 +1645,101 @@ func renameSuggestions(accountStore *client.AccountStore) gin.HandlerFunc {
 		})
 	}
 }
+
+func markShared(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			ID     string `binding:"required"`
+			Shares []ledger.Share
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := ldgStore.MarkShared(body.ID, body.Shares); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// markTransfer tags or untags a transaction as a transfer between the user's own accounts, which income and expense reports exclude
+func markTransfer(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			ID       string `binding:"required"`
+			Transfer bool
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := ldgStore.MarkTransfer(body.ID, body.Transfer); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func getReimbursables(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Reimbursables": ldgStore.Reimbursables(),
+			"Settlements":   ldgStore.Settlements(),
+		})
+	}
+}
+
+func settleReimbursable(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			ID   string `binding:"required"`
+			Name string `binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := ldgStore.SettleReimbursable(body.ID, body.Name); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func getRecurring(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Recurring": ldgStore.Recurring(),
+		})
+	}
+}
+
+const (
+	defaultForecastDays = 30
+	maxForecastDays     = 366
+)
+
+func getForecast(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days := defaultForecastDays
+		if daysQuery, ok := c.GetQuery("days"); ok {
+			parsedDays, err := strconv.ParseInt(daysQuery, 10, 64)
+			switch {
+			case err != nil:
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid integer: %s", daysQuery))
+				return
+			case parsedDays < 1 || parsedDays > maxForecastDays:
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Days must be a positive integer no more than %d", maxForecastDays))
+				return
+			}
+			days = int(parsedDays)
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Forecast": ldgStore.Forecast(time.Now(), days, c.QueryArray("exclude[]")),
+		})
+	}
+}
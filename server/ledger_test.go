@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNaturalizeBalances(t *testing.T) {
+	opening := decimal.NewFromFloat(-5)
+	resp := BalanceResponse{
+		Accounts: []AccountResponse{
+			{ID: "expenses:food", Balances: []decimal.Decimal{decimal.NewFromFloat(10), decimal.NewFromFloat(-2)}},
+			{ID: "revenues:salary", Balances: []decimal.Decimal{decimal.NewFromFloat(-100)}, OpeningBalance: &opening},
+		},
+		ClosedAccounts: []AccountResponse{
+			{ID: "revenues", Balances: []decimal.Decimal{decimal.NewFromFloat(-1)}},
+		},
+	}
+	revenueBalances := resp.Accounts[1].Balances
+
+	naturalizeBalances(&resp)
+	assert.Equal(t, []decimal.Decimal{decimal.NewFromFloat(10), decimal.NewFromFloat(-2)}, resp.Accounts[0].Balances)
+	assert.Equal(t, []decimal.Decimal{decimal.NewFromFloat(100)}, resp.Accounts[1].Balances)
+	assert.Equal(t, decimal.NewFromFloat(5), *resp.Accounts[1].OpeningBalance)
+	assert.Equal(t, []decimal.Decimal{decimal.NewFromFloat(1)}, resp.ClosedAccounts[0].Balances)
+
+	assert.Equal(t, decimal.NewFromFloat(-100), revenueBalances[0], "Original balances should not change")
+	assert.Equal(t, decimal.NewFromFloat(-5), opening, "Original opening balance should not change")
+}
+
+func TestTombstoneDuplicates(t *testing.T) {
+	store := newTombstoneStore(plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}}))
+	posting := func(account, id string) ledger.Posting {
+		p := ledger.Posting{Account: account, Amount: decimal.NewFromFloat(-1), Currency: "$"}
+		if id != "" {
+			p.Tags = map[string]string{"id": id}
+		}
+		return p
+	}
+	report := ledger.DedupeReport{Clusters: []ledger.DuplicateCluster{{
+		Keep: ledger.Transaction{Postings: []ledger.Posting{posting("assets:bank", "1"), posting("expenses:food", "")}},
+		Remove: []ledger.Transaction{
+			{Postings: []ledger.Posting{posting("assets:bank", "1"), posting("expenses:food", "")}},
+			{Postings: []ledger.Posting{posting("assets:bank", "2"), posting("expenses:food", "")}},
+		},
+	}}}
+
+	require.NoError(t, tombstoneDuplicates(store, report, time.Now()))
+	assert.False(t, store.IsDeleted("assets:bank", "1"), "IDs shared with the kept transaction should not be tombstoned")
+	assert.True(t, store.IsDeleted("assets:bank", "2"))
+}
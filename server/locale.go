@@ -0,0 +1,139 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/language"
+)
+
+const (
+	// machineLocaleName is the 'locale' query value for machine-readable formats, even if the request has an Accept-Language header
+	machineLocaleName     = "iso"
+	acceptLanguageHeader  = "Accept-Language"
+	contentLanguageHeader = "Content-Language"
+)
+
+// displayLocale renders dates and amounts in human-formatted output, like CSV exports and widget HTML.
+// The zero value is the machine locale, which renders ISO-8601 dates and ungrouped amounts with a dot decimal separator.
+type displayLocale struct {
+	tag        language.Tag
+	dateFormat string
+	group      string
+	decimal    string
+	// symbolAfter places currency symbols after amounts, like "1.234,50 €"
+	symbolAfter bool
+}
+
+var (
+	machineLocale = displayLocale{dateFormat: asOfDateFormat, decimal: "."}
+
+	// displayLocales are the supported display locales. The first is used when none of the requested locales match.
+	displayLocales = []displayLocale{
+		{tag: language.AmericanEnglish, dateFormat: "01/02/2006", group: ",", decimal: "."},
+		{tag: language.BritishEnglish, dateFormat: "02/01/2006", group: ",", decimal: "."},
+		{tag: language.German, dateFormat: "02.01.2006", group: ".", decimal: ",", symbolAfter: true},
+		{tag: language.Spanish, dateFormat: "02/01/2006", group: ".", decimal: ",", symbolAfter: true},
+		{tag: language.French, dateFormat: "02/01/2006", group: "\u00a0", decimal: ",", symbolAfter: true},
+		{tag: language.Japanese, dateFormat: "2006/01/02", group: ",", decimal: "."},
+	}
+	displayLocaleMatcher = newDisplayLocaleMatcher()
+)
+
+func newDisplayLocaleMatcher() language.Matcher {
+	tags := make([]language.Tag, 0, len(displayLocales))
+	for _, locale := range displayLocales {
+		tags = append(tags, locale.tag)
+	}
+	return language.NewMatcher(tags)
+}
+
+// negotiateLocale returns the display locale for the 'locale' query, a BCP 47 tag like "de-DE", or else the Accept-Language header.
+// Requests without either use the machine locale, so scripts get the same output regardless of the server's locale.
+func negotiateLocale(c *gin.Context) (displayLocale, error) {
+	if query := c.Query("locale"); query != "" {
+		if query == machineLocaleName {
+			return machineLocale, nil
+		}
+		tag, err := language.Parse(query)
+		if err != nil {
+			return machineLocale, errors.Errorf("Invalid locale, must be a language tag like \"en-US\" or %q: %q", machineLocaleName, query)
+		}
+		_, index, confidence := displayLocaleMatcher.Match(tag)
+		if confidence == language.No {
+			return machineLocale, errors.Errorf("Unsupported locale: %q", query)
+		}
+		return displayLocales[index], nil
+	}
+	header := c.GetHeader(acceptLanguageHeader)
+	if header == "" {
+		return machineLocale, nil
+	}
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		// browsers' headers are best-effort, so fall back instead of failing the request
+		return machineLocale, nil
+	}
+	_, index, _ := displayLocaleMatcher.Match(tags...)
+	return displayLocales[index], nil
+}
+
+// isMachine returns true if 'l' is the machine locale
+func (l displayLocale) isMachine() bool {
+	return l.tag == language.Und
+}
+
+// setContentLanguage labels localized responses with their display locale
+func (l displayLocale) setContentLanguage(c *gin.Context) {
+	if !l.isMachine() {
+		c.Header(contentLanguageHeader, l.tag.String())
+	}
+}
+
+// Date renders 't' as a date without a time of day
+func (l displayLocale) Date(t time.Time) string {
+	return t.Format(l.dateFormat)
+}
+
+// Number renders 'amount' rounded to 'decimals' without a currency symbol, for spreadsheet-friendly text like CSV files
+func (l displayLocale) Number(amount decimal.Decimal, decimals int) string {
+	fixed := amount.StringFixed(int32(decimals))
+	sign := ""
+	if strings.HasPrefix(fixed, "-") {
+		sign, fixed = "-", fixed[1:]
+	}
+	integer, fraction := fixed, ""
+	if i := strings.IndexRune(fixed, '.'); i >= 0 {
+		integer, fraction = fixed[:i], fixed[i+1:]
+	}
+	if l.group != "" {
+		var groups []string
+		for len(integer) > 3 {
+			groups = append([]string{integer[len(integer)-3:]}, groups...)
+			integer = integer[:len(integer)-3]
+		}
+		integer = strings.Join(append([]string{integer}, groups...), l.group)
+	}
+	if fraction == "" {
+		return sign + integer
+	}
+	return sign + integer + l.decimal + fraction
+}
+
+// Currency renders 'amount' with format's currency symbol, like "-$1,234.50" or "-1.234,50 €"
+func (l displayLocale) Currency(format model.CurrencyFormat, amount decimal.Decimal) string {
+	sign := ""
+	if amount.IsNegative() {
+		sign = "-"
+		amount = amount.Neg()
+	}
+	number := l.Number(amount, format.Decimals)
+	if l.symbolAfter {
+		return sign + number + " " + strings.TrimSpace(format.PrefixSymbol())
+	}
+	return sign + format.PrefixSymbol() + number
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "Update golden files in testdata")
+
+func TestNegotiateLocale(t *testing.T) {
+	for _, tc := range []struct {
+		description    string
+		query          string
+		acceptLanguage string
+		expectDate     string
+		expectErr      bool
+	}{
+		{description: "no locale", expectDate: "2024-01-02"},
+		{description: "accept language", acceptLanguage: "de-DE,de;q=0.9,en;q=0.8", expectDate: "02.01.2024"},
+		{description: "regional fallback", acceptLanguage: "en-AU", expectDate: "02/01/2024"},
+		{description: "unsupported accept language", acceptLanguage: "tlh", expectDate: "01/02/2024"},
+		{description: "malformed accept language", acceptLanguage: ";;;", expectDate: "2024-01-02"},
+		{description: "query overrides header", query: "ja", acceptLanguage: "de-DE", expectDate: "2024/01/02"},
+		{description: "machine query", query: machineLocaleName, acceptLanguage: "de-DE", expectDate: "2024-01-02"},
+		{description: "invalid query", query: "not a locale!", expectErr: true},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/?"+url.Values{"locale": {tc.query}}.Encode(), nil)
+			if tc.acceptLanguage != "" {
+				c.Request.Header.Set(acceptLanguageHeader, tc.acceptLanguage)
+			}
+			locale, err := negotiateLocale(c)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectDate, locale.Date(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)))
+		})
+	}
+}
+
+func TestDisplayLocaleFormats(t *testing.T) {
+	amount := decimal.RequireFromString("-1234567.891")
+	usd, eur, chf := model.NewCurrencyFormat("USD"), model.NewCurrencyFormat("EUR"), model.CurrencyFormat{Code: "CHF", Decimals: 2}
+	findLocale := func(tag string) displayLocale {
+		for _, locale := range displayLocales {
+			if locale.tag.String() == tag {
+				return locale
+			}
+		}
+		t.Fatalf("Locale not found: %s", tag)
+		return displayLocale{}
+	}
+
+	assert.Equal(t, "-1234567.89", machineLocale.Number(amount, 2))
+	assert.Equal(t, "-$1234567.89", machineLocale.Currency(usd, amount))
+	assert.Equal(t, usd.Format(amount), machineLocale.Currency(usd, amount), "Machine locale should match the currency's own format")
+
+	enUS := findLocale("en-US")
+	assert.Equal(t, "-1,234,567.89", enUS.Number(amount, 2))
+	assert.Equal(t, "-$1,234,567.89", enUS.Currency(usd, amount))
+	assert.Equal(t, "CHF 12.00", enUS.Currency(chf, decimal.NewFromFloat(12)))
+	assert.Equal(t, "999", enUS.Number(decimal.NewFromFloat(999), 0))
+
+	de := findLocale("de")
+	assert.Equal(t, "-1.234.567,89", de.Number(amount, 2))
+	assert.Equal(t, "-1.234.567,89 €", de.Currency(eur, amount))
+	assert.Equal(t, "12,00 CHF", de.Currency(chf, decimal.NewFromFloat(12)))
+
+	fr := findLocale("fr")
+	assert.Equal(t, "1 000,50", fr.Number(decimal.NewFromFloat(1000.5), 2))
+}
+
+// TestMachineFormatGolden renders API transactions in different server locales and time zones, which must produce identical output.
+// Run with -update to rewrite the golden file after an intended change.
+func TestMachineFormatGolden(t *testing.T) {
+	const goldenFile = "testdata/transactions.golden.json"
+	render := func(lang string, location *time.Location) []byte {
+		originalLocal := time.Local
+		defer func() { time.Local = originalLocal }()
+		time.Local = location
+		for _, key := range []string{"LANG", "LC_ALL", "LC_NUMERIC", "LC_TIME"} {
+			original, isSet := os.LookupEnv(key)
+			require.NoError(t, os.Setenv(key, lang))
+			if isSet {
+				defer os.Setenv(key, original)
+			} else {
+				defer os.Unsetenv(key)
+			}
+		}
+
+		ldg, err := ledger.NewFromReader(strings.NewReader(`
+2024/01/02=2024/01/03 (1001) Bäckerei Müller ; note: croissants
+    assets:Bank   $-1234.50 ; id: bakery
+    expenses:food   $1234.50
+
+2024/12/31 Year end interest
+    assets:Bank   $0.01 ; id: interest
+    revenues:interest   $-0.01
+`))
+		require.NoError(t, err)
+		accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+		require.NoError(t, err)
+		resp, err := newTransactionsResponse(ldg.Query(ledger.QueryOptions{}, 1, 10), accountStore, model.NewCurrencyFormat("EUR"))
+		require.NoError(t, err)
+		output, err := json.MarshalIndent(resp, "", "\t")
+		require.NoError(t, err)
+		return append(output, '\n')
+	}
+
+	berlin := time.FixedZone("CET", 60*60)
+	output := render("de_DE.UTF-8", berlin)
+	assert.Equal(t, string(output), string(render("en_US.UTF-8", time.UTC)), "Machine output should not depend on the server's locale or time zone")
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(goldenFile), 0755))
+		require.NoError(t, ioutil.WriteFile(goldenFile, output, 0644))
+	}
+	golden, err := ioutil.ReadFile(goldenFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(golden), string(output))
+}
@@ -0,0 +1,7 @@
+//go:build !race
+// +build !race
+
+package server
+
+// raceEnabled is true when tests run with the race detector, which adds its own allocations
+const raceEnabled = false
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/datalock"
+)
+
+// readyResponse reports whether this instance can serve requests, and which instance owns the data directory
+type readyResponse struct {
+	Ready      bool
+	ReadOnly   bool
+	LockHolder *datalock.Owner `json:",omitempty"`
+	Error      string          `json:",omitempty"`
+	// AccountsWatch reports hot-reloads of the accounts files, nil if not watched
+	AccountsWatch *client.AccountsWatchStatus `json:",omitempty"`
+}
+
+func getReady(options Options, watcher *client.AccountWatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := readyResponse{
+			Ready:      true,
+			ReadOnly:   options.ReadOnly,
+			LockHolder: options.LockHolder,
+		}
+		if watcher != nil {
+			status := watcher.Status()
+			resp.AccountsWatch = &status
+		}
+		if options.Lock != nil {
+			owner := options.Lock.Owner()
+			resp.LockHolder = &owner
+			if err := options.Lock.AssertHeld(); err != nil {
+				resp.Ready = false
+				resp.Error = err.Error()
+				if heldErr, ok := err.(datalock.HeldError); ok {
+					resp.LockHolder = &heldErr.Owner
+				}
+				c.JSON(http.StatusServiceUnavailable, resp)
+				return
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/reconcile"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// reconcileState is a reconciliation session's progress
+type reconcileState struct {
+	reconcile.Session
+	// Cleared is the account's total of cleared and reconciled transactions as of the statement date
+	Cleared decimal.Decimal
+	// Difference is the amount left to clear before the session can be committed
+	Difference decimal.Decimal
+	// Transactions are the account's unreconciled transactions as of the statement date
+	Transactions []ledger.Transaction
+}
+
+func newReconcileState(ldgStore *ledger.Store, session reconcile.Session) reconcileState {
+	cleared, txns := ldgStore.Unreconciled(session.Account, session.Date)
+	if txns == nil {
+		txns = []ledger.Transaction{}
+	}
+	return reconcileState{
+		Session:      session,
+		Cleared:      cleared,
+		Difference:   session.Balance.Sub(cleared),
+		Transactions: txns,
+	}
+}
+
+func newReconcileStore(db plaindb.DB) *reconcile.Store {
+	store, err := reconcile.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+// getReconcileSession returns the account's session. Aborts c and returns false if there isn't one.
+func getReconcileSession(c *gin.Context, store *reconcile.Store, account string) (reconcile.Session, bool) {
+	session, found, err := store.Get(account)
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return session, false
+	}
+	if !found {
+		abortWithClientError(c, http.StatusNotFound, errors.Errorf("No reconciliation is in progress for account: %q", account))
+		return session, false
+	}
+	return session, true
+}
+
+func startReconcile(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+	store := newReconcileStore(db)
+	return func(c *gin.Context) {
+		var body struct {
+			Account string          `binding:"required"`
+			Date    string          `binding:"required"` // the statement's closing date
+			Balance decimal.Decimal // the statement's ending balance
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		date, err := time.Parse(asOfDateFormat, body.Date)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid statement date, must be in YYYY-MM-DD format: %q", body.Date))
+			return
+		}
+		session := reconcile.Session{
+			Account: body.Account,
+			Date:    date,
+			Balance: body.Balance,
+			Started: time.Now(),
+		}
+		if err := store.Start(session); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, newReconcileState(ldgStore, session))
+	}
+}
+
+func toggleReconcile(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+	store := newReconcileStore(db)
+	return func(c *gin.Context) {
+		var body struct {
+			Account string `binding:"required"`
+			ID      string `binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		session, ok := getReconcileSession(c, store, body.Account)
+		if !ok {
+			return
+		}
+		unreconciled := false
+		_, txns := ldgStore.Unreconciled(session.Account, session.Date)
+		for _, txn := range txns {
+			for _, p := range txn.Postings {
+				if p.ID() == body.ID {
+					unreconciled = true
+				}
+			}
+		}
+		if !unreconciled {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Transaction %q is not an unreconciled transaction for %q on or before the statement date", body.ID, session.Account))
+			return
+		}
+		if _, err := ldgStore.ToggleCleared(body.ID); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, newReconcileState(ldgStore, session))
+	}
+}
+
+func commitReconcile(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+	store := newReconcileStore(db)
+	return func(c *gin.Context) {
+		var body struct {
+			Account string `binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		session, ok := getReconcileSession(c, store, body.Account)
+		if !ok {
+			return
+		}
+		if state := newReconcileState(ldgStore, session); !state.Difference.IsZero() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, map[string]interface{}{
+				"Error":      "Cleared balance does not match the statement balance",
+				"Difference": state.Difference,
+			})
+			return
+		}
+		count, err := ldgStore.Reconcile(session.Account, session.Date, session.Balance)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if err := store.End(session.Account); err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Reconciled": count,
+		})
+	}
+}
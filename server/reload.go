@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	gosync "sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/rules"
+	"github.com/johnstarich/sage/settings"
+	"github.com/johnstarich/sage/sync"
+	"github.com/johnstarich/sage/vcs"
+	"go.uber.org/zap"
+)
+
+// blockDuringReload holds requests while a reload is swapping in new data, so they never see a partial reload
+func blockDuringReload(reloadMu *gosync.RWMutex) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reloadMu.RLock()
+		defer reloadMu.RUnlock()
+		c.Next()
+	}
+}
+
+func reloadAll(
+	reloadMu *gosync.RWMutex,
+	db plaindb.DB,
+	ldgStore *ledger.Store,
+	accountStore *client.AccountStore,
+	rulesFile vcs.File,
+	rulesStore *rules.Store,
+	settingsStore *settings.Store,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := c.MustGet(loggerKey).(*zap.Logger)
+		reloadMu.Lock()
+		result, err := sync.Reload(db, ldgStore, accountStore, rulesFile, rulesStore, settingsStore)
+		reloadMu.Unlock()
+		if err != nil {
+			abortWithClientError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		if !result.Reloaded {
+			logger.Warn("Reload failed validation, keeping previous state", zap.Any("files", result.Files))
+			c.AbortWithStatusJSON(http.StatusBadRequest, map[string]interface{}{
+				"Error":  "Reload failed validation, keeping previous state",
+				"Result": result,
+			})
+			return
+		}
+		logger.Info("Reloaded all data from disk", zap.Any("changes", result.Changes))
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Result": result,
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/report"
+	"github.com/johnstarich/sage/settings"
+	"github.com/pkg/errors"
+)
+
+const (
+	dateBasisQuery = "dateBasis"
+	amortizeQuery  = "amortize"
+	foldFeesQuery  = "foldFees"
+)
+
+// queryReportLedger returns the ledger a report should use, applying c's amortize and foldFees options. Aborts c and returns false on failure.
+// Scoped API keys only see their part of the ledger.
+func queryReportLedger(c *gin.Context, ldg *ledger.Ledger) (*ledger.Ledger, bool) {
+	ldg, ok := queryAmortized(c, scopedLedger(c, ldg), true)
+	if !ok {
+		return nil, false
+	}
+	return queryFoldedFees(c, ldg)
+}
+
+// queryAmortized returns an amortized copy of ldg if c's amortize query is true, or 'amortizeDefault' if not set. Aborts c and returns false on failure.
+// Amortization only affects reports, the ledger itself is unchanged.
+func queryAmortized(c *gin.Context, ldg *ledger.Ledger, amortizeDefault bool) (*ledger.Ledger, bool) {
+	amortize := amortizeDefault
+	if amortizeStr := c.Query(amortizeQuery); amortizeStr != "" {
+		var err error
+		amortize, err = strconv.ParseBool(amortizeStr)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid amortize option, must be true or false: %q", amortizeStr))
+			return nil, false
+		}
+	}
+	if amortize {
+		return ldg.Amortized(), true
+	}
+	return ldg, true
+}
+
+// queryFoldedFees returns a copy of ldg where linked fees are categorized like their purchases if c's foldFees query is true. Aborts c and returns false on failure.
+func queryFoldedFees(c *gin.Context, ldg *ledger.Ledger) (*ledger.Ledger, bool) {
+	foldStr := c.Query(foldFeesQuery)
+	if foldStr == "" {
+		return ldg, true
+	}
+	fold, err := strconv.ParseBool(foldStr)
+	if err != nil {
+		abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Invalid foldFees option, must be true or false: %q", foldStr))
+		return nil, false
+	}
+	if fold {
+		return ldg.FoldedFees(), true
+	}
+	return ldg, true
+}
+
+// queryDateBasis returns c's date basis, or the default report setting if not set. Aborts c and returns false on failure.
+func queryDateBasis(c *gin.Context, settingsStore *settings.Store) (ledger.DateBasis, bool) {
+	if basis := c.Query(dateBasisQuery); basis != "" {
+		dateBasis, err := ledger.ParseDateBasis(basis)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return "", false
+		}
+		return dateBasis, true
+	}
+	current, err := settingsStore.Settings()
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return "", false
+	}
+	return current.Report.DateBasis, true
+}
+
+func getReportSettings(settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current, err := settingsStore.Settings()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, current.Report)
+	}
+}
+
+func updateReportSettings(settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var reportSettings report.Settings
+		if err := c.ShouldBindJSON(&reportSettings); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := settingsStore.Update(settings.Update{Report: &reportSettings}); err != nil {
+			abortWithSettingsError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/reported"
+	"github.com/johnstarich/sage/sync"
+	"github.com/pkg/errors"
+)
+
+func newReportedStore(db plaindb.DB) *reported.Store {
+	store, err := reported.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+// refreshBalance fetches only the institution-reported balances for each 'accountID', or every supported account if 'all' is true, and compares them to the ledger
+func refreshBalance(db plaindb.DB, ldgStore *ledger.Store, accountStore *client.AccountStore) gin.HandlerFunc {
+	store := newReportedStore(db)
+	return func(c *gin.Context) {
+		ids := c.QueryArray("accountID")
+		all := c.Query("all") == "true"
+		if len(ids) == 0 && !all {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("accountID or all=true is required"))
+			return
+		}
+		if len(ids) > 0 && all {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("accountID and all=true cannot be used together"))
+			return
+		}
+		balances, err := sync.RefreshBalances(ldgStore, accountStore, store, ids)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Balances": balances,
+		})
+	}
+}
@@ -1,21 +1,63 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/budget"
+	"github.com/johnstarich/sage/client/model"
 	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
 	"github.com/johnstarich/sage/rules"
+	"github.com/johnstarich/sage/settings"
 	"github.com/johnstarich/sage/sync"
 	"github.com/johnstarich/sage/vcs"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 // CSVRule is the request model for changing a single rule
 type CSVRule struct {
 	Conditions []string
 	Account2   string
+	Splits     []rules.Split
+	// Amortize spreads matching transactions over this many months in reports
+	Amortize int
+}
+
+func (r CSVRule) rule() (rules.Rule, error) {
+	var rule rules.Rule
+	var err error
+	if len(r.Splits) > 0 {
+		rule, err = rules.NewCSVSplitRule("", "", r.Splits, r.Conditions...)
+	} else {
+		rule, err = rules.NewCSVRule("", r.Account2, "", r.Conditions...)
+	}
+	if err != nil || r.Amortize == 0 {
+		return rule, err
+	}
+	return rules.AmortizeRule(rule, r.Amortize)
+}
+
+// rulesPayload is the request model for replacing all rules. Accepts either a plain list of rules or an object with a CategoryCodes section.
+type rulesPayload struct {
+	Rules rules.Rules
+	// CategoryCodes overrides the default SIC/MCC code categories. Leaves the current overrides in place if omitted.
+	CategoryCodes rules.CategoryCodes
+	// SplitTemplates replaces the payee split templates. Leaves the current templates in place if omitted.
+	SplitTemplates *rules.SplitTemplates
+}
+
+func (p *rulesPayload) UnmarshalJSON(b []byte) error {
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		return json.Unmarshal(b, &p.Rules)
+	}
+	type payloadJSON rulesPayload
+	return json.Unmarshal(b, (*payloadJSON)(p))
 }
 
 func getRules(rulesStore *rules.Store, ldgStore *ledger.Store) gin.HandlerFunc {
@@ -27,17 +69,28 @@ func getRules(rulesStore *rules.Store, ldgStore *ledger.Store) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
-		var result interface{} = rulesStore
 		if options.Transaction != "" {
 			txn, found := ldgStore.Transaction(options.Transaction)
 			if !found {
 				abortWithClientError(c, http.StatusNotFound, errors.New("Transaction not found"))
 				return
 			}
-			result = rulesStore.Matches(&txn)
+			response := map[string]interface{}{
+				"Rules": rulesStore.Matches(&txn),
+			}
+			if code := rulesStore.ClassifiedBy(txn); code != "" {
+				response["ClassifiedBy"] = "classified by MCC " + code
+			}
+			if template := txn.Tags[ledger.SplitTemplateTag]; template != "" {
+				response["SplitTemplate"] = template
+			}
+			c.JSON(http.StatusOK, response)
+			return
 		}
 		c.JSON(http.StatusOK, map[string]interface{}{
-			"Rules": result,
+			"Rules":          rulesStore,
+			"CategoryCodes":  rulesStore.CategoryCodes(),
+			"SplitTemplates": rulesStore.SplitTemplates(),
 		})
 	}
 }
@@ -62,32 +115,140 @@ func getRule(rulesStore *rules.Store) gin.HandlerFunc {
 	}
 }
 
-func updateRules(rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
+// categoryReferences maps category account keys to what still uses them, so rule changes can warn before orphaning them
+func categoryReferences(db plaindb.DB, settingsStore *settings.Store) (map[string][]string, error) {
+	references := make(map[string][]string)
+	addReference := func(category, referencedBy string) {
+		if category != "" {
+			key := ledger.AccountKey(category)
+			references[key] = append(references[key], referencedBy)
+		}
+	}
+	budgetStore, err := budget.NewStore(db)
+	if err != nil {
+		return nil, err
+	}
+	budgetAccounts, err := budgetStore.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range budgetAccounts {
+		addReference(account, "budgets")
+	}
+	currentSettings, err := settingsStore.Settings()
+	if err != nil {
+		return nil, err
+	}
+	addReference(currentSettings.DefaultCategory, "default category setting")
+	addReference(currentSettings.ForeignFees.Category, "foreign fees setting")
+	return references, nil
+}
+
+// checkRules compares 'newRules' to the current rules. Returns any warnings and true if the caller should save 'newRules'.
+// If there are warnings, aborts with them instead, unless the request sets force=true.
+func checkRules(c *gin.Context, db plaindb.DB, settingsStore *settings.Store, rulesStore *rules.Store, newRules rules.Rules) ([]rules.Warning, bool) {
+	var options struct {
+		Force bool `form:"force"`
+	}
+	if err := c.BindQuery(&options); err != nil {
+		abortWithClientError(c, http.StatusBadRequest, err)
+		return nil, false
+	}
+	references, err := categoryReferences(db, settingsStore)
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	warnings := rules.Check(rulesStore.Rules(), newRules, references)
+	if len(warnings) > 0 && !options.Force {
+		logger := c.MustGet(loggerKey).(*zap.Logger)
+		logger.Info("Aborting with rule warnings", zap.Int("warnings", len(warnings)))
+		c.AbortWithStatusJSON(http.StatusConflict, map[string]interface{}{
+			"Error":    "Rules may have mistakes, review the warnings and save again with force=true to keep them",
+			"Warnings": warnings,
+		})
+		return nil, false
+	}
+	return warnings, true
+}
+
+// abortWithRuleErrors responds with the position of each invalid rule if err is a RuleErrors. Returns true if aborted.
+func abortWithRuleErrors(c *gin.Context, err error) bool {
+	ruleErrs, ok := errors.Cause(err).(rules.RuleErrors)
+	if !ok {
+		return false
+	}
+	logger := c.MustGet(loggerKey).(*zap.Logger)
+	logger.Info("Aborting with invalid rules", zap.String("error", err.Error()))
+	c.AbortWithStatusJSON(http.StatusBadRequest, map[string]interface{}{
+		"Error":      errors.Wrap(err, "Malformed rules").Error(),
+		"RuleErrors": ruleErrs,
+	})
+	return true
+}
+
+// rulesSaved responds with any warnings accepted by force=true, or no content if there weren't any
+func rulesSaved(c *gin.Context, warnings []rules.Warning) {
+	if len(warnings) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"Warnings": warnings,
+	})
+}
+
+func updateRules(db plaindb.DB, settingsStore *settings.Store, rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		decoder := json.NewDecoder(c.Request.Body)
-		var newRules rules.Rules
-		if err := decoder.Decode(&newRules); err != nil {
+		var payload rulesPayload
+		if err := decoder.Decode(&payload); err != nil {
+			if abortWithRuleErrors(c, err) {
+				return
+			}
 			c.AbortWithStatusJSON(http.StatusBadRequest, map[string]string{
 				"Error": errors.Wrap(err, "Malformed rules").Error(),
 			})
 			return
 		}
-		rulesStore.Replace(newRules)
+		if payload.SplitTemplates != nil {
+			if err := (*payload.SplitTemplates).Validate(); err != nil {
+				abortWithClientError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if payload.CategoryCodes != nil {
+			if err := payload.CategoryCodes.Validate(); err != nil {
+				abortWithClientError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		warnings, ok := checkRules(c, db, settingsStore, rulesStore, payload.Rules)
+		if !ok {
+			return
+		}
+		if payload.CategoryCodes != nil {
+			_ = rulesStore.SetCategoryCodes(payload.CategoryCodes) // validated above
+		}
+		if payload.SplitTemplates != nil {
+			_ = rulesStore.SetSplitTemplates(*payload.SplitTemplates) // validated above
+		}
+		rulesStore.Replace(payload.Rules)
 		if err := sync.Rules(rulesFile, rulesStore); err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
-		c.Status(http.StatusNoContent)
+		rulesSaved(c, warnings)
 	}
 }
 
-func updateRule(rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
+func updateRule(db plaindb.DB, settingsStore *settings.Store, rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var bodyRule struct {
 			CSVRule
 			Index *int
 		}
-		if err := c.BindJSON(&bodyRule); err != nil {
+		if err := c.ShouldBindJSON(&bodyRule); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
@@ -95,11 +256,21 @@ func updateRule(rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusBadRequest, errors.New("Rule index is required"))
 			return
 		}
-		rule, err := rules.NewCSVRule("", bodyRule.Account2, "", bodyRule.Conditions...)
+		rule, err := bodyRule.rule()
 		if err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
+		newRules := rulesStore.Rules()
+		if *bodyRule.Index < 0 || *bodyRule.Index >= len(newRules) {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Rule not found"))
+			return
+		}
+		newRules[*bodyRule.Index] = rule
+		warnings, ok := checkRules(c, db, settingsStore, rulesStore, newRules)
+		if !ok {
+			return
+		}
 		err = rulesStore.Update(*bodyRule.Index, rule)
 		if err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
@@ -109,39 +280,47 @@ func updateRule(rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
-		c.Status(http.StatusNoContent)
+		rulesSaved(c, warnings)
 	}
 }
 
-func addRule(rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
+func addRule(db plaindb.DB, settingsStore *settings.Store, rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var bodyRule CSVRule
-		if err := c.BindJSON(&bodyRule); err != nil {
+		if err := c.ShouldBindJSON(&bodyRule); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
-		rule, err := rules.NewCSVRule("", bodyRule.Account2, "", bodyRule.Conditions...)
+		rule, err := bodyRule.rule()
 		if err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
+		warnings, ok := checkRules(c, db, settingsStore, rulesStore, append(rulesStore.Rules(), rule))
+		if !ok {
+			return
+		}
 		newIndex := rulesStore.Add(rule)
 		if err := sync.Rules(rulesFile, rulesStore); err != nil {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
-		c.JSON(http.StatusOK, map[string]interface{}{
+		response := map[string]interface{}{
 			"Index": newIndex,
-		})
+		}
+		if len(warnings) > 0 {
+			response["Warnings"] = warnings
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
-func deleteRule(rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
+func deleteRule(db plaindb.DB, settingsStore *settings.Store, rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var bodyRule struct {
 			Index *int
 		}
-		if err := c.BindJSON(&bodyRule); err != nil {
+		if err := c.ShouldBindJSON(&bodyRule); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
 		}
@@ -149,6 +328,16 @@ func deleteRule(rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusBadRequest, errors.New("Index is required"))
 			return
 		}
+		currentRules := rulesStore.Rules()
+		if *bodyRule.Index < 0 || *bodyRule.Index >= len(currentRules) {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Rule not found"))
+			return
+		}
+		newRules := append(currentRules[:*bodyRule.Index:*bodyRule.Index], currentRules[*bodyRule.Index+1:]...)
+		warnings, ok := checkRules(c, db, settingsStore, rulesStore, newRules)
+		if !ok {
+			return
+		}
 		if err := rulesStore.Remove(*bodyRule.Index); err != nil {
 			abortWithClientError(c, http.StatusBadRequest, err)
 			return
@@ -157,6 +346,104 @@ func deleteRule(rulesFile vcs.File, rulesStore *rules.Store) gin.HandlerFunc {
 			abortWithClientError(c, http.StatusInternalServerError, err)
 			return
 		}
-		c.Status(http.StatusNoContent)
+		rulesSaved(c, warnings)
+	}
+}
+
+// previewApplyRules returns the category changes applying the current rules, or a candidate set of rules, would make to the ledger. Nothing is written.
+func previewApplyRules(rulesStore *rules.Store, ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			// Rules is a candidate rule set to preview instead of the current rules, if set
+			Rules      *rules.Rules
+			Start, End time.Time
+		}
+		if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil && err != io.EOF {
+			abortWithClientError(c, http.StatusBadRequest, errors.Wrap(err, "Malformed rules"))
+			return
+		}
+		store := rulesStore
+		if body.Rules != nil {
+			store = rules.NewStore(*body.Rules)
+		}
+		result := ldgStore.Query(ledger.QueryOptions{Start: body.Start, End: body.End}, 1, ldgStore.Size()+1)
+		changes := store.Preview(result.Transactions)
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Count":   len(changes),
+			"Changes": changes,
+		})
+	}
+}
+
+// evaluateRules categorizes a sample transaction with a candidate set of rules. Nothing is read from or written to the stored rules.
+func evaluateRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Rules          rules.Rules
+			CategoryCodes  rules.CategoryCodes
+			SplitTemplates rules.SplitTemplates
+			// Precedence is the classifier stage order, or the default order if empty
+			Precedence  []string
+			Transaction ledger.Transaction
+		}
+		if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Wrap(err, "Malformed rules"))
+			return
+		}
+		store := rules.NewStore(body.Rules)
+		if body.CategoryCodes != nil {
+			if err := store.SetCategoryCodes(body.CategoryCodes); err != nil {
+				abortWithClientError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if err := store.SetSplitTemplates(body.SplitTemplates); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := store.SetPrecedence(body.Precedence); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := body.Transaction.Validate(); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, errors.Wrap(err, "Malformed transaction"))
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Evaluation": store.Evaluate(body.Transaction),
+		})
+	}
+}
+
+// explainTransaction re-classifies a stored transaction as if it were just downloaded, and responds with each classifier stage's result in precedence order.
+// The stored transaction is not changed.
+func explainTransaction(ldgStore *ledger.Store, rulesStore *rules.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Query("id")
+		if id == "" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Transaction ID is required"))
+			return
+		}
+		txn, found := ldgStore.Transaction(id)
+		if !found {
+			abortWithClientError(c, http.StatusNotFound, errors.Errorf("Transaction not found: %q", id))
+			return
+		}
+		if len(txn.Postings) == 0 {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Transaction has no postings: %q", id))
+			return
+		}
+		// downloaded transactions have a single uncategorized balancing posting
+		source := txn.Postings[0]
+		downloaded := txn
+		downloaded.Postings = []ledger.Posting{
+			source,
+			{Account: model.Uncategorized, Amount: source.Amount.Neg(), Currency: source.Currency},
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Transaction": txn,
+			"Precedence":  rulesStore.Precedence(),
+			"Evaluation":  rulesStore.Evaluate(downloaded),
+		})
 	}
 }
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// SyncSchedule runs auto-sync at the times matching a cron expression, instead of on a fixed interval.
+// The zero value disables the schedule, so the settings' sync interval is used.
+type SyncSchedule struct {
+	// Cron is a standard 5 field cron expression, like "0 6,18 * * *" for 6am and 6pm, or a descriptor like "@daily"
+	Cron string
+	// TimeZone is the IANA time zone the expression's times are in, like America/Denver. Defaults to the local time zone.
+	TimeZone string
+}
+
+// Enabled returns true if a cron expression is set
+func (s SyncSchedule) Enabled() bool {
+	return s.Cron != ""
+}
+
+// Validate returns an error if the cron expression or time zone is invalid
+func (s SyncSchedule) Validate() error {
+	_, err := s.parse()
+	return err
+}
+
+func (s SyncSchedule) parse() (*syncSchedule, error) {
+	location := time.Local
+	if s.TimeZone != "" {
+		var err error
+		location, err = time.LoadLocation(s.TimeZone)
+		if err != nil || s.TimeZone == "Local" {
+			return nil, errors.Errorf("Invalid sync schedule time zone, must be an IANA time zone name like America/Denver: %q", s.TimeZone)
+		}
+	}
+	schedule, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid sync schedule cron expression %q", s.Cron)
+	}
+	return &syncSchedule{schedule: schedule, location: location}, nil
+}
+
+// syncSchedule computes the next auto-sync times for a SyncSchedule
+type syncSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+// Next returns the first scheduled time after 'now'. Times are matched in the schedule's time zone, so they stay put across DST changes.
+func (s *syncSchedule) Next(now time.Time) time.Time {
+	// schedules without a CRON_TZ prefix match times in the location of the time they're given
+	return s.schedule.Next(now.In(s.location))
+}
+
+// runSyncSchedule calls autoSync at each scheduled time until 'done' receives
+func runSyncSchedule(schedule *syncSchedule, done <-chan bool, autoSync func(), logger *zap.Logger) {
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			logger.Warn("Sync schedule has no future times, auto-sync stopped")
+			return
+		}
+		logger.Info("Scheduled next auto-sync", zap.Time("time", next))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			autoSync()
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncScheduleValidate(t *testing.T) {
+	assert.NoError(t, SyncSchedule{Cron: "0 6,18 * * *", TimeZone: "America/New_York"}.Validate())
+	assert.NoError(t, SyncSchedule{Cron: "@daily"}.Validate())
+	assert.Error(t, SyncSchedule{Cron: "0 25 * * *"}.Validate())
+	assert.Error(t, SyncSchedule{Cron: "every morning"}.Validate())
+	assert.Error(t, SyncSchedule{Cron: "0 6 * * *", TimeZone: "Mars/Olympus_Mons"}.Validate())
+	assert.False(t, SyncSchedule{TimeZone: "America/New_York"}.Enabled())
+}
+
+func TestSyncScheduleNext(t *testing.T) {
+	schedule, err := SyncSchedule{Cron: "0 6,18 * * *", TimeZone: "America/New_York"}.parse()
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// DST starts at 2am on 2020-03-08 in New York
+	now := time.Date(2020, 3, 7, 12, 0, 0, 0, newYork).UTC()
+	var next []time.Time
+	for i := 0; i < 3; i++ {
+		now = schedule.Next(now)
+		next = append(next, now.UTC())
+	}
+	assert.Equal(t, []time.Time{
+		time.Date(2020, 3, 7, 23, 0, 0, 0, time.UTC), // 6pm EST
+		time.Date(2020, 3, 8, 10, 0, 0, 0, time.UTC), // 6am EDT
+		time.Date(2020, 3, 8, 22, 0, 0, 0, time.UTC), // 6pm EDT
+	}, next)
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/apikey"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+)
+
+const (
+	apiPrefix        = "/api/v1"
+	apiKeyHeaderName = "X-Api-Key"
+	scopeContextKey  = "scope"
+
+	fullAccessScope = "full access"
+)
+
+// scopedRoutes are the only endpoints scoped API keys may call, and the access each requires. All other endpoints require full access.
+// Every endpoint listed must read through scopedLedger and scopedAccount, and check changes with requireScopedTransaction or requireScopedAccount.
+var scopedRoutes = map[string]string{
+	"GET /getAccounts":       apikey.ReadAccess,
+	"GET /getBalances":       apikey.ReadAccess,
+	"GET /getCategoryTotals": apikey.ReadAccess,
+	"GET /getTransactions":   apikey.ReadAccess,
+	"GET /spendingBreakdown": apikey.ReadAccess,
+	"POST /recordBalance":    apikey.WriteAccess,
+	"POST /setNote":          apikey.WriteAccess,
+}
+
+// requestScope is the data a scoped API key can access. A nil scope has full access.
+type requestScope struct {
+	key apikey.Key
+	// accounts are the allowed ledger account names, nil if all are allowed
+	accounts []string
+}
+
+func newAPIKeyStore(db plaindb.DB) *apikey.Store {
+	store, err := apikey.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+func newRequestScope(key apikey.Key, accountStore *client.AccountStore) (*requestScope, error) {
+	scope := &requestScope{key: key}
+	if len(key.Scope.Accounts) == 0 {
+		return scope, nil
+	}
+	scope.accounts = make([]string, 0, len(key.Scope.Accounts))
+	for _, id := range key.Scope.Accounts {
+		var account model.Account
+		found, err := accountStore.Get(id, &account)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			scope.accounts = append(scope.accounts, model.LedgerAccountName(account))
+		}
+	}
+	return scope, nil
+}
+
+func (s *requestScope) allowsAccount(name string) bool {
+	if s == nil || s.accounts == nil {
+		return true
+	}
+	for _, allowed := range s.accounts {
+		if ledger.HasAccountPrefix(name, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *requestScope) allowsCategory(name string) bool {
+	if s == nil || len(s.key.Scope.Categories) == 0 {
+		return true
+	}
+	for _, allowed := range s.key.Scope.Categories {
+		if ledger.HasAccountPrefix(name, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func missingScopeError(scope string) error {
+	return errors.Errorf("API key is missing scope: %s", scope)
+}
+
+// requireScope authenticates requests with an API key, and limits them to the key's scope. Requests without an API key are left to the other authenticators.
+func requireScope(db plaindb.DB, accountStore *client.AccountStore) gin.HandlerFunc {
+	store := newAPIKeyStore(db)
+	return func(c *gin.Context) {
+		secretKey := c.GetHeader(apiKeyHeaderName)
+		if secretKey == "" {
+			return
+		}
+		key, valid := store.Validate(secretKey)
+		if !valid {
+			abortWithClientError(c, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+		route := c.Request.Method + " " + strings.TrimPrefix(c.Request.URL.Path, apiPrefix)
+		access, allowed := scopedRoutes[route]
+		if !allowed {
+			abortWithClientError(c, http.StatusForbidden, missingScopeError(fullAccessScope))
+			return
+		}
+		if access == apikey.WriteAccess && key.Scope.Access != apikey.WriteAccess {
+			abortWithClientError(c, http.StatusForbidden, missingScopeError(apikey.WriteAccess))
+			return
+		}
+		scope, err := newRequestScope(key, accountStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Set(scopeContextKey, scope)
+	}
+}
+
+// getScope returns c's API key scope, or nil for full access
+func getScope(c *gin.Context) *requestScope {
+	scope, ok := c.Get(scopeContextKey)
+	if !ok {
+		return nil
+	}
+	return scope.(*requestScope)
+}
+
+// scopedLedger returns the part of ldg c's API key can access, or ldg itself for full access
+func scopedLedger(c *gin.Context, ldg *ledger.Ledger) *ledger.Ledger {
+	scope := getScope(c)
+	if scope == nil {
+		return ldg
+	}
+	return ldg.Scoped(scope.allowsAccount, scope.allowsCategory)
+}
+
+// scopedAccount returns true if c's API key can access 'account'
+func scopedAccount(c *gin.Context, account model.Account) bool {
+	return getScope(c).allowsAccount(model.LedgerAccountName(account))
+}
+
+// requireScopedTransaction returns true if c's API key can access transaction 'id'. Otherwise aborts c and returns false.
+// Missing transactions are rejected the same way, so keys can't infer which out-of-scope transactions exist.
+func requireScopedTransaction(c *gin.Context, ldg *ledger.Ledger, id string) bool {
+	if getScope(c) == nil {
+		return true
+	}
+	if _, found := scopedLedger(c, ldg).Transaction(id); !found {
+		abortWithClientError(c, http.StatusForbidden, missingScopeError("transaction "+id))
+		return false
+	}
+	return true
+}
+
+// requireScopedAccount returns true if c's API key can access account 'id'. Otherwise aborts c and returns false.
+// Missing accounts are rejected the same way, so keys can't infer which out-of-scope accounts exist.
+func requireScopedAccount(c *gin.Context, accountStore *client.AccountStore, id string) bool {
+	if getScope(c) == nil {
+		return true
+	}
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return false
+	}
+	if !found || !scopedAccount(c, account) {
+		abortWithClientError(c, http.StatusForbidden, missingScopeError("account "+id))
+		return false
+	}
+	return true
+}
+
+func getAPIKeys(db plaindb.DB) gin.HandlerFunc {
+	store := newAPIKeyStore(db)
+	return func(c *gin.Context) {
+		keys, err := store.All()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Keys": keys,
+		})
+	}
+}
+
+func addAPIKey(db plaindb.DB, accountStore *client.AccountStore) gin.HandlerFunc {
+	store := newAPIKeyStore(db)
+	return func(c *gin.Context) {
+		var body struct {
+			Label string
+			Scope apikey.Scope
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		for _, id := range body.Scope.Accounts {
+			var account model.Account
+			found, err := accountStore.Get(id, &account)
+			if err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+				return
+			}
+			if !found {
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Account not found: %q", id))
+				return
+			}
+		}
+		secretKey, key, err := store.Create(body.Label, body.Scope, time.Now())
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Key":    secretKey,
+			"APIKey": key,
+		})
+	}
+}
+
+func deleteAPIKey(db plaindb.DB) gin.HandlerFunc {
+	store := newAPIKeyStore(db)
+	return func(c *gin.Context) {
+		if err := store.Revoke(c.Param("id")); err != nil {
+			abortWithClientError(c, http.StatusNotFound, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/apikey"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/report"
+	"github.com/johnstarich/sage/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+type memFile struct {
+	data []byte
+}
+
+func (m *memFile) Write(b []byte) error {
+	m.data = append([]byte(nil), b...)
+	return nil
+}
+
+func (m *memFile) Path() string {
+	return ""
+}
+
+func (m *memFile) Read() ([]byte, error) {
+	return m.data, nil
+}
+
+const scopeTestLedger = `
+2020/01/01 interest
+    assets:savings bank:****1111   $100.00 ; id: savings-1
+    revenues:interest
+
+2020/01/02 groceries
+    liabilities:secret card:****2222   $-57.00 ; id: card-1
+    expenses:food
+
+2020/01/03 pay card
+    assets:savings bank:****1111   $-25.00 ; id: savings-2
+    liabilities:secret card:****2222   $25.00
+`
+
+func scopeTestServer(t *testing.T, scope apikey.Scope) (engine *gin.Engine, secretKey string) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	accountStore, err := client.NewAccountStore(db)
+	require.NoError(t, err)
+	require.NoError(t, accountStore.Add(model.NewManualAccount("1111", "rainy day fund", model.AssetAccount, "savings bank")))
+	require.NoError(t, accountStore.Add(model.NewManualAccount("2222", "hidden card", model.LiabilityAccount, "secret card")))
+	ldgStore, err := ledger.NewStore(&memFile{data: []byte(scopeTestLedger)}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	settingsStore, err := settings.NewStore(db, settings.Settings{Report: report.Settings{DateBasis: ledger.PostingBasis}})
+	require.NoError(t, err)
+	keys := newAPIKeyStore(db)
+	secretKey, _, err = keys.Create("spreadsheet", scope, time.Now())
+	require.NoError(t, err)
+
+	engine = gin.New()
+	logger := zaptest.NewLogger(t)
+	engine.Use(func(c *gin.Context) {
+		c.Set(loggerKey, logger)
+	})
+	api := engine.Group(apiPrefix)
+	api.Use(requireScope(db, accountStore))
+	api.GET("/getAccounts", getAccounts(accountStore, ldgStore, settingsStore))
+	api.GET("/getBalances", getBalances(db, ldgStore, accountStore, settingsStore))
+	api.GET("/getCategoryTotals", getCategoryTotals(ldgStore, settingsStore))
+	api.GET("/getTransactions", getTransactions(ldgStore, accountStore, settingsStore))
+	api.GET("/getTransaction", getTransaction(ldgStore))
+	api.GET("/spendingBreakdown", getSpendingBreakdown(ldgStore, settingsStore))
+	api.POST("/setNote", setNote(ldgStore))
+	api.POST("/recordBalance", recordBalance(ldgStore, accountStore))
+	return engine, secretKey
+}
+
+func scopeTestRequest(engine *gin.Engine, secretKey, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, apiPrefix+path, strings.NewReader(body))
+	if secretKey != "" {
+		req.Header.Set(apiKeyHeaderName, secretKey)
+	}
+	resp := httptest.NewRecorder()
+	engine.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestScopedKeyCannotInferOtherAccounts(t *testing.T) {
+	engine, secretKey := scopeTestServer(t, apikey.Scope{Access: apikey.ReadAccess, Accounts: []string{"1111"}})
+
+	for _, path := range []string{
+		"/getAccounts",
+		"/getBalances",
+		"/getBalances?accountTypes=expenses&accountTypes=revenues&accountTypes=liabilities",
+		"/getBalances?asOf=2020-01-31",
+		"/getCategoryTotals?asOf=2020-01-31",
+		"/getTransactions?results=50",
+		"/getTransactions?results=50&accounts=liabilities:secret%20card:****2222",
+		"/spendingBreakdown?start=2020-01-01T00:00:00Z&end=2020-01-31T00:00:00Z",
+	} {
+		t.Run(path, func(t *testing.T) {
+			resp := scopeTestRequest(engine, secretKey, http.MethodGet, path, "")
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			body := resp.Body.String()
+			for _, secret := range []string{"2222", "secret card", "hidden card", "card-1", "groceries", "food", "57"} {
+				assert.NotContains(t, body, secret)
+			}
+		})
+	}
+
+	resp := scopeTestRequest(engine, secretKey, http.MethodGet, "/getTransactions?results=50", "")
+	assert.Contains(t, resp.Body.String(), "savings-1")
+	assert.Contains(t, resp.Body.String(), ledger.RedactedAccount, "Transfers to out-of-scope accounts should be redacted")
+	resp = scopeTestRequest(engine, secretKey, http.MethodGet, "/getAccounts", "")
+	assert.Contains(t, resp.Body.String(), "rainy day fund")
+}
+
+func TestScopedKeyRejectsOutOfScopeRequests(t *testing.T) {
+	readEngine, readKey := scopeTestServer(t, apikey.Scope{Access: apikey.ReadAccess, Accounts: []string{"1111"}})
+	writeEngine, writeKey := scopeTestServer(t, apikey.Scope{Access: apikey.WriteAccess, Accounts: []string{"1111"}})
+
+	for _, tc := range []struct {
+		description string
+		engine      *gin.Engine
+		secretKey   string
+		method      string
+		path        string
+		body        string
+		expectCode  int
+		expectErr   string
+	}{
+		{
+			description: "invalid key",
+			engine:      readEngine,
+			secretKey:   "bad.key",
+			method:      http.MethodGet,
+			path:        "/getTransactions",
+			expectCode:  http.StatusUnauthorized,
+			expectErr:   "Unauthorized",
+		},
+		{
+			description: "endpoint without scoped filtering",
+			engine:      readEngine,
+			secretKey:   readKey,
+			method:      http.MethodGet,
+			path:        "/getTransaction?id=savings-1",
+			expectCode:  http.StatusForbidden,
+			expectErr:   "API key is missing scope: full access",
+		},
+		{
+			description: "read only key mutating",
+			engine:      readEngine,
+			secretKey:   readKey,
+			method:      http.MethodPost,
+			path:        "/setNote",
+			body:        `{"ID": "savings-1", "Note": "hi"}`,
+			expectCode:  http.StatusForbidden,
+			expectErr:   "API key is missing scope: read-write",
+		},
+		{
+			description: "out of scope transaction",
+			engine:      writeEngine,
+			secretKey:   writeKey,
+			method:      http.MethodPost,
+			path:        "/setNote",
+			body:        `{"ID": "card-1", "Note": "hi"}`,
+			expectCode:  http.StatusForbidden,
+			expectErr:   "API key is missing scope: transaction card-1",
+		},
+		{
+			description: "missing transaction looks the same as out of scope",
+			engine:      writeEngine,
+			secretKey:   writeKey,
+			method:      http.MethodPost,
+			path:        "/setNote",
+			body:        `{"ID": "card-2", "Note": "hi"}`,
+			expectCode:  http.StatusForbidden,
+			expectErr:   "API key is missing scope: transaction card-2",
+		},
+		{
+			description: "out of scope account",
+			engine:      writeEngine,
+			secretKey:   writeKey,
+			method:      http.MethodPost,
+			path:        "/recordBalance?id=2222&date=2020-02-01&amount=1",
+			expectCode:  http.StatusForbidden,
+			expectErr:   "API key is missing scope: account 2222",
+		},
+		{
+			description: "missing account looks the same as out of scope",
+			engine:      writeEngine,
+			secretKey:   writeKey,
+			method:      http.MethodPost,
+			path:        "/recordBalance?id=3333&date=2020-02-01&amount=1",
+			expectCode:  http.StatusForbidden,
+			expectErr:   "API key is missing scope: account 3333",
+		},
+		{
+			description: "in scope mutation",
+			engine:      writeEngine,
+			secretKey:   writeKey,
+			method:      http.MethodPost,
+			path:        "/setNote",
+			body:        `{"ID": "savings-1", "Note": "hi"}`,
+			expectCode:  http.StatusNoContent,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			resp := scopeTestRequest(tc.engine, tc.secretKey, tc.method, tc.path, tc.body)
+			assert.Equal(t, tc.expectCode, resp.Code, resp.Body.String())
+			if tc.expectErr != "" {
+				assert.Contains(t, resp.Body.String(), tc.expectErr)
+			}
+		})
+	}
+}
+
+func TestUnscopedRequestsHaveFullAccess(t *testing.T) {
+	engine, _ := scopeTestServer(t, apikey.Scope{Access: apikey.ReadAccess, Accounts: []string{"1111"}})
+	resp := scopeTestRequest(engine, "", http.MethodGet, "/getTransactions?results=50", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "card-1")
+}
@@ -6,23 +6,29 @@ package server
 
 import (
 	"net/http"
+	gosync "sync"
 	"time"
 
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/audit"
+	"github.com/johnstarich/sage/changeset"
 	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/datalock"
+	"github.com/johnstarich/sage/envelope"
 	"github.com/johnstarich/sage/ledger"
 	"github.com/johnstarich/sage/plaindb"
 	"github.com/johnstarich/sage/redactor"
 	"github.com/johnstarich/sage/rules"
+	"github.com/johnstarich/sage/settings"
 	"github.com/johnstarich/sage/sync"
 	"github.com/johnstarich/sage/vcs"
 	"go.uber.org/zap"
 )
 
 const (
-	syncInterval = 4 * time.Hour
-	loggerKey    = "logger"
+	keepAliveInterval = 6 * time.Hour
+	loggerKey         = "logger"
 )
 
 // Options contains options for configuring the Sage HTTP server
@@ -30,6 +36,34 @@ type Options struct {
 	Address  string
 	AutoSync bool
 	Password redactor.String
+	// WebDir serves the web UI from this directory instead of the embedded assets, if set
+	WebDir string
+
+	// ReadOnly is set when another instance holds the data directory lock, identified by LockHolder
+	ReadOnly   bool
+	LockHolder *datalock.Owner
+	// Lock is this instance's data directory lock, nil when ReadOnly
+	Lock *datalock.Lock
+	// AuditLog records each sync's per-account outcomes, nil if disabled
+	AuditLog *audit.Log
+	// SyncSummary is replaced with the latest sync's summary after each run, nil if disabled
+	SyncSummary *audit.SummaryFile
+	// SyncGuard quarantines unusually large batches and failed transactions during sync, nil in read-only mode
+	SyncGuard *sync.Guard
+	// Settings contains configurable behavior, like the sync interval
+	Settings *settings.Store
+	// CORS allows other origins to call the API, the default only allows same-origin requests
+	CORS CORS
+	// SyncSchedule runs auto-sync at specific times instead of the settings' sync interval, if set
+	SyncSchedule SyncSchedule
+	// AccountInfoCacheTTL is how long account discovery responses are reused, 0 disables caching
+	AccountInfoCacheTTL time.Duration
+	// Changes applies changes spanning the account store, ledger, and rules atomically
+	Changes *changeset.Manager
+	// AccountsWatchInterval is how often to check the accounts files for changes made outside Sage, 0 disables watching
+	AccountsWatchInterval time.Duration
+	// MaxUploadSize limits file upload bodies in bytes, like OFX statements and CSV files. Defaults to DefaultMaxUploadSize if 0.
+	MaxUploadSize int64
 }
 
 // Run starts the server
@@ -41,6 +75,29 @@ func Run(
 	logger *zap.Logger,
 	options Options,
 ) error {
+	if err := options.CORS.Validate(); err != nil {
+		return err
+	}
+	maxUploadSize := options.MaxUploadSize
+	if maxUploadSize == 0 {
+		maxUploadSize = DefaultMaxUploadSize
+	}
+	var schedule *syncSchedule
+	if options.SyncSchedule.Enabled() {
+		var err error
+		schedule, err = options.SyncSchedule.parse()
+		if err != nil {
+			return err
+		}
+	}
+	var accountWatcher *client.AccountWatcher
+	if options.AccountsWatchInterval > 0 && !options.ReadOnly {
+		var err error
+		accountWatcher, err = client.NewAccountWatcher(db, accountStore)
+		if err != nil {
+			return err
+		}
+	}
 	engine := gin.New()
 	engine.Use(
 		ginzap.Ginzap(logger, time.RFC3339, true),
@@ -48,55 +105,66 @@ func Run(
 		func(c *gin.Context) {
 			c.Set(loggerKey, logger)
 		},
+		limitBody(maxJSONBodySize), // upload routes raise the limit
 	)
+	engine.Use(corsHandler(options.CORS, engine.Routes)) // runs before authentication, which preflights never include
 	engine.GET("/", func(c *gin.Context) { c.Redirect(http.StatusTemporaryRedirect, "/web") })
 
-	web := engine.Group("/web")
-	web.StaticFS("/", newDefaultRouteFS(
-		"/index.html",
-		AssetFile(),
-		"/static/",
-	))
+	setupWeb(engine.Group("/web"), webFS(options.WebDir))
 
 	engine.GET("/api/v1/getVersion", getVersion(http.DefaultClient, "api.github.com", "JohnStarich/sage", logger)) // add version route without auth
+	engine.GET("/api/v1/widget/:token", getWidget(db, ldgStore, accountStore, options.Settings))                   // share tokens replace auth for widgets
+	engine.GET("/api/v1/ready", getReady(options, accountWatcher))                                                 // readiness probes run without auth
 
-	api := engine.Group("/api/v1")
+	api := engine.Group(apiPrefix)
+	api.Use(requireScope(db, accountStore))
 	if len(options.Password) > 0 {
 		auth := newAuthenticator(options.Password)
 		engine.POST("/api/authz", signIn(auth))
 		api.Use(requireAuth(auth))
 	}
-	setupAPI(api, db, ldgStore, accountStore, rulesFile, rulesStore)
+	var reloadMu gosync.RWMutex
+	api.POST("/reloadAll", reloadAll(&reloadMu, db, ldgStore, accountStore, rulesFile, rulesStore, options.Settings))
+	prober := sync.NewProber()
+	setupAPI(api.Group("", blockDuringReload(&reloadMu)), db, ldgStore, accountStore, rulesFile, rulesStore, prober, options.AuditLog, options.SyncSummary, options.SyncGuard, options.Settings, newAccountInfoCache(options.AccountInfoCacheTTL), options.Changes, maxUploadSize)
 
 	done := make(chan bool, 1)
 	errs := make(chan error, 2)
 
-	logger.Info("Starting server", zap.String("addr", options.Address))
-	if !options.AutoSync {
+	logger.Info("Starting server", zap.String("addr", options.Address), zap.Bool("readOnly", options.ReadOnly))
+	if !options.ReadOnly {
+		go runKeepAlive(prober, ldgStore, accountStore, options.Settings, logger)
+	}
+	if accountWatcher != nil {
+		go runAccountsWatch(accountWatcher, prober, options.AccountsWatchInterval, logger)
+	}
+	if !options.AutoSync || options.ReadOnly {
 		return engine.Run(options.Address)
 	}
 
+	current, err := options.Settings.Settings()
+	if err != nil {
+		return err
+	}
 	go func() {
 		// give gin server time to start running. don't perform unnecessary requests if gin fails to boot
 		time.Sleep(2 * time.Second)
 		runSync := func() {
-			sync.Sync(ldgStore, accountStore, rulesStore, false)
+			sync.Sync(ldgStore, accountStore, rulesStore, options.AuditLog, options.SyncSummary, options.SyncGuard, false)
 		}
-		runSync()
-		ticker := time.NewTicker(syncInterval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-done:
-				return
-			case <-ticker.C:
-				_, _, err := ldgStore.SyncStatus()
-				if err == nil {
-					// only auto-sync if last sync succeeded
-					runSync()
-				}
+		autoSync := func() {
+			_, _, err := ldgStore.SyncStatus()
+			if !sync.IsFatal(err) {
+				// only auto-sync if last sync succeeded or partially failed
+				runSync()
 			}
 		}
+		runSync()
+		if schedule != nil {
+			runSyncSchedule(schedule, done, autoSync, logger)
+		} else {
+			runSyncInterval(options.Settings, time.Duration(current.SyncInterval), done, autoSync, logger)
+		}
 	}()
 
 	go func() {
@@ -116,6 +184,111 @@ func Run(
 	}
 }
 
+// runSyncInterval calls autoSync every settings' sync interval until 'done' receives, rescheduling when the interval changes
+func runSyncInterval(settingsStore *settings.Store, interval time.Duration, done <-chan bool, autoSync func(), logger *zap.Logger) {
+	intervals := make(chan time.Duration, 1)
+	settingsStore.OnChange(func(updated settings.Settings) {
+		// keep only the latest interval, the sync loop only needs the newest one
+		select {
+		case <-intervals:
+		default:
+		}
+		intervals <- time.Duration(updated.SyncInterval)
+	})
+
+	ticker := time.NewTicker(interval)
+	defer func() {
+		ticker.Stop()
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case newInterval := <-intervals:
+			if newInterval != interval {
+				interval = newInterval
+				ticker.Stop()
+				ticker = time.NewTicker(interval)
+				logger.Info("Rescheduled auto-sync", zap.Duration("interval", interval))
+			}
+		case <-ticker.C:
+			autoSync()
+		}
+	}
+}
+
+// runKeepAlive periodically probes institutions which are due for a keepalive, then checks those due for account discovery.
+// Skips a round while a sync is running, since the sync contacts the institution anyway.
+func runKeepAlive(prober *sync.Prober, ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store, logger *zap.Logger) {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if syncing, _, _ := ldgStore.SyncStatus(); syncing {
+			continue
+		}
+		if err := prober.ProbeDue(accountStore); err != nil {
+			logger.Error("Keepalive probes failed", zap.Error(err))
+		}
+		if err := prober.DiscoverDue(accountStore, logger, notifyDiscovery(settingsStore, logger)); err != nil {
+			logger.Error("Account discovery checks failed", zap.Error(err))
+		}
+	}
+}
+
+// runAccountsWatch hot-reloads the accounts files every 'interval' if they changed on disk.
+// Institutions whose credentials changed may be probed again, even if they rejected the previous credentials.
+func runAccountsWatch(watcher *client.AccountWatcher, prober *sync.Prober, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		reload, err := watcher.Check()
+		if err != nil {
+			logger.Error("Rejected changes to accounts files, keeping the previous accounts", zap.Error(err))
+			continue
+		}
+		if reload == nil {
+			continue
+		}
+		credentialsChanged := make([]string, 0, len(reload.CredentialsChanged))
+		for _, change := range reload.CredentialsChanged {
+			prober.ClearLockout(change.Before)
+			prober.ClearLockout(change.After)
+			credentialsChanged = append(credentialsChanged, change.Account)
+		}
+		// only log IDs, never account details or credentials
+		logger.Info("Reloaded accounts files",
+			zap.Strings("accounts", reload.Accounts),
+			zap.Strings("institutions", reload.Institutions),
+			zap.Strings("credentialsChanged", credentialsChanged),
+		)
+	}
+}
+
+// notifyDiscovery returns a func which logs account discovery differences and sends them to the settings' webhook
+func notifyDiscovery(settingsStore *settings.Store, logger *zap.Logger) func(sync.Discovery) {
+	return func(discovery sync.Discovery) {
+		discovery = discovery.Redacted()
+		logger.Warn("Institution reported new accounts or stopped reporting stored accounts",
+			zap.String("institution", discovery.Institution),
+			zap.Any("new", discovery.New),
+			zap.Any("missing", discovery.Missing),
+		)
+		currentSettings, err := settingsStore.Settings()
+		if err != nil {
+			logger.Error("Failed to read webhook settings", zap.Error(err))
+			return
+		}
+		err = currentSettings.Webhook.Notify(http.DefaultClient, settings.WebhookEvent{
+			Event: sync.DiscoveryEvent,
+			Time:  discovery.Time,
+			Data:  discovery,
+		})
+		if err != nil {
+			logger.Error("Failed to notify webhook about account discovery", zap.Error(err))
+		}
+	}
+}
+
 func setupAPI(
 	router gin.IRouter,
 	db plaindb.DB,
@@ -123,45 +296,159 @@ func setupAPI(
 	accountStore *client.AccountStore,
 	rulesFile vcs.File,
 	rulesStore *rules.Store,
+	prober *sync.Prober,
+	auditLog *audit.Log,
+	summaryFile *audit.SummaryFile,
+	guard *sync.Guard,
+	settingsStore *settings.Store,
+	accountCache *accountInfoCache,
+	changes *changeset.Manager,
+	maxUploadSize int64,
 ) {
-	router.GET("/getLedgerSyncStatus", getLedgerSyncStatus(ldgStore))
+	router.GET("/getLedgerSyncStatus", getLedgerSyncStatus(ldgStore, prober))
+	router.GET("/dashboard", getDashboard(ldgStore, accountStore, settingsStore, prober))
+	router.GET("/getHouseholdDashboard", getHouseholdDashboard(ldgStore, accountStore, settingsStore, newHouseholdPeer()))
 	router.POST("/submitSyncPrompt", submitSyncPrompt(ldgStore))
-	router.POST("/syncLedger", syncLedger(ldgStore, accountStore, rulesStore))
-	router.POST("/importOFX", importOFXFile(ldgStore, accountStore, rulesStore))
-	router.POST("/renameLedgerAccount", renameLedgerAccount(ldgStore))
+	router.POST("/syncLedger", syncLedger(ldgStore, accountStore, rulesStore, auditLog, summaryFile, guard))
+	router.GET("/getLastSyncSummary", getLastSyncSummary(summaryFile))
+	router.GET("/auditLog", getAuditLog(auditLog))
+	router.GET("/getQuarantinedBatches", getQuarantinedBatches(guard))
+	router.POST("/getQuarantinedBatches/approve", approveQuarantinedBatch(guard, ldgStore, rulesStore))
+	router.POST("/getQuarantinedBatches/discard", discardQuarantinedBatch(guard))
+	router.GET("/quarantine", getQuarantinedTransactions(guard))
+	router.POST("/releaseQuarantined", releaseQuarantined(guard, ldgStore, rulesStore))
+	router.POST("/discardQuarantined", discardQuarantined(guard))
+	router.POST("/finalSync", finalSync(ldgStore, accountStore, rulesStore))
+	router.POST("/resetSyncState", resetSyncState(ldgStore, accountStore))
+	router.POST("/closeAccount", closeAccount(db, changes, ldgStore, accountStore))
+	router.POST("/reopenAccount", reopenAccount(db, accountStore))
+	router.POST("/importOFX", limitBody(maxUploadSize), importOFXFile(ldgStore, accountStore, rulesStore, guard))
+	router.POST("/importDirectory", importDirectory(ldgStore, accountStore, rulesStore, guard))
+	downloads := newDownloadSnapshots(downloadSnapshotTTL, maxDownloadSnapshots)
+	router.GET("/exportQFX", exportQFX(ldgStore, accountStore, downloads))
+	router.HEAD("/exportQFX", exportQFX(ldgStore, accountStore, downloads))
+	router.GET("/ledgerFile", getLedgerFile(ldgStore, downloads))
+	router.HEAD("/ledgerFile", getLedgerFile(ldgStore, downloads))
+	router.POST("/accounts/:id/uploadStatement", limitBody(maxUploadSize), uploadStatement(ldgStore, accountStore, rulesStore, auditLog, summaryFile, guard))
+	router.POST("/renameLedgerAccount", renameLedgerAccount(ldgStore, settingsStore))
+	router.POST("/renameCategory", renameCategory(changes, ldgStore, rulesStore, settingsStore))
 	router.GET("/renameSuggestions", renameSuggestions(accountStore))
+	router.GET("/validateLedger", validateLedger(ldgStore, settingsStore))
+	router.GET("/fsck", checkIntegrity(ldgStore))
+	router.POST("/fsck/heal", healIntegrity(ldgStore))
+	router.POST("/ledger/dedupe", dedupeLedger(db, ldgStore))
 
-	router.GET("/getBalances", getBalances(ldgStore, accountStore))
+	router.GET("/getBalances", getBalances(db, ldgStore, accountStore, settingsStore))
+	router.GET("/netWorth", getNetWorth(db, ldgStore, accountStore, settingsStore))
 	router.POST("/updateOpeningBalance", updateOpeningBalance(ldgStore, accountStore))
+	router.POST("/recordBalance", recordBalance(ldgStore, accountStore))
+	router.POST("/adjustCashBalance", adjustCashBalance(ldgStore, settingsStore))
+	router.POST("/recordCashSpending", recordCashSpending(ldgStore, settingsStore))
+	router.POST("/refreshBalance", refreshBalance(db, ldgStore, accountStore))
 	router.GET("/getCategories", getExpenseAndRevenueAccounts(ldgStore, rulesStore))
+	router.GET("/getCategoryTotals", getCategoryTotals(ldgStore, settingsStore))
+	router.GET("/spendingBreakdown", getSpendingBreakdown(ldgStore, settingsStore))
 
-	router.GET("/getAccounts", getAccounts(accountStore))
+	router.GET("/getAccounts", getAccounts(accountStore, ldgStore, settingsStore))
+	router.GET("/staleAccounts", getStaleAccounts(accountStore))
 	router.GET("/getAccount", getAccount(accountStore))
-	router.POST("/updateAccount", updateAccount(accountStore, ldgStore))
-	router.POST("/addAccount", addAccount(accountStore))
+	router.POST("/updateAccount", updateAccount(changes, accountStore, ldgStore, prober))
+	router.POST("/addAccount", addAccount(accountStore, prober))
+	router.POST("/addAccountVerified", addAccountVerified(accountStore))
 	router.GET("/deleteAccount", removeAccount(accountStore))
 
+	router.GET("/institutions", getInstitutions(accountStore))
+	router.POST("/institutions", updateInstitution(accountStore))
+	router.DELETE("/institutions", removeInstitution(accountStore))
+
 	router.GET("/web/getDriverNames", getWebConnectDrivers())
 
 	router.GET("/direct/getDrivers", getDirectConnectDrivers())
 	router.POST("/direct/verifyAccount", verifyAccount(accountStore))
-	router.POST("/direct/fetchAccounts", fetchDirectConnectAccounts())
+	router.POST("/direct/verifyConnector", verifyDirectConnector())
+	router.POST("/direct/transfer", transferFunds(accountStore))
+	router.POST("/direct/fetchAccounts", fetchDirectConnectAccounts(accountCache))
+	router.POST("/direct/fetchAccounts/clearCache", clearAccountInfoCache(accountCache))
+	router.POST("/direct/diagnose", diagnoseDirectConnector())
+	router.GET("/direct/statement", getDirectStatement(accountStore))
+	router.POST("/direct/probeNow", probeNow(prober, accountStore))
+	router.POST("/direct/discoverAccounts", discoverAccounts(prober, accountStore))
+	router.POST("/direct/fetchAllAccounts", fetchAllAccounts(prober, accountStore))
+	router.POST("/adoptDiscoveredAccount", adoptDiscoveredAccount(prober, accountStore))
+	router.GET("/direct/clientRegistration", getClientRegistration(prober, accountStore))
+	router.POST("/direct/clientRegistration/regenerate", regenerateClientID(accountStore))
+	router.POST("/direct/clientRegistration/set", setClientID(accountStore))
+
+	router.GET("/getTransactions", getTransactions(ldgStore, accountStore, settingsStore))
+	router.GET("/register", getRegister(ldgStore))
+	router.GET("/getTransaction", getTransaction(ldgStore))
+
+	router.GET("/snapshots", getSnapshots(ldgStore))
+	router.GET("/asOfSnapshot/:snapshotID/getBalances", getSnapshotBalances(db, ldgStore, accountStore, settingsStore))
+	router.GET("/asOfSnapshot/:snapshotID/getTransactions", getSnapshotTransactions(ldgStore, accountStore, settingsStore))
 
-	router.GET("/getTransactions", getTransactions(ldgStore, accountStore))
 	router.POST("/updateTransaction", updateTransaction(ldgStore))
 	router.POST("/updateTransactions", updateTransactions(ldgStore))
+	router.POST("/deleteTransaction", deleteTransaction(db, ldgStore))
+	router.GET("/tombstones", getTombstones(db))
+	router.POST("/tombstones/clear", clearTombstones(db))
+	router.POST("/setNote", setNote(ldgStore))
 	router.POST("/reimportTransactions", reimportTransactions(ldgStore, rulesStore))
+	router.GET("/exportUncategorized", exportUncategorized(ldgStore, accountStore, settingsStore))
+	router.POST("/importCategorizations", limitBody(maxUploadSize), importCategorizations(ldgStore, settingsStore))
+	router.POST("/archiveBefore", archiveBefore(ldgStore))
+	router.POST("/markShared", markShared(ldgStore))
+	router.POST("/markTransfer", markTransfer(ldgStore))
+	router.GET("/getReimbursables", getReimbursables(ldgStore))
+	router.POST("/settleReimbursable", settleReimbursable(ldgStore))
+	router.GET("/recurring", getRecurring(ldgStore))
+	router.GET("/forecast", getForecast(ldgStore))
+	router.POST("/simulateExpense", simulateExpense(db, ldgStore, settingsStore))
+	router.POST("/reconcile/start", startReconcile(db, ldgStore))
+	router.POST("/reconcile/toggle", toggleReconcile(db, ldgStore))
+	router.POST("/reconcile/commit", commitReconcile(db, ldgStore))
 
 	router.GET("/getRules", getRules(rulesStore, ldgStore))
 	router.GET("/getRule", getRule(rulesStore))
-	router.POST("/updateRules", updateRules(rulesFile, rulesStore))
-	router.POST("/updateRule", updateRule(rulesFile, rulesStore))
-	router.POST("/addRule", addRule(rulesFile, rulesStore))
-	router.POST("/deleteRule", deleteRule(rulesFile, rulesStore))
+	router.POST("/updateRules", updateRules(db, settingsStore, rulesFile, rulesStore))
+	router.POST("/updateRule", updateRule(db, settingsStore, rulesFile, rulesStore))
+	router.POST("/addRule", addRule(db, settingsStore, rulesFile, rulesStore))
+	router.POST("/deleteRule", deleteRule(db, settingsStore, rulesFile, rulesStore))
+	router.POST("/previewApplyRules", previewApplyRules(rulesStore, ldgStore))
+	router.POST("/rules/evaluate", evaluateRules())
+	router.GET("/rules/explainTransaction", explainTransaction(ldgStore, rulesStore))
 
-	router.GET("/getBudgets", getBudgets(db, ldgStore))
-	router.GET("/getBudget", getBudget(db, ldgStore))
+	router.GET("/getBudgets", getBudgets(db, ldgStore, settingsStore))
+	router.GET("/getBudget", getBudget(db, ldgStore, settingsStore))
 	router.POST("/updateBudget", updateBudget(db))
 	router.GET("/deleteBudget", deleteBudget(db))
-	router.GET("/getEverythingElseBudget", getEverythingElseBudgetDetails(db, ldgStore))
+
+	envelopeStore, err := envelope.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	router.GET("/getEnvelopes", getEnvelopes(envelopeStore, ldgStore))
+	router.POST("/addEnvelope", addEnvelope(envelopeStore, ldgStore))
+	router.POST("/fundEnvelope", fundEnvelope(envelopeStore, ldgStore))
+	router.POST("/moveEnvelopeMoney", moveEnvelopeMoney(envelopeStore))
+	router.POST("/spendFromEnvelope", spendFromEnvelope(envelopeStore, ldgStore))
+	router.POST("/deleteEnvelope", deleteEnvelope(envelopeStore))
+
+	router.GET("/settings", getSettings(settingsStore))
+	router.POST("/settings", updateSettings(settingsStore))
+	router.GET("/getReportSettings", getReportSettings(settingsStore))
+	router.POST("/updateReportSettings", updateReportSettings(settingsStore))
+
+	router.GET("/getFXRates", getFXRates(db))
+	router.POST("/updateFXRate", updateFXRate(db))
+	router.POST("/importFXRates", limitBody(maxUploadSize), importFXRates(db))
+	router.GET("/getEverythingElseBudget", getEverythingElseBudgetDetails(db, ldgStore, settingsStore))
+
+	router.GET("/shareTokens", getShareTokens(db))
+	router.POST("/shareTokens", addShareToken(db, ldgStore))
+	router.DELETE("/shareTokens/:id", deleteShareToken(db))
+
+	router.GET("/apiKeys", getAPIKeys(db))
+	router.POST("/apiKeys", addAPIKey(db, accountStore))
+	router.DELETE("/apiKeys/:id", deleteAPIKey(db))
 }
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/settings"
+	"go.uber.org/zap"
+)
+
+func getSettings(settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current, err := settingsStore.Settings()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, current)
+	}
+}
+
+func updateSettings(settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var update settings.Update
+		if err := c.ShouldBindJSON(&update); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		updated, err := settingsStore.Update(update)
+		if err != nil {
+			abortWithSettingsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// abortWithSettingsError aborts with a 400 detailing each invalid field, or a 500 for other errors
+func abortWithSettingsError(c *gin.Context, err error) {
+	fieldErrs, ok := err.(settings.FieldErrors)
+	if !ok {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return
+	}
+	logger := c.MustGet(loggerKey).(*zap.Logger)
+	logger.Info("Aborting with invalid settings", zap.String("error", err.Error()))
+	c.AbortWithStatusJSON(http.StatusBadRequest, map[string]interface{}{
+		"Error":  err.Error(),
+		"Fields": fieldErrs,
+	})
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/budget"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/settings"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const maxSimulatedScenarios = 10
+
+type simulationScenario struct {
+	Name     string
+	Expenses []ledger.HypotheticalExpense
+}
+
+// simulatedBudget compares a budget's balance with and without a scenario's hypothetical expenses
+type simulatedBudget struct {
+	Month   string
+	Account string
+	Budget  decimal.Decimal
+	Before  decimal.Decimal
+	After   decimal.Decimal
+}
+
+// simulatedForecastDay is a day of a scenario's forecast, with each account's balance change caused by the hypothetical expenses
+type simulatedForecastDay struct {
+	Date     time.Time
+	Balances map[string]decimal.Decimal
+	Delta    map[string]decimal.Decimal `json:",omitempty"`
+	Entries  []ledger.ForecastEntry     `json:",omitempty"`
+}
+
+type simulationResult struct {
+	Name string
+	// Simulated is always true, all results are hypothetical and never written to the ledger
+	Simulated    bool
+	Transactions []ledger.Transaction
+	Budgets      []simulatedBudget
+	Forecast     []simulatedForecastDay
+}
+
+// simulateExpense runs the budget and forecast computations with each scenario's hypothetical recurring expenses added to an in-memory copy of the ledger
+func simulateExpense(db plaindb.DB, ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
+	store, err := budget.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		var body struct {
+			Days      int
+			Scenarios []simulationScenario
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if body.Days == 0 {
+			body.Days = defaultForecastDays
+		}
+		if body.Days < 1 || body.Days > maxForecastDays {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Days must be a positive integer no more than %d", maxForecastDays))
+			return
+		}
+		if len(body.Scenarios) == 0 || len(body.Scenarios) > maxSimulatedScenarios {
+			abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Provide between 1 and %d scenarios", maxSimulatedScenarios))
+			return
+		}
+		for i, scenario := range body.Scenarios {
+			if scenario.Name == "" {
+				body.Scenarios[i].Name = fmt.Sprintf("Scenario %d", i+1)
+			}
+			if len(scenario.Expenses) == 0 {
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Scenario %q must have at least one expense", body.Scenarios[i].Name))
+				return
+			}
+			for _, expense := range scenario.Expenses {
+				if err := expense.Validate(); err != nil {
+					abortWithClientError(c, http.StatusBadRequest, errors.Wrapf(err, "Invalid expense in scenario %q", body.Scenarios[i].Name))
+					return
+				}
+			}
+		}
+		dateBasis, ok := queryDateBasis(c, settingsStore)
+		if !ok {
+			return
+		}
+		ldg, ok := queryReportLedger(c, ldgStore.Ledger)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		start := startOfMonth(now)
+		end := now.AddDate(0, 0, body.Days)
+		var allMonthlyBudgets []budget.Accounts
+		for current := start; current.Before(end); current = current.AddDate(0, 1, 0) {
+			month, err := store.Month(current.Year(), current.Month())
+			if err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+				return
+			}
+			allMonthlyBudgets = append(allMonthlyBudgets, month)
+		}
+		before, err := calculateBudgetBalances(allMonthlyBudgets, ldg, start, end, dateBasis)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		forecastBefore := ldgStore.Forecast(now, body.Days, nil)
+
+		results := make([]simulationResult, 0, len(body.Scenarios))
+		for _, scenario := range body.Scenarios {
+			var txns []ledger.Transaction
+			for _, expense := range scenario.Expenses {
+				txns = append(txns, expense.Transactions(end)...)
+			}
+			after, err := calculateBudgetBalances(allMonthlyBudgets, ldg.Simulated(txns), start, end, dateBasis)
+			if err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+				return
+			}
+			forecastAfter := ldgStore.Simulated(txns).Forecast(now, body.Days, nil)
+			results = append(results, simulationResult{
+				Name:         scenario.Name,
+				Simulated:    true,
+				Transactions: txns,
+				Budgets:      compareBudgets(start, before, after),
+				Forecast:     compareForecasts(forecastBefore, forecastAfter),
+			})
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Simulated": true,
+			"Start":     start.UTC().Format(time.RFC3339),
+			"End":       end.UTC().Format(time.RFC3339),
+			"Scenarios": results,
+		})
+	}
+}
+
+// compareBudgets returns the budgets with different balances in 'before' and 'after', which must be calculated from the same monthly budgets
+func compareBudgets(start time.Time, before, after [][]monthlyBudget) []simulatedBudget {
+	var affected []simulatedBudget
+	for monthOffset := range after {
+		beforeBalances := make(map[string]decimal.Decimal, len(before[monthOffset]))
+		for _, b := range before[monthOffset] {
+			beforeBalances[b.Account] = b.Balance
+		}
+		month := addMonths(start, monthOffset).Format("2006-01")
+		for _, b := range after[monthOffset] {
+			if beforeBalance := beforeBalances[b.Account]; !beforeBalance.Equal(b.Balance) {
+				affected = append(affected, simulatedBudget{
+					Month:   month,
+					Account: b.Account,
+					Budget:  b.Budget,
+					Before:  beforeBalance,
+					After:   b.Balance,
+				})
+			}
+		}
+	}
+	return affected
+}
+
+// compareForecasts returns 'after' with each account's balance change from 'before' and only the simulated entries. Both forecasts must cover the same days.
+func compareForecasts(before, after []ledger.ForecastDay) []simulatedForecastDay {
+	days := make([]simulatedForecastDay, 0, len(after))
+	for i, day := range after {
+		simulatedDay := simulatedForecastDay{
+			Date:     day.Date,
+			Balances: day.Balances,
+		}
+		for account, balance := range day.Balances {
+			if delta := balance.Sub(before[i].Balances[account]); !delta.IsZero() {
+				if simulatedDay.Delta == nil {
+					simulatedDay.Delta = make(map[string]decimal.Decimal)
+				}
+				simulatedDay.Delta[account] = delta
+			}
+		}
+		for _, entry := range day.Entries {
+			if entry.Source == ledger.ForecastSimulated {
+				simulatedDay.Entries = append(simulatedDay.Entries, entry)
+			}
+		}
+		days = append(days, simulatedDay)
+	}
+	return days
+}
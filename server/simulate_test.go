@@ -0,0 +1,64 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareBudgets(t *testing.T) {
+	start := time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+	before := [][]monthlyBudget{
+		{
+			{Account: "expenses:fitness", Budget: decimal.NewFromFloat(50)},
+			{Account: "expenses:food", Budget: decimal.NewFromFloat(200), Balance: decimal.NewFromFloat(120)},
+		},
+		{
+			{Account: "expenses:fitness", Budget: decimal.NewFromFloat(50)},
+		},
+	}
+	after := [][]monthlyBudget{
+		{
+			{Account: "expenses:fitness", Budget: decimal.NewFromFloat(50), Balance: decimal.NewFromFloat(40)},
+			{Account: "expenses:food", Budget: decimal.NewFromFloat(200), Balance: decimal.NewFromFloat(120)},
+		},
+		{
+			{Account: "expenses:fitness", Budget: decimal.NewFromFloat(50), Balance: decimal.NewFromFloat(80)},
+		},
+	}
+	affected := compareBudgets(start, before, after)
+	require.Len(t, affected, 2)
+	assert.Equal(t, "2020-04", affected[0].Month)
+	assert.Equal(t, "expenses:fitness", affected[0].Account)
+	assert.Equal(t, "40", affected[0].After.String())
+	assert.Equal(t, "2020-05", affected[1].Month)
+	assert.Equal(t, "0", affected[1].Before.String())
+	assert.Equal(t, "80", affected[1].After.String())
+}
+
+func TestCompareForecasts(t *testing.T) {
+	const account = "assets:bank"
+	date := time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+	before := []ledger.ForecastDay{{
+		Date:     date,
+		Balances: map[string]decimal.Decimal{account: decimal.NewFromFloat(100)},
+		Entries:  []ledger.ForecastEntry{{Account: account, Source: ledger.ForecastScheduled}},
+	}}
+	after := []ledger.ForecastDay{{
+		Date:     date,
+		Balances: map[string]decimal.Decimal{account: decimal.NewFromFloat(60)},
+		Entries: []ledger.ForecastEntry{
+			{Account: account, Source: ledger.ForecastScheduled},
+			{Account: account, Amount: decimal.NewFromFloat(-40), Source: ledger.ForecastSimulated},
+		},
+	}}
+	days := compareForecasts(before, after)
+	require.Len(t, days, 1)
+	assert.Equal(t, "-40", days[0].Delta[account].String())
+	require.Len(t, days[0].Entries, 1)
+	assert.Equal(t, ledger.ForecastSimulated, days[0].Entries[0].Source)
+}
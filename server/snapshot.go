@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/fx"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/settings"
+	"go.uber.org/zap"
+)
+
+// historicalResponse marks a response as computed from a past ledger snapshot, rather than the live ledger
+type historicalResponse struct {
+	Historical   bool
+	SnapshotID   string
+	SnapshotTime time.Time
+}
+
+func newHistoricalResponse(snapshot *ledger.Snapshot) historicalResponse {
+	return historicalResponse{
+		Historical:   true,
+		SnapshotID:   snapshot.ID,
+		SnapshotTime: snapshot.Time,
+	}
+}
+
+// loadSnapshot loads the snapshot named in the URL. Aborts c and returns false on failure.
+func loadSnapshot(c *gin.Context, ldgStore *ledger.Store) (*ledger.Snapshot, bool) {
+	snapshot, err := ldgStore.Snapshot(c.Param("snapshotID"))
+	if err == nil {
+		return snapshot, true
+	}
+	if err != ledger.ErrSnapshotNotFound {
+		abortWithClientError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	versions, versionsErr := ldgStore.Snapshots()
+	if versionsErr != nil {
+		abortWithClientError(c, http.StatusInternalServerError, versionsErr)
+		return nil, false
+	}
+	snapshotIDs := make([]string, 0, len(versions))
+	for _, version := range versions {
+		snapshotIDs = append(snapshotIDs, version.ID)
+	}
+	logger := c.MustGet(loggerKey).(*zap.Logger)
+	logger.Info("Aborting with client error", zap.String("error", err.Error()))
+	c.AbortWithStatusJSON(http.StatusNotFound, map[string]interface{}{
+		"Error":     err.Error(),
+		"Snapshots": snapshotIDs,
+	})
+	return nil, false
+}
+
+func getSnapshotBalances(db plaindb.DB, ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store) gin.HandlerFunc {
+	fxStore, err := fx.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		snapshot, ok := loadSnapshot(c, ldgStore)
+		if !ok {
+			return
+		}
+		resp, ok := queryBalances(c, snapshot.Ledger, accountStore, fxStore, settingsStore)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, struct {
+			historicalResponse
+			BalanceResponse
+		}{newHistoricalResponse(snapshot), resp})
+	}
+}
+
+func getSnapshotTransactions(ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshot, ok := loadSnapshot(c, ldgStore)
+		if !ok {
+			return
+		}
+		result, ok := queryTransactions(c, snapshot.Ledger, accountStore, settingsStore)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, struct {
+			historicalResponse
+			transactionsResponse
+		}{newHistoricalResponse(snapshot), result})
+	}
+}
+
+func getSnapshots(ldgStore *ledger.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		versions, err := ldgStore.Snapshots()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Snapshots": versions,
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/settings"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// spendingCategory is a top-level expense category's share of total spending
+type spendingCategory struct {
+	// Category is the top-level category account, like "expenses:food"
+	Category string
+	Amount   decimal.Decimal
+	// Percent is Amount's share of the total, from 0 to 100 and rounded to 2 decimal places
+	Percent decimal.Decimal
+}
+
+type spendingBreakdownResponse struct {
+	Start    string
+	End      string
+	Currency model.CurrencyFormat
+	Total    decimal.Decimal
+	// Categories are sorted by amount, largest first
+	Categories []spendingCategory
+}
+
+// getSpendingBreakdown responds with total spending between the 'start' and 'end' queries, grouped by top-level expense category.
+// Defaults to the start of the month through today. Transfers are excluded.
+func getSpendingBreakdown(ldgStore *ledger.Store, settingsStore *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start, end, err := getStartEndTimes(c.Query("start"), c.Query("end"), startOfMonth)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if end.Before(start) {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("End must not be before start"))
+			return
+		}
+		dateBasis, ok := queryDateBasis(c, settingsStore)
+		if !ok {
+			return
+		}
+		ldg, ok := queryReportLedger(c, ldgStore.Ledger)
+		if !ok {
+			return
+		}
+		total, categories := spendingBreakdown(ldg, start, end, dateBasis)
+		c.JSON(http.StatusOK, spendingBreakdownResponse{
+			Start:      start.UTC().Format(time.RFC3339),
+			End:        end.UTC().Format(time.RFC3339),
+			Currency:   homeCurrency(settingsStore),
+			Total:      total,
+			Categories: categories,
+		})
+	}
+}
+
+// spendingBreakdown sums expense postings between start and end by top-level category.
+// Categories with net refunds are left out, so every share is positive and the shares add up to 100.
+func spendingBreakdown(ldg *ledger.Ledger, start, end time.Time, dateBasis ledger.DateBasis) (decimal.Decimal, []spendingCategory) {
+	amounts := make(map[string]decimal.Decimal)
+	for account, balance := range ldg.LeftOverAccountBalancesBy(start, end, dateBasis, model.AssetAccount, model.LiabilityAccount) {
+		if account != model.Uncategorized && ldg.AccountType(account) != ledger.ExpenseType {
+			continue
+		}
+		category := topLevelCategory(account)
+		amounts[category] = amounts[category].Add(balance)
+	}
+
+	var total decimal.Decimal
+	categories := make([]spendingCategory, 0, len(amounts))
+	for category, amount := range amounts {
+		if amount.IsPositive() {
+			total = total.Add(amount)
+			categories = append(categories, spendingCategory{Category: category, Amount: amount})
+		}
+	}
+	for i := range categories {
+		categories[i].Percent = categories[i].Amount.Div(total).Mul(decimal.New(100, 0)).Round(2)
+	}
+	sort.Slice(categories, func(a, b int) bool {
+		if !categories[a].Amount.Equal(categories[b].Amount) {
+			return categories[a].Amount.GreaterThan(categories[b].Amount)
+		}
+		return categories[a].Category < categories[b].Category
+	})
+	return total, categories
+}
+
+// topLevelCategory returns the first category segment of 'account', like "expenses:food" for "expenses:food:groceries"
+func topLevelCategory(account string) string {
+	components := strings.SplitN(account, ":", 3)
+	if len(components) < 2 {
+		return account
+	}
+	return components[0] + ":" + components[1]
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpendingBreakdown(t *testing.T) {
+	ldg, err := ledger.NewFromReader(strings.NewReader(`
+account expenses:transfers  ; transfer: true
+
+2019/04/30 Last month
+	assets:bank   $-5
+	expenses:food
+
+2019/05/02 Groceries
+	assets:bank   $-10
+	expenses:food:groceries
+
+2019/05/03 Restaurant
+	assets:bank   $-20
+	expenses:food:restaurants
+
+2019/05/04 Movie
+	assets:bank   $-10
+	expenses:entertainment
+
+2019/05/05 Refund
+	assets:bank   $15
+	expenses:shopping
+
+2019/05/06 Paycheck
+	assets:bank   $100
+	revenues:salary
+
+2019/05/07 Savings
+	assets:bank   $-500
+	expenses:transfers
+
+2019/05/08 Unknown
+	assets:bank   $-5
+	uncategorized
+`))
+	require.NoError(t, err)
+
+	start := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 5, 31, 0, 0, 0, 0, time.UTC)
+	total, categories := spendingBreakdown(ldg, start, end, ledger.PostingBasis)
+	assert.Equal(t, "45", total.String())
+	type category struct{ Category, Amount, Percent string }
+	var results []category
+	for _, c := range categories {
+		results = append(results, category{c.Category, c.Amount.String(), c.Percent.String()})
+	}
+	assert.Equal(t, []category{
+		{"expenses:food", "30", "66.67"},
+		{"expenses:entertainment", "10", "22.22"},
+		{"uncategorized", "5", "11.11"},
+	}, results, "Transfers and net refunds should be left out")
+}
+
+func TestTopLevelCategory(t *testing.T) {
+	assert.Equal(t, "expenses:food", topLevelCategory("expenses:food:groceries"))
+	assert.Equal(t, "expenses:food", topLevelCategory("expenses:food"))
+	assert.Equal(t, "uncategorized", topLevelCategory("uncategorized"))
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/pkg/errors"
+)
+
+const defaultStaleAge = 7 * 24 * time.Hour
+
+// staleAccount is an account which hasn't synced successfully within the requested age
+type staleAccount struct {
+	ID          string
+	Description string
+	// LastSyncSuccess is when the account last synced without errors. Nil if it never has.
+	LastSyncSuccess *time.Time `json:",omitempty"`
+	NeverSynced     bool
+	Archived        bool `json:",omitempty"`
+	Closed          bool `json:",omitempty"`
+}
+
+// parseAge parses a positive duration, also accepting whole days like "7d"
+func parseAge(age string) (time.Duration, error) {
+	var duration time.Duration
+	var err error
+	if days := strings.TrimSuffix(age, "d"); days != age {
+		var count int
+		count, err = strconv.Atoi(days)
+		duration = time.Duration(count) * 24 * time.Hour
+	} else {
+		duration, err = time.ParseDuration(age)
+	}
+	if err != nil || duration <= 0 {
+		return 0, errors.Errorf("Invalid age, must be a positive duration like 7d or 36h: %q", age)
+	}
+	return duration, nil
+}
+
+// findStaleAccounts returns accounts which haven't synced successfully since 'olderThan' before 'now', least recently synced first.
+// Manual accounts are skipped, as are archived and closed accounts unless 'includeInactive' is true.
+func findStaleAccounts(accountStore *client.AccountStore, olderThan time.Duration, includeInactive bool, now time.Time) ([]staleAccount, error) {
+	cutoff := now.Add(-olderThan)
+	stale := []staleAccount{}
+	var account model.Account
+	err := accountStore.Iter(&account, func(id string) bool {
+		if model.IsManual(account) {
+			// manual accounts, like a cash wallet, never sync
+			return true
+		}
+		archived, closed := model.IsArchived(account), model.ClosedDate(account) != nil
+		if !includeInactive && (archived || closed) {
+			return true
+		}
+		lastSuccess := model.LastSyncSuccess(account)
+		if lastSuccess != nil && lastSuccess.After(cutoff) {
+			return true
+		}
+		stale = append(stale, staleAccount{
+			ID:              id,
+			Description:     model.DisplayName(account),
+			LastSyncSuccess: lastSuccess,
+			NeverSynced:     lastSuccess == nil,
+			Archived:        archived,
+			Closed:          closed,
+		})
+		return true
+	})
+	sort.Slice(stale, func(a, b int) bool {
+		lastA, lastB := stale[a].LastSyncSuccess, stale[b].LastSyncSuccess
+		switch {
+		case lastA == nil && lastB == nil:
+			return stale[a].ID < stale[b].ID
+		case lastA == nil || lastB == nil:
+			return lastA == nil
+		case !lastA.Equal(*lastB):
+			return lastA.Before(*lastB)
+		default:
+			return stale[a].ID < stale[b].ID
+		}
+	})
+	return stale, err
+}
+
+// getStaleAccounts lists accounts which haven't synced successfully within the 'olderThan' query, defaulting to 7 days
+func getStaleAccounts(accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var options struct {
+			OlderThan       string `form:"olderThan"`
+			IncludeInactive bool   `form:"includeInactive"`
+		}
+		if err := c.BindQuery(&options); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		olderThan := defaultStaleAge
+		if options.OlderThan != "" {
+			var err error
+			olderThan, err = parseAge(options.OlderThan)
+			if err != nil {
+				abortWithClientError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		accounts, err := findStaleAccounts(accountStore, olderThan, options.IncludeInactive, time.Now())
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"OlderThan": olderThan.String(),
+			"Accounts":  accounts,
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAge(t *testing.T) {
+	age, err := parseAge("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, age)
+	age, err = parseAge("36h")
+	require.NoError(t, err)
+	assert.Equal(t, 36*time.Hour, age)
+	for _, invalid := range []string{"0d", "-1d", "d", "soon"} {
+		_, err := parseAge(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFindStaleAccounts(t *testing.T) {
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	now := time.Date(2019, 5, 20, 0, 0, 0, 0, time.UTC)
+	recent := now.AddDate(0, 0, -1)
+	old := now.AddDate(0, 0, -30)
+	older := now.AddDate(0, 0, -60)
+	for _, account := range []*model.BasicAccount{
+		{AccountID: "recent", AccountDescription: "recent", LastSyncSuccess: &recent},
+		{AccountID: "old", AccountDescription: "old", LastSyncSuccess: &old},
+		{AccountID: "older", AccountDescription: "older", LastSyncSuccess: &older},
+		{AccountID: "never", AccountDescription: "never"},
+		{AccountID: "archived", AccountDescription: "archived", Archived: true},
+		{AccountID: "closed", AccountDescription: "closed", LastSyncSuccess: &older, Closed: &old},
+	} {
+		require.NoError(t, accountStore.Add(account))
+	}
+	require.NoError(t, accountStore.Add(model.NewManualAccount("wallet", "wallet", model.AssetAccount, "cash")))
+
+	stale, err := findStaleAccounts(accountStore, 7*24*time.Hour, false, now)
+	require.NoError(t, err)
+	assert.Equal(t, []staleAccount{
+		{ID: "never", Description: "never", NeverSynced: true},
+		{ID: "older", Description: "older", LastSyncSuccess: &older},
+		{ID: "old", Description: "old", LastSyncSuccess: &old},
+	}, stale)
+
+	stale, err = findStaleAccounts(accountStore, 90*24*time.Hour, true, now)
+	require.NoError(t, err)
+	assert.Equal(t, []staleAccount{
+		{ID: "archived", Description: "archived", NeverSynced: true, Archived: true},
+		{ID: "never", Description: "never", NeverSynced: true},
+	}, stale)
+}
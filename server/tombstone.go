@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/tombstone"
+	"github.com/pkg/errors"
+)
+
+func newTombstoneStore(db plaindb.DB) *tombstone.Store {
+	store, err := tombstone.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+// deleteTransaction removes a transaction from the ledger and records a tombstone, so future syncs don't import it again
+func deleteTransaction(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+	store := newTombstoneStore(db)
+	return func(c *gin.Context) {
+		id := c.Query("id")
+		txn, found := ldgStore.Transaction(id)
+		if !found {
+			abortWithClientError(c, http.StatusNotFound, errors.New("Transaction not found by ID: "+id))
+			return
+		}
+		if ledger.IsBalanceAssertion(txn) || len(txn.Postings) == 0 || txn.Postings[0].ID() == "" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Only imported transactions can be deleted: "+id))
+			return
+		}
+		// record the tombstone first, so a failed delete can't be re-imported either
+		if err := store.Add(txn.Postings[0].Account, txn.Postings[0].ID(), time.Now()); err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		deleted, err := ldgStore.RemoveTransaction(id)
+		if err != nil {
+			abortWithLedgerError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Deleted": deleted,
+		})
+	}
+}
+
+// getTombstones returns the deleted transaction IDs for 'account', or for every account if not set
+func getTombstones(db plaindb.DB) gin.HandlerFunc {
+	store := newTombstoneStore(db)
+	return func(c *gin.Context) {
+		if account := c.Query("account"); account != "" {
+			tombstones, err := store.Account(account)
+			if err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+				return
+			}
+			c.JSON(http.StatusOK, map[string]interface{}{
+				"Tombstones": map[string][]tombstone.Tombstone{account: tombstones},
+			})
+			return
+		}
+		tombstones, err := store.All()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Tombstones": tombstones,
+		})
+	}
+}
+
+// clearTombstones removes the tombstone for 'id' on 'account', or all of the account's tombstones if 'id' is not set
+func clearTombstones(db plaindb.DB) gin.HandlerFunc {
+	store := newTombstoneStore(db)
+	return func(c *gin.Context) {
+		account := c.Query("account")
+		if account == "" {
+			abortWithClientError(c, http.StatusBadRequest, errors.New("Account is required"))
+			return
+		}
+		cleared, err := store.Clear(account, c.Query("id"))
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Cleared": cleared,
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// transferFunds sends an intra-bank transfer between two direct connect accounts and responds with the institution's confirmation.
+// Both accounts must opt in with AllowTransfers. The transfer appears in the ledger after the next sync.
+func transferFunds(accountStore *client.AccountStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := c.MustGet(loggerKey).(*zap.Logger)
+		var body struct {
+			From, To string
+			Amount   decimal.Decimal
+		}
+		if !readJSON(c, &body) {
+			return
+		}
+
+		var accounts []direct.Account
+		for _, id := range []string{body.From, body.To} {
+			var account model.Account
+			found, err := accountStore.Get(id, &account)
+			if err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+				return
+			}
+			if !found {
+				abortWithClientError(c, http.StatusNotFound, errors.Errorf("Account not found by ID: %q", id))
+				return
+			}
+			directAccount, ok := account.(direct.Account)
+			if !ok {
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Transfers are only supported for direct connect accounts: %q", account.Description()))
+				return
+			}
+			accounts = append(accounts, directAccount)
+		}
+		from, to := accounts[0], accounts[1]
+		if err := direct.ValidateTransfer(from, to, body.Amount); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+
+		confirmation, err := direct.Transfer(from, to, body.Amount)
+		if err != nil {
+			if err == direct.ErrAuthFailed {
+				abortWithClientError(c, http.StatusUnauthorized, err)
+				return
+			}
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		logger.Info("Institution confirmed transfer",
+			zap.String("from", from.ID()),
+			zap.String("to", to.ID()),
+			zap.String("amount", body.Amount.String()),
+			zap.String("serverID", confirmation.ServerID),
+		)
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Transfer": confirmation,
+		})
+	}
+}
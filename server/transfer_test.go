@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestTransferFunds(t *testing.T) {
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	for _, account := range []struct {
+		id, accountType string
+		allowTransfers  bool
+	}{
+		{"1111", "CHECKING", true},
+		{"2222", "SAVINGS", true},
+		{"3333", "SAVINGS", false},
+	} {
+		directAccount, err := client.UnmarshalAccount([]byte(fmt.Sprintf(`{
+			"AccountID": %q,
+			"AccountDescription": "some bank account",
+			"AllowTransfers": %t,
+			"DirectConnect": {
+				"InstDescription": "some bank",
+				"InstFID": "1234",
+				"InstOrg": "some org",
+				"ConnectorURL": "https://bank.example/ofx",
+				"ConnectorUsername": "some username",
+				"ConnectorPassword": "some password",
+				"ConnectorConfig": {"AppID": "QWIN", "AppVersion": "2500", "OFXVersion": "102"}
+			},
+			"BankAccountType": %q,
+			"RoutingNumber": "111"
+		}`, account.id, account.allowTransfers, account.accountType)))
+		require.NoError(t, err)
+		require.NoError(t, accountStore.Add(directAccount))
+	}
+	require.NoError(t, accountStore.Add(&model.BasicAccount{
+		AccountID:          "4444",
+		AccountDescription: "some manual import",
+		AccountType:        model.AssetAccount,
+		BasicInstitution:   model.BasicInstitution{InstOrg: "some org", InstFID: "1234"},
+	}))
+
+	for _, tc := range []struct {
+		description  string
+		body         string
+		expectStatus int
+		expectErr    string
+	}{
+		{
+			description:  "missing account",
+			body:         `{"From": "1111", "To": "9999", "Amount": "5"}`,
+			expectStatus: http.StatusNotFound,
+			expectErr:    `Account not found by ID: \"9999\"`,
+		},
+		{
+			description:  "not direct connect",
+			body:         `{"From": "1111", "To": "4444", "Amount": "5"}`,
+			expectStatus: http.StatusBadRequest,
+			expectErr:    `Transfers are only supported for direct connect accounts: \"some manual import\"`,
+		},
+		{
+			description:  "transfers not enabled",
+			body:         `{"From": "1111", "To": "3333", "Amount": "5"}`,
+			expectStatus: http.StatusBadRequest,
+			expectErr:    `Transfers are not enabled for account \"3333\"`,
+		},
+		{
+			description:  "invalid amount",
+			body:         `{"From": "1111", "To": "2222", "Amount": "-5"}`,
+			expectStatus: http.StatusBadRequest,
+			expectErr:    "Transfer amount must be positive: -5",
+		},
+		{
+			description:  "malformed amount",
+			body:         `{"From": "1111", "To": "2222", "Amount": "five"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			engine := gin.New()
+			logger := zaptest.NewLogger(t)
+			engine.Use(func(c *gin.Context) {
+				c.Set(loggerKey, logger)
+			})
+			engine.POST("/direct/transfer", transferFunds(accountStore))
+			resp := httptest.NewRecorder()
+			engine.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/direct/transfer", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.expectStatus, resp.Code)
+			assert.Contains(t, resp.Body.String(), tc.expectErr)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/settings"
+	"github.com/johnstarich/sage/share"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const widgetCacheControl = "private, max-age=300" // suitable for 5 minute polling
+
+var (
+	errWidgetNotFound = errors.New("Not found")
+
+	widgetTemplate = template.Must(template.New("widget").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Label}}</title></head>
+<body><div class="sage-widget"><span class="label">{{.Label}}</span> <span class="amount">{{.DisplayAmount}}</span></div></body></html>
+`))
+)
+
+// widgetResponse only contains aggregate amounts. Never include account numbers or payees.
+type widgetResponse struct {
+	Widget   string
+	Label    string
+	Amount   string
+	Currency string
+	// DisplayAmount is Amount with its currency symbol, formatted for the negotiated display locale. Only set for localized requests.
+	DisplayAmount string `json:",omitempty"`
+	AsOf          time.Time
+}
+
+func getShareTokens(db plaindb.DB) gin.HandlerFunc {
+	store, err := share.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		tokens, err := store.All()
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Tokens": tokens,
+		})
+	}
+}
+
+func addShareToken(db plaindb.DB, ldgStore *ledger.Store) gin.HandlerFunc {
+	store, err := share.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		var body struct {
+			Widget  string `binding:"required"`
+			Label   string
+			Account string
+			Expires *time.Time
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		if body.Widget == share.AccountBalanceWidget {
+			if _, _, balances := ldgStore.Balances(); balances[body.Account] == nil {
+				abortWithClientError(c, http.StatusBadRequest, errors.Errorf("Account not found: %q", body.Account))
+				return
+			}
+		}
+		secretToken, token, err := store.Create(body.Widget, body.Label, body.Account, body.Expires, time.Now())
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"Token":      secretToken,
+			"ShareToken": token,
+		})
+	}
+}
+
+func deleteShareToken(db plaindb.DB) gin.HandlerFunc {
+	store, err := share.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		if err := store.Revoke(c.Param("id")); err != nil {
+			abortWithClientError(c, http.StatusNotFound, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// getWidget serves a single widget for a valid share token. It is registered without the main authentication.
+// Invalid, expired, and revoked tokens all respond with 404 to avoid revealing which tokens exist.
+func getWidget(db plaindb.DB, ldgStore *ledger.Store, accountStore *client.AccountStore, settingsStore *settings.Store) gin.HandlerFunc {
+	store, err := share.NewStore(db)
+	if err != nil {
+		panic(err)
+	}
+	return func(c *gin.Context) {
+		now := time.Now()
+		token, valid := store.Validate(c.Param("token"), now)
+		if !valid {
+			abortWithClientError(c, http.StatusNotFound, errWidgetNotFound)
+			return
+		}
+
+		locale, err := negotiateLocale(c)
+		if err != nil {
+			abortWithClientError(c, http.StatusBadRequest, err)
+			return
+		}
+		resp := widgetResponse{
+			Widget: token.Widget,
+			Label:  token.Label,
+			AsOf:   now,
+		}
+		formats, err := newCurrencyFormats(ldgStore.Ledger, accountStore, settingsStore)
+		if err != nil {
+			abortWithClientError(c, http.StatusInternalServerError, err)
+			return
+		}
+		format := formats.home
+		var amount decimal.Decimal
+		switch token.Widget {
+		case share.NetWorthWidget:
+			_, _, balances := ldgStore.Balances()
+			for account, accountBalances := range balances {
+				if strings.HasPrefix(account, "assets:") || strings.HasPrefix(account, "liabilities:") {
+					amount = amount.Add(accountBalances[len(accountBalances)-1])
+				}
+			}
+		case share.MonthlySpendWidget:
+			start := startOfMonth(now)
+			amount = ldgStore.AccountBalance("expenses:", start, now)
+		case share.AccountBalanceWidget:
+			_, _, balances := ldgStore.Balances()
+			accountBalances := balances[token.Account]
+			if len(accountBalances) == 0 {
+				abortWithClientError(c, http.StatusNotFound, errWidgetNotFound)
+				return
+			}
+			amount = accountBalances[len(accountBalances)-1]
+			format = formats.get(token.Account)
+		default:
+			abortWithClientError(c, http.StatusNotFound, errWidgetNotFound)
+			return
+		}
+		resp.Currency = format.Symbol
+		resp.Amount = format.Fixed(amount)
+
+		html := c.Query("format") == "html"
+		if html || !locale.isMachine() {
+			resp.DisplayAmount = locale.Currency(format, amount)
+		}
+
+		c.Header("Cache-Control", widgetCacheControl)
+		c.Header("Vary", acceptLanguageHeader)
+		locale.setContentLanguage(c)
+		if html {
+			c.Status(http.StatusOK)
+			c.Header("Content-Type", "text/html; charset=utf-8")
+			if err := widgetTemplate.Execute(c.Writer, resp); err != nil {
+				abortWithClientError(c, http.StatusInternalServerError, err)
+			}
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
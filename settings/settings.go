@@ -0,0 +1,381 @@
+// Package settings persists Sage's configurable behavior, so it can change without a restart
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/redactor"
+	"github.com/johnstarich/sage/report"
+	"github.com/johnstarich/sage/rules"
+)
+
+const (
+	// DefaultSyncInterval is how often the server syncs when not configured
+	DefaultSyncInterval = 4 * time.Hour
+	// MinSyncInterval avoids hammering institutions with sync requests
+	MinSyncInterval = 5 * time.Minute
+)
+
+// Settings are Sage's current settings, after applying any updates to the defaults
+type Settings struct {
+	// SyncInterval is the time between automatic syncs
+	SyncInterval Duration
+	// DefaultCategory replaces the uncategorized expense category for transactions no rule matches, if set
+	DefaultCategory string
+	Report          report.Settings
+	// SyncGuardMultiple quarantines unusually large sync batches, 0 disables the guard
+	SyncGuardMultiple float64
+	// ForeignFees links foreign transaction fees to their purchases during sync, an empty Payee disables it
+	ForeignFees ledger.FeeRule
+	Webhook     Webhook
+	SMTP        SMTP
+	// StrictAccounts makes ledger validation fail for postings to accounts without an account directive, like hledger's strict mode
+	StrictAccounts bool
+	// DeclareAccounts adds an account directive for each new account Sage creates, so the ledger stays valid in strict mode
+	DeclareAccounts bool
+	// ClassifierPrecedence orders the stages which categorize synced transactions, highest precedence first. Empty uses the default order.
+	ClassifierPrecedence []string `json:",omitempty"`
+	// HomeCurrency is the ISO 4217 code of the currency for accounts without one of their own. Empty uses model.DefaultCurrencyCode.
+	HomeCurrency string `json:",omitempty"`
+	// Household is another Sage instance to combine with this one in the household dashboard
+	Household HouseholdPeer
+}
+
+// HomeCurrencyFormat returns the format of the home currency
+func (s Settings) HomeCurrencyFormat() model.CurrencyFormat {
+	if s.HomeCurrency == "" {
+		return model.NewCurrencyFormat(model.DefaultCurrencyCode)
+	}
+	return model.NewCurrencyFormat(s.HomeCurrency)
+}
+
+// Webhook is a URL to notify about events
+type Webhook struct {
+	URL string
+	// Auth is sent as the Authorization header
+	Auth redactor.String
+}
+
+// HouseholdPeer is another household member's Sage instance, read with one of its scoped API keys.
+// Only balances and category totals are read, unless IncludeTransactions is set and the key's scope allows reading transactions.
+type HouseholdPeer struct {
+	// Name labels the peer's data, like "Alex"
+	Name string
+	// URL is the peer's base URL, like https://sage.example.com. Empty disables peering.
+	URL    string
+	APIKey redactor.String
+	// IncludeTransactions also reads the peer's recent transactions
+	IncludeTransactions bool
+}
+
+// SMTP is a mail server to send notifications through
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password redactor.String
+	From     string
+	To       string
+}
+
+// Update is a partial update to Settings. Nil fields are unchanged.
+// Redacted secrets are sent as null, so they remain unchanged unless explicitly set.
+type Update struct {
+	SyncInterval      *Duration        `json:",omitempty"`
+	DefaultCategory   *string          `json:",omitempty"`
+	Report            *report.Settings `json:",omitempty"`
+	SyncGuardMultiple *float64         `json:",omitempty"`
+	ForeignFees       *ledger.FeeRule  `json:",omitempty"`
+	Webhook           *WebhookUpdate   `json:",omitempty"`
+	SMTP              *SMTPUpdate      `json:",omitempty"`
+	StrictAccounts    *bool            `json:",omitempty"`
+	DeclareAccounts   *bool            `json:",omitempty"`
+	// ClassifierPrecedence replaces the stage order, an empty list restores the default
+	ClassifierPrecedence *[]string            `json:",omitempty"`
+	HomeCurrency         *string              `json:",omitempty"`
+	Household            *HouseholdPeerUpdate `json:",omitempty"`
+}
+
+// WebhookUpdate is a partial update to Webhook
+type WebhookUpdate struct {
+	URL  *string          `json:",omitempty"`
+	Auth *redactor.String `json:",omitempty"`
+}
+
+// HouseholdPeerUpdate is a partial update to HouseholdPeer
+type HouseholdPeerUpdate struct {
+	Name                *string          `json:",omitempty"`
+	URL                 *string          `json:",omitempty"`
+	APIKey              *redactor.String `json:",omitempty"`
+	IncludeTransactions *bool            `json:",omitempty"`
+}
+
+// SMTPUpdate is a partial update to SMTP
+type SMTPUpdate struct {
+	Host     *string          `json:",omitempty"`
+	Port     *int             `json:",omitempty"`
+	Username *string          `json:",omitempty"`
+	Password *redactor.String `json:",omitempty"`
+	From     *string          `json:",omitempty"`
+	To       *string          `json:",omitempty"`
+}
+
+// FieldErrors maps each invalid field to the reason it's invalid
+type FieldErrors map[string]string
+
+func (f FieldErrors) Error() string {
+	fields := make([]string, 0, len(f))
+	for field := range f {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	reasons := make([]string, 0, len(fields))
+	for _, field := range fields {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", field, f[field]))
+	}
+	return "Invalid settings: " + strings.Join(reasons, "; ")
+}
+
+// Validate returns FieldErrors for each invalid field set in u
+func (u Update) Validate() error {
+	errs := make(FieldErrors)
+	if u.SyncInterval != nil && time.Duration(*u.SyncInterval) < MinSyncInterval {
+		errs["SyncInterval"] = fmt.Sprintf("Must be at least %s", MinSyncInterval)
+	}
+	if u.DefaultCategory != nil && !validCategory(*u.DefaultCategory) {
+		errs["DefaultCategory"] = "Must be a ledger account name, or empty to use the default"
+	}
+	if u.Report != nil {
+		if err := u.Report.Validate(); err != nil {
+			errs["Report.DateBasis"] = err.Error()
+		}
+	}
+	if u.SyncGuardMultiple != nil {
+		if multiple := *u.SyncGuardMultiple; multiple != 0 && multiple < 1 {
+			errs["SyncGuardMultiple"] = "Must be 0 to disable, or at least 1"
+		}
+	}
+	if u.ForeignFees != nil {
+		if err := u.ForeignFees.Validate(); err != nil {
+			errs["ForeignFees"] = err.Error()
+		}
+	}
+	if u.ClassifierPrecedence != nil {
+		if _, err := rules.NormalizePrecedence(*u.ClassifierPrecedence); err != nil {
+			errs["ClassifierPrecedence"] = err.Error()
+		}
+	}
+	if u.HomeCurrency != nil && *u.HomeCurrency != "" {
+		if err := model.NewCurrencyFormat(*u.HomeCurrency).Validate(); err != nil {
+			errs["HomeCurrency"] = err.Error()
+		}
+	}
+	if u.Webhook != nil && u.Webhook.URL != nil && *u.Webhook.URL != "" {
+		if parsed, err := url.Parse(*u.Webhook.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs["Webhook.URL"] = "Must be an http or https URL"
+		}
+	}
+	if u.Household != nil && u.Household.URL != nil && *u.Household.URL != "" {
+		if parsed, err := url.Parse(*u.Household.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs["Household.URL"] = "Must be an http or https URL"
+		}
+	}
+	if u.SMTP != nil {
+		if u.SMTP.Port != nil && (*u.SMTP.Port < 0 || *u.SMTP.Port > 65535) {
+			errs["SMTP.Port"] = "Must be a valid port number"
+		}
+		if u.SMTP.Host != nil && strings.ContainsAny(*u.SMTP.Host, " \t\n/") {
+			errs["SMTP.Host"] = "Must be a host name"
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validCategory(category string) bool {
+	if category == "" {
+		return true
+	}
+	return strings.TrimSpace(category) == category &&
+		!strings.ContainsAny(category, "\t\n;") &&
+		!strings.Contains(category, "  ")
+}
+
+// apply sets each of u's fields on s
+func (u Update) apply(s *Settings) {
+	if u.SyncInterval != nil {
+		s.SyncInterval = *u.SyncInterval
+	}
+	if u.DefaultCategory != nil {
+		s.DefaultCategory = ledger.NormalizeAccountName(*u.DefaultCategory)
+	}
+	if u.Report != nil {
+		s.Report = *u.Report
+	}
+	if u.SyncGuardMultiple != nil {
+		s.SyncGuardMultiple = *u.SyncGuardMultiple
+	}
+	if u.ForeignFees != nil {
+		s.ForeignFees = *u.ForeignFees
+	}
+	if u.Webhook != nil {
+		setString(&s.Webhook.URL, u.Webhook.URL)
+		setRedacted(&s.Webhook.Auth, u.Webhook.Auth)
+	}
+	if u.SMTP != nil {
+		setString(&s.SMTP.Host, u.SMTP.Host)
+		if u.SMTP.Port != nil {
+			s.SMTP.Port = *u.SMTP.Port
+		}
+		setString(&s.SMTP.Username, u.SMTP.Username)
+		setRedacted(&s.SMTP.Password, u.SMTP.Password)
+		setString(&s.SMTP.From, u.SMTP.From)
+		setString(&s.SMTP.To, u.SMTP.To)
+	}
+	if u.Household != nil {
+		setString(&s.Household.Name, u.Household.Name)
+		if u.Household.URL != nil {
+			s.Household.URL = strings.TrimRight(*u.Household.URL, "/")
+		}
+		setRedacted(&s.Household.APIKey, u.Household.APIKey)
+		if u.Household.IncludeTransactions != nil {
+			s.Household.IncludeTransactions = *u.Household.IncludeTransactions
+		}
+	}
+	if u.StrictAccounts != nil {
+		s.StrictAccounts = *u.StrictAccounts
+	}
+	if u.DeclareAccounts != nil {
+		s.DeclareAccounts = *u.DeclareAccounts
+	}
+	if u.HomeCurrency != nil {
+		s.HomeCurrency = strings.ToUpper(strings.TrimSpace(*u.HomeCurrency))
+	}
+	if u.ClassifierPrecedence != nil {
+		s.ClassifierPrecedence = nil
+		if len(*u.ClassifierPrecedence) > 0 {
+			s.ClassifierPrecedence, _ = rules.NormalizePrecedence(*u.ClassifierPrecedence)
+		}
+	}
+}
+
+// merge sets each of other's fields on u, so u contains both updates
+func (u *Update) merge(other Update) {
+	if other.SyncInterval != nil {
+		u.SyncInterval = other.SyncInterval
+	}
+	if other.DefaultCategory != nil {
+		u.DefaultCategory = other.DefaultCategory
+	}
+	if other.Report != nil {
+		u.Report = other.Report
+	}
+	if other.SyncGuardMultiple != nil {
+		u.SyncGuardMultiple = other.SyncGuardMultiple
+	}
+	if other.ForeignFees != nil {
+		u.ForeignFees = other.ForeignFees
+	}
+	// copy nested updates, since u may be shared with the stored changes
+	if other.Webhook != nil {
+		var webhook WebhookUpdate
+		if u.Webhook != nil {
+			webhook = *u.Webhook
+		}
+		mergeString(&webhook.URL, other.Webhook.URL)
+		mergeRedacted(&webhook.Auth, other.Webhook.Auth)
+		u.Webhook = &webhook
+	}
+	if other.SMTP != nil {
+		var smtp SMTPUpdate
+		if u.SMTP != nil {
+			smtp = *u.SMTP
+		}
+		mergeString(&smtp.Host, other.SMTP.Host)
+		if other.SMTP.Port != nil {
+			smtp.Port = other.SMTP.Port
+		}
+		mergeString(&smtp.Username, other.SMTP.Username)
+		mergeRedacted(&smtp.Password, other.SMTP.Password)
+		mergeString(&smtp.From, other.SMTP.From)
+		mergeString(&smtp.To, other.SMTP.To)
+		u.SMTP = &smtp
+	}
+	if other.Household != nil {
+		var household HouseholdPeerUpdate
+		if u.Household != nil {
+			household = *u.Household
+		}
+		mergeString(&household.Name, other.Household.Name)
+		mergeString(&household.URL, other.Household.URL)
+		mergeRedacted(&household.APIKey, other.Household.APIKey)
+		if other.Household.IncludeTransactions != nil {
+			household.IncludeTransactions = other.Household.IncludeTransactions
+		}
+		u.Household = &household
+	}
+	if other.StrictAccounts != nil {
+		u.StrictAccounts = other.StrictAccounts
+	}
+	if other.DeclareAccounts != nil {
+		u.DeclareAccounts = other.DeclareAccounts
+	}
+	if other.ClassifierPrecedence != nil {
+		u.ClassifierPrecedence = other.ClassifierPrecedence
+	}
+	if other.HomeCurrency != nil {
+		u.HomeCurrency = other.HomeCurrency
+	}
+}
+
+func setString(dest *string, value *string) {
+	if value != nil {
+		*dest = *value
+	}
+}
+
+func setRedacted(dest *redactor.String, value *redactor.String) {
+	if value != nil {
+		*dest = *value
+	}
+}
+
+func mergeString(dest **string, value *string) {
+	if value != nil {
+		*dest = value
+	}
+}
+
+func mergeRedacted(dest **redactor.String, value *redactor.String) {
+	if value != nil {
+		*dest = value
+	}
+}
+
+// Duration is a time.Duration which marshals to JSON as a string, like "4h0m0s"
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(str)
+	*d = Duration(duration)
+	return err
+}
@@ -0,0 +1,126 @@
+package settings
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+)
+
+const (
+	settingsBucket        = "settings"
+	settingsBucketVersion = "1"
+	settingsID            = "settings"
+)
+
+// Store persists changes to the default settings.
+// Only changed fields are saved, so new defaults apply to anything left unchanged.
+type Store struct {
+	mu        sync.Mutex
+	bucket    plaindb.Bucket
+	defaults  Settings
+	listeners []func(Settings)
+}
+
+// NewStore returns the settings bucket, using 'defaults' for any setting which hasn't been changed
+func NewStore(db plaindb.DB, defaults Settings) (*Store, error) {
+	bucket, err := db.Bucket(settingsBucket, settingsBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket:   bucket,
+		defaults: defaults,
+	}, err
+}
+
+// Settings returns the current settings
+func (s *Store) Settings() (Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, _, err := s.settings()
+	return settings, err
+}
+
+func (s *Store) settings() (Settings, Update, error) {
+	settings := s.defaults
+	var changes Update
+	_, err := s.bucket.Get(settingsID, &changes)
+	changes.apply(&settings)
+	return settings, changes, err
+}
+
+// Update validates and saves 'update', merging it with any previous changes. Returns the new settings.
+// Returns FieldErrors if any field is invalid, in which case nothing is saved.
+func (s *Store) Update(update Update) (Settings, error) {
+	if err := update.Validate(); err != nil {
+		return Settings{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, changes, err := s.settings()
+	if err != nil {
+		return Settings{}, err
+	}
+	changes.merge(update)
+	if err := s.bucket.Put(settingsID, changes); err != nil {
+		return Settings{}, err
+	}
+	settings, _, err := s.settings()
+	if err != nil {
+		return settings, err
+	}
+	for _, listener := range s.listeners {
+		listener(settings)
+	}
+	return settings, nil
+}
+
+// Reload re-reads and validates the saved settings from disk. Call swap to replace the current settings with the reloaded ones and notify listeners.
+func (s *Store) Reload(db plaindb.DB) (swap func(), err error) {
+	bucket, swapBucket, err := db.ReloadBucket(settingsBucket, settingsBucketVersion, &storeUpgrader{})
+	if err != nil {
+		return nil, err
+	}
+	var changes Update
+	if _, err := bucket.Get(settingsID, &changes); err != nil {
+		return nil, err
+	}
+	if err := changes.Validate(); err != nil {
+		return nil, err
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		swapBucket()
+		settings, _, err := s.settings()
+		if err != nil {
+			return
+		}
+		for _, listener := range s.listeners {
+			listener(settings)
+		}
+	}, nil
+}
+
+// OnChange calls 'listener' with the new settings after every update, so changes can take effect immediately
+func (s *Store) OnChange(listener func(Settings)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var update Update
+		err := json.Unmarshal(data, &update)
+		return update, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
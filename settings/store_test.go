@@ -0,0 +1,146 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/redactor"
+	"github.com/johnstarich/sage/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore(plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}}), Settings{
+		SyncInterval: Duration(DefaultSyncInterval),
+		Report:       report.Settings{DateBasis: ledger.PostingBasis},
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func TestUpdateMerges(t *testing.T) {
+	store := newTestStore(t)
+	var changed []Settings
+	store.OnChange(func(s Settings) {
+		changed = append(changed, s)
+	})
+
+	var update Update
+	require.NoError(t, json.Unmarshal([]byte(`{"SyncInterval": "1h", "Webhook": {"URL": "https://example.com/hook", "Auth": "Bearer secret"}}`), &update))
+	_, err := store.Update(update)
+	require.NoError(t, err)
+
+	update = Update{}
+	require.NoError(t, json.Unmarshal([]byte(`{"DefaultCategory": "expenses:review", "Webhook": {"URL": "https://example.com/other", "Auth": null}}`), &update))
+	updated, err := store.Update(update)
+	require.NoError(t, err)
+	assert.Equal(t, Settings{
+		SyncInterval:    Duration(time.Hour),
+		DefaultCategory: "expenses:review",
+		Report:          report.Settings{DateBasis: ledger.PostingBasis},
+		Webhook:         Webhook{URL: "https://example.com/other", Auth: "Bearer secret"},
+	}, updated)
+	require.Len(t, changed, 2)
+	assert.Equal(t, updated, changed[1])
+
+	current, err := store.Settings()
+	require.NoError(t, err)
+	assert.Equal(t, updated, current)
+}
+
+func TestUpdateInvalid(t *testing.T) {
+	store := newTestStore(t)
+	interval := Duration(time.Second)
+	multiple := 0.5
+	category := "expenses:bad  name"
+	url := "ftp://example.com"
+	port := 70000
+	_, err := store.Update(Update{
+		SyncInterval:      &interval,
+		DefaultCategory:   &category,
+		Report:            &report.Settings{DateBasis: "accrual"},
+		SyncGuardMultiple: &multiple,
+		Webhook:           &WebhookUpdate{URL: &url},
+		SMTP:              &SMTPUpdate{Port: &port},
+		Household:         &HouseholdPeerUpdate{URL: &url},
+	})
+	require.IsType(t, FieldErrors{}, err)
+	assert.Equal(t, []string{
+		"DefaultCategory",
+		"Household.URL",
+		"Report.DateBasis",
+		"SMTP.Port",
+		"SyncGuardMultiple",
+		"SyncInterval",
+		"Webhook.URL",
+	}, sortedKeys(err.(FieldErrors)))
+
+	current, err := store.Settings()
+	require.NoError(t, err)
+	assert.Equal(t, Duration(DefaultSyncInterval), current.SyncInterval, "Invalid updates should not be saved")
+}
+
+func TestSettingsRedactsSecrets(t *testing.T) {
+	store := newTestStore(t)
+	password := redactor.String("hunter2")
+	current, err := store.Update(Update{SMTP: &SMTPUpdate{Password: &password}})
+	require.NoError(t, err)
+
+	data, err := json.Marshal(current)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+	assert.Contains(t, string(data), `"SyncInterval":"4h0m0s"`)
+
+	var buf bytes.Buffer
+	require.NoError(t, redactor.NewEncoder(&buf).Encode(current))
+	assert.Contains(t, buf.String(), "hunter2", "Secrets should be persisted")
+}
+
+func sortedKeys(errs FieldErrors) []string {
+	keys := make([]string, 0, len(errs))
+	for key := range errs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestReload(t *testing.T) {
+	contents := `{}`
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(contents), nil
+	}})
+	store, err := NewStore(db, Settings{DefaultCategory: "expenses:uncategorized"})
+	require.NoError(t, err)
+	var changed []Settings
+	store.OnChange(func(s Settings) {
+		changed = append(changed, s)
+	})
+
+	contents = `{"Version": "1", "Data": {"settings": {"SyncInterval": "1s"}}}`
+	_, err = store.Reload(db)
+	assert.Error(t, err)
+
+	contents = `{"Version": "1", "Data": {"settings": {"DefaultCategory": "expenses:review"}}}`
+	swap, err := store.Reload(db)
+	require.NoError(t, err)
+	current, err := store.Settings()
+	require.NoError(t, err)
+	assert.Equal(t, "expenses:uncategorized", current.DefaultCategory, "Settings should not change until swapped")
+
+	swap()
+	current, err = store.Settings()
+	require.NoError(t, err)
+	assert.Equal(t, "expenses:review", current.DefaultCategory)
+	require.Len(t, changed, 1)
+	assert.Equal(t, current, changed[0])
+}
@@ -0,0 +1,46 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WebhookEvent is the JSON body posted to a webhook
+type WebhookEvent struct {
+	// Event names the kind of event, like "accountDiscovery"
+	Event string
+	Time  time.Time
+	Data  interface{}
+}
+
+// Notify posts 'event' to the webhook URL. Does nothing if the URL is empty.
+func (w Webhook) Notify(client *http.Client, event WebhookEvent) error {
+	if w.URL == "" {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Auth != "" {
+		req.Header.Set("Authorization", string(w.Auth))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Failed to send webhook")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("Webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package share
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+)
+
+const (
+	// NetWorthWidget shows the current total of all asset and liability balances
+	NetWorthWidget = "networth"
+	// MonthlySpendWidget shows the total of this month's expenses
+	MonthlySpendWidget = "monthly-spend"
+	// AccountBalanceWidget shows the current balance of a single account
+	AccountBalanceWidget = "account-balance"
+
+	tokensBucket        = "shareTokens"
+	tokensBucketVersion = "1"
+
+	idLength     = 12
+	secretLength = 32
+	separator    = "."
+)
+
+// Token grants read-only access to a single widget. Only a hash of the token's secret is stored.
+type Token struct {
+	ID      string
+	Widget  string
+	Label   string `json:",omitempty"`
+	Account string `json:",omitempty"`
+	Created time.Time
+	Expires *time.Time `json:",omitempty"`
+}
+
+// storedToken includes the secret's hash, which is never exposed through the API
+type storedToken struct {
+	Token
+	Hash string
+}
+
+// Store manages share tokens
+type Store struct {
+	mu     sync.Mutex
+	bucket plaindb.Bucket
+}
+
+// NewStore returns the share tokens bucket
+func NewStore(db plaindb.DB) (*Store, error) {
+	bucket, err := db.Bucket(tokensBucket, tokensBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket: bucket,
+	}, err
+}
+
+// Create generates a new token for 'widget'. The returned secret token is only available once.
+func (s *Store) Create(widget, label, account string, expires *time.Time, now time.Time) (secretToken string, token Token, err error) {
+	switch widget {
+	case NetWorthWidget, MonthlySpendWidget:
+		account = ""
+	case AccountBalanceWidget:
+		if account == "" {
+			return "", Token{}, errors.New("An account is required for account balance widgets")
+		}
+	default:
+		return "", Token{}, errors.Errorf("Unrecognized widget type: %q", widget)
+	}
+	if expires != nil && !expires.After(now) {
+		return "", Token{}, errors.New("Expiration must be in the future")
+	}
+
+	id, err := randomString(idLength)
+	if err != nil {
+		return "", Token{}, err
+	}
+	secret, err := randomString(secretLength)
+	if err != nil {
+		return "", Token{}, err
+	}
+	token = Token{
+		ID:      id,
+		Widget:  widget,
+		Label:   label,
+		Account: account,
+		Created: now,
+		Expires: expires,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.bucket.Put(id, storedToken{Token: token, Hash: hashSecret(secret)})
+	return id + separator + secret, token, err
+}
+
+// Revoke deletes the token with the given ID
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var token storedToken
+	found, err := s.bucket.Get(id, &token)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("Share token not found: %q", id)
+	}
+	return s.bucket.Put(id, nil)
+}
+
+// All returns all tokens, sorted by creation time
+func (s *Store) All() ([]Token, error) {
+	var tokens []Token
+	var token storedToken
+	err := s.bucket.Iter(&token, func(id string) bool {
+		tokens = append(tokens, token.Token)
+		return true
+	})
+	sort.Slice(tokens, func(a, b int) bool {
+		return tokens[a].Created.Before(tokens[b].Created)
+	})
+	return tokens, err
+}
+
+// Validate returns the token matching 'secretToken' if it exists and has not expired
+// The secret comparison is constant-time.
+func (s *Store) Validate(secretToken string, now time.Time) (Token, bool) {
+	tokens := strings.SplitN(secretToken, separator, 2)
+	if len(tokens) != 2 {
+		return Token{}, false
+	}
+	id, secret := tokens[0], tokens[1]
+	var token storedToken
+	found, err := s.bucket.Get(id, &token)
+	if err != nil || !found {
+		// compare anyway to keep timing consistent with a found token
+		subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(hashSecret("")))
+		return Token{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(token.Hash)) != 1 {
+		return Token{}, false
+	}
+	if token.Expires != nil && !now.Before(*token.Expires) {
+		return Token{}, false
+	}
+	return token.Token, true
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(length int) (string, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var token storedToken
+		err := json.Unmarshal(data, &token)
+		return token, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
@@ -0,0 +1,105 @@
+package share
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockDBStore(t *testing.T) *Store {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	store, err := NewStore(db)
+	require.NoError(t, err)
+	return store
+}
+
+func TestCreate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	for _, tc := range []struct {
+		description string
+		widget      string
+		account     string
+		expires     *time.Time
+		expectErr   string
+	}{
+		{
+			description: "net worth",
+			widget:      NetWorthWidget,
+		},
+		{
+			description: "account balance",
+			widget:      AccountBalanceWidget,
+			account:     "assets:Bank",
+		},
+		{
+			description: "account balance without account",
+			widget:      AccountBalanceWidget,
+			expectErr:   "An account is required for account balance widgets",
+		},
+		{
+			description: "unrecognized widget",
+			widget:      "transactions",
+			expectErr:   `Unrecognized widget type: "transactions"`,
+		},
+		{
+			description: "expired",
+			widget:      MonthlySpendWidget,
+			expires:     &past,
+			expectErr:   "Expiration must be in the future",
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			store := mockDBStore(t)
+			secretToken, token, err := store.Create(tc.widget, "label", tc.account, tc.expires, now)
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(secretToken, token.ID+separator))
+			assert.Equal(t, tc.widget, token.Widget)
+			assert.Equal(t, tc.account, token.Account)
+
+			tokens, err := store.All()
+			require.NoError(t, err)
+			assert.Equal(t, []Token{token}, tokens)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+	store := mockDBStore(t)
+	secretToken, token, err := store.Create(NetWorthWidget, "", "", &expires, now)
+	require.NoError(t, err)
+
+	validated, valid := store.Validate(secretToken, now)
+	assert.True(t, valid)
+	assert.Equal(t, token, validated)
+
+	_, valid = store.Validate(token.ID+separator+"wrong", now)
+	assert.False(t, valid, "Wrong secret must be invalid")
+	_, valid = store.Validate("unknown"+separator+"secret", now)
+	assert.False(t, valid, "Unknown ID must be invalid")
+	_, valid = store.Validate(token.ID, now)
+	assert.False(t, valid, "Missing secret must be invalid")
+	_, valid = store.Validate(secretToken, expires)
+	assert.False(t, valid, "Expired token must be invalid")
+
+	require.NoError(t, store.Revoke(token.ID))
+	_, valid = store.Validate(secretToken, now)
+	assert.False(t, valid, "Revoked token must be invalid")
+
+	err = store.Revoke(token.ID)
+	require.Error(t, err)
+	assert.Equal(t, `Share token not found: "`+token.ID+`"`, err.Error())
+}
@@ -0,0 +1,215 @@
+package sync
+
+import (
+	gosync "sync"
+	"time"
+
+	"github.com/johnstarich/sage/audit"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/redactor"
+	"github.com/johnstarich/sage/rules"
+)
+
+// auditRun collects each account's outcome during a single sync for the audit log and sync summary
+type auditRun struct {
+	mu       gosync.Mutex
+	accounts map[string]*audit.AccountOutcome
+	order    []string
+	secrets  map[string]bool
+	imported int
+
+	isNew     func(ledger.Transaction) bool
+	newCounts map[string]int
+	// deferred counts each account's future-dated transactions held back until a later sync
+	deferred map[string]int
+	// dropped counts each account's zero-amount transactions dropped by its policy
+	dropped map[string]int
+	newTxns []audit.SummaryTransaction
+	// disagreements counts new transactions where matching classifier stages chose different categories
+	disagreements int
+}
+
+// newAuditRun returns an auditRun which counts transactions as new when 'isNew' returns true
+func newAuditRun(isNew func(ledger.Transaction) bool) *auditRun {
+	return &auditRun{
+		accounts:  make(map[string]*audit.AccountOutcome),
+		secrets:   make(map[string]bool),
+		isNew:     isNew,
+		newCounts: make(map[string]int),
+		deferred:  make(map[string]int),
+		dropped:   make(map[string]int),
+	}
+}
+
+// recordDeferred counts each account's future-dated transactions which were held back from the ledger
+func (r *auditRun) recordDeferred(txns []ledger.Transaction) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	countByAccount(r.deferred, txns)
+}
+
+// recordDropped counts each account's zero-amount transactions which were dropped by its policy
+func (r *auditRun) recordDropped(txns []ledger.Transaction) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	countByAccount(r.dropped, txns)
+}
+
+func countByAccount(counts map[string]int, txns []ledger.Transaction) {
+	for _, txn := range txns {
+		if len(txn.Postings) > 0 {
+			counts[txn.Postings[0].Account]++
+		}
+	}
+}
+
+// record counts the transactions downloaded for each of 'accounts'. If err is set, it's recorded as the accounts' failure.
+func (r *auditRun) record(accounts []model.Account, txns []ledger.Transaction, err error) {
+	if r == nil {
+		return
+	}
+	counts := make(map[string]int)
+	for _, txn := range txns {
+		if len(txn.Postings) > 0 && !ledger.IsBalanceAssertion(txn) {
+			counts[txn.Postings[0].Account]++
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, account := range accounts {
+		if passworder, ok := account.Institution().(interface{ Password() redactor.String }); ok {
+			r.secrets[string(passworder.Password())] = true
+		}
+		id := account.ID()
+		outcome, exists := r.accounts[id]
+		if !exists {
+			outcome = &audit.AccountOutcome{
+				Account:     model.LedgerAccountName(account),
+				Description: account.Description(),
+			}
+			r.accounts[id] = outcome
+			r.order = append(r.order, id)
+		}
+		outcome.Downloaded += counts[outcome.Account]
+		if err != nil && outcome.Error == "" {
+			outcome.Error = err.Error()
+		}
+	}
+}
+
+// recordWarning records the institution's signon warning for each of 'accounts', if non-nil
+func (r *auditRun) recordWarning(accounts []model.Account, warning *direct.SignonWarning) {
+	if r == nil || warning == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, account := range accounts {
+		if outcome, exists := r.accounts[account.ID()]; exists && outcome.Warning == "" {
+			outcome.Warning = warning.String()
+		}
+	}
+}
+
+// recordClassifications counts the new transactions in 'txns' whose classifier stages disagreed
+func (r *auditRun) recordClassifications(txns []ledger.Transaction, classifications []rules.Classification) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, classification := range classifications {
+		if classification.Disagreement() && len(txns[i].Postings) > 0 && r.isNew(txns[i]) {
+			r.disagreements++
+		}
+	}
+}
+
+// process wraps processTxns to count the transactions imported into the ledger, and which of them are new
+func (r *auditRun) process(processTxns func([]ledger.Transaction)) func([]ledger.Transaction) {
+	return func(txns []ledger.Transaction) {
+		r.mu.Lock()
+		r.imported = len(txns)
+		for _, txn := range txns {
+			if len(txn.Postings) == 0 || ledger.IsBalanceAssertion(txn) || !r.isNew(txn) {
+				continue
+			}
+			p := txn.Postings[0]
+			r.newCounts[p.Account]++
+			r.newTxns = append(r.newTxns, audit.SummaryTransaction{
+				Date:    txn.Date,
+				Account: p.Account,
+				Payee:   txn.Payee,
+				Amount:  p.Amount,
+			})
+		}
+		r.mu.Unlock()
+		processTxns(txns)
+	}
+}
+
+// done returns a callback to write the run's outcome to 'log' and 'summaryFile' when the sync finishes.
+// The summary is also sent to 'results'. 'modified' reports whether the sync changed the ledger.
+func (r *auditRun) done(log *audit.Log, summaryFile *audit.SummaryFile, start, end time.Time, modified func() bool, results chan<- audit.Summary) func(error) {
+	return func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		now := time.Now()
+		entry := audit.Entry{
+			Time:     now,
+			Start:    start,
+			End:      end,
+			Accounts: make([]audit.AccountOutcome, 0, len(r.order)),
+			Imported: r.imported,
+		}
+		summary := audit.Summary{
+			Time:           now,
+			Accounts:       make([]audit.SummaryAccount, 0, len(r.order)),
+			LedgerModified: modified(),
+			Transactions:   r.newTxns,
+
+			ClassificationDisagreements: r.disagreements,
+		}
+		for _, id := range r.order {
+			outcome := *r.accounts[id]
+			entry.Accounts = append(entry.Accounts, outcome)
+			newCount := r.newCounts[outcome.Account]
+			summary.New += newCount
+			account := audit.SummaryAccount{
+				Account:     outcome.Account,
+				Description: outcome.Description,
+				New:         newCount,
+				Error:       outcome.Error,
+				Warning:     outcome.Warning,
+				Dropped:     r.dropped[outcome.Account],
+			}
+			if deferred := r.deferred[outcome.Account]; deferred > 0 {
+				account.Deferred = deferred
+				account.Note = FutureDeferredReason
+			}
+			summary.Accounts = append(summary.Accounts, account)
+		}
+		if err != nil {
+			entry.Error = err.Error()
+			summary.Error = err.Error()
+		}
+		secrets := make([]string, 0, len(r.secrets))
+		for secret := range r.secrets {
+			secrets = append(secrets, secret)
+		}
+		// audit failures shouldn't fail the sync, which already finished
+		_ = log.Write(entry, secrets...)
+		summary = summaryFile.Prepare(summary, secrets...)
+		_ = summaryFile.Write(summary)
+		results <- summary
+	}
+}
@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/audit"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/rules"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	auditLog := audit.New(filepath.Join(dir, "audit.log"), 0)
+
+	connector := direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", "user", "hunter2", direct.Config{})
+	card := direct.NewCreditCard("5678", "some card", connector)
+	other := direct.NewCreditCard("9012", "other card", connector)
+	txn := ledger.Transaction{Postings: []ledger.Posting{{Account: model.LedgerAccountName(card)}, {Account: model.Uncategorized}}}
+
+	run := newAuditRun(func(ledger.Transaction) bool { return true })
+	run.record([]model.Account{card, other}, []ledger.Transaction{txn, txn}, nil)
+	run.record([]model.Account{card, other}, nil, errors.New("bad password hunter2"))
+	run.recordWarning([]model.Account{card}, &direct.SignonWarning{Code: 15000, Severity: "WARN", Message: "Password expires soon"})
+	run.process(func([]ledger.Transaction) {})([]ledger.Transaction{txn, txn})
+	run.recordClassifications([]ledger.Transaction{txn, txn}, []rules.Classification{
+		{Stage: rules.StageRules, Stages: []rules.StageResult{
+			{Stage: rules.StageRules, Matched: true, Categories: []string{"expenses:meals"}},
+			{Stage: rules.StageCategoryCodes, Matched: true, Categories: []string{"expenses:travel"}},
+		}},
+		{Stage: rules.StageRules, Stages: []rules.StageResult{
+			{Stage: rules.StageRules, Matched: true, Categories: []string{"expenses:meals"}},
+		}},
+	})
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	summaryFile := audit.NewSummaryFile(filepath.Join(dir, "summary.json"), false)
+	results := make(chan audit.Summary, 1)
+	run.done(auditLog, summaryFile, start, end, func() bool { return true }, results)(errors.New("sync failed"))
+
+	entries, err := auditLog.Tail(1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	assert.Equal(t, start, entry.Start)
+	assert.Equal(t, end, entry.End)
+	assert.Equal(t, 2, entry.Imported)
+	assert.Equal(t, "sync failed", entry.Error)
+	assert.Equal(t, []audit.AccountOutcome{
+		{Account: "liabilities:some org:****5678", Description: "some card", Downloaded: 2, Error: "bad password ****", Warning: "Signon status 15000: Password expires soon"},
+		{Account: "liabilities:some org:****9012", Description: "other card", Error: "bad password ****"},
+	}, entry.Accounts)
+
+	summary := <-results
+	assert.Equal(t, 2, summary.New)
+	assert.True(t, summary.LedgerModified)
+	assert.Equal(t, 1, summary.ClassificationDisagreements)
+	assert.Equal(t, "sync failed", summary.Error)
+	assert.Equal(t, []audit.SummaryAccount{
+		{Account: "liabilities:some org:****5678", Description: "some card", New: 2, Error: "bad password ****", Warning: "Signon status 15000: Password expires soon"},
+		{Account: "liabilities:some org:****9012", Description: "other card", Error: "bad password ****"},
+	}, summary.Accounts)
+	assert.Empty(t, summary.Transactions, "Transaction details should only be included in verbose summaries")
+	saved, found, err := summaryFile.Read()
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, summary.Accounts, saved.Accounts)
+
+	var noRun *auditRun
+	noRun.record([]model.Account{card}, nil, nil)
+	noRun.recordWarning([]model.Account{card}, &direct.SignonWarning{})
+}
@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// BalanceAdjustmentAccount is the other side of each manual account's balance adjustments
+const BalanceAdjustmentAccount = "equity:Balance Adjustments"
+
+// RecordBalance records a balance snapshot for the manual account 'id', so its ledger balance on 'date' equals 'balance'.
+// The difference from the current balance is recorded as a transaction against BalanceAdjustmentAccount.
+// Returns the adjustment, or nil if the balance already matched.
+func RecordBalance(ldgStore *ledger.Store, accountStore *client.AccountStore, id string, date time.Time, balance decimal.Decimal) (*ledger.Transaction, error) {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Errorf("Account not found by ID: %q", id)
+	}
+	if !model.IsManual(account) {
+		return nil, errors.Errorf("Account is not tracked manually, balances are only recorded for manual accounts: %q", account.Description())
+	}
+	if closed := model.ClosedDate(account); closed != nil && date.After(*closed) {
+		return nil, errors.Errorf("Account %q was closed on %s", account.Description(), closed.Format(closedDateFormat))
+	}
+
+	name := model.LedgerAccountName(account)
+	difference := balance.Sub(ldgStore.BalancesAsOf(date)[name])
+	if difference.IsZero() {
+		return nil, nil
+	}
+	currency := ldgStore.AccountCurrencies()[name]
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	adjustment := ledger.Transaction{
+		Date:  date,
+		Payee: "Balance adjustment: " + account.Description(),
+		Postings: []ledger.Posting{
+			{
+				Account:  name,
+				Amount:   difference,
+				Currency: currency,
+				Tags:     map[string]string{"id": fmt.Sprintf("balance-%s-%s-%d", account.ID(), date.Format(closedDateFormat), time.Now().UnixNano())},
+			},
+			{Account: BalanceAdjustmentAccount, Amount: difference.Neg(), Currency: currency},
+		},
+	}
+	if err := ldgStore.AddTransactions([]ledger.Transaction{adjustment}); err != nil {
+		return nil, errors.Wrap(err, "Failed to record balance adjustment")
+	}
+	return &adjustment, nil
+}
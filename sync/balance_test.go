@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+type memFile struct {
+	data []byte
+}
+
+func (m *memFile) Write(b []byte) error {
+	m.data = append([]byte(nil), b...)
+	return nil
+}
+
+func (m *memFile) Path() string {
+	return ""
+}
+
+func (m *memFile) Read() ([]byte, error) {
+	return m.data, nil
+}
+
+func TestRecordBalance(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	accountStore, err := client.NewAccountStore(db)
+	require.NoError(t, err)
+	envelope := model.NewManualAccount("envelope", "cash envelope", model.AssetAccount, "cash")
+	require.NoError(t, accountStore.Add(envelope))
+	require.NoError(t, accountStore.Add(&model.BasicAccount{AccountID: "card", AccountDescription: "some card"}))
+	ldgStore, err := ledger.NewStore(&memFile{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	name := model.LedgerAccountName(envelope)
+	jan := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	adjustment, err := RecordBalance(ldgStore, accountStore, "envelope", jan, decimal.NewFromFloat(100))
+	require.NoError(t, err)
+	require.NotNil(t, adjustment)
+	assert.Equal(t, BalanceAdjustmentAccount, adjustment.Postings[1].Account)
+
+	adjustment, err = RecordBalance(ldgStore, accountStore, "envelope", feb, decimal.NewFromFloat(60))
+	require.NoError(t, err)
+	require.NotNil(t, adjustment)
+	assert.Equal(t, "-40", adjustment.Postings[0].Amount.String())
+	assert.Equal(t, "60", ldgStore.BalancesAsOf(feb)[name].String())
+	assert.Equal(t, "100", ldgStore.BalancesAsOf(jan)[name].String())
+
+	adjustment, err = RecordBalance(ldgStore, accountStore, "envelope", feb, decimal.NewFromFloat(60))
+	require.NoError(t, err)
+	assert.Nil(t, adjustment, "Matching balances shouldn't need an adjustment")
+	assert.Equal(t, 2, ldgStore.Size())
+
+	_, err = RecordBalance(ldgStore, accountStore, "card", feb, decimal.NewFromFloat(60))
+	require.Error(t, err)
+	assert.Equal(t, `Account is not tracked manually, balances are only recorded for manual accounts: "some card"`, err.Error())
+}
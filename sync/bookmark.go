@@ -0,0 +1,183 @@
+package sync
+
+import (
+	gosync "sync"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+)
+
+// ResetBookmark clears the sync bookmark for account 'id', so the next sync re-fetches its transactions from the start of the ledger.
+// Existing transactions are kept, the next sync skips any duplicates.
+func ResetBookmark(accountStore *client.AccountStore, id string) error {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("Account not found by ID: %q", id)
+	}
+	bookmarker, ok := account.(model.SyncBookmarker)
+	if !ok {
+		return errors.Errorf("Account does not support sync bookmarks: %q", account.Description())
+	}
+	bookmarker.SetSyncBookmark(&time.Time{})
+	return accountStore.Update(id, account)
+}
+
+// accountSyncStart returns the first date to download for account, limited to the ledger's date range
+func accountSyncStart(account model.Account, recentStart, ledgerStart time.Time) time.Time {
+	bookmark := model.SyncBookmark(account)
+	if bookmark == nil {
+		return recentStart
+	}
+	start := *bookmark
+	if start.Before(ledgerStart) {
+		start = ledgerStart
+	}
+	if start.IsZero() || start.After(recentStart) {
+		// empty ledger, or already caught up to the rest of the ledger
+		return recentStart
+	}
+	return start
+}
+
+// syncStarts returns each account's first download date, and the earliest of those dates
+func syncStarts(accountStore *client.AccountStore, include func(model.Account) bool, recentStart, ledgerStart time.Time) (map[string]time.Time, time.Time, error) {
+	starts := make(map[string]time.Time)
+	earliest := recentStart
+	var account model.Account
+	err := accountStore.Iter(&account, func(id string) bool {
+		if !include(account) {
+			return true
+		}
+		start := accountSyncStart(account, recentStart, ledgerStart)
+		starts[id] = start
+		if start.Before(earliest) {
+			earliest = start
+		}
+		return true
+	})
+	return starts, earliest, err
+}
+
+// bookmarks tracks each account's download progress during a single sync
+type bookmarks struct {
+	mu     gosync.Mutex
+	synced map[string]time.Time
+	failed map[string]bool
+	// limits caps each account's bookmark at its earliest deferred transaction, so a later sync downloads it again
+	limits map[string]time.Time
+	// successOnly records when accounts last synced without changing their bookmarks, for syncs which ignore bookmarks
+	successOnly bool
+	now         func() time.Time
+}
+
+func newBookmarks() *bookmarks {
+	return &bookmarks{
+		synced: make(map[string]time.Time),
+		failed: make(map[string]bool),
+		limits: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// newSyncSuccesses returns bookmarks which only record each account's last successful sync time
+func newSyncSuccesses() *bookmarks {
+	b := newBookmarks()
+	b.successOnly = true
+	return b
+}
+
+// record marks 'accounts' as downloaded through 'end'. After a failure, an account's bookmark stops advancing for the rest of the sync.
+func (b *bookmarks) record(accounts []model.Account, end time.Time, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, account := range accounts {
+		id := account.ID()
+		switch {
+		case err != nil:
+			b.failed[id] = true
+		case !b.failed[id] && end.After(b.synced[id]):
+			b.synced[id] = end
+		}
+	}
+}
+
+// holdBack keeps the bookmarks for 'accounts' from advancing past any of the 'deferred' transactions' dates
+func (b *bookmarks) holdBack(accounts []model.Account, deferred []ledger.Transaction) {
+	if b == nil {
+		return
+	}
+	ids := make(map[string]string, len(accounts))
+	for _, account := range accounts {
+		ids[model.LedgerAccountName(account)] = account.ID()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, txn := range deferred {
+		if len(txn.Postings) == 0 {
+			continue
+		}
+		id, ok := ids[txn.Postings[0].Account]
+		if !ok {
+			continue
+		}
+		if limit, exists := b.limits[id]; !exists || txn.Date.Before(limit) {
+			b.limits[id] = txn.Date
+		}
+	}
+}
+
+// save writes the recorded bookmarks to their accounts, along with the sync time for accounts which never failed
+func (b *bookmarks) save(accountStore *client.AccountStore) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	syncedAt := b.now()
+	for id, end := range b.synced {
+		succeeded := !b.failed[id]
+		if b.successOnly && !succeeded {
+			continue
+		}
+		// reload the account to avoid overwriting changes made during the sync
+		var account model.Account
+		found, err := accountStore.Get(id, &account)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		changed := false
+		if bookmarker, ok := account.(model.SyncBookmarker); ok && !b.successOnly {
+			end := end
+			if limit, exists := b.limits[id]; exists && limit.Before(end) {
+				end = limit
+			}
+			bookmarker.SetSyncBookmark(&end)
+			changed = true
+		}
+		if recorder, ok := account.(model.SyncSuccessRecorder); ok && succeeded {
+			syncedAt := syncedAt
+			recorder.SetLastSyncSuccessTime(&syncedAt)
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := accountStore.Update(id, account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
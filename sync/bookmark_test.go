@@ -0,0 +1,167 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func getBookmark(t *testing.T, accountStore *client.AccountStore, id string) *time.Time {
+	t.Helper()
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	require.NoError(t, err)
+	require.True(t, found)
+	return model.SyncBookmark(account)
+}
+
+func TestResetBookmark(t *testing.T) {
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	lastSync := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, accountStore.Add(&model.BasicAccount{
+		AccountID:          "1",
+		AccountDescription: "some account",
+		LastSync:           &lastSync,
+	}))
+
+	require.NoError(t, ResetBookmark(accountStore, "1"))
+	assert.Equal(t, timePtr(time.Time{}), getBookmark(t, accountStore, "1"))
+
+	err = ResetBookmark(accountStore, "2")
+	require.Error(t, err)
+	assert.Equal(t, `Account not found by ID: "2"`, err.Error())
+}
+
+func TestAccountSyncStart(t *testing.T) {
+	ledgerStart := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	recentStart := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		description string
+		bookmark    *time.Time
+		ledgerStart time.Time
+		expect      time.Time
+	}{
+		{
+			description: "no bookmark",
+			ledgerStart: ledgerStart,
+			expect:      recentStart,
+		},
+		{
+			description: "reset bookmark",
+			bookmark:    timePtr(time.Time{}),
+			ledgerStart: ledgerStart,
+			expect:      ledgerStart,
+		},
+		{
+			description: "reset bookmark with empty ledger",
+			bookmark:    timePtr(time.Time{}),
+			expect:      recentStart,
+		},
+		{
+			description: "bookmark behind the ledger",
+			bookmark:    timePtr(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)),
+			ledgerStart: ledgerStart,
+			expect:      time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			description: "bookmark caught up",
+			bookmark:    timePtr(time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)),
+			ledgerStart: ledgerStart,
+			expect:      recentStart,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			account := &model.BasicAccount{AccountID: "1", LastSync: tc.bookmark}
+			assert.Equal(t, tc.expect, accountSyncStart(account, recentStart, tc.ledgerStart))
+		})
+	}
+}
+
+func TestBookmarksSave(t *testing.T) {
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	account1 := &model.BasicAccount{AccountID: "1", AccountDescription: "account 1", LastSync: timePtr(time.Time{})}
+	account2 := &model.BasicAccount{AccountID: "2", AccountDescription: "account 2"}
+	require.NoError(t, accountStore.Add(account1))
+	require.NoError(t, accountStore.Add(account2))
+
+	chunk1 := time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC)
+	chunk2 := time.Date(2019, 3, 2, 0, 0, 0, 0, time.UTC)
+	chunk3 := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	marks := newBookmarks()
+	marks.record([]model.Account{account1, account2}, chunk1, nil)
+	marks.record([]model.Account{account1}, chunk2, nil)
+	marks.record([]model.Account{account2}, chunk2, errors.New("some error"))
+	marks.record([]model.Account{account1, account2}, chunk3, nil)
+	require.NoError(t, marks.save(accountStore))
+
+	assert.Equal(t, &chunk3, getBookmark(t, accountStore, "1"))
+	assert.Equal(t, &chunk1, getBookmark(t, accountStore, "2"), "Bookmarks should not advance past a failed download")
+	assert.NotNil(t, getLastSyncSuccess(t, accountStore, "1"))
+	assert.Nil(t, getLastSyncSuccess(t, accountStore, "2"), "Accounts with failed downloads should not record a successful sync")
+
+	var noMarks *bookmarks
+	noMarks.record([]model.Account{account1}, chunk3, nil)
+	assert.NoError(t, noMarks.save(accountStore))
+}
+
+func TestBookmarksHoldBack(t *testing.T) {
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	account1 := &model.BasicAccount{AccountID: "1", AccountDescription: "account 1", AccountType: model.LiabilityAccount, LastSync: timePtr(time.Time{})}
+	account2 := &model.BasicAccount{AccountID: "2", AccountDescription: "account 2", AccountType: model.LiabilityAccount, LastSync: timePtr(time.Time{})}
+	require.NoError(t, accountStore.Add(account1))
+	require.NoError(t, accountStore.Add(account2))
+	accounts := []model.Account{account1, account2}
+
+	end := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	deferredDate := time.Date(2019, 3, 20, 0, 0, 0, 0, time.UTC)
+	marks := newBookmarks()
+	marks.record(accounts, end, nil)
+	marks.holdBack(accounts, []ledger.Transaction{
+		{Date: end.AddDate(0, 0, 5), Postings: []ledger.Posting{{Account: model.LedgerAccountName(account1)}}},
+		{Date: deferredDate, Postings: []ledger.Posting{{Account: model.LedgerAccountName(account1)}}},
+	})
+	require.NoError(t, marks.save(accountStore))
+
+	assert.Equal(t, &deferredDate, getBookmark(t, accountStore, "1"), "Bookmarks should not advance past deferred transactions")
+	assert.Equal(t, &end, getBookmark(t, accountStore, "2"))
+}
+
+func getLastSyncSuccess(t *testing.T, accountStore *client.AccountStore, id string) *time.Time {
+	t.Helper()
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	require.NoError(t, err)
+	require.True(t, found)
+	return model.LastSyncSuccess(account)
+}
+
+func TestSyncSuccessesSave(t *testing.T) {
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	bookmark := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	account := &model.BasicAccount{AccountID: "1", AccountDescription: "account 1", LastSync: &bookmark}
+	require.NoError(t, accountStore.Add(account))
+
+	syncedAt := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	marks := newSyncSuccesses()
+	marks.now = func() time.Time { return syncedAt }
+	marks.record([]model.Account{account}, time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC), nil)
+	require.NoError(t, marks.save(accountStore))
+
+	assert.Equal(t, &bookmark, getBookmark(t, accountStore, "1"), "Bookmarks should not change")
+	assert.Equal(t, &syncedAt, getLastSyncSuccess(t, accountStore, "1"))
+}
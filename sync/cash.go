@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// AdjustCashBalance records a counted cash balance, so the cash wallet account's ledger balance on 'date' equals 'counted'.
+// The difference from the current balance is recorded as a transaction against ledger.UnaccountedCashAccount, for cash spent without recording it.
+// Returns the adjustment, or nil if the balance already matched.
+// Uses the cash account's currency, or 'home' if it has no postings yet.
+func AdjustCashBalance(ldgStore *ledger.Store, home model.CurrencyFormat, date time.Time, counted decimal.Decimal) (*ledger.Transaction, error) {
+	if counted.IsNegative() {
+		return nil, errors.Errorf("Counted cash must not be negative: %s", counted)
+	}
+	difference := counted.Sub(ldgStore.BalancesAsOf(date)[ledger.CashAccount])
+	if difference.IsZero() {
+		return nil, nil
+	}
+	currency := cashCurrency(ldgStore, home)
+	adjustment := ledger.Transaction{
+		Date:  date,
+		Payee: "Cash balance adjustment",
+		Postings: []ledger.Posting{
+			{
+				Account:  ledger.CashAccount,
+				Amount:   difference,
+				Currency: currency,
+				Tags:     map[string]string{"id": fmt.Sprintf("cash-%s-%d", date.Format(closedDateFormat), time.Now().UnixNano())},
+			},
+			{Account: ledger.UnaccountedCashAccount, Amount: difference.Neg(), Currency: currency},
+		},
+	}
+	if err := ldgStore.AddTransactions([]ledger.Transaction{adjustment}); err != nil {
+		return nil, errors.Wrap(err, "Failed to record cash balance adjustment")
+	}
+	return &adjustment, nil
+}
+
+// RecordCashSpending records 'amount' of cash spent on 'payee' from the cash wallet account, categorized as expense account 'category'.
+// An empty category leaves the spending uncategorized. Uses the cash account's currency, or 'home' if it has no postings yet.
+func RecordCashSpending(ldgStore *ledger.Store, home model.CurrencyFormat, date time.Time, payee, category string, amount decimal.Decimal) (*ledger.Transaction, error) {
+	if !amount.IsPositive() {
+		return nil, errors.Errorf("Cash spent must be positive: %s", amount)
+	}
+	if strings.TrimSpace(payee) == "" {
+		return nil, errors.New("Payee must not be empty")
+	}
+	if strings.ContainsAny(payee, "\r\n") {
+		return nil, errors.Errorf("Payee must not contain line breaks: %q", payee)
+	}
+	if category == "" {
+		category = model.Uncategorized
+	} else {
+		if err := ledger.ValidateCategory(category); err != nil {
+			return nil, err
+		}
+		category = ledger.NormalizeAccountName(category)
+		if ldgStore.AccountType(category) != ledger.ExpenseType {
+			return nil, errors.Errorf("Category must be an expense account: %q", category)
+		}
+	}
+	currency := cashCurrency(ldgStore, home)
+	spending := ledger.Transaction{
+		Date:  date,
+		Payee: payee,
+		Postings: []ledger.Posting{
+			{
+				Account:  ledger.CashAccount,
+				Amount:   amount.Neg(),
+				Currency: currency,
+				Tags:     map[string]string{"id": fmt.Sprintf("cash-spent-%s-%d", date.Format(closedDateFormat), time.Now().UnixNano())},
+			},
+			{Account: category, Amount: amount, Currency: currency},
+		},
+	}
+	if err := ldgStore.AddTransactions([]ledger.Transaction{spending}); err != nil {
+		return nil, errors.Wrap(err, "Failed to record cash spending")
+	}
+	return &spending, nil
+}
+
+func cashCurrency(ldgStore *ledger.Store, home model.CurrencyFormat) string {
+	if currency := ldgStore.AccountCurrencies()[ledger.CashAccount]; currency != "" {
+		return currency
+	}
+	return home.Symbol
+}
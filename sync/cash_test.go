@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+var usd = model.NewCurrencyFormat(model.DefaultCurrencyCode)
+
+func TestAdjustCashBalance(t *testing.T) {
+	ldgStore, err := ledger.NewStore(&memFile{data: []byte(`
+2020/01/02 Corner Bank
+    assets:Bank   $-100 ; id: atm
+    assets:Cash
+
+2020/01/05 Lunch
+    assets:Cash   $-15 ; id: lunch
+    expenses:food
+`)}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	jan := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	adjustment, err := AdjustCashBalance(ldgStore, usd, jan, decimal.NewFromFloat(60))
+	require.NoError(t, err)
+	require.NotNil(t, adjustment)
+	assert.Equal(t, "-25", adjustment.Postings[0].Amount.String())
+	assert.Equal(t, ledger.UnaccountedCashAccount, adjustment.Postings[1].Account)
+	assert.Equal(t, "$", adjustment.Postings[0].Currency)
+	assert.Equal(t, "60", ldgStore.BalancesAsOf(jan)[ledger.CashAccount].String())
+
+	adjustment, err = AdjustCashBalance(ldgStore, usd, jan, decimal.NewFromFloat(60))
+	require.NoError(t, err)
+	assert.Nil(t, adjustment, "Matching balances shouldn't need an adjustment")
+	assert.Equal(t, 3, ldgStore.Size())
+
+	_, err = AdjustCashBalance(ldgStore, usd, jan, decimal.NewFromFloat(-1))
+	assert.EqualError(t, err, "Counted cash must not be negative: -1")
+}
+
+func TestRecordCashSpending(t *testing.T) {
+	ldgStore, err := ledger.NewStore(&memFile{data: []byte(`
+2020/01/02 Corner Bank
+    assets:Bank   $-100 ; id: atm
+    assets:Cash
+`)}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	date := time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)
+	spending, err := RecordCashSpending(ldgStore, usd, date, "Farmers market", "expenses:food", decimal.NewFromFloat(15))
+	require.NoError(t, err)
+	require.NotNil(t, spending)
+	assert.Equal(t, "Farmers market", spending.Payee)
+	assert.Equal(t, ledger.CashAccount, spending.Postings[0].Account)
+	assert.Equal(t, "-15", spending.Postings[0].Amount.String())
+	assert.Equal(t, "expenses:food", spending.Postings[1].Account)
+	assert.Equal(t, "$", spending.Postings[0].Currency)
+	assert.Equal(t, "85", ldgStore.BalancesAsOf(date)[ledger.CashAccount].String())
+
+	spending, err = RecordCashSpending(ldgStore, usd, date, "Parking meter", "", decimal.NewFromFloat(2))
+	require.NoError(t, err)
+	assert.Equal(t, model.Uncategorized, spending.Postings[1].Account)
+
+	_, err = RecordCashSpending(ldgStore, usd, date, "Refund", "expenses:food", decimal.NewFromFloat(-1))
+	assert.EqualError(t, err, "Cash spent must be positive: -1")
+	_, err = RecordCashSpending(ldgStore, usd, date, "", "expenses:food", decimal.NewFromFloat(1))
+	assert.EqualError(t, err, "Payee must not be empty")
+	_, err = RecordCashSpending(ldgStore, usd, date, "Wallet", "assets:Cash", decimal.NewFromFloat(1))
+	assert.EqualError(t, err, `Category must be an expense account: "assets:Cash"`)
+	_, err = RecordCashSpending(ldgStore, usd, date, "Lunch\n\n2020/01/06 Injected", "expenses:food", decimal.NewFromFloat(1))
+	assert.EqualError(t, err, `Payee must not contain line breaks: "Lunch\n\n2020/01/06 Injected"`)
+	_, err = RecordCashSpending(ldgStore, usd, date, "Lunch", "expenses:food\n\n2020/01/06 Injected\n    assets:Bank  $-999 ; id: evil\n    expenses:x", decimal.NewFromFloat(1))
+	assert.Error(t, err)
+	assert.Equal(t, 3, ldgStore.Size())
+	assert.NotContains(t, ldgStore.String(), "Injected")
+}
+
+func TestRecordCashSpendingHomeCurrency(t *testing.T) {
+	ldgStore, err := ledger.NewStore(&memFile{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	spending, err := RecordCashSpending(ldgStore, model.NewCurrencyFormat("EUR"), time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC), "Bakery", "expenses:food", decimal.NewFromFloat(3))
+	require.NoError(t, err)
+	assert.Equal(t, "€", spending.Postings[0].Currency, "New cash accounts should use the home currency")
+}
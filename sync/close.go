@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/journal"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	closedDateFormat = "2006-01-02"
+	defaultCurrency  = "$"
+)
+
+// ResidualBalanceError is returned when closing an account with a nonzero balance and no write-off account
+type ResidualBalanceError struct {
+	Account  string
+	Residual decimal.Decimal
+	Currency string
+	// Format renders the residual in the account's currency
+	Format model.CurrencyFormat
+}
+
+func (e ResidualBalanceError) Error() string {
+	return fmt.Sprintf("Account %q has a residual balance of %s%s on its closure date. Provide a write-off category to balance it", e.Account, e.Format.Symbol, e.Format.Fixed(e.Residual))
+}
+
+// CloseAccount marks account 'id' closed on 'date', after verifying its ledger balance is zero on that date.
+// If 'writeOffTo' is set, a nonzero balance is first cleared with a transaction against the 'writeOffTo' account.
+// Future syncs and imports reject the account's transactions dated after closure.
+func CloseAccount(ldgStore *ledger.Store, accountStore *client.AccountStore, journalStore *journal.Store, id string, date time.Time, writeOffTo string) error {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("Account not found by ID: %q", id)
+	}
+	closer, ok := account.(model.Closer)
+	if !ok {
+		return errors.Errorf("Account does not support closing: %q", account.Description())
+	}
+	if closed := closer.ClosedDate(); closed != nil {
+		return errors.Errorf("Account %q is already closed as of %s", account.Description(), closed.Format(closedDateFormat))
+	}
+
+	writeOff, err := closingTransaction(ldgStore.Ledger, account, date, writeOffTo)
+	if err != nil {
+		return err
+	}
+	var residual decimal.Decimal
+	if writeOff != nil {
+		residual = writeOff.Postings[1].Amount
+		if err := ldgStore.AddTransactions([]ledger.Transaction{*writeOff}); err != nil {
+			return errors.Wrap(err, "Failed to record write-off transaction")
+		}
+		if _, err := closingTransaction(ldgStore.Ledger, account, date, ""); err != nil {
+			return err
+		}
+	}
+
+	closer.SetClosedDate(&date)
+	if err := accountStore.Update(id, account); err != nil {
+		return err
+	}
+	details := map[string]string{"date": date.Format(closedDateFormat)}
+	if writeOff != nil {
+		details["writeOffTo"] = writeOffTo
+		details["residual"] = residual.String()
+	}
+	_, err = journalStore.Record(time.Now(), journal.AccountClosed, id, details)
+	return err
+}
+
+// ReopenAccount clears account 'id's closed state, allowing new transactions after its old closure date
+func ReopenAccount(accountStore *client.AccountStore, journalStore *journal.Store, id string) error {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("Account not found by ID: %q", id)
+	}
+	closer, ok := account.(model.Closer)
+	if !ok || closer.ClosedDate() == nil {
+		return errors.Errorf("Account is not closed: %q", account.Description())
+	}
+	closed := *closer.ClosedDate()
+	closer.SetClosedDate(nil)
+	if err := accountStore.Update(id, account); err != nil {
+		return err
+	}
+	_, err = journalStore.Record(time.Now(), journal.AccountReopened, id, map[string]string{
+		"closed": closed.Format(closedDateFormat),
+	})
+	return err
+}
+
+// closingTransaction returns the transaction clearing account's residual balance on 'date', or nil if it is already zero.
+// Returns a ResidualBalanceError if the balance is nonzero and 'writeOffTo' is empty. Otherwise 'writeOffTo' must be an expense or revenue account.
+func closingTransaction(ldg *ledger.Ledger, account model.Account, date time.Time, writeOffTo string) (*ledger.Transaction, error) {
+	name := model.LedgerAccountName(account)
+	if last := ldg.LastPostingTime(name); !last.Before(date.AddDate(0, 0, 1)) {
+		return nil, errors.Errorf("Account %q has transactions after its closure date, the latest on %s", account.Description(), last.Format(closedDateFormat))
+	}
+	residual := ldg.BalancesAsOf(date)[name]
+	if residual.IsZero() {
+		return nil, nil
+	}
+	currency := ldg.AccountCurrencies()[name]
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	if writeOffTo == "" {
+		return nil, ResidualBalanceError{
+			Account:  account.Description(),
+			Residual: residual,
+			Currency: currency,
+			Format:   model.ResolveCurrencyFormat(account, currency, model.NewCurrencyFormat(model.DefaultCurrencyCode)),
+		}
+	}
+	if writeOffTo == name {
+		return nil, errors.New("Write-off category must be a different account")
+	}
+	if err := ledger.ValidateCategory(writeOffTo); err != nil {
+		return nil, err
+	}
+	writeOffTo = ledger.NormalizeAccountName(writeOffTo)
+	if accountType := ldg.AccountType(writeOffTo); accountType != ledger.ExpenseType && accountType != ledger.RevenueType {
+		return nil, errors.Errorf("Write-off category must be an expense or revenue account: %q", writeOffTo)
+	}
+	return &ledger.Transaction{
+		Date:  date,
+		Payee: "Closed account: " + account.Description(),
+		Postings: []ledger.Posting{
+			{
+				Account:  name,
+				Amount:   residual.Neg(),
+				Currency: currency,
+				Tags:     map[string]string{"id": fmt.Sprintf("close-%s-%s", account.ID(), date.Format(closedDateFormat))},
+			},
+			{Account: writeOffTo, Amount: residual, Currency: currency},
+		},
+	}, nil
+}
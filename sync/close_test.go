@@ -0,0 +1,141 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/journal"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClosingTransaction(t *testing.T) {
+	account := &model.BasicAccount{
+		AccountID:          "1234",
+		AccountDescription: "old card",
+		AccountType:        model.LiabilityAccount,
+		BasicInstitution:   model.BasicInstitution{InstDescription: "some org"},
+	}
+	name := model.LedgerAccountName(account)
+	closeDate := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	makeTxn := func(date time.Time, amount int64) ledger.Transaction {
+		return ledger.Transaction{
+			Date:  date,
+			Payee: "some payee",
+			Postings: []ledger.Posting{
+				{Account: name, Amount: decimal.New(amount, 0), Currency: "$"},
+				{Account: "expenses:shopping", Amount: decimal.New(-amount, 0), Currency: "$"},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		description string
+		txns        []ledger.Transaction
+		writeOffTo  string
+		expectTxn   *ledger.Transaction
+		expectErr   string
+	}{
+		{
+			description: "zero balance",
+			txns: []ledger.Transaction{
+				makeTxn(closeDate.AddDate(0, 0, -2), -10),
+				makeTxn(closeDate, 10),
+			},
+		},
+		{
+			description: "residual without write-off",
+			txns:        []ledger.Transaction{makeTxn(closeDate.AddDate(0, 0, -2), -10)},
+			expectErr:   `Account "old card" has a residual balance of $-10.00 on its closure date. Provide a write-off category to balance it`,
+		},
+		{
+			description: "residual with write-off",
+			txns:        []ledger.Transaction{makeTxn(closeDate.AddDate(0, 0, -2), -10)},
+			writeOffTo:  "expenses:fees",
+			expectTxn: &ledger.Transaction{
+				Date:  closeDate,
+				Payee: "Closed account: old card",
+				Postings: []ledger.Posting{
+					{Account: name, Amount: decimal.New(10, 0), Currency: "$", Tags: map[string]string{"id": "close-1234-2020-02-01"}},
+					{Account: "expenses:fees", Amount: decimal.New(-10, 0), Currency: "$"},
+				},
+			},
+		},
+		{
+			description: "write-off to the same account",
+			txns:        []ledger.Transaction{makeTxn(closeDate.AddDate(0, 0, -2), -10)},
+			writeOffTo:  name,
+			expectErr:   "Write-off category must be a different account",
+		},
+		{
+			description: "write-off to a balance account",
+			txns:        []ledger.Transaction{makeTxn(closeDate.AddDate(0, 0, -2), -10)},
+			writeOffTo:  "assets:checking",
+			expectErr:   `Write-off category must be an expense or revenue account: "assets:checking"`,
+		},
+		{
+			description: "write-off with line breaks",
+			txns:        []ledger.Transaction{makeTxn(closeDate.AddDate(0, 0, -2), -10)},
+			writeOffTo:  "expenses:fees\n\n2020/01/06 Injected\n    assets:Bank  $-999",
+			expectErr:   `Category must not contain semicolons, tabs, or line breaks: "expenses:fees\n\n2020/01/06 Injected\n    assets:Bank  $-999"`,
+		},
+		{
+			description: "transactions after closure",
+			txns: []ledger.Transaction{
+				makeTxn(closeDate.AddDate(0, 0, -2), -10),
+				makeTxn(closeDate.AddDate(0, 0, 1), 10),
+			},
+			expectErr: `Account "old card" has transactions after its closure date, the latest on 2020-02-02`,
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			ldg, err := ledger.New(tc.txns)
+			require.NoError(t, err)
+			txn, err := closingTransaction(ldg, account, closeDate, tc.writeOffTo)
+			if tc.expectErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectTxn, txn)
+		})
+	}
+}
+
+func TestReopenAccount(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	accountStore, err := client.NewAccountStore(db)
+	require.NoError(t, err)
+	journalStore, err := journal.NewStore(db)
+	require.NoError(t, err)
+	closed := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, accountStore.Add(&model.BasicAccount{
+		AccountID:          "1",
+		AccountDescription: "old card",
+		Closed:             &closed,
+	}))
+
+	require.NoError(t, ReopenAccount(accountStore, journalStore, "1"))
+	var account model.Account
+	_, err = accountStore.Get("1", &account)
+	require.NoError(t, err)
+	assert.Nil(t, model.ClosedDate(account))
+
+	entries, err := journalStore.Entries("1")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, journal.AccountReopened, entries[0].Action)
+	assert.Equal(t, map[string]string{"closed": "2020-02-01"}, entries[0].Details)
+
+	err = ReopenAccount(accountStore, journalStore, "1")
+	require.Error(t, err)
+	assert.Equal(t, `Account is not closed: "old card"`, err.Error())
+}
@@ -0,0 +1,265 @@
+package sync
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DiscoveryEvent is the webhook event name for account discovery checks which found differences
+const DiscoveryEvent = "accountDiscovery"
+
+// DiscoveredAccount is an account an institution newly reported, or a stored account it stopped reporting
+type DiscoveredAccount struct {
+	ID          string
+	Description string
+	Type        string
+}
+
+// Discovery is the outcome of an account discovery check, which compares an institution login's reported accounts to the stored ones
+type Discovery struct {
+	Institution string
+	Time        time.Time
+	// New are reported accounts which aren't stored yet. Add them with AdoptDiscoveredAccount.
+	New []DiscoveredAccount `json:",omitempty"`
+	// Missing are stored accounts the institution no longer reports, which may have been closed or replaced
+	Missing []DiscoveredAccount `json:",omitempty"`
+	Error   string              `json:",omitempty"`
+	// Unsupported is set if the institution doesn't support account info requests. Scheduled checks skip it from then on.
+	Unsupported bool `json:",omitempty"`
+}
+
+// Redacted returns a copy of d with account numbers redacted, for sending outside Sage
+func (d Discovery) Redacted() Discovery {
+	redact := func(accounts []DiscoveredAccount) []DiscoveredAccount {
+		var redacted []DiscoveredAccount
+		for _, account := range accounts {
+			account.ID = model.RedactPrefix(account.ID)
+			redacted = append(redacted, account)
+		}
+		return redacted
+	}
+	d.New = redact(d.New)
+	d.Missing = redact(d.Missing)
+	return d
+}
+
+// HasChanges returns true if the check found new or missing accounts
+func (d Discovery) HasChanges() bool {
+	return len(d.New) > 0 || len(d.Missing) > 0
+}
+
+func discoveredAccount(account model.Account) DiscoveredAccount {
+	return DiscoveredAccount{
+		ID:          account.ID(),
+		Description: account.Description(),
+		Type:        account.Type(),
+	}
+}
+
+// DiscoverDue checks each institution login whose discovery interval has elapsed since its last check.
+// Locked out institutions and those without account info support are skipped. Failed checks also wait a full interval, so outages aren't retried on every round.
+// 'notify' is called with each check which found new or missing accounts.
+func (p *Prober) DiscoverDue(accountStore *client.AccountStore, logger *zap.Logger, notify func(Discovery)) error {
+	groups, err := probeGroups(accountStore)
+	if err != nil {
+		return err
+	}
+	now := p.now()
+	var errs []string
+	for _, group := range groups {
+		config := group.connector.Config()
+		interval := config.AccountDiscoveryInterval()
+		if interval == 0 || config.AccountInfoUnsupported || p.lockedOut(group.key) {
+			continue
+		}
+		if last := config.LastAccountDiscovery; last != nil && now.Sub(*last) < interval {
+			continue
+		}
+		discovery, err := p.discover(accountStore, group, logger)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		if discovery.HasChanges() {
+			notify(discovery)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("Failed to record account discovery checks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// DiscoverAccount immediately checks the institution login for account 'id', even if it was marked unsupported
+func (p *Prober) DiscoverAccount(accountStore *client.AccountStore, id string, logger *zap.Logger) (Discovery, error) {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return Discovery{}, err
+	}
+	if !found {
+		return Discovery{}, errors.Errorf("Account not found by ID: %q", id)
+	}
+	connector, isDirect := account.Institution().(direct.Connector)
+	if !isDirect {
+		return Discovery{}, errors.Errorf("Account discovery is only supported for direct connect accounts: %q", account.Description())
+	}
+	groups, err := probeGroups(accountStore)
+	if err != nil {
+		return Discovery{}, err
+	}
+	key := connectorKey(connector)
+	for _, group := range groups {
+		if group.key == key {
+			return p.discover(accountStore, group, logger)
+		}
+	}
+	return Discovery{}, errors.Errorf("Account discovery is only supported for active accounts: %q", account.Description())
+}
+
+// Discoveries returns the most recent discovery check for each institution login, newest first
+func (p *Prober) Discoveries() []Discovery {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	discoveries := make([]Discovery, 0, len(p.discoveries))
+	for _, discovery := range p.discoveries {
+		discoveries = append(discoveries, discovery)
+	}
+	sort.Slice(discoveries, func(a, b int) bool {
+		return discoveries[a].Time.After(discoveries[b].Time)
+	})
+	return discoveries
+}
+
+// AdoptDiscoveredAccount adds the account 'id' reported as new by the latest discovery checks. It shares its institution login with the accounts already stored.
+func (p *Prober) AdoptDiscoveredAccount(accountStore *client.AccountStore, id string) (model.Account, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var matchKey string
+	var match model.Account
+	for key, accounts := range p.discovered {
+		for _, account := range accounts {
+			if account.ID() != id {
+				continue
+			}
+			if match != nil {
+				return nil, errors.Errorf("Account ID was reported by more than one institution: %q", id)
+			}
+			matchKey, match = key, account
+		}
+	}
+	if match == nil {
+		return nil, errors.Errorf("Account not found in the latest discovery checks: %q", id)
+	}
+	if err := accountStore.Add(match); err != nil {
+		return nil, err
+	}
+
+	var remaining []model.Account
+	for _, account := range p.discovered[matchKey] {
+		if account.ID() != id {
+			remaining = append(remaining, account)
+		}
+	}
+	p.discovered[matchKey] = remaining
+	discovery := p.discoveries[matchKey]
+	var newAccounts []DiscoveredAccount
+	for _, account := range discovery.New {
+		if account.ID != id {
+			newAccounts = append(newAccounts, account)
+		}
+	}
+	discovery.New = newAccounts
+	p.discoveries[matchKey] = discovery
+	return match, nil
+}
+
+// discover fetches the accounts 'group' can access and records the check
+func (p *Prober) discover(accountStore *client.AccountStore, group probeGroup, logger *zap.Logger) (Discovery, error) {
+	reported, fetchErr := p.fetchAccounts(group.connector, logger)
+	return p.recordDiscovery(accountStore, group, reported, fetchErr)
+}
+
+// recordDiscovery compares the 'reported' accounts to the stored accounts, then records the check on 'group's institution
+func (p *Prober) recordDiscovery(accountStore *client.AccountStore, group probeGroup, reported []model.Account, fetchErr error) (Discovery, error) {
+	now := p.now()
+	discovery := Discovery{
+		Institution: group.connector.Description(),
+		Time:        now,
+	}
+	var newAccounts []model.Account
+	if fetchErr != nil {
+		discovery.Error = fetchErr.Error()
+		discovery.Unsupported = errors.Cause(fetchErr) == direct.ErrAccountInfoUnsupported
+	} else {
+		stored := make(map[string]bool)
+		var account model.Account
+		err := accountStore.Iter(&account, func(id string) bool {
+			stored[id] = true
+			return true
+		})
+		if err != nil {
+			return discovery, err
+		}
+		reportedIDs := make(map[string]bool, len(reported))
+		for _, account := range reported {
+			reportedIDs[account.ID()] = true
+			if !stored[account.ID()] {
+				newAccounts = append(newAccounts, account)
+				discovery.New = append(discovery.New, discoveredAccount(account))
+			}
+		}
+		for _, account := range group.accounts {
+			if !reportedIDs[account.ID()] {
+				discovery.Missing = append(discovery.Missing, discoveredAccount(account))
+			}
+		}
+	}
+
+	p.mu.Lock()
+	p.discoveries[group.key] = discovery
+	p.discovered[group.key] = newAccounts
+	p.mu.Unlock()
+
+	update := func(config *direct.Config) {
+		config.LastAccountDiscovery = &now
+		config.AccountInfoUnsupported = discovery.Unsupported
+	}
+	// new accounts share group's connector, so adopting one keeps the updated config
+	config := group.connector.Config()
+	update(&config)
+	group.connector.SetConfig(config)
+	return discovery, updateConnectorConfig(accountStore, group.accounts, update)
+}
+
+// updateConnectorConfig changes the institution config of each of 'accounts'
+func updateConnectorConfig(accountStore *client.AccountStore, accounts []model.Account, update func(config *direct.Config)) error {
+	for _, a := range accounts {
+		// reload the account to avoid overwriting changes made during the request
+		var account model.Account
+		found, err := accountStore.Get(a.ID(), &account)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		connector, isDirect := account.Institution().(direct.Connector)
+		if !isDirect {
+			continue
+		}
+		config := connector.Config()
+		update(&config)
+		connector.SetConfig(config)
+		if err := accountStore.Update(account.ID(), account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+func getDiscoveryConfig(t *testing.T, accountStore *client.AccountStore, id string) direct.Config {
+	t.Helper()
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	require.NoError(t, err)
+	require.True(t, found)
+	return account.Institution().(direct.Connector).Config()
+}
+
+func TestDiscoverDue(t *testing.T) {
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	newConnector := func(username string, discoveryDays int) direct.Connector {
+		return direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", username, "password", direct.Config{AccountDiscoveryDays: discoveryDays})
+	}
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	connector := newConnector("user", 30)
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("1", "old card", connector)))
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("2", "kept card", connector)))
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("3", "disabled card", newConnector("disabled", 0))))
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("4", "unsupported card", newConnector("unsupported", 30))))
+
+	prober := newProber(nil, func() time.Time { return now })
+	var fetched []string
+	prober.fetchAccounts = func(connector direct.Connector, logger *zap.Logger) ([]model.Account, error) {
+		fetched = append(fetched, connector.Username())
+		if connector.Username() == "unsupported" {
+			return nil, errors.Wrap(direct.ErrAccountInfoUnsupported, "Failed to fetch accounts")
+		}
+		return []model.Account{
+			direct.NewCreditCard("2", "kept card", connector),
+			direct.NewCreditCard("5", "replacement card", connector),
+		}, nil
+	}
+	var notified []Discovery
+	notify := func(discovery Discovery) {
+		notified = append(notified, discovery)
+	}
+	logger := zaptest.NewLogger(t)
+
+	require.NoError(t, prober.DiscoverDue(accountStore, logger, notify))
+	assert.ElementsMatch(t, []string{"user", "unsupported"}, fetched)
+	require.Len(t, notified, 1)
+	assert.Equal(t, []DiscoveredAccount{{ID: "5", Description: "replacement card", Type: model.LiabilityAccount}}, notified[0].New)
+	assert.Equal(t, []DiscoveredAccount{{ID: "1", Description: "old card", Type: model.LiabilityAccount}}, notified[0].Missing)
+	assert.Equal(t, &now, getDiscoveryConfig(t, accountStore, "1").LastAccountDiscovery)
+	assert.True(t, getDiscoveryConfig(t, accountStore, "4").AccountInfoUnsupported)
+	assert.Len(t, prober.Discoveries(), 2)
+
+	fetched, notified = nil, nil
+	now = now.AddDate(0, 0, 31)
+	require.NoError(t, prober.DiscoverDue(accountStore, logger, notify))
+	assert.Equal(t, []string{"user"}, fetched, "Unsupported institutions should not be checked again")
+
+	fetched = nil
+	require.NoError(t, prober.DiscoverDue(accountStore, logger, notify))
+	assert.Empty(t, fetched, "Checks should not repeat before the interval")
+
+	_, err = prober.AdoptDiscoveredAccount(accountStore, "2")
+	assert.Error(t, err, "Stored accounts should not be adopted")
+	account, err := prober.AdoptDiscoveredAccount(accountStore, "5")
+	require.NoError(t, err)
+	assert.Equal(t, "replacement card", account.Description())
+	assert.Equal(t, &now, getDiscoveryConfig(t, accountStore, "5").LastAccountDiscovery)
+	for _, discovery := range prober.Discoveries() {
+		assert.Empty(t, discovery.New)
+	}
+	_, err = prober.AdoptDiscoveredAccount(accountStore, "5")
+	assert.Error(t, err, "Adopted accounts should no longer be discovered")
+}
+
+func TestDiscoveryRedacted(t *testing.T) {
+	discovery := Discovery{
+		New:     []DiscoveredAccount{{ID: "123456789", Description: "new card"}},
+		Missing: []DiscoveredAccount{{ID: "987654321", Description: "old card"}},
+	}
+	redacted := discovery.Redacted()
+	assert.Equal(t, model.RedactPrefix("123456789"), redacted.New[0].ID)
+	assert.Equal(t, model.RedactPrefix("987654321"), redacted.Missing[0].ID)
+	assert.Equal(t, "123456789", discovery.New[0].ID, "Redacting should not modify the original")
+}
@@ -0,0 +1,103 @@
+package sync
+
+import (
+	sErrors "github.com/johnstarich/sage/errors"
+	"github.com/johnstarich/sage/ledger"
+)
+
+// PartialError indicates a sync finished, but some accounts or transactions failed. Successful changes are still saved.
+type PartialError struct {
+	// Accounts contains descriptions of any accounts which failed to download
+	Accounts []string
+	cause    error
+}
+
+// FatalError indicates a sync failed and no changes were saved
+type FatalError struct {
+	cause error
+}
+
+// Classify returns a PartialError or FatalError for the given sync error, or nil if there's no error.
+// Wrapped errors are classified by their causes.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var partial PartialError
+	var fatal FatalError
+	switch {
+	case sErrors.As(err, &partial), sErrors.As(err, &fatal):
+		return err
+	case ledger.IsPartial(err):
+		return PartialError{Accounts: failedAccounts(err), cause: err}
+	default:
+		return NewFatalError(err)
+	}
+}
+
+// NewFatalError marks err as a fatal sync error
+func NewFatalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return FatalError{cause: err}
+}
+
+// IsFatal returns true if err should halt further syncs until a person intervenes
+func IsFatal(err error) bool {
+	var fatal FatalError
+	return sErrors.As(Classify(err), &fatal)
+}
+
+func failedAccounts(err error) []string {
+	errs, ok := err.(sErrors.Errors)
+	if !ok {
+		errs = sErrors.Errors{err}
+	}
+	var accounts []string
+	for _, e := range errs {
+		var download *downloadErr
+		if sErrors.As(e, &download) {
+			accounts = append(accounts, download.accounts...)
+		}
+	}
+	return accounts
+}
+
+func (p PartialError) Error() string {
+	return p.cause.Error()
+}
+
+// Unwrap returns the original sync error
+func (p PartialError) Unwrap() error {
+	return p.cause
+}
+
+// Partial always returns true
+func (p PartialError) Partial() bool {
+	return true
+}
+
+// Cause returns the original sync error, for compatibility with errors.Cause
+func (p PartialError) Cause() error {
+	return p.cause
+}
+
+func (f FatalError) Error() string {
+	return f.cause.Error()
+}
+
+// Unwrap returns the original sync error
+func (f FatalError) Unwrap() error {
+	return f.cause
+}
+
+// Partial always returns false, even if the original error was partial
+func (f FatalError) Partial() bool {
+	return false
+}
+
+// Cause returns the original sync error, for compatibility with errors.Cause
+func (f FatalError) Cause() error {
+	return f.cause
+}
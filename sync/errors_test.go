@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"testing"
+
+	sErrors "github.com/johnstarich/sage/errors"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func wrapTwice(err error) error {
+	return errors.Wrap(errors.Wrap(err, "layer 1"), "layer 2")
+}
+
+func TestClassify(t *testing.T) {
+	someErr := errors.New("some error")
+	downloadErr := wrapDownloadErr(someErr, []string{"account 1"})
+	for _, tc := range []struct {
+		description    string
+		err            error
+		expectPartial  bool
+		expectFatal    bool
+		expectAccounts []string
+	}{
+		{description: "no error"},
+		{
+			description: "plain error",
+			err:         someErr,
+			expectFatal: true,
+		},
+		{
+			description:   "ledger validation error",
+			err:           wrapTwice(ledger.NewValidateError(1, someErr)),
+			expectPartial: true,
+		},
+		{
+			description:    "download error",
+			err:            wrapTwice(downloadErr),
+			expectPartial:  true,
+			expectAccounts: []string{"account 1"},
+		},
+		{
+			description: "multiple download errors",
+			err: sErrors.Errors{
+				downloadErr,
+				wrapTwice(wrapDownloadErr(someErr, []string{"account 2", "account 3"})),
+			},
+			expectPartial:  true,
+			expectAccounts: []string{"account 1", "account 2", "account 3"},
+		},
+		{
+			description: "download and fatal errors",
+			err:         sErrors.Errors{downloadErr, someErr},
+			expectFatal: true,
+		},
+		{
+			description: "fatal error",
+			err:         wrapTwice(NewFatalError(downloadErr)),
+			expectFatal: true,
+		},
+		{
+			description:    "partial error",
+			err:            wrapTwice(Classify(downloadErr)),
+			expectPartial:  true,
+			expectAccounts: []string{"account 1"},
+		},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			err := Classify(tc.err)
+			assert.Equal(t, tc.expectFatal, IsFatal(tc.err))
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tc.err.Error(), err.Error())
+
+			var partial PartialError
+			var fatal FatalError
+			assert.Equal(t, tc.expectPartial, sErrors.As(err, &partial))
+			assert.Equal(t, tc.expectFatal, sErrors.As(err, &fatal))
+			assert.Equal(t, tc.expectAccounts, partial.Accounts)
+		})
+	}
+}
+
+func TestDownloadErrCause(t *testing.T) {
+	someErr := errors.New("some error")
+	err := wrapTwice(wrapDownloadErr(someErr, []string{"account 1"}))
+	assert.Equal(t, someErr, errors.Cause(err))
+	assert.True(t, ledger.IsPartial(err))
+}
+
+func TestFatalErrorNotPartial(t *testing.T) {
+	err := wrapTwice(NewFatalError(ledger.NewValidateError(1, errors.New("some error"))))
+	assert.False(t, ledger.IsPartial(err))
+	assert.True(t, IsFatal(err))
+}
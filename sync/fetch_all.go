@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"net/url"
+	"strings"
+	gosync "sync"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"go.uber.org/zap"
+)
+
+// maxConcurrentAccountFetches is the most institution hosts to fetch account info from at once
+const maxConcurrentAccountFetches = 4
+
+// ReportedAccounts are the accounts an institution login reported, compared to the stored accounts
+type ReportedAccounts struct {
+	Discovery
+	Accounts []ReportedAccount `json:",omitempty"`
+}
+
+// ReportedAccount is an account an institution reported. Configured is false if it isn't stored yet.
+type ReportedAccount struct {
+	DiscoveredAccount
+	Configured bool
+}
+
+type fetchedAccounts struct {
+	group    probeGroup
+	reported []model.Account
+	err      error
+	skipped  bool
+}
+
+// FetchAllAccounts fetches account info from every active direct connect institution login, grouped by login.
+// Logins sharing an institution host are fetched one at a time, and at most a few hosts are contacted at once.
+// Locked out logins are skipped. Each fetch is recorded as a discovery check, so new accounts can be adopted with AdoptDiscoveredAccount.
+func (p *Prober) FetchAllAccounts(accountStore *client.AccountStore, logger *zap.Logger) ([]ReportedAccounts, error) {
+	groups, err := probeGroups(accountStore)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := make([]fetchedAccounts, len(groups))
+	hosts := make(map[string][]int)
+	var hostOrder []string
+	for i, group := range groups {
+		fetched[i].group = group
+		host := institutionHost(group.connector.URL())
+		if _, exists := hosts[host]; !exists {
+			hostOrder = append(hostOrder, host)
+		}
+		hosts[host] = append(hosts[host], i)
+	}
+
+	limit := make(chan struct{}, maxConcurrentAccountFetches)
+	var wg gosync.WaitGroup
+	for _, host := range hostOrder {
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			for _, i := range indexes {
+				result := &fetched[i]
+				if p.lockedOut(result.group.key) {
+					result.skipped = true
+					continue
+				}
+				result.reported, result.err = p.fetchAccounts(result.group.connector, logger)
+			}
+		}(hosts[host])
+	}
+	wg.Wait()
+
+	// record serially, since recording updates the account store
+	results := make([]ReportedAccounts, 0, len(fetched))
+	for _, result := range fetched {
+		if result.skipped {
+			results = append(results, ReportedAccounts{Discovery: Discovery{
+				Institution: result.group.connector.Description(),
+				Time:        p.now(),
+				Error:       "Skipped, the institution rejected its credentials on the last probe",
+			}})
+			continue
+		}
+		discovery, err := p.recordDiscovery(accountStore, result.group, result.reported, result.err)
+		if err != nil {
+			return nil, err
+		}
+		newIDs := make(map[string]bool, len(discovery.New))
+		for _, account := range discovery.New {
+			newIDs[account.ID] = true
+		}
+		reportedAccounts := ReportedAccounts{Discovery: discovery}
+		for _, account := range result.reported {
+			reportedAccounts.Accounts = append(reportedAccounts.Accounts, ReportedAccount{
+				DiscoveredAccount: discoveredAccount(account),
+				Configured:        !newIDs[account.ID()],
+			})
+		}
+		results = append(results, reportedAccounts)
+	}
+	return results, nil
+}
+
+// institutionHost returns the host of 'urlStr', or the whole URL if it doesn't parse
+func institutionHost(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Host == "" {
+		return urlStr
+	}
+	return strings.ToLower(u.Host)
+}
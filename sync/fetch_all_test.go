@@ -0,0 +1,80 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFetchAllAccounts(t *testing.T) {
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	newConnector := func(url, username string) direct.Connector {
+		return direct.New("Bank "+username, "1234", "some org", url, username, "password", direct.Config{})
+	}
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("1", "card 1", newConnector("https://example.com/ofx", "alice"))))
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("2", "card 2", newConnector("https://EXAMPLE.com/ofx", "bob"))))
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("3", "card 3", newConnector("https://other.example.com/ofx", "carol"))))
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("4", "card 4", newConnector("https://locked.example.com/ofx", "dave"))))
+
+	prober := newProber(func(connector direct.Connector) error {
+		return direct.ErrLockedOut
+	}, func() time.Time { return now })
+	_, err = prober.ProbeAccount(accountStore, "4")
+	require.NoError(t, err)
+
+	var exampleInFlight, maxExampleInFlight atomic.Int32
+	var fetched []string
+	fetchedUsers := make(chan string, 4)
+	prober.fetchAccounts = func(connector direct.Connector, logger *zap.Logger) ([]model.Account, error) {
+		fetchedUsers <- connector.Username()
+		if institutionHost(connector.URL()) == "example.com" {
+			inFlight := exampleInFlight.Inc()
+			defer exampleInFlight.Dec()
+			if inFlight > maxExampleInFlight.Load() {
+				maxExampleInFlight.Store(inFlight)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		accounts := []model.Account{direct.NewCreditCard(map[string]string{"alice": "1", "bob": "2", "carol": "3"}[connector.Username()], "card", connector)}
+		if connector.Username() == "carol" {
+			accounts = append(accounts, direct.NewCreditCard("5", "new card", connector))
+		}
+		return accounts, nil
+	}
+
+	results, err := prober.FetchAllAccounts(accountStore, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	close(fetchedUsers)
+	for user := range fetchedUsers {
+		fetched = append(fetched, user)
+	}
+	assert.ElementsMatch(t, []string{"alice", "bob", "carol"}, fetched, "Locked out logins should not be contacted")
+	assert.Equal(t, int32(1), maxExampleInFlight.Load(), "Logins on the same host should be fetched one at a time")
+
+	require.Len(t, results, 4)
+	byInstitution := make(map[string]ReportedAccounts)
+	for _, result := range results {
+		byInstitution[result.Institution] = result
+	}
+	assert.Equal(t, []ReportedAccount{
+		{DiscoveredAccount: DiscoveredAccount{ID: "3", Description: "card", Type: model.LiabilityAccount}, Configured: true},
+		{DiscoveredAccount: DiscoveredAccount{ID: "5", Description: "new card", Type: model.LiabilityAccount}, Configured: false},
+	}, byInstitution["Bank carol"].Accounts)
+	assert.Equal(t, []DiscoveredAccount{{ID: "5", Description: "new card", Type: model.LiabilityAccount}}, byInstitution["Bank carol"].New)
+	assert.NotEmpty(t, byInstitution["Bank dave"].Error)
+	assert.Empty(t, byInstitution["Bank dave"].Accounts)
+
+	_, err = prober.AdoptDiscoveredAccount(accountStore, "5")
+	assert.NoError(t, err, "Fetched accounts should be adoptable")
+}
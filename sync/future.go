@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+)
+
+const (
+	// DefaultFutureTolerance is how far past today a downloaded transaction may be dated before it's deferred
+	DefaultFutureTolerance = 24 * time.Hour
+
+	// FutureDeferredReason is the sync summary note for accounts with deferred transactions
+	FutureDeferredReason = "future-dated, deferred"
+
+	// ClaimedDateTag records an institution's original date on transactions clamped to the import date
+	ClaimedDateTag = "claimed_date"
+)
+
+// SetFutureDates changes how far past today a transaction may be dated before it's deferred to a later sync.
+// If 'importNow' is true, future-dated transactions are imported immediately with their date clamped to today, instead of deferred.
+func (g *Guard) SetFutureDates(tolerance time.Duration, importNow bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.futureTolerance = tolerance
+	g.importFuture = importNow
+}
+
+// deferFuture removes transactions dated beyond today plus the guard's tolerance, usually caused by an institution's clock bug.
+// Returns the remaining transactions and the deferred ones. If the guard imports future dates, they're clamped to today and tagged with their original date instead.
+// Balance assertions are never clamped, since they'd assert a balance on the wrong date.
+func (r *guardRun) deferFuture(txns []ledger.Transaction) (kept, deferred []ledger.Transaction) {
+	if r == nil {
+		return txns, nil
+	}
+	r.guard.mu.RLock()
+	tolerance, importNow := r.guard.futureTolerance, r.guard.importFuture
+	r.guard.mu.RUnlock()
+
+	now := r.guard.now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	limit := today.Add(tolerance)
+	kept = make([]ledger.Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if !txn.Date.After(limit) {
+			kept = append(kept, txn)
+			continue
+		}
+		if !importNow || ledger.IsBalanceAssertion(txn) {
+			deferred = append(deferred, txn)
+			continue
+		}
+		tags := make(map[string]string, len(txn.Tags)+1)
+		for key, value := range txn.Tags {
+			tags[key] = value
+		}
+		tags[ClaimedDateTag] = txn.Date.Format(ledger.DateFormat)
+		txn.Tags = tags
+		txn.Date = today
+		kept = append(kept, txn)
+	}
+	return kept, deferred
+}
+
+// deferFuture holds back future-dated transactions from 'accounts' until a later sync, recording them in 'run' and keeping 'marks' from advancing past them
+func deferFuture(guard *guardRun, marks *bookmarks, run *auditRun, accounts []model.Account, txns []ledger.Transaction) []ledger.Transaction {
+	txns, deferred := guard.deferFuture(txns)
+	if len(deferred) > 0 {
+		marks.holdBack(accounts, deferred)
+		run.recordDeferred(deferred)
+	}
+	return txns
+}
@@ -0,0 +1,389 @@
+package sync
+
+import (
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/journal"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/quarantine"
+	"github.com/johnstarich/sage/rules"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// DefaultGuardMultiple is how many times larger than an account's norm a batch must be to quarantine it
+	DefaultGuardMultiple = 10
+
+	// QuarantinedReason is the sync result for accounts with a held batch
+	QuarantinedReason = "quarantined: unusually large batch"
+
+	// guardMinTransactions avoids holding small batches for accounts which rarely have new transactions
+	guardMinTransactions = 20
+	// normWindow is the number of recent syncs an account's norm averages over
+	normWindow = 20
+)
+
+// Guard holds unusually large batches of new transactions and transactions which fail validation out of the ledger until they're approved
+type Guard struct {
+	store    *quarantine.Store
+	journal  *journal.Store
+	now      func() time.Time
+	mu       gosync.RWMutex
+	multiple decimal.Decimal
+	// futureTolerance is how far past today a transaction may be dated before it's deferred
+	futureTolerance time.Duration
+	// importFuture clamps future-dated transactions to today instead of deferring them
+	importFuture bool
+}
+
+// NewGuard returns a Guard which quarantines an account's batch when it is more than 'multiple' times the account's norm
+func NewGuard(store *quarantine.Store, journalStore *journal.Store, multiple float64) *Guard {
+	return &Guard{
+		store:           store,
+		journal:         journalStore,
+		multiple:        decimal.NewFromFloat(multiple),
+		futureTolerance: DefaultFutureTolerance,
+		now:             time.Now,
+	}
+}
+
+// SetMultiple changes how many times larger than an account's norm a batch must be to quarantine it. 0 stops quarantining new batches.
+func (g *Guard) SetMultiple(multiple float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.multiple = decimal.NewFromFloat(multiple)
+}
+
+// Batches returns all quarantined batches, oldest first
+func (g *Guard) Batches() ([]quarantine.Batch, error) {
+	return g.store.Batches()
+}
+
+// Approve imports the quarantined batch 'id' into the ledger, applying rules and skipping duplicates like a normal sync
+func (g *Guard) Approve(ldgStore *ledger.Store, rulesStore *rules.Store, id string) (quarantine.Batch, error) {
+	batch, err := g.store.Remove(id)
+	if err != nil {
+		return batch, err
+	}
+	txns, assertions := ledger.SplitBalanceAssertions(batch.Transactions)
+	applyRules(ldgStore, rulesStore, nil)(txns)
+	if err := ldgStore.AddTransactions(append(txns, assertions...)); err != nil {
+		// put the batch back, so it isn't lost
+		if _, holdErr := g.store.Hold(batch); holdErr != nil {
+			return batch, errors.Wrap(holdErr, err.Error())
+		}
+		return batch, err
+	}
+	return batch, g.record(journal.BatchApproved, batch)
+}
+
+// Discard drops the quarantined batch 'id'
+func (g *Guard) Discard(id string) (quarantine.Batch, error) {
+	batch, err := g.store.Remove(id)
+	if err != nil {
+		return batch, err
+	}
+	return batch, g.record(journal.BatchDiscarded, batch)
+}
+
+func (g *Guard) record(action string, batch quarantine.Batch) error {
+	_, err := g.journal.Record(g.now(), action, batch.AccountID, map[string]string{
+		"account": batch.Account,
+		"count":   fmt.Sprintf("%d", batch.Count),
+		"amount":  batch.Amount.String(),
+	})
+	return err
+}
+
+// FailedTransactions returns all quarantined transactions which failed validation, oldest first
+func (g *Guard) FailedTransactions() ([]quarantine.Failed, error) {
+	return g.store.FailedTransactions()
+}
+
+// HoldFailed quarantines each of 'rejected'. Returns a FailedTransactionsError if any were held.
+func (g *Guard) HoldFailed(rejected []ledger.Rejection) error {
+	if len(rejected) == 0 {
+		return nil
+	}
+	now := g.now()
+	for _, rejection := range rejected {
+		_, err := g.store.HoldFailed(quarantine.Failed{
+			Time:        now,
+			Reason:      rejection.Reason,
+			Transaction: rejection.Transaction,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return FailedTransactionsError{Count: len(rejected)}
+}
+
+// ReleaseFailed adds the quarantined failed transaction 'id' to the ledger.
+// If 'fixed' is non-nil, it replaces the quarantined transaction as-is. Otherwise, rules are applied to the quarantined transaction like a normal sync.
+func (g *Guard) ReleaseFailed(ldgStore *ledger.Store, rulesStore *rules.Store, id string, fixed *ledger.Transaction) (quarantine.Failed, error) {
+	failed, err := g.store.GetFailed(id)
+	if err != nil {
+		return failed, err
+	}
+	txns := []ledger.Transaction{failed.Transaction}
+	if fixed != nil {
+		txns[0] = *fixed
+	} else {
+		applyRules(ldgStore, rulesStore, nil)(txns)
+	}
+	if err := ledger.ScreenTransaction(txns[0]); err != nil {
+		return failed, errors.Wrap(err, "Transaction still fails validation")
+	}
+	if err := ldgStore.AddTransactions(txns); err != nil {
+		return failed, err
+	}
+	if _, err := g.store.RemoveFailed(id); err != nil {
+		return failed, err
+	}
+	return failed, g.recordFailed(journal.FailedReleased, failed)
+}
+
+// DiscardFailed drops the quarantined failed transaction 'id'
+func (g *Guard) DiscardFailed(id string) (quarantine.Failed, error) {
+	failed, err := g.store.RemoveFailed(id)
+	if err != nil {
+		return failed, err
+	}
+	return failed, g.recordFailed(journal.FailedDiscarded, failed)
+}
+
+func (g *Guard) recordFailed(action string, failed quarantine.Failed) error {
+	var account string
+	if len(failed.Transaction.Postings) > 0 {
+		account = failed.Transaction.Postings[0].Account
+	}
+	_, err := g.journal.Record(g.now(), action, account, map[string]string{
+		"id":     failed.ID,
+		"payee":  failed.Transaction.Payee,
+		"reason": failed.Reason,
+	})
+	return err
+}
+
+// exceeds returns true if a batch of 'count' new transactions totaling 'amount' is unusually large for 'norm'
+func (g *Guard) exceeds(norm quarantine.Norm, count int, amount decimal.Decimal) bool {
+	g.mu.RLock()
+	multiple := g.multiple
+	g.mu.RUnlock()
+	if !multiple.IsPositive() || norm.Syncs == 0 || count < guardMinTransactions {
+		// disabled, first-ever sync, or too small to matter
+		return false
+	}
+	normCount := decimal.NewFromFloat(norm.Count)
+	if normCount.LessThan(decimal.New(1, 0)) {
+		normCount = decimal.New(1, 0)
+	}
+	if decimal.New(int64(count), 0).GreaterThan(normCount.Mul(multiple)) {
+		return true
+	}
+	return norm.Amount.IsPositive() && amount.GreaterThan(norm.Amount.Mul(multiple))
+}
+
+// QuarantinedError is returned for each account with a quarantined batch
+type QuarantinedError struct {
+	AccountID string
+	Account   string
+	BatchID   string
+	Count     int
+}
+
+func (e QuarantinedError) Error() string {
+	return fmt.Sprintf("Account %q %s of %d new transactions. Approve or discard batch %q", e.Account, QuarantinedReason, e.Count, e.BatchID)
+}
+
+// Partial always returns true, since other accounts' transactions are still imported
+func (e QuarantinedError) Partial() bool {
+	return true
+}
+
+// FailedTransactionsError is returned when transactions which fail validation are quarantined
+type FailedTransactionsError struct {
+	Count int
+}
+
+func (e FailedTransactionsError) Error() string {
+	return fmt.Sprintf("Quarantined %d transactions which failed validation. Fix and release or discard them from the quarantine", e.Count)
+}
+
+// Partial always returns true, since the remaining transactions are still imported
+func (e FailedTransactionsError) Partial() bool {
+	return true
+}
+
+// guardRun checks each account's new transactions during a single sync
+type guardRun struct {
+	guard *Guard
+	isNew func(ledger.Transaction) bool
+	// skip contains account IDs which are backfilling, and shouldn't be compared to their norm
+	skip map[string]bool
+	// screenOnly disables holding large batches, only failed transactions are quarantined
+	screenOnly bool
+
+	mu     gosync.Mutex
+	totals map[string]*batchTotal
+}
+
+type batchTotal struct {
+	count  int
+	amount decimal.Decimal
+}
+
+// newRun returns a guardRun for a single sync. Returns nil if g is nil, which disables the guard.
+func (g *Guard) newRun(isNew func(ledger.Transaction) bool, skip map[string]bool) *guardRun {
+	if g == nil {
+		return nil
+	}
+	return &guardRun{
+		guard:  g,
+		isNew:  isNew,
+		skip:   skip,
+		totals: make(map[string]*batchTotal),
+	}
+}
+
+// newScreenRun returns a guardRun which only quarantines failed transactions, for syncs which shouldn't be compared to account norms. Returns nil if g is nil.
+func (g *Guard) newScreenRun() *guardRun {
+	run := g.newRun(nil, nil)
+	if run != nil {
+		run.screenOnly = true
+	}
+	return run
+}
+
+// screen quarantines transactions in 'txns' which would fail ledger validation or don't belong to any of 'accounts', returning the remaining transactions
+func (r *guardRun) screen(accounts []model.Account, txns []ledger.Transaction) ([]ledger.Transaction, error) {
+	if r == nil {
+		return txns, nil
+	}
+	names := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		names[model.LedgerAccountName(account)] = true
+	}
+	txns, rejected := ledger.ScreenTransactions(txns)
+	kept := make([]ledger.Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if account := txn.Postings[0].Account; !names[account] {
+			rejected = append(rejected, ledger.Rejection{Transaction: txn, Reason: fmt.Sprintf("No matching account found for %q", account)})
+			continue
+		}
+		kept = append(kept, txn)
+	}
+	return kept, r.guard.HoldFailed(rejected)
+}
+
+// hold quarantines any unusually large batches in 'txns' for 'accounts', returning the remaining transactions and an error for each held batch.
+// Should only be called for successful downloads, since every non-backfilling account's result counts toward its norm.
+func (r *guardRun) hold(accounts []model.Account, txns []ledger.Transaction) ([]ledger.Transaction, []error) {
+	if r == nil || r.screenOnly {
+		return txns, nil
+	}
+	byName := make(map[string]model.Account, len(accounts))
+	for _, account := range accounts {
+		byName[model.LedgerAccountName(account)] = account
+	}
+	grouped := make(map[string][]ledger.Transaction)
+	totals := make(map[string]*batchTotal)
+	for _, txn := range txns {
+		if len(txn.Postings) == 0 {
+			continue
+		}
+		account, ok := byName[txn.Postings[0].Account]
+		if !ok {
+			continue
+		}
+		id := account.ID()
+		grouped[id] = append(grouped[id], txn)
+		if ledger.IsBalanceAssertion(txn) || !r.isNew(txn) {
+			continue
+		}
+		if totals[id] == nil {
+			totals[id] = &batchTotal{}
+		}
+		totals[id].count++
+		totals[id].amount = totals[id].amount.Add(txn.Postings[0].Amount.Abs())
+	}
+
+	held := make(map[string]bool)
+	var errs []error
+	for _, account := range accounts {
+		id := account.ID()
+		if r.skip[id] {
+			// backfills don't reflect a typical sync, so they're neither checked nor added to the norm
+			continue
+		}
+		total := totals[id]
+		if total == nil {
+			total = &batchTotal{}
+		}
+		norm, err := r.guard.store.Norm(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if r.guard.exceeds(norm, total.count, total.amount) {
+			batch, err := r.guard.store.Hold(quarantine.Batch{
+				AccountID:    id,
+				Account:      model.LedgerAccountName(account),
+				Description:  account.Description(),
+				Time:         r.guard.now(),
+				Reason:       QuarantinedReason,
+				Count:        total.count,
+				Amount:       total.amount,
+				Transactions: grouped[id],
+			})
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			held[id] = true
+			errs = append(errs, QuarantinedError{AccountID: id, Account: account.Description(), BatchID: batch.ID, Count: total.count})
+			continue
+		}
+		r.mu.Lock()
+		if r.totals[id] == nil {
+			r.totals[id] = &batchTotal{}
+		}
+		r.totals[id].count += total.count
+		r.totals[id].amount = r.totals[id].amount.Add(total.amount)
+		r.mu.Unlock()
+	}
+	if len(held) == 0 {
+		return txns, errs
+	}
+
+	kept := make([]ledger.Transaction, 0, len(txns))
+	for _, txn := range txns {
+		if len(txn.Postings) > 0 {
+			if account, ok := byName[txn.Postings[0].Account]; ok && held[account.ID()] {
+				continue
+			}
+		}
+		kept = append(kept, txn)
+	}
+	return kept, errs
+}
+
+// save adds this run's accepted batches to each account's norm
+func (r *guardRun) save() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, total := range r.totals {
+		if err := r.guard.store.UpdateNorm(id, total.count, total.amount, normWindow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package sync
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/journal"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/quarantine"
+	"github.com/johnstarich/sage/rules"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newTestGuard(t *testing.T) *Guard {
+	t.Helper()
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	store, err := quarantine.NewStore(db)
+	require.NoError(t, err)
+	journalStore, err := journal.NewStore(db)
+	require.NoError(t, err)
+	guard := NewGuard(store, journalStore, DefaultGuardMultiple)
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	guard.now = func() time.Time { return now }
+	return guard
+}
+
+func makeBatch(account model.Account, count int, amount float64) []ledger.Transaction {
+	txns := make([]ledger.Transaction, 0, count)
+	for i := 0; i < count; i++ {
+		txns = append(txns, ledger.Transaction{
+			Payee: "some payee",
+			Postings: []ledger.Posting{
+				{Account: model.LedgerAccountName(account), Amount: decimal.NewFromFloat(-amount), Tags: map[string]string{"id": fmt.Sprintf("%s-%d", account.ID(), i)}},
+				{Account: model.Uncategorized, Amount: decimal.NewFromFloat(amount)},
+			},
+		})
+	}
+	return txns
+}
+
+func TestGuardHold(t *testing.T) {
+	guard := newTestGuard(t)
+	connector := direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", "user", "password", direct.Config{})
+	card := direct.NewCreditCard("1", "some card", connector)
+	other := direct.NewCreditCard("2", "other card", connector)
+	backfill := direct.NewCreditCard("3", "backfill card", connector)
+	accounts := []model.Account{card, other, backfill}
+	isNew := func(ledger.Transaction) bool { return true }
+	skip := map[string]bool{"3": true}
+
+	run := guard.newRun(isNew, skip)
+	txns := append(makeBatch(card, 25, 1), makeBatch(backfill, 100, 1)...)
+	kept, errs := run.hold(accounts, txns)
+	assert.Empty(t, errs, "First-ever syncs should not be held")
+	assert.Len(t, kept, 125)
+	require.NoError(t, run.save())
+
+	run = guard.newRun(isNew, skip)
+	txns = append(makeBatch(card, 300, 1), makeBatch(other, 1, 1000)...)
+	txns = append(txns, makeBatch(backfill, 1000, 1)...)
+	kept, errs = run.hold(accounts, txns)
+	require.Len(t, errs, 1)
+	quarantined, ok := errs[0].(QuarantinedError)
+	require.True(t, ok)
+	assert.Equal(t, "1", quarantined.AccountID)
+	assert.Equal(t, 300, quarantined.Count)
+	assert.True(t, quarantined.Partial())
+	assert.Len(t, kept, 1001, "Backfills and other accounts should be kept")
+
+	batches, err := guard.Batches()
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	assert.Equal(t, quarantined.BatchID, batches[0].ID)
+	assert.Equal(t, QuarantinedReason, batches[0].Reason)
+	assert.Equal(t, "300", batches[0].Amount.String())
+	assert.Len(t, batches[0].Transactions, 300)
+	require.NoError(t, run.save())
+
+	norm, err := guard.store.Norm("1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, norm.Syncs, "Held batches should not change the norm")
+	norm, err = guard.store.Norm("3")
+	require.NoError(t, err)
+	assert.Equal(t, 0, norm.Syncs, "Backfills should not change the norm")
+
+	var noRun *guardRun
+	kept, errs = noRun.hold(accounts, txns)
+	assert.Empty(t, errs)
+	assert.Equal(t, txns, kept)
+}
+
+func TestGuardExceeds(t *testing.T) {
+	guard := newTestGuard(t)
+	norm := quarantine.Norm{Syncs: 5, Count: 3, Amount: decimal.NewFromFloat(100)}
+	assert.False(t, guard.exceeds(quarantine.Norm{}, 1000, decimal.Zero), "First sync should never exceed")
+	assert.False(t, guard.exceeds(norm, guardMinTransactions-1, decimal.NewFromFloat(5000)), "Small batches should never exceed")
+	assert.False(t, guard.exceeds(norm, 30, decimal.NewFromFloat(1000)))
+	assert.True(t, guard.exceeds(norm, 31, decimal.NewFromFloat(1000)))
+	assert.True(t, guard.exceeds(norm, 30, decimal.NewFromFloat(1000.01)))
+
+	guard.SetMultiple(20)
+	assert.False(t, guard.exceeds(norm, 31, decimal.NewFromFloat(1000)))
+	guard.SetMultiple(0)
+	assert.False(t, guard.exceeds(norm, 1000, decimal.NewFromFloat(100000)), "Disabled guard should never exceed")
+}
+
+func TestGuardDiscard(t *testing.T) {
+	guard := newTestGuard(t)
+	batch, err := guard.store.Hold(quarantine.Batch{AccountID: "1", Account: "liabilities:some org:****1", Count: 2, Amount: decimal.NewFromFloat(10)})
+	require.NoError(t, err)
+
+	_, err = guard.Discard(batch.ID)
+	require.NoError(t, err)
+	batches, err := guard.Batches()
+	require.NoError(t, err)
+	assert.Empty(t, batches)
+
+	entries, err := guard.journal.Entries("1")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, journal.BatchDiscarded, entries[0].Action)
+	assert.Equal(t, map[string]string{"account": "liabilities:some org:****1", "count": "2", "amount": "10"}, entries[0].Details)
+
+	_, err = guard.Discard(batch.ID)
+	assert.Error(t, err)
+}
+
+func TestGuardScreenRelease(t *testing.T) {
+	guard := newTestGuard(t)
+	connector := direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", "user", "password", direct.Config{})
+	card := direct.NewCreditCard("1", "some card", connector)
+	date := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	txns := makeBatch(card, 3, 1)
+	for i := range txns {
+		txns[i].Date = date
+	}
+	txns[1].Postings[1].Amount = decimal.NewFromFloat(2)
+	txns[2].Postings[0].Account = "liabilities:other org:****9"
+
+	kept, err := guard.newScreenRun().screen([]model.Account{card}, txns)
+	assert.Equal(t, txns[:1], kept)
+	require.Error(t, err)
+	assert.Equal(t, FailedTransactionsError{Count: 2}, err)
+	assert.True(t, ledger.IsPartial(err))
+
+	failed, err := guard.FailedTransactions()
+	require.NoError(t, err)
+	require.Len(t, failed, 2)
+	assert.Contains(t, failed[0].Reason+failed[1].Reason, "not balanced")
+	assert.Contains(t, failed[0].Reason+failed[1].Reason, `No matching account found for "liabilities:other org:****9"`)
+
+	ldgStore, err := ledger.NewStore(&memFile{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	rulesStore := rules.NewStore(nil)
+	var unbalanced, unmatched quarantine.Failed
+	for _, f := range failed {
+		if f.Transaction.Postings[0].ID() == txns[1].Postings[0].ID() {
+			unbalanced = f
+		} else {
+			unmatched = f
+		}
+	}
+
+	_, err = guard.ReleaseFailed(ldgStore, rulesStore, unbalanced.ID, nil)
+	assert.Error(t, err, "Unfixed transactions should stay quarantined")
+	fixed := unbalanced.Transaction
+	fixed.Postings[1].Amount = decimal.NewFromFloat(1)
+	_, err = guard.ReleaseFailed(ldgStore, rulesStore, unbalanced.ID, &fixed)
+	require.NoError(t, err)
+	_, found := ldgStore.Transaction(fixed.Postings[0].ID())
+	assert.True(t, found)
+
+	_, err = guard.DiscardFailed(unmatched.ID)
+	require.NoError(t, err)
+	failed, err = guard.FailedTransactions()
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+
+	entries, err := guard.journal.Entries(model.LedgerAccountName(card))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, journal.FailedReleased, entries[0].Action)
+}
+
+func TestGuardDeferFuture(t *testing.T) {
+	guard := newTestGuard(t)
+	today := guard.now()
+	makeTxn := func(id string, date time.Time) ledger.Transaction {
+		return ledger.Transaction{
+			Date:  date,
+			Payee: id,
+			Postings: []ledger.Posting{
+				{Account: "liabilities:some card", Amount: decimal.NewFromFloat(-1), Tags: map[string]string{"id": id}},
+				{Account: model.Uncategorized, Amount: decimal.NewFromFloat(1)},
+			},
+		}
+	}
+	txns := []ledger.Transaction{
+		makeTxn("today", today),
+		makeTxn("tomorrow", today.AddDate(0, 0, 1)),
+		makeTxn("next week", today.AddDate(0, 0, 7)),
+	}
+
+	var noGuard *guardRun
+	kept, deferred := noGuard.deferFuture(txns)
+	assert.Len(t, kept, 3)
+	assert.Empty(t, deferred)
+
+	kept, deferred = guard.newRun(nil, nil).deferFuture(txns)
+	assert.Equal(t, txns[:2], kept, "Transactions within the tolerance should be kept")
+	assert.Equal(t, txns[2:], deferred)
+
+	guard.SetFutureDates(0, true)
+	kept, deferred = guard.newRun(nil, nil).deferFuture(txns)
+	assert.Empty(t, deferred)
+	require.Len(t, kept, 3)
+	for _, txn := range kept[1:] {
+		assert.Equal(t, today, txn.Date, "Future dates should be clamped to today")
+	}
+	assert.Equal(t, "2020/03/02", kept[1].Tags[ClaimedDateTag])
+	assert.Equal(t, "2020/03/08", kept[2].Tags[ClaimedDateTag])
+	assert.Empty(t, txns[2].Tags, "Original transactions should not be modified")
+	assert.Empty(t, kept[0].Tags[ClaimedDateTag])
+}
@@ -0,0 +1,270 @@
+package sync
+
+import (
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ProbeResult is the outcome of a keepalive probe against an institution. Probes only sign on, they never download statements or change the ledger.
+type ProbeResult struct {
+	Institution string
+	Accounts    []string
+	Time        time.Time
+	Manual      bool   `json:",omitempty"`
+	Error       string `json:",omitempty"`
+	// LockedOut is set when the institution rejected the credentials. Scheduled probes skip the institution until a manual probe succeeds.
+	LockedOut bool `json:",omitempty"`
+}
+
+// Prober sends keepalive probes to direct connect institutions which would otherwise go unused for longer than their keepalive interval
+type Prober struct {
+	mu        gosync.Mutex
+	results   map[string]ProbeResult
+	keepAlive func(direct.Connector) error
+	now       func() time.Time
+
+	// discoveries are the latest account discovery checks, and discovered are their new accounts, both by institution login
+	discoveries   map[string]Discovery
+	discovered    map[string][]model.Account
+	fetchAccounts func(direct.Connector, *zap.Logger) ([]model.Account, error)
+}
+
+// probeGroup contains the accounts sharing a single institution login
+type probeGroup struct {
+	key         string
+	connector   direct.Connector
+	accounts    []model.Account
+	lastContact time.Time
+}
+
+// NewProber returns a Prober which probes institutions with signon-only requests
+func NewProber() *Prober {
+	return newProber(direct.KeepAlive, time.Now)
+}
+
+func newProber(keepAlive func(direct.Connector) error, now func() time.Time) *Prober {
+	return &Prober{
+		results:   make(map[string]ProbeResult),
+		keepAlive: keepAlive,
+		now:       now,
+
+		discoveries:   make(map[string]Discovery),
+		discovered:    make(map[string][]model.Account),
+		fetchAccounts: direct.Accounts,
+	}
+}
+
+// ProbeDue probes each institution whose keepalive interval has elapsed since its accounts last synced or were probed.
+// Institutions which rejected their credentials on the last probe are skipped.
+func (p *Prober) ProbeDue(accountStore *client.AccountStore) error {
+	groups, err := probeGroups(accountStore)
+	if err != nil {
+		return err
+	}
+	now := p.now()
+	var errs []string
+	for _, group := range groups {
+		interval := group.connector.Config().KeepAliveInterval()
+		if interval == 0 || p.lockedOut(group.key) || now.Sub(group.lastContact) < interval {
+			continue
+		}
+		if err := p.probe(accountStore, group, false).saveErr; err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("Failed to record keepalive probes: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ProbeAccount immediately probes the institution for account 'id', even if its last probe was locked out
+func (p *Prober) ProbeAccount(accountStore *client.AccountStore, id string) (ProbeResult, error) {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	if !found {
+		return ProbeResult{}, errors.Errorf("Account not found by ID: %q", id)
+	}
+	connector, isDirect := account.Institution().(direct.Connector)
+	if !isDirect {
+		return ProbeResult{}, errors.Errorf("Keepalive probes are only supported for direct connect accounts: %q", account.Description())
+	}
+	groups, err := probeGroups(accountStore)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	key := connectorKey(connector)
+	group := probeGroup{key: key, connector: connector, accounts: []model.Account{account}}
+	for _, g := range groups {
+		if g.key == key {
+			group = g
+			break
+		}
+	}
+	outcome := p.probe(accountStore, group, true)
+	return outcome.ProbeResult, outcome.saveErr
+}
+
+// Results returns the most recent probe for each institution, newest first
+func (p *Prober) Results() []ProbeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	results := make([]ProbeResult, 0, len(p.results))
+	for _, result := range p.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Time.After(results[b].Time)
+	})
+	return results
+}
+
+// RecordConnectivity records a connectivity check of 'account's institution as its latest probe.
+// If the check signed on successfully, 'account' is marked kept alive, so call this before saving 'account'.
+func (p *Prober) RecordConnectivity(account model.Account, report direct.ConnectivityReport) {
+	connector, isDirect := account.Institution().(direct.Connector)
+	if !isDirect {
+		return
+	}
+	now := p.now()
+	result := ProbeResult{
+		Institution: connector.Description(),
+		Accounts:    []string{account.Description()},
+		Time:        now,
+		Manual:      true,
+	}
+	if err := report.Err(); err != nil {
+		result.Error = err.Error()
+		result.LockedOut = report.AuthFailed()
+	} else if keepAliver, ok := account.(direct.KeepAliver); ok && report.Signon {
+		keepAliver.SetLastKeepAliveTime(&now)
+	}
+	p.mu.Lock()
+	p.results[connectorKey(connector)] = result
+	p.mu.Unlock()
+}
+
+// ClearLockout allows scheduled probes to contact 'connector's institution again, e.g. after its credentials were rotated
+func (p *Prober) ClearLockout(connector direct.Connector) {
+	key := connectorKey(connector)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if result, ok := p.results[key]; ok && result.LockedOut {
+		result.LockedOut = false
+		p.results[key] = result
+	}
+}
+
+func (p *Prober) lockedOut(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.results[key].LockedOut
+}
+
+type probeOutcome struct {
+	ProbeResult
+	saveErr error
+}
+
+func (p *Prober) probe(accountStore *client.AccountStore, group probeGroup, manual bool) probeOutcome {
+	err := p.keepAlive(group.connector)
+	now := p.now()
+	result := ProbeResult{
+		Institution: group.connector.Description(),
+		Time:        now,
+		Manual:      manual,
+	}
+	for _, account := range group.accounts {
+		result.Accounts = append(result.Accounts, account.Description())
+	}
+	if err != nil {
+		result.Error = err.Error()
+		// avoid deepening a lockout with repeated failed sign ons
+		result.LockedOut = err == direct.ErrAuthFailed || err == direct.ErrLockedOut
+	}
+	p.mu.Lock()
+	p.results[group.key] = result
+	p.mu.Unlock()
+
+	outcome := probeOutcome{ProbeResult: result}
+	if err == nil {
+		outcome.saveErr = saveKeepAlive(accountStore, group.accounts, now)
+	}
+	return outcome
+}
+
+// saveKeepAlive records a successful probe on each account
+func saveKeepAlive(accountStore *client.AccountStore, accounts []model.Account, now time.Time) error {
+	for _, a := range accounts {
+		// reload the account to avoid overwriting changes made during the probe
+		var account model.Account
+		found, err := accountStore.Get(a.ID(), &account)
+		if err != nil {
+			return err
+		}
+		keepAliver, ok := account.(direct.KeepAliver)
+		if !found || !ok {
+			continue
+		}
+		keepAliver.SetLastKeepAliveTime(&now)
+		if err := accountStore.Update(account.ID(), account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeGroups returns the active direct connect accounts grouped by institution login, along with each group's most recent contact
+func probeGroups(accountStore *client.AccountStore) ([]probeGroup, error) {
+	groups := make(map[string]*probeGroup)
+	var keys []string
+	var account model.Account
+	err := accountStore.Iter(&account, func(id string) bool {
+		connector, isDirect := account.Institution().(direct.Connector)
+		if !isDirect || !isActive(account) || model.ClosedDate(account) != nil {
+			return true
+		}
+		key := connectorKey(connector)
+		group, exists := groups[key]
+		if !exists {
+			group = &probeGroup{key: key, connector: connector}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.accounts = append(group.accounts, account)
+		if bookmark := model.SyncBookmark(account); bookmark != nil && bookmark.After(group.lastContact) {
+			group.lastContact = *bookmark
+		}
+		if keepAliver, ok := account.(direct.KeepAliver); ok {
+			if last := keepAliver.LastKeepAliveTime(); last != nil && last.After(group.lastContact) {
+				group.lastContact = *last
+			}
+		}
+		return true
+	})
+	result := make([]probeGroup, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *groups[key])
+	}
+	return result, err
+}
+
+// connectorKey identifies an institution login
+func connectorKey(connector direct.Connector) string {
+	return strings.Join([]string{
+		strings.TrimRight(connector.URL(), "/"),
+		connector.Username(),
+		connector.FID(),
+	}, "\x00")
+}
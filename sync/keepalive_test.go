@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getKeepAlive(t *testing.T, accountStore *client.AccountStore, id string) *time.Time {
+	t.Helper()
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	require.NoError(t, err)
+	require.True(t, found)
+	return account.(direct.KeepAliver).LastKeepAliveTime()
+}
+
+func TestProbeDue(t *testing.T) {
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	newConnector := func(username string, keepAliveDays int) direct.Connector {
+		return direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", username, "password", direct.Config{KeepAliveDays: keepAliveDays})
+	}
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	stale := direct.NewCreditCard("1", "stale card", newConnector("stale", 30))
+	stale.(model.SyncBookmarker).SetSyncBookmark(timePtr(now.AddDate(0, 0, -31)))
+	recent := direct.NewCreditCard("2", "recent card", newConnector("recent", 30))
+	recent.(model.SyncBookmarker).SetSyncBookmark(timePtr(now.AddDate(0, 0, -1)))
+	disabled := direct.NewCreditCard("3", "disabled card", newConnector("disabled", 0))
+	lockedOut := direct.NewCreditCard("4", "locked out card", newConnector("locked", 30))
+	for _, account := range []model.Account{stale, recent, disabled, lockedOut} {
+		require.NoError(t, accountStore.Add(account))
+	}
+
+	var probed []string
+	prober := newProber(func(connector direct.Connector) error {
+		probed = append(probed, connector.Username())
+		if connector.Username() == "locked" {
+			return direct.ErrLockedOut
+		}
+		return nil
+	}, func() time.Time { return now })
+
+	require.NoError(t, prober.ProbeDue(accountStore))
+	assert.ElementsMatch(t, []string{"stale", "locked"}, probed)
+	assert.Equal(t, &now, getKeepAlive(t, accountStore, "1"))
+	assert.Nil(t, getKeepAlive(t, accountStore, "4"))
+
+	probed = nil
+	require.NoError(t, prober.ProbeDue(accountStore))
+	assert.Empty(t, probed, "Probes should not repeat before the interval, or for locked out institutions")
+
+	results := prober.Results()
+	require.Len(t, results, 2)
+	for _, result := range results {
+		if result.Institution == "" || len(result.Accounts) != 1 {
+			t.Errorf("Unexpected probe result: %+v", result)
+		}
+		if result.Accounts[0] == "locked out card" {
+			assert.True(t, result.LockedOut)
+			assert.Equal(t, direct.ErrLockedOut.Error(), result.Error)
+		}
+	}
+}
+
+func TestProbeAccount(t *testing.T) {
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	connector := direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", "user", "password", direct.Config{})
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("1", "some card", connector)))
+	require.NoError(t, accountStore.Add(&model.BasicAccount{AccountID: "2", AccountDescription: "manual account"}))
+
+	probeErr := errors.New("some error")
+	prober := newProber(func(direct.Connector) error { return probeErr }, func() time.Time { return now })
+	result, err := prober.ProbeAccount(accountStore, "1")
+	require.NoError(t, err)
+	assert.Equal(t, ProbeResult{
+		Institution: "Some Bank",
+		Accounts:    []string{"some card"},
+		Time:        now,
+		Manual:      true,
+		Error:       "some error",
+	}, result)
+	assert.Nil(t, getKeepAlive(t, accountStore, "1"))
+
+	probeErr = nil
+	result, err = prober.ProbeAccount(accountStore, "1")
+	require.NoError(t, err)
+	assert.Empty(t, result.Error)
+	assert.Equal(t, &now, getKeepAlive(t, accountStore, "1"))
+
+	_, err = prober.ProbeAccount(accountStore, "2")
+	require.Error(t, err)
+	assert.Equal(t, `Keepalive probes are only supported for direct connect accounts: "manual account"`, err.Error())
+}
+
+func TestRecordConnectivity(t *testing.T) {
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	connector := direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", "user", "password", direct.Config{})
+	account := direct.NewCreditCard("1", "some card", connector)
+	prober := newProber(func(direct.Connector) error { return nil }, func() time.Time { return now })
+
+	prober.RecordConnectivity(account, direct.ConnectivityReport{
+		Probes: []direct.ProbeResult{{Name: direct.SignonProbe, StatusCode: 15500, Error: "Signon status 15500: Signon invalid"}},
+		Signon: true,
+	})
+	assert.Equal(t, []ProbeResult{{
+		Institution: "Some Bank",
+		Accounts:    []string{"some card"},
+		Time:        now,
+		Manual:      true,
+		Error:       direct.SignonProbe + " failed: Signon status 15500: Signon invalid",
+		LockedOut:   true,
+	}}, prober.Results())
+	assert.Nil(t, account.(direct.KeepAliver).LastKeepAliveTime())
+
+	prober.RecordConnectivity(account, direct.ConnectivityReport{
+		Probes: []direct.ProbeResult{{Name: direct.ProfileProbe, Passed: true}},
+	})
+	assert.Nil(t, account.(direct.KeepAliver).LastKeepAliveTime(), "Anonymous checks don't keep credentials alive")
+
+	prober.RecordConnectivity(account, direct.ConnectivityReport{
+		Probes: []direct.ProbeResult{{Name: direct.SignonProbe, Passed: true}},
+		Signon: true,
+	})
+	assert.Equal(t, &now, account.(direct.KeepAliver).LastKeepAliveTime())
+	results := prober.Results()
+	require.Len(t, results, 1)
+	assert.Empty(t, results[0].Error)
+	assert.False(t, results[0].LockedOut)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/johnstarich/sage/audit"
 	"github.com/johnstarich/sage/client"
 	"github.com/johnstarich/sage/client/direct"
 	"github.com/johnstarich/sage/client/model"
@@ -14,29 +15,181 @@ import (
 	"github.com/johnstarich/sage/prompter"
 	"github.com/johnstarich/sage/records"
 	"github.com/johnstarich/sage/rules"
+	"github.com/pkg/errors"
 )
 
 // Sync fetches transactions for each account and categorizes them based on rules, then writes them to disk
-func Sync(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, syncFromLedgerStart bool) {
-	download := downloadTxns(accountStore)
+// Accounts with older sync bookmarks, or reset bookmarks, download from their bookmark instead of the ledger's most recent transaction.
+// Each account's outcome is appended to 'auditLog' when the sync finishes. 'auditLog' may be nil.
+// Unusually large batches are quarantined by 'guard', except for backfills, along with any transactions which fail validation. 'guard' may be nil to import every batch.
+// The run's summary is written to 'summaryFile' and sent on the returned channel when the sync finishes. 'summaryFile' may be nil.
+// Returns nil if a sync is already running.
+func Sync(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, auditLog *audit.Log, summaryFile *audit.SummaryFile, guard *Guard, syncFromLedgerStart bool) <-chan audit.Summary {
+	recentStart, end := ldgStore.RecentSyncRange()
 	if syncFromLedgerStart {
-		ldgStore.Resync(download, rulesStore.ApplyAll)
-	} else {
-		ldgStore.SyncRecent(download, rulesStore.ApplyAll)
+		return syncRange(ldgStore, accountStore, rulesStore, auditLog, summaryFile, guard, ldgStore.FirstTransactionTime(), end)
 	}
+
+	isNew := func(txn ledger.Transaction) bool {
+		_, found := ldgStore.Transaction(txn.Postings[0].ID())
+		return !found
+	}
+	run := newAuditRun(isNew)
+	processTxns := applyRules(ldgStore, rulesStore, run)
+	results := make(chan audit.Summary, 1)
+	revision := ldgStore.Revision()
+	modified := func() bool {
+		return ldgStore.Revision() != revision
+	}
+	starts, start, err := syncStarts(accountStore, isActive, recentStart, ldgStore.Ledger.FirstTransactionTime())
+	if err != nil {
+		// fall back to the default range, the download will report the account store failure
+		starts, start = nil, recentStart
+	}
+	include := func(account model.Account, downloadEnd time.Time) bool {
+		return isActive(account) && downloadEnd.After(starts[account.ID()])
+	}
+	marks := newBookmarks()
+	backfills := make(map[string]bool)
+	for id, accountStart := range starts {
+		backfills[id] = accountStart.Before(recentStart)
+	}
+	guardRun := guard.newRun(isNew, backfills)
+	if !ldgStore.StartSyncThen(start, end, downloadTxns(accountStore, include, marks, run, guardRun), run.process(func(txns []ledger.Transaction) {
+		processTxns(txns)
+		// bookmarks only widen future download ranges, so saving them before the ledger is written can't skip transactions
+		_ = marks.save(accountStore)
+		_ = guardRun.save()
+	}), run.done(auditLog, summaryFile, start, end, modified, results)) {
+		return nil
+	}
+	return results
+}
+
+// SyncDays is like Sync, but downloads the last 'days' days for every active account, ignoring sync bookmarks
+// Fails if 'days' is not positive or reaches further back than an included institution's maximum history.
+// Returns a nil channel if a sync is already running.
+func SyncDays(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, auditLog *audit.Log, summaryFile *audit.SummaryFile, guard *Guard, days int) (<-chan audit.Summary, error) {
+	if err := validateHistoryDays(accountStore, days); err != nil {
+		return nil, err
+	}
+	_, end := ldgStore.RecentSyncRange()
+	start, end := direct.RelativeRange(days, end)
+	return syncRange(ldgStore, accountStore, rulesStore, auditLog, summaryFile, guard, start, end), nil
+}
+
+// validateHistoryDays returns an error if 'days' is invalid for any active direct connect account's institution
+func validateHistoryDays(accountStore *client.AccountStore, days int) error {
+	if err := (direct.Config{}).ValidateHistoryDays(days); err != nil {
+		return err
+	}
+	var validateErr error
+	var account model.Account
+	err := accountStore.Iter(&account, func(string) bool {
+		if connector, isDirect := account.Institution().(direct.Connector); isDirect && isActive(account) {
+			if err := connector.Config().ValidateHistoryDays(days); err != nil {
+				validateErr = errors.Wrap(err, connector.Description())
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return validateErr
 }
 
-func downloadTxns(accountStore *client.AccountStore) func(start, end time.Time, prompter prompter.Prompter) ([]ledger.Transaction, error) {
+// syncRange downloads every active account's transactions from 'start' to 'end', ignoring sync bookmarks and batch size limits.
+// Still records each account's last successful sync time. Returns nil if a sync is already running.
+func syncRange(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, auditLog *audit.Log, summaryFile *audit.SummaryFile, guard *Guard, start, end time.Time) <-chan audit.Summary {
+	isNew := func(txn ledger.Transaction) bool {
+		_, found := ldgStore.Transaction(txn.Postings[0].ID())
+		return !found
+	}
+	run := newAuditRun(isNew)
+	results := make(chan audit.Summary, 1)
+	revision := ldgStore.Revision()
+	modified := func() bool {
+		return ldgStore.Revision() != revision
+	}
+	include := func(account model.Account, _ time.Time) bool {
+		return isActive(account)
+	}
+	marks := newSyncSuccesses()
+	processTxns := applyRules(ldgStore, rulesStore, run)
+	if !ldgStore.StartSyncThen(start, end, downloadTxns(accountStore, include, marks, run, guard.newScreenRun()), run.process(func(txns []ledger.Transaction) {
+		processTxns(txns)
+		_ = marks.save(accountStore)
+	}), run.done(auditLog, summaryFile, start, end, modified, results)) {
+		return nil
+	}
+	return results
+}
+
+// FinalSync downloads any remaining transactions for the account 'id', then archives it to exclude it from future syncs
+// If the download fails, e.g. the institution already revoked access, the account is left unchanged.
+func FinalSync(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, id string) error {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("Account not found by ID: %q", id)
+	}
+	if err := client.RequireCapability(account, model.CapabilityIncrementalStatement); err != nil {
+		return err
+	}
+	archiver, ok := account.(model.Archiver)
+	if !ok {
+		return errors.Errorf("Account does not support archiving: %q", account.Description())
+	}
+	if archiver.IsArchived() {
+		return errors.Errorf("Account is already archived: %q", account.Description())
+	}
+
+	download := downloadTxns(accountStore, func(a model.Account, _ time.Time) bool {
+		return a.ID() == id
+	}, nil, nil, nil)
+	if err := ldgStore.SyncRecentNow(download, applyRules(ldgStore, rulesStore, nil)); err != nil {
+		return errors.Wrapf(err, "Final sync failed, so %q was not archived. The institution may have already revoked access", account.Description())
+	}
+	archiver.SetArchived(true)
+	return accountStore.Update(id, account)
+}
+
+// applyRules returns a txn processor which categorizes txns with 'rulesStore', then links foreign transaction fees to their purchases.
+// Classifier disagreements are counted in 'run', if non-nil.
+func applyRules(ldgStore *ledger.Store, rulesStore *rules.Store, run *auditRun) func(txns []ledger.Transaction) {
+	return func(txns []ledger.Transaction) {
+		classifications := rulesStore.Classify(txns)
+		run.recordClassifications(txns, classifications)
+		ldgStore.LinkFees(rulesStore.FeeRule(), txns)
+	}
+}
+
+func isActive(account model.Account) bool {
+	return !model.IsArchived(account)
+}
+
+// downloadTxns returns a downloader for accounts where 'include' returns true for the download's end date.
+// Records download progress in 'marks' and per-account outcomes in 'run', and quarantines failed transactions and unusually large batches with 'guard', if non-nil.
+// Future-dated transactions are deferred to a later sync by 'guard', if non-nil.
+func downloadTxns(accountStore *client.AccountStore, include func(account model.Account, downloadEnd time.Time) bool, marks *bookmarks, run *auditRun, guard *guardRun) func(start, end time.Time, prompter prompter.Prompter) ([]ledger.Transaction, error) {
 	return func(start, end time.Time, prompter prompter.Prompter) ([]ledger.Transaction, error) {
 		instMap := make(map[model.Institution][]model.Account)
 		var account model.Account
 		err := accountStore.Iter(&account, func(id string) bool {
+			if !include(account, end) {
+				return true
+			}
 			inst := account.Institution()
 			instMap[inst] = append(instMap[inst], account)
 			return true
 		})
 		if err != nil {
-			return nil, err
+			return nil, NewFatalError(errors.Wrap(err, "Failed to load accounts"))
 		}
 		var allTxns []ledger.Transaction
 		var errs sErrors.Errors
@@ -50,9 +203,19 @@ func downloadTxns(accountStore *client.AccountStore) func(start, end time.Time,
 						descriptions = append(descriptions, account.Description())
 					}
 				}
-				txns, err := direct.Statement(connector, start, end, requestors, client.ParseOFX)
+				txns, warning, err := direct.Statement(connector, start, end, requestors, client.ParseOFX)
+				marks.record(accounts, end, err)
+				run.record(accounts, txns, err)
+				run.recordWarning(accounts, warning)
 				errs.AddErr(wrapDownloadErr(err, descriptions))
-				allTxns = append(allTxns, txns...)
+				txns = client.LocalizeDates(txns, accounts)
+				txns = client.SetTransactionCodes(txns, accounts)
+				txns = client.RouteCashWithdrawals(txns, accounts)
+				txns = rejectClosed(&errs, client.FilterBalanceAssertions(txns, accounts), accounts)
+				txns = dropZeroAmounts(run, accounts, txns)
+				txns = deferFuture(guard, marks, run, accounts, txns)
+				txns = holdFailed(&errs, guard, accounts, txns)
+				allTxns = append(allTxns, holdLarge(&errs, guard, run, accounts, txns, err)...)
 			}
 			if connector, isConn := inst.(web.Connector); isConn {
 				var descriptions []string
@@ -62,17 +225,68 @@ func downloadTxns(accountStore *client.AccountStore) func(start, end time.Time,
 					descriptions = append(descriptions, account.Description())
 				}
 				txns, err := web.Statement(connector, start, end, accountIDs, client.ParseOFX, prompter)
+				marks.record(accounts, end, err)
+				run.record(accounts, txns, err)
 				if !errs.AddErr(wrapDownloadErr(err, descriptions)) {
 					// TODO remove break after beta
 					break // beta: fail immediately on web connector error
 				}
-				allTxns = append(allTxns, txns...)
+				txns = client.LocalizeDates(txns, accounts)
+				txns = client.SetTransactionCodes(txns, accounts)
+				txns = client.RouteCashWithdrawals(txns, accounts)
+				txns = rejectClosed(&errs, client.FilterBalanceAssertions(txns, accounts), accounts)
+				txns = dropZeroAmounts(run, accounts, txns)
+				txns = deferFuture(guard, marks, run, accounts, txns)
+				txns = holdFailed(&errs, guard, accounts, txns)
+				allTxns = append(allTxns, holdLarge(&errs, guard, run, accounts, txns, err)...)
 			}
 		}
 		return allTxns, errs.ErrOrNil()
 	}
 }
 
+// rejectClosed removes transactions dated after their account's closure, adding an error for each affected account to errs
+func rejectClosed(errs *sErrors.Errors, txns []ledger.Transaction, accounts []model.Account) []ledger.Transaction {
+	txns, closedErrs := client.RejectClosedTransactions(txns, accounts)
+	for _, closedErr := range closedErrs {
+		errs.AddErr(closedErr)
+	}
+	return txns
+}
+
+// dropZeroAmounts applies each account's zero-amount policy to txns, counting dropped transactions in the account's audit outcome
+func dropZeroAmounts(run *auditRun, accounts []model.Account, txns []ledger.Transaction) []ledger.Transaction {
+	txns, dropped := client.FilterZeroAmounts(txns, accounts)
+	run.recordDropped(dropped)
+	return txns
+}
+
+// holdFailed quarantines transactions which would fail ledger validation, adding an error to errs if any were held
+func holdFailed(errs *sErrors.Errors, guard *guardRun, accounts []model.Account, txns []ledger.Transaction) []ledger.Transaction {
+	txns, err := guard.screen(accounts, txns)
+	errs.AddErr(err)
+	return txns
+}
+
+// holdLarge quarantines unusually large batches from a successful download, adding an error to errs and the account's audit outcome for each held batch
+func holdLarge(errs *sErrors.Errors, guard *guardRun, run *auditRun, accounts []model.Account, txns []ledger.Transaction, downloadErr error) []ledger.Transaction {
+	if downloadErr != nil {
+		return txns
+	}
+	txns, holdErrs := guard.hold(accounts, txns)
+	for _, err := range holdErrs {
+		errs.AddErr(err)
+		if quarantined, ok := err.(QuarantinedError); ok {
+			for _, account := range accounts {
+				if account.ID() == quarantined.AccountID {
+					run.record([]model.Account{account}, nil, errors.New(QuarantinedReason))
+				}
+			}
+		}
+	}
+	return txns
+}
+
 type downloadErr struct {
 	error
 	accounts []string
@@ -93,6 +307,21 @@ func (d *downloadErr) Error() string {
 	return fmt.Sprintf("Failed downloading transactions for account %q: %s", d.accounts, d.error.Error())
 }
 
+// Unwrap returns the original download failure
+func (d *downloadErr) Unwrap() error {
+	return d.error
+}
+
+// Cause returns the original download failure, for compatibility with errors.Cause
+func (d *downloadErr) Cause() error {
+	return d.error
+}
+
+// Partial always returns true, since other accounts' transactions are still imported
+func (d *downloadErr) Partial() bool {
+	return true
+}
+
 func (d *downloadErr) MarshalJSON() ([]byte, error) {
 	downloadErr := struct {
 		Description string
@@ -104,7 +333,8 @@ func (d *downloadErr) MarshalJSON() ([]byte, error) {
 		Accounts:    d.accounts,
 	}
 
-	if err, ok := d.error.(records.Error); ok {
+	var err records.Error
+	if sErrors.As(d.error, &err) {
 		downloadErr.Records = err.Records()
 	}
 	return json.Marshal(downloadErr)
@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"context"
+	gosync "sync"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/client/web"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/reported"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// balanceRefreshTimeout limits each account's balance refresh, so refreshes return within a few seconds
+	balanceRefreshTimeout = 10 * time.Second
+	// maxConcurrentRefreshes is the most balance refreshes to run at once
+	maxConcurrentRefreshes = 4
+)
+
+// RefreshedBalance compares an account's freshly reported balance to its ledger balance
+type RefreshedBalance struct {
+	AccountID   string
+	Account     string
+	Description string
+	Reported    *reported.Balance `json:",omitempty"`
+	// Ledger is the ledger's balance for the account as of the reported balance's date, or now if the refresh failed
+	Ledger decimal.Decimal
+	// Difference is the reported balance minus the ledger balance
+	Difference *decimal.Decimal `json:",omitempty"`
+	Error      string           `json:",omitempty"`
+}
+
+// RefreshBalances fetches the current institution-reported balance for each of the accounts 'ids', or every active account which supports balances if 'ids' is empty.
+// Only balances are requested, no transactions are downloaded and the ledger is not changed. Reported balances are saved to 'balanceStore'.
+// Refreshes run in parallel and each one times out after a few seconds. Failures are reported on each account's result.
+func RefreshBalances(ldgStore *ledger.Store, accountStore *client.AccountStore, balanceStore *reported.Store, ids []string) ([]RefreshedBalance, error) {
+	accounts, err := refreshAccounts(accountStore, ids)
+	if err != nil {
+		return nil, err
+	}
+	return refreshBalances(ldgStore.Ledger, balanceStore, accounts, fetchBalance, time.Now), nil
+}
+
+// refreshAccounts returns the accounts for 'ids', or every active account which supports balances if 'ids' is empty
+func refreshAccounts(accountStore *client.AccountStore, ids []string) ([]model.Account, error) {
+	var accounts []model.Account
+	if len(ids) > 0 {
+		for _, id := range ids {
+			var account model.Account
+			found, err := accountStore.Get(id, &account)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, errors.Errorf("Account not found by ID: %q", id)
+			}
+			accounts = append(accounts, account)
+		}
+		return accounts, nil
+	}
+	var account model.Account
+	err := accountStore.Iter(&account, func(string) bool {
+		if isActive(account) && model.ClosedDate(account) == nil && client.Capabilities(account).Has(model.CapabilityBalance) {
+			accounts = append(accounts, account)
+		}
+		return true
+	})
+	return accounts, err
+}
+
+func refreshBalances(
+	ldg *ledger.Ledger,
+	balanceStore *reported.Store,
+	accounts []model.Account,
+	fetch func(context.Context, model.Account) (reported.Balance, error),
+	now func() time.Time,
+) []RefreshedBalance {
+	results := make([]RefreshedBalance, len(accounts))
+	limit := make(chan struct{}, maxConcurrentRefreshes)
+	var wg gosync.WaitGroup
+	for i, account := range accounts {
+		wg.Add(1)
+		go func(result *RefreshedBalance, account model.Account) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			name := model.LedgerAccountName(account)
+			*result = RefreshedBalance{
+				AccountID:   account.ID(),
+				Account:     name,
+				Description: account.Description(),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), balanceRefreshTimeout)
+			defer cancel()
+			balance, err := fetch(ctx, account)
+			if err != nil {
+				result.Error = err.Error()
+				result.Ledger = ldg.BalancesAsOf(now())[name]
+				return
+			}
+			balance.Fetched = now()
+			if err := balanceStore.Put(account.ID(), balance); err != nil {
+				result.Error = errors.Wrap(err, "Failed to save reported balance").Error()
+			}
+			result.Reported = &balance
+			result.Ledger = ldg.BalancesAsOf(balance.AsOf)[name]
+			difference := balance.Amount.Sub(result.Ledger)
+			result.Difference = &difference
+		}(&results[i], account)
+	}
+	wg.Wait()
+	return results
+}
+
+// fetchBalance requests only the current balance for 'account' from its institution
+func fetchBalance(ctx context.Context, account model.Account) (reported.Balance, error) {
+	if err := client.RequireCapability(account, model.CapabilityBalance); err != nil {
+		return reported.Balance{}, err
+	}
+	switch connector := account.Institution().(type) {
+	case direct.Connector:
+		requestor, ok := account.(direct.Requestor)
+		if !ok {
+			return reported.Balance{}, model.MissingCapabilityError{Capability: model.CapabilityBalance}
+		}
+		balance, err := direct.StatementBalance(ctx, connector, requestor)
+		return reported.Balance{Amount: balance.Amount, Currency: balance.Currency, AsOf: balance.AsOf}, err
+	case web.Connector:
+		amount, asOf, err := web.Balance(ctx, connector, account.ID())
+		return reported.Balance{Amount: amount, AsOf: asOf}, err
+	default:
+		return reported.Balance{}, model.MissingCapabilityError{Capability: model.CapabilityBalance}
+	}
+}
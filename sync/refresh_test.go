@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/reported"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshBalances(t *testing.T) {
+	makeAccount := func(id string) model.Account {
+		return &model.BasicAccount{
+			AccountID:          id,
+			AccountDescription: "account " + id,
+			AccountType:        model.AssetAccount,
+			BasicInstitution:   model.BasicInstitution{InstDescription: "some org"},
+		}
+	}
+	accounts := []model.Account{makeAccount("1"), makeAccount("2")}
+	name := model.LedgerAccountName(accounts[0])
+	asOf := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2020, 1, 11, 0, 0, 0, 0, time.UTC)
+	ldg, err := ledger.New([]ledger.Transaction{
+		{
+			Date:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Payee: "some payee",
+			Postings: []ledger.Posting{
+				{Account: name, Amount: decimal.New(100, 0), Currency: "$"},
+				{Account: "revenues:pay", Amount: decimal.New(-100, 0), Currency: "$"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	beforeLedger := ldg.String()
+
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	store, err := reported.NewStore(db)
+	require.NoError(t, err)
+
+	results := refreshBalances(ldg, store, accounts, func(ctx context.Context, account model.Account) (reported.Balance, error) {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline, "Refreshes should time out")
+		if account.ID() == "2" {
+			return reported.Balance{}, errors.New("some error")
+		}
+		return reported.Balance{Amount: decimal.New(110, 0), Currency: "USD", AsOf: asOf}, nil
+	}, func() time.Time { return now })
+
+	require.Len(t, results, 2)
+	assert.Equal(t, "1", results[0].AccountID)
+	require.NotNil(t, results[0].Reported)
+	assert.Equal(t, now, results[0].Reported.Fetched)
+	assert.True(t, decimal.New(100, 0).Equal(results[0].Ledger))
+	require.NotNil(t, results[0].Difference)
+	assert.True(t, decimal.New(10, 0).Equal(*results[0].Difference))
+	assert.Empty(t, results[0].Error)
+
+	assert.Equal(t, "2", results[1].AccountID)
+	assert.Equal(t, "some error", results[1].Error)
+	assert.Nil(t, results[1].Reported)
+	assert.Nil(t, results[1].Difference)
+
+	saved, found, err := store.Get("1")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.True(t, decimal.New(110, 0).Equal(saved.Amount))
+	_, found, err = store.Get("2")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	assert.Equal(t, beforeLedger, ldg.String(), "Refreshing balances must not change the ledger")
+}
@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/pkg/errors"
+)
+
+// ClientRegistration describes the ClientUID a direct connect login signs on with. Every account sharing the login uses the same ClientUID.
+type ClientRegistration struct {
+	Institution string
+	Accounts    []string
+	// ClientID is redacted except for its last few characters
+	ClientID  string
+	Generated *time.Time `json:",omitempty"`
+	// LastSignon is the login's most recent keepalive probe since Sage started, if any
+	LastSignon *ProbeResult `json:",omitempty"`
+	// Warning explains any follow-up needed at the institution after a change
+	Warning string `json:",omitempty"`
+}
+
+const reauthorizeWarning = "The institution may need to authorize the new ClientUID before syncs can sign on again, often by email or on their website"
+
+// ClientRegistration returns the ClientUID registration for the direct connect login used by account 'id'
+func (p *Prober) ClientRegistration(accountStore *client.AccountStore, id string) (ClientRegistration, error) {
+	connector, err := directConnector(accountStore, id)
+	if err != nil {
+		return ClientRegistration{}, err
+	}
+	registration, err := clientRegistration(accountStore, connector)
+	if err != nil {
+		return ClientRegistration{}, err
+	}
+	if result, found := p.result(connectorKey(connector)); found {
+		registration.LastSignon = &result
+	}
+	return registration, nil
+}
+
+func (p *Prober) result(key string) (ProbeResult, bool) {
+	if p == nil {
+		return ProbeResult{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result, found := p.results[key]
+	return result, found
+}
+
+// RegenerateClientID replaces the ClientUID for the direct connect login used by account 'id' with a new random one
+func RegenerateClientID(accountStore *client.AccountStore, id string) (ClientRegistration, error) {
+	clientID, err := direct.NewClientID()
+	if err != nil {
+		return ClientRegistration{}, err
+	}
+	return setClientID(accountStore, id, clientID, time.Now())
+}
+
+// SetClientID sets the ClientUID for the direct connect login used by account 'id', i.e. to reuse one registered by another installation
+func SetClientID(accountStore *client.AccountStore, id, clientID string) (ClientRegistration, error) {
+	clientID = strings.TrimSpace(clientID)
+	if err := direct.ValidateClientID(clientID); err != nil {
+		return ClientRegistration{}, err
+	}
+	return setClientID(accountStore, id, clientID, time.Now())
+}
+
+// setClientID updates the ClientUID on every account sharing account 'id's login
+func setClientID(accountStore *client.AccountStore, id, clientID string, now time.Time) (ClientRegistration, error) {
+	connector, err := directConnector(accountStore, id)
+	if err != nil {
+		return ClientRegistration{}, err
+	}
+	key := connectorKey(connector)
+	var updates []model.Account
+	var account model.Account
+	err = accountStore.Iter(&account, func(string) bool {
+		if accountConnector, isDirect := account.Institution().(direct.Connector); isDirect && connectorKey(accountConnector) == key {
+			updates = append(updates, account)
+		}
+		return true
+	})
+	if err != nil {
+		return ClientRegistration{}, err
+	}
+	for _, account := range updates {
+		accountConnector := account.Institution().(direct.Connector)
+		config := accountConnector.Config()
+		config.ClientID = clientID
+		config.ClientIDGenerated = &now
+		accountConnector.SetConfig(config)
+		if err := accountStore.Update(account.ID(), account); err != nil {
+			return ClientRegistration{}, err
+		}
+	}
+
+	connector, err = directConnector(accountStore, id)
+	if err != nil {
+		return ClientRegistration{}, err
+	}
+	registration, err := clientRegistration(accountStore, connector)
+	registration.Warning = reauthorizeWarning
+	return registration, err
+}
+
+// directConnector returns the direct connector for account 'id'
+func directConnector(accountStore *client.AccountStore, id string) (direct.Connector, error) {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Errorf("Account not found by ID: %q", id)
+	}
+	connector, isDirect := account.Institution().(direct.Connector)
+	if !isDirect {
+		return nil, errors.Errorf("ClientUIDs are only supported for direct connect accounts: %q", account.Description())
+	}
+	return connector, nil
+}
+
+func clientRegistration(accountStore *client.AccountStore, connector direct.Connector) (ClientRegistration, error) {
+	config := connector.Config()
+	registration := ClientRegistration{
+		Institution: connector.Description(),
+		ClientID:    model.RedactPrefix(config.ClientID),
+		Generated:   config.ClientIDGenerated,
+	}
+	key := connectorKey(connector)
+	var account model.Account
+	err := accountStore.Iter(&account, func(string) bool {
+		if accountConnector, isDirect := account.Institution().(direct.Connector); isDirect && connectorKey(accountConnector) == key {
+			registration.Accounts = append(registration.Accounts, account.Description())
+		}
+		return true
+	})
+	sort.Strings(registration.Accounts)
+	return registration, err
+}
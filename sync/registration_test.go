@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getConnectorConfig(t *testing.T, accountStore *client.AccountStore, id string) direct.Config {
+	t.Helper()
+	connector, err := directConnector(accountStore, id)
+	require.NoError(t, err)
+	return connector.Config()
+}
+
+func TestClientRegistration(t *testing.T) {
+	now := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	connector := direct.New("Some Bank", "1234", "some org", "https://example.com/ofx", "user", "password", direct.Config{AppID: "QWIN", AppVersion: "2500", OFXVersion: "102", ClientID: "11112222"})
+	otherConnector := direct.New("Other Bank", "5678", "other org", "https://example.com/other", "user", "password", direct.Config{AppID: "QWIN", AppVersion: "2500", OFXVersion: "102", ClientID: "33334444"})
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("1", "some card", connector)))
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("2", "other card", connector)))
+	require.NoError(t, accountStore.Add(direct.NewCreditCard("3", "other bank card", otherConnector)))
+	require.NoError(t, accountStore.Add(&model.BasicAccount{AccountID: "4", AccountDescription: "manual account"}))
+
+	prober := newProber(func(direct.Connector) error { return errors.New("some error") }, func() time.Time { return now })
+	registration, err := prober.ClientRegistration(accountStore, "1")
+	require.NoError(t, err)
+	assert.Equal(t, ClientRegistration{
+		Institution: "Some Bank",
+		Accounts:    []string{"other card", "some card"},
+		ClientID:    "****2222",
+	}, registration)
+
+	_, err = prober.ProbeAccount(accountStore, "2")
+	require.NoError(t, err)
+	registration, err = prober.ClientRegistration(accountStore, "1")
+	require.NoError(t, err)
+	require.NotNil(t, registration.LastSignon)
+	assert.Equal(t, "some error", registration.LastSignon.Error)
+
+	registration, err = setClientID(accountStore, "2", "imported-client-id", now)
+	require.NoError(t, err)
+	assert.Equal(t, ClientRegistration{
+		Institution: "Some Bank",
+		Accounts:    []string{"other card", "some card"},
+		ClientID:    "****t-id",
+		Generated:   &now,
+		Warning:     reauthorizeWarning,
+	}, registration)
+	for _, id := range []string{"1", "2"} {
+		assert.Equal(t, "imported-client-id", getConnectorConfig(t, accountStore, id).ClientID)
+	}
+	assert.Equal(t, "33334444", getConnectorConfig(t, accountStore, "3").ClientID, "Other logins should keep their ClientUID")
+
+	registration, err = RegenerateClientID(accountStore, "1")
+	require.NoError(t, err)
+	clientID := getConnectorConfig(t, accountStore, "2").ClientID
+	assert.Len(t, clientID, 36)
+	assert.Equal(t, model.RedactPrefix(clientID), registration.ClientID)
+	assert.NoError(t, direct.ValidateClientID(clientID))
+
+	_, err = SetClientID(accountStore, "1", "  ")
+	assert.EqualError(t, err, "Invalid ClientUID, must be 1 to 36 characters")
+	_, err = SetClientID(accountStore, "4", "some-client-id")
+	assert.EqualError(t, err, `ClientUIDs are only supported for direct connect accounts: "manual account"`)
+}
@@ -0,0 +1,151 @@
+package sync
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/johnstarich/sage/budget"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/rules"
+	"github.com/johnstarich/sage/settings"
+	"github.com/johnstarich/sage/vcs"
+	"github.com/pkg/errors"
+)
+
+const reloadSyncTimeout = 30 * time.Second
+
+// ReloadResult reports the outcome of reloading all data files from disk
+type ReloadResult struct {
+	Reloaded bool
+	Files    map[string]ReloadFileResult
+	Changes  ReloadChanges
+}
+
+// ReloadFileResult reports the outcome of reading and validating a single data file
+type ReloadFileResult struct {
+	Valid bool
+	Error string `json:",omitempty"`
+}
+
+// ReloadChanges summarizes the differences between the serving state and the reloaded files
+type ReloadChanges struct {
+	TransactionsDelta int
+	AccountsAdded     []string
+	AccountsRemoved   []string
+}
+
+func (r *ReloadResult) addFile(name string, err error) bool {
+	result := ReloadFileResult{Valid: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.Files[name] = result
+	return err == nil
+}
+
+// Reload re-reads the ledger, accounts, rules, payee categories, budgets, and settings from disk, validates them as a set, then swaps them into the given stores.
+// Waits for any running sync to finish and prevents new syncs during the reload.
+// If any file fails validation, none of the stores are modified.
+func Reload(db plaindb.DB, ldgStore *ledger.Store, accountStore *client.AccountStore, rulesFile vcs.File, rulesStore *rules.Store, settingsStore *settings.Store) (ReloadResult, error) {
+	result := ReloadResult{Files: make(map[string]ReloadFileResult)}
+	resume, err := ldgStore.PauseSync(reloadSyncTimeout)
+	if err != nil {
+		return result, err
+	}
+	defer resume()
+
+	newLdg, ldgErr := ldgStore.ReadFile()
+	valid := result.addFile("ledger", ldgErr)
+
+	newAccountStore, swapAccounts, accountsErr := client.ReloadAccountStore(db)
+	var newAccountIDs, newLedgerAccounts map[string]bool
+	if accountsErr == nil {
+		newAccountIDs, newLedgerAccounts, accountsErr = accountNames(newAccountStore)
+	}
+	valid = result.addFile("accounts", accountsErr) && valid
+
+	newRules, newCodes, newTemplates, rulesErr := readRules(rulesFile)
+	if rulesErr == nil {
+		rulesErr = newCodes.Validate()
+	}
+	if rulesErr == nil {
+		rulesErr = newTemplates.Validate()
+	}
+	if rulesErr == nil && accountsErr == nil {
+		for _, account := range newRules.SourceAccounts() {
+			if !newLedgerAccounts[account] {
+				rulesErr = errors.Errorf("Rule references an account that does not exist: %q", account)
+				break
+			}
+		}
+	}
+	valid = result.addFile("rules", rulesErr) && valid
+
+	payeesPath := rulesStore.PayeeCategoriesPath()
+	newPayees, payeesErr := rules.ReadPayeeCategoriesFile(payeesPath)
+	if payeesPath != "" {
+		valid = result.addFile("payee categories", payeesErr) && valid
+	}
+
+	_, swapBudgets, budgetsErr := budget.ReloadStore(db)
+	valid = result.addFile("budgets", budgetsErr) && valid
+
+	swapSettings, settingsErr := settingsStore.Reload(db)
+	valid = result.addFile("settings", settingsErr) && valid
+
+	if !valid {
+		return result, nil
+	}
+
+	currentAccountIDs, _, err := accountNames(accountStore)
+	if err != nil {
+		return result, err
+	}
+	for id := range newAccountIDs {
+		if !currentAccountIDs[id] {
+			result.Changes.AccountsAdded = append(result.Changes.AccountsAdded, id)
+		}
+	}
+	for id := range currentAccountIDs {
+		if !newAccountIDs[id] {
+			result.Changes.AccountsRemoved = append(result.Changes.AccountsRemoved, id)
+		}
+	}
+	sort.Strings(result.Changes.AccountsAdded)
+	sort.Strings(result.Changes.AccountsRemoved)
+	result.Changes.TransactionsDelta = newLdg.Size() - ldgStore.Size()
+
+	ldgStore.Replace(newLdg)
+	swapAccounts()
+	rulesStore.Replace(newRules)
+	_ = rulesStore.SetCategoryCodes(newCodes)      // validated above
+	_ = rulesStore.SetSplitTemplates(newTemplates) // validated above
+	rulesStore.SetPayeeCategories(newPayees, payeesPath)
+	swapBudgets()
+	swapSettings()
+	result.Reloaded = true
+	return result, nil
+}
+
+func accountNames(accountStore *client.AccountStore) (ids, ledgerNames map[string]bool, err error) {
+	ids, ledgerNames = make(map[string]bool), make(map[string]bool)
+	var account model.Account
+	err = accountStore.Iter(&account, func(id string) bool {
+		ids[id] = true
+		ledgerNames[model.LedgerAccountName(account)] = true
+		return true
+	})
+	return ids, ledgerNames, err
+}
+
+func readRules(rulesFile vcs.File) (rules.Rules, rules.CategoryCodes, rules.SplitTemplates, error) {
+	b, err := rulesFile.Read()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return rules.NewCSVRulesFileFromReader(bytes.NewReader(b))
+}
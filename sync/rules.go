@@ -1,6 +1,7 @@
 package sync
 
 import (
+	"github.com/johnstarich/sage/changeset"
 	"github.com/johnstarich/sage/rules"
 	"github.com/johnstarich/sage/vcs"
 	"github.com/pkg/errors"
@@ -12,3 +13,40 @@ func Rules(rulesFile vcs.File, store *rules.Store) error {
 	err := rulesFile.Write([]byte(s))
 	return errors.Wrap(err, "Error writing rules store to disk")
 }
+
+type rulesChanges struct {
+	file   vcs.File
+	store  *rules.Store
+	before string // rules file contents from before staging, empty unless staged
+}
+
+// RulesChanges stages 'store' in a changeset, writing it to 'rulesFile' on commit if it changed.
+// Writes with Rules are not held while staged, so changes to 'store' inside a changeset should only be written by the commit.
+func RulesChanges(rulesFile vcs.File, store *rules.Store) changeset.Resource {
+	return &rulesChanges{file: rulesFile, store: store}
+}
+
+func (r *rulesChanges) Stage() (func(), error) {
+	r.before = r.store.String()
+	previousRules := r.store.Rules()
+	previousCodes := r.store.CategoryCodes()
+	previousTemplates := r.store.SplitTemplates()
+	return func() {
+		r.store.Replace(previousRules)
+		// restoring previously valid values can't fail validation
+		_ = r.store.SetCategoryCodes(previousCodes)
+		_ = r.store.SetSplitTemplates(previousTemplates)
+	}, nil
+}
+
+func (r *rulesChanges) Files() (map[string][]byte, error) {
+	s := r.store.String()
+	if s == r.before {
+		return nil, nil
+	}
+	return map[string][]byte{r.file.Path(): []byte(s)}, nil
+}
+
+func (r *rulesChanges) Unstage() {
+	r.before = ""
+}
@@ -4,11 +4,22 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/johnstarich/sage/client/direct"
+	"github.com/johnstarich/sage/datalock"
 	"github.com/johnstarich/sage/plaindb"
 )
 
-func Shutdown(db plaindb.DB, exitCode int) {
+// Shutdown closes institution connections and the DB, releases the data directory lock, and exits with 'exitCode'. Both db and lock may be nil.
+func Shutdown(db plaindb.DB, lock *datalock.Lock, exitCode int) {
 	fmt.Println(`{"level":"info","msg":"Shutting down"}`)
-	_ = db.Close()
+	direct.CloseConnections()
+	if db != nil {
+		_ = db.Close()
+	}
+	if lock != nil {
+		if err := lock.Release(); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to release data directory lock:", err)
+		}
+	}
 	os.Exit(exitCode)
 }
@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"io"
+	gosync "sync"
+	"time"
+
+	"github.com/johnstarich/sage/audit"
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	sErrors "github.com/johnstarich/sage/errors"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/prompter"
+	"github.com/johnstarich/sage/rules"
+	"github.com/pkg/errors"
+)
+
+// UploadStatement imports an OFX statement file for the account 'id', processed the same way as a sync of only that account.
+// Fails without changes if the file can't be parsed or contains a statement for a different account.
+// The run's summary is written to 'summaryFile' and sent on the returned channel when the import finishes.
+// Returns a nil channel if a sync is already running.
+func UploadStatement(ldgStore *ledger.Store, accountStore *client.AccountStore, rulesStore *rules.Store, auditLog *audit.Log, summaryFile *audit.SummaryFile, guard *Guard, id string, r io.Reader) (<-chan audit.Summary, error) {
+	var account model.Account
+	found, err := accountStore.Get(id, &account)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Errorf("Account not found by ID: %q", id)
+	}
+	txns, err := statementTransactions(account, r)
+	if err != nil {
+		return nil, err
+	}
+	txns = client.LocalizeDates(txns, []model.Account{account})
+	txns = client.SetTransactionCodes(txns, []model.Account{account})
+	txns = client.RouteCashWithdrawals(txns, []model.Account{account})
+	start, end := statementRange(txns)
+
+	isNew := func(txn ledger.Transaction) bool {
+		_, found := ldgStore.Transaction(txn.Postings[0].ID())
+		return !found
+	}
+	run := newAuditRun(isNew)
+	processTxns := applyRules(ldgStore, rulesStore, run)
+	results := make(chan audit.Summary, 1)
+	revision := ldgStore.Revision()
+	modified := func() bool {
+		return ldgStore.Revision() != revision
+	}
+	marks := newBookmarks()
+	guardRun := guard.newRun(isNew, map[string]bool{id: false})
+	accounts := []model.Account{account}
+
+	var once gosync.Once
+	download := func(_, _ time.Time, _ prompter.Prompter) ([]ledger.Transaction, error) {
+		// the whole statement is already downloaded, so only return it for the first chunk
+		var downloaded []ledger.Transaction
+		var errs sErrors.Errors
+		once.Do(func() {
+			if extendsBookmark(account, start, end) {
+				marks.record(accounts, end, nil)
+			}
+			run.record(accounts, txns, nil)
+			downloaded = rejectClosed(&errs, client.FilterBalanceAssertions(txns, accounts), accounts)
+			downloaded = dropZeroAmounts(run, accounts, downloaded)
+			downloaded = holdFailed(&errs, guardRun, accounts, downloaded)
+			downloaded = holdLarge(&errs, guardRun, run, accounts, downloaded, nil)
+		})
+		return downloaded, errs.ErrOrNil()
+	}
+	if !ldgStore.StartSyncThen(start, end, download, run.process(func(txns []ledger.Transaction) {
+		processTxns(txns)
+		_ = marks.save(accountStore)
+		_ = guardRun.save()
+	}), run.done(auditLog, summaryFile, start, end, modified, results)) {
+		return nil, nil
+	}
+	return results, nil
+}
+
+// statementTransactions parses the OFX statement in 'r' and moves its transactions onto 'account'.
+// Returns an error if the file has no statements or any of its statements are for a different account.
+func statementTransactions(account model.Account, r io.Reader) ([]ledger.Transaction, error) {
+	imported, txns, err := client.ReadOFX(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse statement")
+	}
+	if len(imported) == 0 {
+		return nil, errors.New("Statement file does not contain any statements")
+	}
+	unmatched := client.MatchImportedAccounts(imported, txns, []model.Account{account})
+	if len(unmatched) > 0 {
+		return nil, errors.Errorf("Statement for %q does not belong to account %q", model.LedgerAccountName(unmatched[0]), account.Description())
+	}
+	if len(txns) == 0 {
+		return nil, errors.New("Statement does not contain any transactions or balances")
+	}
+	return txns, nil
+}
+
+// statementRange returns the earliest and latest dates in a statement's transactions, including its balance
+func statementRange(txns []ledger.Transaction) (start, end time.Time) {
+	for _, txn := range txns {
+		if start.IsZero() || txn.Date.Before(start) {
+			start = txn.Date
+		}
+		if txn.Date.After(end) {
+			end = txn.Date
+		}
+	}
+	return start, end
+}
+
+// extendsBookmark returns true if a statement from 'start' to 'end' continues from account's sync bookmark, so the bookmark can advance to 'end' without skipping a gap.
+// Accounts without a bookmark, or with a reset bookmark, are left as they are.
+func extendsBookmark(account model.Account, start, end time.Time) bool {
+	bookmark := model.SyncBookmark(account)
+	if bookmark == nil || bookmark.IsZero() {
+		return false
+	}
+	return !start.After(*bookmark) && end.After(*bookmark)
+}
@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/client"
+	"github.com/johnstarich/sage/client/model"
+	"github.com/johnstarich/sage/ledger"
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/johnstarich/sage/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func makeStatement(accountID string) string {
+	return `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<SIGNONMSGSRSV1>
+	<SONRS>
+		<STATUS>
+			<CODE>0
+			<SEVERITY>INFO
+		</STATUS>
+		<DTSERVER>20200110120000
+		<LANGUAGE>ENG
+		<FI>
+			<ORG>SOMEORG
+			<FID>1234
+		</FI>
+	</SONRS>
+</SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+	<STMTTRNRS>
+		<TRNUID>0
+		<STATUS>
+			<CODE>0
+			<SEVERITY>INFO
+		</STATUS>
+		<STMTRS>
+			<CURDEF>USD
+			<BANKACCTFROM>
+				<BANKID>5555
+				<ACCTID>` + accountID + `
+				<ACCTTYPE>CHECKING
+			</BANKACCTFROM>
+			<BANKTRANLIST>
+				<DTSTART>20200101120000
+				<DTEND>20200106120000
+				<STMTTRN>
+					<TRNTYPE>DEBIT
+					<DTPOSTED>20200102120000
+					<TRNAMT>-10.00
+					<FITID>1
+					<NAME>Some Shop
+				</STMTTRN>
+				<STMTTRN>
+					<TRNTYPE>CREDIT
+					<DTPOSTED>20200105120000
+					<TRNAMT>100.00
+					<FITID>2
+					<NAME>Paycheck
+				</STMTTRN>
+			</BANKTRANLIST>
+			<LEDGERBAL>
+				<BALAMT>90.00
+				<DTASOF>20200106120000
+			</LEDGERBAL>
+		</STMTRS>
+	</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+}
+
+func TestUploadStatement(t *testing.T) {
+	accountStore, err := client.NewAccountStore(plaindb.NewMockDB(plaindb.MockConfig{}))
+	require.NoError(t, err)
+	bookmark := time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)
+	account := &model.BasicAccount{
+		AccountID:          "11111234",
+		AccountDescription: "some checking",
+		AccountType:        model.AssetAccount,
+		BasicInstitution:   model.BasicInstitution{InstOrg: "SOMEORG", InstFID: "1234"},
+		LastSync:           &bookmark,
+	}
+	require.NoError(t, accountStore.Add(account))
+	ldgStore, err := ledger.NewStore(&memFile{}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	rulesStore := rules.NewStore(nil)
+
+	_, err = UploadStatement(ldgStore, accountStore, rulesStore, nil, nil, nil, "11111234", strings.NewReader(makeStatement("5678")))
+	require.Error(t, err)
+	assert.Equal(t, `Statement for "assets:SOMEORG:****5678" does not belong to account "some checking"`, err.Error())
+	assert.Empty(t, ldgStore.String())
+
+	results, err := UploadStatement(ldgStore, accountStore, rulesStore, nil, nil, nil, "11111234", strings.NewReader(makeStatement("XXXX1234")))
+	require.NoError(t, err)
+	require.NotNil(t, results)
+	summary := <-results
+	assert.Empty(t, summary.Error)
+	assert.Equal(t, 2, summary.New)
+	require.Len(t, summary.Accounts, 1)
+	assert.Equal(t, model.LedgerAccountName(account), summary.Accounts[0].Account)
+
+	ledgerAccount := model.LedgerAccountName(account)
+	assert.Equal(t, 2, strings.Count(ldgStore.String(), ledgerAccount))
+	newBookmark := getBookmark(t, accountStore, "11111234")
+	require.NotNil(t, newBookmark)
+	assert.True(t, time.Date(2020, 1, 6, 12, 0, 0, 0, time.UTC).Equal(*newBookmark), "Bookmark should advance to the statement's end: %s", newBookmark)
+}
+
+func TestExtendsBookmark(t *testing.T) {
+	bookmark := time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		description string
+		bookmark    *time.Time
+		start, end  time.Time
+		extends     bool
+	}{
+		{description: "no bookmark", start: start, end: end},
+		{description: "reset bookmark", bookmark: &time.Time{}, start: start, end: end},
+		{description: "overlaps bookmark", bookmark: &bookmark, start: start, end: end, extends: true},
+		{description: "gap after bookmark", bookmark: &bookmark, start: bookmark.AddDate(0, 0, 1), end: end},
+		{description: "before bookmark", bookmark: &bookmark, start: start, end: bookmark},
+	} {
+		t.Run(tc.description, func(t *testing.T) {
+			account := &model.BasicAccount{AccountID: "1", LastSync: tc.bookmark}
+			assert.Equal(t, tc.extends, extendsBookmark(account, tc.start, tc.end))
+		})
+	}
+}
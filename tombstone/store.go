@@ -0,0 +1,153 @@
+// Package tombstone records deliberately deleted transactions, so syncs and imports don't add them back
+package tombstone
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/pkg/errors"
+)
+
+const (
+	tombstonesBucket        = "tombstones"
+	tombstonesBucketVersion = "1"
+)
+
+// Tombstone is a deleted transaction's ID, usually derived from its FITID
+type Tombstone struct {
+	ID      string
+	Deleted time.Time
+}
+
+// Store persists each account's set of deleted transaction IDs
+type Store struct {
+	mu     sync.Mutex
+	bucket plaindb.Bucket
+}
+
+// NewStore returns the tombstones bucket
+func NewStore(db plaindb.DB) (*Store, error) {
+	bucket, err := db.Bucket(tombstonesBucket, tombstonesBucketVersion, &storeUpgrader{})
+	return &Store{
+		bucket: bucket,
+	}, err
+}
+
+// Add records the transaction 'id' on 'account' as deleted
+func (s *Store) Add(account, id string, deleted time.Time) error {
+	if strings.TrimSpace(account) == "" || id == "" {
+		return errors.New("Account and transaction ID must not be empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.get(account)
+	if err != nil {
+		return err
+	}
+	ids[id] = deleted
+	return s.bucket.Put(account, ids)
+}
+
+// IsDeleted implements ledger.Tombstones. Lookup failures count as not deleted, so the transaction is imported instead of lost.
+func (s *Store) IsDeleted(account, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.get(account)
+	if err != nil {
+		return false
+	}
+	_, deleted := ids[id]
+	return deleted
+}
+
+// Account returns the tombstones for 'account', oldest first
+func (s *Store) Account(account string) ([]Tombstone, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.get(account)
+	if err != nil {
+		return nil, err
+	}
+	return sortTombstones(ids), nil
+}
+
+// All returns every account's tombstones, oldest first
+func (s *Store) All() (map[string][]Tombstone, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make(map[string][]Tombstone)
+	var ids map[string]time.Time
+	err := s.bucket.Iter(&ids, func(account string) bool {
+		all[account] = sortTombstones(ids)
+		return true
+	})
+	return all, err
+}
+
+// Clear removes the tombstone for transaction 'id' on 'account', or every tombstone for 'account' if 'id' is empty. Cleared transactions are imported again by the next sync.
+// Returns the number of removed tombstones.
+func (s *Store) Clear(account, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.get(account)
+	if err != nil {
+		return 0, err
+	}
+	if id == "" {
+		return len(ids), s.bucket.Put(account, nil)
+	}
+	if _, found := ids[id]; !found {
+		return 0, nil
+	}
+	delete(ids, id)
+	if len(ids) == 0 {
+		return 1, s.bucket.Put(account, nil)
+	}
+	return 1, s.bucket.Put(account, ids)
+}
+
+// get returns a copy of the account's tombstones, since the bucket shares its stored map
+func (s *Store) get(account string) (map[string]time.Time, error) {
+	var stored map[string]time.Time
+	_, err := s.bucket.Get(account, &stored)
+	ids := make(map[string]time.Time, len(stored))
+	for id, deleted := range stored {
+		ids[id] = deleted
+	}
+	return ids, err
+}
+
+func sortTombstones(ids map[string]time.Time) []Tombstone {
+	tombstones := make([]Tombstone, 0, len(ids))
+	for id, deleted := range ids {
+		tombstones = append(tombstones, Tombstone{ID: id, Deleted: deleted})
+	}
+	sort.Slice(tombstones, func(a, b int) bool {
+		if tombstones[a].Deleted.Equal(tombstones[b].Deleted) {
+			return tombstones[a].ID < tombstones[b].ID
+		}
+		return tombstones[a].Deleted.Before(tombstones[b].Deleted)
+	})
+	return tombstones
+}
+
+type storeUpgrader struct{}
+
+func (u *storeUpgrader) Parse(dataVersion, id string, data json.RawMessage) (interface{}, error) {
+	switch dataVersion {
+	case "1":
+		var ids map[string]time.Time
+		err := json.Unmarshal(data, &ids)
+		return ids, err
+	default:
+		return nil, errors.Errorf("Unsupported version: %q", dataVersion)
+	}
+}
+
+func (u *storeUpgrader) Upgrade(dataVersion, id string, data interface{}) (newVersion string, newData interface{}, err error) {
+	return dataVersion, data, nil
+}
@@ -0,0 +1,51 @@
+package tombstone
+
+import (
+	"testing"
+	"time"
+
+	"github.com/johnstarich/sage/plaindb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	db := plaindb.NewMockDB(plaindb.MockConfig{FileReader: func(fileName string) ([]byte, error) {
+		return []byte(`{}`), nil
+	}})
+	store, err := NewStore(db)
+	require.NoError(t, err)
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	assert.False(t, store.IsDeleted("assets:Bank", "1"))
+	assert.Error(t, store.Add("assets:Bank", "", first))
+	require.NoError(t, store.Add("assets:Bank", "2", second))
+	require.NoError(t, store.Add("assets:Bank", "1", first))
+	require.NoError(t, store.Add("liabilities:Card", "3", first))
+	assert.True(t, store.IsDeleted("assets:Bank", "1"))
+	assert.False(t, store.IsDeleted("liabilities:Card", "1"), "Tombstones should be per-account")
+
+	tombstones, err := store.Account("assets:Bank")
+	require.NoError(t, err)
+	assert.Equal(t, []Tombstone{{ID: "1", Deleted: first}, {ID: "2", Deleted: second}}, tombstones)
+	all, err := store.All()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]Tombstone{
+		"assets:Bank":      {{ID: "1", Deleted: first}, {ID: "2", Deleted: second}},
+		"liabilities:Card": {{ID: "3", Deleted: first}},
+	}, all)
+
+	cleared, err := store.Clear("assets:Bank", "1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, cleared)
+	assert.False(t, store.IsDeleted("assets:Bank", "1"))
+	assert.True(t, store.IsDeleted("assets:Bank", "2"))
+
+	cleared, err = store.Clear("liabilities:Card", "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, cleared)
+	tombstones, err = store.Account("liabilities:Card")
+	require.NoError(t, err)
+	assert.Empty(t, tombstones)
+}
@@ -0,0 +1,121 @@
+package vcs
+
+import (
+	"io"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+var (
+	// ErrVersionNotFound is returned when a file has no committed version with the requested ID
+	ErrVersionNotFound = errors.New("Version not found")
+
+	commitHashPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// Version is a committed revision of a file
+type Version struct {
+	ID   string
+	Time time.Time
+}
+
+// VersionedFile is a File with read access to its committed history
+type VersionedFile interface {
+	File
+	// Versions returns the committed versions of this file, newest first
+	Versions() ([]Version, error)
+	// ReadVersion returns the contents of this file as of version 'id'
+	ReadVersion(id string) ([]byte, error)
+}
+
+func (f *file) Versions() ([]Version, error) {
+	return f.repo.versions(f.path)
+}
+
+func (f *file) ReadVersion(id string) ([]byte, error) {
+	return f.repo.readVersion(f.path, id)
+}
+
+// relativePath returns 'path' relative to the repo's root, as stored in git trees
+func (s *syncRepo) relativePath(path string) (string, error) {
+	tree, err := s.repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	rootPath, err := filepath.Abs(tree.Filesystem.Root())
+	if err != nil {
+		return "", err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	path, err = filepath.Rel(rootPath, path)
+	return filepath.ToSlash(path), err
+}
+
+func (s *syncRepo) versions(path string) ([]Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	relPath, err := s.relativePath(path)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := s.repo.Log(&git.LogOptions{FileName: &relPath})
+	if err == plumbing.ErrReferenceNotFound {
+		// no commits yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []Version
+	err = commits.ForEach(func(commit *object.Commit) error {
+		versions = append(versions, Version{
+			ID:   commit.Hash.String(),
+			Time: commit.Author.When,
+		})
+		return nil
+	})
+	if err == io.EOF {
+		// file-filtered logs can return EOF when reaching the first commit
+		err = nil
+	}
+	return versions, err
+}
+
+func (s *syncRepo) readVersion(path, id string) ([]byte, error) {
+	if !commitHashPattern.MatchString(id) {
+		return nil, ErrVersionNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	relPath, err := s.relativePath(path)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := s.repo.CommitObject(plumbing.NewHash(id))
+	if err == plumbing.ErrObjectNotFound {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := commit.File(relPath)
+	if err == object.ErrFileNotFound {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	contents, err := f.Contents()
+	return []byte(contents), err
+}
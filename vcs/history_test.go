@@ -0,0 +1,46 @@
+package vcs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileVersions(t *testing.T) {
+	cleanup := func() {
+		require.NoError(t, os.RemoveAll(testDBPath))
+	}
+	cleanup()
+	defer cleanup()
+
+	repoInt, err := Open(testDBPath, nil)
+	require.NoError(t, err)
+	f := repoInt.File(testDBPath + "/ledger.journal").(VersionedFile)
+	other := repoInt.File(testDBPath + "/other.json")
+
+	versions, err := f.Versions()
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+
+	require.NoError(t, f.Write([]byte("first")))
+	require.NoError(t, other.Write([]byte("unrelated")))
+	require.NoError(t, f.Write([]byte("second")))
+
+	versions, err = f.Versions()
+	require.NoError(t, err)
+	require.Len(t, versions, 2, "Only commits changing the file should be listed")
+
+	contents, err := f.ReadVersion(versions[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(contents))
+	contents, err = f.ReadVersion(versions[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(contents))
+
+	_, err = f.ReadVersion("not a hash")
+	assert.Equal(t, ErrVersionNotFound, err)
+	_, err = f.ReadVersion("0123456789012345678901234567890123456789")
+	assert.Equal(t, ErrVersionNotFound, err)
+}
@@ -8,11 +8,13 @@ import (
 type File interface {
 	Write(b []byte) error
 	Read() ([]byte, error)
+	// Path returns the file's path on disk
+	Path() string
 }
 
 type file struct {
 	path string
-	repo Repository
+	repo *syncRepo
 }
 
 func (repo *syncRepo) File(path string) File {
@@ -26,6 +28,10 @@ func (f *file) Write(b []byte) error {
 	return f.repo.CommitFiles(diskWriter(f.path, b), "Update "+f.path, f.path)
 }
 
+func (f *file) Path() string {
+	return f.path
+}
+
 func (f *file) Read() ([]byte, error) {
 	buf, err := ioutil.ReadFile(f.path)
 	if os.IsNotExist(err) {
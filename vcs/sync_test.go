@@ -16,7 +16,7 @@ func TestFile(t *testing.T) {
 	cleanup()
 	defer cleanup()
 
-	repoInt, err := Open("./testdb")
+	repoInt, err := Open("./testdb", nil)
 	require.NoError(t, err)
 	repo := repoInt.(*syncRepo)
 
@@ -22,8 +22,12 @@ type Repository interface {
 	File(path string) File
 }
 
-// Open ensures a Git repo exists at 'path' and returns its Repository
-func Open(path string) (Repository, error) {
+// WriteGuard returns an error if this process may not write to the repository, e.g. another process holds the data directory lock
+type WriteGuard func() error
+
+// Open ensures a Git repo exists at 'path' and returns its Repository.
+// Every write first checks 'guard', if non-nil.
+func Open(path string, guard WriteGuard) (Repository, error) {
 	path = filepath.Clean(path)
 	if err := os.MkdirAll(path, 0750); err != nil {
 		return nil, err
@@ -32,14 +36,25 @@ func Open(path string) (Repository, error) {
 		DetectDotGit: false,
 	})
 	if err == git.ErrRepositoryNotExists {
+		if err := guard.check(); err != nil {
+			return nil, err
+		}
 		repo, err = initVCS(path)
 	}
-	return &syncRepo{repo: repo}, err
+	return &syncRepo{repo: repo, guard: guard}, err
+}
+
+func (g WriteGuard) check() error {
+	if g == nil {
+		return nil
+	}
+	return g()
 }
 
 type syncRepo struct {
-	repo *git.Repository
-	mu   sync.Mutex
+	repo  *git.Repository
+	guard WriteGuard
+	mu    sync.Mutex
 }
 
 func initVCS(path string) (*git.Repository, error) {
@@ -100,6 +115,9 @@ func (s *syncRepo) CommitFiles(prepFiles func() error, message string, paths ...
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.guard.check(); err != nil {
+		return err
+	}
 
 	var err error
 	var tree *git.Worktree
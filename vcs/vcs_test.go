@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/src-d/go-git.v4"
@@ -27,7 +28,7 @@ func TestOpen(t *testing.T) {
 	err = ioutil.WriteFile(filepath.Join(testDBPath, "bucket.json"), []byte(`{}`), 0750)
 	require.NoError(t, err)
 
-	repoInt, err := Open(testDBPath)
+	repoInt, err := Open(testDBPath, nil)
 	require.NoError(t, err)
 	require.IsType(t, &syncRepo{}, repoInt)
 
@@ -60,7 +61,7 @@ func TestOpenMkdirErr(t *testing.T) {
 
 	err := ioutil.WriteFile(testDBPath, []byte(`I'm not a database!`), 0750)
 	require.NoError(t, err)
-	_, err = Open(testDBPath)
+	_, err = Open(testDBPath, nil)
 	require.Error(t, err)
 	assert.Equal(t, "mkdir testdb: not a directory", err.Error())
 }
@@ -69,7 +70,7 @@ func TestCommitFiles(t *testing.T) {
 	cleanupTestDB(t)
 	defer cleanupTestDB(t)
 
-	repoInt, err := Open(testDBPath)
+	repoInt, err := Open(testDBPath, nil)
 	require.NoError(t, err)
 	require.IsType(t, &syncRepo{}, repoInt)
 	repo := repoInt.(*syncRepo)
@@ -110,7 +111,7 @@ func TestCommitNoChanges(t *testing.T) {
 	cleanupTestDB(t)
 	defer cleanupTestDB(t)
 
-	repoInt, err := Open(testDBPath)
+	repoInt, err := Open(testDBPath, nil)
 	require.NoError(t, err)
 	require.IsType(t, &syncRepo{}, repoInt)
 	repo := repoInt.(*syncRepo)
@@ -138,3 +139,27 @@ func TestCommitNoChanges(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, 1, getCount(), "no commit should be made for unchanged file")
 }
+
+func TestCommitWriteGuard(t *testing.T) {
+	cleanupTestDB(t)
+	defer cleanupTestDB(t)
+
+	_, err := Open(testDBPath, nil)
+	require.NoError(t, err)
+
+	guardErr := errors.New("some guard error")
+	repo, err := Open(testDBPath, func() error { return guardErr })
+	require.NoError(t, err)
+
+	prepared := false
+	err = repo.CommitFiles(func() error {
+		prepared = true
+		return nil
+	}, "add some file", filepath.Join(testDBPath, "some file.txt"))
+	assert.Equal(t, guardErr, err)
+	assert.False(t, prepared, "guarded writes should not prepare files")
+
+	cleanupTestDB(t)
+	_, err = Open(testDBPath, func() error { return guardErr })
+	assert.Equal(t, guardErr, err, "guarded repos should not be initialized")
+}
@@ -7,6 +7,7 @@ import Container from 'react-bootstrap/Container';
 import Crumb from './Breadcrumb';
 import React from 'react';
 import Row from 'react-bootstrap/Row';
+import { confirmWarnings } from './RuleEditor';
 import API from './API';
 import './Categories.css';
 import cellEditFactory, { Type } from 'react-bootstrap-table2-editor';
@@ -85,8 +86,14 @@ export default function Categories({ match }) {
       Conditions: rule.Conditions.split('\n'),
     }))
     API.post('/v1/updateRules', apiRules)
+      .catch(e => {
+        if (e.response && e.response.status === 409 && confirmWarnings(e.response.data.Warnings)) {
+          return API.post('/v1/updateRules', apiRules, { params: { force: true } })
+        }
+        throw e
+      })
       .then(() => setRules(newRules))
-      .catch(e => alert(`Error saving rules. ${e.response.data.Error || ""}`))
+      .catch(e => e.response && alert(`Error saving rules. ${e.response.data.Error || ""}`))
   }
 
   const cellEdit = cellEditFactory({
@@ -28,7 +28,13 @@ export default function ImportAccounts() {
               throw Error("Must provide one file to import")
             }
             API.post('/v1/importOFX', files[0])
-              .then(() => window.location.reload())
+              .then(res => {
+                const unmatched = res.data.Unmatched || []
+                if (unmatched.length > 0) {
+                  alert(`No matching accounts found for these statements, so new accounts were created: ${unmatched.join(', ')}`)
+                }
+                window.location.reload()
+              })
               .catch(e => {
                 if (!e.response.data || !e.response.data.Error) {
                   throw e
@@ -10,6 +10,23 @@ import { cleanCategory } from './CategoryPicker';
 
 const amountExpr = `\\d+(\\.\\d+)?`
 
+export function confirmWarnings(warnings) {
+  const messages = (warnings || []).map(w => `- ${w.Message}`).join('\n')
+  return window.confirm(`These rules may have mistakes:\n${messages}\n\nSave anyway?`)
+}
+
+// postRule saves a rule change, confirming any warnings before forcing the save
+async function postRule(path, body) {
+  try {
+    return await API.post(path, body)
+  } catch (e) {
+    if (e.response && e.response.status === 409 && confirmWarnings(e.response.data.Warnings)) {
+      return API.post(path, body, { params: { force: true } })
+    }
+    throw e
+  }
+}
+
 function payeeRegex(payee) {
   return RegExp.escape(payee.toLocaleLowerCase())
 }
@@ -125,9 +142,9 @@ export default function ({ transaction, onClose, rule, setRule, removeRule }) {
       Index: rule.Index,
     })
     if (condition) {
-      await API.post('/v1/updateRule', newRule)
+      await postRule('/v1/updateRule', newRule)
     } else {
-      const res = await API.post('/v1/addRule', newRule)
+      const res = await postRule('/v1/addRule', newRule)
       newRule.Index = Number(res.data.Index)
     }
     setRule(newRule)
@@ -137,7 +154,7 @@ export default function ({ transaction, onClose, rule, setRule, removeRule }) {
   const deleteRule = async () => {
     let newConditions = rule.Conditions.slice()
     if (condition && newConditions.length === 1) {
-      await API.post('/v1/deleteRule', { Index: rule.Index })
+      await postRule('/v1/deleteRule', { Index: rule.Index })
       removeRule()
       onClose()
       return